@@ -0,0 +1,618 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/check"
+	"github.com/arifali123/152compiler/packages/cli"
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/desugar"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/emulator"
+	"github.com/arifali123/152compiler/packages/format"
+	"github.com/arifali123/152compiler/packages/grade"
+	"github.com/arifali123/152compiler/packages/ir"
+	"github.com/arifali123/152compiler/packages/manifest"
+	"github.com/arifali123/152compiler/packages/opt"
+)
+
+// readSource loads the single file argument
+func readSource(ctx *cli.Context) (string, string, error) {
+	if len(ctx.Args) != 1 {
+		return "", "", cli.Usagef("expected exactly one source file")
+	}
+	return readPath(ctx, ctx.Args[0])
+}
+
+// readPath loads one source file; "-" reads standard input
+func readPath(ctx *cli.Context, path string) (string, string, error) {
+	if path == "-" {
+		content, err := io.ReadAll(ctx.Stdin)
+		return "<stdin>", string(content), err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("reading file: %w", err)
+	}
+	return path, string(content), nil
+}
+
+// openPath opens one source file for reading as a stream; "-" is standard
+// input. The caller closes it.
+func openPath(ctx *cli.Context, path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(ctx.Stdin), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	return f, nil
+}
+
+// reportDiagnostics renders diagnostics to stderr and returns an ExitError
+// if any of them is an error
+func reportDiagnostics(ctx *cli.Context, path, source string, diags []diag.Diagnostic) error {
+	r := &diag.Renderer{
+		Out:    ctx.Stderr,
+		Color:  diag.ColorEnabled(ctx.Stderr, noColor),
+		Source: source,
+	}
+	for _, d := range diags {
+		d.File = path
+		r.Render(d)
+	}
+	if diag.HasErrors(diags) {
+		return &cli.ExitError{Code: 1}
+	}
+	return nil
+}
+
+// compileFile reads and compiles the file argument, reporting any errors.
+// It returns the path and source it read along with the result.
+func compileFile(ctx *cli.Context, opts compiler.Options) (string, string, *compiler.Result, error) {
+	if len(ctx.Args) != 1 {
+		return "", "", nil, cli.Usagef("expected exactly one source file")
+	}
+	return compilePath(ctx, ctx.Args[0], opts)
+}
+
+// compilePath reads and compiles one source file, reporting any errors
+func compilePath(ctx *cli.Context, path string, opts compiler.Options) (string, string, *compiler.Result, error) {
+	path, source, err := readPath(ctx, path)
+	if err != nil {
+		return "", "", nil, err
+	}
+	res := compiler.CompileWith(source, opts)
+	if err := reportDiagnostics(ctx, path, source, res.Diagnostics); err != nil {
+		return path, source, res, err
+	}
+	return path, source, res, nil
+}
+
+func buildCommand() *cli.Command {
+	var output, target, syscalls, limit, template, macros, report string
+	var wordSize int
+	var stats, split, listing, withManifest bool
+	var opts compiler.Options
+	shared := codegenFlags{checkFlags: checkFlags{opts: &opts}}
+	var flags *flag.FlagSet
+	return &cli.Command{
+		Name:  "build",
+		Usage: "[flags] <file.py>",
+		Short: "compile a program to MIPS assembly",
+		Long:  "Without -o the assembly is written to out/<name>.s. Use -o - for standard output.",
+		Flags: func(fs *flag.FlagSet) {
+			flags = fs
+			fs.StringVar(&output, "o", "", "output `file`")
+			fs.BoolVar(&opts.Codegen.FrameTrailer, "frames", false, "append a comment describing each function's stack frame")
+			shared.register(fs, "declare the simulator's byte `order`, big or little, in an output header")
+			fs.BoolVar(&opts.Optimize, "O", false, "optimize: substitute globals assigned once from constants")
+			fs.BoolVar(&opts.Opt.KeepStorage, "keep-constants", false, "with -O, still allocate storage for substituted constants")
+			fs.StringVar(&target, "target", "mars", "target `dialect`: "+strings.Join(codegen.TargetNames(), ", "))
+			fs.StringVar(&syscalls, "syscalls", "", "comma-separated `name=number` syscall overrides: "+strings.Join(codegen.SyscallNames(), ", "))
+			fs.IntVar(&wordSize, "wordsize", 32, "register width in `bits`: 32, or 64 for MIPS64 (ld/sd, daddu)")
+			fs.StringVar(&template, "template", "", "wrap the output in a template `file` whose {{data}} and {{text}} lines are replaced by the generated sections")
+			fs.StringVar(&macros, "macros", "", "write a macro prelude `file` at the top and call its print_int, print_str and exit macros instead of raw syscalls")
+			fs.BoolVar(&stats, "stats", false, "print instruction, data, string and label counts to stderr")
+			fs.BoolVar(&listing, "listing", false, "also write a .lst file interleaving each source line with its assembly")
+			fs.BoolVar(&split, "split-output", false, "write each function to its own file next to the output, which includes them")
+			fs.StringVar(&limit, "limit", "", "comma-separated `name=number` size caps that fail the build: "+strings.Join(codegen.LimitNames(), ", "))
+			fs.BoolVar(&withManifest, "manifest", false, "also write a .json manifest of the input, options, outputs with their SHA-256 hashes and diagnostic counts")
+			fs.StringVar(&report, "report", "", "write a JSON compilation report of phase timings, diagnostics, symbol counts, code size and optimizations to `file`, even when the build fails")
+		},
+		Run: func(ctx *cli.Context) error {
+			t, ok := codegen.LookupTarget(target)
+			if !ok {
+				return cli.Usagef("unknown target %q", target)
+			}
+			if wordSize != 32 && wordSize != 64 {
+				return cli.Usagef("word size must be 32 or 64, got %d", wordSize)
+			}
+			t.WordSize = wordSize
+			table, err := codegen.ParseSyscalls(syscalls)
+			if err != nil {
+				return cli.Usagef("%v", err)
+			}
+			t.Syscalls = table
+			opts.Codegen.Target = t
+			if err := shared.apply(ctx); err != nil {
+				return err
+			}
+			if template != "" {
+				text, err := os.ReadFile(template)
+				if err != nil {
+					return err
+				}
+				if opts.Codegen.Template, err = codegen.ParseTemplate(string(text)); err != nil {
+					return fmt.Errorf("%s: %v", template, err)
+				}
+			}
+			if macros != "" {
+				text, err := os.ReadFile(macros)
+				if err != nil {
+					return err
+				}
+				if opts.Codegen.Macros, err = codegen.ParseMacros(string(text)); err != nil {
+					return fmt.Errorf("%s: %v", macros, err)
+				}
+			}
+			limits, err := codegen.ParseLimits(limit)
+			if err != nil {
+				return cli.Usagef("%v", err)
+			}
+			if output == "-" && (split || listing || withManifest) {
+				return cli.Usagef("-split-output, -listing and -manifest need an output file, not standard output")
+			}
+			var m *manifest.Manifest
+			if withManifest {
+				m = manifest.New(flagValues(flags))
+			}
+
+			path, source, res, err := compileFile(ctx, opts)
+			if res == nil {
+				return err
+			}
+			if report != "" {
+				data, rerr := res.Report().JSON()
+				if rerr == nil {
+					rerr = os.WriteFile(report, data, 0644)
+				}
+				if rerr != nil {
+					return fmt.Errorf("writing report: %w", rerr)
+				}
+			}
+			if output == "" {
+				base := filepath.Base(path)
+				output = filepath.Join("out", strings.TrimSuffix(base, filepath.Ext(base))+".s")
+			}
+			// writeFile writes one output of the build and records it in the manifest
+			writeFile := func(name, text string) error {
+				if m != nil {
+					m.AddOutput(name, []byte(text))
+				}
+				return os.WriteFile(name, []byte(text), 0644)
+			}
+			// finish writes the manifest, which is kept for failed builds too
+			finish := func(failed bool) error {
+				if m == nil {
+					return nil
+				}
+				m.AddInput(path, []byte(source))
+				m.Count(res.Diagnostics)
+				m.Failed = m.Failed || failed
+				data, err := m.JSON()
+				if err != nil {
+					return err
+				}
+				name := strings.TrimSuffix(output, filepath.Ext(output)) + ".json"
+				if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+					return fmt.Errorf("creating output directory: %w", err)
+				}
+				if err := os.WriteFile(name, data, 0644); err != nil {
+					return fmt.Errorf("writing manifest file: %w", err)
+				}
+				fmt.Fprintf(ctx.Stdout, "Manifest written to %s\n", name)
+				return nil
+			}
+			if err != nil {
+				if ferr := finish(true); ferr != nil {
+					return ferr
+				}
+				return err
+			}
+
+			size := codegen.Measure(res.Assembly)
+			if stats {
+				fmt.Fprintln(ctx.Stderr, size)
+			}
+			if over := size.Exceeded(limits); len(over) > 0 {
+				for _, o := range over {
+					fmt.Fprintf(ctx.Stderr, "size limit exceeded: %s\n", o)
+				}
+				if err := finish(true); err != nil {
+					return err
+				}
+				return &cli.ExitError{Code: 1}
+			}
+
+			if output == "-" {
+				fmt.Fprintln(ctx.Stdout, res.Assembly)
+				return nil
+			}
+			if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+				return fmt.Errorf("creating output directory: %w", err)
+			}
+			if listing {
+				lst := strings.TrimSuffix(output, filepath.Ext(output)) + ".lst"
+				if err := writeFile(lst, codegen.Listing(source, res.Assembly, res.SourceMap)); err != nil {
+					return fmt.Errorf("writing listing file: %w", err)
+				}
+				fmt.Fprintf(ctx.Stdout, "Listing written to %s\n", lst)
+			}
+			assembly := res.Assembly
+			if split {
+				var files []codegen.SplitFile
+				stem := strings.TrimSuffix(filepath.Base(output), filepath.Ext(output))
+				assembly, files = codegen.Split(assembly, res.Functions, func(function string) string {
+					return stem + "_" + function + ".s"
+				})
+				for _, f := range files {
+					path := filepath.Join(filepath.Dir(output), f.Name)
+					if err := writeFile(path, f.Text); err != nil {
+						return fmt.Errorf("writing output file: %w", err)
+					}
+					fmt.Fprintf(ctx.Stdout, "%s written to %s\n", f.Function, path)
+				}
+			}
+			if err := writeFile(output, assembly); err != nil {
+				return fmt.Errorf("writing output file: %w", err)
+			}
+			fmt.Fprintf(ctx.Stdout, "MIPS code written to %s\n", output)
+			return finish(false)
+		},
+	}
+}
+
+// flagValues maps the name of every flag in fs to its value, set or not
+func flagValues(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+// parseEndian reads an -endian flag, which may be left empty
+func parseEndian(name string) (codegen.Endianness, error) {
+	if name == "" {
+		return codegen.EndianUnstated, nil
+	}
+	e, err := codegen.ParseEndianness(name)
+	if err != nil {
+		return e, cli.Usagef("%v", err)
+	}
+	return e, nil
+}
+
+// parseLang reads a -lang flag, which may be left empty
+func parseLang(name string) (check.Level, error) {
+	if name == "" {
+		return check.AnyLevel, nil
+	}
+	l, err := check.ParseLevel(name)
+	if err != nil {
+		return l, cli.Usagef("%v", err)
+	}
+	return l, nil
+}
+
+// checkFlags are the checker flags every command that analyzes a program
+// accepts
+type checkFlags struct {
+	opts  *compiler.Options
+	lang  string
+	trace bool
+}
+
+func (f *checkFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.opts.Strict, "strict", false, "treat warnings, reads of never-assigned variables, calls to undefined functions and arithmetic on strings as errors")
+	fs.StringVar(&f.lang, "lang", "", "reject constructs above a course `level`: level1 (assignments and print), level2 (control flow) or level3 (functions)")
+	fs.BoolVar(&f.trace, "trace", false, "print each token lexed and each statement and block parsed to stderr")
+	fs.BoolVar(&f.opts.NoRecover, "no-recover", false, "crash with a Go panic rather than report an internal compiler error, for debugging the compiler")
+}
+
+// apply validates the flags and stores them in the options
+func (f *checkFlags) apply(ctx *cli.Context) error {
+	if f.trace {
+		f.opts.Trace = log.New(ctx.Stderr, "trace: ", 0)
+	}
+	var err error
+	f.opts.Lang, err = parseLang(f.lang)
+	return err
+}
+
+// codegenFlags are the checker flags plus the code generation flags that
+// build and run share. The -endian help differs: build declares the order
+// in a header, run emulates it.
+type codegenFlags struct {
+	checkFlags
+	endian, loopRegs string
+}
+
+func (f *codegenFlags) register(fs *flag.FlagSet, endianUsage string) {
+	f.checkFlags.register(fs)
+	fs.BoolVar(&f.opts.Codegen.Checked, "checked", false, "guard stack frames with a canary and abort on reads of unassigned globals, on division by zero and on runaway recursion")
+	fs.IntVar(&f.opts.Codegen.MaxDepth, "max-depth", codegen.DefaultMaxDepth, "with -checked, abort when more than `n` function calls are under way at once")
+	fs.IntVar(&f.opts.Codegen.MaxIterations, "max-iterations", 0, "abort after `n` loop iterations in all, counted by the generated code; 0 counts nothing")
+	fs.StringVar(&f.opts.Codegen.Entry, "entry", "", "run the top-level statements as an init routine, then call the function `name`")
+	fs.StringVar(&f.endian, "endian", "", endianUsage)
+	fs.StringVar(&f.loopRegs, "loop-registers", "", "comma-separated saved `registers`, such as $s0, to keep the counters of innermost loops in")
+}
+
+// apply validates the flags and stores them in the options, filling in the
+// target already chosen
+func (f *codegenFlags) apply(ctx *cli.Context) error {
+	if err := f.checkFlags.apply(ctx); err != nil {
+		return err
+	}
+	c := &f.opts.Codegen
+	if c.MaxDepth < 1 {
+		return cli.Usagef("max depth must be at least 1, got %d", c.MaxDepth)
+	}
+	if c.MaxIterations < 0 {
+		return cli.Usagef("max iterations cannot be negative, got %d", c.MaxIterations)
+	}
+	var err error
+	if c.Target.Endian, err = parseEndian(f.endian); err != nil {
+		return err
+	}
+	if c.Target.LoopRegisters, err = codegen.ParseLoopRegisters(f.loopRegs); err != nil {
+		return cli.Usagef("%v", err)
+	}
+	return nil
+}
+
+func runCommand() *cli.Command {
+	var maxSteps int
+	var steps, stats bool
+	var opts compiler.Options
+	shared := codegenFlags{checkFlags: checkFlags{opts: &opts}}
+	return &cli.Command{
+		Name:  "run",
+		Usage: "[flags] <file.py>",
+		Short: "compile a program and execute it in the built-in emulator",
+		Long:  "Program input is read from standard input. The exit status is the program's.",
+		Flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&maxSteps, "max-steps", emulator.DefaultMaxSteps, "abort after `n` instructions")
+			fs.BoolVar(&steps, "steps", false, "print the executed instruction count to stderr")
+			fs.BoolVar(&stats, "stats", false, "print loop induction variables, trip counts and per-loop instruction counts to stderr")
+			fs.BoolVar(&opts.Optimize, "O", false, "optimize before running")
+			shared.register(fs, "byte `order` of the emulated memory, big or little")
+		},
+		Run: func(ctx *cli.Context) error {
+			if err := shared.apply(ctx); err != nil {
+				return err
+			}
+			_, _, res, err := compileFile(ctx, opts)
+			if err != nil {
+				return err
+			}
+			m, err := emulator.Load(res.Assembly)
+			if err != nil {
+				return err
+			}
+			result, err := m.Run(emulator.Config{
+				Stdin:    ctx.Stdin,
+				Stdout:   ctx.Stdout,
+				MaxSteps: maxSteps,
+				Profile:  stats,
+			})
+			if err != nil {
+				return err
+			}
+			switch {
+			case stats:
+				writeLoopStats(ctx.Stderr, opt.Loops(res.Program), res.Loops, m, result)
+			case steps:
+				fmt.Fprintf(ctx.Stderr, "%d instructions executed\n", result.Steps)
+			}
+			if result.ExitCode != 0 {
+				return &cli.ExitError{Code: result.ExitCode}
+			}
+			return nil
+		},
+	}
+}
+
+func tokensCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "tokens",
+		Usage: "<file.py>",
+		Short: "print the token stream produced by the lexer",
+		Run: func(ctx *cli.Context) error {
+			if len(ctx.Args) != 1 {
+				return cli.Usagef("expected exactly one source file")
+			}
+			in, err := openPath(ctx, ctx.Args[0])
+			if err != nil {
+				return err
+			}
+			defer in.Close()
+			tokens, err := compiler.TokensFrom(in)
+			for _, tok := range tokens {
+				fmt.Fprintf(ctx.Stdout, "%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+			}
+			if err != nil {
+				return fmt.Errorf("reading file: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+func astCommand() *cli.Command {
+	var core bool
+	return &cli.Command{
+		Name:  "ast",
+		Usage: "[flags] <file.py>",
+		Short: "print the abstract syntax tree",
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&core, "desugar", false, "print the core tree the checker and code generator see")
+		},
+		Run: func(ctx *cli.Context) error {
+			path, source, err := readSource(ctx)
+			if err != nil {
+				return err
+			}
+			program, diags := compiler.Parse(source)
+			if err := reportDiagnostics(ctx, path, source, diags); err != nil {
+				return err
+			}
+			if core {
+				program = desugar.Program(program)
+			}
+			fmt.Fprint(ctx.Stdout, ast.Dump(program))
+			return nil
+		},
+	}
+}
+
+func irCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ir",
+		Usage: "<file.py>",
+		Short: "print the three-address code for a program",
+		Run: func(ctx *cli.Context) error {
+			path, source, err := readSource(ctx)
+			if err != nil {
+				return err
+			}
+			program, diags := compiler.Analyze(source)
+			if err := reportDiagnostics(ctx, path, source, diags); err != nil {
+				return err
+			}
+			fmt.Fprint(ctx.Stdout, ir.Lower(program).String())
+			return nil
+		},
+	}
+}
+
+func fmtCommand() *cli.Command {
+	var write bool
+	return &cli.Command{
+		Name:  "fmt",
+		Usage: "[flags] <file.py>",
+		Short: "reformat a program in canonical style, keeping comments and blank lines",
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&write, "w", false, "write the result back to the source file")
+		},
+		Run: func(ctx *cli.Context) error {
+			path, source, err := readSource(ctx)
+			if err != nil {
+				return err
+			}
+			program, diags := compiler.Parse(source)
+			if err := reportDiagnostics(ctx, path, source, diags); err != nil {
+				return err
+			}
+			formatted := format.SourceWithTrivia(program, compiler.TokensWithTrivia(source))
+			if !write || path == "<stdin>" {
+				fmt.Fprint(ctx.Stdout, formatted)
+				return nil
+			}
+			if formatted == source {
+				return nil
+			}
+			return os.WriteFile(path, []byte(formatted), 0644)
+		},
+	}
+}
+
+func lintCommand() *cli.Command {
+	var opts compiler.Options
+	shared := checkFlags{opts: &opts}
+	return &cli.Command{
+		Name:  "lint",
+		Usage: "[flags] <file.py>",
+		Short: "check a program for errors without generating code",
+		Flags: func(fs *flag.FlagSet) {
+			shared.register(fs)
+		},
+		Run: func(ctx *cli.Context) error {
+			if err := shared.apply(ctx); err != nil {
+				return err
+			}
+			path, source, err := readSource(ctx)
+			if err != nil {
+				return err
+			}
+			_, diags := compiler.AnalyzeWith(source, opts)
+			return reportDiagnostics(ctx, path, source, diags)
+		},
+	}
+}
+
+func gradeCommand() *cli.Command {
+	var tests, reportFormat, output string
+	var maxSteps int
+	var compileTimeout time.Duration
+	return &cli.Command{
+		Name:  "grade",
+		Usage: "[flags] <submissions-dir>",
+		Short: "compile and test a directory of submissions",
+		Long: `Every .py file in the directory is a submission, as is every subdirectory
+holding main.py or a single .py file. With -tests, each NAME.out in that
+directory is a test case whose standard input is the matching NAME.in.`,
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&tests, "tests", "", "`dir` of NAME.in/NAME.out test cases")
+			fs.StringVar(&reportFormat, "format", "csv", "report `format`: csv or json")
+			fs.StringVar(&output, "o", "", "write the report to `file` instead of stdout")
+			fs.IntVar(&maxSteps, "max-steps", emulator.DefaultMaxSteps, "abort each run after `n` instructions")
+			fs.DurationVar(&compileTimeout, "compile-timeout", grade.DefaultCompileTimeout, "give up on a submission whose compilation takes longer than `d`")
+		},
+		Run: func(ctx *cli.Context) error {
+			if len(ctx.Args) != 1 {
+				return cli.Usagef("expected a submissions directory")
+			}
+			if reportFormat != "csv" && reportFormat != "json" {
+				return cli.Usagef("unknown report format %q", reportFormat)
+			}
+			subs, err := grade.FindSubmissions(ctx.Args[0])
+			if err != nil {
+				return err
+			}
+			var cases []grade.Case
+			if tests != "" {
+				if cases, err = grade.LoadCases(tests); err != nil {
+					return err
+				}
+			}
+
+			report := grade.Grade(subs, cases, grade.Config{MaxSteps: maxSteps, CompileTimeout: compileTimeout})
+
+			w := ctx.Stdout
+			if output != "" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			if reportFormat == "json" {
+				return report.WriteJSON(w)
+			}
+			return report.WriteCSV(w)
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/cli"
+	"github.com/arifali123/152compiler/packages/conformance"
+)
+
+func conformCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "conform",
+		Usage: "[fixtures-dir]",
+		Short: "run the conformance suite on every target, with and without -O",
+		Long: `Each .py file in the directory, test_data/conformance by default, is a
+fixture whose leading comments give the output it must print (# output:)
+or the diagnostics it must report (# error: and # warning:, each as
+line:column: message). A failing fixture is printed with what differed.`,
+		Run: func(ctx *cli.Context) error {
+			dir := "test_data/conformance"
+			switch len(ctx.Args) {
+			case 0:
+			case 1:
+				dir = ctx.Args[0]
+			default:
+				return cli.Usagef("expected at most one fixtures directory")
+			}
+			fixtures, err := conformance.Load(dir)
+			if err != nil {
+				return err
+			}
+			failed := 0
+			results := conformance.Run(fixtures)
+			for _, r := range results {
+				if r.Err != nil {
+					failed++
+					fmt.Fprintf(ctx.Stdout, "FAIL %s [%s]: %s\n", r.Fixture, r.Variant, strings.TrimRight(r.Err.Error(), "\n"))
+				}
+			}
+			fmt.Fprintf(ctx.Stdout, "%d fixtures, %d checks, %d failed\n", len(fixtures), len(results), failed)
+			if failed > 0 {
+				return &cli.ExitError{Code: 1}
+			}
+			return nil
+		},
+	}
+}
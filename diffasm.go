@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/arifali123/152compiler/packages/cli"
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/compiler"
+)
+
+func diffAsmCommand() *cli.Command {
+	var context int
+	var opts compiler.Options
+	return &cli.Command{
+		Name:  "diff-asm",
+		Usage: "[flags] <before.py> [<after.py>]",
+		Short: "compare the assembly generated for two programs",
+		Long: `With two files, both are compiled with the same flags. With one, it is
+compiled without and then with -O to show what optimizing changed.
+Comments and spacing are ignored, generated labels are renumbered and
+temporary registers are renamed in order of use within each function, so
+only differences in the code itself are shown.`,
+		Flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&context, "U", 3, "show `n` unchanged lines around each change")
+			fs.BoolVar(&opts.Optimize, "O", false, "optimize both programs when comparing two files")
+			fs.BoolVar(&opts.Codegen.Checked, "checked", false, "guard stack frames with a canary and abort on reads of unassigned globals and on division by zero")
+		},
+		Run: func(ctx *cli.Context) error {
+			if len(ctx.Args) < 1 || len(ctx.Args) > 2 {
+				return cli.Usagef("expected one or two source files")
+			}
+			if context < 0 {
+				return cli.Usagef("-U must not be negative")
+			}
+			beforePath, afterPath := ctx.Args[0], ctx.Args[0]
+			beforeOpts, afterOpts := opts, opts
+			if len(ctx.Args) == 2 {
+				afterPath = ctx.Args[1]
+			} else {
+				if opts.Optimize {
+					return cli.Usagef("-O compares two files; one file is already compared with and without it")
+				}
+				afterOpts.Optimize = true
+			}
+
+			_, _, before, err := compilePath(ctx, beforePath, beforeOpts)
+			if err != nil {
+				return err
+			}
+			_, _, after, err := compilePath(ctx, afterPath, afterOpts)
+			if err != nil {
+				return err
+			}
+			diff := codegen.Diff(codegen.Normalize(before.Assembly), codegen.Normalize(after.Assembly), context)
+			if diff == "" {
+				return nil
+			}
+			afterName := afterPath
+			if afterPath == beforePath {
+				afterName += " (-O)"
+			}
+			fmt.Fprintf(ctx.Stdout, "--- %s\n+++ %s\n%s", beforePath, afterName, diff)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/arifali123/152compiler/packages/cli"
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/explain"
+)
+
+func explainCommand() *cli.Command {
+	var line int
+	var opts compiler.Options
+	return &cli.Command{
+		Name:  "explain",
+		Usage: "-line N [flags] <file.py>",
+		Short: "show the tokens, syntax tree, IR and assembly for one source line",
+		Long: `The assembly is the code the source map attributes to the line, with
+notes on what it does. Statements holding a block, such as if and while,
+are shown without their bodies, which are on the lines that follow.`,
+		Flags: func(fs *flag.FlagSet) {
+			fs.IntVar(&line, "line", 0, "the source `line` to explain, counting from 1")
+			fs.BoolVar(&opts.Optimize, "O", false, "optimize before generating code")
+			fs.BoolVar(&opts.Codegen.Checked, "checked", false, "guard stack frames with a canary and abort on reads of unassigned globals and on division by zero")
+		},
+		Run: func(ctx *cli.Context) error {
+			if line < 1 {
+				return cli.Usagef("-line is required and counts from 1")
+			}
+			path, source, err := readSource(ctx)
+			if err != nil {
+				return err
+			}
+			e, diags := explain.Line(source, line, opts)
+			if err := reportDiagnostics(ctx, path, source, diags); err != nil {
+				return err
+			}
+			fmt.Fprint(ctx.Stdout, e)
+			return nil
+		},
+	}
+}
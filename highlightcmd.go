@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/arifali123/152compiler/packages/cli"
+	"github.com/arifali123/152compiler/packages/highlight"
+)
+
+func highlightCommand() *cli.Command {
+	var outFormat string
+	return &cli.Command{
+		Name:  "highlight",
+		Usage: "[flags] <file.py>",
+		Short: "classify a program's text for syntax coloring",
+		Long: `The lsp format prints a JSON object with the token type legend and the
+data array of an LSP semantic tokens response. The html format prints the
+source in a <pre> element with each token in a span of class hl-<kind>.
+The ranges format prints one line:column, length and kind per token.`,
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&outFormat, "format", "ranges", "output `format`: ranges, lsp or html")
+		},
+		Run: func(ctx *cli.Context) error {
+			if outFormat != "ranges" && outFormat != "lsp" && outFormat != "html" {
+				return cli.Usagef("unknown format %q", outFormat)
+			}
+			_, source, err := readSource(ctx)
+			if err != nil {
+				return err
+			}
+			ranges := highlight.Ranges(source)
+			switch outFormat {
+			case "lsp":
+				return json.NewEncoder(ctx.Stdout).Encode(map[string]interface{}{
+					"legend": map[string]interface{}{"tokenTypes": highlight.Kinds, "tokenModifiers": []string{}},
+					"data":   highlight.LSP(ranges),
+				})
+			case "html":
+				fmt.Fprint(ctx.Stdout, highlight.HTML(source, ranges))
+			default:
+				for _, r := range ranges {
+					fmt.Fprintf(ctx.Stdout, "%d:%d\t%d\t%s\n", r.Line, r.Column, r.Length, r.Kind)
+				}
+			}
+			return nil
+		},
+	}
+}
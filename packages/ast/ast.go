@@ -2,8 +2,10 @@ package ast
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/arifali123/152compiler/packages/symbol"
 	"github.com/arifali123/152compiler/packages/token"
 )
 
@@ -31,13 +33,47 @@ type FunctionDefinition struct {
 	Name       string
 	Parameters []string
 	Body       []Statement
+	Params     []*symbol.Symbol // the parameters' variables, set by package bind
+	Locals     []*symbol.Symbol // the variables local to the function, set by package bind
 }
 
 type IfStatement struct {
 	Token       token.Token
 	Condition   Expression
 	Consequence []Statement
+	Elifs       []*ElifClause // tried in order when Condition is false
 	Alternative []Statement
+	Hint        BranchHint
+}
+
+// ElifClause is one elif branch of an IfStatement. The desugar stage folds
+// the branches into nested ifs in Alternative before checking.
+type ElifClause struct {
+	Token       token.Token
+	Condition   Expression
+	Consequence []Statement
+	Hint        BranchHint
+}
+
+// BranchHint is how often a condition is expected to hold, given by a
+// "# pragma: likely" or "# pragma: unlikely" comment after its colon. The
+// code generator lets the expected branch fall through.
+type BranchHint int
+
+const (
+	NoHint BranchHint = iota
+	Likely
+	Unlikely
+)
+
+func (h BranchHint) String() string {
+	switch h {
+	case Likely:
+		return "likely"
+	case Unlikely:
+		return "unlikely"
+	}
+	return ""
 }
 
 type WhileStatement struct {
@@ -46,10 +82,52 @@ type WhileStatement struct {
 	Body      []Statement
 }
 
+// ForStatement is for Variable in range(Start, Stop, Step). Start is nil for
+// the one-argument form and Step is nil unless given. The desugar stage
+// rewrites it to a while loop.
+type ForStatement struct {
+	Token    token.Token
+	Variable string
+	Start    Expression
+	Stop     Expression
+	Step     Expression
+	Body     []Statement
+}
+
 type AssignmentStatement struct {
-	Token token.Token
-	Name  string
-	Value Expression
+	Token      token.Token
+	Name       string
+	Annotation string // the type in name: type = value, empty without one
+	Value      Expression
+	Symbol     *symbol.Symbol // the variable assigned, set by package bind
+	Temporary  bool           // Name is a hidden temporary, set by package desugar
+}
+
+// TupleAssignment is a, b = x, y, which assigns every value only after all
+// of them are evaluated. The desugar stage rewrites it to plain assignments.
+type TupleAssignment struct {
+	Token  token.Token
+	Names  []string
+	Values []Expression
+}
+
+// AugmentedAssignment is x += value and friends. The desugar stage rewrites
+// it to a plain AssignmentStatement before checking and code generation.
+type AugmentedAssignment struct {
+	Token    token.Token
+	Name     string
+	Operator string // "+", "-" or "*"
+	Value    Expression
+}
+
+// IndexAssignment is Target = Value for an element of a list, as in
+// xs[i] = v or grid[i][j] = v. Operator is set for xs[i] += v and friends,
+// which the desugar stage rewrites to a plain IndexAssignment.
+type IndexAssignment struct {
+	Token    token.Token // the first token of the target
+	Target   *IndexExpression
+	Operator string
+	Value    Expression
 }
 
 type PrintStatement struct {
@@ -63,14 +141,37 @@ type BinaryExpression struct {
 	Right    Expression
 }
 
+// Comparison is a chain of two or more comparisons, a < b < c, which holds
+// when each neighbouring pair does. Every operand is evaluated at most once,
+// left to right, stopping at the first pair that fails.
+type Comparison struct {
+	Operands  []Expression
+	Operators []string // Operators[i] compares Operands[i] with Operands[i+1]
+}
+
+// PrefixExpression is a unary operator, "-" or "not", applied to an operand.
+// Negative integer constants are folded into IntegerLiteral by the parser
+// instead.
+type PrefixExpression struct {
+	Token    token.Token
+	Operator string
+	Right    Expression
+}
+
 type Identifier struct {
-	Token token.Token
-	Value string
+	Token  token.Token
+	Value  string
+	Symbol *symbol.Symbol // the variable referred to, set by package bind
 }
 
 type IntegerLiteral struct {
 	Token token.Token
-	Value string
+	Value int64
+}
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
 }
 
 type StringLiteral struct {
@@ -78,10 +179,44 @@ type StringLiteral struct {
 	Value string
 }
 
+// InterpolatedString is an f-string. Parts holds its text as StringLiterals
+// and the expressions written between braces, in order.
+type InterpolatedString struct {
+	Token token.Token
+	Parts []Expression
+}
+
+// NoneLiteral is None. It is stored as 0 and printed as None.
+type NoneLiteral struct {
+	Token token.Token
+}
+
 type FunctionCall struct {
 	Token     token.Token
 	Function  string
 	Arguments []Expression
+	Discarded bool // the result is never used, set by package check
+	Method    bool // written receiver.Function(...), with the receiver as the first argument
+}
+
+// ListLiteral is [element, ...]
+type ListLiteral struct {
+	Token    token.Token // the '['
+	Elements []Expression
+}
+
+// DictLiteral is {key: value, ...}; Keys and Values are parallel
+type DictLiteral struct {
+	Token  token.Token
+	Keys   []Expression
+	Values []Expression
+}
+
+// IndexExpression is Left[Index], a lookup in a dictionary or a list
+type IndexExpression struct {
+	Token token.Token // the '['
+	Left  Expression
+	Index Expression
 }
 
 type ReturnStatement struct {
@@ -89,6 +224,13 @@ type ReturnStatement struct {
 	Value Expression
 }
 
+// GlobalStatement is global a, b. Inside a function it makes the names
+// refer to the globals rather than to variables of the function's own.
+type GlobalStatement struct {
+	Token token.Token
+	Names []string
+}
+
 type ExpressionStatement struct {
 	Expression Expression
 }
@@ -96,16 +238,31 @@ type ExpressionStatement struct {
 func (p *Program) TokenLiteral() string              { return p.Statements[0].TokenLiteral() }
 func (as *AssignmentStatement) TokenLiteral() string { return as.Token.Literal }
 func (as *AssignmentStatement) statementNode()       {}
+func (aa *AugmentedAssignment) TokenLiteral() string { return aa.Token.Literal }
+func (aa *AugmentedAssignment) statementNode()       {}
+func (ia *IndexAssignment) TokenLiteral() string     { return ia.Token.Literal }
+func (ia *IndexAssignment) statementNode()           {}
 func (i *IntegerLiteral) TokenLiteral() string       { return i.Token.Literal }
 func (i *IntegerLiteral) expressionNode()            {}
+func (f *FloatLiteral) TokenLiteral() string         { return f.Token.Literal }
+func (f *FloatLiteral) expressionNode()              {}
 func (i *Identifier) TokenLiteral() string           { return i.Token.Literal }
 func (i *Identifier) expressionNode()                {}
 func (be *BinaryExpression) TokenLiteral() string    { return be.Left.TokenLiteral() }
 func (be *BinaryExpression) expressionNode()         {}
+func (c *Comparison) TokenLiteral() string           { return c.Operands[0].TokenLiteral() }
+func (c *Comparison) expressionNode()                {}
+func (pe *PrefixExpression) TokenLiteral() string    { return pe.Token.Literal }
+func (pe *PrefixExpression) expressionNode()         {}
 func (fs *FunctionDefinition) TokenLiteral() string  { return fs.Token.Literal }
 func (fs *FunctionDefinition) statementNode()        {}
 func (is *IfStatement) TokenLiteral() string         { return is.Token.Literal }
 func (is *IfStatement) statementNode()               {}
+func (ec *ElifClause) TokenLiteral() string          { return ec.Token.Literal }
+func (fs *ForStatement) TokenLiteral() string        { return fs.Token.Literal }
+func (fs *ForStatement) statementNode()              {}
+func (ta *TupleAssignment) TokenLiteral() string     { return ta.Token.Literal }
+func (ta *TupleAssignment) statementNode()           {}
 func (ws *WhileStatement) TokenLiteral() string      { return ws.Token.Literal }
 func (ws *WhileStatement) statementNode()            {}
 func (ps *PrintStatement) TokenLiteral() string      { return ps.Token.Literal }
@@ -113,10 +270,22 @@ func (ps *PrintStatement) statementNode()            {}
 func (ps *PrintStatement) expressionNode()           {}
 func (sl *StringLiteral) TokenLiteral() string       { return sl.Token.Literal }
 func (sl *StringLiteral) expressionNode()            {}
+func (nl *NoneLiteral) TokenLiteral() string         { return nl.Token.Literal }
+func (is *InterpolatedString) TokenLiteral() string  { return is.Token.Literal }
+func (is *InterpolatedString) expressionNode()       {}
+func (nl *NoneLiteral) expressionNode()              {}
 func (fc *FunctionCall) TokenLiteral() string        { return fc.Token.Literal }
 func (fc *FunctionCall) expressionNode()             {}
+func (dl *DictLiteral) TokenLiteral() string         { return dl.Token.Literal }
+func (ll *ListLiteral) TokenLiteral() string         { return ll.Token.Literal }
+func (ll *ListLiteral) expressionNode()              {}
+func (dl *DictLiteral) expressionNode()              {}
+func (ie *IndexExpression) TokenLiteral() string     { return ie.Token.Literal }
+func (ie *IndexExpression) expressionNode()          {}
 func (rs *ReturnStatement) TokenLiteral() string     { return rs.Token.Literal }
 func (rs *ReturnStatement) statementNode()           {}
+func (gs *GlobalStatement) TokenLiteral() string     { return gs.Token.Literal }
+func (gs *GlobalStatement) statementNode()           {}
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string {
 	if es.Expression != nil {
@@ -141,17 +310,111 @@ func (p *Program) String() string {
 }
 
 func (as *AssignmentStatement) String() string {
+	if as.Annotation != "" {
+		return fmt.Sprintf("%s: %s = %s", as.Name, as.Annotation, as.Value.String())
+	}
 	return fmt.Sprintf("%s = %s", as.Name, as.Value.String())
 }
 
+func (aa *AugmentedAssignment) String() string {
+	return fmt.Sprintf("%s %s= %s", aa.Name, aa.Operator, aa.Value.String())
+}
+
+func (ia *IndexAssignment) String() string {
+	return fmt.Sprintf("%s %s= %s", ia.Target.String(), ia.Operator, ia.Value.String())
+}
+
 func (ps *PrintStatement) String() string {
 	return fmt.Sprintf("print(%s)", ps.Value.String())
 }
 
 func (rs *ReturnStatement) String() string {
+	if rs.Value == nil {
+		return "return"
+	}
 	return fmt.Sprintf("return %s", rs.Value.String())
 }
 
+func (gs *GlobalStatement) String() string {
+	return "global " + strings.Join(gs.Names, ", ")
+}
+
+// ReturnsValue reports whether some return in fn gives a value other than
+// None. A function that never does is void and its calls evaluate to None.
+func ReturnsValue(fn *FunctionDefinition) bool {
+	found := false
+	Rewrite(fn, func(n Node) Node {
+		if r, ok := n.(*ReturnStatement); ok && r.Value != nil {
+			if _, none := r.Value.(*NoneLiteral); !none {
+				found = true
+			}
+		}
+		return n
+	})
+	return found
+}
+
+// DeclaredGlobals returns the names a global statement anywhere in fn
+// declares, which then refer to the globals throughout fn
+func DeclaredGlobals(fn *FunctionDefinition) map[string]bool {
+	names := make(map[string]bool)
+	Rewrite(fn, func(n Node) Node {
+		if g, ok := n.(*GlobalStatement); ok {
+			for _, name := range g.Names {
+				names[name] = true
+			}
+		}
+		return n
+	})
+	return names
+}
+
+// LocalNames returns the variables local to fn in the order they are first
+// assigned: every name it assigns, at any depth, that is neither one of its
+// parameters nor declared global in it
+func LocalNames(fn *FunctionDefinition) []string {
+	excluded := DeclaredGlobals(fn)
+	for _, p := range fn.Parameters {
+		excluded[p] = true
+	}
+
+	var names []string
+	add := func(name string) {
+		if !excluded[name] {
+			excluded[name] = true
+			names = append(names, name)
+		}
+	}
+	var block func(stmts []Statement)
+	block = func(stmts []Statement) {
+		for _, stmt := range stmts {
+			switch s := stmt.(type) {
+			case *AssignmentStatement:
+				add(s.Name)
+			case *AugmentedAssignment:
+				add(s.Name)
+			case *TupleAssignment:
+				for _, name := range s.Names {
+					add(name)
+				}
+			case *ForStatement:
+				add(s.Variable)
+				block(s.Body)
+			case *IfStatement:
+				block(s.Consequence)
+				for _, e := range s.Elifs {
+					block(e.Consequence)
+				}
+				block(s.Alternative)
+			case *WhileStatement:
+				block(s.Body)
+			}
+		}
+	}
+	block(fn.Body)
+	return names
+}
+
 func (fs *FunctionDefinition) String() string {
 	return fmt.Sprintf("def %s(%s)", fs.Name, strings.Join(fs.Parameters, ", "))
 }
@@ -160,6 +423,28 @@ func (is *IfStatement) String() string {
 	return fmt.Sprintf("if %s", is.Condition.String())
 }
 
+func (ec *ElifClause) String() string {
+	return fmt.Sprintf("elif %s", ec.Condition.String())
+}
+
+func (ta *TupleAssignment) String() string {
+	values := make([]string, len(ta.Values))
+	for i, v := range ta.Values {
+		values[i] = v.String()
+	}
+	return fmt.Sprintf("%s = %s", strings.Join(ta.Names, ", "), strings.Join(values, ", "))
+}
+
+func (fs *ForStatement) String() string {
+	if fs.Start == nil {
+		return fmt.Sprintf("for %s in range(%s)", fs.Variable, fs.Stop.String())
+	}
+	if fs.Step != nil {
+		return fmt.Sprintf("for %s in range(%s, %s, %s)", fs.Variable, fs.Start.String(), fs.Stop.String(), fs.Step.String())
+	}
+	return fmt.Sprintf("for %s in range(%s, %s)", fs.Variable, fs.Start.String(), fs.Stop.String())
+}
+
 func (ws *WhileStatement) String() string {
 	return fmt.Sprintf("while %s", ws.Condition.String())
 }
@@ -168,22 +453,99 @@ func (be *BinaryExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", be.Left.String(), be.Operator, be.Right.String())
 }
 
+func (c *Comparison) String() string {
+	var out strings.Builder
+	out.WriteString("(" + c.Operands[0].String())
+	for i, op := range c.Operators {
+		out.WriteString(" " + op + " " + c.Operands[i+1].String())
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+func (pe *PrefixExpression) String() string {
+	if pe.Operator == "not" {
+		return fmt.Sprintf("(not %s)", pe.Right.String())
+	}
+	return fmt.Sprintf("(%s%s)", pe.Operator, pe.Right.String())
+}
+
 func (i *Identifier) String() string {
 	return i.Value
 }
 
 func (il *IntegerLiteral) String() string {
-	return il.Value
+	return strconv.FormatInt(il.Value, 10)
+}
+
+// String writes the value in decimal, always with a point, so that it reads
+// back as the same float
+func (fl *FloatLiteral) String() string {
+	s := strconv.FormatFloat(fl.Value, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
 }
 
 func (sl *StringLiteral) String() string {
 	return sl.Value
 }
 
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+
+// Escape writes s as the body of a string literal, escaping the backslashes,
+// quotes, newlines and tabs the lexer reads back. MARS reads the same escapes
+// in .asciiz.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func (nl *NoneLiteral) String() string {
+	return "None"
+}
+
+func (is *InterpolatedString) String() string {
+	var out strings.Builder
+	out.WriteString(`f"`)
+	for _, part := range is.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(strings.NewReplacer("{", "{{", "}", "}}").Replace(Escape(text.Value)))
+			continue
+		}
+		out.WriteString("{" + part.String() + "}")
+	}
+	out.WriteString(`"`)
+	return out.String()
+}
+
 func (fc *FunctionCall) String() string {
 	args := make([]string, len(fc.Arguments))
 	for i, arg := range fc.Arguments {
 		args[i] = arg.String()
 	}
+	if fc.Method && len(args) > 0 {
+		return fmt.Sprintf("%s.%s(%s)", args[0], fc.Function, strings.Join(args[1:], ", "))
+	}
 	return fmt.Sprintf("%s(%s)", fc.Function, strings.Join(args, ", "))
 }
+
+func (ll *ListLiteral) String() string {
+	elements := make([]string, len(ll.Elements))
+	for i, e := range ll.Elements {
+		elements[i] = e.String()
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (dl *DictLiteral) String() string {
+	pairs := make([]string, len(dl.Keys))
+	for i, key := range dl.Keys {
+		pairs[i] = key.String() + ": " + dl.Values[i].String()
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func (ie *IndexExpression) String() string {
+	return fmt.Sprintf("%s[%s]", ie.Left.String(), ie.Index.String())
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/arifali123/152compiler/packages/token"
@@ -17,7 +18,7 @@ func TestASTNodes(t *testing.T) {
 					Name:  "x",
 					Value: &IntegerLiteral{
 						Token: token.Token{Type: token.INT, Literal: "5"},
-						Value: "5",
+						Value: 5,
 					},
 				},
 			},
@@ -74,7 +75,7 @@ func TestASTNodes(t *testing.T) {
 				Operator: ">",
 				Right: &IntegerLiteral{
 					Token: token.Token{Type: token.INT, Literal: "0"},
-					Value: "0",
+					Value: 0,
 				},
 			},
 			Consequence: []Statement{
@@ -83,7 +84,7 @@ func TestASTNodes(t *testing.T) {
 					Name:  "y",
 					Value: &IntegerLiteral{
 						Token: token.Token{Type: token.INT, Literal: "1"},
-						Value: "1",
+						Value: 1,
 					},
 				},
 			},
@@ -93,7 +94,7 @@ func TestASTNodes(t *testing.T) {
 					Name:  "y",
 					Value: &IntegerLiteral{
 						Token: token.Token{Type: token.INT, Literal: "2"},
-						Value: "2",
+						Value: 2,
 					},
 				},
 			},
@@ -124,7 +125,7 @@ func TestASTNodes(t *testing.T) {
 				Operator: "<",
 				Right: &IntegerLiteral{
 					Token: token.Token{Type: token.INT, Literal: "10"},
-					Value: "10",
+					Value: 10,
 				},
 			},
 			Body: []Statement{
@@ -152,23 +153,23 @@ func TestASTNodes(t *testing.T) {
 		expr := &BinaryExpression{
 			Left: &IntegerLiteral{
 				Token: token.Token{Type: token.INT, Literal: "5"},
-				Value: "5",
+				Value: 5,
 			},
 			Operator: "+",
 			Right: &IntegerLiteral{
 				Token: token.Token{Type: token.INT, Literal: "3"},
-				Value: "3",
+				Value: 3,
 			},
 		}
 
 		if expr.Operator != "+" {
 			t.Errorf("wrong operator. want=+, got=%s", expr.Operator)
 		}
-		if expr.Right.(*IntegerLiteral).Value != "3" {
-			t.Errorf("wrong right value. want=3, got=%s", expr.Right.(*IntegerLiteral).Value)
+		if expr.Right.(*IntegerLiteral).Value != 3 {
+			t.Errorf("wrong right value. want=3, got=%d", expr.Right.(*IntegerLiteral).Value)
 		}
-		if expr.Left.(*IntegerLiteral).Value != "5" {
-			t.Errorf("wrong left value. want=5, got=%s", expr.Left.(*IntegerLiteral).Value)
+		if expr.Left.(*IntegerLiteral).Value != 5 {
+			t.Errorf("wrong left value. want=5, got=%d", expr.Left.(*IntegerLiteral).Value)
 		}
 	})
 
@@ -180,11 +181,11 @@ func TestASTNodes(t *testing.T) {
 			Arguments: []Expression{
 				&IntegerLiteral{
 					Token: token.Token{Type: token.INT, Literal: "5"},
-					Value: "5",
+					Value: 5,
 				},
 				&IntegerLiteral{
 					Token: token.Token{Type: token.INT, Literal: "3"},
-					Value: "3",
+					Value: 3,
 				},
 			},
 		}
@@ -300,7 +301,7 @@ func TestTokenLiterals(t *testing.T) {
 		// Test IntegerLiteral
 		intLit := &IntegerLiteral{
 			Token: token.Token{Type: token.INT, Literal: "42"},
-			Value: "42",
+			Value: 42,
 		}
 		if got := intLit.TokenLiteral(); got != "42" {
 			t.Errorf("IntegerLiteral.TokenLiteral() = %v, want %v", got, "42")
@@ -444,7 +445,7 @@ func TestStatementString(t *testing.T) {
 	// Common test values
 	intLit := &IntegerLiteral{
 		Token: token.Token{Type: token.INT, Literal: "42"},
-		Value: "42",
+		Value: 42,
 	}
 	strLit := &StringLiteral{
 		Token: token.Token{Type: token.STRING, Literal: "hello"},
@@ -568,7 +569,7 @@ func TestProgramAndExpressionString(t *testing.T) {
 	// Common test values
 	intLit := &IntegerLiteral{
 		Token: token.Token{Type: token.INT, Literal: "42"},
-		Value: "42",
+		Value: 42,
 	}
 	strLit := &StringLiteral{
 		Token: token.Token{Type: token.STRING, Literal: "hello"},
@@ -678,7 +679,7 @@ func TestFunctionCallString(t *testing.T) {
 	// Common test values
 	intLit := &IntegerLiteral{
 		Token: token.Token{Type: token.INT, Literal: "42"},
-		Value: "42",
+		Value: 42,
 	}
 	strLit := &StringLiteral{
 		Token: token.Token{Type: token.STRING, Literal: "hello"},
@@ -773,9 +774,9 @@ func TestASTStructure(t *testing.T) {
 				&AssignmentStatement{
 					Name: "x",
 					Value: &BinaryExpression{
-						Left:     &IntegerLiteral{Value: "5"},
+						Left:     &IntegerLiteral{Value: 5},
 						Operator: "+",
-						Right:    &IntegerLiteral{Value: "3"},
+						Right:    &IntegerLiteral{Value: 3},
 					},
 				},
 				&AssignmentStatement{
@@ -783,7 +784,7 @@ func TestASTStructure(t *testing.T) {
 					Value: &BinaryExpression{
 						Left:     &Identifier{Value: "x"},
 						Operator: "*",
-						Right:    &IntegerLiteral{Value: "2"},
+						Right:    &IntegerLiteral{Value: 2},
 					},
 				},
 				&PrintStatement{
@@ -840,7 +841,7 @@ func buildTestCase2AST() *Program {
 				Condition: &BinaryExpression{
 					Left:     &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"},
 					Operator: ">",
-					Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "5"}, Value: "5"},
+					Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "5"}, Value: 5},
 				},
 				Consequence: []Statement{
 					&WhileStatement{
@@ -848,7 +849,7 @@ func buildTestCase2AST() *Program {
 						Condition: &BinaryExpression{
 							Left:     &Identifier{Token: token.Token{Type: token.IDENT, Literal: "i"}, Value: "i"},
 							Operator: "<",
-							Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "10"}, Value: "10"},
+							Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "10"}, Value: 10},
 						},
 						Body: []Statement{
 							&PrintStatement{
@@ -884,3 +885,249 @@ func buildTestCase3AST() *Program {
 		},
 	}
 }
+
+func TestDump(t *testing.T) {
+	expected := `Program
+  FunctionDefinition add(a, b)
+    Body
+      Return
+        Binary +
+          Identifier a
+          Identifier b
+`
+	if got := Dump(buildTestCase3AST()); got != expected {
+		t.Errorf("Dump wrong.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	original := buildTestCase3AST()
+	before := Dump(original)
+
+	var visited []string
+	renamed := Rewrite(original, func(n Node) Node {
+		visited = append(visited, fmt.Sprintf("%T", n))
+		if id, ok := n.(*Identifier); ok {
+			id.Value = "p_" + id.Value
+		}
+		return n
+	})
+
+	expected := `Program
+  FunctionDefinition add(a, b)
+    Body
+      Return
+        Binary +
+          Identifier p_a
+          Identifier p_b
+`
+	if got := Dump(renamed); got != expected {
+		t.Errorf("rewritten tree wrong.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+	if got := Dump(original); got != before {
+		t.Errorf("Rewrite modified its input:\n%s", got)
+	}
+
+	order := "*ast.Identifier *ast.Identifier *ast.BinaryExpression *ast.ReturnStatement *ast.FunctionDefinition *ast.Program"
+	if got := fmt.Sprint(visited); got != "["+order+"]" {
+		t.Errorf("wrong visit order.\nexpected=[%s]\ngot=     %s", order, got)
+	}
+
+	t.Run("replace and remove", func(t *testing.T) {
+		program := &Program{Statements: []Statement{
+			&PrintStatement{Value: &BinaryExpression{Left: &IntegerLiteral{Value: 1}, Operator: "+", Right: &IntegerLiteral{Value: 2}}},
+			&ExpressionStatement{Expression: &Identifier{Value: "x"}},
+		}}
+		got := Rewrite(program, func(n Node) Node {
+			switch n := n.(type) {
+			case *BinaryExpression:
+				return &IntegerLiteral{Value: n.Left.(*IntegerLiteral).Value + n.Right.(*IntegerLiteral).Value}
+			case *ExpressionStatement:
+				return nil
+			}
+			return n
+		})
+		if s := got.String(); s != "print(3)" {
+			t.Errorf("expected print(3), got %q", s)
+		}
+	})
+
+	t.Run("kind mismatch panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected a panic when an expression is replaced by a statement")
+			}
+		}()
+		Rewrite(buildTestCase3AST(), func(n Node) Node {
+			if _, ok := n.(*Identifier); ok {
+				return &ReturnStatement{}
+			}
+			return n
+		})
+	})
+}
+
+func TestConstructors(t *testing.T) {
+	at := token.Token{Type: token.FOR, Literal: "for", Line: 3, Column: 5}
+
+	t.Run("positions", func(t *testing.T) {
+		name, one := NewName("i", at), NewInteger(1, at)
+		if name.Token != (token.Token{Type: token.IDENT, Literal: "i", Line: 3, Column: 5}) {
+			t.Errorf("wrong name token %+v", name.Token)
+		}
+		if one.Token != (token.Token{Type: token.INT, Literal: "1", Line: 3, Column: 5}) {
+			t.Errorf("wrong integer token %+v", one.Token)
+		}
+		if s := NewAssign(at, "i", NewBinary(name, "+", one)).String(); s != "i = (i + 1)" {
+			t.Errorf("wrong assignment %q", s)
+		}
+	})
+
+	t.Run("bare return", func(t *testing.T) {
+		var missing *Identifier
+		if r := NewReturn(at, missing); r.Value != nil {
+			t.Errorf("expected a bare return, got %#v", r.Value)
+		}
+	})
+
+	var missing *IntegerLiteral
+	invalid := []struct {
+		name  string
+		build func()
+	}{
+		{"nil operand", func() { NewBinary(NewName("x", at), "+", nil) }},
+		{"typed nil operand", func() { NewBinary(missing, "+", NewName("x", at)) }},
+		{"unknown operator", func() { NewBinary(NewName("x", at), "^", NewName("y", at)) }},
+		{"unknown prefix", func() { NewPrefix(at, "+", NewName("x", at)) }},
+		{"assignment without a value", func() { NewAssign(at, "x", missing) }},
+		{"assignment without a name", func() { NewAssign(at, "", NewName("x", at)) }},
+		{"tuple length mismatch", func() { NewTuple(at, []string{"a", "b"}, []Expression{NewName("x", at)}) }},
+		{"print without a value", func() { NewPrint(at, nil) }},
+		{"while without a condition", func() { NewWhile(at, nil, nil) }},
+		{"for without a stop", func() { NewFor(at, "i", nil, nil, nil, nil) }},
+		{"for with a step but no start", func() { NewFor(at, "i", nil, NewName("n", at), NewName("s", at), nil) }},
+		{"index without an index", func() { NewIndex(at, NewName("d", at), nil) }},
+		{"list with a missing element", func() { NewList(at, []Expression{NewName("x", at), missing}) }},
+		{"global without names", func() { NewGlobal(at, nil) }},
+		{"comparison of one pair", func() { NewComparison([]Expression{NewName("a", at), NewName("b", at)}, []string{"<"}) }},
+		{"comparison with arithmetic", func() {
+			NewComparison([]Expression{NewName("a", at), NewName("b", at), NewName("c", at)}, []string{"<", "+"})
+		}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			tt.build()
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	at := func(line, column int) token.Token {
+		return token.Token{Type: token.IDENT, Literal: "x", Line: line, Column: column}
+	}
+	var missing *IntegerLiteral
+	tests := []struct {
+		name     string
+		node     Node
+		expected []string
+	}{
+		{
+			name: "well formed",
+			node: &Program{Statements: []Statement{
+				NewAssign(at(1, 1), "x", NewBinary(NewName("y", at(1, 5)), "+", NewInteger(1, at(1, 9)))),
+				NewWhile(at(2, 1), NewName("x", at(2, 7)), []Statement{NewPrint(at(3, 2), NewName("x", at(3, 8)))}),
+				NewReturn(at(4, 1), nil),
+			}},
+		},
+		{
+			name: "nil operands",
+			node: &AssignmentStatement{Token: at(2, 1), Name: "x", Value: &BinaryExpression{
+				Left:     &BinaryExpression{Left: NewName("y", at(2, 5)), Operator: "*", Right: missing},
+				Operator: "+",
+			}},
+			expected: []string{
+				"2:5: error: missing right operand of '*'",
+				"2:5: error: missing right operand of '+'",
+			},
+		},
+		{
+			name: "missing left operand",
+			node: &PrintStatement{Token: at(4, 1), Value: &BinaryExpression{Operator: "-", Right: NewName("y", at(4, 9))}},
+			expected: []string{
+				"4:1: error: missing left operand of '-'",
+			},
+		},
+		{
+			name: "empty bodies",
+			node: &Program{Statements: []Statement{
+				&FunctionDefinition{Token: at(1, 1), Name: "f"},
+				&IfStatement{Token: at(3, 1), Condition: NewName("x", at(3, 4)), Consequence: []Statement{nil}},
+			}},
+			expected: []string{
+				"1:1: error: empty body of 'f'",
+				"3:1: error: missing statement",
+			},
+		},
+		{
+			name: "assignment without a value",
+			node: &Program{Statements: []Statement{
+				&AssignmentStatement{Token: at(5, 1), Name: "x", Value: missing},
+				&WhileStatement{Token: at(6, 1), Body: []Statement{&ExpressionStatement{}}},
+			}},
+			expected: []string{
+				"5:1: error: missing value assigned to 'x'",
+				"6:1: error: missing while condition",
+				"6:1: error: missing expression",
+			},
+		},
+		{
+			name: "mismatched lists",
+			node: &ExpressionStatement{Expression: &DictLiteral{Token: at(7, 5), Keys: []Expression{NewString("a", at(7, 6))}}},
+			expected: []string{
+				"7:5: error: mismatched dictionary: 1 keys, 0 values",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range Validate(tt.node) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("wrong problems.\nexpected=%q\ngot=     %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLocalNames(t *testing.T) {
+	at := token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 1}
+	one := NewInteger(1, at)
+	fn := &FunctionDefinition{
+		Name:       "f",
+		Parameters: []string{"a"},
+		Body: []Statement{
+			NewAssign(at, "b", one),
+			NewAssign(at, "a", one),
+			NewIf(at, NewName("a", at), []Statement{
+				NewAssign(at, "g", one),
+				NewTuple(at, []string{"c", "b"}, []Expression{one, one}),
+			}, []Statement{NewGlobal(at, []string{"g"})}),
+			NewWhile(at, NewName("a", at), []Statement{NewAugmented(at, "d", "+", one)}),
+			NewFor(at, "i", nil, one, nil, nil),
+		},
+	}
+	if got, want := LocalNames(fn), []string{"b", "c", "d", "i"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong locals. expected=%v, got=%v", want, got)
+	}
+	if got, want := DeclaredGlobals(fn), map[string]bool{"g": true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong globals. expected=%v, got=%v", want, got)
+	}
+}
@@ -0,0 +1,159 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dump renders a node and all of its children as an indented tree, one node
+// per line. Unlike String it includes the bodies of blocks.
+func Dump(node Node) string {
+	var out strings.Builder
+	dump(&out, node, 0)
+	return out.String()
+}
+
+func dump(out *strings.Builder, node Node, depth int) {
+	line := func(format string, args ...interface{}) {
+		out.WriteString(strings.Repeat("  ", depth))
+		fmt.Fprintf(out, format, args...)
+		out.WriteString("\n")
+	}
+	block := func(label string, stmts []Statement) {
+		out.WriteString(strings.Repeat("  ", depth+1))
+		out.WriteString(label + "\n")
+		for _, s := range stmts {
+			dump(out, s, depth+2)
+		}
+	}
+
+	switch n := node.(type) {
+	case nil:
+		line("<nil>")
+	case *Program:
+		line("Program")
+		for _, s := range n.Statements {
+			dump(out, s, depth+1)
+		}
+	case *AssignmentStatement:
+		if n.Annotation != "" {
+			line("Assignment %s: %s", n.Name, n.Annotation)
+		} else {
+			line("Assignment %s", n.Name)
+		}
+		dump(out, n.Value, depth+1)
+	case *TupleAssignment:
+		line("TupleAssignment %s", strings.Join(n.Names, ", "))
+		for _, v := range n.Values {
+			dump(out, v, depth+1)
+		}
+	case *AugmentedAssignment:
+		line("AugmentedAssignment %s %s=", n.Name, n.Operator)
+		dump(out, n.Value, depth+1)
+	case *IndexAssignment:
+		line("IndexAssignment %s=", n.Operator)
+		dump(out, n.Target, depth+1)
+		dump(out, n.Value, depth+1)
+	case *PrintStatement:
+		line("Print")
+		dump(out, n.Value, depth+1)
+	case *ReturnStatement:
+		line("Return")
+		if n.Value != nil {
+			dump(out, n.Value, depth+1)
+		}
+	case *GlobalStatement:
+		line("Global %s", strings.Join(n.Names, ", "))
+	case *ExpressionStatement:
+		line("ExpressionStatement")
+		dump(out, n.Expression, depth+1)
+	case *FunctionDefinition:
+		line("FunctionDefinition %s(%s)", n.Name, strings.Join(n.Parameters, ", "))
+		block("Body", n.Body)
+	case *IfStatement:
+		if n.Hint != NoHint {
+			line("If (" + n.Hint.String() + ")")
+		} else {
+			line("If")
+		}
+		dump(out, n.Condition, depth+1)
+		block("Then", n.Consequence)
+		for _, e := range n.Elifs {
+			dump(out, e, depth+1)
+		}
+		if n.Alternative != nil {
+			block("Else", n.Alternative)
+		}
+	case *ElifClause:
+		line("Elif")
+		dump(out, n.Condition, depth+1)
+		block("Then", n.Consequence)
+	case *ForStatement:
+		line("For %s", n.Variable)
+		if n.Start != nil {
+			dump(out, n.Start, depth+1)
+		}
+		dump(out, n.Stop, depth+1)
+		if n.Step != nil {
+			dump(out, n.Step, depth+1)
+		}
+		block("Body", n.Body)
+	case *WhileStatement:
+		line("While")
+		dump(out, n.Condition, depth+1)
+		block("Body", n.Body)
+	case *PrefixExpression:
+		line("Prefix %s", n.Operator)
+		dump(out, n.Right, depth+1)
+	case *BinaryExpression:
+		line("Binary %s", n.Operator)
+		dump(out, n.Left, depth+1)
+		dump(out, n.Right, depth+1)
+	case *Comparison:
+		line("Comparison %s", strings.Join(n.Operators, " "))
+		for _, operand := range n.Operands {
+			dump(out, operand, depth+1)
+		}
+	case *FunctionCall:
+		if n.Method {
+			line("Method %s", n.Function)
+		} else {
+			line("Call %s", n.Function)
+		}
+		for _, a := range n.Arguments {
+			dump(out, a, depth+1)
+		}
+	case *DictLiteral:
+		line("Dict")
+		for i, key := range n.Keys {
+			dump(out, key, depth+1)
+			dump(out, n.Values[i], depth+2)
+		}
+	case *ListLiteral:
+		line("List")
+		for _, e := range n.Elements {
+			dump(out, e, depth+1)
+		}
+	case *IndexExpression:
+		line("Index")
+		dump(out, n.Left, depth+1)
+		dump(out, n.Index, depth+1)
+	case *InterpolatedString:
+		line("InterpolatedString")
+		for _, part := range n.Parts {
+			dump(out, part, depth+1)
+		}
+	case *Identifier:
+		line("Identifier %s", n.Value)
+	case *IntegerLiteral:
+		line("Integer %d", n.Value)
+	case *FloatLiteral:
+		line("Float %s", n)
+	case *StringLiteral:
+		line("String %q", n.Value)
+	case *NoneLiteral:
+		line("None")
+	default:
+		line("%T", n)
+	}
+}
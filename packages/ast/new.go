@@ -0,0 +1,179 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// The constructors below build nodes whose required fields are all set, so
+// later stages never see an operand or value missing. They panic when given
+// a nil child, an empty name or an unknown operator: each is a bug in the
+// parser or a pass, never in the program being compiled.
+
+// binaryOperators are the operators a BinaryExpression may hold
+var binaryOperators = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "//": true, "%": true, "**": true,
+	"<": true, ">": true, "<=": true, ">=": true, "==": true, "!=": true,
+	"and": true, "or": true,
+}
+
+// NewName returns a reference to name placed at the position of at
+func NewName(name string, at token.Token) *Identifier {
+	require(name != "", "NewName", "empty name")
+	return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name, Line: at.Line, Column: at.Column}, Value: name}
+}
+
+// NewInteger returns the literal value placed at the position of at
+func NewInteger(value int64, at token.Token) *IntegerLiteral {
+	return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10), Line: at.Line, Column: at.Column}, Value: value}
+}
+
+// NewString returns the string literal value placed at the position of at
+func NewString(value string, at token.Token) *StringLiteral {
+	return &StringLiteral{Token: token.Token{Type: token.STRING, Literal: value, Line: at.Line, Column: at.Column}, Value: value}
+}
+
+// NewCall returns a call to function placed at the position of at
+func NewCall(function string, at token.Token, args []Expression) *FunctionCall {
+	require(function != "", "NewCall", "empty function name")
+	for _, arg := range args {
+		require(!isNil(arg), "NewCall", "missing argument to %s", function)
+	}
+	return &FunctionCall{Token: token.Token{Type: token.IDENT, Literal: function, Line: at.Line, Column: at.Column}, Function: function, Arguments: args}
+}
+
+func NewBinary(left Expression, operator string, right Expression) *BinaryExpression {
+	require(binaryOperators[operator], "NewBinary", "unknown operator %q", operator)
+	require(!isNil(left), "NewBinary", "missing left operand of %q", operator)
+	require(!isNil(right), "NewBinary", "missing right operand of %q", operator)
+	return &BinaryExpression{Left: left, Operator: operator, Right: right}
+}
+
+// comparisonOperators are the operators a Comparison may chain
+var comparisonOperators = map[string]bool{"<": true, ">": true, "<=": true, ">=": true, "==": true, "!=": true}
+
+func NewComparison(operands []Expression, operators []string) *Comparison {
+	require(len(operators) >= 2 && len(operands) == len(operators)+1, "NewComparison", "%d operands for %d operators", len(operands), len(operators))
+	for i, op := range operators {
+		require(comparisonOperators[op], "NewComparison", "unknown operator %q", op)
+		require(!isNil(operands[i]), "NewComparison", "missing left operand of %q", op)
+	}
+	require(!isNil(operands[len(operands)-1]), "NewComparison", "missing last operand")
+	return &Comparison{Operands: operands, Operators: operators}
+}
+
+func NewPrefix(tok token.Token, operator string, right Expression) *PrefixExpression {
+	require(operator == "-" || operator == "not", "NewPrefix", "unknown operator %q", operator)
+	require(!isNil(right), "NewPrefix", "missing operand of %q", operator)
+	return &PrefixExpression{Token: tok, Operator: operator, Right: right}
+}
+
+// NewList returns the list literal of elements opened by the '[' at
+func NewList(at token.Token, elements []Expression) *ListLiteral {
+	for _, e := range elements {
+		require(!isNil(e), "NewList", "missing element")
+	}
+	return &ListLiteral{Token: at, Elements: elements}
+}
+
+func NewIndex(tok token.Token, left, index Expression) *IndexExpression {
+	require(!isNil(left), "NewIndex", "missing value to index")
+	require(!isNil(index), "NewIndex", "missing index")
+	return &IndexExpression{Token: tok, Left: left, Index: index}
+}
+
+func NewAssign(tok token.Token, name string, value Expression) *AssignmentStatement {
+	require(name != "", "NewAssign", "empty name")
+	require(!isNil(value), "NewAssign", "missing value for %s", name)
+	return &AssignmentStatement{Token: tok, Name: name, Value: value}
+}
+
+func NewAugmented(tok token.Token, name, operator string, value Expression) *AugmentedAssignment {
+	require(name != "", "NewAugmented", "empty name")
+	require(binaryOperators[operator], "NewAugmented", "unknown operator %q", operator)
+	require(!isNil(value), "NewAugmented", "missing value for %s", name)
+	return &AugmentedAssignment{Token: tok, Name: name, Operator: operator, Value: value}
+}
+
+// NewIndexAssign returns target = value, or target op= value when operator
+// is not empty
+func NewIndexAssign(tok token.Token, target *IndexExpression, operator string, value Expression) *IndexAssignment {
+	require(target != nil, "NewIndexAssign", "missing target")
+	require(operator == "" || binaryOperators[operator], "NewIndexAssign", "unknown operator %q", operator)
+	require(!isNil(value), "NewIndexAssign", "missing value for %s", target.String())
+	return &IndexAssignment{Token: tok, Target: target, Operator: operator, Value: value}
+}
+
+func NewTuple(tok token.Token, names []string, values []Expression) *TupleAssignment {
+	require(len(names) > 0 && len(names) == len(values), "NewTuple", "%d names for %d values", len(names), len(values))
+	for i, name := range names {
+		require(name != "", "NewTuple", "empty name")
+		require(!isNil(values[i]), "NewTuple", "missing value for %s", name)
+	}
+	return &TupleAssignment{Token: tok, Names: names, Values: values}
+}
+
+func NewPrint(tok token.Token, value Expression) *PrintStatement {
+	require(!isNil(value), "NewPrint", "missing value")
+	return &PrintStatement{Token: tok, Value: value}
+}
+
+// NewReturn returns a return of value, or a bare return if value is nil
+func NewReturn(tok token.Token, value Expression) *ReturnStatement {
+	if isNil(value) {
+		value = nil
+	}
+	return &ReturnStatement{Token: tok, Value: value}
+}
+
+func NewGlobal(tok token.Token, names []string) *GlobalStatement {
+	require(len(names) > 0, "NewGlobal", "no names")
+	for _, name := range names {
+		require(name != "", "NewGlobal", "empty name")
+	}
+	return &GlobalStatement{Token: tok, Names: names}
+}
+
+func NewIf(tok token.Token, condition Expression, consequence, alternative []Statement) *IfStatement {
+	require(!isNil(condition), "NewIf", "missing condition")
+	return &IfStatement{Token: tok, Condition: condition, Consequence: consequence, Alternative: alternative}
+}
+
+func NewWhile(tok token.Token, condition Expression, body []Statement) *WhileStatement {
+	require(!isNil(condition), "NewWhile", "missing condition")
+	return &WhileStatement{Token: tok, Condition: condition, Body: body}
+}
+
+// NewFor returns for variable in range(start, stop, step); start and step
+// may be nil, but a step needs a start
+func NewFor(tok token.Token, variable string, start, stop, step Expression, body []Statement) *ForStatement {
+	require(variable != "", "NewFor", "empty loop variable")
+	require(!isNil(stop), "NewFor", "missing stop")
+	if isNil(start) {
+		start = nil
+	}
+	if isNil(step) {
+		step = nil
+	}
+	require(step == nil || start != nil, "NewFor", "step without a start")
+	return &ForStatement{Token: tok, Variable: variable, Start: start, Stop: stop, Step: step, Body: body}
+}
+
+func require(ok bool, constructor, format string, args ...interface{}) {
+	if !ok {
+		panic(fmt.Sprintf("ast.%s: %s", constructor, fmt.Sprintf(format, args...)))
+	}
+}
+
+// isNil also catches a nil pointer stored in an interface, which a failed
+// parse function returning a concrete type leaves behind
+func isNil(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
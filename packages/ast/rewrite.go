@@ -0,0 +1,198 @@
+package ast
+
+import "fmt"
+
+// Rewrite returns a copy of node with fn applied to every node in it,
+// children before their parent. fn receives a copy whose children have
+// already been rewritten and returns its replacement, which may be the node
+// it was given. Returning nil for a statement removes it from its block.
+// The tree passed in is left unchanged.
+//
+// fn must replace an expression with an expression and a statement with a
+// statement; Rewrite panics otherwise.
+func Rewrite(node Node, fn func(Node) Node) Node {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *Program:
+		c := *n
+		c.Statements = rewriteBlock(n.Statements, fn)
+		return fn(&c)
+	case *FunctionDefinition:
+		c := *n
+		c.Parameters = append([]string(nil), n.Parameters...)
+		c.Body = rewriteBlock(n.Body, fn)
+		return fn(&c)
+	case *IfStatement:
+		c := *n
+		c.Condition = rewriteExpr(n.Condition, fn)
+		c.Consequence = rewriteBlock(n.Consequence, fn)
+		if n.Elifs != nil {
+			c.Elifs = make([]*ElifClause, len(n.Elifs))
+			for i, e := range n.Elifs {
+				c.Elifs[i] = &ElifClause{
+					Token:       e.Token,
+					Condition:   rewriteExpr(e.Condition, fn),
+					Consequence: rewriteBlock(e.Consequence, fn),
+					Hint:        e.Hint,
+				}
+			}
+		}
+		c.Alternative = rewriteBlock(n.Alternative, fn)
+		return fn(&c)
+	case *WhileStatement:
+		c := *n
+		c.Condition = rewriteExpr(n.Condition, fn)
+		c.Body = rewriteBlock(n.Body, fn)
+		return fn(&c)
+	case *ForStatement:
+		c := *n
+		c.Start = rewriteExpr(n.Start, fn)
+		c.Stop = rewriteExpr(n.Stop, fn)
+		c.Step = rewriteExpr(n.Step, fn)
+		c.Body = rewriteBlock(n.Body, fn)
+		return fn(&c)
+	case *AssignmentStatement:
+		c := *n
+		c.Value = rewriteExpr(n.Value, fn)
+		return fn(&c)
+	case *TupleAssignment:
+		c := *n
+		c.Names = append([]string(nil), n.Names...)
+		c.Values = make([]Expression, len(n.Values))
+		for i, v := range n.Values {
+			c.Values[i] = rewriteExpr(v, fn)
+		}
+		return fn(&c)
+	case *AugmentedAssignment:
+		c := *n
+		c.Value = rewriteExpr(n.Value, fn)
+		return fn(&c)
+	case *IndexAssignment:
+		c := *n
+		if target, ok := rewriteExpr(n.Target, fn).(*IndexExpression); ok {
+			c.Target = target
+		}
+		c.Value = rewriteExpr(n.Value, fn)
+		return fn(&c)
+	case *PrintStatement:
+		c := *n
+		c.Value = rewriteExpr(n.Value, fn)
+		return fn(&c)
+	case *ReturnStatement:
+		c := *n
+		c.Value = rewriteExpr(n.Value, fn)
+		return fn(&c)
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = rewriteExpr(n.Expression, fn)
+		return fn(&c)
+	case *GlobalStatement:
+		c := *n
+		c.Names = append([]string(nil), n.Names...)
+		return fn(&c)
+	case *BinaryExpression:
+		c := *n
+		c.Left = rewriteExpr(n.Left, fn)
+		c.Right = rewriteExpr(n.Right, fn)
+		return fn(&c)
+	case *PrefixExpression:
+		c := *n
+		c.Right = rewriteExpr(n.Right, fn)
+		return fn(&c)
+	case *FunctionCall:
+		c := *n
+		if n.Arguments != nil {
+			c.Arguments = make([]Expression, len(n.Arguments))
+			for i, arg := range n.Arguments {
+				c.Arguments[i] = rewriteExpr(arg, fn)
+			}
+		}
+		return fn(&c)
+	case *DictLiteral:
+		c := *n
+		c.Keys = make([]Expression, len(n.Keys))
+		c.Values = make([]Expression, len(n.Values))
+		for i := range n.Keys {
+			c.Keys[i] = rewriteExpr(n.Keys[i], fn)
+			c.Values[i] = rewriteExpr(n.Values[i], fn)
+		}
+		return fn(&c)
+	case *ListLiteral:
+		c := *n
+		c.Elements = make([]Expression, len(n.Elements))
+		for i, e := range n.Elements {
+			c.Elements[i] = rewriteExpr(e, fn)
+		}
+		return fn(&c)
+	case *Comparison:
+		c := *n
+		c.Operands = make([]Expression, len(n.Operands))
+		for i, operand := range n.Operands {
+			c.Operands[i] = rewriteExpr(operand, fn)
+		}
+		return fn(&c)
+	case *IndexExpression:
+		c := *n
+		c.Left = rewriteExpr(n.Left, fn)
+		c.Index = rewriteExpr(n.Index, fn)
+		return fn(&c)
+	case *InterpolatedString:
+		c := *n
+		c.Parts = make([]Expression, len(n.Parts))
+		for i, part := range n.Parts {
+			c.Parts[i] = rewriteExpr(part, fn)
+		}
+		return fn(&c)
+	case *Identifier:
+		c := *n
+		return fn(&c)
+	case *IntegerLiteral:
+		c := *n
+		return fn(&c)
+	case *FloatLiteral:
+		c := *n
+		return fn(&c)
+	case *StringLiteral:
+		c := *n
+		return fn(&c)
+	case *NoneLiteral:
+		c := *n
+		return fn(&c)
+	}
+	return fn(node)
+}
+
+func rewriteExpr(e Expression, fn func(Node) Node) Expression {
+	if e == nil {
+		return nil
+	}
+	r := Rewrite(e, fn)
+	if r == nil {
+		return nil
+	}
+	expr, ok := r.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: %T replaced by non-expression %T", e, r))
+	}
+	return expr
+}
+
+func rewriteBlock(stmts []Statement, fn func(Node) Node) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	out := make([]Statement, 0, len(stmts))
+	for _, s := range stmts {
+		r := Rewrite(s, fn)
+		if r == nil {
+			continue
+		}
+		stmt, ok := r.(Statement)
+		if !ok {
+			panic(fmt.Sprintf("ast.Rewrite: %T replaced by non-statement %T", s, r))
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
@@ -0,0 +1,218 @@
+package ast
+
+import (
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// Validate reports the structural problems in a tree that the code generator
+// cannot compile: a missing operand, value or condition, an empty block and
+// mismatched parallel lists. The parser never builds such a tree, but a
+// rewrite or a tree built by hand can. Each problem is positioned at the
+// nearest token, which for an operator is its left operand's.
+func Validate(node Node) []diag.Diagnostic {
+	v := &validator{}
+	v.node(node)
+	return v.diags
+}
+
+type validator struct {
+	at    token.Token // the token of the innermost node that has one
+	diags []diag.Diagnostic
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.diags = append(v.diags, diag.Errorf(v.at.Line, v.at.Column, format, args...))
+}
+
+// startAt positions the problems in e at its first token, if it has one
+func (v *validator) startAt(e Expression) {
+	if tok := StartToken(e); tok.Line > 0 {
+		v.at = tok
+	}
+}
+
+// expr validates e, reporting it as missing when it is nil
+func (v *validator) expr(e Expression, what string) {
+	if isNil(e) {
+		v.errorf("missing %s", what)
+		return
+	}
+	v.node(e)
+}
+
+// block validates stmts, which must hold at least one statement
+func (v *validator) block(stmts []Statement, what string) {
+	if len(stmts) == 0 {
+		v.errorf("empty %s", what)
+	}
+	v.statements(stmts)
+}
+
+func (v *validator) statements(stmts []Statement) {
+	for _, s := range stmts {
+		if isNil(s) {
+			v.errorf("missing statement")
+			continue
+		}
+		v.node(s)
+	}
+}
+
+func (v *validator) node(node Node) {
+	outer := v.at
+	defer func() { v.at = outer }()
+
+	switch n := node.(type) {
+	case *Program:
+		v.statements(n.Statements)
+	case *FunctionDefinition:
+		v.at = n.Token
+		v.block(n.Body, "body of '"+n.Name+"'")
+	case *IfStatement:
+		v.at = n.Token
+		v.expr(n.Condition, "if condition")
+		v.block(n.Consequence, "if block")
+		for _, e := range n.Elifs {
+			v.node(e)
+		}
+		v.statements(n.Alternative)
+	case *ElifClause:
+		v.at = n.Token
+		v.expr(n.Condition, "elif condition")
+		v.block(n.Consequence, "elif block")
+	case *WhileStatement:
+		v.at = n.Token
+		v.expr(n.Condition, "while condition")
+		v.block(n.Body, "while body")
+	case *ForStatement:
+		v.at = n.Token
+		if !isNil(n.Start) {
+			v.node(n.Start)
+		}
+		v.expr(n.Stop, "range stop")
+		if !isNil(n.Step) {
+			v.node(n.Step)
+		}
+		v.block(n.Body, "for body")
+	case *AssignmentStatement:
+		v.at = n.Token
+		v.expr(n.Value, "value assigned to '"+n.Name+"'")
+	case *TupleAssignment:
+		v.at = n.Token
+		if len(n.Names) != len(n.Values) {
+			v.errorf("mismatched tuple assignment: %d names, %d values", len(n.Names), len(n.Values))
+		}
+		for _, value := range n.Values {
+			v.expr(value, "value in a tuple assignment")
+		}
+	case *AugmentedAssignment:
+		v.at = n.Token
+		v.expr(n.Value, "value assigned to '"+n.Name+"'")
+	case *IndexAssignment:
+		v.at = n.Token
+		if n.Target == nil {
+			v.errorf("missing element assigned to")
+		} else {
+			v.node(n.Target)
+		}
+		v.expr(n.Value, "value assigned to an element")
+	case *PrintStatement:
+		v.at = n.Token
+		v.expr(n.Value, "value to print")
+	case *ReturnStatement:
+		v.at = n.Token
+		if !isNil(n.Value) {
+			v.node(n.Value)
+		}
+	case *ExpressionStatement:
+		v.expr(n.Expression, "expression")
+	case *BinaryExpression:
+		v.startAt(n)
+		v.expr(n.Left, "left operand of '"+n.Operator+"'")
+		v.expr(n.Right, "right operand of '"+n.Operator+"'")
+	case *Comparison:
+		v.startAt(n)
+		if len(n.Operators) < 2 || len(n.Operands) != len(n.Operators)+1 {
+			v.errorf("mismatched comparison: %d operands, %d operators", len(n.Operands), len(n.Operators))
+		}
+		for _, operand := range n.Operands {
+			v.expr(operand, "operand of a comparison")
+		}
+	case *PrefixExpression:
+		v.at = n.Token
+		v.expr(n.Right, "operand of '"+n.Operator+"'")
+	case *FunctionCall:
+		v.at = n.Token
+		for _, arg := range n.Arguments {
+			v.expr(arg, "argument to '"+n.Function+"'")
+		}
+	case *ListLiteral:
+		v.at = n.Token
+		for _, e := range n.Elements {
+			v.expr(e, "list element")
+		}
+	case *DictLiteral:
+		v.at = n.Token
+		if len(n.Keys) != len(n.Values) {
+			v.errorf("mismatched dictionary: %d keys, %d values", len(n.Keys), len(n.Values))
+		}
+		for _, key := range n.Keys {
+			v.expr(key, "dictionary key")
+		}
+		for _, value := range n.Values {
+			v.expr(value, "dictionary value")
+		}
+	case *IndexExpression:
+		v.at = n.Token
+		v.expr(n.Left, "value to index")
+		v.expr(n.Index, "index")
+	case *InterpolatedString:
+		v.at = n.Token
+		for _, part := range n.Parts {
+			v.expr(part, "part of an f-string")
+		}
+	}
+}
+
+// StartToken returns the token e begins with. Its Line is zero when e holds
+// none, as a BinaryExpression missing its left operand does.
+func StartToken(e Expression) token.Token {
+	switch e := e.(type) {
+	case *BinaryExpression:
+		if !isNil(e.Left) {
+			return StartToken(e.Left)
+		}
+	case *Comparison:
+		if len(e.Operands) > 0 && !isNil(e.Operands[0]) {
+			return StartToken(e.Operands[0])
+		}
+	case *Identifier:
+		return e.Token
+	case *IntegerLiteral:
+		return e.Token
+	case *FloatLiteral:
+		return e.Token
+	case *StringLiteral:
+		return e.Token
+	case *NoneLiteral:
+		return e.Token
+	case *PrefixExpression:
+		return e.Token
+	case *FunctionCall:
+		return e.Token
+	case *ListLiteral:
+		return e.Token
+	case *DictLiteral:
+		return e.Token
+	case *IndexExpression:
+		// Token is the '[' after the value indexed
+		if !isNil(e.Left) {
+			return StartToken(e.Left)
+		}
+		return e.Token
+	case *InterpolatedString:
+		return e.Token
+	}
+	return token.Token{}
+}
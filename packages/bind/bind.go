@@ -0,0 +1,219 @@
+// Package bind resolves every variable name in a program to the symbol it
+// refers to and records it on the node, so later stages never look names up
+// themselves.
+package bind
+
+import (
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/symbol"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// Program sets the Symbol of every Identifier and AssignmentStatement in
+// program and the Params and Locals of every function, and returns the global scope.
+// As in Python, a variable a function assigns is local to it unless the
+// function declares it global, and its parameters and locals shadow globals
+// of the same name. Function names are a separate namespace and are not
+// bound.
+func Program(program *ast.Program) *symbol.SymbolTable {
+	b := &binder{globals: symbol.NewSymbolTable(nil)}
+	b.block(program.Statements, b.globals)
+	return b.globals
+}
+
+// Statement binds stmt as a top-level statement of the program whose
+// global scope is globals, defining there any global it introduces
+func Statement(stmt ast.Statement, globals *symbol.SymbolTable) {
+	b := &binder{globals: globals}
+	b.statement(stmt, globals)
+}
+
+type binder struct {
+	globals *symbol.SymbolTable
+}
+
+func (b *binder) block(stmts []ast.Statement, scope *symbol.SymbolTable) {
+	for _, stmt := range stmts {
+		b.statement(stmt, scope)
+	}
+}
+
+func (b *binder) statement(stmt ast.Statement, scope *symbol.SymbolTable) {
+	switch s := stmt.(type) {
+	case *ast.FunctionDefinition:
+		inner := b.globals.EnterScope("function")
+		s.Params = nil
+		for _, p := range s.Parameters {
+			param := inner.Define(p, symbol.IntegerType)
+			param.IsParam = true
+			s.Params = append(s.Params, param)
+		}
+		s.Locals = nil
+		for _, name := range ast.LocalNames(s) {
+			s.Locals = append(s.Locals, inner.Define(name, symbol.IntegerType))
+		}
+		b.block(s.Body, inner)
+	case *ast.AssignmentStatement:
+		s.Symbol = b.assign(s, scope)
+		b.expression(s.Value, scope)
+	case *ast.AugmentedAssignment:
+		b.expression(s.Value, scope)
+	case *ast.IndexAssignment:
+		b.expression(s.Target, scope)
+		b.expression(s.Value, scope)
+	case *ast.PrintStatement:
+		b.expression(s.Value, scope)
+	case *ast.ReturnStatement:
+		b.expression(s.Value, scope)
+	case *ast.ExpressionStatement:
+		b.expression(s.Expression, scope)
+	case *ast.IfStatement:
+		b.expression(s.Condition, scope)
+		b.block(s.Consequence, scope)
+		b.block(s.Alternative, scope)
+	case *ast.WhileStatement:
+		b.expression(s.Condition, scope)
+		b.block(s.Body, scope)
+	}
+}
+
+// assign returns the variable an assignment writes. A variable other than a
+// parameter takes the type of the last value assigned to it, which decides how print treats it, and
+// the storage its type annotation selects. A dictionary or a list holds
+// strings when any of its values is a string literal, and a list
+// variable, sorted and reversed give a list of what the list holds. A list
+// of lists also records what its rows hold.
+func (b *binder) assign(s *ast.AssignmentStatement, scope *symbol.SymbolTable) *symbol.Symbol {
+	symType, values, rows := symbol.IntegerType, symbol.SymbolType(""), symbol.SymbolType("")
+	switch v := s.Value.(type) {
+	case *ast.StringLiteral:
+		symType = symbol.StringType
+	case *ast.DictLiteral:
+		symType, values = symbol.DictType, symbol.IntegerType
+		for _, value := range v.Values {
+			if _, ok := value.(*ast.StringLiteral); ok {
+				values = symbol.StringType
+			}
+		}
+	case *ast.ListLiteral, *ast.FunctionCall, *ast.Identifier, *ast.IndexExpression:
+		if held, ok := b.listValues(v, scope); ok {
+			symType, values = symbol.ListType, held
+			if held == symbol.ListType {
+				rows = b.rowValues(v, scope)
+			}
+		}
+	}
+	sym := b.resolve(s.Name, scope)
+	if sym != nil && !sym.IsParam {
+		sym.Type, sym.Values, sym.Rows = symType, values, rows
+		if storage, ok := symbol.LookupStorage(s.Annotation); ok {
+			sym.Storage = storage
+		}
+	}
+	return sym
+}
+
+// listValues reports whether e is a list, and what it holds
+func (b *binder) listValues(e ast.Expression, scope *symbol.SymbolTable) (symbol.SymbolType, bool) {
+	switch e := e.(type) {
+	case *ast.ListLiteral:
+		for _, element := range e.Elements {
+			if _, ok := element.(*ast.StringLiteral); ok {
+				return symbol.StringType, true
+			}
+			if _, ok := b.listValues(element, scope); ok {
+				return symbol.ListType, true
+			}
+		}
+		return symbol.IntegerType, true
+	case *ast.IndexExpression:
+		// A row of a list of lists
+		if held, ok := b.listValues(e.Left, scope); ok && held == symbol.ListType {
+			return b.rowValues(e.Left, scope), true
+		}
+	case *ast.FunctionCall:
+		if (e.Function == "sorted" || e.Function == "reversed") && len(e.Arguments) == 1 {
+			return b.listValues(e.Arguments[0], scope)
+		}
+		if e.Function == "zeros" {
+			return symbol.ListType, true
+		}
+	case *ast.Identifier:
+		if list := b.resolve(e.Value, scope); list != nil && list.Type == symbol.ListType {
+			return list.Values, true
+		}
+	}
+	return "", false
+}
+
+// rowValues is what the rows of e, a list of lists, hold
+func (b *binder) rowValues(e ast.Expression, scope *symbol.SymbolTable) symbol.SymbolType {
+	switch e := e.(type) {
+	case *ast.ListLiteral:
+		rows := symbol.IntegerType
+		for _, element := range e.Elements {
+			if held, ok := b.listValues(element, scope); ok && held == symbol.StringType {
+				rows = held
+			}
+		}
+		return rows
+	case *ast.FunctionCall:
+		if len(e.Arguments) == 1 {
+			return b.rowValues(e.Arguments[0], scope)
+		}
+	case *ast.Identifier:
+		if list := b.resolve(e.Value, scope); list != nil {
+			return list.Rows
+		}
+	}
+	return symbol.IntegerType
+}
+
+func (b *binder) expression(e ast.Expression, scope *symbol.SymbolTable) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		e.Symbol = b.resolve(e.Value, scope)
+	case *ast.BinaryExpression:
+		b.expression(e.Left, scope)
+		b.expression(e.Right, scope)
+	case *ast.Comparison:
+		for _, operand := range e.Operands {
+			b.expression(operand, scope)
+		}
+	case *ast.PrefixExpression:
+		b.expression(e.Right, scope)
+	case *ast.FunctionCall:
+		for _, arg := range e.Arguments {
+			b.expression(arg, scope)
+		}
+	case *ast.DictLiteral:
+		for i := range e.Keys {
+			b.expression(e.Keys[i], scope)
+			b.expression(e.Values[i], scope)
+		}
+	case *ast.ListLiteral:
+		for _, element := range e.Elements {
+			b.expression(element, scope)
+		}
+	case *ast.IndexExpression:
+		b.expression(e.Left, scope)
+		b.expression(e.Index, scope)
+	case *ast.InterpolatedString:
+		for _, part := range e.Parts {
+			b.expression(part, scope)
+		}
+	}
+}
+
+// resolve finds the variable name refers to in scope. A name that is not
+// yet defined becomes a global, so one read before any assignment still
+// gets storage. Keywords never name a variable.
+func (b *binder) resolve(name string, scope *symbol.SymbolTable) *symbol.Symbol {
+	if token.LookupIdent(name) != token.IDENT {
+		return nil
+	}
+	if sym, ok := scope.Lookup(name); ok {
+		return sym
+	}
+	return b.globals.Define(name, symbol.IntegerType)
+}
@@ -0,0 +1,159 @@
+package bind
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/parser"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string // every binding, in source order
+		globals  map[string]symbol.SymbolType
+	}{
+		{
+			name:     "globals",
+			input:    "x = 1\ny = x + z\n",
+			expected: []string{"1: x global", "2: y global", "2: x global", "2: z global"},
+			globals:  map[string]symbol.SymbolType{"x": symbol.IntegerType, "y": symbol.IntegerType, "z": symbol.IntegerType},
+		},
+		{
+			name:     "parameter shadows global",
+			input:    "x = 5\ndef f(x):\n\tx = x + y\n\treturn x\n\ny = f(x)\n",
+			expected: []string{"1: x global", "3: x param", "3: x param", "3: y global", "4: x param", "6: y global", "6: x global"},
+			globals:  map[string]symbol.SymbolType{"x": symbol.IntegerType, "y": symbol.IntegerType},
+		},
+		{
+			name:     "assignment inside a function is local",
+			input:    "def f(a):\n\tn = a\n\treturn n\n\nprint(n)\n",
+			expected: []string{"2: n local", "2: a param", "3: n local", "5: n global"},
+			globals:  map[string]symbol.SymbolType{"n": symbol.IntegerType},
+		},
+		{
+			name:     "local shadows global",
+			input:    "s = 1\ndef f():\n\ts = \"hi\"\n\treturn s\n\nprint(s)\n",
+			expected: []string{"1: s global", "3: s local", "4: s local", "6: s global"},
+			globals:  map[string]symbol.SymbolType{"s": symbol.IntegerType},
+		},
+		{
+			name:     "global statement",
+			input:    "def f(a):\n\tglobal n\n\tn = a\n\tm = n\n\nprint(n)\n",
+			expected: []string{"3: n global", "3: a param", "4: m local", "4: n global", "6: n global"},
+			globals:  map[string]symbol.SymbolType{"n": symbol.IntegerType},
+		},
+		{
+			name:     "last assignment decides the type",
+			input:    "s = 1\nif s > 0:\n\ts = \"hi\"\nprint(s)\n",
+			expected: []string{"1: s global", "2: s global", "3: s global", "4: s global"},
+			globals:  map[string]symbol.SymbolType{"s": symbol.StringType},
+		},
+		{
+			name:     "dictionary",
+			input:    "k = \"a\"\nd = {k: n}\nprint(d[k])\n",
+			expected: []string{"1: k global", "2: d global", "2: k global", "2: n global", "3: d global", "3: k global"},
+			globals:  map[string]symbol.SymbolType{"k": symbol.StringType, "d": symbol.DictType, "n": symbol.IntegerType},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			globals := Program(program)
+
+			var got []string
+			seen := make(map[string]*symbol.Symbol)
+			record := func(name string, line int, sym *symbol.Symbol) {
+				if sym == nil {
+					t.Fatalf("%s on line %d is unbound", name, line)
+				}
+				kind := "local"
+				if sym.IsParam {
+					kind = "param"
+				}
+				if sym.IsGlobal {
+					kind = "global"
+					if prev, ok := seen[name]; ok && prev != sym {
+						t.Errorf("global %s bound to two symbols", name)
+					}
+					seen[name] = sym
+				}
+				got = append(got, fmt.Sprintf("%d: %s %s", line, name, kind))
+			}
+			walk(program.Statements, record)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("wrong bindings.\nexpected: %q\ngot:      %q", tt.expected, got)
+			}
+
+			types := make(map[string]symbol.SymbolType)
+			for _, sym := range globals.GetSymbols() {
+				if !sym.IsPrint {
+					types[sym.Name] = sym.Type
+				}
+			}
+			if !reflect.DeepEqual(types, tt.globals) {
+				t.Errorf("wrong globals. expected=%v, got=%v", tt.globals, types)
+			}
+		})
+	}
+}
+
+// walk reports every bound node in source order, an assignment's target
+// before its value
+func walk(stmts []ast.Statement, record func(string, int, *symbol.Symbol)) {
+	var expr func(ast.Expression)
+	expr = func(e ast.Expression) {
+		switch e := e.(type) {
+		case *ast.Identifier:
+			record(e.Value, e.Token.Line, e.Symbol)
+		case *ast.BinaryExpression:
+			expr(e.Left)
+			expr(e.Right)
+		case *ast.PrefixExpression:
+			expr(e.Right)
+		case *ast.FunctionCall:
+			for _, arg := range e.Arguments {
+				expr(arg)
+			}
+		case *ast.DictLiteral:
+			for i := range e.Keys {
+				expr(e.Keys[i])
+				expr(e.Values[i])
+			}
+		case *ast.IndexExpression:
+			expr(e.Left)
+			expr(e.Index)
+		}
+	}
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			record(s.Name, s.Token.Line, s.Symbol)
+			expr(s.Value)
+		case *ast.PrintStatement:
+			expr(s.Value)
+		case *ast.ReturnStatement:
+			expr(s.Value)
+		case *ast.IfStatement:
+			expr(s.Condition)
+			walk(s.Consequence, record)
+			walk(s.Alternative, record)
+		case *ast.WhileStatement:
+			expr(s.Condition)
+			walk(s.Body, record)
+		case *ast.FunctionDefinition:
+			walk(s.Body, record)
+		}
+	}
+}
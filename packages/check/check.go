@@ -0,0 +1,626 @@
+// Package check performs the semantic checks that run after parsing: names
+// that are defined twice and names that hide another binding. It also marks
+// calls whose result is discarded so code generation can skip it.
+package check
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/symbol"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// builtins are functions provided by the runtime that programs may not redefine
+var builtins = map[string]bool{
+	"print":    true,
+	"format":   true,
+	"len":      true,
+	"sorted":   true,
+	"reversed": true,
+	"sum":      true,
+	"min":      true,
+	"max":      true,
+	"zeros":    true,
+}
+
+// listFunctions are the builtins that take a single list
+var listFunctions = map[string]bool{"len": true, "sorted": true, "reversed": true, "sum": true, "min": true, "max": true}
+
+// aggregates are the list functions that only work on integers
+var aggregates = map[string]bool{"sum": true, "min": true, "max": true}
+
+// listMethods are the methods a list has, none of which takes an argument
+var listMethods = map[string]bool{"sort": true, "reverse": true}
+
+type checker struct {
+	diags     []diag.Diagnostic
+	functions map[string]*ast.FunctionDefinition
+	globals   map[string]*ast.AssignmentStatement
+	locals    map[string]bool // the parameters and variables of the function being checked
+}
+
+// Check reports semantic errors and warnings for a parsed program and sets
+// Discarded on every call made as a statement
+func Check(program *ast.Program) []diag.Diagnostic {
+	return CheckWith(program, Options{})
+}
+
+// CheckWith is Check with explicit options
+func CheckWith(program *ast.Program, opts Options) []diag.Diagnostic {
+	c := &checker{
+		functions: make(map[string]*ast.FunctionDefinition),
+		globals:   make(map[string]*ast.AssignmentStatement),
+	}
+
+	// Collect every top-level binding first so names can be checked against
+	// definitions that appear later in the file
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*ast.FunctionDefinition); ok {
+			c.defineFunction(fn)
+		}
+	}
+	for _, stmt := range program.Statements {
+		c.collect(stmt)
+	}
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*ast.FunctionDefinition); ok {
+			c.checkFunction(fn)
+		}
+	}
+	c.checkComparisons(program.Statements)
+	c.checkAnnotations(program.Statements, nil, make(map[string]*ast.AssignmentStatement))
+	c.checkVoid(program)
+	c.checkEffects(program.Statements)
+	if opts.Strict {
+		c.checkStrict(program)
+	}
+	markDiscarded(program.Statements)
+	sort.SliceStable(c.diags, func(i, j int) bool { return c.diags[i].Line < c.diags[j].Line })
+	return c.diags
+}
+
+// orderings are the comparisons that need string contents rather than
+// identity
+var orderings = map[string]bool{"<": true, ">": true, "<=": true, ">=": true}
+
+// checkComparisons rejects ordering a string literal against a value only
+// known at run time. == and != compare two strings by contents, but the
+// other comparisons would only order their addresses, which means nothing.
+func (c *checker) checkComparisons(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			c.checkExpr(s.Value)
+		case *ast.PrintStatement:
+			if fs, ok := s.Value.(*ast.InterpolatedString); ok {
+				for _, part := range fs.Parts {
+					c.checkExpr(part)
+				}
+				continue
+			}
+			c.checkExpr(s.Value)
+		case *ast.ReturnStatement:
+			c.checkExpr(s.Value)
+		case *ast.ExpressionStatement:
+			c.checkExpr(s.Expression)
+		case *ast.IndexAssignment:
+			c.checkExpr(s.Target)
+			c.checkExpr(s.Value)
+			c.checkStore(s)
+		case *ast.FunctionDefinition:
+			c.locals = make(map[string]bool)
+			for _, p := range s.Parameters {
+				c.locals[p] = true
+			}
+			for _, name := range ast.LocalNames(s) {
+				c.locals[name] = true
+			}
+			c.checkComparisons(s.Body)
+			c.locals = nil
+		case *ast.IfStatement:
+			c.checkExpr(s.Condition)
+			c.checkComparisons(s.Consequence)
+			c.checkComparisons(s.Alternative)
+		case *ast.WhileStatement:
+			c.checkExpr(s.Condition)
+			c.checkComparisons(s.Body)
+		}
+	}
+}
+
+func (c *checker) checkExpr(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.BinaryExpression:
+		c.checkExpr(e.Left)
+		c.checkExpr(e.Right)
+		c.checkOrdering(e.Left, e.Operator, e.Right)
+		// desugar has already lowered every format string it can
+		if lit, ok := e.Left.(*ast.StringLiteral); ok && e.Operator == "%" {
+			c.errorf(lit.Token.Line, lit.Token.Column, "a format string for '%%' needs exactly one %%d, %%i or %%s conversion, optionally with a width as in %%5d or %%-5d")
+		}
+	case *ast.Comparison:
+		for _, operand := range e.Operands {
+			c.checkExpr(operand)
+		}
+		// A string between two orderings would otherwise be reported twice
+		for i, op := range e.Operators {
+			if c.checkOrdering(e.Operands[i], op, e.Operands[i+1]) {
+				break
+			}
+		}
+	case *ast.PrefixExpression:
+		c.checkExpr(e.Right)
+	case *ast.FunctionCall:
+		for _, arg := range e.Arguments {
+			c.checkExpr(arg)
+		}
+		switch {
+		case e.Method:
+			c.checkMethod(e)
+		case e.Function == "format":
+			c.checkFormat(e)
+		case e.Function == "zeros":
+			c.checkZeros(e)
+		case listFunctions[e.Function] && len(e.Arguments) != 1:
+			c.errorf(e.Token.Line, e.Token.Column, "%s() takes a list, got %d arguments", e.Function, len(e.Arguments))
+		case aggregates[e.Function]:
+			c.checkAggregate(e)
+		case e.Function == "sorted" && holdsLists(c.literalOf(e.Arguments[0])):
+			c.errorf(e.Token.Line, e.Token.Column, "sorted() cannot order a list of lists")
+		}
+	case *ast.DictLiteral:
+		for i := range e.Keys {
+			c.checkExpr(e.Keys[i])
+			c.checkExpr(e.Values[i])
+		}
+		c.checkEntries(e.Keys, "dictionary keys")
+		c.checkEntries(e.Values, "dictionary values")
+	case *ast.ListLiteral:
+		for _, element := range e.Elements {
+			c.checkExpr(element)
+		}
+		c.checkEntries(e.Elements, "list elements")
+		c.checkRows(e)
+	case *ast.IndexExpression:
+		c.checkExpr(e.Left)
+		c.checkExpr(e.Index)
+	case *ast.Identifier:
+		// desugar has already replaced every main guard with its block
+		if e.Value == "__name__" {
+			c.errorf(e.Token.Line, e.Token.Column, "'__name__' can only be compared with \"__main__\" in an if statement")
+		}
+	case *ast.InterpolatedString:
+		// Each part is printed by its own system call, so there is no
+		// string value to store or compute with
+		c.errorf(e.Token.Line, e.Token.Column, "an f-string can only be printed")
+	}
+}
+
+// checkFormat checks a call to the format builtin, which turns an integer
+// or a string into a string padded to an optional width
+func (c *checker) checkFormat(call *ast.FunctionCall) {
+	if n := len(call.Arguments); n != 1 && n != 2 {
+		c.errorf(call.Token.Line, call.Token.Column, "format() takes a value and an optional width, got %d arguments", n)
+		return
+	}
+	if f, ok := call.Arguments[0].(*ast.FloatLiteral); ok {
+		c.errorf(f.Token.Line, f.Token.Column, "format() can only format integers and strings")
+	}
+	if len(call.Arguments) == 2 {
+		if s, ok := call.Arguments[1].(*ast.StringLiteral); ok {
+			c.errorf(s.Token.Line, s.Token.Column, "the width given to format() must be an integer")
+		}
+	}
+}
+
+// checkZeros checks a call to the zeros builtin, which makes a list of rows
+// of zeros from a number of rows and of columns
+func (c *checker) checkZeros(call *ast.FunctionCall) {
+	if n := len(call.Arguments); n != 2 {
+		c.errorf(call.Token.Line, call.Token.Column, "zeros() takes a number of rows and of columns, got %d arguments", n)
+		return
+	}
+	for _, arg := range call.Arguments {
+		switch arg := arg.(type) {
+		case *ast.StringLiteral:
+			c.errorf(arg.Token.Line, arg.Token.Column, "the sizes given to zeros() must be integers")
+		case *ast.FloatLiteral:
+			c.errorf(arg.Token.Line, arg.Token.Column, "the sizes given to zeros() must be integers")
+		}
+	}
+}
+
+// checkAggregate rejects sum, min or max of a list that holds strings: a
+// literal, or a global first assigned one
+func (c *checker) checkAggregate(call *ast.FunctionCall) {
+	list := call.Arguments[0]
+	if id, ok := list.(*ast.Identifier); ok && !c.locals[id.Value] {
+		if g := c.globals[id.Value]; g != nil {
+			list = g.Value
+		}
+	}
+	if holdsStrings(list) || holdsLists(list) {
+		c.errorf(call.Token.Line, call.Token.Column, "%s() needs a list of integers", call.Function)
+	}
+}
+
+// checkRows checks a list literal that holds lists. Its elements must all
+// be lists, which hold no lists of their own, and print can only tell the
+// rows apart when they all hold strings or all hold integers.
+func (c *checker) checkRows(list *ast.ListLiteral) {
+	if !holdsLists(list) {
+		return
+	}
+	var strings, integers bool
+	for _, element := range list.Elements {
+		row, ok := element.(*ast.ListLiteral)
+		if !ok {
+			c.errorf(list.Token.Line, list.Token.Column, "list elements must all be lists or none of them")
+			return
+		}
+		if holdsLists(row) {
+			c.errorf(row.Token.Line, row.Token.Column, "lists can only nest one level deep")
+			return
+		}
+		for _, e := range row.Elements {
+			switch e.(type) {
+			case *ast.StringLiteral:
+				strings = true
+			case *ast.IntegerLiteral:
+				integers = true
+			}
+		}
+		if strings && integers {
+			c.errorf(row.Token.Line, row.Token.Column, "the rows of a list must all hold strings or all hold integers")
+			return
+		}
+	}
+}
+
+// checkStore checks xs[i] = v. Only list elements can be assigned, and a
+// value must be of the kind the list already holds when that is known.
+func (c *checker) checkStore(s *ast.IndexAssignment) {
+	line, column := s.Token.Line, s.Token.Column
+	target := c.literalOf(s.Target.Left)
+	if _, ok := target.(*ast.DictLiteral); ok {
+		c.errorf(line, column, "dictionary entries cannot be assigned; only list elements can")
+		return
+	}
+	lists := holdsLists(target)
+	if list, ok := target.(*ast.ListLiteral); !lists && (!ok || len(list.Elements) == 0) {
+		return
+	}
+	switch s.Value.(type) {
+	case *ast.StringLiteral:
+		if lists {
+			c.errorf(line, column, "a string cannot be stored in a list of lists")
+		} else if !holdsStrings(target) {
+			c.errorf(line, column, "a string cannot be stored in a list of integers")
+		}
+	case *ast.IntegerLiteral:
+		if lists {
+			c.errorf(line, column, "an integer cannot be stored in a list of lists")
+		} else if holdsStrings(target) {
+			c.errorf(line, column, "an integer cannot be stored in a list of strings")
+		}
+	case *ast.ListLiteral:
+		if !lists {
+			c.errorf(line, column, "a list can only be stored in a list of lists")
+		}
+	}
+}
+
+// zeroRow stands for a row of the list zeros() makes
+var zeroRow = &ast.ListLiteral{Elements: []ast.Expression{&ast.IntegerLiteral{}}}
+
+// literalOf is the literal e was built from when that is known: the value
+// a global was first assigned, or the first row of a list of lists e is
+// indexing. Otherwise it is e itself.
+func (c *checker) literalOf(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if g := c.globals[e.Value]; g != nil && !c.locals[e.Value] {
+			return g.Value
+		}
+	case *ast.IndexExpression:
+		switch list := c.literalOf(e.Left).(type) {
+		case *ast.ListLiteral:
+			for _, element := range list.Elements {
+				if row, ok := element.(*ast.ListLiteral); ok {
+					return row
+				}
+			}
+		case *ast.FunctionCall:
+			if holdsLists(list) {
+				return zeroRow
+			}
+		}
+	}
+	return e
+}
+
+// holdsLists reports whether a value is a list literal with a list literal
+// element, or a call to zeros
+func holdsLists(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.FunctionCall:
+		return e.Function == "zeros" && !e.Method
+	case *ast.ListLiteral:
+		for _, element := range e.Elements {
+			if _, ok := element.(*ast.ListLiteral); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkMethod checks receiver.name(), which only lists have methods for
+func (c *checker) checkMethod(call *ast.FunctionCall) {
+	if !listMethods[call.Function] {
+		c.errorf(call.Token.Line, call.Token.Column, "lists have no method '%s'; use sort() or reverse()", call.Function)
+		return
+	}
+	if n := len(call.Arguments) - 1; n != 0 {
+		c.errorf(call.Token.Line, call.Token.Column, "%s() takes no arguments, got %d", call.Function, n)
+	} else if call.Function == "sort" && holdsLists(c.literalOf(call.Arguments[0])) {
+		c.errorf(call.Token.Line, call.Token.Column, "sort() cannot order a list of lists")
+	}
+}
+
+// checkOrdering rejects ordering a string literal against anything but
+// another one, reporting whether it did
+func (c *checker) checkOrdering(left ast.Expression, op string, right ast.Expression) bool {
+	if !orderings[op] {
+		return false
+	}
+	l, lok := left.(*ast.StringLiteral)
+	r, rok := right.(*ast.StringLiteral)
+	if lok == rok {
+		return false
+	}
+	lit := l
+	if !lok {
+		lit = r
+	}
+	c.errorf(lit.Token.Line, lit.Token.Column, "a string can only be compared with '%s' against another string literal", op)
+	return true
+}
+
+// checkEntries rejects the literal keys or values of a dictionary, or the
+// elements of a list, when they mix strings and integers, which lookups and
+// print could not tell apart, or include a float
+func (c *checker) checkEntries(entries []ast.Expression, what string) {
+	var sawString, sawInteger, mixed bool
+	for _, e := range entries {
+		var tok token.Token
+		switch e := e.(type) {
+		case *ast.FloatLiteral:
+			c.errorf(e.Token.Line, e.Token.Column, "%s cannot be floats", what)
+			continue
+		case *ast.StringLiteral:
+			tok, sawString = e.Token, true
+		case *ast.IntegerLiteral:
+			tok, sawInteger = e.Token, true
+		default:
+			continue
+		}
+		if sawString && sawInteger && !mixed {
+			c.errorf(tok.Line, tok.Column, "%s must be all strings or all integers", what)
+			mixed = true
+		}
+	}
+}
+
+// checkAnnotations validates the types in name: type = value. A global keeps
+// one type everywhere it is annotated, parameters take none, and a constant
+// must fit the storage it selects.
+func (c *checker) checkAnnotations(stmts []ast.Statement, params map[string]bool, seen map[string]*ast.AssignmentStatement) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			if s.Annotation != "" {
+				c.checkAnnotation(s, params, seen)
+			}
+		case *ast.FunctionDefinition:
+			inner := make(map[string]bool)
+			for _, p := range s.Parameters {
+				inner[p] = true
+			}
+			c.checkAnnotations(s.Body, inner, seen)
+		case *ast.IfStatement:
+			c.checkAnnotations(s.Consequence, params, seen)
+			c.checkAnnotations(s.Alternative, params, seen)
+		case *ast.WhileStatement:
+			c.checkAnnotations(s.Body, params, seen)
+		}
+	}
+}
+
+func (c *checker) checkAnnotation(s *ast.AssignmentStatement, params map[string]bool, seen map[string]*ast.AssignmentStatement) {
+	line, column := s.Token.Line, s.Token.Column
+	storage, ok := symbol.LookupStorage(s.Annotation)
+	switch {
+	case !ok:
+		c.errorf(line, column, "unknown type '%s' for '%s'; expected one of %s", s.Annotation, s.Name, strings.Join(symbol.StorageNames(), ", "))
+		return
+	case params[s.Name]:
+		c.errorf(line, column, "parameter '%s' cannot be annotated", s.Name)
+		return
+	}
+	if prev, ok := seen[s.Name]; ok && prev.Annotation != s.Annotation {
+		c.errorf(line, column, "'%s' is annotated as %s here but as %s on line %d", s.Name, s.Annotation, prev.Annotation, prev.Token.Line)
+	} else if !ok {
+		seen[s.Name] = s
+	}
+
+	switch v := s.Value.(type) {
+	case *ast.StringLiteral:
+		c.errorf(line, column, "'%s' is annotated as %s but assigned a string", s.Name, s.Annotation)
+	case *ast.IntegerLiteral:
+		if min, max, bounded := storage.Range(); bounded && (v.Value < min || v.Value > max) {
+			c.errorf(line, column, "%d does not fit in %s '%s' (%d to %d)", v.Value, s.Annotation, s.Name, min, max)
+		}
+	}
+}
+
+// markDiscarded flags the calls whose value nothing reads
+func markDiscarded(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.ExpressionStatement:
+			if call, ok := s.Expression.(*ast.FunctionCall); ok {
+				call.Discarded = true
+			}
+		case *ast.FunctionDefinition:
+			markDiscarded(s.Body)
+		case *ast.IfStatement:
+			markDiscarded(s.Consequence)
+			markDiscarded(s.Alternative)
+		case *ast.WhileStatement:
+			markDiscarded(s.Body)
+		}
+	}
+}
+
+func (c *checker) defineFunction(fn *ast.FunctionDefinition) {
+	if builtins[fn.Name] {
+		c.errorf(fn.Token.Line, fn.Token.Column, "'%s' is a builtin function and cannot be redefined", fn.Name)
+		return
+	}
+	if prev, ok := c.functions[fn.Name]; ok {
+		c.errorf(fn.Token.Line, fn.Token.Column, "function '%s' is already defined on line %d", fn.Name, prev.Token.Line)
+		return
+	}
+	c.functions[fn.Name] = fn
+}
+
+// collect records the global variables assigned by top-level code and by
+// functions that declare them global
+func (c *checker) collect(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		if builtins[s.Name] {
+			c.errorf(s.Token.Line, s.Token.Column, "'%s' is a builtin function and cannot be assigned to", s.Name)
+			return
+		}
+		if s.Name == "__name__" {
+			c.errorf(s.Token.Line, s.Token.Column, "'__name__' is always \"__main__\" and cannot be assigned to")
+			return
+		}
+		if fn, ok := c.functions[s.Name]; ok {
+			c.warningf(s.Token.Line, s.Token.Column, "assignment to '%s' shadows the function defined on line %d", s.Name, fn.Token.Line)
+		}
+		if _, ok := c.globals[s.Name]; !ok {
+			c.globals[s.Name] = s
+		}
+	case *ast.GlobalStatement:
+		c.warningf(s.Token.Line, s.Token.Column, "'global' outside a function has no effect")
+	case *ast.FunctionDefinition:
+		// A function assigns the globals it declares
+		declared := ast.DeclaredGlobals(s)
+		ast.Rewrite(s, func(n ast.Node) ast.Node {
+			if a, ok := n.(*ast.AssignmentStatement); ok && declared[a.Name] {
+				if _, ok := c.globals[a.Name]; !ok {
+					c.globals[a.Name] = a
+				}
+			}
+			return n
+		})
+	case *ast.IfStatement:
+		for _, inner := range s.Consequence {
+			c.collect(inner)
+		}
+		for _, inner := range s.Alternative {
+			c.collect(inner)
+		}
+	case *ast.WhileStatement:
+		for _, inner := range s.Body {
+			c.collect(inner)
+		}
+	}
+}
+
+func (c *checker) checkFunction(fn *ast.FunctionDefinition) {
+	params := make(map[string]bool)
+	for _, p := range fn.Parameters {
+		switch {
+		case params[p]:
+			c.errorf(fn.Token.Line, 0, "duplicate parameter '%s' in function '%s'", p, fn.Name)
+		case builtins[p]:
+			c.errorf(fn.Token.Line, 0, "'%s' is a builtin function and cannot be used as a parameter name", p)
+		case c.functions[p] != nil:
+			c.warningf(fn.Token.Line, 0, "parameter '%s' of '%s' shadows the function defined on line %d", p, fn.Name, c.functions[p].Token.Line)
+		case c.globals[p] != nil:
+			c.warningf(fn.Token.Line, 0, "parameter '%s' of '%s' shadows the global variable assigned on line %d", p, fn.Name, c.globals[p].Token.Line)
+		}
+		params[p] = true
+	}
+	c.checkGlobals(fn, params)
+	c.checkBody(fn, fn.Body, params, ast.DeclaredGlobals(fn))
+}
+
+// checkGlobals rejects declaring a parameter global, and declaring a name
+// global after the function has already used it
+func (c *checker) checkGlobals(fn *ast.FunctionDefinition, params map[string]bool) {
+	firstUse := make(map[string]int)
+	use := func(name string, line int) {
+		if first, ok := firstUse[name]; !ok || line < first {
+			firstUse[name] = line
+		}
+	}
+	var decls []*ast.GlobalStatement
+	ast.Rewrite(fn, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.AssignmentStatement:
+			use(n.Name, n.Token.Line)
+		case *ast.Identifier:
+			use(n.Value, n.Token.Line)
+		case *ast.GlobalStatement:
+			decls = append(decls, n)
+		}
+		return n
+	})
+	for _, g := range decls {
+		for _, name := range g.Names {
+			if params[name] {
+				c.errorf(g.Token.Line, g.Token.Column, "'%s' is a parameter of '%s' and cannot be declared global", name, fn.Name)
+			} else if line, ok := firstUse[name]; ok && line < g.Token.Line {
+				c.errorf(g.Token.Line, g.Token.Column, "'%s' is used on line %d, before it is declared global", name, line)
+			}
+		}
+	}
+}
+
+func (c *checker) checkBody(fn *ast.FunctionDefinition, body []ast.Statement, params, declared map[string]bool) {
+	for _, stmt := range body {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			switch {
+			case params[s.Name], declared[s.Name]:
+			case builtins[s.Name]:
+				c.errorf(s.Token.Line, s.Token.Column, "'%s' is a builtin function and cannot be assigned to", s.Name)
+			case c.functions[s.Name] != nil:
+				c.warningf(s.Token.Line, s.Token.Column, "assignment to '%s' inside '%s' shadows the function defined on line %d", s.Name, fn.Name, c.functions[s.Name].Token.Line)
+			case c.globals[s.Name] != nil:
+				c.warningf(s.Token.Line, s.Token.Column, "assignment to '%s' inside '%s' shadows the global variable assigned on line %d", s.Name, fn.Name, c.globals[s.Name].Token.Line)
+			}
+		case *ast.IfStatement:
+			c.checkBody(fn, s.Consequence, params, declared)
+			c.checkBody(fn, s.Alternative, params, declared)
+		case *ast.WhileStatement:
+			c.checkBody(fn, s.Body, params, declared)
+		}
+	}
+}
+
+func (c *checker) errorf(line, column int, format string, args ...interface{}) {
+	c.diags = append(c.diags, diag.Errorf(line, column, format, args...))
+}
+
+func (c *checker) warningf(line, column int, format string, args ...interface{}) {
+	c.diags = append(c.diags, diag.Warningf(line, column, format, args...))
+}
@@ -0,0 +1,491 @@
+package check
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []diag.Diagnostic
+	}{
+		{
+			name:  "clean program",
+			input: "def add(a, b):\n\treturn a + b\n\nx = add(1, 2)\nprint(x)\n",
+		},
+		{
+			name:  "dictionary entries",
+			input: "d = {\"a\": 1, 2: \"b\", \"c\": 1.5}\ne = {1: x, 2: y}\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(1, 14, "dictionary keys must be all strings or all integers"),
+				diag.Errorf(1, 17, "dictionary values must be all strings or all integers"),
+				diag.Errorf(1, 27, "dictionary values cannot be floats"),
+			},
+		},
+		{
+			name:  "format",
+			input: "s = \"%f\" % x\nt = format(1, 2, 3)\nu = format(1.5)\nv = format(1, \"5\")\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(1, 5, "%s", "a format string for '%' needs exactly one %d, %i or %s conversion, optionally with a width as in %5d or %-5d"),
+				diag.Errorf(2, 5, "format() takes a value and an optional width, got 3 arguments"),
+				diag.Errorf(3, 12, "format() can only format integers and strings"),
+				diag.Errorf(4, 15, "the width given to format() must be an integer"),
+			},
+		},
+		{
+			name:  "lists",
+			input: "xs = [1, \"a\", 2.5]\nn = len(xs, 1)\nxs.sort(1)\nxs.push(3)\nys = sorted()\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(1, 10, "list elements must be all strings or all integers"),
+				diag.Errorf(1, 15, "list elements cannot be floats"),
+				diag.Errorf(2, 5, "len() takes a list, got 2 arguments"),
+				diag.Errorf(3, 4, "sort() takes no arguments, got 1"),
+				diag.Errorf(4, 4, "lists have no method 'push'; use sort() or reverse()"),
+				diag.Errorf(5, 6, "sorted() takes a list, got 0 arguments"),
+			},
+		},
+		{
+			name:  "aggregates",
+			input: "ws = [\"a\", \"b\"]\nn = sum(ws)\nm = max([\"x\"])\nk = min(1, 2)\ndef f(ws):\n\treturn sum(ws)\n\nprint(sum([1, 2]))\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(2, 5, "sum() needs a list of integers"),
+				diag.Errorf(3, 5, "max() needs a list of integers"),
+				diag.Errorf(4, 5, "min() takes a list, got 2 arguments"),
+				diag.Warningf(5, 0, "parameter 'ws' of 'f' shadows the global variable assigned on line 1"),
+			},
+		},
+		{
+			name:  "lists of lists",
+			input: "d = {1: 2}\nd[1] = 3\nxs = [1]\nxs[0] = \"a\"\ng = [[1], [2]]\ng[0] = 5\nxs[0] = [1]\nm = [[1], 2]\nn = [[[1]]]\nr = [[1], [\"a\"]]\nprint(sum(g))\ng.sort()\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(2, 1, "dictionary entries cannot be assigned; only list elements can"),
+				diag.Errorf(4, 1, "a string cannot be stored in a list of integers"),
+				diag.Errorf(6, 1, "an integer cannot be stored in a list of lists"),
+				diag.Errorf(7, 1, "a list can only be stored in a list of lists"),
+				diag.Errorf(8, 5, "list elements must all be lists or none of them"),
+				diag.Errorf(9, 6, "lists can only nest one level deep"),
+				diag.Errorf(10, 11, "the rows of a list must all hold strings or all hold integers"),
+				diag.Errorf(11, 7, "sum() needs a list of integers"),
+				diag.Errorf(12, 3, "sort() cannot order a list of lists"),
+			},
+		},
+		{
+			name:  "zeros",
+			input: "g = zeros(2)\nh = zeros(\"a\", 2.5)\nm = zeros(2, 2)\nm[0] = 1\nm[0][1] = \"x\"\nprint(max(m))\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(1, 5, "zeros() takes a number of rows and of columns, got 1 arguments"),
+				diag.Errorf(2, 11, "the sizes given to zeros() must be integers"),
+				diag.Errorf(2, 16, "the sizes given to zeros() must be integers"),
+				diag.Errorf(4, 1, "an integer cannot be stored in a list of lists"),
+				diag.Errorf(5, 1, "a string cannot be stored in a list of integers"),
+				diag.Errorf(6, 7, "max() needs a list of integers"),
+			},
+		},
+		{
+			name:  "values never used",
+			input: "x = 1\nx == 2\nx + 1\ndef f(n):\n\t(n - 1)\n\tf(n - 1)\n\treturn [n][0]\n\nx < 3 < 4\nx\n",
+			expected: []diag.Diagnostic{
+				diag.Warningf(2, 1, "the result of '==' is never used; did you mean '=' to assign to 'x'?"),
+				diag.Warningf(3, 1, "the value of this expression is never used; did you mean to assign it?"),
+				diag.Warningf(5, 3, "the value of this expression is never used; did you mean to assign it?"),
+				diag.Warningf(9, 1, "the value of this expression is never used; did you mean to assign it?"),
+				diag.Warningf(10, 1, "the value of this expression is never used; did you mean to assign it?"),
+			},
+		},
+		{
+			name:  "duplicate parameter",
+			input: "def f(x, x):\n\treturn x\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(1, 0, "duplicate parameter 'x' in function 'f'"),
+			},
+		},
+		{
+			name:  "function defined twice",
+			input: "def f(a):\n\treturn a\n\ndef f(b):\n\treturn b\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(4, 1, "function 'f' is already defined on line 1"),
+			},
+		},
+		{
+			name:  "parameter shadows global",
+			input: "x = 1\ndef f(x):\n\treturn x\n",
+			expected: []diag.Diagnostic{
+				diag.Warningf(2, 0, "parameter 'x' of 'f' shadows the global variable assigned on line 1"),
+			},
+		},
+		{
+			name:  "parameter shadows function",
+			input: "def g(a):\n\treturn a\n\ndef f(g):\n\treturn g\n",
+			expected: []diag.Diagnostic{
+				diag.Warningf(4, 0, "parameter 'g' of 'f' shadows the function defined on line 1"),
+			},
+		},
+		{
+			name:  "local assignment shadows global",
+			input: "def f(a):\n\ty = a\n\treturn y\n\ny = 4\n",
+			expected: []diag.Diagnostic{
+				diag.Warningf(2, 2, "assignment to 'y' inside 'f' shadows the global variable assigned on line 5"),
+			},
+		},
+		{
+			name:  "assignment to a declared global",
+			input: "def f(a):\n\tglobal y\n\ty = a\n\treturn y\n\ny = 4\n",
+		},
+		{
+			name:  "misplaced global declarations",
+			input: "def f(a):\n\tb = a\n\tglobal a, b\n\treturn b\n\nglobal c\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(3, 2, "'a' is a parameter of 'f' and cannot be declared global"),
+				diag.Errorf(3, 2, "'b' is used on line 2, before it is declared global"),
+				diag.Warningf(6, 1, "'global' outside a function has no effect"),
+			},
+		},
+		{
+			name:  "global assignment shadows function",
+			input: "f = 2\ndef f(a):\n\treturn a\n",
+			expected: []diag.Diagnostic{
+				diag.Warningf(1, 1, "assignment to 'f' shadows the function defined on line 2"),
+			},
+		},
+		{
+			name:  "annotated globals",
+			input: "a: int8 = -128\nb: uint16 = 65535\nc: char = 65\na: int8 = a + 1\n",
+		},
+		{
+			name:  "bad annotations",
+			input: "a: uint8 = 256\nb: float = 1\nc: int16 = \"s\"\nd: int8 = 1\nd: int16 = 2\ndef f(p):\n\tp: int8 = 1\n\treturn p\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(1, 1, "256 does not fit in uint8 'a' (0 to 255)"),
+				diag.Errorf(2, 1, "unknown type 'float' for 'b'; expected one of char, int, int16, int8, uint16, uint8"),
+				diag.Errorf(3, 1, "'c' is annotated as int16 but assigned a string"),
+				diag.Errorf(5, 1, "'d' is annotated as int16 here but as int8 on line 4"),
+				diag.Errorf(7, 2, "parameter 'p' cannot be annotated"),
+			},
+		},
+		{
+			name:  "string literals ordered against each other",
+			input: "if \"a\" < \"b\":\n\tprint(1)\n",
+		},
+		{
+			name:  "string literal ordered against a variable",
+			input: "s = \"b\"\nwhile s > \"a\":\n\ts = \"a\"\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(2, 11, "a string can only be compared with '>' against another string literal"),
+			},
+		},
+		{
+			name:  "assigning the result of a void function",
+			input: "def show(x):\n\tprint(x)\n\treturn\n\ndef first(x):\n\tif x > 0:\n\t\treturn x\n\treturn None\n\ny = show(1)\nz = first(1)\n",
+			expected: []diag.Diagnostic{
+				diag.Warningf(10, 1, "'show' does not return a value, so 'y' is set to None"),
+			},
+		},
+		{
+			name:  "string and None in a comparison chain",
+			input: "x = 1\nok = 0 < \"a\" < x\nno = 0 == None < 2\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(2, 10, "a string can only be compared with '<' against another string literal"),
+				diag.Errorf(3, 11, "None cannot be used with '<'"),
+			},
+		},
+		{
+			name:  "f-string outside print",
+			input: "x = 1\nprint(f\"{x}\")\ny = f\"{x}\"\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(3, 5, "an f-string can only be printed"),
+			},
+		},
+		{
+			name:  "__name__ outside a main guard",
+			input: "print(__name__)\n__name__ = \"m\"\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(1, 7, "'__name__' can only be compared with \"__main__\" in an if statement"),
+				diag.Errorf(2, 1, "'__name__' is always \"__main__\" and cannot be assigned to"),
+			},
+		},
+		{
+			name:  "None in arithmetic",
+			input: "def show(v):\n\tprint(v)\n\nx = None\ny = x == None\nz = None + 1\nw = 2 * show(1)\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(6, 5, "None cannot be used with '+'"),
+				diag.Errorf(7, 9, "'show' does not return a value, so its result cannot be used with '*'"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parse errors: %v", p.Errors())
+			}
+
+			got := Check(program)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("wrong number of diagnostics. expected=%v, got=%v", tt.expected, got)
+			}
+			for i := range got {
+				if !reflect.DeepEqual(got[i], tt.expected[i]) {
+					t.Errorf("diagnostic %d wrong.\nexpected=%v\ngot=     %v", i, tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDiscardedCalls(t *testing.T) {
+	input := "def f(a):\n\tprint(a)\n\ndef g(a):\n\tf(a)\n\treturn a\n\nf(1)\nx = g(2)\nwhile x > 0:\n\tg(x)\n\tx = x - 1\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	Check(program)
+
+	var discarded, kept []string
+	var walk func([]ast.Statement)
+	visit := func(e ast.Expression) {
+		if call, ok := e.(*ast.FunctionCall); ok {
+			desc := fmt.Sprintf("%s@%d", call.Function, call.Token.Line)
+			if call.Discarded {
+				discarded = append(discarded, desc)
+			} else {
+				kept = append(kept, desc)
+			}
+		}
+	}
+	walk = func(stmts []ast.Statement) {
+		for _, stmt := range stmts {
+			switch s := stmt.(type) {
+			case *ast.ExpressionStatement:
+				visit(s.Expression)
+			case *ast.AssignmentStatement:
+				visit(s.Value)
+			case *ast.FunctionDefinition:
+				walk(s.Body)
+			case *ast.WhileStatement:
+				walk(s.Body)
+			}
+		}
+	}
+	walk(program.Statements)
+
+	if !reflect.DeepEqual(discarded, []string{"f@5", "f@8", "g@11"}) {
+		t.Errorf("wrong discarded calls: %v", discarded)
+	}
+	if !reflect.DeepEqual(kept, []string{"g@9"}) {
+		t.Errorf("wrong kept calls: %v", kept)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []diag.Diagnostic
+	}{
+		{
+			name:  "clean program",
+			input: "def add(a, b):\n\tc = a + b\n\treturn c\n\nx = add(1, 2)\nprint(x)\n",
+		},
+		{
+			name:  "read but never assigned",
+			input: "x = y + 1\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(1, 5, "'y' is read but never assigned"),
+			},
+		},
+		{
+			name:  "local assigned later in the function",
+			input: "def f(a):\n\twhile a > 0:\n\t\tb = a\n\t\ta = a - 1\n\treturn b\n",
+		},
+		{
+			name:  "global assigned only in a function",
+			input: "def f(a):\n\tglobal n\n\tn = a\n\nf(1)\nprint(n)\n",
+		},
+		{
+			name:  "undefined function",
+			input: "x = g(1)\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(1, 5, "function 'g' is not defined"),
+			},
+		},
+		{
+			name:  "function defined after the call",
+			input: "def f(a):\n\treturn g(a)\n\ndef g(a):\n\treturn a\n",
+		},
+		{
+			name:  "string arithmetic",
+			input: "s = \"a\"\nx = s + 1\ny = s * 2\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(2, 5, "a string can only be added to another string"),
+				diag.Errorf(3, 5, "a string cannot be used with '*'; arithmetic needs integers"),
+			},
+		},
+		{
+			name:  "string concatenation",
+			input: "s = \"a\"\nt = s + \"b\"\nu = t + s + \"c\"\n",
+		},
+		{
+			name:  "indexing",
+			input: "d = {\"a\": 1}\nn = 2\nx = d[\"a\"] + n[\"a\"]\ndef f(n):\n\treturn n[1]\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(3, 14, "'n' is not a dictionary or a list"),
+				diag.Errorf(4, 0, "parameter 'n' of 'f' shadows the global variable assigned on line 2"),
+			},
+		},
+		{
+			name:  "lists",
+			input: "xs = [\"b\", \"a\"]\nxs.sort()\nys = sorted(xs)\ns = xs[0] + \"!\"\nn = len(ys) + ys[0]\n",
+		},
+		{
+			name:  "parameter hides string global",
+			input: "s = \"a\"\ndef f(s):\n\treturn s + 1\n",
+			expected: []diag.Diagnostic{
+				diag.Errorf(2, 0, "parameter 's' of 'f' shadows the global variable assigned on line 1"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parse errors: %v", p.Errors())
+			}
+
+			got := CheckWith(program, Options{Strict: true})
+			if len(got) != len(tt.expected) {
+				t.Fatalf("wrong number of diagnostics. expected=%v, got=%v", tt.expected, got)
+			}
+			for i := range got {
+				if !reflect.DeepEqual(got[i], tt.expected[i]) {
+					t.Errorf("diagnostic %d wrong.\nexpected=%v\ngot=     %v", i, tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGate(t *testing.T) {
+	input := "x = 1\nwhile x < 3:\n\tx += 1\nfor i in range(2):\n\tprint(i)\ndef f(a):\n\treturn a\ny = f(x)\ndef g():\n\tglobal x\n"
+	tests := []struct {
+		level    Level
+		expected []diag.Diagnostic
+	}{
+		{level: AnyLevel},
+		{level: Level3},
+		{
+			level: Level2,
+			expected: []diag.Diagnostic{
+				diag.Errorf(6, 1, "function definitions are not allowed at level2; they start at level3"),
+				diag.Errorf(7, 2, "return statements are not allowed at level2; they start at level3"),
+				diag.Errorf(8, 5, "function calls are not allowed at level2; they start at level3"),
+				diag.Errorf(9, 1, "function definitions are not allowed at level2; they start at level3"),
+				diag.Errorf(10, 2, "global statements are not allowed at level2; they start at level3"),
+			},
+		},
+		{
+			level: Level1,
+			expected: []diag.Diagnostic{
+				diag.Errorf(2, 1, "while loops are not allowed at level1; they start at level2"),
+				diag.Errorf(4, 1, "for loops are not allowed at level1; they start at level2"),
+				diag.Errorf(6, 1, "function definitions are not allowed at level1; they start at level3"),
+				diag.Errorf(7, 2, "return statements are not allowed at level1; they start at level3"),
+				diag.Errorf(8, 5, "function calls are not allowed at level1; they start at level3"),
+				diag.Errorf(9, 1, "function definitions are not allowed at level1; they start at level3"),
+				diag.Errorf(10, 2, "global statements are not allowed at level1; they start at level3"),
+			},
+		},
+	}
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			got := Gate(program, tt.level)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("wrong diagnostics.\nexpected=%v\ngot=     %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		entry    string
+		expected []diag.Diagnostic
+	}{
+		{name: "defined", input: "def main():\n\tprint(1)\nx = 1\n", entry: "main"},
+		{
+			name:     "undefined",
+			input:    "x = 1\n",
+			entry:    "main",
+			expected: []diag.Diagnostic{diag.Errorf(0, 0, "entry point 'main' is not defined")},
+		},
+		{
+			name:     "with parameters",
+			input:    "x = 1\ndef main(a):\n\tprint(a)\n",
+			entry:    "main",
+			expected: []diag.Diagnostic{diag.Errorf(2, 1, "entry point 'main' cannot take parameters")},
+		},
+		{
+			name:     "called from the top level",
+			input:    "def run():\n\tprint(1)\nrun()\n",
+			entry:    "run",
+			expected: []diag.Diagnostic{diag.Warningf(3, 1, "'run' is the entry point and runs after the top-level code; calling it here runs it twice")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parse errors: %v", p.Errors())
+			}
+			got := Entry(program, tt.entry)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("wrong diagnostics.\nexpected=%v\ngot=     %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRanges(t *testing.T) {
+	input := "for i in range(1, 5, 0):\n\tprint(i)\ndef f(n):\n\tfor j in range(n, 0, -1):\n\t\tfor k in range(0, j, -0):\n\t\t\tprint(k)\nfor m in range(0, 4, 2 - 2):\n\tprint(m)\n"
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+	expected := []diag.Diagnostic{
+		diag.Errorf(1, 22, "range() step cannot be zero"),
+		diag.Errorf(5, 24, "range() step cannot be zero"),
+	}
+	if got := Ranges(program); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong diagnostics.\nexpected=%v\ngot=     %v", expected, got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, l := range []Level{Level1, Level2, Level3} {
+		got, err := ParseLevel(l.String())
+		if err != nil || got != l {
+			t.Errorf("ParseLevel(%q) = %v, %v", l.String(), got, err)
+		}
+	}
+	if _, err := ParseLevel("level4"); err == nil {
+		t.Error("expected an error for level4")
+	}
+}
@@ -0,0 +1,47 @@
+package check
+
+import "github.com/arifali123/152compiler/packages/ast"
+
+// checkEffects warns about an expression statement that computes a value
+// and does nothing with it, such as x + 1 or x == 1 on a line of its own,
+// which is almost always meant to be an assignment
+func (c *checker) checkEffects(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.ExpressionStatement:
+			if !pure(s.Expression) {
+				continue
+			}
+			at := ast.StartToken(s.Expression)
+			if b, ok := s.Expression.(*ast.BinaryExpression); ok && b.Operator == "==" {
+				if _, ok := b.Left.(*ast.Identifier); ok {
+					c.warningf(at.Line, at.Column, "the result of '==' is never used; did you mean '=' to assign to '%s'?", b.Left)
+					continue
+				}
+			}
+			c.warningf(at.Line, at.Column, "the value of this expression is never used; did you mean to assign it?")
+		case *ast.FunctionDefinition:
+			c.checkEffects(s.Body)
+		case *ast.IfStatement:
+			c.checkEffects(s.Consequence)
+			c.checkEffects(s.Alternative)
+		case *ast.WhileStatement:
+			c.checkEffects(s.Body)
+		}
+	}
+}
+
+// pure reports whether evaluating e can do nothing but produce its value,
+// which holds when it calls no function. An f-string, which is already
+// rejected outside print, counts as impure so it is not reported twice.
+func pure(e ast.Expression) bool {
+	effects := false
+	ast.Rewrite(&ast.ExpressionStatement{Expression: e}, func(n ast.Node) ast.Node {
+		switch n.(type) {
+		case *ast.FunctionCall, *ast.InterpolatedString:
+			effects = true
+		}
+		return n
+	})
+	return !effects
+}
@@ -0,0 +1,36 @@
+package check
+
+import (
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/diag"
+)
+
+// Entry reports problems with running the function name after the
+// top-level statements: it must be defined and take no parameters, and the
+// top-level code calling it as well would run it twice
+func Entry(program *ast.Program, name string) []diag.Diagnostic {
+	var fn *ast.FunctionDefinition
+	for _, stmt := range program.Statements {
+		if def, ok := stmt.(*ast.FunctionDefinition); ok && def.Name == name {
+			fn = def
+		}
+	}
+	if fn == nil {
+		return []diag.Diagnostic{diag.Errorf(0, 0, "entry point '%s' is not defined", name)}
+	}
+	if len(fn.Parameters) > 0 {
+		return []diag.Diagnostic{diag.Errorf(fn.Token.Line, fn.Token.Column, "entry point '%s' cannot take parameters", name)}
+	}
+
+	var diags []diag.Diagnostic
+	for _, stmt := range program.Statements {
+		es, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			continue
+		}
+		if call, ok := es.Expression.(*ast.FunctionCall); ok && call.Function == name {
+			diags = append(diags, diag.Warningf(call.Token.Line, call.Token.Column, "'%s' is the entry point and runs after the top-level code; calling it here runs it twice", name))
+		}
+	}
+	return diags
+}
@@ -0,0 +1,88 @@
+package check
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// Level is a course milestone that limits which constructs a program may
+// use. Each level allows everything the levels below it do.
+type Level int
+
+const (
+	// AnyLevel allows the whole language
+	AnyLevel Level = iota
+	// Level1 allows assignments, expressions and print
+	Level1
+	// Level2 adds if, elif, else, while and for
+	Level2
+	// Level3 adds def, return, global and function calls
+	Level3
+)
+
+func (l Level) String() string {
+	switch l {
+	case Level1:
+		return "level1"
+	case Level2:
+		return "level2"
+	case Level3:
+		return "level3"
+	}
+	return "any"
+}
+
+// ParseLevel reads "level1", "level2" or "level3"
+func ParseLevel(name string) (Level, error) {
+	for l := Level1; l <= Level3; l++ {
+		if name == l.String() {
+			return l, nil
+		}
+	}
+	return AnyLevel, fmt.Errorf("unknown language level %q (known: level1, level2, level3)", name)
+}
+
+// Gate reports every construct in program above level. It needs the tree
+// as parsed, before the desugar stage turns for loops and elif into
+// constructs of other levels.
+func Gate(program *ast.Program, level Level) []diag.Diagnostic {
+	if level == AnyLevel {
+		return nil
+	}
+	var diags []diag.Diagnostic
+	reject := func(tok token.Token, construct string, needs Level) {
+		if needs > level {
+			diags = append(diags, diag.Errorf(tok.Line, tok.Column, "%s are not allowed at %s; they start at %s", construct, level, needs))
+		}
+	}
+	ast.Rewrite(program, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.IfStatement:
+			reject(n.Token, "if statements", Level2)
+		case *ast.WhileStatement:
+			reject(n.Token, "while loops", Level2)
+		case *ast.ForStatement:
+			reject(n.Token, "for loops", Level2)
+		case *ast.FunctionDefinition:
+			reject(n.Token, "function definitions", Level3)
+		case *ast.ReturnStatement:
+			reject(n.Token, "return statements", Level3)
+		case *ast.GlobalStatement:
+			reject(n.Token, "global statements", Level3)
+		case *ast.FunctionCall:
+			reject(n.Token, "function calls", Level3)
+		}
+		return n
+	})
+	sort.SliceStable(diags, func(i, j int) bool {
+		if diags[i].Line != diags[j].Line {
+			return diags[i].Line < diags[j].Line
+		}
+		return diags[i].Column < diags[j].Column
+	})
+	return diags
+}
@@ -0,0 +1,24 @@
+package check
+
+import (
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/diag"
+)
+
+// Ranges reports for loops whose range() step is a literal zero, which
+// Python rejects when the loop starts. It runs before package desugar
+// lowers the loops away.
+func Ranges(program *ast.Program) []diag.Diagnostic {
+	var diags []diag.Diagnostic
+	ast.Rewrite(program, func(n ast.Node) ast.Node {
+		loop, ok := n.(*ast.ForStatement)
+		if !ok {
+			return n
+		}
+		if step, ok := loop.Step.(*ast.IntegerLiteral); ok && step.Value == 0 {
+			diags = append(diags, diag.Errorf(step.Token.Line, step.Token.Column, "range() step cannot be zero"))
+		}
+		return n
+	})
+	return diags
+}
@@ -0,0 +1,228 @@
+package check
+
+import (
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// Options selects how pedantic Check is
+type Options struct {
+	// Strict turns warnings into errors and rejects what the default mode lets
+	// through for beginners: reading a variable that is never assigned, which
+	// otherwise reads as 0, calling a function that is not defined,
+	// arithmetic on strings other than adding two of them, which otherwise
+	// works on their addresses, and indexing a global that is not a
+	// dictionary or a list.
+	Strict bool
+}
+
+// strictScope holds the names a block may read. locals are the parameters
+// and variables of the enclosing function, which hide globals of the same
+// name; it is empty at the top level.
+type strictScope struct {
+	names, locals map[string]bool
+}
+
+// checkStrict reports the errors only strict mode makes
+func (c *checker) checkStrict(program *ast.Program) {
+	globals := make(map[string]bool)
+	for name := range c.globals {
+		globals[name] = true
+	}
+	top := strictScope{names: globals, locals: map[string]bool{}}
+	for _, stmt := range program.Statements {
+		fn, ok := stmt.(*ast.FunctionDefinition)
+		if !ok {
+			c.checkStrictBlock([]ast.Statement{stmt}, top)
+			continue
+		}
+		scope := strictScope{names: make(map[string]bool), locals: make(map[string]bool)}
+		for _, p := range fn.Parameters {
+			scope.locals[p] = true
+		}
+		for _, name := range ast.LocalNames(fn) {
+			scope.locals[name] = true
+		}
+		for name := range globals {
+			scope.names[name] = true
+		}
+		for name := range scope.locals {
+			scope.names[name] = true
+		}
+		c.checkStrictBlock(fn.Body, scope)
+	}
+
+	for i := range c.diags {
+		c.diags[i].Severity = diag.Error
+	}
+}
+
+func (c *checker) checkStrictBlock(stmts []ast.Statement, scope strictScope) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			c.checkStrictExpr(s.Value, scope)
+		case *ast.PrintStatement:
+			c.checkStrictExpr(s.Value, scope)
+		case *ast.ReturnStatement:
+			c.checkStrictExpr(s.Value, scope)
+		case *ast.ExpressionStatement:
+			c.checkStrictExpr(s.Expression, scope)
+		case *ast.IndexAssignment:
+			c.checkStrictExpr(s.Target, scope)
+			c.checkStrictExpr(s.Value, scope)
+		case *ast.IfStatement:
+			c.checkStrictExpr(s.Condition, scope)
+			c.checkStrictBlock(s.Consequence, scope)
+			c.checkStrictBlock(s.Alternative, scope)
+		case *ast.WhileStatement:
+			c.checkStrictExpr(s.Condition, scope)
+			c.checkStrictBlock(s.Body, scope)
+		}
+	}
+}
+
+var arithmetic = map[string]bool{"+": true, "-": true, "*": true, "/": true, "//": true, "%": true, "**": true}
+
+func (c *checker) checkStrictExpr(e ast.Expression, scope strictScope) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if !scope.names[e.Value] && c.functions[e.Value] == nil {
+			c.errorf(e.Token.Line, e.Token.Column, "'%s' is read but never assigned", e.Value)
+		}
+	case *ast.BinaryExpression:
+		c.checkStrictExpr(e.Left, scope)
+		c.checkStrictExpr(e.Right, scope)
+		if e.Operator == "+" {
+			// Two strings concatenate; a string and anything else do not
+			left, lok := c.stringValue(e.Left, scope)
+			right, rok := c.stringValue(e.Right, scope)
+			if lok != rok {
+				tok := left
+				if rok {
+					tok = right
+				}
+				c.errorf(tok.Line, tok.Column, "a string can only be added to another string")
+			}
+		} else if arithmetic[e.Operator] {
+			for _, operand := range []ast.Expression{e.Left, e.Right} {
+				if tok, ok := c.stringValue(operand, scope); ok {
+					c.errorf(tok.Line, tok.Column, "a string cannot be used with '%s'; arithmetic needs integers", e.Operator)
+				}
+			}
+		}
+	case *ast.Comparison:
+		for _, operand := range e.Operands {
+			c.checkStrictExpr(operand, scope)
+		}
+	case *ast.PrefixExpression:
+		c.checkStrictExpr(e.Right, scope)
+	case *ast.FunctionCall:
+		if c.functions[e.Function] == nil && !builtins[e.Function] && !e.Method {
+			c.errorf(e.Token.Line, e.Token.Column, "function '%s' is not defined", e.Function)
+		}
+		for _, arg := range e.Arguments {
+			c.checkStrictExpr(arg, scope)
+		}
+	case *ast.DictLiteral:
+		for i := range e.Keys {
+			c.checkStrictExpr(e.Keys[i], scope)
+			c.checkStrictExpr(e.Values[i], scope)
+		}
+	case *ast.ListLiteral:
+		for _, element := range e.Elements {
+			c.checkStrictExpr(element, scope)
+		}
+	case *ast.IndexExpression:
+		c.checkStrictExpr(e.Left, scope)
+		c.checkStrictExpr(e.Index, scope)
+		if id, ok := e.Left.(*ast.Identifier); ok && !scope.locals[id.Value] {
+			if g := c.globals[id.Value]; g != nil && !indexable(c.literalOf(g.Value)) {
+				c.errorf(id.Token.Line, id.Token.Column, "'%s' is not a dictionary or a list", id.Value)
+			}
+		}
+	case *ast.InterpolatedString:
+		for _, part := range e.Parts {
+			c.checkStrictExpr(part, scope)
+		}
+	}
+}
+
+// indexable reports whether a global first assigned e can be indexed
+func indexable(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.DictLiteral, *ast.ListLiteral:
+		return true
+	case *ast.FunctionCall:
+		return e.Function == "sorted" || e.Function == "reversed" || e.Function == "zeros"
+	}
+	return false
+}
+
+// stringValue reports whether e is a string literal, a concatenation, a
+// global first assigned one or a lookup in a global first assigned strings
+// or rows of them, returning the token to point at
+func (c *checker) stringValue(e ast.Expression, scope strictScope) (token.Token, bool) {
+	switch e := e.(type) {
+	case *ast.StringLiteral:
+		return e.Token, true
+	case *ast.Identifier:
+		if g := c.globals[e.Value]; g != nil && !scope.locals[e.Value] {
+			if holdsString(g.Value) {
+				return e.Token, true
+			}
+		}
+	case *ast.IndexExpression:
+		if id, ok := e.Left.(*ast.Identifier); ok && !scope.locals[id.Value] {
+			if g := c.globals[id.Value]; g != nil && holdsStrings(g.Value) {
+				return id.Token, true
+			}
+		}
+		if row, ok := e.Left.(*ast.IndexExpression); ok {
+			if id, ok := row.Left.(*ast.Identifier); ok && !scope.locals[id.Value] {
+				if g := c.globals[id.Value]; g != nil && holdsStrings(c.literalOf(row)) {
+					return id.Token, true
+				}
+			}
+		}
+	case *ast.BinaryExpression:
+		if e.Operator == "+" {
+			if tok, ok := c.stringValue(e.Left, scope); ok {
+				return tok, true
+			}
+			return c.stringValue(e.Right, scope)
+		}
+	}
+	return token.Token{}, false
+}
+
+// holdsString reports whether a value is a string literal or a
+// concatenation with one
+func holdsString(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.StringLiteral:
+		return true
+	case *ast.BinaryExpression:
+		return e.Operator == "+" && (holdsString(e.Left) || holdsString(e.Right))
+	}
+	return false
+}
+
+// holdsStrings reports whether a value is a dictionary with a string
+// literal value or a list with a string literal element
+func holdsStrings(e ast.Expression) bool {
+	var entries []ast.Expression
+	switch e := e.(type) {
+	case *ast.DictLiteral:
+		entries = e.Values
+	case *ast.ListLiteral:
+		entries = e.Elements
+	}
+	for _, entry := range entries {
+		if _, ok := entry.(*ast.StringLiteral); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package check
+
+import "github.com/arifali123/152compiler/packages/ast"
+
+// checkVoid warns when a variable is assigned the result of a function that
+// never returns a value, which is always None, and rejects None and such
+// calls as operands of arithmetic or ordering
+func (c *checker) checkVoid(program *ast.Program) {
+	void := make(map[string]bool)
+	for name, fn := range c.functions {
+		if !ast.ReturnsValue(fn) {
+			void[name] = true
+		}
+	}
+	none := func(e ast.Expression) (string, int, int, bool) {
+		switch e := e.(type) {
+		case *ast.NoneLiteral:
+			return "None", e.Token.Line, e.Token.Column, true
+		case *ast.FunctionCall:
+			if void[e.Function] {
+				return "'" + e.Function + "' does not return a value, so its result", e.Token.Line, e.Token.Column, true
+			}
+		}
+		return "", 0, 0, false
+	}
+
+	ast.Rewrite(program, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.AssignmentStatement:
+			if call, ok := n.Value.(*ast.FunctionCall); ok && void[call.Function] && !n.Temporary {
+				c.warningf(n.Token.Line, n.Token.Column, "'%s' does not return a value, so '%s' is set to None", call.Function, n.Name)
+			}
+		case *ast.BinaryExpression:
+			// None compares with == and != but has no order and no arithmetic
+			if !arithmetic[n.Operator] && !orderings[n.Operator] {
+				break
+			}
+			for _, operand := range []ast.Expression{n.Left, n.Right} {
+				if what, line, column, ok := none(operand); ok {
+					c.errorf(line, column, "%s cannot be used with '%s'", what, n.Operator)
+				}
+			}
+		case *ast.Comparison:
+			for i, operand := range n.Operands {
+				what, line, column, ok := none(operand)
+				if !ok {
+					continue
+				}
+				// An operand between two comparisons is named once, with
+				// the first of them that orders
+				if i > 0 && orderings[n.Operators[i-1]] {
+					c.errorf(line, column, "%s cannot be used with '%s'", what, n.Operators[i-1])
+				} else if i < len(n.Operators) && orderings[n.Operators[i]] {
+					c.errorf(line, column, "%s cannot be used with '%s'", what, n.Operators[i])
+				}
+			}
+		}
+		return n
+	})
+}
@@ -0,0 +1,224 @@
+// Package cli is a small subcommand framework: every command gets its own
+// flag set, consistent help text and uniform error and exit-code handling.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Command describes one subcommand
+type Command struct {
+	Name  string
+	Usage string // argument synopsis shown after the command name
+	Short string // one-line description for the command list
+	Long  string // optional extra help text
+
+	// Flags registers command-specific flags
+	Flags func(fs *flag.FlagSet)
+	Run   func(ctx *Context) error
+}
+
+// Context is passed to a running command
+type Context struct {
+	Args   []string // positional arguments after flag parsing
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// App is a collection of commands sharing global flags
+type App struct {
+	Name     string
+	Short    string
+	Commands []*Command
+
+	// Global registers flags accepted by every command
+	Global func(fs *flag.FlagSet)
+}
+
+// UsageError makes the framework print the command's help after the message
+type UsageError struct {
+	Msg string
+}
+
+func (e *UsageError) Error() string { return e.Msg }
+
+// Usagef builds a UsageError
+func Usagef(format string, args ...interface{}) error {
+	return &UsageError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// ExitError ends the program with Code without printing anything further;
+// the command is expected to have reported the problem already.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("exit status %d", e.Code) }
+
+// Lookup finds a command by name
+func (a *App) Lookup(name string) *Command {
+	for _, c := range a.Commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Run dispatches args (without the program name) and returns the exit code
+func (a *App) Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	top := flag.NewFlagSet(a.Name, flag.ContinueOnError)
+	top.SetOutput(io.Discard)
+	if a.Global != nil {
+		a.Global(top)
+	}
+	if err := top.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			a.printHelp(stdout)
+			return 0
+		}
+		fmt.Fprintf(stderr, "%s: %v\n", a.Name, err)
+		a.printHelp(stderr)
+		return 2
+	}
+	args = top.Args()
+
+	if len(args) == 0 {
+		a.printHelp(stderr)
+		return 2
+	}
+
+	name := args[0]
+	if name == "help" {
+		if len(args) > 1 {
+			if cmd := a.Lookup(args[1]); cmd != nil {
+				a.printCommandHelp(stdout, cmd, a.flagSet(top, cmd))
+				return 0
+			}
+			fmt.Fprintf(stderr, "%s: unknown command %q\n", a.Name, args[1])
+			return 2
+		}
+		a.printHelp(stdout)
+		return 0
+	}
+
+	cmd := a.Lookup(name)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "%s: unknown command %q\n", a.Name, name)
+		a.printHelp(stderr)
+		return 2
+	}
+
+	fs := a.flagSet(top, cmd)
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			a.printCommandHelp(stdout, cmd, fs)
+			return 0
+		}
+		fmt.Fprintf(stderr, "%s %s: %v\n", a.Name, cmd.Name, err)
+		a.printCommandHelp(stderr, cmd, fs)
+		return 2
+	}
+
+	ctx := &Context{Args: positional, Stdin: stdin, Stdout: stdout, Stderr: stderr}
+	if err := cmd.Run(ctx); err != nil {
+		var usage *UsageError
+		var exit *ExitError
+		switch {
+		case errors.As(err, &exit):
+			return exit.Code
+		case errors.As(err, &usage):
+			fmt.Fprintf(stderr, "%s %s: %s\n", a.Name, cmd.Name, usage.Msg)
+			a.printCommandHelp(stderr, cmd, fs)
+			return 2
+		default:
+			fmt.Fprintf(stderr, "%s %s: %v\n", a.Name, cmd.Name, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// flagSet builds the command's flags. Global flags share their flag.Value
+// with the top-level set so values given before the command name survive.
+func (a *App) flagSet(top *flag.FlagSet, cmd *Command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	top.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	if cmd.Flags != nil {
+		cmd.Flags(fs)
+	}
+	return fs
+}
+
+// parseInterspersed allows flags after positional arguments, so that
+// `build prog.py -o prog.s` works like `build -o prog.s prog.py`.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (a *App) printHelp(w io.Writer) {
+	if a.Short != "" {
+		fmt.Fprintf(w, "%s - %s\n\n", a.Name, a.Short)
+	}
+	fmt.Fprintf(w, "Usage:\n  %s <command> [flags] [arguments]\n\nCommands:\n", a.Name)
+
+	cmds := append([]*Command(nil), a.Commands...)
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+	width := 0
+	for _, c := range cmds {
+		if len(c.Name) > width {
+			width = len(c.Name)
+		}
+	}
+	for _, c := range cmds {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, c.Name, c.Short)
+	}
+	fmt.Fprintf(w, "\nRun '%s help <command>' for details on a command.\n", a.Name)
+}
+
+func (a *App) printCommandHelp(w io.Writer, cmd *Command, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s %s %s\n\n%s\n", a.Name, cmd.Name, cmd.Usage, cmd.Short)
+	if cmd.Long != "" {
+		fmt.Fprintf(w, "\n%s\n", strings.TrimSpace(cmd.Long))
+	}
+
+	var flags strings.Builder
+	fs.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		line := "  -" + f.Name
+		if name != "" {
+			line += " " + name
+		}
+		if f.DefValue != "" && f.DefValue != "false" {
+			usage += fmt.Sprintf(" (default %q)", f.DefValue)
+		}
+		fmt.Fprintf(&flags, "%s\n    \t%s\n", line, usage)
+	})
+	if flags.Len() > 0 {
+		fmt.Fprintf(w, "\nFlags:\n%s", flags.String())
+	}
+}
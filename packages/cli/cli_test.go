@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func newTestApp(got *[]string, out *string, verbose *bool) *App {
+	return &App{
+		Name: "pyc",
+		Global: func(fs *flag.FlagSet) {
+			fs.BoolVar(verbose, "v", false, "verbose output")
+		},
+		Commands: []*Command{
+			{
+				Name:  "build",
+				Usage: "[flags] <file.py>",
+				Short: "compile a file",
+				Flags: func(fs *flag.FlagSet) {
+					fs.StringVar(out, "o", "", "output file")
+				},
+				Run: func(ctx *Context) error {
+					*got = ctx.Args
+					if len(ctx.Args) != 1 {
+						return Usagef("expected one file")
+					}
+					return nil
+				},
+			},
+			{
+				Name:  "fail",
+				Short: "always fails",
+				Run: func(ctx *Context) error {
+					if len(ctx.Args) > 0 {
+						return &ExitError{Code: 3}
+					}
+					return errors.New("boom")
+				},
+			},
+		},
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantArgs []string
+		wantOut  string
+		wantV    bool
+		stderr   string
+	}{
+		{"Flags Before File", []string{"build", "-o", "a.s", "x.py"}, 0, []string{"x.py"}, "a.s", false, ""},
+		{"Flags After File", []string{"build", "x.py", "-o", "b.s"}, 0, []string{"x.py"}, "b.s", false, ""},
+		{"Global Flag", []string{"-v", "build", "x.py"}, 0, []string{"x.py"}, "", true, ""},
+		{"Global Flag On Command", []string{"build", "-v", "x.py"}, 0, []string{"x.py"}, "", true, ""},
+		{"Usage Error", []string{"build"}, 2, []string{}, "", false, "expected one file"},
+		{"Unknown Command", []string{"frob"}, 2, nil, "", false, `unknown command "frob"`},
+		{"Unknown Flag", []string{"build", "-z"}, 2, nil, "", false, "flag provided but not defined"},
+		{"Command Error", []string{"fail"}, 1, nil, "", false, "pyc fail: boom"},
+		{"Exit Error", []string{"fail", "x"}, 3, nil, "", false, ""},
+		{"No Command", []string{}, 2, nil, "", false, "Usage:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			var out string
+			var verbose bool
+			var stdout, stderr strings.Builder
+
+			app := newTestApp(&got, &out, &verbose)
+			code := app.Run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+			if code != tt.wantCode {
+				t.Errorf("exit code wrong. expected=%d, got=%d (stderr=%q)", tt.wantCode, code, stderr.String())
+			}
+			if tt.wantArgs != nil && strings.Join(got, " ") != strings.Join(tt.wantArgs, " ") {
+				t.Errorf("args wrong. expected=%v, got=%v", tt.wantArgs, got)
+			}
+			if out != tt.wantOut {
+				t.Errorf("-o wrong. expected=%q, got=%q", tt.wantOut, out)
+			}
+			if verbose != tt.wantV {
+				t.Errorf("-v wrong. expected=%v, got=%v", tt.wantV, verbose)
+			}
+			if tt.stderr != "" && !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr missing %q, got %q", tt.stderr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestHelp(t *testing.T) {
+	var got []string
+	var out string
+	var verbose bool
+	app := newTestApp(&got, &out, &verbose)
+
+	var stdout strings.Builder
+	if code := app.Run([]string{"help", "build"}, nil, &stdout, &stdout); code != 0 {
+		t.Fatalf("help exit code wrong. expected=0, got=%d", code)
+	}
+	for _, want := range []string{"Usage: pyc build [flags] <file.py>", "-o string", "-v"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("help output missing %q:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	if code := app.Run([]string{"-h"}, nil, &stdout, &stdout); code != 0 {
+		t.Fatalf("-h exit code wrong. expected=0, got=%d", code)
+	}
+	if !strings.Contains(stdout.String(), "build  compile a file") {
+		t.Errorf("command list missing build:\n%s", stdout.String())
+	}
+}
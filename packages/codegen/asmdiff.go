@@ -0,0 +1,170 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	asmWord       = regexp.MustCompile(`\$?[A-Za-z_][A-Za-z0-9_]*`)
+	numberedLabel = regexp.MustCompile(`^(.*?_?)(\d+)$`)
+	tempRegister  = regexp.MustCompile(`^\$(t\d|f([4-9]|1[01]))$`)
+)
+
+// Normalize rewrites asm so that two programs differing only in incidental
+// choices compare equal line for line. Comments and blank lines are dropped
+// and spacing is made uniform. Generated labels are renumbered in order of
+// first appearance, and within each function temporary registers are
+// renamed in the order they are first used, so inserting a statement does
+// not renumber everything after it.
+func Normalize(asm string) []string {
+	labels := make(map[string]string)
+	next := make(map[string]int)
+	var regs map[string]string
+	var lines []string
+
+	rename := func(text string) string {
+		return asmWord.ReplaceAllStringFunc(text, func(w string) string {
+			if tempRegister.MatchString(w) {
+				if r, ok := regs[w]; ok {
+					return r
+				}
+				class := w[:2]
+				first := 0
+				if class == "$f" {
+					first = 4
+				}
+				n := 0
+				for _, r := range regs {
+					if r[:2] == class {
+						n++
+					}
+				}
+				regs[w] = class + strconv.Itoa(first+n)
+				return regs[w]
+			}
+			if !generatedLabel.MatchString(w) {
+				return w
+			}
+			if l, ok := labels[w]; ok {
+				return l
+			}
+			prefix := numberedLabel.FindStringSubmatch(w)[1]
+			next[prefix]++
+			labels[w] = prefix + strconv.Itoa(next[prefix])
+			return labels[w]
+		})
+	}
+
+	for _, line := range strings.Split(asm, "\n") {
+		fields := strings.Fields(stripAsmComment(line))
+		if len(fields) == 0 {
+			continue
+		}
+		line = strings.Join(fields, " ")
+		if label, ok := strings.CutSuffix(fields[0], ":"); ok {
+			if !generatedLabel.MatchString(label) {
+				regs = make(map[string]string)
+			}
+		} else {
+			line = "    " + line
+		}
+		// only the part before a string operand names labels and registers
+		code, quoted, hasString := strings.Cut(line, "\"")
+		line = rename(code)
+		if hasString {
+			line += "\"" + quoted
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Diff compares two normalized listings and returns their differences as
+// unified diff hunks, each change shown with up to context unchanged lines
+// around it. It returns "" when the listings are the same.
+func Diff(before, after []string, context int) string {
+	// common[i][j] is the length of the longest common subsequence of
+	// before[i:] and after[j:]
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			switch {
+			case before[i] == after[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	type edit struct {
+		op   byte
+		a, b int // lines of before and after consumed before this one
+		text string
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			edits = append(edits, edit{' ', i, j, before[i]})
+			i, j = i+1, j+1
+		case j == len(after) || i < len(before) && common[i+1][j] >= common[i][j+1]:
+			edits = append(edits, edit{'-', i, j, before[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', i, j, after[j]})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+		// extend the hunk while the next change is close enough that the
+		// context around the two would overlap
+		end := start
+		for k := start; k < len(edits) && k-end-1 <= 2*context; k++ {
+			if edits[k].op != ' ' {
+				end = k
+			}
+		}
+		from := max(start-context, 0)
+		to := min(end+context+1, len(edits))
+		var body strings.Builder
+		removed, added := 0, 0
+		for _, e := range edits[from:to] {
+			body.WriteString(fmt.Sprintf("%c%s\n", e.op, e.text))
+			if e.op != '+' {
+				removed++
+			}
+			if e.op != '-' {
+				added++
+			}
+		}
+		out.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(edits[from].a, removed), hunkRange(edits[from].b, added)))
+		out.WriteString(body.String())
+		start = to
+	}
+	return out.String()
+}
+
+// hunkRange formats the line range of one side of a hunk as unified diffs
+// do: an empty range is given by the line before it
+func hunkRange(first, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", first)
+	}
+	return fmt.Sprintf("%d,%d", first+1, count)
+}
@@ -4,150 +4,477 @@ package codegen
 import (
 	"fmt"
 	"log"
-	"strconv"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/bind"
+	"github.com/arifali123/152compiler/packages/gensym"
 	"github.com/arifali123/152compiler/packages/symbol"
-	"github.com/arifali123/152compiler/packages/token"
 )
 
+// Options controls the target and optional parts of the generated assembly
+type Options struct {
+	// FrameTrailer appends a comment block describing each function's stack
+	// frame, parameter offsets and the registers it uses.
+	FrameTrailer bool
+
+	// Target selects the instruction dialect; the zero value is MARS
+	Target TargetDescription
+
+	// Checked keeps a sentinel below each function's frame and aborts with
+	// a message if it changed by the time the function returns. Word-sized
+	// globals also start out holding the sentinel, and reading one that
+	// still does aborts as a use before assignment. Dividing by zero aborts
+	// too, as does calling deeper than MaxDepth.
+	Checked bool
+
+	// MaxDepth caps the function calls under way at once in a checked
+	// program; zero means DefaultMaxDepth
+	MaxDepth int
+
+	// MaxIterations, if positive, counts the iterations of every loop in the
+	// program together and aborts once there have been more, so a program
+	// that would never finish stops on any simulator
+	MaxIterations int
+
+	// Template, if set, is written around the generated sections
+	Template *Template
+
+	// Macros, if set, is a prelude written at the top of the output whose
+	// macros are called in place of system calls
+	Macros *Macros
+
+	// Entry, if set, names a function without parameters that the program
+	// calls after running its top-level statements, which then become a
+	// routine of their own
+	Entry string
+
+	// Names, if set, numbers the labels the generated code needs, going on
+	// from the last number it handed out. Otherwise each call to Generate,
+	// and each run of GenerateStatement calls with the same env, numbers
+	// them from 1.
+	Names *gensym.Generator
+}
+
 type CodeGenerator struct {
 	symbolTable      *symbol.SymbolTable
-	output           strings.Builder
-	labelCount       int
+	output           sink
+	names            *gensym.Generator // numbers labels; see Options.Names
 	nextReg          int
 	usedRegs         map[int]bool
+	usedFloats       map[int]bool
 	stringMap        map[string]string
+	stringOrder      []string        // the keys of stringMap in the order they were added
+	usedData         map[string]bool // the data labels the generated code refers to
+	floatMap         map[string]string
+	floatOrder       []string
+	usesConcat       bool // the program needs the concatenation routine
+	usesStrEqual     bool // ... the string comparison routine
+	usesIntToStr     bool // ... the routine writing an integer out, for format
+	usesPad          bool // ... the routine padding a string to a width
+	usesDict         bool // ... the dictionary lookup routine
+	usesListCopy     bool // ... the routine copying a list, for sorted and reversed
+	usesSort         bool // ... the list sorting routine
+	usesReverse      bool // ... the list reversing routine
+	usesPrintList    bool // ... the routine printing a list
+	usesSum          bool // ... the routine adding up a list
+	usesMin          bool // ... the routine finding the least element of a list
+	usesMax          bool // ... the routine finding the greatest element of a list
+	usesZeros        bool // ... the routine making a list of lists of zeros
+	usesAlloc        bool // ... the allocation routine
+	countsIterations bool // ... the loop iteration counter
+	registerTemps    map[*symbol.Symbol]bool
+	held             map[*symbol.Symbol]int    // register temporaries assigned but not yet read
+	pinned           map[*symbol.Symbol]string // variables kept in a loop register, see loopPins
+	voidFuncs        map[string]bool           // functions that never return a value
+	cold             []coldBlock
 	currentFunction  string
 	currentParams    []string
-	varRegs          map[string]int
+	funcExit         string // label of the current function's epilogue
 	controlFlowStack []*ControlFlowContext
+	functions        []*ast.FunctionDefinition
+	definitions      map[string]*ast.FunctionDefinition // every top-level function by name, whose parameters' types decide how arguments are passed
+	returns          map[string]symbol.SymbolType       // the type of value each function returns
+	frame            *Frame
+	frames           []*Frame
+	funcNames        map[string]bool
+	labelNames       map[string]string
+	syscalls         SyscallTable
+	loops            []LoopLabels
+	functionTexts    []FunctionText
+	marks            []LineMark
+	line             int     // source line of the statement being generated
+	session          session // the statements GenerateStatement has generated
+	Options          Options
 }
 
 func New(symTable *symbol.SymbolTable) *CodeGenerator {
 	return &CodeGenerator{
 		symbolTable:      symTable,
-		labelCount:       0,
+		names:            gensym.New(0),
 		usedRegs:         make(map[int]bool),
+		usedFloats:       make(map[int]bool),
 		stringMap:        make(map[string]string),
 		currentParams:    make([]string, 0),
-		varRegs:          make(map[string]int),
 		controlFlowStack: make([]*ControlFlowContext, 0),
 	}
 }
 
 func (g *CodeGenerator) getNextLabel() string {
-	g.labelCount++
-	return fmt.Sprintf("L%d", g.labelCount)
+	return g.names.Name("L")
 }
 
+// addStringLiteral returns the label of value, which the code about to be
+// written refers to
 func (g *CodeGenerator) addStringLiteral(value string) string {
+	label := g.internString(value)
+	g.usedData[label] = true
+	return label
+}
+
+// internString gives value a label without using it, so labels are numbered
+// in source order however the code generated for them is laid out
+func (g *CodeGenerator) internString(value string) string {
 	if label, exists := g.stringMap[value]; exists {
 		return label
 	}
 
 	label := fmt.Sprintf("str_%d", len(g.stringMap))
 	g.stringMap[value] = label
+	g.stringOrder = append(g.stringOrder, value)
 	return label
 }
 
+// newNames returns the generator labels are numbered with from the start of
+// a compilation
+func (g *CodeGenerator) newNames() *gensym.Generator {
+	if g.Options.Names != nil {
+		return g.Options.Names
+	}
+	return gensym.New(0)
+}
+
+// newline returns the label of the line ending print writes
+func (g *CodeGenerator) newline() string {
+	g.usedData["newline"] = true
+	return "newline"
+}
+
+// Generate returns the assembly for node. Programs are bound first, which
+// sets the Symbol of every variable reference in the tree.
 func (g *CodeGenerator) Generate(node ast.Node) string {
 	if node == nil {
 		log.Println("Warning: nil node passed to Generate")
 		return ""
 	}
+	g.generateText(node, sink{})
+	text := g.output.String()
+	g.output = sink{}
+	g.writeData()
+	data := g.output.String()
+	g.output = sink{}
+
+	pieces, textStart := []string{data, text}, len(data)
+	if t := g.Options.Template; t != nil {
+		pieces, textStart = t.pieces(data, text)
+	}
+	// The source map and function ranges all point into the text
+	for i := range g.marks {
+		g.marks[i].Offset += textStart
+	}
+	for i := range g.functionTexts {
+		g.functionTexts[i].Start += textStart
+		g.functionTexts[i].End += textStart
+	}
+	return strings.Join(pieces, "")
+}
 
-	g.symbolTable = symbol.NewSymbolTable(nil)
-	g.output.Reset()
-	g.stringMap = make(map[string]string)
-	g.varRegs = make(map[string]int)
+// generateText binds node and generates the text section for it into out,
+// leaving what the data section needs recorded on g
+func (g *CodeGenerator) generateText(node ast.Node, out sink) {
+	table := symbol.NewSymbolTable(nil)
+	if prog, ok := node.(*ast.Program); ok {
+		table = bind.Program(prog)
+	}
+	g.reset(table)
+	g.output = out
+	g.names = g.newNames()
 
-	// First pass: collect all variables
+	// First pass: collect function names and string constants
 	g.collectSymbols(node)
 
-	// Generate data section first
-	g.output.WriteString(".data\n")
-	g.output.WriteString("newline: .asciiz \"\\n\"\n")
-
-	// Declare all variables
 	for _, sym := range g.symbolTable.GetSymbols() {
-		if sym.IsGlobal && !sym.IsPrint {
-			g.output.WriteString(fmt.Sprintf("%s: .word 0\n", sym.Name))
+		if sym.IsGlobal && !sym.IsPrint && !g.registerTemps[sym] && g.poisoned(sym) {
+			g.internString(uninitMessage(sym.Name))
 		}
 	}
 
-	// Add string literals
-	for str, label := range g.stringMap {
-		g.output.WriteString(fmt.Sprintf("%s: .asciiz \"%s\"\n", label, str))
-	}
-	g.output.WriteString("\n")
-
-	// Then generate text section
+	// The text section is generated first so the data section only holds
+	// the strings and floats it uses
 	g.output.WriteString(".text\n")
 	g.output.WriteString("main:\n")
 
+	g.frame = newEntryFrame()
+	if g.Options.Entry != "" {
+		// main calls the top-level statements as a routine, then the entry
+		g.output.WriteString(fmt.Sprintf("    jal %s\n", initLabel))
+		g.output.WriteString(fmt.Sprintf("    jal %s\n", g.funcLabel(g.Options.Entry)))
+		g.output.WriteString("\n")
+		g.exit()
+		g.frame = newInitFrame(g.Options.Target.WordBytes())
+		g.output.WriteString(fmt.Sprintf("\n%s:\n", initLabel))
+		g.writePrologue()
+	}
+	g.frames = append(g.frames, g.frame)
 	if prog, ok := node.(*ast.Program); ok {
 		for _, stmt := range prog.Statements {
 			g.generateNode(stmt)
 		}
 	}
 
-	g.output.WriteString("\n    li $v0, 10\n    syscall\n")
+	g.output.WriteString("\n")
+	if g.Options.Entry != "" {
+		g.writeEpilogue()
+	} else {
+		g.exit()
+	}
+	g.writeColdBlocks()
+
+	// Function bodies follow main's exit so control never falls into them
+	for _, fn := range g.functions {
+		g.output.WriteString("\n")
+		start := g.output.Len()
+		g.generateFunction(fn)
+		g.functionTexts = append(g.functionTexts, FunctionText{Name: fn.Name, Start: start, End: g.output.Len()})
+	}
+	if g.usesConcat {
+		g.output.WriteString("\n")
+		g.writeConcat()
+	}
+	if g.usesStrEqual {
+		g.output.WriteString("\n")
+		g.writeStrEqual()
+	}
+	if g.usesIntToStr {
+		g.output.WriteString("\n")
+		g.writeIntToStr()
+	}
+	if g.usesPad {
+		g.output.WriteString("\n")
+		g.writePad()
+	}
+	if g.usesDict {
+		g.output.WriteString("\n")
+		g.writeDictGet()
+	}
+	if g.usesListCopy {
+		g.output.WriteString("\n")
+		g.writeListCopy()
+	}
+	if g.usesSort {
+		g.output.WriteString("\n")
+		g.writeSort()
+	}
+	if g.usesReverse {
+		g.output.WriteString("\n")
+		g.writeReverse()
+	}
+	if g.usesPrintList {
+		g.output.WriteString("\n")
+		g.writePrintList()
+	}
+	if g.usesSum {
+		g.output.WriteString("\n")
+		g.writeSum()
+	}
+	if g.usesMin {
+		g.output.WriteString("\n")
+		g.writeExtreme(minLabel, "min")
+	}
+	if g.usesMax {
+		g.output.WriteString("\n")
+		g.writeExtreme(maxLabel, "max")
+	}
+	if g.usesZeros {
+		g.output.WriteString("\n")
+		g.writeZeros()
+	}
+	if g.usesAlloc {
+		g.output.WriteString("\n")
+		g.writeAlloc()
+	}
+	g.frame = nil
+
+	if g.Options.FrameTrailer {
+		var globals []string
+		for _, sym := range g.symbolTable.GetSymbols() {
+			if sym.IsGlobal && !sym.IsPrint && !g.registerTemps[sym] {
+				if label := g.varLabel(sym.Name); label != sym.Name {
+					globals = append(globals, sym.Name+" (as "+label+")")
+				} else {
+					globals = append(globals, sym.Name)
+				}
+			}
+		}
+		sort.Strings(globals)
+		g.writeFrameTrailer(globals)
+	}
+}
 
-	return g.output.String()
+// reset clears what the last generation left behind and makes table the
+// global scope
+func (g *CodeGenerator) reset(table *symbol.SymbolTable) {
+	g.symbolTable = table
+	g.output.Reset()
+	g.stringMap = make(map[string]string)
+	g.stringOrder = nil
+	g.usedData = make(map[string]bool)
+	g.floatMap = make(map[string]string)
+	g.floatOrder = nil
+	g.usedFloats = make(map[int]bool)
+	g.usesConcat = false
+	g.usesStrEqual = false
+	g.usesIntToStr = false
+	g.usesPad = false
+	g.usesDict = false
+	g.usesListCopy = false
+	g.usesSort = false
+	g.usesReverse = false
+	g.usesPrintList = false
+	g.usesSum = false
+	g.usesMin = false
+	g.usesMax = false
+	g.usesZeros = false
+	g.usesAlloc = false
+	g.countsIterations = false
+	g.held = make(map[*symbol.Symbol]int)
+	g.pinned = make(map[*symbol.Symbol]string)
+	g.cold = nil
+	g.functions = nil
+	g.definitions = make(map[string]*ast.FunctionDefinition)
+	g.returns = make(map[string]symbol.SymbolType)
+	g.frame = nil
+	g.frames = nil
+	g.funcNames = make(map[string]bool)
+	g.labelNames = make(map[string]string)
+	g.syscalls = g.Options.Target.Syscalls.Resolved()
+	g.loops = nil
+	g.functionTexts = nil
+	g.marks = nil
+	g.line = 0
 }
 
-func (g *CodeGenerator) collectSymbols(node ast.Node) {
-	if node == nil {
-		return
+// writeData writes the header and the data section: every global, then the
+// strings and floats the generated code refers to
+func (g *CodeGenerator) writeData() {
+	if e := g.Options.Target.Endian; e != EndianUnstated {
+		g.output.WriteString(fmt.Sprintf("# endian: %s\n", e))
+	}
+	if m := g.Options.Macros; m != nil {
+		g.output.WriteString(m.prelude)
+		if !strings.HasSuffix(m.prelude, "\n") {
+			g.output.WriteString("\n")
+		}
+		g.output.WriteString("\n")
 	}
 
-	switch n := node.(type) {
-	case *ast.Program:
-		for _, stmt := range n.Statements {
-			g.collectSymbols(stmt)
+	g.output.WriteString(".data\n")
+	if g.usedData["newline"] {
+		g.output.WriteString("newline: .asciiz \"\\n\"\n")
+	}
+	if g.countsIterations {
+		g.output.WriteString(fmt.Sprintf("%s: %s 0\n", iterationsLabel, g.op(".word")))
+	}
+	if g.Options.Checked && len(g.funcNames) > 0 {
+		g.output.WriteString(fmt.Sprintf("%s: %s 0\n", depthLabel, g.op(".word")))
+	}
+	for _, sym := range g.symbolTable.GetSymbols() {
+		if sym.IsGlobal && !sym.IsPrint && !g.registerTemps[sym] {
+			if sym.Type == symbol.FloatType {
+				g.output.WriteString(fmt.Sprintf("%s: .float 0.0\n", g.varLabel(sym.Name)))
+				continue
+			}
+			initial := 0
+			if g.poisoned(sym) {
+				initial = canaryValue
+			}
+			g.output.WriteString(fmt.Sprintf("%s: %s %d\n", g.varLabel(sym.Name), g.directive(sym), initial))
 		}
-	case *ast.AssignmentStatement:
-		var symType symbol.SymbolType
-		switch v := n.Value.(type) {
-		case *ast.StringLiteral:
-			symType = symbol.StringType
-			g.addStringLiteral(v.Value)
-		default:
-			symType = symbol.IntegerType
+	}
+	for _, str := range g.stringOrder {
+		if label := g.stringMap[str]; g.usedData[label] {
+			g.output.WriteString(fmt.Sprintf("%s: .asciiz \"%s\"\n", label, ast.Escape(str)))
 		}
-		sym := g.symbolTable.Define(n.Name, symType)
-		sym.IsGlobal = true
-		g.collectSymbols(n.Value)
-	case *ast.IfStatement:
-		g.collectSymbols(n.Condition)
-		for _, stmt := range n.Consequence {
-			g.collectSymbols(stmt)
+	}
+	for _, value := range g.floatOrder {
+		if label := g.floatMap[value]; g.usedData[label] {
+			g.output.WriteString(fmt.Sprintf("%s: .float %s\n", label, value))
 		}
-		if n.Alternative != nil {
-			for _, stmt := range n.Alternative {
-				g.collectSymbols(stmt)
+	}
+	g.output.WriteString("\n")
+}
+
+// collectSymbols records the names of user functions, interns every string
+// and float literal and infers the type of each global; the variables
+// themselves come from the binder. Every node is visited, so literals are
+// numbered in source order; writeData keeps only those the code refers to.
+func (g *CodeGenerator) collectSymbols(node ast.Node) {
+	if prog, ok := node.(*ast.Program); ok {
+		g.findVoidFunctions(prog)
+		g.inferTypes(prog)
+		g.inferVoid(prog)
+		g.findRegisterTemps(prog)
+	}
+	ast.Rewrite(node, func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.FunctionDefinition:
+			g.funcNames[n.Name] = true
+			if g.Options.Checked {
+				g.internString(canaryMessage(n.Name))
+				g.internString(depthMessage)
 			}
-		}
-	case *ast.WhileStatement:
-		g.collectSymbols(n.Condition)
-		for _, stmt := range n.Body {
-			g.collectSymbols(stmt)
-		}
-	case *ast.BinaryExpression:
-		g.collectSymbols(n.Left)
-		g.collectSymbols(n.Right)
-	case *ast.Identifier:
-		if token.LookupIdent(n.Value) == token.IDENT {
-			if _, exists := g.symbolTable.Lookup(n.Value); !exists {
-				sym := g.symbolTable.Define(n.Value, symbol.IntegerType)
-				sym.IsGlobal = true
+			for _, sym := range n.Locals {
+				if !g.registerTemps[sym] && g.poisoned(sym) {
+					g.internString(uninitMessage(sym.Name))
+				}
+			}
+		case *ast.WhileStatement:
+			if g.Options.MaxIterations > 0 {
+				g.countsIterations = true
+				g.internString(iterationsMessage)
+			}
+		case *ast.StringLiteral:
+			g.internString(n.Value)
+		case *ast.FloatLiteral:
+			g.internFloat(n)
+		case *ast.BinaryExpression:
+			if g.Options.Checked && (n.Operator == "/" || n.Operator == "//" || n.Operator == "%") {
+				g.internString(divisionMessage)
+			}
+		case *ast.FunctionCall:
+			if n.Function == "min" || n.Function == "max" {
+				g.internString(emptyMessage(n.Function))
+			}
+		case *ast.IndexExpression:
+			g.internString(keyMessage)
+			if g.Options.Checked {
+				g.internString(indexMessage)
+			}
+		case *ast.PrintStatement:
+			if g.isNone(n.Value) {
+				g.internString(noneText)
+			}
+		case *ast.InterpolatedString:
+			for _, part := range n.Parts {
+				if g.isNone(part) {
+					g.internString(noneText)
+				}
 			}
 		}
-	case *ast.PrintStatement:
-		g.collectSymbols(n.Value)
-	}
+		return n
+	})
 }
 
 func (g *CodeGenerator) generateNode(node ast.Node) string {
@@ -155,7 +482,9 @@ func (g *CodeGenerator) generateNode(node ast.Node) string {
 		return ""
 	}
 
-	log.Printf("[DEBUG] Generating node type: %T", node)
+	if stmt, ok := node.(ast.Statement); ok {
+		defer g.enterStatement(stmt)()
+	}
 
 	switch n := node.(type) {
 	case *ast.Program:
@@ -166,77 +495,66 @@ func (g *CodeGenerator) generateNode(node ast.Node) string {
 		return result
 
 	case *ast.PrintStatement:
-		switch val := n.Value.(type) {
-		case *ast.IntegerLiteral:
-			reg := g.allocateRegister()
-			g.output.WriteString(fmt.Sprintf("    li $t%d, %s\n", reg, val.Value))
-			g.output.WriteString(fmt.Sprintf("    move $a0, $t%d\n", reg))
-			g.output.WriteString("    li $v0, 1\n")
-			g.freeRegister(reg)
-		case *ast.StringLiteral:
-			label := g.addStringLiteral(val.Value)
-			g.output.WriteString(fmt.Sprintf("    la $a0, %s\n", label))
-			g.output.WriteString("    li $v0, 4\n")
-		case *ast.Identifier:
-			if sym, exists := g.symbolTable.Lookup(val.Value); exists {
-				reg := g.loadIdentifier(val.Value)
-				if reg != nil {
-					if sym.Type == symbol.StringType {
-						g.output.WriteString(fmt.Sprintf("    move $a0, $t%d\n", *reg))
-						g.output.WriteString("    li $v0, 4\n")
-					} else {
-						g.output.WriteString(fmt.Sprintf("    move $a0, $t%d\n", *reg))
-						g.output.WriteString("    li $v0, 1\n")
-					}
-					g.freeRegister(*reg)
-				}
+		if s, ok := n.Value.(*ast.InterpolatedString); ok {
+			// Each part is printed on its own, chosen by its type
+			for _, part := range s.Parts {
+				g.printValue(part)
 			}
+		} else {
+			g.printValue(n.Value)
 		}
-		g.output.WriteString("    syscall\n")
-		g.output.WriteString("    la $a0, newline\n")
-		g.output.WriteString("    li $v0, 4\n")
-		g.output.WriteString("    syscall\n")
+		g.printLabel(g.newline())
 		return ""
 
 	case *ast.IntegerLiteral:
-		val, err := strconv.Atoi(n.Value)
-		if err != nil {
-			log.Printf("Error converting integer literal: %v", err)
-			return ""
-		}
-		g.output.WriteString(fmt.Sprintf("    li $t0, %d\n", val))
+		g.loadImmediate("$t0", n.Value)
 		return ""
 
 	case *ast.Identifier:
-		if token.LookupIdent(n.Value) != token.IDENT {
-			return ""
-		}
-		reg := g.loadIdentifier(n.Value)
-		if reg == nil {
-			return ""
+		if reg := g.generateExpression(n); reg >= 0 {
+			g.freeRegister(reg)
 		}
-		g.freeRegister(*reg)
+		return ""
+
+	case *ast.IndexAssignment:
+		g.generateIndexAssignment(n)
 		return ""
 
 	case *ast.AssignmentStatement:
-		if strLit, ok := n.Value.(*ast.StringLiteral); ok {
-			label := g.addStringLiteral(strLit.Value)
-			reg := g.allocateRegister()
-			g.output.WriteString(fmt.Sprintf("    la $t%d, %s\n", reg, label))
-			g.output.WriteString(fmt.Sprintf("    sw $t%d, %s\n", reg, n.Name))
-			g.varRegs[n.Name] = reg
-		} else {
-			reg := g.generateExpression(n.Value)
-			if reg >= 0 {
-				g.output.WriteString(fmt.Sprintf("    sw $t%d, %s\n", reg, n.Name))
-				g.varRegs[n.Name] = reg
+		if n.Symbol == nil {
+			return ""
+		}
+		if n.Symbol.Type == symbol.FloatType {
+			if reg := g.generateFloat(n.Value); reg >= 0 {
+				g.output.WriteString(fmt.Sprintf("    s.s $f%d, %s\n", reg, g.address(n.Symbol)))
+				g.freeFloat(reg)
 			}
+			return ""
+		}
+		if g.registerTemps[n.Symbol] {
+			g.holdTemp(n)
+			return ""
+		}
+		reg := g.generateExpression(n.Value)
+		if reg < 0 {
+			return ""
+		}
+		if pinned, ok := g.pinned[n.Symbol]; ok {
+			g.output.WriteString(fmt.Sprintf("    move %s, $t%d\n", pinned, reg))
+		} else {
+			g.output.WriteString(fmt.Sprintf("    %s $t%d, %s\n", g.storeOp(n.Symbol), reg, g.address(n.Symbol)))
 		}
+		g.freeRegister(reg)
 		return ""
 
 	case *ast.BinaryExpression:
-		leftReg := g.generateExpression(n.Left)
-		rightReg := g.generateExpression(n.Right)
+		if n.Operator == "and" || n.Operator == "or" {
+			if reg := g.generateLogical(n); reg >= 0 {
+				g.freeRegister(reg)
+			}
+			return ""
+		}
+		leftReg, rightReg := g.generateOperands(n.Left, n.Right)
 		resultReg := g.allocateRegister()
 
 		if n.Operator == "<" || n.Operator == ">" {
@@ -253,14 +571,11 @@ func (g *CodeGenerator) generateNode(node ast.Node) string {
 		} else {
 			switch n.Operator {
 			case "+":
-				g.output.WriteString(fmt.Sprintf("    add $t%d, $t%d, $t%d\n",
-					resultReg, leftReg, rightReg))
+				g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("add"), resultReg, leftReg, rightReg))
 			case "-":
-				g.output.WriteString(fmt.Sprintf("    sub $t%d, $t%d, $t%d\n",
-					resultReg, leftReg, rightReg))
+				g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("sub"), resultReg, leftReg, rightReg))
 			case "*":
-				g.output.WriteString(fmt.Sprintf("    mul $t%d, $t%d, $t%d\n",
-					resultReg, leftReg, rightReg))
+				g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("mul"), resultReg, leftReg, rightReg))
 			}
 		}
 
@@ -269,89 +584,330 @@ func (g *CodeGenerator) generateNode(node ast.Node) string {
 		return ""
 
 	case *ast.IfStatement:
-		log.Printf("[DEBUG] Generating if statement")
 		if err := g.GenerateIfStatement(n); err != nil {
 			log.Printf("Error generating if statement: %v", err)
 		}
 		return ""
 
 	case *ast.WhileStatement:
-		log.Printf("[DEBUG] Generating while statement")
 		if err := g.GenerateWhileStatement(n); err != nil {
 			log.Printf("Error generating while statement: %v", err)
 		}
 		return ""
 
+	case *ast.FunctionDefinition:
+		g.functions = append(g.functions, n)
+		return ""
+
+	case *ast.ReturnStatement:
+		g.generateReturn(n)
+		return ""
+
+	case *ast.ExpressionStatement:
+		if reg := g.generateExpression(n.Expression); reg >= 0 {
+			g.freeRegister(reg)
+		}
+		return ""
+
+	case *ast.GlobalStatement:
+		// Only changes what the binder resolves names to
+		return ""
+
 	default:
 		log.Printf("Warning: Unhandled node type: %T\n", n)
 		return ""
 	}
 }
 
+// printValue prints value with the system call chosen by its type
+func (g *CodeGenerator) printValue(value ast.Expression) {
+	if g.isNone(value) {
+		g.printNone(value)
+	} else if g.isFloat(value) {
+		if reg := g.generateFloat(value); reg >= 0 {
+			g.output.WriteString(fmt.Sprintf("    mov.s $f12, $f%d\n", reg))
+			g.loadImmediate("$v0", int64(g.syscalls.PrintFloat))
+			g.freeFloat(reg)
+			g.output.WriteString("    syscall\n")
+		}
+	} else if g.isList(value) {
+		g.printList(value)
+	} else {
+		switch val := value.(type) {
+		case *ast.IntegerLiteral:
+			reg := g.allocateRegister()
+			g.loadImmediate(fmt.Sprintf("$t%d", reg), val.Value)
+			g.printInt(reg)
+			g.freeRegister(reg)
+		case *ast.StringLiteral:
+			g.printLabel(g.addStringLiteral(val.Value))
+		case *ast.Identifier:
+			if sym := val.Symbol; sym != nil {
+				reg := g.loadVariable(sym)
+				g.printRegister(reg, sym.Type == symbol.StringType)
+				g.freeRegister(reg)
+			}
+		default:
+			if reg := g.generateExpression(val); reg >= 0 {
+				g.printRegister(reg, g.isString(val))
+				g.freeRegister(reg)
+			}
+		}
+	}
+}
+
+// printRegister prints the integer in $t<reg>, or the string it points to
+func (g *CodeGenerator) printRegister(reg int, isString bool) {
+	if !isString {
+		g.printInt(reg)
+		return
+	}
+	g.output.WriteString(fmt.Sprintf("    move $a0, $t%d\n", reg))
+	g.loadImmediate("$v0", int64(g.syscalls.PrintString))
+	g.output.WriteString("    syscall\n")
+}
+
 func (g *CodeGenerator) generateExpression(expr ast.Expression) int {
 	if expr == nil {
 		return -1
 	}
+	if bin, ok := expr.(*ast.BinaryExpression); ok && bin.Operator == "+" && g.isString(bin) {
+		return g.generateConcat(bin)
+	}
+	if g.isFloat(expr) {
+		return g.truncateFloat(expr)
+	}
 
 	switch e := expr.(type) {
 	case *ast.IntegerLiteral:
 		reg := g.allocateRegister()
-		g.output.WriteString(fmt.Sprintf("    li $t%d, %s\n", reg, e.Value))
+		g.loadImmediate(fmt.Sprintf("$t%d", reg), e.Value)
 		return reg
 
 	case *ast.Identifier:
-		if token.LookupIdent(e.Value) != token.IDENT {
+		if e.Symbol == nil {
 			return -1
 		}
-
-		if sym, exists := g.symbolTable.Lookup(e.Value); exists {
-			reg := g.allocateRegister()
-			g.output.WriteString(fmt.Sprintf("    lw $t%d, %s\n", reg, sym.Name))
+		if reg, ok := g.takeHeld(e.Symbol); ok {
 			return reg
 		}
-		return -1
+		return g.loadVariable(e.Symbol)
+
+	case *ast.NoneLiteral:
+		reg := g.allocateRegister()
+		g.output.WriteString(fmt.Sprintf("    move $t%d, $zero\n", reg))
+		return reg
+
+	case *ast.StringLiteral:
+		// Literals are interned, so a string's value is its label's address
+		reg := g.allocateRegister()
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, %s\n", g.op("la"), reg, g.addStringLiteral(e.Value)))
+		return reg
 
 	case *ast.BinaryExpression:
-		leftReg := g.generateExpression(e.Left)
-		rightReg := g.generateExpression(e.Right)
+		if e.Operator == "and" || e.Operator == "or" {
+			return g.generateLogical(e)
+		}
+		if g.hasFloatOperand(e) {
+			return g.generateFloatComparison(e)
+		}
+		leftReg, rightReg := g.generateOperands(e.Left, e.Right)
+		if g.stringEquality(e.Left, e.Operator, e.Right) {
+			resultReg := g.compareStrings(e.Operator, leftReg, rightReg)
+			g.freeRegister(leftReg)
+			g.freeRegister(rightReg)
+			return resultReg
+		}
 		resultReg := g.allocateRegister()
 
 		switch e.Operator {
 		case "+":
-			g.output.WriteString(fmt.Sprintf("    add $t%d, $t%d, $t%d\n", resultReg, leftReg, rightReg))
+			g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("add"), resultReg, leftReg, rightReg))
 		case "-":
-			g.output.WriteString(fmt.Sprintf("    sub $t%d, $t%d, $t%d\n", resultReg, leftReg, rightReg))
+			g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("sub"), resultReg, leftReg, rightReg))
 		case "*":
-			g.output.WriteString(fmt.Sprintf("    mul $t%d, $t%d, $t%d\n", resultReg, leftReg, rightReg))
+			g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("mul"), resultReg, leftReg, rightReg))
+		case "<", ">", "<=", ">=", "==", "!=":
+			g.compareRegisters(e.Operator, resultReg, leftReg, rightReg)
+		case "/", "//", "%":
+			g.generateDivision(e.Operator, resultReg, leftReg, rightReg)
+		case "**":
+			g.generatePower(resultReg, leftReg, rightReg)
 		}
 
 		g.freeRegister(leftReg)
 		g.freeRegister(rightReg)
 		return resultReg
+
+	case *ast.Comparison:
+		return g.generateComparison(e)
+
+	case *ast.PrefixExpression:
+		operand := g.generateExpression(e.Right)
+		if operand == -1 {
+			return -1
+		}
+		resultReg := g.allocateRegister()
+		if e.Operator == "not" {
+			g.output.WriteString(fmt.Sprintf("    sltiu $t%d, $t%d, 1\n", resultReg, operand))
+		} else {
+			g.output.WriteString(fmt.Sprintf("    %s $t%d, $zero, $t%d\n", g.op("subu"), resultReg, operand))
+		}
+		g.freeRegister(operand)
+		return resultReg
+
+	case *ast.FunctionCall:
+		return g.generateFunctionCall(e)
+
+	case *ast.DictLiteral:
+		return g.generateDict(e)
+
+	case *ast.ListLiteral:
+		return g.generateList(e)
+
+	case *ast.IndexExpression:
+		return g.generateIndex(e)
 	}
 	return -1
 }
 
+// generateDivision divides $t<left> by $t<right> the way Python's // and %
+// do, which round the quotient down and gives the remainder the divisor's sign. div
+// truncates toward zero, so a nonzero remainder whose sign differs from the
+// divisor's is corrected. With Checked, a zero divisor aborts the program.
+func (g *CodeGenerator) generateDivision(op string, resultReg, leftReg, rightReg int) {
+	if g.Options.Checked {
+		g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", rightReg, g.coldAbort(divisionMessage)))
+	}
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d\n", g.op("div"), leftReg, rightReg))
+
+	rem := resultReg
+	if op != "%" {
+		rem = g.allocateRegister()
+		defer g.freeRegister(rem)
+		g.output.WriteString(fmt.Sprintf("    mflo $t%d\n", resultReg))
+	}
+	sign := g.allocateRegister()
+	defer g.freeRegister(sign)
+	done := g.getUniqueLabel("div_done")
+	g.output.WriteString(fmt.Sprintf("    mfhi $t%d\n", rem))
+	g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", rem, done))
+	g.output.WriteString(fmt.Sprintf("    xor $t%d, $t%d, $t%d\n", sign, rem, rightReg))
+	g.output.WriteString(fmt.Sprintf("    bgez $t%d, %s\n", sign, done))
+	if op != "%" {
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, -1\n", g.op("addiu"), resultReg, resultReg))
+	} else {
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("add"), resultReg, resultReg, rightReg))
+	}
+	g.output.WriteString(fmt.Sprintf("%s:\n", done))
+}
+
+// generatePower raises $t<base> to $t<exp> by repeated squaring. A negative
+// exponent gives 0, as there are no fractions to hold the result.
+func (g *CodeGenerator) generatePower(resultReg, baseReg, expReg int) {
+	base, exp, bit := g.allocateRegister(), g.allocateRegister(), g.allocateRegister()
+	defer g.freeRegister(base)
+	defer g.freeRegister(exp)
+	defer g.freeRegister(bit)
+	loop, skip, done := g.getUniqueLabel("pow_loop"), g.getUniqueLabel("pow_skip"), g.getUniqueLabel("pow_done")
+
+	g.output.WriteString(fmt.Sprintf("    li $t%d, 1\n", resultReg))
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $t%d\n", base, baseReg))
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $t%d\n", exp, expReg))
+	g.output.WriteString(fmt.Sprintf("    bgez $t%d, %s\n", exp, loop))
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $zero\n", resultReg))
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $zero\n", exp))
+	g.output.WriteString(fmt.Sprintf("%s:\n", loop))
+	g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", exp, done))
+	g.output.WriteString(fmt.Sprintf("    andi $t%d, $t%d, 1\n", bit, exp))
+	g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", bit, skip))
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("mul"), resultReg, resultReg, base))
+	g.output.WriteString(fmt.Sprintf("%s:\n", skip))
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("mul"), base, base, base))
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, 1\n", g.op("sra"), exp, exp))
+	g.output.WriteString(fmt.Sprintf("    j %s\n", loop))
+	g.output.WriteString(fmt.Sprintf("%s:\n", done))
+}
+
+// generateLogical evaluates and/or as Python does: the result is the left
+// operand when it decides the outcome, and the right operand is only
+// evaluated otherwise
+func (g *CodeGenerator) generateLogical(e *ast.BinaryExpression) int {
+	leftReg := g.generateExpression(e.Left)
+	if leftReg == -1 {
+		return -1
+	}
+	resultReg := g.allocateRegister()
+	end := g.getUniqueLabel(e.Operator + "_end")
+	branch := "beq"
+	if e.Operator == "or" {
+		branch = "bne"
+	}
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $t%d\n", resultReg, leftReg))
+	g.freeRegister(leftReg)
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, $zero, %s\n", branch, resultReg, end))
+	rightReg := g.generateExpression(e.Right)
+	if rightReg == -1 {
+		g.freeRegister(resultReg)
+		return -1
+	}
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $t%d\n", resultReg, rightReg))
+	g.freeRegister(rightReg)
+	g.output.WriteString(fmt.Sprintf("%s:\n", end))
+	return resultReg
+}
+
+// generateReturn leaves the result in $v0 and jumps to the function's single
+// epilogue
 func (g *CodeGenerator) generateReturn(stmt *ast.ReturnStatement) {
-	if stmt == nil || stmt.Value == nil {
+	if stmt == nil || g.frame == nil || g.frame.entry {
 		return
 	}
+	g.storeReturnValue(stmt)
+	g.output.WriteString(fmt.Sprintf("    j %s\n", g.funcExit))
+}
 
-	resultReg := g.generateExpression(stmt.Value)
-	if resultReg == -1 {
+func (g *CodeGenerator) storeReturnValue(stmt *ast.ReturnStatement) {
+	// Callers of a void function read None without looking at $v0
+	if g.voidFuncs[g.currentFunction] {
+		return
+	}
+	if stmt.Value == nil {
+		g.output.WriteString("    move $v0, $zero\n")
 		return
 	}
+	if g.returns[g.currentFunction] == symbol.FloatType {
+		// A float goes back as its bits, which the caller moves to the FPU
+		if freg := g.generateFloat(stmt.Value); freg >= 0 {
+			g.output.WriteString(fmt.Sprintf("    mfc1 $v0, $f%d\n", freg))
+			g.freeFloat(freg)
+		}
+		return
+	}
+	if stmt.Value != nil {
+		if resultReg := g.generateExpression(stmt.Value); resultReg != -1 {
+			g.output.WriteString(fmt.Sprintf("    move $v0, $t%d\n", resultReg))
+			g.freeRegister(resultReg)
+		}
+	}
+}
 
-	g.output.WriteString(fmt.Sprintf("    move $v0, $t%d\n", resultReg))
-	g.freeRegister(resultReg)
+// writePrologue pushes the current frame, saving $ra and the caller's $fp
+// in its top two words and pointing $fp just above it
+func (g *CodeGenerator) writePrologue() {
+	word := g.Options.Target.WordBytes()
+	g.output.WriteString(fmt.Sprintf("    %s $sp, $sp, -%d\n", g.op("addiu"), g.frame.Size))
+	g.output.WriteString(fmt.Sprintf("    %s $ra, %d($sp)\n", g.op("sw"), g.frame.Size-word))
+	g.output.WriteString(fmt.Sprintf("    %s $fp, %d($sp)\n", g.op("sw"), g.frame.Size-2*word))
+	g.output.WriteString(fmt.Sprintf("    %s $fp, $sp, %d\n", g.op("addiu"), g.frame.Size))
+}
 
-	g.output.WriteString("    lw $s1, -16($fp)\n")
-	g.output.WriteString("    lw $s0, -12($fp)\n")
-	g.output.WriteString("    lw $fp, -8($fp)\n")
-	g.output.WriteString("    lw $ra, -4($fp)\n")
-	frameSize := 16 + (len(g.currentParams) * 4)
-	frameSize = (frameSize + 7) & ^7
-	g.output.WriteString(fmt.Sprintf("    addiu $sp, $sp, %d\n", frameSize))
+// writeEpilogue pops the current frame and returns to the caller
+func (g *CodeGenerator) writeEpilogue() {
+	word := g.Options.Target.WordBytes()
+	g.output.WriteString(fmt.Sprintf("    %s $ra, %d($fp)\n", g.op("lw"), -word))
+	g.output.WriteString("    move $sp, $fp\n")
+	g.output.WriteString(fmt.Sprintf("    %s $fp, %d($sp)\n", g.op("lw"), -2*word))
 	g.output.WriteString("    jr $ra\n")
 }
 
@@ -362,153 +918,198 @@ func (g *CodeGenerator) generateFunction(fn *ast.FunctionDefinition) {
 
 	g.currentFunction = fn.Name
 	g.currentParams = fn.Parameters
-
-	frameSize := 16 + (len(fn.Parameters) * 4)
-	frameSize = (frameSize + 7) & ^7
-
-	g.output.WriteString(fmt.Sprintf("%s:\n", fn.Name))
-
-	g.output.WriteString(fmt.Sprintf("    addiu $sp, $sp, -%d\n", frameSize))
-	g.output.WriteString("    sw $ra, -4($sp)\n")
-	g.output.WriteString("    sw $fp, -8($sp)\n")
-	g.output.WriteString("    sw $s0, -12($sp)\n")
-	g.output.WriteString("    sw $s1, -16($sp)\n")
-	g.output.WriteString("    move $fp, $sp\n")
-
-	for i, param := range fn.Parameters {
-		g.symbolTable.Define(param, symbol.IntegerType)
-		offset := -(20 + (i * 4))
-		g.output.WriteString(fmt.Sprintf("    sw $a%d, %d($fp)\n", i, offset))
+	// Register temporaries never need a slot of their own
+	var locals []*symbol.Symbol
+	var names []string
+	for _, sym := range fn.Locals {
+		if !g.registerTemps[sym] {
+			locals = append(locals, sym)
+			names = append(names, sym.Name)
+		}
 	}
+	g.frame = newFrame(fn.Name, fn.Parameters, names, g.Options.Target.WordBytes(), g.Options.Checked)
+	g.frames = append(g.frames, g.frame)
+	g.clearAllRegisters()
+	defer g.enterStatement(fn)()
 
-	for _, stmt := range fn.Body {
-		g.generateNode(stmt)
-	}
+	g.output.WriteString(fmt.Sprintf("%s:\n", g.funcLabel(fn.Name)))
+	g.writePrologue()
 
-	hasReturn := false
-	for _, stmt := range fn.Body {
-		if _, ok := stmt.(*ast.ReturnStatement); ok {
-			hasReturn = true
+	for i, param := range fn.Parameters {
+		if i >= 4 {
+			log.Println("Warning - more than 4 parameters not supported")
 			break
 		}
+		offset, _ := g.frame.offset(param)
+		g.output.WriteString(fmt.Sprintf("    %s $a%d, %d($fp)\n", g.op("sw"), i, offset))
 	}
-
-	if !hasReturn {
-		g.output.WriteString("    lw $s1, -16($fp)\n")
-		g.output.WriteString("    lw $s0, -12($fp)\n")
-		g.output.WriteString("    lw $fp, -8($fp)\n")
-		g.output.WriteString("    lw $ra, -4($fp)\n")
-		g.output.WriteString(fmt.Sprintf("    addiu $sp, $sp, %d\n", frameSize))
-		g.output.WriteString("    jr $ra\n")
+	if g.Options.Checked {
+		g.writeCanary()
+		g.enterCall()
 	}
-
-	g.currentFunction = ""
-	g.currentParams = nil
-}
-
-func (g *CodeGenerator) generateAssignment(stmt *ast.AssignmentStatement) {
-	if stmt == nil || stmt.Value == nil {
-		return
-	}
-
-	if call, ok := stmt.Value.(*ast.FunctionCall); ok {
-		log.Printf("Generating function call: %s\n", call.Function)
-		resultReg := g.generateFunctionCall(call)
-		if resultReg != -1 {
-			sym := g.symbolTable.Define(stmt.Name, symbol.IntegerType)
-			g.output.WriteString(fmt.Sprintf("    sw $v0, %s\n", sym.Name))
-			g.freeRegister(resultReg)
+	g.initLocals(locals)
+
+	g.funcExit = g.getUniqueLabel("func_exit")
+	for i, stmt := range fn.Body {
+		// A return ending the body falls through to the epilogue
+		if ret, ok := stmt.(*ast.ReturnStatement); ok && i == len(fn.Body)-1 {
+			leave := g.enterStatement(ret)
+			g.storeReturnValue(ret)
+			leave()
+			continue
 		}
-		return
-	}
-
-	resultReg := g.generateExpression(stmt.Value)
-	if resultReg == -1 {
-		return
+		g.generateNode(stmt)
 	}
 
-	sym, exists := g.symbolTable.Lookup(stmt.Name)
-	if !exists {
-		sym = g.symbolTable.Define(stmt.Name, symbol.IntegerType)
+	// Every return jumps here, so each function has exactly one epilogue
+	g.output.WriteString(fmt.Sprintf("%s:\n", g.funcExit))
+	if g.Options.Checked {
+		g.checkCanary()
+		g.leaveCall()
 	}
+	g.writeEpilogue()
+	g.writeColdBlocks()
 
-	g.output.WriteString(fmt.Sprintf("    sw $t%d, %s\n", resultReg, sym.Name))
-	g.freeRegister(resultReg)
+	g.currentFunction = ""
+	g.funcExit = ""
+	g.currentParams = nil
 }
 
 func (g *CodeGenerator) generateFunctionCall(call *ast.FunctionCall) int {
-	log.Printf("Generating function call: %s\n", call.Function)
 	if call == nil {
 		return -1
 	}
+	if call.Function == formatFunction {
+		return g.generateFormat(call)
+	}
+	if call.Function == zerosFunction {
+		return g.generateZeros(call)
+	}
+	if call.Method || listFunctions[call.Function] {
+		return g.generateListCall(call)
+	}
 
+	// Temporaries live across the call, so spill them before the callee reuses them
 	savedRegs := []int{}
 	for reg := 0; reg < 10; reg++ {
 		if g.usedRegs[reg] {
-			g.output.WriteString(fmt.Sprintf("    sw $t%d, 0($sp)\n", reg))
-			g.output.WriteString("    addiu $sp, $sp, -4\n")
+			g.output.WriteString(fmt.Sprintf("    %s $sp, $sp, %d\n", g.op("addiu"), -g.Options.Target.WordBytes()))
+			g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($sp)\n", g.op("sw"), reg))
 			savedRegs = append(savedRegs, reg)
 		}
 	}
+	savedFloats := []int{}
+	for reg := firstFloatReg; reg <= lastFloatReg; reg++ {
+		if g.usedFloats[reg] {
+			g.output.WriteString(fmt.Sprintf("    %s $sp, $sp, %d\n", g.op("addiu"), -g.Options.Target.WordBytes()))
+			g.output.WriteString(fmt.Sprintf("    s.s $f%d, 0($sp)\n", reg))
+			savedFloats = append(savedFloats, reg)
+		}
+	}
+	g.clearAllRegisters()
 
+	// An argument containing a call overwrites $a0-$a3, so arguments before
+	// it stay in temporaries until every argument has been evaluated
+	lastCall := -1
+	for i, arg := range call.Arguments {
+		if containsCall(arg) {
+			lastCall = i
+		}
+	}
+	pending := map[int]int{}
+	var params []*symbol.Symbol
+	if fn := g.definitions[call.Function]; fn != nil {
+		params = fn.Params
+	}
 	for i, arg := range call.Arguments {
 		if i >= 4 {
 			log.Println("Warning - more than 4 arguments not supported")
 			break
 		}
-		argReg := g.generateExpression(arg)
-		if argReg != -1 {
+		argReg := -1
+		if i < len(params) && params[i].Type == symbol.FloatType {
+			argReg = g.floatBits(arg)
+		} else {
+			argReg = g.generateExpression(arg)
+		}
+		if argReg == -1 {
+			continue
+		}
+		if i < lastCall {
+			pending[i] = argReg
+			continue
+		}
+		g.output.WriteString(fmt.Sprintf("    move $a%d, $t%d\n", i, argReg))
+		g.freeRegister(argReg)
+	}
+	for i := 0; i < lastCall; i++ {
+		if argReg, ok := pending[i]; ok {
 			g.output.WriteString(fmt.Sprintf("    move $a%d, $t%d\n", i, argReg))
 			g.freeRegister(argReg)
 		}
 	}
 
-	g.output.WriteString(fmt.Sprintf("    jal %s\n", call.Function))
+	g.output.WriteString(fmt.Sprintf("    jal %s\n", g.funcLabel(call.Function)))
+
+	for i := len(savedFloats) - 1; i >= 0; i-- {
+		reg := savedFloats[i]
+		g.output.WriteString(fmt.Sprintf("    l.s $f%d, 0($sp)\n", reg))
+		g.output.WriteString(fmt.Sprintf("    %s $sp, $sp, %d\n", g.op("addiu"), g.Options.Target.WordBytes()))
+		g.usedFloats[reg] = true
+	}
 
 	for i := len(savedRegs) - 1; i >= 0; i-- {
 		reg := savedRegs[i]
-		g.output.WriteString("    addiu $sp, $sp, 4\n")
-		g.output.WriteString(fmt.Sprintf("    lw $t%d, 0($sp)\n", reg))
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($sp)\n", g.op("lw"), reg))
+		g.output.WriteString(fmt.Sprintf("    %s $sp, $sp, %d\n", g.op("addiu"), g.Options.Target.WordBytes()))
+		g.usedRegs[reg] = true
 	}
 
+	// A discarded result stays in $v0 rather than tying up a temporary
+	if call.Discarded {
+		return -1
+	}
 	resultReg := g.allocateRegister()
+	// A void function leaves nothing in $v0, and its result is None
+	if g.voidFuncs[call.Function] {
+		g.output.WriteString(fmt.Sprintf("    move $t%d, $zero\n", resultReg))
+		return resultReg
+	}
 	g.output.WriteString(fmt.Sprintf("    move $t%d, $v0\n", resultReg))
 	return resultReg
 }
 
-func (g *CodeGenerator) generatePrintStatement(stmt *ast.PrintStatement) {
-	if stmt == nil || stmt.Value == nil {
-		return
-	}
-
-	switch v := stmt.Value.(type) {
-	case *ast.StringLiteral:
-		g.output.WriteString("    li $v0, 4\n")
-		g.output.WriteString(fmt.Sprintf("    la $a0, %s\n", v.Value))
-		g.output.WriteString("    syscall\n")
-	case *ast.Identifier:
-		sym, exists := g.symbolTable.Lookup(v.Value)
-		if !exists {
-			return
-		}
-		if sym.Type == symbol.StringType {
-			g.output.WriteString("    li $v0, 4\n")
-			g.output.WriteString(fmt.Sprintf("    lw $a0, %s\n", v.Value))
-		} else {
-			g.output.WriteString("    li $v0, 1\n")
-			g.output.WriteString(fmt.Sprintf("    lw $a0, %s\n", v.Value))
+func containsCall(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.FunctionCall:
+		return true
+	case *ast.BinaryExpression:
+		return containsCall(e.Left) || containsCall(e.Right)
+	case *ast.Comparison:
+		return slices.ContainsFunc(e.Operands, containsCall)
+	case *ast.PrefixExpression:
+		return containsCall(e.Right)
+	case *ast.IndexExpression:
+		return containsCall(e.Left) || containsCall(e.Index)
+	case *ast.DictLiteral:
+		for i := range e.Keys {
+			if containsCall(e.Keys[i]) || containsCall(e.Values[i]) {
+				return true
+			}
 		}
-		g.output.WriteString("    syscall\n")
-		g.output.WriteString("    li $v0, 11\n")
-		g.output.WriteString("    li $a0, 10\n")
-		g.output.WriteString("    syscall\n")
+	case *ast.ListLiteral:
+		return slices.ContainsFunc(e.Elements, containsCall)
 	}
+	return false
 }
 
 func (g *CodeGenerator) allocateRegister() int {
 	for i := 0; i < 10; i++ {
 		if !g.usedRegs[i] {
 			g.usedRegs[i] = true
+			if g.frame != nil {
+				g.frame.temps[i] = true
+			}
 			return i
 		}
 	}
@@ -521,29 +1122,105 @@ func (g *CodeGenerator) freeRegister(reg int) {
 	}
 }
 
+// clearAllRegisters frees every temporary except those holding a tuple
+// assignment's values, which stay reserved until they are read
 func (g *CodeGenerator) clearAllRegisters() {
 	for reg := 0; reg < 10; reg++ {
 		g.usedRegs[reg] = false
 	}
+	for _, reg := range g.held {
+		g.usedRegs[reg] = true
+	}
+	for reg := firstFloatReg; reg <= lastFloatReg; reg++ {
+		g.usedFloats[reg] = false
+	}
 }
 
-func (g *CodeGenerator) loadIdentifier(name string) *int {
-	if sym, exists := g.symbolTable.Lookup(name); exists {
-		reg := g.allocateRegister()
-		if reg < 0 {
-			return nil
-		}
-		switch sym.Type {
-		case symbol.StringType:
-			g.output.WriteString(fmt.Sprintf("    lw $t%d, %s\n", reg, name))
-		case symbol.IntegerType, symbol.BooleanType:
-			g.output.WriteString(fmt.Sprintf("    lw $t%d, %s\n", reg, name))
-		default:
-			log.Printf("Warning: unknown type for identifier %s: %s", name, sym.Type)
-			g.freeRegister(reg)
-			return nil
+// loadVariable loads a bound variable into a fresh temporary
+func (g *CodeGenerator) loadVariable(sym *symbol.Symbol) int {
+	reg := g.allocateRegister()
+	if pinned, ok := g.pinned[sym]; ok {
+		g.output.WriteString(fmt.Sprintf("    move $t%d, %s\n", reg, pinned))
+		return reg
+	}
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, %s\n", g.loadOp(sym), reg, g.address(sym)))
+	if g.poisoned(sym) {
+		g.checkInitialized(sym, reg)
+	}
+	return reg
+}
+
+// poisoned reports whether a variable starts out holding the sentinel under
+// -checked. Byte and halfword variables are too narrow for it and start at
+// 0, floats start at 0.0 and parameters always hold an argument.
+func (g *CodeGenerator) poisoned(sym *symbol.Symbol) bool {
+	return g.Options.Checked && !sym.IsParam && sym.Storage.Size == 0 && sym.Type != symbol.FloatType
+}
+
+// checkInitialized aborts the program with a message when the value just
+// loaded into $t<reg> is still the sentinel the variable started with
+func (g *CodeGenerator) checkInitialized(sym *symbol.Symbol, reg int) {
+	sentinel := g.allocateRegister()
+	g.loadImmediate(fmt.Sprintf("$t%d", sentinel), canaryValue)
+	g.output.WriteString(fmt.Sprintf("    beq $t%d, $t%d, %s\n", reg, sentinel, g.coldAbort(uninitMessage(sym.Name))))
+	g.freeRegister(sentinel)
+}
+
+func uninitMessage(name string) string {
+	return fmt.Sprintf("'%s' was read before it was assigned\n", name)
+}
+
+// divisionMessage is printed when a checked program divides by zero
+const divisionMessage = "division by zero\n"
+
+// abort prints message, which must already be interned, and exits with
+// status 1
+func (g *CodeGenerator) abort(message string) {
+	g.printLabel(g.addStringLiteral(message))
+	g.exitWith(1)
+}
+
+// directive, loadOp and storeOp follow the storage a variable's annotation
+// selected; byte and halfword values are widened to a full register on load
+func (g *CodeGenerator) directive(sym *symbol.Symbol) string {
+	switch sym.Storage.Size {
+	case 1:
+		return ".byte"
+	case 2:
+		return ".half"
+	}
+	return g.op(".word")
+}
+
+func (g *CodeGenerator) loadOp(sym *symbol.Symbol) string {
+	op := map[int]string{1: "lb", 2: "lh"}[sym.Storage.Size]
+	if op == "" {
+		return g.op("lw")
+	}
+	if sym.Storage.Unsigned {
+		op += "u"
+	}
+	return op
+}
+
+func (g *CodeGenerator) storeOp(sym *symbol.Symbol) string {
+	switch sym.Storage.Size {
+	case 1:
+		return "sb"
+	case 2:
+		return "sh"
+	}
+	return g.op("sw")
+}
+
+// address returns the memory operand for a bound variable: its frame slot
+// for a parameter or local of the current function, its .data label for a
+// global
+func (g *CodeGenerator) address(sym *symbol.Symbol) string {
+	if !sym.IsGlobal {
+		if offset, ok := g.frame.offset(sym.Name); ok {
+			return fmt.Sprintf("%d($fp)", offset)
 		}
-		return &reg
 	}
-	return nil
+	return g.varLabel(sym.Name)
 }
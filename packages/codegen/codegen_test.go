@@ -1,10 +1,17 @@
 package codegen
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"testing"
 
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/desugar"
+	"github.com/arifali123/152compiler/packages/emulator"
+	"github.com/arifali123/152compiler/packages/gensym"
 	"github.com/arifali123/152compiler/packages/lexer"
 	"github.com/arifali123/152compiler/packages/parser"
 	"github.com/arifali123/152compiler/packages/symbol"
@@ -168,7 +175,6 @@ main:
 			name:  "Integer Assignment with Addition",
 			input: "x = 5 + 3",
 			expected: `.data
-newline: .asciiz "\n"
 x: .word 0
 
 .text
@@ -186,7 +192,6 @@ main:
 			input: `x = 8
 y = x * 2`,
 			expected: `.data
-newline: .asciiz "\n"
 x: .word 0
 y: .word 0
 
@@ -232,7 +237,6 @@ func TestNodeGeneration(t *testing.T) {
 
 		got := codeGen.Generate(program)
 		expected := `.data
-newline: .asciiz "\n"
 x: .word 0
 
 .text
@@ -257,7 +261,6 @@ main:
 
 		got := codeGen.Generate(program)
 		expected := `.data
-newline: .asciiz "\n"
 name: .word 0
 str_0: .asciiz "hello"
 
@@ -282,7 +285,6 @@ main:
 				name:  "Addition",
 				input: "x = 5 + 3",
 				expected: `.data
-newline: .asciiz "\n"
 x: .word 0
 
 .text
@@ -299,7 +301,6 @@ main:
 				name:  "Multiplication",
 				input: "x = 4 * 2",
 				expected: `.data
-newline: .asciiz "\n"
 x: .word 0
 
 .text
@@ -518,7 +519,6 @@ main:
     li $t#, 0
     slt $t#, $t#, $t#
     beq $t#, $zero, if_false_2
-    j if_true_1
 if_true_1:
     li $t#, 1
     sw $t#, y
@@ -550,11 +550,7 @@ main:
     li $t#, 0
     sw $t#, i
 while_start_1:
-    lw $t#, i
-    li $t#, 3
-    slt $t#, $t#, $t#
-    beq $t#, $zero, while_end_3
-    j while_body_2
+    j while_cond_4
 while_body_2:
     lw $t#, i
     move $a0, $t#
@@ -567,7 +563,11 @@ while_body_2:
     li $t#, 1
     add $t#, $t#, $t#
     sw $t#, i
-    j while_start_1
+while_cond_4:
+    lw $t#, i
+    li $t#, 3
+    slt $t#, $t#, $t#
+    bne $t#, $zero, while_body_2
 while_end_3:
 
     li $v0, 10
@@ -632,22 +632,19 @@ main:
 
 add:
     addiu $sp, $sp, -16
-    sw $ra, -4($sp)
-    sw $fp, -8($sp)
-    sw $s0, -12($sp)
-    sw $s1, -16($sp)
-    move $fp, $sp
-    sw $a0, -20($fp)
-    sw $a1, -24($fp)
-    lw $t#, -20($fp)
-    lw $t#, -24($fp)
+    sw $ra, 12($sp)
+    sw $fp, 8($sp)
+    addiu $fp, $sp, 16
+    sw $a0, -12($fp)
+    sw $a1, -16($fp)
+    lw $t#, -12($fp)
+    lw $t#, -16($fp)
     add $t#, $t#, $t#
     move $v0, $t#
-    lw $s1, -16($fp)
-    lw $s0, -12($fp)
-    lw $fp, -8($fp)
+func_exit_1:
     lw $ra, -4($fp)
-    addiu $sp, $sp, 16
+    move $sp, $fp
+    lw $fp, -8($sp)
     jr $ra`,
 		},
 	}
@@ -666,3 +663,1882 @@ add:
 		})
 	}
 }
+
+func TestFrameTrailer(t *testing.T) {
+	input := "def add(a, b):\n\treturn a + b\n\ndef twice(x):\n\treturn add(x, x)\n\ny = twice(4)\nprint(y)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	plain := New(symbol.NewSymbolTable(nil))
+	if got := plain.Generate(program); strings.Contains(got, "# Frame layout") {
+		t.Errorf("trailer emitted without FrameTrailer:\n%s", got)
+	}
+
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.FrameTrailer = true
+	got := g.Generate(program)
+
+	frames := g.Frames()
+	if len(frames) != 3 || frames[1].Name != "add" || frames[2].Name != "twice" {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	if frames[1].Size != 16 || frames[2].Size != 16 {
+		t.Errorf("frame sizes wrong. got add=%d twice=%d", frames[1].Size, frames[2].Size)
+	}
+
+	for _, want := range []string{
+		"# Frame layout",
+		"# main: no stack frame",
+		"#   globals in .data: y",
+		"# add: 16 byte frame",
+		"#    -12($fp)  a      parameter, passed in $a0",
+		"#    -16($fp)  b      parameter, passed in $a1",
+		"# twice: 16 byte frame",
+		"#   result in $v0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("trailer missing %q:\n%s", want, got)
+		}
+	}
+	if !strings.Contains(got, "sw $a1, -16($fp)") {
+		t.Errorf("parameter stored at a different offset than documented:\n%s", got)
+	}
+}
+
+func TestLocals(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		checked  bool
+		expected string
+	}{
+		{
+			name:     "recursion keeps each call's locals",
+			input:    "def fact(n):\n\tif n < 2:\n\t\treturn 1\n\trest = fact(n - 1)\n\tresult = n * rest\n\treturn result\n\nx = fact(5)\nprint(x)\n",
+			expected: "120\n",
+		},
+		{
+			name:     "local shadows global",
+			input:    "x = 1\ndef f():\n\tx = 2\n\treturn x\n\ny = f()\nprint(x)\nprint(y)\n",
+			expected: "1\n2\n",
+		},
+		{
+			name:     "global statement",
+			input:    "n = 0\ndef bump():\n\tglobal n\n\tn = n + 1\n\nbump()\nbump()\nprint(n)\n",
+			expected: "2\n",
+		},
+		{
+			name:     "typed locals",
+			input:    "def f():\n\ts = \"hi\"\n\tz = 1.5\n\tz = z * 2\n\tprint(s)\n\tprint(z)\n\nf()\n",
+			expected: "hi\n3.0\n",
+		},
+		{
+			name:     "locals start at zero",
+			input:    "def f(a):\n\tif a > 0:\n\t\tb = a\n\treturn b\n\nx = f(0)\nprint(x)\n",
+			expected: "0\n",
+		},
+		{
+			name:     "checked local read before assignment",
+			input:    "def f(a):\n\tif a > 0:\n\t\tb = a\n\treturn b\n\nx = f(0)\nprint(x)\n",
+			checked:  true,
+			expected: "'b' was read before it was assigned\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options.Checked = tt.checked
+			asm := g.Generate(desugar.Program(program))
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+
+	// Locals live in the frame, not in .data
+	input := "def f(a):\n\tb = a + 1\n\treturn b\n\nx = f(1)\nprint(x)\n"
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.FrameTrailer = true
+	got := g.Generate(parser.New(lexer.New(input)).ParseProgram())
+	for _, want := range []string{"sw $zero, -16($fp)", "sw $t2, -16($fp)", "#    -16($fp)  b      local variable"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "b: .word") {
+		t.Errorf("local given a .data word:\n%s", got)
+	}
+}
+
+func TestEntry(t *testing.T) {
+	input := "def main():\n\tprint(\"main\")\n\tprint(x)\n\nx = 5\nprint(\"init\")\n"
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.Entry = "main"
+	g.Options.FrameTrailer = true
+	asm := g.Generate(desugar.Program(parser.New(lexer.New(input)).ParseProgram()))
+	var out strings.Builder
+	if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, asm)
+	}
+	if want := "init\nmain\n5\n"; out.String() != want {
+		t.Errorf("wrong output. expected=%q, got=%q\n%s", want, out.String(), asm)
+	}
+	for _, want := range []string{"main:\n    jal rt_init\n    jal u_main\n", "rt_init:\n    addiu $sp, $sp, -8\n", "# rt_init: 8 byte frame"} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("output missing %q:\n%s", want, asm)
+		}
+	}
+}
+
+func TestNameMangling(t *testing.T) {
+	input := "def main(a):\n\treturn a + 1\n\ndef add(a, b):\n\treturn a + b\n\nnewline = 4\nstr_0 = \"hi\"\nadd = add(newline, 2)\nu_x = main(add)\nprint(str_0)\nprint(add)\nprint(u_x)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	got := New(symbol.NewSymbolTable(nil)).Generate(program)
+
+	for _, want := range []string{
+		"newline: .asciiz",
+		"u_newline: .word 0",
+		"u_str_0: .word 0",
+		"u_v_add: .word 0",
+		"u_u_x: .word 0",
+		"u_main:",
+		"jal u_main",
+		"jal add",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+
+	// Every label must be defined exactly once
+	seen := map[string]bool{}
+	for _, line := range strings.Split(got, "\n") {
+		if i := strings.Index(line, ":"); i > 0 && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "#") {
+			label := line[:i]
+			if seen[label] {
+				t.Errorf("label %s defined twice:\n%s", label, got)
+			}
+			seen[label] = true
+		}
+	}
+
+	var out strings.Builder
+	if _, err := emulator.Run(got, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, got)
+	}
+	if out.String() != "hi\n6\n7\n" {
+		t.Errorf("output wrong. got=%q", out.String())
+	}
+}
+
+func TestChainLabelMangling(t *testing.T) {
+	// Globals named like the labels of chained comparisons, numbered past
+	// wherever the generator has got to by then
+	var input strings.Builder
+	input.WriteString("def f():\n\treturn 5\n\ndef h():\n\treturn 2.5\n\n")
+	for i := 1; i <= 8; i++ {
+		fmt.Fprintf(&input, "cmp_end_%d = %d\nfcmp_fail_%d = %d\nfcmp_end_%d = %d\n", i, i, i, i, i, i)
+	}
+	input.WriteString("x = 1 < f() < 10\ny = 1.0 < h() < 2.0\nprint(x)\nprint(y)\nprint(cmp_end_1 + fcmp_fail_2 + fcmp_end_3)\n")
+	got := New(symbol.NewSymbolTable(nil)).Generate(parser.New(lexer.New(input.String())).ParseProgram())
+
+	for _, want := range []string{"u_cmp_end_1: .word 0", "u_fcmp_fail_2: .word 0", "u_fcmp_end_3: .word 0"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(got, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, got)
+	}
+	if out.String() != "1\n0\n6\n" {
+		t.Errorf("output wrong. got=%q", out.String())
+	}
+}
+
+func TestLabelSanitizing(t *testing.T) {
+	input := "t0 = 1\nsp = 2\nx_y = 3\nra = t0 + sp\nprint(ra)\nprint(x_y)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	// Identifiers the lexer cannot produce still reach codegen through
+	// programmatically built trees
+	program.Statements = append(program.Statements,
+		&ast.AssignmentStatement{Name: "é", Value: &ast.IntegerLiteral{Value: 7}},
+		&ast.PrintStatement{Value: &ast.Identifier{Value: "é"}},
+	)
+
+	g := New(symbol.NewSymbolTable(nil))
+	got := g.Generate(program)
+
+	for _, want := range []string{"u_t0: .word 0", "u_sp: .word 0", "u_ra: .word 0", "u_x_y: .word 0", "x__e9_: .word 0"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if names := g.SourceNames(); names["u_t0"] != "t0" || names["x__e9_"] != "é" {
+		t.Errorf("reverse map wrong: %v", names)
+	}
+
+	var out strings.Builder
+	if _, err := emulator.Run(got, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, got)
+	}
+	if out.String() != "3\n3\n7\n" {
+		t.Errorf("output wrong. got=%q", out.String())
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		name, prefix, expected string
+	}{
+		{"é", "", "x__e9_"},
+		{"a_b", "", "x_a__b"},
+		{"2x", "", "x_2x"},
+		{"é", "v_", "x_v__e9_"},
+	}
+	for _, tt := range tests {
+		if got := escapeLabel(tt.name, tt.prefix); got != tt.expected {
+			t.Errorf("escapeLabel(%q, %q) = %q, expected %q", tt.name, tt.prefix, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadImmediate(t *testing.T) {
+	tests := []struct {
+		value    int64
+		mars     string
+		bare     string
+		expected int32
+	}{
+		{0, "li $t0, 0", "addiu $t0, $zero, 0", 0},
+		{32767, "li $t0, 32767", "addiu $t0, $zero, 32767", 32767},
+		{-32768, "li $t0, -32768", "addiu $t0, $zero, -32768", -32768},
+		{32768, "li $t0, 32768", "ori $t0, $zero, 32768", 32768},
+		{65535, "li $t0, 65535", "ori $t0, $zero, 65535", 65535},
+		{65536, "li $t0, 65536", "lui $t0, 1", 65536},
+		{-32769, "li $t0, -32769", "lui $t0, 65535\nori $t0, $t0, 32767", -32769},
+		{-70000, "li $t0, -70000", "lui $t0, 65534\nori $t0, $t0, 61072", -70000},
+		{2147483647, "li $t0, 2147483647", "lui $t0, 32767\nori $t0, $t0, 65535", 2147483647},
+		{-2147483648, "li $t0, -2147483648", "lui $t0, 32768", -2147483648},
+	}
+
+	for _, tt := range tests {
+		for _, target := range []string{"mars", "bare"} {
+			t.Run(fmt.Sprintf("%s/%d", target, tt.value), func(t *testing.T) {
+				g := New(symbol.NewSymbolTable(nil))
+				g.Options.Target, _ = LookupTarget(target)
+				g.loadImmediate("$t0", tt.value)
+
+				want := tt.mars
+				if target == "bare" {
+					want = tt.bare
+				}
+				if got := normalizeWhitespace(strings.TrimSpace(g.output.String())); got != want {
+					t.Errorf("wrong instructions.\nexpected=%q\ngot=     %q", want, got)
+				}
+
+				m, err := emulator.Load("main:\n" + g.output.String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := m.Run(emulator.Config{}); err != nil {
+					t.Fatal(err)
+				}
+				if got := m.Register(8); got != tt.expected {
+					t.Errorf("$t0 = %d, expected %d", got, tt.expected)
+				}
+			})
+		}
+	}
+}
+
+func TestNegativeNumbers(t *testing.T) {
+	input := "x = -2147483648\nprint(x)\nz = 5 - 7\nprint(z)\nw = -z\nprint(w)\nif z > -5:\n\tprint(z)\nk = 3 * -70000\nprint(k)\nprint(-9)\n"
+	expected := "-2147483648\n-2\n2\n-2\n-210000\n-9\n"
+
+	for _, target := range TargetNames() {
+		t.Run(target, func(t *testing.T) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options.Target, _ = LookupTarget(target)
+			asm := g.Generate(program)
+
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != expected {
+				t.Errorf("output wrong. expected=%q, got=%q", expected, out.String())
+			}
+		})
+	}
+}
+
+func TestWordSize64(t *testing.T) {
+	input := "def add(a, b):\n\treturn a + b\n\nx = add(1, 2)\nprint(x)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.Target.WordSize = 64
+	got := g.Generate(program)
+
+	if frames := g.Frames(); len(frames) != 2 || frames[1].Size != 32 {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	for _, want := range []string{
+		"x: .dword 0",
+		"daddiu $sp, $sp, -32",
+		"sd $ra, 24($sp)",
+		"sd $fp, 16($sp)",
+		"daddiu $fp, $sp, 32",
+		"sd $a1, -32($fp)",
+		"ld $t0, -24($fp)",
+		"daddu $t2, $t0, $t1",
+		"ld $ra, -8($fp)",
+		"ld $fp, -16($sp)",
+		"sd $t0, x",
+		"dla $a0, newline",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	for _, narrow := range []string{" lw ", " sw ", " add ", ".word"} {
+		if strings.Contains(got, narrow) {
+			t.Errorf("64-bit output contains %q:\n%s", narrow, got)
+		}
+	}
+}
+
+func TestLoadImmediate64(t *testing.T) {
+	tests := []struct {
+		value int64
+		mars  string
+		bare  string
+	}{
+		{5, "li $t0, 5", "addiu $t0, $zero, 5"},
+		{-2147483648, "li $t0, -2147483648", "lui $t0, 32768"},
+		{2147483648, "dli $t0, 2147483648", "addiu $t0, $zero, 0\ndsll $t0, $t0, 16\nori $t0, $t0, 32768\ndsll $t0, $t0, 16"},
+		{4886718345, "dli $t0, 4886718345", "addiu $t0, $zero, 1\ndsll $t0, $t0, 16\nori $t0, $t0, 9029\ndsll $t0, $t0, 16\nori $t0, $t0, 26505"},
+		{-4294967296, "dli $t0, -4294967296", "addiu $t0, $zero, -1\ndsll $t0, $t0, 16\ndsll $t0, $t0, 16"},
+	}
+
+	for _, tt := range tests {
+		for _, target := range []string{"mars", "bare"} {
+			t.Run(fmt.Sprintf("%s/%d", target, tt.value), func(t *testing.T) {
+				g := New(symbol.NewSymbolTable(nil))
+				g.Options.Target, _ = LookupTarget(target)
+				g.Options.Target.WordSize = 64
+				g.loadImmediate("$t0", tt.value)
+
+				want := tt.mars
+				if target == "bare" {
+					want = tt.bare
+				}
+				if got := normalizeWhitespace(strings.TrimSpace(g.output.String())); got != want {
+					t.Errorf("wrong instructions.\nexpected=%q\ngot=     %q", want, got)
+				}
+			})
+		}
+	}
+}
+
+func TestSyscallTable(t *testing.T) {
+	table, err := ParseSyscalls("print_int=101, exit=93")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SyscallTable{PrintInt: 101, PrintString: 4, ReadInt: 5, ReadString: 8, Exit: 93, ExitCode: 17, PrintChar: 11, PrintFloat: 2, Sbrk: 9}
+	if got := table.Resolved(); got != want {
+		t.Errorf("wrong table. expected=%+v, got=%+v", want, got)
+	}
+
+	program := parser.New(lexer.New("x = 7\nprint(x)\nprint(\"hi\")\n")).ParseProgram()
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.Target.Syscalls = table
+	got := g.Generate(program)
+	for _, want := range []string{"li $v0, 101", "li $v0, 93", "li $v0, 4"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "li $v0, 1\n") || strings.Contains(got, "li $v0, 10\n") {
+		t.Errorf("default syscall number left in output:\n%s", got)
+	}
+
+	for _, spec := range []string{"print_double=3", "exit", "exit=x", "exit=0"} {
+		if _, err := ParseSyscalls(spec); err == nil {
+			t.Errorf("ParseSyscalls(%q) succeeded, expected an error", spec)
+		}
+	}
+}
+
+func TestSingleEpilogue(t *testing.T) {
+	input := "def sign(n):\n\tif n < 0:\n\t\treturn 0 - 1\n\twhile n > 1:\n\t\treturn 1\n\treturn n\n\ndef noop(n):\n\tprint(n)\n\nx = sign(5)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	got := New(symbol.NewSymbolTable(nil)).Generate(program)
+
+	if n := strings.Count(got, "jr $ra"); n != 2 {
+		t.Errorf("expected one epilogue per function, got %d:\n%s", n, got)
+	}
+	if n := strings.Count(got, "    j func_exit_"); n != 2 {
+		t.Errorf("expected the two early returns to jump to the exit, got %d:\n%s", n, got)
+	}
+	if !strings.Contains(got, "move $v0, $t0\nfunc_exit_") {
+		t.Errorf("final return should fall through to the exit:\n%s", got)
+	}
+}
+
+func TestDiscardedCall(t *testing.T) {
+	program := parser.New(lexer.New("def f(a):\n\treturn a\n\nf(1)\nx = f(2)\n")).ParseProgram()
+	program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionCall).Discarded = true
+	got := New(symbol.NewSymbolTable(nil)).Generate(program)
+
+	if n := strings.Count(got, ", $v0\n"); n != 1 {
+		t.Errorf("expected only the used result to be moved out of $v0, got %d:\n%s", n, got)
+	}
+}
+
+func TestStringIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		operator string
+		literal  string
+		expected string
+	}{
+		{"equal contents share a label", `"hi"`, "==", "hi", "same\n1\n"},
+		{"different contents", `"hi"`, "==", "ho", "different\n0\n"},
+		{"not equal", `"hi"`, "!=", "ho", "same\n1\n"},
+		{"built string equal by contents", `"h" + "i"`, "==", "hi", "same\n1\n"},
+		{"built string not equal", `"h" + "i"`, "!=", "hi", "different\n0\n"},
+		{"built string differs", `"h" + "o"`, "==", "hi", "different\n0\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := "s = " + tt.value + "\nif s " + tt.operator + " \"" + tt.literal + "\":\n\tprint(\"same\")\nelse:\n\tprint(\"different\")\nprint(s " + tt.operator + " \"" + tt.literal + "\")\n"
+			program := parser.New(lexer.New(input)).ParseProgram()
+			asm := New(symbol.NewSymbolTable(nil)).Generate(program)
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+}
+
+func TestStorageSizes(t *testing.T) {
+	input := "c: uint8 = 250\nc = c + 10\nprint(c)\nb: int8 = 127\nb = b + 1\nprint(b)\nh: int16 = -300\nprint(h)\nw: uint16 = 65535\nprint(w)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	got := New(symbol.NewSymbolTable(nil)).Generate(program)
+
+	for _, want := range []string{"c: .byte 0", "b: .byte 0", "h: .half 0", "w: .half 0",
+		"lbu $t", "lb $t", "lh $t", "lhu $t", "sb $t", "sh $t"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(got, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, got)
+	}
+	if want := "4\n-128\n-300\n65535\n"; out.String() != want {
+		t.Errorf("wrong output. expected=%q, got=%q", want, out.String())
+	}
+}
+
+func TestEndianHeader(t *testing.T) {
+	input := "c: uint8 = 250\nh: int16 = -300\nx = c + h\nprint(x)\n"
+	for _, endian := range []Endianness{EndianUnstated, LittleEndian, BigEndian} {
+		t.Run(endian.String(), func(t *testing.T) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options.Target.Endian = endian
+			got := g.Generate(program)
+
+			header := "# endian: " + endian.String() + "\n.data\n"
+			if endian == EndianUnstated {
+				header = ".data\n"
+			}
+			if !strings.HasPrefix(got, header) {
+				t.Errorf("output should start with %q:\n%s", header, got)
+			}
+			var out strings.Builder
+			if _, err := emulator.Run(got, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, got)
+			}
+			if out.String() != "-50\n" {
+				t.Errorf("wrong output. expected=%q, got=%q", "-50\n", out.String())
+			}
+		})
+	}
+
+	for name, want := range map[string]Endianness{"big": BigEndian, "little": LittleEndian} {
+		if got, err := ParseEndianness(name); err != nil || got != want {
+			t.Errorf("ParseEndianness(%q) = %v, %v", name, got, err)
+		}
+	}
+	if _, err := ParseEndianness("middle"); err == nil {
+		t.Errorf("ParseEndianness accepted middle")
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	input := "def f(a):\n\treturn a + 1\n\nx = f(2)\nprint(x)\n"
+	for _, layout := range []string{
+		"# header\n{{data}}\n# code\n{{text}}# footer\n",
+		"{{text}}\n.data\nextra: .word 7\n{{data}}",
+	} {
+		t.Run(layout, func(t *testing.T) {
+			tmpl, err := ParseTemplate(layout)
+			if err != nil {
+				t.Fatalf("ParseTemplate failed: %v", err)
+			}
+			plain := New(symbol.NewSymbolTable(nil))
+			want := plain.Generate(parser.New(lexer.New(input)).ParseProgram())
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options.Template = tmpl
+			got := g.Generate(parser.New(lexer.New(input)).ParseProgram())
+
+			data, text, _ := strings.Cut(want, ".text\n")
+			expected := strings.NewReplacer("{{data}}", data, "{{text}}", ".text\n"+text).Replace(layout)
+			if got != expected {
+				t.Errorf("wrong output.\nexpected=%q\ngot=     %q", expected, got)
+			}
+			for i, f := range g.FunctionTexts() {
+				w := plain.FunctionTexts()[i]
+				if got[f.Start:f.End] != want[w.Start:w.End] {
+					t.Errorf("function %s moved to %q", f.Name, got[f.Start:f.End])
+				}
+			}
+			for i, m := range g.SourceMap() {
+				w := plain.SourceMap()[i]
+				if !strings.HasPrefix(got[m.Offset:], want[w.Offset:min(len(want), w.Offset+20)]) {
+					t.Errorf("line %d moved to %q", m.Line, got[m.Offset:])
+				}
+			}
+			var out strings.Builder
+			if _, err := emulator.Run(got, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, got)
+			}
+			if out.String() != "3\n" {
+				t.Errorf("wrong output. expected=%q, got=%q", "3\n", out.String())
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "{{data}}", "{{data}}{{text}}{{data}}", "{{data}}{{text}}{{name}}", "{{data}}{{text}}{{"} {
+		if _, err := ParseTemplate(bad); err == nil {
+			t.Errorf("ParseTemplate(%q) accepted", bad)
+		}
+	}
+}
+
+// failingWriter accepts limit bytes, then fails every write
+type failingWriter struct {
+	limit   int
+	written int
+}
+
+var errWriteFailed = errors.New("disk full")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.limit {
+		n := w.limit - w.written
+		w.written = w.limit
+		return n, errWriteFailed
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+// chunkWriter records the size of each write it is given
+type chunkWriter struct {
+	strings.Builder
+	writes []int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.Builder.Write(p)
+}
+
+func TestGenerateTo(t *testing.T) {
+	// Enough code to take several of GenerateTo's buffers
+	var input strings.Builder
+	input.WriteString("def f(a):\n\treturn a * 2\n\n")
+	for i := 0; i < 400; i++ {
+		fmt.Fprintf(&input, "print(\"line %d\")\nprint(f(%d) / 3.0)\n", i, i)
+	}
+	program := func() ast.Node { return parser.New(lexer.New(input.String())).ParseProgram() }
+
+	dataFirst, err := ParseTemplate("# header\n{{data}}\n# code\n{{text}}# footer\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	textFirst, err := ParseTemplate("# header\n{{text}}\n{{data}}# footer\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		opts func() Options
+	}{
+		{"plain", func() Options { return Options{} }},
+		{"data first", func() Options { return Options{Template: dataFirst} }},
+		{"text first", func() Options { return Options{Template: textFirst} }},
+		{"checked", func() Options { return Options{Checked: true, FrameTrailer: true} }},
+		{"shared names", func() Options { return Options{Names: gensym.New(100)} }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := New(symbol.NewSymbolTable(nil))
+			plain.Options = tt.opts()
+			want := plain.Generate(program())
+			if len(want) < 4*outputBuffer {
+				t.Fatalf("program too small to test buffering: %d bytes", len(want))
+			}
+
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options = tt.opts()
+			var out chunkWriter
+			if err := g.GenerateTo(&out, program()); err != nil {
+				t.Fatalf("GenerateTo failed: %v", err)
+			}
+			if out.String() != want {
+				t.Errorf("GenerateTo wrote %d bytes differing from Generate's %d", out.Len(), len(want))
+			}
+			if !slices.Equal(g.SourceMap(), plain.SourceMap()) || !slices.Equal(g.FunctionTexts(), plain.FunctionTexts()) {
+				t.Errorf("GenerateTo's offsets differ from Generate's")
+			}
+			if plain.Options.Names != nil && g.Options.Names.Last() != plain.Options.Names.Last() {
+				t.Errorf("GenerateTo left the names at %d, Generate at %d", g.Options.Names.Last(), plain.Options.Names.Last())
+			}
+			if len(out.writes) < 4 || slices.Max(out.writes) > len(want)/2 {
+				t.Errorf("assembly not streamed: writes of %v bytes", out.writes)
+			}
+		})
+	}
+
+	want := New(symbol.NewSymbolTable(nil)).Generate(program())
+	for _, limit := range []int{0, 100, outputBuffer + 1, len(want) - 1} {
+		w := &failingWriter{limit: limit}
+		if err := New(symbol.NewSymbolTable(nil)).GenerateTo(w, program()); err != errWriteFailed {
+			t.Errorf("limit %d: expected %v, got %v", limit, errWriteFailed, err)
+		}
+	}
+}
+
+func TestUnusedData(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		data    []string
+		missing []string
+	}{
+		{
+			name:    "no print",
+			input:   "x = 1.5\ny = 2\n",
+			data:    []string{"flt_0: .float 1.5"},
+			missing: []string{"newline:"},
+		},
+		{
+			name:  "print",
+			input: "print(\"hi\")\n",
+			data:  []string{"newline: .asciiz", "str_0: .asciiz \"hi\""},
+		},
+		{
+			name:    "dictionary without lookups",
+			input:   "d = {1: 2}\n",
+			missing: []string{"newline:", "key not found"},
+		},
+		{
+			name:    "strings of a comparison decided at compile time",
+			input:   "if \"a\" == \"b\":\n\tprint(\"c\")\n",
+			data:    []string{"str_2: .asciiz \"c\""},
+			missing: []string{"\"a\"", "\"b\""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parser.New(lexer.New(tt.input)).ParseProgram()
+			got := New(symbol.NewSymbolTable(nil)).Generate(program)
+			data, _, _ := strings.Cut(got, ".text\n")
+			for _, want := range tt.data {
+				if !strings.Contains(data, want) {
+					t.Errorf("data section should hold %q:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.missing {
+				if strings.Contains(data, unwanted) {
+					t.Errorf("data section should not hold %q:\n%s", unwanted, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMacros(t *testing.T) {
+	prelude := "# course macros\n.macro print_int (%x)\n\tli $v0, 1\n\tmove $a0, %x\n\tsyscall\n.end_macro\n" +
+		".macro print_str(%label)\n\tli $v0, 4\n\tla $a0, %label\n\tsyscall\n.end_macro\n"
+	macros, err := ParseMacros(prelude)
+	if err != nil {
+		t.Fatalf("ParseMacros failed: %v", err)
+	}
+	if !macros.Defines("print_int") || !macros.Defines("print_str") || macros.Defines("exit") {
+		t.Errorf("wrong macros defined: %+v", macros)
+	}
+
+	input := "x = 2\nprint(x)\nprint(\"hi\")\ns = \"a\" + \"b\"\nprint(s)\n"
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.Macros = macros
+	got := g.Generate(parser.New(lexer.New(input)).ParseProgram())
+	if !strings.HasPrefix(got, prelude+"\n.data\n") {
+		t.Errorf("output should open with the prelude:\n%s", got)
+	}
+	if want := "    lw $t0, x\n    print_int($t0)\n    print_str(newline)\n    print_str(str_0)\n    print_str(newline)\n"; !strings.Contains(got, want) {
+		t.Errorf("prints should call the macros:\n%s", got)
+	}
+	// A string in a register has no macro, nor does exit in this prelude
+	if !strings.Contains(got, "    move $a0, $t0\n    li $v0, 4\n    syscall\n") {
+		t.Errorf("a computed string should be printed with a syscall:\n%s", got)
+	}
+	if !strings.Contains(got, "    li $v0, 10\n    syscall\n") {
+		t.Errorf("exit should be a syscall:\n%s", got)
+	}
+
+	for _, bad := range []string{"", "# nothing\n", ".macro print_int\n.end_macro\n", ".macro exit(%code)\n.end_macro\n", ".macro\n"} {
+		if _, err := ParseMacros(bad); err == nil {
+			t.Errorf("ParseMacros(%q) accepted", bad)
+		}
+	}
+}
+
+func TestCheckedFrames(t *testing.T) {
+	input := "def add(a, b):\n\treturn a + b\n\nx = add(1, 2)\nprint(x)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.Checked = true
+	g.Options.FrameTrailer = true
+	got := g.Generate(program)
+
+	if frames := g.Frames(); len(frames) != 2 || frames[1].Size != 24 {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	for _, want := range []string{
+		"li $t0, -559038737\n    sw $t0, -20($fp)\n",
+		"lw $t0, -20($fp)\n    li $t1, -559038737\n    bne $t0, $t1, cold_",
+		"stack frame of 'add' was overwritten",
+		"-20($fp)  (canary) sentinel checked before returning",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q:\n%s", want, got)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		asm      string
+		expected string
+	}{
+		{"intact", got, "3\n"},
+		{"overwritten", strings.Replace(got, "sw $t0, -20($fp)", "sw $zero, -20($fp)", 1), "stack frame of 'add' was overwritten\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if _, err := emulator.Run(tt.asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, tt.asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestCheckedGlobals(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		data     string
+		expected string
+	}{
+		{"assigned first", "x = 4\nprint(x)\n", "x: .word -559038737\n", "4\n"},
+		{"read first", "y = x + 1\nx = 2\nprint(y)\n", "x: .word -559038737\n", "'x' was read before it was assigned\n"},
+		{"narrow storage is not poisoned", "c: uint8 = 7\nprint(c)\n", "c: .byte 0\n", "7\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parser.New(lexer.New(tt.input)).ParseProgram()
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options.Checked = true
+			asm := g.Generate(program)
+			if !strings.Contains(asm, tt.data) {
+				t.Errorf("data section missing %q:\n%s", tt.data, asm)
+			}
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestRecursionDepth(t *testing.T) {
+	input := "def f(n):\n\tif n == 0:\n\t\treturn 0\n\tr = f(n - 1)\n\treturn r + 1\n\nx = f(3)\nprint(x)\ny = f(3)\nprint(y)\n"
+	tests := []struct {
+		name     string
+		maxDepth int
+		expected string
+	}{
+		{"default", 0, "3\n3\n"},
+		{"deep enough", 4, "3\n3\n"},
+		{"too deep", 3, "maximum recursion depth exceeded\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options.Checked = true
+			g.Options.MaxDepth = tt.maxDepth
+			asm := g.Generate(program)
+			if !strings.Contains(asm, "rt_depth: .word 0\n") {
+				t.Errorf("data section missing the depth counter:\n%s", asm)
+			}
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+}
+
+func TestMaxIterations(t *testing.T) {
+	input := "x = 0\nwhile x < 10:\n\tx += 1\nprint(x)\ndef spin(n):\n\twhile n > 0:\n\t\tn += 1\n\treturn n\n\ny = spin(x)\nprint(y)\n"
+	tests := []struct {
+		name          string
+		maxIterations int
+		expected      string
+	}{
+		{"counted across loops", 50, "10\nloop iteration limit exceeded\n"},
+		{"first loop over the bound", 9, "loop iteration limit exceeded\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options.MaxIterations = tt.maxIterations
+			asm := g.Generate(desugar.Program(program))
+			if !strings.Contains(asm, "rt_iterations: .word 0\n") {
+				t.Errorf("data section missing the iteration counter:\n%s", asm)
+			}
+			var out strings.Builder
+			res, err := emulator.Run(asm, emulator.Config{Stdout: &out})
+			if err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+			if res.ExitCode != 1 {
+				t.Errorf("wrong exit status. expected=1, got=%d", res.ExitCode)
+			}
+		})
+	}
+
+	// Without a bound nothing is counted
+	asm := New(symbol.NewSymbolTable(nil)).Generate(desugar.Program(parser.New(lexer.New(input)).ParseProgram()))
+	if strings.Contains(asm, "rt_iterations") {
+		t.Errorf("loops counted without a bound:\n%s", asm)
+	}
+}
+
+func TestDivision(t *testing.T) {
+	input := "a = 7\nn = -7\nb = 2\nm = -2\nq = a / b\nprint(q)\nq = n / b\nprint(q)\nq = a / m\nprint(q)\nq = n / m\nprint(q)\n" +
+		"r = a % b\nprint(r)\nr = n % b\nprint(r)\nr = a % m\nprint(r)\nr = n % m\nprint(r)\nz = 0\nq = a / z\nprint(7)\n"
+	tests := []struct {
+		name     string
+		checked  bool
+		expected string
+	}{
+		{"unchecked", false, "3\n-4\n-4\n3\n1\n1\n-1\n-1\n7\n"},
+		{"checked", true, "3\n-4\n-4\n3\n1\n1\n-1\n-1\ndivision by zero\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parser.New(lexer.New(input)).ParseProgram()
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options.Checked = tt.checked
+			asm := g.Generate(program)
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+}
+
+func TestPower(t *testing.T) {
+	input := "b = 3\ne = 4\np = b ** e\nprint(p)\nn = -2\np = n ** 3\nprint(p)\ne = 0\np = b ** e\nprint(p)\ne = -1\np = b ** e\nprint(p)\n" +
+		"q = 7 // 2\nprint(q)\nq = -7 // 2\nprint(q)\nz = 0\nq = 7 // z\nprint(9)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.Checked = true
+	asm := g.Generate(program)
+	var out strings.Builder
+	if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, asm)
+	}
+	if want := "81\n-8\n1\n0\n3\n-4\ndivision by zero\n"; out.String() != want {
+		t.Errorf("wrong output. expected=%q, got=%q\n%s", want, out.String(), asm)
+	}
+}
+
+func TestPrintLiterals(t *testing.T) {
+	input := "def greet(n):\n\tprint(\"hi\")\n\twhile n > 0:\n\t\tif n == 2:\n\t\t\tprint(\"two\")\n\t\telse:\n\t\t\ts = \"other\"\n\t\t\tprint(s)\n\t\tn = n - 1\n\treturn n\n\n" +
+		"x = greet(2)\nif x == 0:\n\tprint(\"hi\")\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	asm := New(symbol.NewSymbolTable(nil)).Generate(program)
+	var out strings.Builder
+	if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, asm)
+	}
+	if want := "hi\ntwo\nother\nhi\n"; out.String() != want {
+		t.Errorf("wrong output. expected=%q, got=%q\n%s", want, out.String(), asm)
+	}
+	if n := strings.Count(asm, `.asciiz "hi"`); n != 1 {
+		t.Errorf("expected \"hi\" in .data once, got %d:\n%s", n, asm)
+	}
+}
+
+func TestConcat(t *testing.T) {
+	input := "def second(a, b):\n\treturn b\n\nname = \"bob\"\nmsg = \"hi \" + name\nprint(msg)\nmsg = msg + \"!\"\nx = second(\"<\" + msg + \">\", 3)\nprint(x)\nwrapped = \"<\" + msg + \">\"\nprint(wrapped)\nprint(name + name)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	asm := New(symbol.NewSymbolTable(nil)).Generate(program)
+	var out strings.Builder
+	if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, asm)
+	}
+	if want := "hi bob\n3\n<hi bob!>\nbobbob\n"; out.String() != want {
+		t.Errorf("wrong output. expected=%q, got=%q\n%s", want, out.String(), asm)
+	}
+	if n := strings.Count(asm, concatLabel+":"); n != 1 {
+		t.Errorf("expected the routine once, got %d", n)
+	}
+
+	asm = New(symbol.NewSymbolTable(nil)).Generate(parser.New(lexer.New("x = 1 + 2\nprint(x)\n")).ParseProgram())
+	if strings.Contains(asm, concatLabel) {
+		t.Errorf("routine emitted for a program without concatenation:\n%s", asm)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"integer", "n = 42\nprint(\"%d items\" % n)\n", "42 items\n"},
+		{"negative", "print(format(-305))\n", "-305\n"},
+		{"most negative", "print(format(-2147483648))\n", "-2147483648\n"},
+		{"zero", "print(\"[%i]\" % 0)\n", "[0]\n"},
+		{"right-aligned", "print(\"[%5d]\" % 42)\n", "[   42]\n"},
+		{"left-aligned", "print(\"[%-5d]\" % 42)\n", "[42   ]\n"},
+		{"narrower than the value", "print(format(12345, 2))\n", "12345\n"},
+		{"string", "s = \"ab\"\nprint(\"<%4s>\" % s)\nprint(format(s, -4) + \"|\")\n", "<  ab>\nab  |\n"},
+		{"width at run time", "w = 3\ns = format(7, w + 1)\nprint(s + \"|\")\n", "   7|\n"},
+		{"call", "def sq(x):\n\treturn x * x\n\nprint(\"%d%%\" % sq(9))\n", "81%\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parser.New(lexer.New(tt.input)).ParseProgram()
+			asm := New(symbol.NewSymbolTable(nil)).Generate(desugar.Program(program))
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+
+	asm := New(symbol.NewSymbolTable(nil)).Generate(parser.New(lexer.New("print(format(\"a\"))\n")).ParseProgram())
+	if strings.Contains(asm, intToStrLabel) || strings.Contains(asm, padLabel) {
+		t.Errorf("routines emitted for a string without a width:\n%s", asm)
+	}
+}
+
+func TestCallTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"float argument and result", "def half(x):\n\treturn x / 2.0\n\nprint(half(3.0))\nprint(half(3))\ny = half(5.0) + 1\nprint(y)\n", "1.5\n1.5\n3.5\n"},
+		{"parameter assigned a float", "def f(x):\n\tx = x / 2.0\n\treturn x\n\nprint(f(3))\n", "1.5\n"},
+		{"recursive float result", "def fact(n):\n\tif n <= 1:\n\t\treturn 1.0\n\treturn n * fact(n - 1)\n\nprint(fact(5))\n", "120.0\n"},
+		{"string result", "def name():\n\treturn \"bob\"\n\nprint(name())\nprint(f\"{name()}!\")\ns = name() + \"?\"\nprint(s)\n", "bob\nbob!\nbob?\n"},
+		{"string argument", "def greet(who):\n\treturn \"hi \" + who\n\ndef show(s):\n\tprint(s)\n\nprint(greet(\"ann\"))\nshow(\"x\")\n", "hi ann\nx\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parser.New(lexer.New(tt.input)).ParseProgram()
+			asm := New(symbol.NewSymbolTable(nil)).Generate(desugar.Program(program))
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+}
+
+func TestDict(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "lookups",
+			input:    "d = {\"a\": 1, \"b\": 2 + 3, \"a\": 9}\nx = d[\"b\"] * 2\nprint(x)\nprint(d[\"a\"])\n",
+			expected: "10\n9\n",
+		},
+		{
+			name:     "string values and integer keys",
+			input:    "names = {1: \"one\", 2: \"two\"}\ni = 2\nprint(names[i])\n",
+			expected: "two\n",
+		},
+		{
+			name:     "built key matches by contents",
+			input:    "k = \"tw\" + \"o\"\nw = {\"two\": 22}\nprint(w[k])\n",
+			expected: "22\n",
+		},
+		{
+			name:     "through functions",
+			input:    "def sq(n):\n\treturn n * n\n\ndef get(t, k):\n\treturn t[k]\n\nd = {\"x\": sq(3), \"y\": sq(4)}\ny = get(d, \"y\")\nprint(y)\nprint(d[\"x\"])\n",
+			expected: "16\n9\n",
+		},
+		{
+			name:     "missing key",
+			input:    "d = {}\nprint(1)\nprint(d[3])\nprint(2)\n",
+			expected: "1\nkey not found\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			asm := New(symbol.NewSymbolTable(nil)).Generate(program)
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+
+	asm := New(symbol.NewSymbolTable(nil)).Generate(parser.New(lexer.New("x = 1\nprint(x)\n")).ParseProgram())
+	if strings.Contains(asm, dictGetLabel) || strings.Contains(asm, allocLabel) {
+		t.Errorf("routines emitted for a program without dictionaries:\n%s", asm)
+	}
+}
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		checked  bool
+		expected string
+	}{
+		{
+			name:     "print and index",
+			input:    "xs = [4, 2 + 3, -1]\nprint(xs)\nprint(xs[1] * 2)\nprint(xs[-1])\nprint(len(xs))\nprint([])\n",
+			expected: "[4, 5, -1]\n10\n-1\n3\n[]\n",
+		},
+		{
+			name:     "sorted and reversed copy",
+			input:    "xs = [5, 3, -8, 1, 9, 3]\nys = sorted(xs)\nprint(ys)\nprint(reversed(xs))\nprint(xs)\nprint(sorted(xs)[-1] + [7, 8][1])\n",
+			expected: "[-8, 1, 3, 3, 5, 9]\n[3, 9, 1, -8, 3, 5]\n[5, 3, -8, 1, 9, 3]\n17\n",
+		},
+		{
+			name:     "methods change the list",
+			input:    "xs = [2, 7, 1]\nxs.sort()\nprint(xs)\nxs.reverse()\nprint(xs)\nprint(xs.sort())\n",
+			expected: "[1, 2, 7]\n[7, 2, 1]\nNone\n",
+		},
+		{
+			name:     "strings sort by contents",
+			input:    "w = [\"pear\", \"app\" + \"le\", \"fig\", \"app\"]\nw.sort()\nprint(w)\nprint(w[1] + \"!\")\n",
+			expected: "['app', 'apple', 'fig', 'pear']\napple!\n",
+		},
+		{
+			name:     "through functions",
+			input:    "def total(a):\n\ts = 0\n\tfor i in range(len(a)):\n\t\ts = s + a[i]\n\treturn s\n\ndef firsts(a):\n\treturn sorted(a)\n\nxs = [3, 1, 2]\nprint(total(xs))\nys = firsts(xs)\nprint(ys[0])\n",
+			expected: "6\n1\n",
+		},
+		{
+			name:     "sum, min and max",
+			input:    "xs = [5, -3, 8, 1]\nprint(sum(xs))\nprint(min(xs))\nprint(max(xs))\nprint(sum([]))\nprint(max([7]) + min(sorted(xs)) * sum(reversed(xs)))\n",
+			expected: "11\n-3\n8\n0\n-26\n",
+		},
+		{
+			name:     "max of an empty list",
+			input:    "xs = []\nprint(max(xs))\nprint(1)\n",
+			expected: "max() of an empty list\n",
+		},
+		{
+			name:     "list of lists",
+			input:    "g = [[1, 2], [3, 4, 5]]\nprint(g)\nprint(g[1][2] + g[0][0])\nprint(len(g[1]))\nrow = g[0]\nprint(row[-1])\nprint([[\"a\"], []])\n",
+			expected: "[[1, 2], [3, 4, 5]]\n6\n3\n2\n[['a'], []]\n",
+		},
+		{
+			name:     "assignment to elements",
+			input:    "xs = [1, 2, 3]\nxs[0] = xs[2] * 5\nxs[-1] += 7\nprint(xs)\ng = [[0, 0], [0, 0]]\nfor i in range(2):\n\tfor j in range(2):\n\t\tg[i][j] = i * 10 + j\ng[1] = [9]\nprint(g)\n",
+			expected: "[15, 2, 10]\n[[0, 1], [9]]\n",
+		},
+		{
+			name:     "zeros",
+			input:    "g = zeros(2, 3)\ng[1][2] = 5\ng[0][0] += 4\nprint(g)\nprint(zeros(0, 2))\nprint(zeros(2, -1))\nh = zeros(1, 1)\nh[0][0] = 9\nprint(g[0][0] + h[0][0])\n",
+			expected: "[[4, 0, 0], [0, 0, 5]]\n[]\n[[], []]\n13\n",
+		},
+		{
+			name:     "rows through functions",
+			input:    "def total(m):\n\tt = 0\n\tfor i in range(len(m)):\n\t\tfor j in range(len(m[i])):\n\t\t\tt = t + m[i][j]\n\treturn t\n\nprint(total([[1, 2], [3]]))\n",
+			expected: "6\n",
+		},
+		{
+			name:     "checked index past the end of a row",
+			input:    "g = [[1, 2], [3]]\ng[1][0] = 4\nprint(g[1][0])\ng[1][1] = 5\nprint(g)\n",
+			checked:  true,
+			expected: "4\nlist index out of range\n",
+		},
+		{
+			name:     "checked index past the end",
+			input:    "xs = [1, 2]\ni = 2\nprint(xs[i - 2])\nprint(xs[i])\n",
+			checked:  true,
+			expected: "1\nlist index out of range\n",
+		},
+		{
+			name:     "checked negative index",
+			input:    "xs = [1, 2]\ni = -1\nprint(xs[i])\n",
+			checked:  true,
+			expected: "list index out of range\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			g := New(symbol.NewSymbolTable(nil))
+			g.Options.Checked = tt.checked
+			asm := g.Generate(desugar.Program(program))
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+
+	asm := New(symbol.NewSymbolTable(nil)).Generate(parser.New(lexer.New("xs = [1]\nprint(len(xs))\n")).ParseProgram())
+	for _, label := range []string{listCopyLabel, sortLabel, reverseLabel, printListLabel, sumLabel, minLabel, maxLabel} {
+		if strings.Contains(asm, label) {
+			t.Errorf("%s emitted for a program that does not use it:\n%s", label, asm)
+		}
+	}
+}
+
+func TestNestedExpressions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"grouping on both sides", "a = 2\nb = 3\nc = 4\nd = 5\nprint((a + b) * (c + d))\nprint(((((a + b) * (c + d)) - ((a - b) * (c - d))) ** 2) // (a + (b * (c + (d * (a + b))))))\n", "45\n21\n"},
+		{"right-nested past the temporaries", "a = 2\nx = (2 + (3 + (4 + (5 + (6 + (7 + (8 + (9 + (10 + (11 + (12 + (13 + (14 + (15 + a))))))))))))))\nprint(x)\n", "121\n"},
+		{"calls inside groups", "def f(n):\n\treturn n + 1\n\ndef g(n, m):\n\treturn n * m\n\na = 2\nb = 3\nprint(f(g(f(f(1)) + 2, (f(3) + g(2, f(4))) * (a - f(b)))))\n", "-139\n"},
+		{"parenthesized call statement", "def f(n):\n\tprint(n)\n\treturn n\n\n(f(1))\n((f((2))))\n", "1\n2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			asm := New(symbol.NewSymbolTable(nil)).Generate(program)
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+}
+
+func TestTupleRegisters(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		storage  bool // the temporaries keep their .data words
+	}{
+		{
+			name:     "swap",
+			input:    "a, b = 1, 2\na, b = b, a\nprint(a)\nprint(b)\n",
+			expected: "2\n1\n",
+		},
+		{
+			name:     "values calling functions",
+			input:    "def inc(n):\n\treturn n + 1\n\nx, y = 3, 4\nx, y = inc(y), inc(x)\nprint(x)\nprint(y)\n",
+			expected: "5\n4\n",
+		},
+		{
+			name:     "in a loop inside a function",
+			input:    "def fib(n):\n\ta, b = 0, 1\n\ti = 0\n\twhile i < n:\n\t\ta, b = b, a + b\n\t\ti = i + 1\n\treturn a\n\nv = fib(10)\nprint(v)\n",
+			expected: "55\n",
+		},
+		{
+			name:     "strings",
+			input:    "s, t = \"l\", \"r\"\ns, t = t, s\nprint(s)\n",
+			expected: "r\n",
+		},
+		{
+			name:     "floats stay in memory",
+			input:    "f, g = 1.5, 2.5\nf, g = g, f\nprint(f)\n",
+			expected: "2.5\n",
+			storage:  true,
+		},
+		{
+			name:     "too many values stay in memory",
+			input:    "p, q, r, u, v, w, z = 1, 2, 3, 4, 5, 6, 7\np, q, r, u, v, w, z = z, w, v, u, r, q, p\nprint(p)\nprint(z)\n",
+			expected: "7\n1\n",
+			storage:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			asm := New(symbol.NewSymbolTable(nil)).Generate(desugar.Program(program))
+			if got := strings.Contains(asm, "x__28_"); got != tt.storage {
+				t.Errorf("temporaries in .data: expected %v, got %v\n%s", tt.storage, got, asm)
+			}
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+}
+
+func TestBranchLayout(t *testing.T) {
+	for _, hint := range []string{"", "  # pragma: likely", "  # pragma: unlikely"} {
+		input := fmt.Sprintf("x = 3\ny = 1.5\nif x > 2:%[1]s\n\tprint(1)\nelse:\n\tprint(2)\nif x < 2 or not y > 1.0:%[1]s\n\tprint(3)\n"+
+			"if y and x != 5:%[1]s\n\tprint(4)\ni = 0\nwhile i < 3 and x:\n\ti = i + 1\nprint(i)\n", hint)
+		program := parser.New(lexer.New(input)).ParseProgram()
+		asm := New(symbol.NewSymbolTable(nil)).Generate(program)
+		var out strings.Builder
+		if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+			t.Fatalf("run failed: %v\n%s", err, asm)
+		}
+		if want := "1\n4\n3\n"; out.String() != want {
+			t.Errorf("%q: wrong output. expected=%q, got=%q\n%s", hint, want, out.String(), asm)
+		}
+
+		// The expected branch is the first label after the condition, which
+		// falls into it without a jump
+		want := "if_true_1:"
+		if strings.Contains(hint, "unlikely") {
+			want = "if_false_2:"
+		}
+		lines := strings.Split(asm, "\n")
+		for _, line := range lines[slices.Index(lines, "main:")+1:] {
+			if strings.HasPrefix(line, "    j ") {
+				t.Errorf("%q: condition jumps instead of falling through:\n%s", hint, asm)
+			}
+			if strings.HasSuffix(line, ":") {
+				if line != want {
+					t.Errorf("%q: expected %s after the condition, got %s:\n%s", hint, want, line, asm)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestNone(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "literal",
+			input:    "x = None\nprint(x)\nprint(None)\n",
+			expected: "None\nNone\n",
+		},
+		{
+			name:     "void function result",
+			input:    "def show(v):\n\tprint(v)\n\treturn\n\nr = show(4)\nprint(r)\nif r == None:\n\tprint(1)\n",
+			expected: "4\nNone\n1\n",
+		},
+		{
+			name:     "bare return from a function with a value",
+			input:    "def pick(v):\n\tif v > 1:\n\t\treturn v\n\treturn\n\na = pick(3)\nb = pick(0)\nprint(a)\nprint(b)\n",
+			expected: "3\n0\n",
+		},
+		{
+			name:     "reassigned from None",
+			input:    "x = None\nx = 2\nprint(x)\n",
+			expected: "2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			asm := New(symbol.NewSymbolTable(nil)).Generate(program)
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "integers and strings",
+			input:    "x = 3\nname = \"bob\"\nprint(f\"{name} has {x * 2 + 1} {{items}}\")\n",
+			expected: "bob has 7 {items}\n",
+		},
+		{
+			name:     "floats, None and lookups",
+			input:    "f = 1.5\nd = {\"a\": \"apple\"}\nk = \"a\"\nprint(f\"{f}/{None}/{d[k]}\")\n",
+			expected: "1.5/None/apple\n",
+		},
+		{
+			name:     "inside a function",
+			input:    "def show(n):\n\tprint(f\"n={n}\")\n\treturn n\n\nv = show(4)\n",
+			expected: "n=4\n",
+		},
+		{
+			name:     "escapes",
+			input:    "n = 2\nprint(f\"a\\t{n}\\n\\\"b\\\"\\\\\")\n",
+			expected: "a\t2\n\"b\"\\\n",
+		},
+		{
+			name:     "empty",
+			input:    "print(f\"\")\n",
+			expected: "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			asm := New(symbol.NewSymbolTable(nil)).Generate(program)
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+}
+
+func TestComparisonChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "names and literals",
+			input:    "x = 5\nprint(0 < x < 10)\nprint(0 < x < 3)\nprint(1 < x == 5 != 4)\n",
+			expected: "1\n0\n1\n",
+		},
+		{
+			name:     "conditions",
+			input:    "x = 5\nif 1 <= x <= 5:\n\tprint(\"in\")\nif 1 <= x < 5:\n\tprint(\"out\")\nwhile 0 <= x < 7:\n\tx += 1\nprint(x)\n",
+			expected: "in\n7\n",
+		},
+		{
+			name:     "middle evaluated once",
+			input:    "x = 5\nd = {1: 7}\nprint(0 < x * 3 < 10)\nprint(6 < d[1] < 8)\nprint(6 < d[1] < 7)\n",
+			expected: "0\n1\n0\n",
+		},
+		{
+			name:     "stops at the first failing pair",
+			input:    "d = {1: 7}\nprint(9 < d[1] < d[2])\n",
+			expected: "0\n",
+		},
+		{
+			name:     "floats",
+			input:    "z = 1.5\nprint(1 < z < 2)\nprint(2 < z < 3)\nprint(1 < z * 2 < 4)\n",
+			expected: "1\n0\n1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			asm := New(symbol.NewSymbolTable(nil)).Generate(desugar.Program(program))
+			var out strings.Builder
+			if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, asm)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("wrong output. expected=%q, got=%q\n%s", tt.expected, out.String(), asm)
+			}
+		})
+	}
+}
+
+func TestColdBlocks(t *testing.T) {
+	input := "def share(a, b):\n\tc = a // b\n\treturn c % b\n\nx = share(7, 2)\nprint(x)\ny = share(7, 0)\nprint(y)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.Checked = true
+	asm := g.Generate(program)
+
+	// Both divisions branch to one block, and the call depth check to
+	// another, placed after the function returns
+	body := asm[strings.Index(asm, "\nshare:"):]
+	if n := strings.Count(body, ", $zero, cold_"); n != 3 {
+		t.Errorf("expected 3 checks branching out of line, got %d:\n%s", n, asm)
+	}
+	exit := strings.Index(body, "jr $ra")
+	if cold := strings.Index(body, "\ncold_"); cold < exit {
+		t.Errorf("cold block is not after the epilogue:\n%s", asm)
+	}
+
+	var out strings.Builder
+	res, err := emulator.Run(asm, emulator.Config{Stdout: &out})
+	if err != nil {
+		t.Fatalf("run failed: %v\n%s", err, asm)
+	}
+	if want := "1\ndivision by zero\n"; out.String() != want {
+		t.Errorf("wrong output. expected=%q, got=%q", want, out.String())
+	}
+	if res.ExitCode != 1 {
+		t.Errorf("wrong exit status. expected=1, got=%d", res.ExitCode)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	asm := ".data\nnewline: .asciiz \"\\n\"\nx: .word 0\nc: .byte 0, 1\nstr_1: .asciiz \"a#b\"\n\n" +
+		".text\nmain:\n    li $t0, 5 # five\n    sw $t0, x\nloop: j loop\n"
+	want := Size{Instructions: 3, DataBytes: 6, StringBytes: 6, Labels: 6}
+	if got := Measure(asm); got != want {
+		t.Errorf("wrong size. expected=%+v, got=%+v", want, got)
+	}
+
+	// A Meter sees the listing in pieces that split lines anywhere
+	for _, chunk := range []int{1, 7, len(asm)} {
+		var out strings.Builder
+		m := &Meter{W: &out}
+		for rest := asm; rest != ""; {
+			n := min(chunk, len(rest))
+			m.Write([]byte(rest[:n]))
+			rest = rest[n:]
+		}
+		if got := m.Size(); got != want || out.String() != asm {
+			t.Errorf("chunks of %d: wrong size %+v or output %q", chunk, got, out.String())
+		}
+	}
+
+	limits, err := ParseLimits("instructions=2, strings=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	over := want.Exceeded(limits)
+	if len(over) != 1 || over[0] != "instructions: 3 exceeds the limit of 2" {
+		t.Errorf("wrong limits exceeded: %q", over)
+	}
+
+	for _, spec := range []string{"bytes=2", "data", "labels=x", "labels=0"} {
+		if _, err := ParseLimits(spec); err == nil {
+			t.Errorf("ParseLimits(%q) succeeded, expected an error", spec)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	input := "def add(a, b):\n\treturn a + b\n\ndef twice(n):\n\treturn n + n\n\nx = add(1, 2)\nprint(x)\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	g := New(symbol.NewSymbolTable(nil))
+	asm := g.Generate(program)
+
+	main, files := Split(asm, g.FunctionTexts(), func(function string) string { return "prog_" + function + ".s" })
+	if len(files) != 2 || files[0].Function != "add" || files[1].Name != "prog_twice.s" {
+		t.Fatalf("unexpected files: %+v", files)
+	}
+	for _, f := range files {
+		if !strings.HasPrefix(f.Text, f.Function+":\n") || !strings.HasSuffix(f.Text, "jr $ra\n") {
+			t.Errorf("%s does not hold exactly one function:\n%s", f.Name, f.Text)
+		}
+		if strings.Contains(main, f.Function+":\n") {
+			t.Errorf("main file still defines %s:\n%s", f.Function, main)
+		}
+	}
+
+	inlined := main
+	for _, f := range files {
+		inlined = strings.Replace(inlined, ".include \""+f.Name+"\"\n", f.Text, 1)
+	}
+	if inlined != asm {
+		t.Errorf("expanding the includes did not restore the program.\nexpected:\n%s\ngot:\n%s", asm, inlined)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	asm := ".data\nstr_7: .asciiz \"if_true_3 $t5\"\n.text\nmain:\n    li   $t5, 1 # one\n\n    beq $t5, $zero, if_true_3\n" +
+		"if_true_3:\n    mul.s $f9, $f6, $f9\n    la $a0, str_7\nadd:\n    move $t4, $a0\n    jr $ra\n"
+	want := []string{
+		"    .data",
+		"str_1: .asciiz \"if_true_3 $t5\"",
+		"    .text",
+		"main:",
+		"    li $t0, 1",
+		"    beq $t0, $zero, if_true_1",
+		"if_true_1:",
+		"    mul.s $f4, $f5, $f4",
+		"    la $a0, str_1",
+		"add:",
+		"    move $t0, $a0",
+		"    jr $ra",
+	}
+	got := Normalize(asm)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong normalization.\nexpected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after []string
+		context       int
+		expected      string
+	}{
+		{"same", []string{"a", "b"}, []string{"a", "b"}, 3, ""},
+		{
+			"change in the middle",
+			[]string{"a", "b", "c", "d", "e"},
+			[]string{"a", "b", "x", "d", "e"},
+			1,
+			"@@ -2,3 +2,3 @@\n b\n-c\n+x\n d\n",
+		},
+		{
+			"insertion at the start",
+			[]string{"a", "b"},
+			[]string{"x", "a", "b"},
+			0,
+			"@@ -0,0 +1,1 @@\n+x\n",
+		},
+		{
+			"distant changes get separate hunks",
+			[]string{"a", "b", "c", "d", "e", "f"},
+			[]string{"x", "b", "c", "d", "e", "y"},
+			1,
+			"@@ -1,2 +1,2 @@\n-a\n+x\n b\n@@ -5,2 +5,2 @@\n e\n-f\n+y\n",
+		},
+		{
+			"close changes share a hunk",
+			[]string{"a", "b", "c"},
+			[]string{"x", "b", "y"},
+			1,
+			"@@ -1,3 +1,3 @@\n-a\n+x\n b\n-c\n+y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.before, tt.after, tt.context); got != tt.expected {
+				t.Errorf("wrong diff.\nexpected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestListing(t *testing.T) {
+	input := "x = 4\nif x > 1:\n\tprint(x)\n\ndef inc(n):\n\treturn n + 1\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	g := New(symbol.NewSymbolTable(nil))
+	asm := g.Generate(program)
+
+	marks := g.SourceMap()
+	for i := 1; i < len(marks); i++ {
+		if marks[i].Offset <= marks[i-1].Offset {
+			t.Fatalf("marks out of order: %+v", marks)
+		}
+	}
+
+	got := Listing(input, asm, marks)
+	if !strings.HasPrefix(got, ".data\n") {
+		t.Errorf("data section should not be attributed to a line:\n%s", got)
+	}
+	for _, want := range []string{
+		"   1  x = 4\n            li $t0, 4\n            sw $t0, x\n   2  if x > 1:\n",
+		"   3  \tprint(x)\n            lw $t0, x\n",
+		"   2  if x > 1:\n            j if_end_",
+		"   5  def inc(n):\n        inc:\n",
+		"   6  \treturn n + 1\n            lw $t0, -12($fp)\n",
+		"   5  def inc(n):\n        func_exit_",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("listing missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRegisterNeed(t *testing.T) {
+	leaf := func() ast.Expression { return &ast.Identifier{Value: "a"} }
+	bin := func(l, r ast.Expression) ast.Expression {
+		return &ast.BinaryExpression{Left: l, Operator: "+", Right: r}
+	}
+	tests := []struct {
+		name string
+		expr ast.Expression
+		want int
+	}{
+		{"leaf", leaf(), 1},
+		{"pair", bin(leaf(), leaf()), 2},
+		{"right chain", bin(leaf(), bin(leaf(), bin(leaf(), leaf()))), 2},
+		{"balanced", bin(bin(leaf(), leaf()), bin(leaf(), leaf())), 3},
+		{"negated", &ast.PrefixExpression{Operator: "-", Right: bin(leaf(), leaf())}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registerNeed(tt.expr); got != tt.want {
+				t.Errorf("registerNeed = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// A right-nested sum deeper than the ten temporaries only fits when the
+// nested side is evaluated first
+func TestOperandOrder(t *testing.T) {
+	program := parser.New(lexer.New("a = 1\nx = a\nprint(x)\n")).ParseProgram()
+	var deep ast.Expression = &ast.Identifier{Value: "a"}
+	for i := 0; i < 14; i++ {
+		deep = &ast.BinaryExpression{Left: &ast.Identifier{Value: "a"}, Operator: "-", Right: deep}
+	}
+	program.Statements[1].(*ast.AssignmentStatement).Value = deep
+
+	asm := New(symbol.NewSymbolTable(nil)).Generate(program)
+	if strings.Contains(asm, "$t3") {
+		t.Errorf("expected at most three temporaries, got:\n%s", asm)
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, asm)
+	}
+	// a - (a - (... - a)) alternates between 0 and 1
+	if out.String() != "1\n" {
+		t.Errorf("wrong output. expected=%q, got=%q\n%s", "1\n", out.String(), asm)
+	}
+}
+
+func TestLoopRegisters(t *testing.T) {
+	input := "def sum_to(n):\n\ttotal = 0\n\ti = 0\n\twhile i < n:\n\t\ttotal = total + i\n\t\ti += 1\n\treturn total\n\n" +
+		"k = 0\nwhile k < 3:\n\tx = sum_to(k)\n\tprint(x)\n\tk += 1\nwhile k > 0:\n\tk -= 1\nprint(k)\n"
+	program := desugar.Program(parser.New(lexer.New(input)).ParseProgram())
+	g := New(symbol.NewSymbolTable(nil))
+	g.Options.Target.LoopRegisters = []string{"$s0"}
+	asm := g.Generate(program)
+
+	for _, want := range []string{
+		// The function's loop saves the caller's $s0 and keeps i in it
+		"addiu $sp, $sp, -8\n    sw $s0, 0($sp)\n    lw $t0, -20($fp)\n    move $s0, $t0\n    j while_cond_",
+		"sw $s0, -20($fp)\n    lw $s0, 0($sp)\n    addiu $sp, $sp, 8\n",
+		// The last top-level loop keeps k in $s0 and stores it at the end
+		"lw $t0, k\n    move $s0, $t0\n    j while_cond_",
+		"sw $s0, k\n",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("output missing %q:\n%s", want, asm)
+		}
+	}
+	if n := strings.Count(asm, "move $s0, $t0\n    j while_cond_"); n != 2 {
+		t.Errorf("expected 2 loops pinned, not the one that calls sum_to; got %d:\n%s", n, asm)
+	}
+
+	var out strings.Builder
+	if _, err := emulator.Run(asm, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, asm)
+	}
+	if want := "0\n0\n1\n0\n"; out.String() != want {
+		t.Errorf("wrong output. expected=%q, got=%q\n%s", want, out.String(), asm)
+	}
+
+	regs, err := ParseLoopRegisters(" $s0, $s7")
+	if err != nil || strings.Join(regs, " ") != "$s0 $s7" {
+		t.Errorf("ParseLoopRegisters = %v, %v", regs, err)
+	}
+	for _, spec := range []string{"$t0", "$s8", "s0", "$s1,$s1"} {
+		if _, err := ParseLoopRegisters(spec); err == nil {
+			t.Errorf("ParseLoopRegisters(%q) succeeded, expected an error", spec)
+		}
+	}
+}
+
+func TestGenerateStatement(t *testing.T) {
+	input := "x = 1\ny = x + 2\nprint(y)\ndef f(a):\n\treturn a * 2\n"
+	program := parser.New(lexer.New(input)).ParseProgram()
+	env := symbol.NewSymbolTable(nil)
+	g := New(nil)
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"assignment", []string{"li $t0, 1", "sw $t0, x"}},
+		{"read of an earlier global", []string{"lw $t0, x", "li $t1, 2", "add $t2, $t0, $t1", "sw $t2, y"}},
+		{"print", []string{"lw $t0, y", "move $a0, $t0", "li $v0, 1", "syscall", "la $a0, newline", "li $v0, 4", "syscall"}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.GenerateStatement(program.Statements[i], env); !slices.Equal(got, tt.want) {
+				t.Errorf("wrong instructions.\nexpected=%q\ngot=     %q", tt.want, got)
+			}
+		})
+	}
+
+	fn := g.GenerateStatement(program.Statements[3], env)
+	if len(fn) == 0 || fn[0] != "f:" || fn[len(fn)-1] != "jr $ra" {
+		t.Errorf("expected the whole of f, got %q", fn)
+	}
+	if _, ok := env.Lookup("y"); !ok {
+		t.Errorf("expected y to be defined in env")
+	}
+
+	// Sugar is lowered as it would be in a whole program
+	sugar := parser.New(lexer.New("x += 2\nfor i in range(3):\n\tprint(i)\nif x > 1:\n\tprint(1)\nelif x > 0:\n\tprint(2)\n")).ParseProgram()
+	if got, want := g.GenerateStatement(sugar.Statements[0], env), []string{"lw $t0, x", "li $t1, 2", "add $t2, $t0, $t1", "sw $t2, x"}; !slices.Equal(got, want) {
+		t.Errorf("wrong instructions for +=.\nexpected=%q\ngot=     %q", want, got)
+	}
+	for _, stmt := range sugar.Statements[1:] {
+		got := strings.Join(g.GenerateStatement(stmt, env), "\n")
+		if !strings.Contains(got, "syscall") || !strings.Contains(got, "j") {
+			t.Errorf("expected a lowered loop or branch for %s, got:\n%s", stmt, got)
+		}
+	}
+
+	// Each string keeps the label it was first given
+	strs := parser.New(lexer.New("print(\"a\")\nprint(\"b\")\nprint(\"a\")\n")).ParseProgram()
+	var labels []string
+	for _, stmt := range strs.Statements {
+		labels = append(labels, g.GenerateStatement(stmt, env)[0])
+	}
+	if labels[0] == labels[1] || labels[0] != labels[2] {
+		t.Errorf("string labels not kept across calls: %q", labels)
+	}
+}
+
+func TestNames(t *testing.T) {
+	input := "x = 1\nif x > 0:\n\tprint(x)\nwhile x < 3:\n\tx += 1\n"
+	generate := func(g *CodeGenerator) string {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		return g.Generate(desugar.Program(program))
+	}
+
+	// Each compilation numbers its labels afresh, so the same generator
+	// gives the same assembly twice
+	g := New(nil)
+	if first, second := generate(g), generate(g); first != second {
+		t.Errorf("labels differ between compilations.\nfirst:\n%s\nsecond:\n%s", first, second)
+	}
+
+	// A generator given in the options pins the numbering
+	g = New(nil)
+	g.Options.Names = gensym.New(100)
+	asm := generate(g)
+	if !strings.Contains(asm, "if_true_101:") || strings.Contains(asm, "_1:") {
+		t.Errorf("expected labels numbered from 101:\n%s", asm)
+	}
+	if g.Options.Names.Last() <= 101 {
+		t.Errorf("expected the generator to have gone on past 101, got %d", g.Options.Names.Last())
+	}
+
+	// Statements generated in one session never reuse a label
+	stmt := parser.New(lexer.New("if x > 0:\n\tprint(x)\n")).ParseProgram().Statements[0]
+	g = New(nil)
+	env := symbol.NewSymbolTable(nil)
+	env.Define("x", symbol.IntegerType)
+	first := strings.Join(g.GenerateStatement(stmt, env), "\n")
+	second := strings.Join(g.GenerateStatement(stmt, env), "\n")
+	if first == second {
+		t.Errorf("expected the second statement to have labels of its own, got:\n%s", second)
+	}
+	if again := strings.Join(g.GenerateStatement(stmt, symbol.NewSymbolTable(nil)), "\n"); again != first {
+		t.Errorf("expected a new session to number from 1.\nexpected:\n%s\ngot:\n%s", first, again)
+	}
+}
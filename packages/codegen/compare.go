@@ -0,0 +1,124 @@
+package codegen
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/arifali123/152compiler/packages/ast"
+)
+
+// compareRegisters leaves 1 in $t<result> if $t<left> op $t<right> holds
+// and 0 otherwise
+func (g *CodeGenerator) compareRegisters(op string, result, left, right int) {
+	switch op {
+	case "<":
+		g.output.WriteString(fmt.Sprintf("    slt $t%d, $t%d, $t%d\n", result, left, right))
+	case ">":
+		g.output.WriteString(fmt.Sprintf("    slt $t%d, $t%d, $t%d\n", result, right, left))
+	case "<=":
+		g.output.WriteString(fmt.Sprintf("    slt $t%d, $t%d, $t%d\n", result, right, left))
+		g.output.WriteString(fmt.Sprintf("    xori $t%d, $t%d, 1\n", result, result))
+	case ">=":
+		g.output.WriteString(fmt.Sprintf("    slt $t%d, $t%d, $t%d\n", result, left, right))
+		g.output.WriteString(fmt.Sprintf("    xori $t%d, $t%d, 1\n", result, result))
+	case "==":
+		g.output.WriteString(fmt.Sprintf("    xor $t%d, $t%d, $t%d\n", result, left, right))
+		g.output.WriteString(fmt.Sprintf("    sltiu $t%d, $t%d, 1\n", result, result))
+	case "!=":
+		g.output.WriteString(fmt.Sprintf("    xor $t%d, $t%d, $t%d\n", result, left, right))
+		g.output.WriteString(fmt.Sprintf("    sltu $t%d, $zero, $t%d\n", result, result))
+	}
+}
+
+// comparisonPairs returns a < b < c as (a < b) and (b < c) when every
+// operand that appears in two pairs is a name or a literal, which reads the
+// same however often it is evaluated
+func comparisonPairs(e *ast.Comparison) (ast.Expression, bool) {
+	for _, operand := range e.Operands[1 : len(e.Operands)-1] {
+		switch operand.(type) {
+		case *ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.NoneLiteral:
+		default:
+			return nil, false
+		}
+	}
+	var all ast.Expression
+	for i, op := range e.Operators {
+		pair := ast.NewBinary(e.Operands[i], op, e.Operands[i+1])
+		if all == nil {
+			all = pair
+		} else {
+			all = ast.NewBinary(all, "and", pair)
+		}
+	}
+	return all, true
+}
+
+// generateComparison leaves 1 or 0 in a $t register. Each operand is
+// evaluated once, left to right, and the operands after the first pair that
+// fails are not evaluated at all.
+func (g *CodeGenerator) generateComparison(e *ast.Comparison) int {
+	if all, ok := comparisonPairs(e); ok {
+		return g.generateExpression(all)
+	}
+	if slices.ContainsFunc(e.Operands, g.isFloat) {
+		return g.generateFloatChain(e)
+	}
+	resultReg := g.allocateRegister()
+	end := g.getUniqueLabel("cmp_end")
+	left := g.generateExpression(e.Operands[0])
+	for i, op := range e.Operators {
+		right := g.generateExpression(e.Operands[i+1])
+		if left < 0 || right < 0 {
+			g.freeRegister(left)
+			g.freeRegister(right)
+			g.freeRegister(resultReg)
+			return -1
+		}
+		if g.stringEquality(e.Operands[i], op, e.Operands[i+1]) {
+			equal := g.compareStrings(op, left, right)
+			g.output.WriteString(fmt.Sprintf("    move $t%d, $t%d\n", resultReg, equal))
+			g.freeRegister(equal)
+		} else {
+			g.compareRegisters(op, resultReg, left, right)
+		}
+		g.freeRegister(left)
+		left = right
+		if i < len(e.Operators)-1 {
+			g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", resultReg, end))
+		}
+	}
+	g.freeRegister(left)
+	g.output.WriteString(fmt.Sprintf("%s:\n", end))
+	return resultReg
+}
+
+// generateFloatChain is generateComparison made on the FPU, for a chain
+// with a float operand
+func (g *CodeGenerator) generateFloatChain(e *ast.Comparison) int {
+	resultReg := g.allocateRegister()
+	fail, end := g.getUniqueLabel("fcmp_fail"), g.getUniqueLabel("fcmp_end")
+	left := g.generateFloat(e.Operands[0])
+	for i, op := range e.Operators {
+		right := g.generateFloat(e.Operands[i+1])
+		if left < 0 || right < 0 {
+			g.freeFloat(left)
+			g.freeFloat(right)
+			g.freeRegister(resultReg)
+			return -1
+		}
+		branch := "bc1f"
+		if !g.compareFloatRegisters(op, left, right) {
+			branch = "bc1t"
+		}
+		g.output.WriteString(fmt.Sprintf("    %s %s\n", branch, fail))
+		g.freeFloat(left)
+		left = right
+	}
+	g.freeFloat(left)
+	g.loadImmediate(fmt.Sprintf("$t%d", resultReg), 1)
+	g.output.WriteString(fmt.Sprintf("    j %s\n", end))
+	g.output.WriteString(fmt.Sprintf("%s:\n", fail))
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $zero\n", resultReg))
+	g.output.WriteString(fmt.Sprintf("%s:\n", end))
+	return resultReg
+}
@@ -0,0 +1,198 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+// runtimePrefix starts the labels of the routines the generated program
+// calls into, such as concatLabel. User names with it are mangled.
+const runtimePrefix = "rt_"
+
+const (
+	concatLabel   = runtimePrefix + "concat"
+	strEqualLabel = runtimePrefix + "str_equal"
+)
+
+// isString reports whether e evaluates to the address of a string
+func (g *CodeGenerator) isString(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.StringLiteral:
+		return true
+	case *ast.Identifier:
+		return e.Symbol != nil && e.Symbol.Type == symbol.StringType
+	case *ast.FunctionCall:
+		return e.Function == formatFunction || g.returns[e.Function] == symbol.StringType
+	case *ast.BinaryExpression:
+		return e.Operator == "+" && (g.isString(e.Left) || g.isString(e.Right))
+	case *ast.IndexExpression:
+		if values, ok := g.listOf(e.Left); ok {
+			return values == symbol.StringType
+		}
+		left, ok := e.Left.(*ast.Identifier)
+		return ok && left.Symbol != nil && left.Symbol.Type == symbol.DictType && left.Symbol.Values == symbol.StringType
+	}
+	return false
+}
+
+// callRuntime calls a runtime routine with the values in args, which it
+// frees. The arguments go on the stack and the routine leaves its result in
+// the first slot, so no register the caller holds is disturbed.
+func (g *CodeGenerator) callRuntime(label string, args ...int) int {
+	word := g.Options.Target.WordBytes()
+	g.output.WriteString(fmt.Sprintf("    %s $sp, $sp, %d\n", g.op("addiu"), -len(args)*word))
+	for i, reg := range args {
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, %d($sp)\n", g.op("sw"), reg, i*word))
+	}
+	g.output.WriteString(fmt.Sprintf("    jal %s\n", label))
+	for _, reg := range args {
+		g.freeRegister(reg)
+	}
+	resultReg := g.allocateRegister()
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($sp)\n", g.op("lw"), resultReg))
+	g.output.WriteString(fmt.Sprintf("    %s $sp, $sp, %d\n", g.op("addiu"), len(args)*word))
+	return resultReg
+}
+
+// generateConcat joins two strings into a new one on the heap
+func (g *CodeGenerator) generateConcat(e *ast.BinaryExpression) int {
+	leftReg, rightReg := g.generateOperands(e.Left, e.Right)
+	if leftReg < 0 || rightReg < 0 {
+		g.freeRegister(leftReg)
+		g.freeRegister(rightReg)
+		return -1
+	}
+	g.usesConcat = true
+	return g.callRuntime(concatLabel, leftReg, rightReg)
+}
+
+// writeConcat emits the routine generateConcat calls. It measures both
+// strings, takes room for them and the terminator from sbrk and copies
+// them in. It only touches $a0-$a3 and $v0, and restores those.
+func (g *CodeGenerator) writeConcat() {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", concatLabel, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", concatLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a2, %d($sp)", g.op("lw"), frame+word)
+
+	// $a0 counts the bytes needed, starting with the terminator
+	g.loadImmediate("$a0", 1)
+	for i, str := range []string{"$a1", "$a2"} {
+		emit("move $a3, %s", str)
+		label(fmt.Sprintf("len%d", i))
+		emit("lbu $v0, 0($a3)")
+		emit("beq $v0, $zero, %s_measured%d", concatLabel, i)
+		emit("%s $a0, $a0, 1", g.op("addiu"))
+		emit("%s $a3, $a3, 1", g.op("addiu"))
+		emit("j %s_len%d", concatLabel, i)
+		label(fmt.Sprintf("measured%d", i))
+	}
+	g.loadImmediate("$v0", int64(g.syscalls.Sbrk))
+	emit("syscall")
+	emit("%s $v0, %d($sp)", g.op("sw"), frame)
+	emit("move $a3, $v0")
+
+	// Copy the left string without its terminator, then the right with it
+	label("left")
+	emit("lbu $a0, 0($a1)")
+	emit("beq $a0, $zero, %s_right", concatLabel)
+	emit("sb $a0, 0($a3)")
+	emit("%s $a1, $a1, 1", g.op("addiu"))
+	emit("%s $a3, $a3, 1", g.op("addiu"))
+	emit("j %s_left", concatLabel)
+	label("right")
+	emit("lbu $a0, 0($a2)")
+	emit("sb $a0, 0($a3)")
+	emit("%s $a2, $a2, 1", g.op("addiu"))
+	emit("%s $a3, $a3, 1", g.op("addiu"))
+	emit("bne $a0, $zero, %s_right", concatLabel)
+
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
+
+// stringEquality reports whether op compares two strings, which must be
+// done by contents: a concatenation builds a new string at run time, so
+// equal strings need not share an address
+func (g *CodeGenerator) stringEquality(left ast.Expression, op string, right ast.Expression) bool {
+	return (op == "==" || op == "!=") && g.isString(left) && g.isString(right)
+}
+
+// compareStrings leaves 1 in a fresh register if the strings at $t<left>
+// and $t<right> have op between them and 0 otherwise. Both registers stay
+// allocated.
+func (g *CodeGenerator) compareStrings(op string, left, right int) int {
+	a, b := g.allocateRegister(), g.allocateRegister()
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $t%d\n", a, left))
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $t%d\n", b, right))
+	g.usesStrEqual = true
+	result := g.callRuntime(strEqualLabel, a, b)
+	if op == "!=" {
+		g.output.WriteString(fmt.Sprintf("    xori $t%d, $t%d, 1\n", result, result))
+	}
+	return result
+}
+
+// writeStrEqual emits the routine compareStrings calls. It walks both
+// strings a byte at a time and leaves 1 in the first argument slot when
+// they match up to and including the terminator. It only touches $a0-$a3
+// and restores them.
+func (g *CodeGenerator) writeStrEqual() {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a2", "$a3"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", strEqualLabel, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", strEqualLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a2, %d($sp)", g.op("lw"), frame+word)
+
+	label("next")
+	emit("lbu $a0, 0($a1)")
+	emit("lbu $a3, 0($a2)")
+	emit("bne $a0, $a3, %s_differ", strEqualLabel)
+	emit("beq $a0, $zero, %s_same", strEqualLabel)
+	emit("%s $a1, $a1, 1", g.op("addiu"))
+	emit("%s $a2, $a2, 1", g.op("addiu"))
+	emit("j %s_next", strEqualLabel)
+	label("same")
+	g.loadImmediate("$a0", 1)
+	emit("j %s_done", strEqualLabel)
+	label("differ")
+	emit("move $a0, $zero")
+	label("done")
+	emit("%s $a0, %d($sp)", g.op("sw"), frame)
+
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
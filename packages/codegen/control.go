@@ -2,9 +2,10 @@ package codegen
 
 import (
 	"fmt"
-	"log"
+	"slices"
 
 	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/opt"
 )
 
 // ControlFlowContext tracks the current control flow state
@@ -14,6 +15,15 @@ type ControlFlowContext struct {
 	depth         int
 }
 
+// LoopLabels names the labels generated for one while loop, so tools can
+// map executed instructions back to the source loop
+type LoopLabels struct {
+	Line  int
+	Start string
+	Body  string
+	End   string
+}
+
 // RegisterScope manages a set of registers for a block of code
 type RegisterScope struct {
 	regs []int
@@ -28,34 +38,36 @@ func (s *RegisterScope) Free(g *CodeGenerator) {
 
 // GenerateIfStatement handles code generation for if statements
 func (g *CodeGenerator) GenerateIfStatement(stmt *ast.IfStatement) error {
-	log.Printf("[DEBUG] Starting if statement generation")
 	// Generate unique labels
 	ifTrue := g.getUniqueLabel("if_true")
 	ifFalse := g.getUniqueLabel("if_false")
 	ifEnd := g.getUniqueLabel("if_end")
 
-	log.Printf("[DEBUG] Generated labels: %s, %s, %s", ifTrue, ifFalse, ifEnd)
+	// The branch expected to run falls through from the condition, so an
+	// unlikely consequence is placed after the else block
+	first, second := ifTrue, ifFalse
+	firstBody, secondBody := stmt.Consequence, stmt.Alternative
+	if stmt.Hint == ast.Unlikely {
+		first, second = ifFalse, ifTrue
+		firstBody, secondBody = stmt.Alternative, stmt.Consequence
+	}
 
 	// Generate condition with automatic register management
 	if err := g.withRegisters(func(scope *RegisterScope) error {
-		return g.generateCondition(stmt.Condition, ifTrue, ifFalse, scope)
+		return g.generateCondition(stmt.Condition, ifTrue, ifFalse, first, scope)
 	}); err != nil {
 		return fmt.Errorf("if condition generation failed: %w", err)
 	}
 
-	// Generate true branch
-	g.output.WriteString(fmt.Sprintf("%s:\n", ifTrue))
-	for _, stmt := range stmt.Consequence {
+	g.output.WriteString(fmt.Sprintf("%s:\n", first))
+	for _, stmt := range firstBody {
 		g.generateNode(stmt)
 	}
 	g.output.WriteString(fmt.Sprintf("    j %s\n", ifEnd))
 
-	// Generate false branch
-	g.output.WriteString(fmt.Sprintf("%s:\n", ifFalse))
-	if stmt.Alternative != nil {
-		for _, stmt := range stmt.Alternative {
-			g.generateNode(stmt)
-		}
+	g.output.WriteString(fmt.Sprintf("%s:\n", second))
+	for _, stmt := range secondBody {
+		g.generateNode(stmt)
 	}
 
 	// End of if statement
@@ -66,97 +78,178 @@ func (g *CodeGenerator) GenerateIfStatement(stmt *ast.IfStatement) error {
 	return nil
 }
 
-// GenerateWhileStatement handles code generation for while loops
+// GenerateWhileStatement handles code generation for while loops. The
+// condition is tested at the bottom, so each iteration takes one branch back
+// to the body and leaving the loop is the branch not taken.
 func (g *CodeGenerator) GenerateWhileStatement(stmt *ast.WhileStatement) error {
-	log.Printf("[DEBUG] Starting while statement generation")
 	// Generate unique labels
 	whileStart := g.getUniqueLabel("while_start")
 	whileBody := g.getUniqueLabel("while_body")
 	whileEnd := g.getUniqueLabel("while_end")
+	whileCond := g.getUniqueLabel("while_cond")
 
-	log.Printf("[DEBUG] Generated labels: %s, %s, %s", whileStart, whileBody, whileEnd)
+	g.loops = append(g.loops, LoopLabels{Line: stmt.Token.Line, Start: whileStart, Body: whileBody, End: whileEnd})
 
 	// Create control flow context for break/continue
 	ctx := &ControlFlowContext{
 		breakLabel:    whileEnd,
-		continueLabel: whileStart,
+		continueLabel: whileCond,
 		depth:         len(g.controlFlowStack),
 	}
 
+	pins := g.loopPins(stmt)
 	return g.withControlFlow(ctx, func() error {
-		// Generate loop start
+		// Enter at the test
 		g.output.WriteString(fmt.Sprintf("%s:\n", whileStart))
-
-		// Generate condition with automatic register management
-		if err := g.withRegisters(func(scope *RegisterScope) error {
-			return g.generateCondition(stmt.Condition, whileBody, whileEnd, scope)
-		}); err != nil {
-			return fmt.Errorf("while condition generation failed: %w", err)
-		}
+		g.enterPins(pins)
+		g.output.WriteString(fmt.Sprintf("    j %s\n", whileCond))
 
 		// Generate loop body
 		g.output.WriteString(fmt.Sprintf("%s:\n", whileBody))
+		if g.countsIterations {
+			g.countIteration()
+		}
 		for _, stmt := range stmt.Body {
 			g.generateNode(stmt)
 			// Clear temporary registers after each statement
 			g.clearAllRegisters()
 		}
 
-		// Jump back to start
-		g.output.WriteString(fmt.Sprintf("    j %s\n", whileStart))
+		// Generate condition with automatic register management
+		g.output.WriteString(fmt.Sprintf("%s:\n", whileCond))
+		if err := g.withRegisters(func(scope *RegisterScope) error {
+			return g.generateCondition(stmt.Condition, whileBody, whileEnd, whileEnd, scope)
+		}); err != nil {
+			return fmt.Errorf("while condition generation failed: %w", err)
+		}
 
 		// Generate loop end
 		g.output.WriteString(fmt.Sprintf("%s:\n", whileEnd))
+		g.leavePins(pins)
 		return nil
 	})
 }
 
-// Helper function to generate condition code
-func (g *CodeGenerator) generateCondition(condition ast.Expression, trueLabel, falseLabel string, scope *RegisterScope) error {
+// iterationsLabel is the word counting loop iterations under
+// Options.MaxIterations
+const iterationsLabel = runtimePrefix + "iterations"
+
+const iterationsMessage = "loop iteration limit exceeded\n"
+
+// countIteration counts one more loop iteration and aborts the program when
+// that makes more than Options.MaxIterations. No value is held in a
+// register at the top of a loop body, so $t0 and $t1 are free.
+func (g *CodeGenerator) countIteration() {
+	g.output.WriteString(fmt.Sprintf("    %s $t0, %s\n", g.op("lw"), iterationsLabel))
+	g.output.WriteString(fmt.Sprintf("    %s $t0, $t0, 1\n", g.op("addiu")))
+	g.output.WriteString(fmt.Sprintf("    %s $t0, %s\n", g.op("sw"), iterationsLabel))
+	g.loadImmediate("$t1", int64(g.Options.MaxIterations))
+	g.output.WriteString("    slt $t1, $t1, $t0\n")
+	g.output.WriteString(fmt.Sprintf("    bne $t1, $zero, %s\n", g.coldAbort(iterationsMessage)))
+}
+
+// generateCondition branches to trueLabel when condition holds and to
+// falseLabel when it does not. next is the label placed right after the
+// condition's code; control falls into it rather than jumping.
+func (g *CodeGenerator) generateCondition(condition ast.Expression, trueLabel, falseLabel, next string, scope *RegisterScope) error {
+	if not, ok := condition.(*ast.PrefixExpression); ok && not.Operator == "not" {
+		return g.generateCondition(not.Right, falseLabel, trueLabel, next, scope)
+	}
+	if chain, ok := condition.(*ast.Comparison); ok {
+		if all, ok := comparisonPairs(chain); ok {
+			return g.generateCondition(all, trueLabel, falseLabel, next, scope)
+		}
+	}
 	binExpr, ok := condition.(*ast.BinaryExpression)
-	if !ok {
-		return fmt.Errorf("unsupported condition type: %T", condition)
+	if !ok || floatOperators[binExpr.Operator] {
+		return g.generateTruthTest(condition, trueLabel, falseLabel, next, scope)
+	}
+
+	// and/or branch on the left operand and only evaluate the right one when
+	// it can still change the outcome
+	switch binExpr.Operator {
+	case "and", "or":
+		rhs := g.getUniqueLabel(binExpr.Operator + "_rhs")
+		leftTrue, leftFalse := rhs, falseLabel
+		if binExpr.Operator == "or" {
+			leftTrue, leftFalse = trueLabel, rhs
+		}
+		if err := g.withRegisters(func(scope *RegisterScope) error {
+			return g.generateCondition(binExpr.Left, leftTrue, leftFalse, rhs, scope)
+		}); err != nil {
+			return err
+		}
+		g.output.WriteString(fmt.Sprintf("%s:\n", rhs))
+		return g.generateCondition(binExpr.Right, trueLabel, falseLabel, next, scope)
+	}
+
+	// Two string constants compare the same way on every run
+	left, lok := binExpr.Left.(*ast.StringLiteral)
+	right, rok := binExpr.Right.(*ast.StringLiteral)
+	if lok && rok {
+		taken, ok := opt.CompareStrings(binExpr.Operator, left.Value, right.Value)
+		if !ok {
+			return fmt.Errorf("unsupported comparison operator: %s", binExpr.Operator)
+		}
+		target := falseLabel
+		if taken {
+			target = trueLabel
+		}
+		if target != next {
+			g.output.WriteString(fmt.Sprintf("    j %s\n", target))
+		}
+		return nil
+	}
+
+	if g.hasFloatOperand(binExpr) {
+		holds, ok := g.compareFloats(binExpr)
+		if !ok {
+			return fmt.Errorf("unsupported comparison operator: %s", binExpr.Operator)
+		}
+		if holds {
+			g.branchUnless("bc1f", "", trueLabel, falseLabel, next)
+		} else {
+			g.branchUnless("bc1t", "", trueLabel, falseLabel, next)
+		}
+		return nil
 	}
 
 	// Generate code for left and right expressions
-	leftReg := g.generateExpression(binExpr.Left)
-	rightReg := g.generateExpression(binExpr.Right)
+	leftReg, rightReg := g.generateOperands(binExpr.Left, binExpr.Right)
 	scope.regs = append(scope.regs, leftReg, rightReg)
+	if g.stringEquality(binExpr.Left, binExpr.Operator, binExpr.Right) {
+		resultReg := g.compareStrings(binExpr.Operator, leftReg, rightReg)
+		scope.regs = append(scope.regs, resultReg)
+		g.branchUnless("beq", fmt.Sprintf("$t%d, $zero", resultReg), trueLabel, falseLabel, next)
+		return nil
+	}
 	resultReg := g.allocateRegister()
 	scope.regs = append(scope.regs, resultReg)
 
 	// Generate appropriate comparison using slt
+	result := fmt.Sprintf("$t%d, $zero", resultReg)
 	switch binExpr.Operator {
 	case ">":
 		// For x > y, compute y < x by swapping operands
 		g.output.WriteString(fmt.Sprintf("    slt $t%d, $t%d, $t%d\n", resultReg, rightReg, leftReg))
-		g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", resultReg, falseLabel))
-		g.output.WriteString(fmt.Sprintf("    j %s\n", trueLabel))
+		g.branchUnless("beq", result, trueLabel, falseLabel, next)
 	case "<":
 		// For x < y, directly use slt
 		g.output.WriteString(fmt.Sprintf("    slt $t%d, $t%d, $t%d\n", resultReg, leftReg, rightReg))
-		g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", resultReg, falseLabel))
-		g.output.WriteString(fmt.Sprintf("    j %s\n", trueLabel))
+		g.branchUnless("beq", result, trueLabel, falseLabel, next)
 	case ">=":
 		// For x >= y, compute !(x < y)
 		g.output.WriteString(fmt.Sprintf("    slt $t%d, $t%d, $t%d\n", resultReg, leftReg, rightReg))
-		g.output.WriteString(fmt.Sprintf("    bne $t%d, $zero, %s\n", resultReg, falseLabel))
-		g.output.WriteString(fmt.Sprintf("    j %s\n", trueLabel))
+		g.branchUnless("bne", result, trueLabel, falseLabel, next)
 	case "<=":
 		// For x <= y, compute !(y < x)
 		g.output.WriteString(fmt.Sprintf("    slt $t%d, $t%d, $t%d\n", resultReg, rightReg, leftReg))
-		g.output.WriteString(fmt.Sprintf("    bne $t%d, $zero, %s\n", resultReg, falseLabel))
-		g.output.WriteString(fmt.Sprintf("    j %s\n", trueLabel))
+		g.branchUnless("bne", result, trueLabel, falseLabel, next)
 	case "==":
-		// For x == y, compute x - y and check if result is zero
-		g.output.WriteString(fmt.Sprintf("    sub $t%d, $t%d, $t%d\n", resultReg, leftReg, rightReg))
-		g.output.WriteString(fmt.Sprintf("    bne $t%d, $zero, %s\n", resultReg, falseLabel))
-		g.output.WriteString(fmt.Sprintf("    j %s\n", trueLabel))
+		// Branch on the operands directly; subtracting them could overflow
+		g.branchUnless("bne", fmt.Sprintf("$t%d, $t%d", leftReg, rightReg), trueLabel, falseLabel, next)
 	case "!=":
-		// For x != y, compute x - y and check if result is not zero
-		g.output.WriteString(fmt.Sprintf("    sub $t%d, $t%d, $t%d\n", resultReg, leftReg, rightReg))
-		g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", resultReg, falseLabel))
-		g.output.WriteString(fmt.Sprintf("    j %s\n", trueLabel))
+		g.branchUnless("beq", fmt.Sprintf("$t%d, $t%d", leftReg, rightReg), trueLabel, falseLabel, next)
 	default:
 		return fmt.Errorf("unsupported comparison operator: %s", binExpr.Operator)
 	}
@@ -164,6 +257,58 @@ func (g *CodeGenerator) generateCondition(condition ast.Expression, trueLabel, f
 	return nil
 }
 
+// generateTruthTest branches on a value the way Python tests it: zero is
+// false and anything else is true
+func (g *CodeGenerator) generateTruthTest(value ast.Expression, trueLabel, falseLabel, next string, scope *RegisterScope) error {
+	if g.isFloat(value) {
+		reg := g.generateFloat(value)
+		if reg == -1 {
+			return fmt.Errorf("unsupported condition type: %T", value)
+		}
+		zero := g.allocateFloat()
+		g.output.WriteString(fmt.Sprintf("    mtc1 $zero, $f%d\n", zero))
+		g.output.WriteString(fmt.Sprintf("    c.eq.s $f%d, $f%d\n", reg, zero))
+		g.branchUnless("bc1t", "", trueLabel, falseLabel, next)
+		g.freeFloat(reg)
+		g.freeFloat(zero)
+		return nil
+	}
+	reg := g.generateExpression(value)
+	if reg == -1 {
+		return fmt.Errorf("unsupported condition type: %T", value)
+	}
+	scope.regs = append(scope.regs, reg)
+	g.branchUnless("beq", fmt.Sprintf("$t%d, $zero", reg), trueLabel, falseLabel, next)
+	return nil
+}
+
+// inverseBranch pairs each conditional branch with the one taken in exactly
+// the opposite case
+var inverseBranch = map[string]string{"beq": "bne", "bne": "beq", "bc1t": "bc1f", "bc1f": "bc1t"}
+
+// branchUnless ends a condition whose branch op with operands is taken when
+// the condition fails. Control must reach falseLabel in that case and
+// trueLabel otherwise; whichever of the two is next is reached by falling
+// through, and when that is falseLabel the branch is inverted to go to
+// trueLabel instead.
+func (g *CodeGenerator) branchUnless(op, operands, trueLabel, falseLabel, next string) {
+	branch := func(op, label string) {
+		if operands == "" {
+			g.output.WriteString(fmt.Sprintf("    %s %s\n", op, label))
+		} else {
+			g.output.WriteString(fmt.Sprintf("    %s %s, %s\n", op, operands, label))
+		}
+	}
+	if next == falseLabel {
+		branch(inverseBranch[op], trueLabel)
+		return
+	}
+	branch(op, falseLabel)
+	if next != trueLabel {
+		g.output.WriteString(fmt.Sprintf("    j %s\n", trueLabel))
+	}
+}
+
 // Helper function to manage register allocation and deallocation
 func (g *CodeGenerator) withRegisters(f func(*RegisterScope) error) error {
 	scope := &RegisterScope{}
@@ -180,8 +325,11 @@ func (g *CodeGenerator) withControlFlow(ctx *ControlFlowContext, f func() error)
 	return f()
 }
 
-// Helper function to generate unique labels
+// getUniqueLabel returns a new label starting with prefix, which must be
+// one of labelPrefixes so user names cannot collide with it
 func (g *CodeGenerator) getUniqueLabel(prefix string) string {
-	g.labelCount++
-	return fmt.Sprintf("%s_%d", prefix, g.labelCount)
+	if !slices.Contains(labelPrefixes, prefix) {
+		panic("codegen: label prefix " + prefix + " is not in labelPrefixes")
+	}
+	return g.names.Name(prefix + "_")
 }
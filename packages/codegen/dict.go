@@ -0,0 +1,172 @@
+package codegen
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+const (
+	allocLabel   = runtimePrefix + "alloc"
+	dictGetLabel = runtimePrefix + "dict_get"
+)
+
+// keyMessage is printed when a lookup finds no entry for its key
+const keyMessage = "key not found\n"
+
+// A dictionary is a table on the heap: the number of entries, whether the
+// keys are strings, then each key followed by its value, one word apiece.
+
+// generateDict builds the table for a dictionary literal
+func (g *CodeGenerator) generateDict(e *ast.DictLiteral) int {
+	word := g.Options.Target.WordBytes()
+	size := g.allocateRegister()
+	g.loadImmediate(fmt.Sprintf("$t%d", size), int64((2+2*len(e.Keys))*word))
+	g.usesAlloc = true
+	table := g.callRuntime(allocLabel, size)
+
+	stringKeys := int64(0)
+	for _, key := range e.Keys {
+		if g.isString(key) {
+			stringKeys = 1
+		}
+	}
+	header := g.allocateRegister()
+	g.loadImmediate(fmt.Sprintf("$t%d", header), int64(len(e.Keys)))
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($t%d)\n", g.op("sw"), header, table))
+	g.loadImmediate(fmt.Sprintf("$t%d", header), stringKeys)
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, %d($t%d)\n", g.op("sw"), header, word, table))
+	g.freeRegister(header)
+
+	for i, key := range e.Keys {
+		for j, part := range []ast.Expression{key, e.Values[i]} {
+			reg := g.generateExpression(part)
+			if reg < 0 {
+				continue
+			}
+			g.output.WriteString(fmt.Sprintf("    %s $t%d, %d($t%d)\n", g.op("sw"), reg, (2+2*i+j)*word, table))
+			g.freeRegister(reg)
+		}
+	}
+	return table
+}
+
+// holdsStrings reports whether a dictionary literal has a string value or
+// a list literal a string element
+func (g *CodeGenerator) holdsStrings(e ast.Expression) bool {
+	if _, ok := e.(*ast.ListLiteral); ok {
+		values, _ := g.listOf(e)
+		return values == symbol.StringType
+	}
+	dict, ok := e.(*ast.DictLiteral)
+	if !ok {
+		return false
+	}
+	for _, value := range dict.Values {
+		if g.isString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateIndex looks a key up in a dictionary, or an element up in a list
+func (g *CodeGenerator) generateIndex(e *ast.IndexExpression) int {
+	if g.isList(e.Left) {
+		return g.generateListIndex(e)
+	}
+	tableReg, keyReg := g.generateOperands(e.Left, e.Index)
+	if tableReg < 0 || keyReg < 0 {
+		g.freeRegister(tableReg)
+		g.freeRegister(keyReg)
+		return -1
+	}
+	g.usesDict = true
+	return g.callRuntime(dictGetLabel, tableReg, keyReg)
+}
+
+// writeAlloc emits the routine that takes the number of bytes on the stack
+// and replaces it with the address of that much new memory from sbrk
+func (g *CodeGenerator) writeAlloc() {
+	word := g.Options.Target.WordBytes()
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	g.output.WriteString(fmt.Sprintf("%s:\n", allocLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -2*word)
+	emit("%s $a0, 0($sp)", g.op("sw"))
+	emit("%s $v0, %d($sp)", g.op("sw"), word)
+	emit("%s $a0, %d($sp)", g.op("lw"), 2*word)
+	g.loadImmediate("$v0", int64(g.syscalls.Sbrk))
+	emit("syscall")
+	emit("%s $v0, %d($sp)", g.op("sw"), 2*word)
+	emit("%s $a0, 0($sp)", g.op("lw"))
+	emit("%s $v0, %d($sp)", g.op("lw"), word)
+	emit("%s $sp, $sp, %d", g.op("addiu"), 2*word)
+	emit("jr $ra")
+}
+
+// writeDictGet emits the lookup routine generateIndex calls. It scans the
+// entries from the last, so a key written twice in a literal finds its
+// later value as in Python. String keys match by contents, other keys by
+// value. A missing key prints keyMessage and exits.
+func (g *CodeGenerator) writeDictGet() {
+	word := g.Options.Target.WordBytes()
+	entry := 2 * word
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0", "$v1", "$t0", "$t1"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", dictGetLabel, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", dictGetLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a2, %d($sp)", g.op("lw"), frame+word)
+
+	// $a3 counts the entries left and $a1 points at the last of them, which
+	// is as many entry sizes past the table as there are entries
+	emit("%s $a3, 0($a1)", g.op("lw"))
+	emit("%s $v1, %d($a1)", g.op("lw"), word)
+	emit("sll $a0, $a3, %d", bits.TrailingZeros(uint(entry)))
+	emit("%s $a1, $a1, $a0", g.op("add"))
+
+	label("next")
+	emit("beq $a3, $zero, %s_missing", dictGetLabel)
+	emit("%s $a0, 0($a1)", g.op("lw"))
+	emit("beq $a0, $a2, %s_found", dictGetLabel)
+	emit("beq $v1, $zero, %s_skip", dictGetLabel)
+	emit("move $t0, $a2")
+	label("compare")
+	emit("lbu $v0, 0($a0)")
+	emit("lbu $t1, 0($t0)")
+	emit("bne $v0, $t1, %s_skip", dictGetLabel)
+	emit("beq $v0, $zero, %s_found", dictGetLabel)
+	emit("%s $a0, $a0, 1", g.op("addiu"))
+	emit("%s $t0, $t0, 1", g.op("addiu"))
+	emit("j %s_compare", dictGetLabel)
+	label("skip")
+	emit("%s $a1, $a1, %d", g.op("addiu"), -entry)
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	emit("j %s_next", dictGetLabel)
+
+	label("found")
+	emit("%s $v0, %d($a1)", g.op("lw"), word)
+	emit("%s $v0, %d($sp)", g.op("sw"), frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+
+	label("missing")
+	g.abort(keyMessage)
+}
@@ -0,0 +1,401 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+// Float temporaries are $f4-$f11; $f12 carries the value print_float prints
+const (
+	firstFloatReg = 4
+	lastFloatReg  = 11
+)
+
+// floatOperators are the binary operators whose result is a float when
+// either operand is
+var floatOperators = map[string]bool{"+": true, "-": true, "*": true, "/": true, "//": true, "%": true, "**": true}
+
+// isFloat reports whether e evaluates to a float
+func (g *CodeGenerator) isFloat(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.FloatLiteral:
+		return true
+	case *ast.Identifier:
+		return e.Symbol != nil && e.Symbol.Type == symbol.FloatType
+	case *ast.FunctionCall:
+		return g.returns[e.Function] == symbol.FloatType
+	case *ast.PrefixExpression:
+		return e.Operator == "-" && g.isFloat(e.Right)
+	case *ast.BinaryExpression:
+		return floatOperators[e.Operator] && (g.isFloat(e.Left) || g.isFloat(e.Right))
+	}
+	return false
+}
+
+// inferTypes makes every word-sized variable that is ever assigned a float
+// a float variable, one assigned a concatenation a string and a dictionary
+// with any string value one of strings, which the binder only infers from
+// literals. Parameters and return values follow the same rule: a parameter
+// passed a float or a string at any call takes that type, as does a
+// function returning one. It repeats until nothing changes, as
+// y = x * 2 only becomes a float assignment once x is known to be one.
+func (g *CodeGenerator) inferTypes(program *ast.Program) {
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*ast.FunctionDefinition); ok {
+			g.definitions[fn.Name] = fn
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		ast.Rewrite(program, func(n ast.Node) ast.Node {
+			switch n := n.(type) {
+			case *ast.FunctionDefinition:
+				if t := g.returnType(n); t != g.returns[n.Name] && g.returns[n.Name] != symbol.FloatType {
+					g.returns[n.Name] = t
+					changed = true
+				}
+			case *ast.FunctionCall:
+				if fn := g.definitions[n.Function]; fn != nil && len(fn.Params) == len(n.Arguments) {
+					for i, param := range fn.Params {
+						if values, ok := g.listOf(n.Arguments[i]); ok && param.Type == symbol.IntegerType {
+							param.Type, param.Values, param.Rows = symbol.ListType, values, g.rowsOf(n.Arguments[i])
+							changed = true
+						} else if t := g.valueType(n.Arguments[i]); param.Type == symbol.IntegerType && t != symbol.IntegerType {
+							param.Type = t
+							changed = true
+						}
+					}
+				}
+			}
+			a, ok := n.(*ast.AssignmentStatement)
+			if !ok || a.Symbol == nil || a.Symbol.Storage.Size != 0 {
+				return n
+			}
+			switch {
+			case a.Symbol.Type != symbol.FloatType && g.isFloat(a.Value):
+				// Callers pass a float parameter any number converted
+				a.Symbol.Type = symbol.FloatType
+				changed = true
+			case a.Symbol.IsParam:
+				// Any other type of a parameter's comes from its arguments
+			case a.Symbol.Type == symbol.IntegerType && g.isString(a.Value):
+				a.Symbol.Type = symbol.StringType
+				changed = true
+			case (a.Symbol.Type == symbol.DictType || a.Symbol.Type == symbol.ListType) && a.Symbol.Values != symbol.StringType && g.holdsStrings(a.Value):
+				a.Symbol.Values = symbol.StringType
+				changed = true
+			case a.Symbol.Type == symbol.IntegerType && g.isList(a.Value):
+				values, _ := g.listOf(a.Value)
+				a.Symbol.Type, a.Symbol.Values, a.Symbol.Rows = symbol.ListType, values, g.rowsOf(a.Value)
+				changed = true
+			}
+			return n
+		})
+	}
+}
+
+// valueType is FloatType, StringType or ListType for an expression of that
+// type and IntegerType for any other
+func (g *CodeGenerator) valueType(e ast.Expression) symbol.SymbolType {
+	switch {
+	case g.isFloat(e):
+		return symbol.FloatType
+	case g.isString(e):
+		return symbol.StringType
+	case g.isList(e):
+		return symbol.ListType
+	}
+	return symbol.IntegerType
+}
+
+// returnType is the type of the values fn returns: a float if any is one,
+// else a string if any is one
+func (g *CodeGenerator) returnType(fn *ast.FunctionDefinition) symbol.SymbolType {
+	t := symbol.IntegerType
+	ast.Rewrite(fn, func(n ast.Node) ast.Node {
+		if r, ok := n.(*ast.ReturnStatement); ok && r.Value != nil {
+			if v := g.valueType(r.Value); v == symbol.FloatType || t == symbol.IntegerType {
+				t = v
+			}
+		}
+		return n
+	})
+	return t
+}
+
+// addFloatLiteral returns the label of lit, which the code about to be
+// written refers to
+func (g *CodeGenerator) addFloatLiteral(lit *ast.FloatLiteral) string {
+	label := g.internFloat(lit)
+	g.usedData[label] = true
+	return label
+}
+
+func (g *CodeGenerator) internFloat(lit *ast.FloatLiteral) string {
+	value := lit.String()
+	if label, exists := g.floatMap[value]; exists {
+		return label
+	}
+	label := fmt.Sprintf("flt_%d", len(g.floatMap))
+	g.floatMap[value] = label
+	g.floatOrder = append(g.floatOrder, value)
+	return label
+}
+
+func (g *CodeGenerator) allocateFloat() int {
+	for i := firstFloatReg; i <= lastFloatReg; i++ {
+		if !g.usedFloats[i] {
+			g.usedFloats[i] = true
+			return i
+		}
+	}
+	return lastFloatReg
+}
+
+func (g *CodeGenerator) freeFloat(reg int) {
+	if reg >= firstFloatReg && reg <= lastFloatReg {
+		g.usedFloats[reg] = false
+	}
+}
+
+// generateFloat evaluates e into a fresh $f register, converting an integer
+// value to a float
+func (g *CodeGenerator) generateFloat(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.FloatLiteral:
+		reg := g.allocateFloat()
+		g.output.WriteString(fmt.Sprintf("    l.s $f%d, %s\n", reg, g.addFloatLiteral(e)))
+		return reg
+	case *ast.Identifier:
+		if g.isFloat(e) {
+			reg := g.allocateFloat()
+			g.output.WriteString(fmt.Sprintf("    l.s $f%d, %s\n", reg, g.address(e.Symbol)))
+			return reg
+		}
+	case *ast.PrefixExpression:
+		if g.isFloat(e) {
+			reg := g.generateFloat(e.Right)
+			g.output.WriteString(fmt.Sprintf("    neg.s $f%d, $f%d\n", reg, reg))
+			return reg
+		}
+	case *ast.BinaryExpression:
+		if g.isFloat(e) {
+			return g.generateFloatArithmetic(e)
+		}
+	case *ast.FunctionCall:
+		// The callee returns a float's bits in $v0
+		if g.isFloat(e) {
+			reg := g.generateFunctionCall(e)
+			if reg < 0 {
+				return -1
+			}
+			freg := g.allocateFloat()
+			g.output.WriteString(fmt.Sprintf("    mtc1 $t%d, $f%d\n", reg, freg))
+			g.freeRegister(reg)
+			return freg
+		}
+	}
+	reg := g.generateExpression(e)
+	if reg < 0 {
+		return -1
+	}
+	freg := g.allocateFloat()
+	g.output.WriteString(fmt.Sprintf("    mtc1 $t%d, $f%d\n", reg, freg))
+	g.output.WriteString(fmt.Sprintf("    cvt.s.w $f%d, $f%d\n", freg, freg))
+	g.freeRegister(reg)
+	return freg
+}
+
+// floatBits evaluates e as a float and moves its bits to a $t register,
+// which is how a float is passed to a function
+func (g *CodeGenerator) floatBits(e ast.Expression) int {
+	freg := g.generateFloat(e)
+	if freg < 0 {
+		return -1
+	}
+	reg := g.allocateRegister()
+	g.output.WriteString(fmt.Sprintf("    mfc1 $t%d, $f%d\n", reg, freg))
+	g.freeFloat(freg)
+	return reg
+}
+
+// truncateFloat evaluates a float expression and converts it to an integer
+// in a $t register, dropping the fraction as Python's int() does
+func (g *CodeGenerator) truncateFloat(e ast.Expression) int {
+	freg := g.generateFloat(e)
+	if freg < 0 {
+		return -1
+	}
+	reg := g.allocateRegister()
+	g.output.WriteString(fmt.Sprintf("    trunc.w.s $f%d, $f%d\n", freg, freg))
+	g.output.WriteString(fmt.Sprintf("    mfc1 $t%d, $f%d\n", reg, freg))
+	g.freeFloat(freg)
+	return reg
+}
+
+func (g *CodeGenerator) generateFloatArithmetic(e *ast.BinaryExpression) int {
+	if e.Operator == "**" {
+		return g.generateFloatPower(e)
+	}
+	left := g.generateFloat(e.Left)
+	right := g.generateFloat(e.Right)
+	if left < 0 || right < 0 {
+		g.freeFloat(left)
+		g.freeFloat(right)
+		return -1
+	}
+	result := g.allocateFloat()
+	switch e.Operator {
+	case "+":
+		g.output.WriteString(fmt.Sprintf("    add.s $f%d, $f%d, $f%d\n", result, left, right))
+	case "-":
+		g.output.WriteString(fmt.Sprintf("    sub.s $f%d, $f%d, $f%d\n", result, left, right))
+	case "*":
+		g.output.WriteString(fmt.Sprintf("    mul.s $f%d, $f%d, $f%d\n", result, left, right))
+	case "/", "//", "%":
+		g.generateFloatDivision(e.Operator, result, left, right)
+	}
+	g.freeFloat(left)
+	g.freeFloat(right)
+	return result
+}
+
+// generateFloatDivision divides like Python: // rounds the quotient down
+// and % is left - right * (left // right), taking the divisor's sign
+func (g *CodeGenerator) generateFloatDivision(op string, result, left, right int) {
+	if g.Options.Checked {
+		zero := g.allocateFloat()
+		g.output.WriteString(fmt.Sprintf("    mtc1 $zero, $f%d\n", zero))
+		g.output.WriteString(fmt.Sprintf("    c.eq.s $f%d, $f%d\n", right, zero))
+		g.output.WriteString(fmt.Sprintf("    bc1t %s\n", g.coldAbort(divisionMessage)))
+		g.freeFloat(zero)
+	}
+	g.output.WriteString(fmt.Sprintf("    div.s $f%d, $f%d, $f%d\n", result, left, right))
+	if op == "/" {
+		return
+	}
+	g.output.WriteString(fmt.Sprintf("    floor.w.s $f%d, $f%d\n", result, result))
+	g.output.WriteString(fmt.Sprintf("    cvt.s.w $f%d, $f%d\n", result, result))
+	if op == "%" {
+		g.output.WriteString(fmt.Sprintf("    mul.s $f%d, $f%d, $f%d\n", result, result, right))
+		g.output.WriteString(fmt.Sprintf("    sub.s $f%d, $f%d, $f%d\n", result, left, result))
+	}
+}
+
+// generateFloatPower raises a float base to an integer power by repeated
+// squaring, taking the reciprocal for a negative exponent. A float exponent
+// is truncated first.
+func (g *CodeGenerator) generateFloatPower(e *ast.BinaryExpression) int {
+	base := g.generateFloat(e.Left)
+	exp := g.generateExpression(e.Right)
+	if base < 0 || exp < 0 {
+		g.freeFloat(base)
+		g.freeRegister(exp)
+		return -1
+	}
+	result := g.allocateFloat()
+	bit, negative := g.allocateRegister(), g.allocateRegister()
+	defer g.freeRegister(negative)
+	defer g.freeRegister(bit)
+	defer g.freeRegister(exp)
+	defer g.freeFloat(base)
+	loop, skip, done := g.getUniqueLabel("pow_loop"), g.getUniqueLabel("pow_skip"), g.getUniqueLabel("pow_done")
+
+	g.loadImmediate(fmt.Sprintf("$t%d", bit), 1)
+	g.output.WriteString(fmt.Sprintf("    mtc1 $t%d, $f%d\n", bit, result))
+	g.output.WriteString(fmt.Sprintf("    cvt.s.w $f%d, $f%d\n", result, result))
+	g.output.WriteString(fmt.Sprintf("    slt $t%d, $t%d, $zero\n", negative, exp))
+	g.output.WriteString(fmt.Sprintf("    bgez $t%d, %s\n", exp, loop))
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, $zero, $t%d\n", g.op("subu"), exp, exp))
+	g.output.WriteString(fmt.Sprintf("%s:\n", loop))
+	g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", exp, done))
+	g.output.WriteString(fmt.Sprintf("    andi $t%d, $t%d, 1\n", bit, exp))
+	g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", bit, skip))
+	g.output.WriteString(fmt.Sprintf("    mul.s $f%d, $f%d, $f%d\n", result, result, base))
+	g.output.WriteString(fmt.Sprintf("%s:\n", skip))
+	g.output.WriteString(fmt.Sprintf("    mul.s $f%d, $f%d, $f%d\n", base, base, base))
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, 1\n", g.op("sra"), exp, exp))
+	g.output.WriteString(fmt.Sprintf("    j %s\n", loop))
+	g.output.WriteString(fmt.Sprintf("%s:\n", done))
+
+	// A negative exponent takes the reciprocal
+	positive := g.getUniqueLabel("pow_skip")
+	g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", negative, positive))
+	g.loadImmediate(fmt.Sprintf("$t%d", bit), 1)
+	g.output.WriteString(fmt.Sprintf("    mtc1 $t%d, $f%d\n", bit, base))
+	g.output.WriteString(fmt.Sprintf("    cvt.s.w $f%d, $f%d\n", base, base))
+	g.output.WriteString(fmt.Sprintf("    div.s $f%d, $f%d, $f%d\n", result, base, result))
+	g.output.WriteString(fmt.Sprintf("%s:\n", positive))
+	return result
+}
+
+// compareFloats sets the FPU condition flag for a comparison with a float
+// operand and reports whether a set flag means the comparison holds
+func (g *CodeGenerator) compareFloats(e *ast.BinaryExpression) (holdsWhenSet bool, ok bool) {
+	if !floatComparisons[e.Operator] {
+		return false, false
+	}
+	left := g.generateFloat(e.Left)
+	right := g.generateFloat(e.Right)
+	if left < 0 || right < 0 {
+		g.freeFloat(left)
+		g.freeFloat(right)
+		return false, false
+	}
+	holds := g.compareFloatRegisters(e.Operator, left, right)
+	g.freeFloat(left)
+	g.freeFloat(right)
+	return holds, true
+}
+
+var floatComparisons = map[string]bool{"<": true, ">": true, "<=": true, ">=": true, "==": true, "!=": true}
+
+// compareFloatRegisters sets the FPU condition flag from comparing $f<left>
+// with $f<right>, reporting whether a set flag means the comparison holds.
+// There is no c.ne.s, so != tests == and inverts the branch.
+func (g *CodeGenerator) compareFloatRegisters(op string, left, right int) bool {
+	cond, swap := "", false
+	switch op {
+	case "<":
+		cond = "c.lt.s"
+	case ">":
+		cond, swap = "c.lt.s", true
+	case "<=":
+		cond = "c.le.s"
+	case ">=":
+		cond, swap = "c.le.s", true
+	case "==", "!=":
+		cond = "c.eq.s"
+	}
+	if swap {
+		left, right = right, left
+	}
+	g.output.WriteString(fmt.Sprintf("    %s $f%d, $f%d\n", cond, left, right))
+	return op != "!="
+}
+
+// generateFloatComparison leaves 1 or 0 in a $t register
+func (g *CodeGenerator) generateFloatComparison(e *ast.BinaryExpression) int {
+	holds, ok := g.compareFloats(e)
+	if !ok {
+		return -1
+	}
+	reg := g.allocateRegister()
+	done := g.getUniqueLabel("fcmp_done")
+	branch := "bc1t"
+	if !holds {
+		branch = "bc1f"
+	}
+	g.loadImmediate(fmt.Sprintf("$t%d", reg), 1)
+	g.output.WriteString(fmt.Sprintf("    %s %s\n", branch, done))
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $zero\n", reg))
+	g.output.WriteString(fmt.Sprintf("%s:\n", done))
+	return reg
+}
+
+// hasFloatOperand reports whether a comparison must be made on the FPU
+func (g *CodeGenerator) hasFloatOperand(e *ast.BinaryExpression) bool {
+	return g.isFloat(e.Left) || g.isFloat(e.Right)
+}
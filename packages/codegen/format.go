@@ -0,0 +1,197 @@
+package codegen
+
+import (
+	"fmt"
+
+	"github.com/arifali123/152compiler/packages/ast"
+)
+
+// formatFunction is the builtin that turns an integer or a string into a
+// string, padded with spaces to an optional width. desugar lowers the %
+// operator on a format string to calls to it.
+const formatFunction = "format"
+
+const (
+	intToStrLabel = runtimePrefix + "int_to_str"
+	padLabel      = runtimePrefix + "pad"
+)
+
+// digitsBytes is room for the digits of any 64-bit integer, its sign and
+// the terminator
+const digitsBytes = 24
+
+// generateFormat evaluates format(value[, width]). A string is used as it
+// is and an integer is written out in decimal; either is then padded to
+// the width, on the left or, for a negative width, on the right.
+func (g *CodeGenerator) generateFormat(call *ast.FunctionCall) int {
+	value := call.Arguments[0]
+	var reg, width int
+	if len(call.Arguments) == 2 {
+		reg, width = g.generateOperands(value, call.Arguments[1])
+		if reg < 0 || width < 0 {
+			g.freeRegister(reg)
+			g.freeRegister(width)
+			return -1
+		}
+	} else if reg = g.generateExpression(value); reg < 0 {
+		return -1
+	}
+	if !g.isString(value) {
+		g.usesIntToStr = true
+		reg = g.callRuntime(intToStrLabel, reg)
+	}
+	if len(call.Arguments) == 2 {
+		g.usesPad = true
+		reg = g.callRuntime(padLabel, reg, width)
+	}
+	return reg
+}
+
+// writeIntToStr emits the routine that writes an integer out in decimal.
+// It takes room for the longest integer from sbrk and fills it from the
+// end. The digits come from the negated value, so the most negative
+// integer needs no special case. It only touches $a0-$a3 and $v0, and
+// restores those.
+func (g *CodeGenerator) writeIntToStr() {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", intToStrLabel, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", intToStrLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	g.loadImmediate("$a0", digitsBytes)
+	g.loadImmediate("$v0", int64(g.syscalls.Sbrk))
+	emit("syscall")
+	emit("%s $a3, $v0, %d", g.op("addiu"), digitsBytes-1)
+	emit("sb $zero, 0($a3)")
+
+	// $a1 holds -|n| and $a2 whether n was negative
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("slt $a2, $a1, $zero")
+	emit("bne $a2, $zero, %s_digits", intToStrLabel)
+	emit("%s $a1, $zero, $a1", g.op("subu"))
+	label("digits")
+	g.loadImmediate("$a0", 10)
+	emit("%s $a1, $a0", g.op("div"))
+	emit("mflo $a1")
+	// The remainder of a negative value is between -9 and 0
+	emit("mfhi $v0")
+	emit("%s $v0, $zero, $v0", g.op("subu"))
+	emit("%s $v0, $v0, %d", g.op("addiu"), '0')
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	emit("sb $v0, 0($a3)")
+	emit("bne $a1, $zero, %s_digits", intToStrLabel)
+	emit("beq $a2, $zero, %s_done", intToStrLabel)
+	g.loadImmediate("$v0", '-')
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	emit("sb $v0, 0($a3)")
+	label("done")
+	emit("%s $a3, %d($sp)", g.op("sw"), frame)
+
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
+
+// writePad emits the routine that pads a string with spaces to a width:
+// on the left, right-aligning it, or on the right for a negative width. A
+// string already as wide is returned as it is rather than copied. It only
+// touches $a0-$a3 and $v0, and restores those.
+func (g *CodeGenerator) writePad() {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", padLabel, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", padLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a2, %d($sp)", g.op("lw"), frame+word)
+
+	// $a3 counts the bytes of the string
+	emit("move $a3, $zero")
+	emit("move $a0, $a1")
+	label("len")
+	emit("lbu $v0, 0($a0)")
+	emit("beq $v0, $zero, %s_measured", padLabel)
+	emit("%s $a3, $a3, 1", g.op("addiu"))
+	emit("%s $a0, $a0, 1", g.op("addiu"))
+	emit("j %s_len", padLabel)
+	label("measured")
+
+	// $a0 is the width without its sign, and $a3 becomes the spaces needed
+	emit("move $a0, $a2")
+	emit("slt $v0, $a2, $zero")
+	emit("beq $v0, $zero, %s_wide", padLabel)
+	emit("%s $a0, $zero, $a2", g.op("subu"))
+	label("wide")
+	emit("slt $v0, $a3, $a0")
+	emit("beq $v0, $zero, %s_done", padLabel)
+	emit("%s $a3, $a0, $a3", g.op("subu"))
+	emit("%s $a0, $a0, 1", g.op("addiu"))
+	g.loadImmediate("$v0", int64(g.syscalls.Sbrk))
+	emit("syscall")
+	emit("%s $v0, %d($sp)", g.op("sw"), frame)
+	emit("slt $a0, $a2, $zero")
+	emit("bne $a0, $zero, %s_left", padLabel)
+
+	// Right-aligned: the spaces, then the string with its terminator
+	label("lead")
+	emit("beq $a3, $zero, %s_copy", padLabel)
+	g.loadImmediate("$a0", ' ')
+	emit("sb $a0, 0($v0)")
+	emit("%s $v0, $v0, 1", g.op("addiu"))
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	emit("j %s_lead", padLabel)
+	label("copy")
+	emit("lbu $a0, 0($a1)")
+	emit("sb $a0, 0($v0)")
+	emit("%s $a1, $a1, 1", g.op("addiu"))
+	emit("%s $v0, $v0, 1", g.op("addiu"))
+	emit("bne $a0, $zero, %s_copy", padLabel)
+	emit("j %s_done", padLabel)
+
+	// Left-aligned: the string without its terminator, then the spaces
+	label("left")
+	emit("lbu $a0, 0($a1)")
+	emit("beq $a0, $zero, %s_trail", padLabel)
+	emit("sb $a0, 0($v0)")
+	emit("%s $a1, $a1, 1", g.op("addiu"))
+	emit("%s $v0, $v0, 1", g.op("addiu"))
+	emit("j %s_left", padLabel)
+	label("trail")
+	emit("beq $a3, $zero, %s_end", padLabel)
+	g.loadImmediate("$a0", ' ')
+	emit("sb $a0, 0($v0)")
+	emit("%s $v0, $v0, 1", g.op("addiu"))
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	emit("j %s_trail", padLabel)
+	label("end")
+	emit("sb $zero, 0($v0)")
+
+	label("done")
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
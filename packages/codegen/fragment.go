@@ -0,0 +1,68 @@
+package codegen
+
+import (
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/bind"
+	"github.com/arifali123/152compiler/packages/desugar"
+	"github.com/arifali123/152compiler/packages/gensym"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+// session is what GenerateStatement keeps between calls with the same env:
+// the lowered statements generated so far, which later ones may call into
+// and whose strings keep their labels
+type session struct {
+	env   *symbol.SymbolTable
+	stmts []ast.Statement
+	names *gensym.Generator // numbers the session's labels
+}
+
+// GenerateStatement returns the instructions for stmt on its own as
+// top-level code, one per element without indentation; a function
+// definition gives the function. stmt is lowered first, as the whole
+// program would be. The names stmt uses are bound in env, the global scope,
+// which keeps the variables defined from one call to the next and may be
+// nil to start an empty one. Calls with the same env also share the
+// functions defined and the labels handed out so far, so a string keeps
+// its label from one statement to the next and no other label is reused. Strings, runtime routines and
+// the blocks a checked statement aborts through are referred to by label
+// but not written.
+func (g *CodeGenerator) GenerateStatement(stmt ast.Statement, env *symbol.SymbolTable) []string {
+	if env == nil {
+		env = symbol.NewSymbolTable(nil)
+	}
+	if g.session.env != env {
+		g.session = session{env: env, names: g.newNames()}
+	}
+	lowered := desugar.Program(&ast.Program{Statements: []ast.Statement{stmt}}).Statements
+	for _, s := range lowered {
+		bind.Statement(s, env)
+	}
+	g.session.stmts = append(g.session.stmts, lowered...)
+	g.reset(env)
+	g.names = g.session.names
+	// Collecting every statement so far numbers the strings in the same
+	// order each time
+	g.collectSymbols(&ast.Program{Statements: g.session.stmts})
+
+	g.frame = newEntryFrame()
+	g.frames = append(g.frames, g.frame)
+	for _, s := range lowered {
+		g.generateNode(s)
+	}
+	for _, fn := range g.functions {
+		g.generateFunction(fn)
+	}
+	g.frame = nil
+
+	var instructions []string
+	for _, line := range strings.Split(g.output.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			instructions = append(instructions, line)
+		}
+	}
+	g.output.Reset()
+	return instructions
+}
@@ -0,0 +1,214 @@
+package codegen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+// Slot is one register-sized word in a stack frame, addressed relative to $fp
+type Slot struct {
+	Name   string
+	Offset int
+	Note   string
+}
+
+// Frame describes the stack layout of one generated function. $fp points at
+// the caller's $sp, so every slot lives at a negative offset from it.
+type Frame struct {
+	Name   string
+	Size   int
+	Params []string
+	Slots  []Slot
+	entry  bool // top-level code, which has no frame of its own
+	temps  map[int]bool
+	canary int // offset of the canary slot, 0 without one
+}
+
+func newEntryFrame() *Frame {
+	return &Frame{Name: "main", entry: true, temps: make(map[int]bool)}
+}
+
+// initLabel is the routine the top-level statements become when
+// Options.Entry names another function to run after them
+const initLabel = runtimePrefix + "init"
+
+// newInitFrame lays out that routine's frame, which only saves $ra and $fp
+func newInitFrame(word int) *Frame {
+	f := newFrame(initLabel, nil, nil, word, false)
+	f.entry = true
+	return f
+}
+
+// canarySlot names the sentinel slot in the layout
+const canarySlot = "(canary)"
+
+// canaryValue is the sentinel a checked function keeps below its frame
+const canaryValue = -559038737 // 0xdeadbeef
+
+// newFrame lays out a function's frame for registers of word bytes: its
+// parameters, then its local variables, then a canary slot below everything
+// else when canary is set. The size is kept a multiple of two words so $sp
+// stays aligned.
+func newFrame(name string, params, locals []string, word int, canary bool) *Frame {
+	f := &Frame{Name: name, Params: params, temps: make(map[int]bool)}
+	f.Slots = append(f.Slots,
+		Slot{Name: "$ra", Offset: -word, Note: "return address"},
+		Slot{Name: "$fp", Offset: -2 * word, Note: "caller's frame pointer"},
+	)
+	for i, p := range params {
+		f.Slots = append(f.Slots, Slot{Name: p, Offset: -(3 + i) * word, Note: fmt.Sprintf("parameter, passed in $a%d", i)})
+	}
+	for _, l := range locals {
+		f.Slots = append(f.Slots, Slot{Name: l, Offset: -(len(f.Slots) + 1) * word, Note: "local variable"})
+	}
+	if canary {
+		f.canary = -(len(f.Slots) + 1) * word
+		f.Slots = append(f.Slots, Slot{Name: canarySlot, Offset: f.canary, Note: "sentinel checked before returning"})
+	}
+	f.Size = (word*len(f.Slots) + 2*word - 1) &^ (2*word - 1)
+	return f
+}
+
+// offset returns the $fp-relative offset of a parameter or local variable
+func (f *Frame) offset(name string) (int, bool) {
+	if f == nil {
+		return 0, false
+	}
+	for _, s := range f.Slots {
+		if s.Name == name {
+			return s.Offset, true
+		}
+	}
+	return 0, false
+}
+
+// writeCanary stores the sentinel in the current frame's canary slot
+func (g *CodeGenerator) writeCanary() {
+	g.loadImmediate("$t0", canaryValue)
+	g.output.WriteString(fmt.Sprintf("    %s $t0, %d($fp)\n", g.op("sw"), g.frame.canary))
+}
+
+// initLocals gives each local variable the value a global starts with, 0 or
+// the sentinel under -checked, so reading one before it is assigned behaves
+// the same wherever the variable lives
+func (g *CodeGenerator) initLocals(locals []*symbol.Symbol) {
+	loaded := false
+	for _, sym := range locals {
+		offset, _ := g.frame.offset(sym.Name)
+		reg := "$zero"
+		if g.poisoned(sym) {
+			if !loaded {
+				g.loadImmediate("$t0", canaryValue)
+				loaded = true
+			}
+			reg = "$t0"
+		}
+		g.output.WriteString(fmt.Sprintf("    %s %s, %d($fp)\n", g.op("sw"), reg, offset))
+	}
+}
+
+// checkCanary aborts the program with a message when the sentinel was
+// overwritten while the function ran. $v0 holds the result, so only
+// temporaries are used until the check passes.
+func (g *CodeGenerator) checkCanary() {
+	g.output.WriteString(fmt.Sprintf("    %s $t0, %d($fp)\n", g.op("lw"), g.frame.canary))
+	g.loadImmediate("$t1", canaryValue)
+	g.output.WriteString(fmt.Sprintf("    bne $t0, $t1, %s\n", g.coldAbort(canaryMessage(g.frame.Name))))
+}
+
+// DefaultMaxDepth is the call depth a checked program aborts beyond when
+// Options.MaxDepth is not set, Python's default recursion limit
+const DefaultMaxDepth = 1000
+
+// depthLabel is the word counting the calls under way in a checked program
+const depthLabel = runtimePrefix + "depth"
+
+const depthMessage = "maximum recursion depth exceeded\n"
+
+// enterCall counts the current function's call and aborts the program when
+// that makes more than the maximum depth, before a runaway recursion can
+// exhaust the stack
+func (g *CodeGenerator) enterCall() {
+	limit := g.Options.MaxDepth
+	if limit == 0 {
+		limit = DefaultMaxDepth
+	}
+	g.output.WriteString(fmt.Sprintf("    %s $t0, %s\n", g.op("lw"), depthLabel))
+	g.output.WriteString(fmt.Sprintf("    %s $t0, $t0, 1\n", g.op("addiu")))
+	g.output.WriteString(fmt.Sprintf("    %s $t0, %s\n", g.op("sw"), depthLabel))
+	g.loadImmediate("$t1", int64(limit))
+	g.output.WriteString("    slt $t1, $t1, $t0\n")
+	g.output.WriteString(fmt.Sprintf("    bne $t1, $zero, %s\n", g.coldAbort(depthMessage)))
+}
+
+// leaveCall uncounts the current function's call. Like checkCanary it
+// leaves $v0 alone.
+func (g *CodeGenerator) leaveCall() {
+	g.output.WriteString(fmt.Sprintf("    %s $t0, %s\n", g.op("lw"), depthLabel))
+	g.output.WriteString(fmt.Sprintf("    %s $t0, $t0, -1\n", g.op("addiu")))
+	g.output.WriteString(fmt.Sprintf("    %s $t0, %s\n", g.op("sw"), depthLabel))
+}
+
+func canaryMessage(function string) string {
+	return fmt.Sprintf("stack frame of '%s' was overwritten\n", function)
+}
+
+// Temps returns the temporary registers the function body used, in order
+func (f *Frame) Temps() []int {
+	var regs []int
+	for r := range f.temps {
+		regs = append(regs, r)
+	}
+	sort.Ints(regs)
+	return regs
+}
+
+// Frames returns the layouts recorded by the last call to Generate
+func (g *CodeGenerator) Frames() []*Frame {
+	return g.frames
+}
+
+// Symbols returns the global scope the last call to Generate bound
+func (g *CodeGenerator) Symbols() *symbol.SymbolTable {
+	return g.symbolTable
+}
+
+// Loops returns the labels of every while loop in the last generated program
+func (g *CodeGenerator) Loops() []LoopLabels {
+	return g.loops
+}
+
+func (g *CodeGenerator) writeFrameTrailer(globals []string) {
+	g.output.WriteString("\n# Frame layout\n")
+	for _, f := range g.frames {
+		g.output.WriteString("#\n")
+		if f.entry && f.Size == 0 {
+			g.output.WriteString("# main: no stack frame\n")
+		} else {
+			name := f.Name
+			if label := g.funcLabel(f.Name); label != f.Name && !f.entry {
+				name += " (as " + label + ")"
+			}
+			g.output.WriteString(fmt.Sprintf("# %s: %d byte frame\n", name, f.Size))
+			for _, s := range f.Slots {
+				g.output.WriteString(fmt.Sprintf("#   %4d($fp)  %-6s %s\n", s.Offset, s.Name, s.Note))
+			}
+		}
+		if f.entry && len(globals) > 0 {
+			g.output.WriteString(fmt.Sprintf("#   globals in .data: %s\n", strings.Join(globals, ", ")))
+		}
+		if temps := f.Temps(); len(temps) > 0 {
+			names := make([]string, len(temps))
+			for i, r := range temps {
+				names[i] = fmt.Sprintf("$t%d", r)
+			}
+			g.output.WriteString(fmt.Sprintf("#   temporaries: %s\n", strings.Join(names, ", ")))
+		}
+		if !f.entry {
+			g.output.WriteString("#   result in $v0\n")
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package codegen
+
+import "fmt"
+
+// coldBlock is code that rarely runs, such as the abort after a failed
+// check. It is kept out of line so the path that passes the check falls
+// through instead of branching around it.
+type coldBlock struct {
+	label   string
+	message string
+	line    int
+}
+
+// coldAbort returns the label of a block that prints message and exits.
+// The block is written after the current function, or after main's exit,
+// and checks in one function failing with the same message share it.
+func (g *CodeGenerator) coldAbort(message string) string {
+	for _, b := range g.cold {
+		if b.message == message {
+			return b.label
+		}
+	}
+	label := g.getUniqueLabel("cold")
+	g.cold = append(g.cold, coldBlock{label: label, message: message, line: g.line})
+	return label
+}
+
+// writeColdBlocks emits the blocks coldAbort handed out since the last call
+func (g *CodeGenerator) writeColdBlocks() {
+	for _, b := range g.cold {
+		g.mark(b.line)
+		g.output.WriteString(fmt.Sprintf("%s:\n", b.label))
+		g.abort(b.message)
+	}
+	if len(g.cold) > 0 {
+		g.mark(g.line)
+	}
+	g.cold = nil
+}
@@ -0,0 +1,677 @@
+package codegen
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+const (
+	listCopyLabel  = runtimePrefix + "list_copy"
+	sortLabel      = runtimePrefix + "sort"
+	reverseLabel   = runtimePrefix + "reverse"
+	printListLabel = runtimePrefix + "print_list"
+	sumLabel       = runtimePrefix + "sum"
+	minLabel       = runtimePrefix + "min"
+	maxLabel       = runtimePrefix + "max"
+	zerosLabel     = runtimePrefix + "zeros"
+)
+
+// zerosFunction is the builtin that makes a rows by cols list of lists of
+// zeros
+const zerosFunction = "zeros"
+
+// indexMessage is printed when a checked program indexes past either end
+// of a list
+const indexMessage = "list index out of range\n"
+
+// emptyMessage is printed when min or max is given an empty list
+func emptyMessage(function string) string {
+	return fmt.Sprintf("%s() of an empty list\n", function)
+}
+
+// listFunctions are the builtins that take a list
+var listFunctions = map[string]bool{"len": true, "sorted": true, "reversed": true, "sum": true, "min": true, "max": true}
+
+// A list is laid out like a dictionary: the number of elements, what they
+// are, then each element, one word apiece. A list of lists holds the address
+// of each row, which is a list of its own, rather than every element in one
+// row-major block: a row can then be read, printed, measured or passed on
+// like any other list, and rows may differ in length.
+
+// The kinds of element the second word of a list records
+const (
+	integerElements = 0
+	stringElements  = 1
+	listElements    = 2
+)
+
+// generateList builds a list literal on the heap
+func (g *CodeGenerator) generateList(e *ast.ListLiteral) int {
+	word := g.Options.Target.WordBytes()
+	size := g.allocateRegister()
+	g.loadImmediate(fmt.Sprintf("$t%d", size), int64((2+len(e.Elements))*word))
+	g.usesAlloc = true
+	list := g.callRuntime(allocLabel, size)
+
+	kind := int64(integerElements)
+	switch values, _ := g.listOf(e); values {
+	case symbol.StringType:
+		kind = stringElements
+	case symbol.ListType:
+		kind = listElements
+	}
+	header := g.allocateRegister()
+	g.loadImmediate(fmt.Sprintf("$t%d", header), int64(len(e.Elements)))
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($t%d)\n", g.op("sw"), header, list))
+	g.loadImmediate(fmt.Sprintf("$t%d", header), kind)
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, %d($t%d)\n", g.op("sw"), header, word, list))
+	g.freeRegister(header)
+
+	for i, element := range e.Elements {
+		reg := g.generateExpression(element)
+		if reg < 0 {
+			continue
+		}
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, %d($t%d)\n", g.op("sw"), reg, (2+i)*word, list))
+		g.freeRegister(reg)
+	}
+	return list
+}
+
+// listOf reports whether e evaluates to a list, and the type of its
+// elements. A list a function returns is taken to hold integers.
+func (g *CodeGenerator) listOf(e ast.Expression) (symbol.SymbolType, bool) {
+	switch e := e.(type) {
+	case *ast.ListLiteral:
+		for _, element := range e.Elements {
+			if g.isString(element) {
+				return symbol.StringType, true
+			}
+			if g.isList(element) {
+				return symbol.ListType, true
+			}
+		}
+		return symbol.IntegerType, true
+	case *ast.Identifier:
+		if e.Symbol != nil && e.Symbol.Type == symbol.ListType {
+			return e.Symbol.Values, true
+		}
+	case *ast.IndexExpression:
+		// A row of a list of lists
+		if values, ok := g.listOf(e.Left); ok && values == symbol.ListType {
+			return g.rowsOf(e.Left), true
+		}
+	case *ast.FunctionCall:
+		if e.Method {
+			return "", false
+		}
+		if (e.Function == "sorted" || e.Function == "reversed") && len(e.Arguments) == 1 {
+			return g.listOf(e.Arguments[0])
+		}
+		if e.Function == zerosFunction {
+			return symbol.ListType, true
+		}
+		if g.returns[e.Function] == symbol.ListType {
+			return symbol.IntegerType, true
+		}
+	}
+	return "", false
+}
+
+// rowsOf is the type of the elements of the rows of e, a list of lists
+func (g *CodeGenerator) rowsOf(e ast.Expression) symbol.SymbolType {
+	switch e := e.(type) {
+	case *ast.ListLiteral:
+		for _, element := range e.Elements {
+			if values, _ := g.listOf(element); values == symbol.StringType {
+				return values
+			}
+		}
+	case *ast.Identifier:
+		if e.Symbol != nil && e.Symbol.Rows != "" {
+			return e.Symbol.Rows
+		}
+	case *ast.FunctionCall:
+		if !e.Method && len(e.Arguments) == 1 {
+			return g.rowsOf(e.Arguments[0])
+		}
+	}
+	return symbol.IntegerType
+}
+
+// isList reports whether e evaluates to the address of a list
+func (g *CodeGenerator) isList(e ast.Expression) bool {
+	_, ok := g.listOf(e)
+	return ok
+}
+
+// generateListIndex loads an element of a list
+func (g *CodeGenerator) generateListIndex(e *ast.IndexExpression) int {
+	reg := g.elementAddress(e)
+	if reg >= 0 {
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($t%d)\n", g.op("lw"), reg, reg))
+	}
+	return reg
+}
+
+// generateIndexAssignment stores a value in an element of a list. As in
+// Python, the value is evaluated before the element it goes to.
+func (g *CodeGenerator) generateIndexAssignment(s *ast.IndexAssignment) {
+	value := g.generateExpression(s.Value)
+	if value < 0 {
+		return
+	}
+	if addr := g.elementAddress(s.Target); addr >= 0 {
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($t%d)\n", g.op("sw"), value, addr))
+		g.freeRegister(addr)
+	}
+	g.freeRegister(value)
+}
+
+// elementAddress computes the address of an element of a list. Indexing a
+// row of a list of lists, as in grid[i][j], first loads the row's address
+// from its list. A negative literal index counts from the end, as in
+// Python. With Checked, an index outside the list aborts the program.
+func (g *CodeGenerator) elementAddress(e *ast.IndexExpression) int {
+	word := g.Options.Target.WordBytes()
+	listReg, indexReg := g.generateOperands(e.Left, e.Index)
+	if listReg < 0 || indexReg < 0 {
+		g.freeRegister(listReg)
+		g.freeRegister(indexReg)
+		return -1
+	}
+	if lit, ok := e.Index.(*ast.IntegerLiteral); ok && lit.Value < 0 {
+		count := g.allocateRegister()
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($t%d)\n", g.op("lw"), count, listReg))
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("add"), indexReg, indexReg, count))
+		g.freeRegister(count)
+	}
+	if g.Options.Checked {
+		// Compared unsigned, a negative index is past the end too
+		inside := g.allocateRegister()
+		g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($t%d)\n", g.op("lw"), inside, listReg))
+		g.output.WriteString(fmt.Sprintf("    sltu $t%d, $t%d, $t%d\n", inside, indexReg, inside))
+		g.output.WriteString(fmt.Sprintf("    beq $t%d, $zero, %s\n", inside, g.coldAbort(indexMessage)))
+		g.freeRegister(inside)
+	}
+	g.output.WriteString(fmt.Sprintf("    sll $t%d, $t%d, %d\n", indexReg, indexReg, bits.TrailingZeros(uint(word))))
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, $t%d\n", g.op("add"), listReg, listReg, indexReg))
+	g.freeRegister(indexReg)
+	g.output.WriteString(fmt.Sprintf("    %s $t%d, $t%d, %d\n", g.op("addiu"), listReg, listReg, 2*word))
+	return listReg
+}
+
+// generateListCall evaluates len, sum, min, max, sorted and reversed, and
+// the sort and reverse methods. sorted and reversed work on a copy; the methods change
+// the list itself and give None.
+func (g *CodeGenerator) generateListCall(call *ast.FunctionCall) int {
+	if len(call.Arguments) == 0 {
+		return -1
+	}
+	reg := g.generateExpression(call.Arguments[0])
+	if reg < 0 {
+		return -1
+	}
+	if !call.Method {
+		switch call.Function {
+		case "len":
+			g.output.WriteString(fmt.Sprintf("    %s $t%d, 0($t%d)\n", g.op("lw"), reg, reg))
+			return reg
+		case "sum":
+			g.usesSum = true
+			return g.callRuntime(sumLabel, reg)
+		case "min":
+			g.usesMin = true
+			return g.callRuntime(minLabel, reg)
+		case "max":
+			g.usesMax = true
+			return g.callRuntime(maxLabel, reg)
+		}
+	}
+	if !call.Method {
+		g.usesListCopy = true
+		reg = g.callRuntime(listCopyLabel, reg)
+	}
+	if call.Function == "sort" || call.Function == "sorted" {
+		g.usesSort = true
+		reg = g.callRuntime(sortLabel, reg)
+	} else {
+		g.usesReverse = true
+		reg = g.callRuntime(reverseLabel, reg)
+	}
+	if !call.Method {
+		return reg
+	}
+	g.freeRegister(reg)
+	if call.Discarded {
+		return -1
+	}
+	reg = g.allocateRegister()
+	g.output.WriteString(fmt.Sprintf("    move $t%d, $zero\n", reg))
+	return reg
+}
+
+// generateZeros builds the list of lists zeros(rows, cols) gives. The sizes
+// are only known at run time, and each call must give new rows, so the
+// memory comes from sbrk rather than a .space the calls would share.
+func (g *CodeGenerator) generateZeros(call *ast.FunctionCall) int {
+	if len(call.Arguments) != 2 {
+		return -1
+	}
+	rows, cols := g.generateOperands(call.Arguments[0], call.Arguments[1])
+	if rows < 0 || cols < 0 {
+		g.freeRegister(rows)
+		g.freeRegister(cols)
+		return -1
+	}
+	g.usesZeros = true
+	return g.callRuntime(zerosLabel, rows, cols)
+}
+
+// printList prints a list the way Python shows one, as [1, 2, 3] or
+// ['a', 'b']
+func (g *CodeGenerator) printList(value ast.Expression) {
+	if reg := g.generateExpression(value); reg >= 0 {
+		g.usesPrintList = true
+		g.freeRegister(g.callRuntime(printListLabel, reg))
+	}
+}
+
+// writeListCopy emits the routine that copies a list, its header included,
+// into new memory from sbrk. It only touches $a0-$a3 and $v0, and restores
+// those.
+func (g *CodeGenerator) writeListCopy() {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", listCopyLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	// $a2 counts the words to copy: the elements and the header
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a2, 0($a1)", g.op("lw"))
+	emit("%s $a2, $a2, 2", g.op("addiu"))
+	emit("sll $a0, $a2, %d", bits.TrailingZeros(uint(word)))
+	g.loadImmediate("$v0", int64(g.syscalls.Sbrk))
+	emit("syscall")
+	emit("%s $v0, %d($sp)", g.op("sw"), frame)
+	g.output.WriteString(fmt.Sprintf("%s_next:\n", listCopyLabel))
+	emit("%s $a3, 0($a1)", g.op("lw"))
+	emit("%s $a3, 0($v0)", g.op("sw"))
+	emit("%s $a1, $a1, %d", g.op("addiu"), word)
+	emit("%s $v0, $v0, %d", g.op("addiu"), word)
+	emit("%s $a2, $a2, -1", g.op("addiu"))
+	emit("bne $a2, $zero, %s_next", listCopyLabel)
+
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
+
+// writeZeros emits the routine generateZeros calls. It takes the number of
+// rows and of columns, counting a negative one as none, and leaves a new
+// list of that many rows, each a new list of that many zeros. It only
+// touches $a0-$a3, $v0 and $v1, and restores those.
+func (g *CodeGenerator) writeZeros() {
+	word := g.Options.Target.WordBytes()
+	shift := bits.TrailingZeros(uint(word))
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0", "$v1"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", zerosLabel, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", zerosLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	// $a1 counts the rows left to make and $a2 is the length of each
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a2, %d($sp)", g.op("lw"), frame+word)
+	emit("bgez $a1, %s_rows", zerosLabel)
+	emit("move $a1, $zero")
+	label("rows")
+	emit("bgez $a2, %s_cols", zerosLabel)
+	emit("move $a2, $zero")
+	label("cols")
+
+	// The outer list, whose slots $v1 walks as each row is made
+	emit("%s $a0, $a1, 2", g.op("addiu"))
+	emit("sll $a0, $a0, %d", shift)
+	g.loadImmediate("$v0", int64(g.syscalls.Sbrk))
+	emit("syscall")
+	emit("%s $v0, %d($sp)", g.op("sw"), frame)
+	emit("%s $a1, 0($v0)", g.op("sw"))
+	g.loadImmediate("$a3", listElements)
+	emit("%s $a3, %d($v0)", g.op("sw"), word)
+	emit("%s $v1, $v0, %d", g.op("addiu"), 2*word)
+
+	label("row")
+	emit("beq $a1, $zero, %s_done", zerosLabel)
+	emit("%s $a0, $a2, 2", g.op("addiu"))
+	emit("sll $a0, $a0, %d", shift)
+	g.loadImmediate("$v0", int64(g.syscalls.Sbrk))
+	emit("syscall")
+	emit("%s $v0, 0($v1)", g.op("sw"))
+	emit("%s $a2, 0($v0)", g.op("sw"))
+	emit("%s $zero, %d($v0)", g.op("sw"), word)
+	emit("%s $v0, $v0, %d", g.op("addiu"), 2*word)
+	emit("move $a3, $a2")
+	label("zero")
+	emit("beq $a3, $zero, %s_next", zerosLabel)
+	emit("%s $zero, 0($v0)", g.op("sw"))
+	emit("%s $v0, $v0, %d", g.op("addiu"), word)
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	emit("j %s_zero", zerosLabel)
+	label("next")
+	emit("%s $v1, $v1, %d", g.op("addiu"), word)
+	emit("%s $a1, $a1, -1", g.op("addiu"))
+	emit("j %s_row", zerosLabel)
+
+	label("done")
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
+
+// writeSort emits the routine that sorts a list in place by insertion and
+// leaves it as its result. Strings are ordered by their bytes, and equal
+// elements keep their order. It only touches $a0-$a3, $v0, $v1 and
+// $t0-$t4, and restores those.
+func (g *CodeGenerator) writeSort() {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0", "$v1", "$t0", "$t1", "$t2", "$t3", "$t4"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", sortLabel, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", sortLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	// $a1 points at the first element and $a3 just past the last, and $v1
+	// says whether they are strings
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a3, 0($a1)", g.op("lw"))
+	emit("%s $v1, %d($a1)", g.op("lw"), word)
+	emit("%s $a1, $a1, %d", g.op("addiu"), 2*word)
+	emit("sll $a3, $a3, %d", bits.TrailingZeros(uint(word)))
+	emit("%s $a3, $a1, $a3", g.op("add"))
+
+	// $a2 walks the elements after the first; each in turn is held in $t1
+	// while those before it that are greater move up a slot, found by $t0
+	emit("%s $a2, $a1, %d", g.op("addiu"), word)
+	label("outer")
+	emit("sltu $v0, $a2, $a3")
+	emit("beq $v0, $zero, %s_done", sortLabel)
+	emit("%s $t1, 0($a2)", g.op("lw"))
+	emit("move $t0, $a2")
+	label("inner")
+	emit("beq $t0, $a1, %s_place", sortLabel)
+	emit("%s $t2, %d($t0)", g.op("lw"), -word)
+	emit("beq $v1, $zero, %s_ints", sortLabel)
+	emit("move $a0, $t2")
+	emit("move $t3, $t1")
+	label("compare")
+	emit("lbu $v0, 0($a0)")
+	emit("lbu $t4, 0($t3)")
+	emit("bne $v0, $t4, %s_differ", sortLabel)
+	emit("beq $v0, $zero, %s_place", sortLabel)
+	emit("%s $a0, $a0, 1", g.op("addiu"))
+	emit("%s $t3, $t3, 1", g.op("addiu"))
+	emit("j %s_compare", sortLabel)
+	label("differ")
+	emit("sltu $v0, $t4, $v0")
+	emit("j %s_decide", sortLabel)
+	label("ints")
+	emit("slt $v0, $t1, $t2")
+	label("decide")
+	emit("beq $v0, $zero, %s_place", sortLabel)
+	emit("%s $t2, 0($t0)", g.op("sw"))
+	emit("%s $t0, $t0, %d", g.op("addiu"), -word)
+	emit("j %s_inner", sortLabel)
+	label("place")
+	emit("%s $t1, 0($t0)", g.op("sw"))
+	emit("%s $a2, $a2, %d", g.op("addiu"), word)
+	emit("j %s_outer", sortLabel)
+
+	label("done")
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
+
+// writeReverse emits the routine that reverses a list in place and leaves
+// it as its result, swapping elements from both ends until they meet. It
+// only touches $a0-$a3 and $v0, and restores those.
+func (g *CodeGenerator) writeReverse() {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", reverseLabel, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", reverseLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	// $a1 points at the first element and $a2 at the last
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a3, 0($a1)", g.op("lw"))
+	emit("%s $a1, $a1, %d", g.op("addiu"), 2*word)
+	emit("sll $a3, $a3, %d", bits.TrailingZeros(uint(word)))
+	emit("%s $a2, $a1, $a3", g.op("add"))
+	emit("%s $a2, $a2, %d", g.op("addiu"), -word)
+	label("next")
+	emit("sltu $v0, $a1, $a2")
+	emit("beq $v0, $zero, %s_done", reverseLabel)
+	emit("%s $a0, 0($a1)", g.op("lw"))
+	emit("%s $v0, 0($a2)", g.op("lw"))
+	emit("%s $v0, 0($a1)", g.op("sw"))
+	emit("%s $a0, 0($a2)", g.op("sw"))
+	emit("%s $a1, $a1, %d", g.op("addiu"), word)
+	emit("%s $a2, $a2, %d", g.op("addiu"), -word)
+	emit("j %s_next", reverseLabel)
+
+	label("done")
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
+
+// writeSum emits the routine that adds up the elements of a list. It only
+// touches $a0, $a1, $a3 and $v0, and restores those.
+func (g *CodeGenerator) writeSum() {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a3", "$v0"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", sumLabel, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", sumLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	// $a1 walks the elements, $a3 counts those left and $v0 is the total
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a3, 0($a1)", g.op("lw"))
+	emit("%s $a1, $a1, %d", g.op("addiu"), 2*word)
+	emit("move $v0, $zero")
+	label("next")
+	emit("beq $a3, $zero, %s_done", sumLabel)
+	emit("%s $a0, 0($a1)", g.op("lw"))
+	emit("%s $v0, $v0, $a0", g.op("add"))
+	emit("%s $a1, $a1, %d", g.op("addiu"), word)
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	emit("j %s_next", sumLabel)
+	label("done")
+	emit("%s $v0, %d($sp)", g.op("sw"), frame)
+
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
+
+// writeExtreme emits the routine at label that finds the least element of
+// a list for min, or the greatest for max. An empty list prints
+// emptyMessage and exits. It only touches $a0-$a3 and $v0, and restores
+// those.
+func (g *CodeGenerator) writeExtreme(label, function string) {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	local := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", label, suffix))
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", label))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	// $a1 walks the elements, $a3 counts those left and $v0 is the best so
+	// far, which starts as the first
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a3, 0($a1)", g.op("lw"))
+	emit("beq $a3, $zero, %s_empty", label)
+	emit("%s $v0, %d($a1)", g.op("lw"), 2*word)
+	emit("%s $a1, $a1, %d", g.op("addiu"), 3*word)
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	local("next")
+	emit("beq $a3, $zero, %s_done", label)
+	emit("%s $a0, 0($a1)", g.op("lw"))
+	if function == "min" {
+		emit("slt $a2, $a0, $v0")
+	} else {
+		emit("slt $a2, $v0, $a0")
+	}
+	emit("beq $a2, $zero, %s_skip", label)
+	emit("move $v0, $a0")
+	local("skip")
+	emit("%s $a1, $a1, %d", g.op("addiu"), word)
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	emit("j %s_next", label)
+	local("done")
+	emit("%s $v0, %d($sp)", g.op("sw"), frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+
+	local("empty")
+	g.abort(emptyMessage(function))
+}
+
+// writePrintList emits the routine printList calls. Strings are printed in
+// single quotes, as Python shows them inside a list, and each row of a list
+// of lists by the routine calling itself. It only touches $a0-$a3, $v0 and
+// $ra, and restores those.
+func (g *CodeGenerator) writePrintList() {
+	word := g.Options.Target.WordBytes()
+	saved := []string{"$a0", "$a1", "$a2", "$a3", "$v0", "$ra"}
+	frame := len(saved) * word
+	emit := func(format string, args ...interface{}) {
+		g.output.WriteString(fmt.Sprintf("    "+format+"\n", args...))
+	}
+	label := func(suffix string) {
+		g.output.WriteString(fmt.Sprintf("%s_%s:\n", printListLabel, suffix))
+	}
+	printChar := func(c byte) {
+		g.loadImmediate("$a0", int64(c))
+		g.loadImmediate("$v0", int64(g.syscalls.PrintChar))
+		emit("syscall")
+	}
+
+	g.output.WriteString(fmt.Sprintf("%s:\n", printListLabel))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -frame)
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("sw"), reg, i*word)
+	}
+	// $a1 walks the elements, $a3 counts those left and $a2 says what they
+	// are
+	emit("%s $a1, %d($sp)", g.op("lw"), frame)
+	emit("%s $a3, 0($a1)", g.op("lw"))
+	emit("%s $a2, %d($a1)", g.op("lw"), word)
+	emit("%s $a1, $a1, %d", g.op("addiu"), 2*word)
+	printChar('[')
+	emit("beq $a3, $zero, %s_close", printListLabel)
+	emit("j %s_element", printListLabel)
+	label("next")
+	printChar(',')
+	printChar(' ')
+	label("element")
+	emit("beq $a2, $zero, %s_int", printListLabel)
+	g.loadImmediate("$v0", listElements)
+	emit("beq $a2, $v0, %s_row", printListLabel)
+	printChar('\'')
+	emit("%s $a0, 0($a1)", g.op("lw"))
+	g.loadImmediate("$v0", int64(g.syscalls.PrintString))
+	emit("syscall")
+	printChar('\'')
+	emit("j %s_step", printListLabel)
+	label("row")
+	emit("%s $a0, 0($a1)", g.op("lw"))
+	emit("%s $sp, $sp, %d", g.op("addiu"), -word)
+	emit("%s $a0, 0($sp)", g.op("sw"))
+	emit("jal %s", printListLabel)
+	emit("%s $sp, $sp, %d", g.op("addiu"), word)
+	emit("j %s_step", printListLabel)
+	label("int")
+	emit("%s $a0, 0($a1)", g.op("lw"))
+	g.loadImmediate("$v0", int64(g.syscalls.PrintInt))
+	emit("syscall")
+	label("step")
+	emit("%s $a1, $a1, %d", g.op("addiu"), word)
+	emit("%s $a3, $a3, -1", g.op("addiu"))
+	emit("bne $a3, $zero, %s_next", printListLabel)
+	label("close")
+	printChar(']')
+
+	for i, reg := range saved {
+		emit("%s %s, %d($sp)", g.op("lw"), reg, i*word)
+	}
+	emit("%s $sp, $sp, %d", g.op("addiu"), frame)
+	emit("jr $ra")
+}
@@ -0,0 +1,113 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+)
+
+// LineMark records that the assembly from Offset on, up to the next mark,
+// was generated for source line Line. Line is 0 for code that belongs to
+// no statement, such as the data section and main's exit.
+type LineMark struct {
+	Offset int
+	Line   int
+}
+
+// SourceMap returns the line marks recorded by the last call to Generate,
+// in increasing Offset order
+func (g *CodeGenerator) SourceMap() []LineMark {
+	return g.marks
+}
+
+// Line returns the source line of the statement being generated, or 0
+// when there is none, for reporting where generation failed
+func (g *CodeGenerator) Line() int {
+	return g.line
+}
+
+// mark attributes the output from here on to source line
+func (g *CodeGenerator) mark(line int) {
+	offset := g.output.Len()
+	if n := len(g.marks); n > 0 && g.marks[n-1].Offset == offset {
+		g.marks = g.marks[:n-1]
+	}
+	if n := len(g.marks); n > 0 && g.marks[n-1].Line == line {
+		return
+	}
+	g.marks = append(g.marks, LineMark{Offset: offset, Line: line})
+}
+
+// enterStatement attributes the code generated for stmt to its line and
+// returns a function that hands the output back to the enclosing statement
+func (g *CodeGenerator) enterStatement(stmt ast.Statement) func() {
+	outer := g.line
+	if line := statementLine(stmt); line > 0 {
+		g.line = line
+	}
+	g.mark(g.line)
+	return func() {
+		g.line = outer
+		g.mark(outer)
+	}
+}
+
+// statementLine is the source line a statement starts on, or 0 if unknown
+func statementLine(stmt ast.Statement) int {
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		return s.Token.Line
+	case *ast.AugmentedAssignment:
+		return s.Token.Line
+	case *ast.IndexAssignment:
+		return s.Token.Line
+	case *ast.PrintStatement:
+		return s.Token.Line
+	case *ast.ReturnStatement:
+		return s.Token.Line
+	case *ast.IfStatement:
+		return s.Token.Line
+	case *ast.WhileStatement:
+		return s.Token.Line
+	case *ast.FunctionDefinition:
+		return s.Token.Line
+	case *ast.ExpressionStatement:
+		switch e := s.Expression.(type) {
+		case *ast.FunctionCall:
+			return e.Token.Line
+		case *ast.Identifier:
+			return e.Token.Line
+		}
+	}
+	return 0
+}
+
+// Listing interleaves the lines of source with the assembly generated for
+// them. Each source line is printed, numbered, before the first assembly
+// attributed to it, with that assembly indented below it.
+func Listing(source, asm string, marks []LineMark) string {
+	src := strings.Split(source, "\n")
+	var out strings.Builder
+	offset, next, line := 0, 0, 0
+	for _, text := range strings.SplitAfter(asm, "\n") {
+		if text == "" {
+			break
+		}
+		for next < len(marks) && marks[next].Offset <= offset {
+			if l := marks[next].Line; l != line {
+				line = l
+				if line > 0 && line <= len(src) {
+					out.WriteString(fmt.Sprintf("%4d  %s\n", line, strings.TrimRight(src[line-1], "\r")))
+				}
+			}
+			next++
+		}
+		offset += len(text)
+		if line > 0 {
+			out.WriteString("        ")
+		}
+		out.WriteString(text)
+	}
+	return out.String()
+}
@@ -0,0 +1,102 @@
+package codegen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Macros is a MARS macro prelude, written at the top of the output. Where it
+// defines one of the macros below with the parameters shown, the generated
+// code calls it instead of the system call sequence it stands for:
+//
+//	print_int(%reg)    print the integer in a register
+//	print_str(%label)  print the string at a label
+//	exit               end the program
+type Macros struct {
+	prelude string
+	defined map[string]bool
+}
+
+// knownMacros maps each macro the code generator can call to its number of
+// parameters
+var knownMacros = map[string]int{"print_int": 1, "print_str": 1, "exit": 0}
+
+// ParseMacros reads the .macro definitions in prelude. It is an error for
+// the prelude to define none of the macros the code generator calls.
+func ParseMacros(prelude string) (*Macros, error) {
+	m := &Macros{prelude: prelude, defined: make(map[string]bool)}
+	for i, line := range strings.Split(prelude, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != ".macro" {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("macros: line %d: .macro without a name", i+1)
+		}
+		rest := strings.Join(fields[1:], " ")
+		name := rest
+		if end := strings.IndexAny(rest, " ("); end >= 0 {
+			name = rest[:end]
+		}
+		want, ok := knownMacros[name]
+		if ok && strings.Count(rest, "%") == want {
+			m.defined[name] = true
+		}
+	}
+	if len(m.defined) == 0 {
+		names := make([]string, 0, len(knownMacros))
+		for name := range knownMacros {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("macros: the prelude defines none of %s", strings.Join(names, ", "))
+	}
+	return m, nil
+}
+
+// Defines reports whether the prelude defines the named macro with the
+// parameters the code generator passes it
+func (m *Macros) Defines(name string) bool {
+	return m != nil && m.defined[name]
+}
+
+// printInt prints the integer in $t<reg>
+func (g *CodeGenerator) printInt(reg int) {
+	if g.Options.Macros.Defines("print_int") {
+		g.output.WriteString(fmt.Sprintf("    print_int($t%d)\n", reg))
+		return
+	}
+	g.output.WriteString(fmt.Sprintf("    move $a0, $t%d\n", reg))
+	g.loadImmediate("$v0", int64(g.syscalls.PrintInt))
+	g.output.WriteString("    syscall\n")
+}
+
+// printLabel prints the string at label
+func (g *CodeGenerator) printLabel(label string) {
+	if g.Options.Macros.Defines("print_str") {
+		g.output.WriteString(fmt.Sprintf("    print_str(%s)\n", label))
+		return
+	}
+	g.output.WriteString(fmt.Sprintf("    %s $a0, %s\n", g.op("la"), label))
+	g.loadImmediate("$v0", int64(g.syscalls.PrintString))
+	g.output.WriteString("    syscall\n")
+}
+
+// exit ends the program
+func (g *CodeGenerator) exit() {
+	if g.Options.Macros.Defines("exit") {
+		g.output.WriteString("    exit\n")
+		return
+	}
+	g.loadImmediate("$v0", int64(g.syscalls.Exit))
+	g.output.WriteString("    syscall\n")
+}
+
+// exitWith ends the program with status, which a plain exit leaves at 0
+func (g *CodeGenerator) exitWith(status int) {
+	g.loadImmediate("$a0", int64(status))
+	g.loadImmediate("$v0", int64(g.syscalls.ExitCode))
+	g.output.WriteString("    syscall\n")
+}
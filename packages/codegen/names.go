@@ -0,0 +1,104 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// mangledPrefix marks a user identifier that was renamed to stay clear of
+// compiler-emitted labels or register names. Generated labels never start
+// with it.
+const mangledPrefix = "u_"
+
+// escapedPrefix marks an identifier containing characters that are not valid
+// in a label; those characters are replaced by their hex code
+const escapedPrefix = "x_"
+
+// reservedLabels are fixed labels the generated program relies on
+var reservedLabels = map[string]bool{
+	"main":    true,
+	"newline": true,
+}
+
+// labelPrefixes are every prefix getUniqueLabel numbers labels with, which
+// refuses any other so a new one cannot be left out of generatedLabel
+var labelPrefixes = []string{
+	"if_true", "if_false", "if_end",
+	"while_start", "while_body", "while_end", "while_cond",
+	"func_exit", "cold",
+	"and_rhs", "or_rhs", "and_end", "or_end",
+	"div_done", "pow_loop", "pow_skip", "pow_done",
+	"cmp_end", "fcmp_fail", "fcmp_end", "fcmp_done",
+}
+
+// generatedLabel matches labels minted by addStringLiteral, getNextLabel and getUniqueLabel
+var generatedLabel = regexp.MustCompile(`^(L|str_|flt_|(` + strings.Join(labelPrefixes, "|") + `)_)\d+$`)
+
+// registerName matches register names an assembler may accept without the $
+var registerName = regexp.MustCompile(`^(zero|at|v[01]|a[0-3]|t[0-9]|s[0-8]|k[01]|gp|sp|fp|ra|f([0-9]|[12][0-9]|3[01]))$`)
+
+var validLabel = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// needsMangling reports whether a user identifier could collide with a
+// compiler label or a register. Names already carrying a prefix are mangled
+// again so the mapping stays one-to-one.
+func needsMangling(name string) bool {
+	return reservedLabels[name] || generatedLabel.MatchString(name) || registerName.MatchString(name) ||
+		strings.HasPrefix(name, mangledPrefix) || strings.HasPrefix(name, escapedPrefix) || strings.HasPrefix(name, runtimePrefix)
+}
+
+// escapeLabel rewrites a name that is not a valid label. Underscores are
+// doubled so neither an escape sequence nor the prefix can be confused with
+// the original text.
+func escapeLabel(name, prefix string) string {
+	var b strings.Builder
+	b.WriteString(escapedPrefix + prefix)
+	for _, r := range name {
+		switch {
+		case r == '_':
+			b.WriteString("__")
+		case r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, "_%x_", r)
+		}
+	}
+	return b.String()
+}
+
+func (g *CodeGenerator) mangle(name, prefix string) string {
+	var label string
+	switch {
+	case !validLabel.MatchString(name):
+		label = escapeLabel(name, prefix)
+	case prefix != "" || needsMangling(name):
+		label = mangledPrefix + prefix + name
+	default:
+		return name
+	}
+	g.labelNames[label] = name
+	return label
+}
+
+// funcLabel returns the assembly label for a user function
+func (g *CodeGenerator) funcLabel(name string) string {
+	return g.mangle(name, "")
+}
+
+// varLabel returns the assembly label for a global variable. A variable
+// sharing its name with a function gets its own prefix so the two labels
+// differ; no other name can produce it because safe names never start
+// with mangledPrefix and unsafe ones never start with "v_".
+func (g *CodeGenerator) varLabel(name string) string {
+	if g.funcNames[name] {
+		return g.mangle(name, "v_")
+	}
+	return g.mangle(name, "")
+}
+
+// SourceNames maps every renamed label in the last generated program back
+// to the identifier it came from, for diagnostics and debug output
+func (g *CodeGenerator) SourceNames() map[string]string {
+	return g.labelNames
+}
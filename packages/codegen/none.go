@@ -0,0 +1,73 @@
+package codegen
+
+import (
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+// noneText is what print shows for None
+const noneText = "None"
+
+// findVoidFunctions records the functions that never return a value. A call
+// to one evaluates to None, which is stored as 0.
+func (g *CodeGenerator) findVoidFunctions(prog *ast.Program) {
+	g.voidFuncs = make(map[string]bool)
+	for _, stmt := range prog.Statements {
+		if fn, ok := stmt.(*ast.FunctionDefinition); ok && !ast.ReturnsValue(fn) {
+			g.voidFuncs[fn.Name] = true
+		}
+	}
+}
+
+// isNone reports whether e is always None: the literal, a call to a void
+// function or a list method, or a variable that is only ever assigned None
+func (g *CodeGenerator) isNone(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.NoneLiteral:
+		return true
+	case *ast.FunctionCall:
+		return e.Method || g.voidFuncs[e.Function]
+	case *ast.Identifier:
+		return e.Symbol != nil && e.Symbol.Type == symbol.VoidType
+	}
+	return false
+}
+
+// inferVoid makes every integer variable whose assignments all give None a
+// VoidType variable, so print shows it as None rather than 0
+func (g *CodeGenerator) inferVoid(program *ast.Program) {
+	for changed := true; changed; {
+		changed = false
+		other := make(map[*symbol.Symbol]bool)
+		var none []*symbol.Symbol
+		ast.Rewrite(program, func(n ast.Node) ast.Node {
+			a, ok := n.(*ast.AssignmentStatement)
+			if !ok || a.Symbol == nil || a.Symbol.IsParam || a.Symbol.Type != symbol.IntegerType {
+				return n
+			}
+			if g.isNone(a.Value) {
+				none = append(none, a.Symbol)
+			} else {
+				other[a.Symbol] = true
+			}
+			return n
+		})
+		for _, sym := range none {
+			if !other[sym] && sym.Type != symbol.VoidType {
+				sym.Type = symbol.VoidType
+				changed = true
+			}
+		}
+	}
+}
+
+// printNone prints None for a value that is always None, evaluating it
+// first in case it is a call
+func (g *CodeGenerator) printNone(value ast.Expression) {
+	if call, ok := value.(*ast.FunctionCall); ok {
+		if reg := g.generateExpression(call); reg >= 0 {
+			g.freeRegister(reg)
+		}
+	}
+	g.printLabel(g.addStringLiteral(noneText))
+}
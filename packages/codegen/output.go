@@ -0,0 +1,96 @@
+package codegen
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/gensym"
+)
+
+// outputBuffer is how much assembly GenerateTo gathers before each write to
+// its io.Writer
+const outputBuffer = 32 << 10
+
+// sink is where the generator writes assembly: kept in memory to be read
+// back, or streamed through a buffered writer. It counts what went into it
+// from where it started, so offsets into the output are known either way.
+type sink struct {
+	w   *bufio.Writer // nil keeps the assembly in buf
+	buf strings.Builder
+	n   int
+}
+
+func (s *sink) WriteString(str string) (int, error) {
+	s.n += len(str)
+	if s.w != nil {
+		return s.w.WriteString(str)
+	}
+	return s.buf.WriteString(str)
+}
+
+// Len is the offset the next write lands at
+func (s *sink) Len() int {
+	return s.n
+}
+
+// String returns what was kept in memory
+func (s *sink) String() string {
+	return s.buf.String()
+}
+
+func (s *sink) Reset() {
+	*s = sink{}
+}
+
+// GenerateTo writes the assembly for node to w as Generate would return it,
+// buffered, and returns the first error writing it. The text section goes
+// to w as it is generated, so the program is never held in memory whole.
+//
+// The data section holds only what the text refers to, which is known once
+// the text has been generated. When the data section comes first, as it
+// does unless a Template puts {{text}} before {{data}}, the text is
+// generated twice: once into nothing to find what the data section needs,
+// then again after it has been written.
+func (g *CodeGenerator) GenerateTo(w io.Writer, node ast.Node) error {
+	if node == nil {
+		log.Println("Warning: nil node passed to Generate")
+		return nil
+	}
+	out := bufio.NewWriterSize(w, outputBuffer)
+	var before, between, after string
+	textFirst := false
+	if t := g.Options.Template; t != nil {
+		before, between, after = t.parts[0], t.parts[1], t.parts[2]
+		textFirst = t.first == placeholders[1]
+	}
+
+	out.WriteString(before)
+	if textFirst {
+		g.generateText(node, sink{w: out, n: len(before)})
+		out.WriteString(between)
+		g.output = sink{w: out}
+		g.writeData()
+	} else {
+		// The first pass must leave the label numbering where it found it
+		var names gensym.Generator
+		if g.Options.Names != nil {
+			names = *g.Options.Names
+		}
+		g.generateText(node, sink{w: bufio.NewWriterSize(io.Discard, outputBuffer)})
+		if g.Options.Names != nil {
+			*g.Options.Names = names
+		}
+		g.output = sink{}
+		g.writeData()
+		data := g.output.String()
+		out.WriteString(data)
+		out.WriteString(between)
+		g.generateText(node, sink{w: out, n: len(before) + len(data) + len(between)})
+	}
+	g.output = sink{}
+	out.WriteString(after)
+	return out.Flush()
+}
@@ -0,0 +1,131 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+// ParseLoopRegisters reads a comma-separated list of saved registers for
+// TargetDescription.LoopRegisters, such as "$s0,$s1"
+func ParseLoopRegisters(spec string) ([]string, error) {
+	var regs []string
+	seen := make(map[string]bool)
+	for _, reg := range strings.Split(spec, ",") {
+		reg = strings.TrimSpace(reg)
+		if reg == "" {
+			continue
+		}
+		if len(reg) != 3 || !strings.HasPrefix(reg, "$s") || reg[2] < '0' || reg[2] > '7' {
+			return nil, fmt.Errorf("loop register %q: expected a saved register, $s0 to $s7", reg)
+		}
+		if seen[reg] {
+			return nil, fmt.Errorf("loop register %s is listed twice", reg)
+		}
+		seen[reg] = true
+		regs = append(regs, reg)
+	}
+	return regs, nil
+}
+
+// pin is a variable kept in a saved register for the length of a loop
+type pin struct {
+	sym *symbol.Symbol
+	reg string
+}
+
+// loopPins picks the variables of loop to keep in the target's loop
+// registers: those its condition reads and its body assigns, in the order
+// the condition reads them. Only an innermost loop qualifies, and only one
+// that makes no calls and does not return, so nothing else can see the
+// variable while it is out of memory and the loop is always left through
+// its end.
+func (g *CodeGenerator) loopPins(loop *ast.WhileStatement) []pin {
+	regs := g.Options.Target.LoopRegisters
+	if len(regs) == 0 {
+		return nil
+	}
+	assigned := make(map[*symbol.Symbol]bool)
+	eligible := true
+	for _, stmt := range loop.Body {
+		ast.Rewrite(stmt, func(n ast.Node) ast.Node {
+			switch n := n.(type) {
+			case *ast.WhileStatement, *ast.ReturnStatement, *ast.FunctionCall:
+				eligible = false
+			case *ast.AssignmentStatement:
+				assigned[n.Symbol] = true
+			}
+			return n
+		})
+	}
+	ast.Rewrite(loop.Condition, func(n ast.Node) ast.Node {
+		if _, ok := n.(*ast.FunctionCall); ok {
+			eligible = false
+		}
+		return n
+	})
+	if !eligible {
+		return nil
+	}
+
+	var pins []pin
+	taken := make(map[*symbol.Symbol]bool)
+	ast.Rewrite(loop.Condition, func(n ast.Node) ast.Node {
+		id, ok := n.(*ast.Identifier)
+		if !ok || id.Symbol == nil || taken[id.Symbol] || len(pins) == len(regs) {
+			return n
+		}
+		sym := id.Symbol
+		if assigned[sym] && sym.Type == symbol.IntegerType && sym.Storage.Size == 0 && !g.registerTemps[sym] {
+			taken[sym] = true
+			pins = append(pins, pin{sym: sym, reg: regs[len(pins)]})
+		}
+		return n
+	})
+	return pins
+}
+
+// enterPins loads each pinned variable into its register. In a function
+// the registers' values are saved on the stack first, since the caller may
+// be keeping its own loop's variables in them.
+func (g *CodeGenerator) enterPins(pins []pin) {
+	if len(pins) == 0 {
+		return
+	}
+	word := g.Options.Target.WordBytes()
+	if g.currentFunction != "" {
+		size := (len(pins)*word + 2*word - 1) &^ (2*word - 1)
+		g.output.WriteString(fmt.Sprintf("    %s $sp, $sp, -%d\n", g.op("addiu"), size))
+		for i, p := range pins {
+			g.output.WriteString(fmt.Sprintf("    %s %s, %d($sp)\n", g.op("sw"), p.reg, i*word))
+		}
+	}
+	for _, p := range pins {
+		reg := g.loadVariable(p.sym)
+		g.output.WriteString(fmt.Sprintf("    move %s, $t%d\n", p.reg, reg))
+		g.freeRegister(reg)
+		g.pinned[p.sym] = p.reg
+	}
+}
+
+// leavePins stores each pinned variable back to memory and restores the
+// registers enterPins saved
+func (g *CodeGenerator) leavePins(pins []pin) {
+	if len(pins) == 0 {
+		return
+	}
+	for _, p := range pins {
+		delete(g.pinned, p.sym)
+		g.output.WriteString(fmt.Sprintf("    %s %s, %s\n", g.storeOp(p.sym), p.reg, g.address(p.sym)))
+	}
+	if g.currentFunction != "" {
+		word := g.Options.Target.WordBytes()
+		size := (len(pins)*word + 2*word - 1) &^ (2*word - 1)
+		for i, p := range pins {
+			g.output.WriteString(fmt.Sprintf("    %s %s, %d($sp)\n", g.op("lw"), p.reg, i*word))
+		}
+		g.output.WriteString(fmt.Sprintf("    %s $sp, $sp, %d\n", g.op("addiu"), size))
+	}
+}
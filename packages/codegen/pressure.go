@@ -0,0 +1,43 @@
+package codegen
+
+import "github.com/arifali123/152compiler/packages/ast"
+
+// registerNeed is the Sethi-Ullman number of e: how many registers
+// evaluating it takes when each binary node evaluates its hungrier operand
+// first. A call counts as one, as its result comes back in a single register.
+func registerNeed(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.BinaryExpression:
+		left, right := registerNeed(e.Left), registerNeed(e.Right)
+		if left == right {
+			return left + 1
+		}
+		return max(left, right)
+	case *ast.PrefixExpression:
+		return registerNeed(e.Right)
+	case *ast.Comparison:
+		// The result and the previous operand are held while each operand
+		// after the first is evaluated
+		need := 0
+		for _, operand := range e.Operands {
+			need = max(need, registerNeed(operand))
+		}
+		return need + 2
+	}
+	return 1
+}
+
+// generateOperands evaluates both operands of a binary operator and returns
+// their registers. The operand needing more registers goes first, so the
+// other's result is not held while it runs. Calls run in source order, as
+// Python does, so an operand containing one is never moved.
+func (g *CodeGenerator) generateOperands(left, right ast.Expression) (leftReg, rightReg int) {
+	if registerNeed(right) > registerNeed(left) && !containsCall(left) && !containsCall(right) {
+		rightReg = g.generateExpression(right)
+		leftReg = g.generateExpression(left)
+		return leftReg, rightReg
+	}
+	leftReg = g.generateExpression(left)
+	rightReg = g.generateExpression(right)
+	return leftReg, rightReg
+}
@@ -0,0 +1,197 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Size summarizes how big a generated program is. Instructions are counted
+// as written, so a pseudo-instruction such as li counts once however many
+// machine instructions the assembler expands it into.
+type Size struct {
+	Instructions int `json:"instructions"`
+	DataBytes    int `json:"dataBytes"`   // variables and other non-string data
+	StringBytes  int `json:"stringBytes"` // .asciiz contents including their terminators
+	Labels       int `json:"labels"`
+}
+
+var directiveBytes = map[string]int{".byte": 1, ".half": 2, ".word": 4, ".dword": 8}
+
+// Measure computes the Size of an assembly listing
+func Measure(asm string) Size {
+	var m sizer
+	for _, line := range strings.Split(asm, "\n") {
+		m.line(line)
+	}
+	return m.size
+}
+
+// sizer adds up a Size a line at a time
+type sizer struct {
+	size   Size
+	inData bool // past a .data directive and not yet back at .text
+}
+
+func (m *sizer) line(line string) {
+	line = strings.TrimSpace(stripAsmComment(line))
+	for {
+		colon := strings.Index(line, ":")
+		if colon < 0 || strings.ContainsAny(line[:colon], " \t\"") {
+			break
+		}
+		m.size.Labels++
+		line = strings.TrimSpace(line[colon+1:])
+	}
+	if line == "" {
+		return
+	}
+	word, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch {
+	case word == ".data":
+		m.inData = true
+	case word == ".text":
+		m.inData = false
+	case word == ".asciiz":
+		m.size.StringBytes += stringBytes(rest) + 1
+	case word == ".ascii":
+		m.size.StringBytes += stringBytes(rest)
+	case word == ".space":
+		n, _ := strconv.Atoi(rest)
+		m.size.DataBytes += n
+	case directiveBytes[word] > 0:
+		m.size.DataBytes += directiveBytes[word] * len(strings.Split(rest, ","))
+	case strings.HasPrefix(word, "."):
+	case !m.inData:
+		m.size.Instructions++
+	}
+}
+
+// Meter passes what is written to it on to W, measuring it as Measure
+// would, for assembly that is streamed rather than kept
+type Meter struct {
+	W       io.Writer
+	sizer   sizer
+	partial []byte // the start of a line not yet ended
+}
+
+func (m *Meter) Write(p []byte) (int, error) {
+	n, err := m.W.Write(p)
+	for rest := p[:n]; len(rest) > 0; {
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			m.partial = append(m.partial, rest...)
+			break
+		}
+		m.sizer.line(string(append(m.partial, rest[:end]...)))
+		m.partial, rest = m.partial[:0], rest[end+1:]
+	}
+	return n, err
+}
+
+// Size returns the Size of what has been written so far
+func (m *Meter) Size() Size {
+	last := m.sizer
+	last.line(string(m.partial))
+	return last.size
+}
+
+// stripAsmComment drops a trailing # comment that is not inside a string
+func stripAsmComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// stringBytes counts the bytes a quoted directive operand assembles to
+func stringBytes(quoted string) int {
+	body := strings.TrimSuffix(strings.TrimPrefix(quoted, "\""), "\"")
+	n := 0
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' {
+			i++
+		}
+		n++
+	}
+	return n
+}
+
+func (s Size) String() string {
+	return fmt.Sprintf("%d instructions, %d data bytes, %d string bytes, %d labels",
+		s.Instructions, s.DataBytes, s.StringBytes, s.Labels)
+}
+
+func (s *Size) limitFields() map[string]*int {
+	return map[string]*int{
+		"instructions": &s.Instructions,
+		"data":         &s.DataBytes,
+		"strings":      &s.StringBytes,
+		"labels":       &s.Labels,
+	}
+}
+
+// ParseLimits reads a comma-separated list of name=number caps such as
+// "instructions=500,data=1024". A field left at zero is not limited.
+func ParseLimits(spec string) (Size, error) {
+	var limits Size
+	fields := limits.limitFields()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return limits, fmt.Errorf("limit %q: expected name=number", entry)
+		}
+		field, known := fields[strings.TrimSpace(name)]
+		if !known {
+			return limits, fmt.Errorf("unknown limit %q (known: %s)", name, strings.Join(LimitNames(), ", "))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			return limits, fmt.Errorf("limit %q: invalid number %q", name, value)
+		}
+		*field = n
+	}
+	return limits, nil
+}
+
+// LimitNames lists the names ParseLimits accepts
+func LimitNames() []string {
+	var s Size
+	names := make([]string, 0, 4)
+	for name := range s.limitFields() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Exceeded describes each measure of s that is over its nonzero cap in limits
+func (s Size) Exceeded(limits Size) []string {
+	var over []string
+	have := s.limitFields()
+	for _, name := range LimitNames() {
+		limit := *limits.limitFields()[name]
+		if limit > 0 && *have[name] > limit {
+			over = append(over, fmt.Sprintf("%s: %d exceeds the limit of %d", name, *have[name], limit))
+		}
+	}
+	return over
+}
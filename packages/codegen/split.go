@@ -0,0 +1,44 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FunctionText locates one function's code, from its label to its final
+// jr $ra, as a byte range of the generated assembly
+type FunctionText struct {
+	Name       string
+	Start, End int
+}
+
+// FunctionTexts returns where each function ended up in the assembly
+// returned by the last call to Generate, in output order
+func (g *CodeGenerator) FunctionTexts() []FunctionText {
+	return g.functionTexts
+}
+
+// SplitFile is one function's code moved out of the main assembly file
+type SplitFile struct {
+	Function string
+	Name     string
+	Text     string
+}
+
+// Split moves each function in asm out to its own file, named by fileName,
+// and leaves a MARS .include directive in its place. Expanding every include
+// in the returned main file gives back asm exactly.
+func Split(asm string, funcs []FunctionText, fileName func(function string) string) (string, []SplitFile) {
+	var main strings.Builder
+	files := make([]SplitFile, 0, len(funcs))
+	last := 0
+	for _, f := range funcs {
+		name := fileName(f.Name)
+		main.WriteString(asm[last:f.Start])
+		main.WriteString(fmt.Sprintf(".include \"%s\"\n", name))
+		files = append(files, SplitFile{Function: f.Name, Name: name, Text: asm[f.Start:f.End]})
+		last = f.End
+	}
+	main.WriteString(asm[last:])
+	return main.String(), files
+}
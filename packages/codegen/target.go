@@ -0,0 +1,261 @@
+package codegen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dialect selects which assembler conveniences the generated code may rely on
+type Dialect int
+
+const (
+	// DialectMARS uses pseudo-instructions such as li that MARS and SPIM expand
+	DialectMARS Dialect = iota
+	// DialectBare emits only real instructions for constants, for assemblers
+	// without pseudo-instruction expansion
+	DialectBare
+)
+
+// TargetDescription describes the machine and assembler the output is for.
+// The zero value is the MARS target.
+type TargetDescription struct {
+	Name    string
+	Dialect Dialect
+
+	// WordSize is the register width in bits, 32 or 64. Zero means 32.
+	WordSize int
+
+	// Syscalls overrides the service numbers loaded into $v0
+	Syscalls SyscallTable
+
+	// Endian is the byte order of the simulator's memory. Data directives
+	// are laid out by the assembler in that order, so the output only
+	// changes by an "# endian:" header declaring it when it is stated.
+	Endian Endianness
+
+	// LoopRegisters are saved registers reserved for loop counters, to
+	// match hand-written code that keeps them out of memory. The variables
+	// an innermost loop's condition reads and its body assigns are kept in
+	// them, in order, from entering the loop to leaving it. Empty keeps
+	// every variable in memory.
+	LoopRegisters []string
+}
+
+// Endianness is the byte order multi-byte values are stored in
+type Endianness int
+
+const (
+	// EndianUnstated leaves the order to the simulator; MARS and SPIM are
+	// little-endian
+	EndianUnstated Endianness = iota
+	LittleEndian
+	BigEndian
+)
+
+func (e Endianness) String() string {
+	switch e {
+	case LittleEndian:
+		return "little"
+	case BigEndian:
+		return "big"
+	}
+	return "unstated"
+}
+
+// ParseEndianness reads "little" or "big"
+func ParseEndianness(name string) (Endianness, error) {
+	switch name {
+	case "little":
+		return LittleEndian, nil
+	case "big":
+		return BigEndian, nil
+	}
+	return EndianUnstated, fmt.Errorf("unknown byte order %q (known: big, little)", name)
+}
+
+// SyscallTable holds the $v0 service number for each runtime call the
+// generated code makes. A zero entry uses the MARS number.
+type SyscallTable struct {
+	PrintInt    int
+	PrintString int
+	ReadInt     int
+	ReadString  int
+	Exit        int
+	ExitCode    int
+	PrintChar   int
+	PrintFloat  int
+	Sbrk        int
+}
+
+// marsSyscalls are the service numbers MARS and SPIM use
+var marsSyscalls = SyscallTable{PrintInt: 1, PrintString: 4, ReadInt: 5, ReadString: 8, Exit: 10, ExitCode: 17, PrintChar: 11, PrintFloat: 2, Sbrk: 9}
+
+// syscallFields maps the names accepted by ParseSyscalls to table entries
+func (s *SyscallTable) syscallFields() map[string]*int {
+	return map[string]*int{
+		"print_int":    &s.PrintInt,
+		"print_string": &s.PrintString,
+		"read_int":     &s.ReadInt,
+		"read_string":  &s.ReadString,
+		"exit":         &s.Exit,
+		"exit_code":    &s.ExitCode,
+		"print_char":   &s.PrintChar,
+		"print_float":  &s.PrintFloat,
+		"sbrk":         &s.Sbrk,
+	}
+}
+
+// Resolved returns the table with every zero entry replaced by its MARS number
+func (s SyscallTable) Resolved() SyscallTable {
+	defaults := marsSyscalls
+	want := defaults.syscallFields()
+	for name, field := range s.syscallFields() {
+		if *field == 0 {
+			*field = *want[name]
+		}
+	}
+	return s
+}
+
+// ParseSyscalls reads a comma-separated list of name=number overrides such
+// as "print_int=1,exit=93"
+func ParseSyscalls(spec string) (SyscallTable, error) {
+	var table SyscallTable
+	fields := table.syscallFields()
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return table, fmt.Errorf("syscall %q: expected name=number", entry)
+		}
+		field, known := fields[strings.TrimSpace(name)]
+		if !known {
+			return table, fmt.Errorf("unknown syscall %q (known: %s)", name, strings.Join(SyscallNames(), ", "))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			return table, fmt.Errorf("syscall %q: invalid number %q", name, value)
+		}
+		*field = n
+	}
+	return table, nil
+}
+
+// SyscallNames lists the names ParseSyscalls accepts
+func SyscallNames() []string {
+	var s SyscallTable
+	names := make([]string, 0, 8)
+	for name := range s.syscallFields() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bits returns the register width in bits
+func (t TargetDescription) Bits() int {
+	if t.WordSize == 64 {
+		return 64
+	}
+	return 32
+}
+
+// WordBytes returns the size of a register, stack slot or global in bytes
+func (t TargetDescription) WordBytes() int {
+	return t.Bits() / 8
+}
+
+// doubleword maps the 32-bit mnemonics codegen uses to their MIPS64 forms
+var doubleword = map[string]string{
+	"lw":    "ld",
+	"sw":    "sd",
+	"la":    "dla",
+	"add":   "daddu",
+	"addiu": "daddiu",
+	"sub":   "dsubu",
+	"subu":  "dsubu",
+	"mul":   "dmul",
+	"div":   "ddiv",
+	"sra":   "dsra",
+	".word": ".dword",
+}
+
+// op returns the mnemonic or directive to use for name on the current target
+func (g *CodeGenerator) op(name string) string {
+	if g.Options.Target.Bits() == 64 {
+		if wide, ok := doubleword[name]; ok {
+			return wide
+		}
+	}
+	return name
+}
+
+var targets = map[string]TargetDescription{
+	"mars": {Name: "mars", Dialect: DialectMARS},
+	"bare": {Name: "bare", Dialect: DialectBare},
+}
+
+// LookupTarget returns the named built-in target
+func LookupTarget(name string) (TargetDescription, bool) {
+	t, ok := targets[name]
+	return t, ok
+}
+
+// TargetNames lists the built-in targets
+func TargetNames() []string {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadImmediate puts a constant in reg. On a 32-bit target values outside
+// 32 bits wrap, as they would in the target's registers.
+func (g *CodeGenerator) loadImmediate(reg string, value int64) {
+	if g.Options.Target.Bits() == 64 && value != int64(int32(value)) {
+		g.loadWideImmediate(reg, value)
+		return
+	}
+	v := int32(value)
+	if g.Options.Target.Dialect != DialectBare {
+		g.output.WriteString(fmt.Sprintf("    li %s, %d\n", reg, v))
+		return
+	}
+
+	switch {
+	case v >= -32768 && v <= 32767:
+		g.output.WriteString(fmt.Sprintf("    addiu %s, $zero, %d\n", reg, v))
+	case v >= 0 && v <= 0xffff:
+		g.output.WriteString(fmt.Sprintf("    ori %s, $zero, %d\n", reg, v))
+	default:
+		hi, lo := uint32(v)>>16, uint32(v)&0xffff
+		g.output.WriteString(fmt.Sprintf("    lui %s, %d\n", reg, hi))
+		if lo != 0 {
+			g.output.WriteString(fmt.Sprintf("    ori %s, %s, %d\n", reg, reg, lo))
+		}
+	}
+}
+
+// loadWideImmediate loads a constant that does not fit in 32 bits. The bare
+// dialect loads the upper half as a 32-bit value, then shifts in the lower
+// half 16 bits at a time.
+func (g *CodeGenerator) loadWideImmediate(reg string, value int64) {
+	if g.Options.Target.Dialect != DialectBare {
+		g.output.WriteString(fmt.Sprintf("    dli %s, %d\n", reg, value))
+		return
+	}
+	g.loadImmediate(reg, value>>32)
+	for _, half := range []uint64{uint64(value) >> 16 & 0xffff, uint64(value) & 0xffff} {
+		g.output.WriteString(fmt.Sprintf("    dsll %s, %s, 16\n", reg, reg))
+		if half != 0 {
+			g.output.WriteString(fmt.Sprintf("    ori %s, %s, %d\n", reg, reg, half))
+		}
+	}
+}
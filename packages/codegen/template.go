@@ -0,0 +1,64 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Template is text written around the generated assembly, such as the
+// header comments a course requires or .include lines for its macro files.
+// The generated .data section replaces {{data}} and the .text section,
+// functions and runtime routines replace {{text}}.
+type Template struct {
+	parts [3]string // the text before, between and after the placeholders
+	first string    // the placeholder that comes first
+}
+
+var placeholders = []string{"{{data}}", "{{text}}"}
+
+// ParseTemplate reads a template, which must hold {{data}} and {{text}}
+// once each and no other placeholder
+func ParseTemplate(text string) (*Template, error) {
+	for rest := text; ; {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("template: unclosed %q", rest[start:min(len(rest), start+12)])
+		}
+		name := rest[start : start+end+2]
+		if name != placeholders[0] && name != placeholders[1] {
+			return nil, fmt.Errorf("template: unknown placeholder %s; expected %s", name, strings.Join(placeholders, " and "))
+		}
+		rest = rest[start+end+2:]
+	}
+	for _, p := range placeholders {
+		if n := strings.Count(text, p); n != 1 {
+			return nil, fmt.Errorf("template: %s must appear once, found %d", p, n)
+		}
+	}
+
+	t := &Template{first: placeholders[0]}
+	if strings.Index(text, placeholders[1]) < strings.Index(text, placeholders[0]) {
+		t.first = placeholders[1]
+	}
+	second := placeholders[0]
+	if t.first == second {
+		second = placeholders[1]
+	}
+	before, rest, _ := strings.Cut(text, t.first)
+	between, after, _ := strings.Cut(rest, second)
+	t.parts = [3]string{before, between, after}
+	return t, nil
+}
+
+// pieces lays data and text out in the template, returning the strings to
+// write in order and the offset text starts at in them
+func (t *Template) pieces(data, text string) ([]string, int) {
+	if t.first == placeholders[1] {
+		return []string{t.parts[0], text, t.parts[1], data, t.parts[2]}, len(t.parts[0])
+	}
+	return []string{t.parts[0], data, t.parts[1], text, t.parts[2]}, len(t.parts[0]) + len(data) + len(t.parts[1])
+}
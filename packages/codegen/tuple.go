@@ -0,0 +1,81 @@
+package codegen
+
+import (
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+// maxHeldTemps caps how many values of one tuple assignment are held in
+// registers at once, leaving the rest of the temporaries for evaluating them
+const maxHeldTemps = 6
+
+// findRegisterTemps picks the hidden temporaries of tuple assignments that
+// can live in a register from their assignment to their one read instead of
+// in .data. A temporary qualifies when it holds an integer or string, is
+// read, and belongs to an assignment of at most maxHeldTemps values.
+func (g *CodeGenerator) findRegisterTemps(prog *ast.Program) {
+	g.registerTemps = make(map[*symbol.Symbol]bool)
+	reads := make(map[*symbol.Symbol]bool)
+	ast.Rewrite(prog, func(n ast.Node) ast.Node {
+		if id, ok := n.(*ast.Identifier); ok && id.Symbol != nil {
+			reads[id.Symbol] = true
+		}
+		return n
+	})
+
+	var block func(stmts []ast.Statement)
+	block = func(stmts []ast.Statement) {
+		var run []*symbol.Symbol
+		flush := func() {
+			if len(run) <= maxHeldTemps {
+				for _, sym := range run {
+					g.registerTemps[sym] = true
+				}
+			}
+			run = nil
+		}
+		for _, stmt := range stmts {
+			if s, ok := stmt.(*ast.AssignmentStatement); ok && s.Temporary {
+				if s.Symbol != nil && s.Symbol.Type != symbol.FloatType && reads[s.Symbol] {
+					run = append(run, s.Symbol)
+				}
+				continue
+			}
+			flush()
+			switch s := stmt.(type) {
+			case *ast.FunctionDefinition:
+				block(s.Body)
+			case *ast.IfStatement:
+				block(s.Consequence)
+				for _, e := range s.Elifs {
+					block(e.Consequence)
+				}
+				block(s.Alternative)
+			case *ast.WhileStatement:
+				block(s.Body)
+			}
+		}
+		flush()
+	}
+	block(prog.Statements)
+}
+
+// holdTemp evaluates the value of an assignment to a register temporary
+// and keeps it in its register until the temporary is read
+func (g *CodeGenerator) holdTemp(s *ast.AssignmentStatement) {
+	reg := g.generateExpression(s.Value)
+	if reg < 0 {
+		reg = g.allocateRegister()
+	}
+	g.held[s.Symbol] = reg
+}
+
+// takeHeld hands over the register holding a temporary, or returns false
+// if sym is not held
+func (g *CodeGenerator) takeHeld(sym *symbol.Symbol) (int, bool) {
+	reg, ok := g.held[sym]
+	if ok {
+		delete(g.held, sym)
+	}
+	return reg, ok
+}
@@ -0,0 +1,268 @@
+// Package compiler wires the lexer, parser, desugaring stage, checker and code
+// generator into the single pipeline shared by every CLI subcommand and the
+// HTTP service.
+package compiler
+
+import (
+	"io"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/check"
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/desugar"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/opt"
+	"github.com/arifali123/152compiler/packages/parser"
+	"github.com/arifali123/152compiler/packages/symbol"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// Result holds everything produced by one compilation
+type Result struct {
+	Program     *ast.Program
+	Assembly    string
+	Diagnostics []diag.Diagnostic
+	Loops       []codegen.LoopLabels   // labels of each while loop in Assembly
+	Functions   []codegen.FunctionText // where each function's code is in Assembly
+	SourceMap   []codegen.LineMark     // the source line each part of Assembly came from
+
+	Phases        []Phase    // how long each stage took, in pipeline order
+	Optimizations []Decision // what the optimizer changed, with -O
+
+	// Internal is the panic a phase of the compiler was stopped by, nil if
+	// none was. It is also reported among the Diagnostics.
+	Internal *InternalError
+
+	symbols *symbol.SymbolTable // the variables code generation bound
+	size    *codegen.Size       // of the assembly CompileTo wrote, which Assembly does not hold
+}
+
+// Failed reports whether the front end rejected the program
+func (r *Result) Failed() bool {
+	return diag.HasErrors(r.Diagnostics)
+}
+
+// Tokens lexes source and returns every token up to and including EOF.
+// Lexing stops early at an ILLEGAL token the lexer cannot move past.
+func Tokens(source string) []token.Token {
+	return lexer.Record(lexer.New(source)).Tokens()
+}
+
+// TokensFrom is Tokens for source read from r a line at a time, so that
+// only the tokens, not the text, are held. The error is the one that ended
+// reading early; the tokens lexed before it are still returned.
+func TokensFrom(r io.Reader) ([]token.Token, error) {
+	l := lexer.NewFromReader(r)
+	return lexer.Record(l).Tokens(), l.Err()
+}
+
+// TokensWithTrivia is Tokens with the whitespace and comments around each
+// token recorded on it, for tools that write the source back out
+func TokensWithTrivia(source string) []token.Token {
+	return lexer.Record(lexer.New(source).KeepTrivia()).Tokens()
+}
+
+// Parse runs the front end and returns the program with any syntax errors
+func Parse(source string) (*ast.Program, []diag.Diagnostic) {
+	return parse(source, 32, nil, &stage{})
+}
+
+func parse(source string, wordSize int, trace lexer.Logger, s *stage) (*ast.Program, []diag.Diagnostic) {
+	// The parser reads every token up front, so the lexer's trace comes
+	// before the parser's
+	l := lexer.New(source)
+	if trace != nil {
+		l.Trace(trace)
+	}
+	p := parser.New(l)
+	s.at = p.Position
+	p.SetTrace(trace)
+	p.SetWordSize(wordSize)
+	program := p.ParseProgram()
+
+	var diags []diag.Diagnostic
+	for _, err := range p.SyntaxErrors() {
+		d := diag.Errorf(err.Line, err.Column, "%s", err.Message)
+		d.EndColumn = err.EndColumn
+		d.Hint = err.Hint
+		d.Fixes = err.Fixes
+		diags = append(diags, d)
+	}
+	return program, diags
+}
+
+// Analyze parses source, lowers it to the core AST and runs the semantic
+// checks on the result
+func Analyze(source string) (*ast.Program, []diag.Diagnostic) {
+	return AnalyzeWith(source, Options{})
+}
+
+// AnalyzeWith is Analyze with explicit options
+func AnalyzeWith(source string, opts Options) (program *ast.Program, diags []diag.Diagnostic) {
+	s := &stage{}
+	var ice *InternalError
+	defer s.rescue(source, opts, &ice, &diags)
+	return analyze(source, opts, newTimer(), s)
+}
+
+func analyze(source string, opts Options, t *timer, s *stage) (*ast.Program, []diag.Diagnostic) {
+	s.enter("parse")
+	program, diags := parse(source, opts.Codegen.Target.Bits(), opts.Trace, s)
+	t.done("parse")
+	if diag.HasErrors(diags) {
+		return program, diags
+	}
+	s.enter("gate")
+	diags = append(diags, check.Gate(program, opts.Lang)...)
+	diags = append(diags, check.Ranges(program)...)
+	t.done("gate")
+	if diag.HasErrors(diags) {
+		return program, diags
+	}
+	s.enter("desugar")
+	program = desugar.Program(program)
+	t.done("desugar")
+	s.enter("check")
+	diags = append(diags, check.CheckWith(program, check.Options{Strict: opts.Strict})...)
+	if opts.Codegen.Entry != "" {
+		diags = append(diags, check.Entry(program, opts.Codegen.Entry)...)
+	}
+	t.done("check")
+	return program, unsuppressed(source, diags)
+}
+
+// unsuppressed drops the warnings on lines that end in a "# noqa" comment,
+// optionally followed by a colon and anything else, as flake8 writes it.
+// Errors are always kept.
+func unsuppressed(source string, diags []diag.Diagnostic) []diag.Diagnostic {
+	quiet := make(map[int]bool)
+	for _, tok := range lexer.Record(lexer.New(source).KeepComments()).Tokens() {
+		if tok.Type != token.COMMENT {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimPrefix(tok.Literal, "#"))
+		if word, _, _ := strings.Cut(text, ":"); strings.EqualFold(strings.TrimSpace(word), "noqa") {
+			quiet[tok.Line] = true
+		}
+	}
+	if len(quiet) == 0 {
+		return diags
+	}
+	kept := diags[:0]
+	for _, d := range diags {
+		if d.Severity != diag.Warning || !quiet[d.Line] {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// Options selects optional compiler behaviour
+type Options struct {
+	Codegen codegen.Options
+
+	// Optimize runs the AST optimizations in package opt before code generation
+	Optimize bool
+	Opt      opt.Options
+
+	// Strict makes every checker warning an error and rejects what the
+	// default mode allows beginners; see check.Options
+	Strict bool
+
+	// Lang rejects constructs above a course level; see check.Gate
+	Lang check.Level
+
+	// Trace, when set, receives a line for each token lexed and each
+	// statement and block parsed
+	Trace lexer.Logger
+
+	// NoRecover lets a panic in the compiler go on rather than be reported
+	// as an internal compiler error, for debugging the compiler
+	NoRecover bool
+
+	// CrashDir is where the stack trace of an internal compiler error is
+	// written; empty means os.TempDir()
+	CrashDir string
+}
+
+// Compile runs the full pipeline. Assembly is empty when parsing or checking failed.
+func Compile(source string) *Result {
+	return CompileWith(source, Options{})
+}
+
+// CompileWith is Compile with explicit options
+func CompileWith(source string, opts Options) *Result {
+	res, _ := compile(source, opts, nil)
+	return res
+}
+
+// CompileTo is CompileWith writing the assembly to w as it is generated
+// rather than keeping it in Result.Assembly, which stays empty. Functions
+// and SourceMap point into what was written, and Report gives its size as
+// measured on the way. Nothing is written when the front end rejects the
+// program. The error is the first one writing to w.
+func CompileTo(w io.Writer, source string, opts Options) (*Result, error) {
+	return compile(source, opts, w)
+}
+
+// compile runs the pipeline, writing the assembly to w, or into
+// Result.Assembly if w is nil
+func compile(source string, opts Options, w io.Writer) (res *Result, err error) {
+	t := newTimer()
+	// res is named so a recovered panic still returns it
+	res = &Result{}
+	defer func() { res.Phases = t.phases }()
+	s := &stage{}
+	defer s.rescue(source, opts, &res.Internal, &res.Diagnostics)
+
+	program, diags := analyze(source, opts, t, s)
+	res.Program, res.Diagnostics = program, diags
+	if res.Failed() {
+		return res, nil
+	}
+
+	if opts.Optimize {
+		s.enter("optimize")
+		o := opts.Opt
+		o.WordSize = opts.Codegen.Target.Bits()
+		for _, name := range opt.ConstantGlobals(program, o) {
+			res.Optimizations = append(res.Optimizations, Decision{Pass: "constant-globals", Detail: "substituted the constant global '" + name + "'"})
+		}
+		for _, line := range opt.StringComparisons(program) {
+			res.Optimizations = append(res.Optimizations, Decision{Pass: "string-comparisons", Line: line, Detail: "resolved a comparison of string literals"})
+		}
+		for _, line := range opt.Swaps(program) {
+			res.Optimizations = append(res.Optimizations, Decision{Pass: "swaps", Line: line, Detail: "exchanged two variables in registers"})
+		}
+		t.done("optimize")
+	}
+
+	// The code generator assumes a well-formed tree; a broken rewrite is
+	// reported here instead of compiled into nonsense
+	s.enter("validate")
+	res.Diagnostics = append(res.Diagnostics, ast.Validate(program)...)
+	if res.Failed() {
+		return res, nil
+	}
+
+	s.enter("codegen")
+	c := codegen.New(symbol.NewSymbolTable(nil))
+	c.Options = opts.Codegen
+	s.at = func() (int, int) { return c.Line(), 0 }
+	if w == nil {
+		res.Assembly = c.Generate(program)
+	} else {
+		m := &codegen.Meter{W: w}
+		err = c.GenerateTo(m, program)
+		size := m.Size()
+		res.size = &size
+	}
+	res.symbols = c.Symbols()
+	res.Loops = c.Loops()
+	res.Functions = c.FunctionTexts()
+	res.SourceMap = c.SourceMap()
+	t.done("codegen")
+	return res, err
+}
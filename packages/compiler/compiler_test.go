@@ -0,0 +1,551 @@
+package compiler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/emulator"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+func TestCompileAndRun(t *testing.T) {
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"../../test_data/test_1.py", "hello\n16\n"},
+		{"../../test_data/test_2.py", "1\n0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n"},
+		{"../../test_data/test_3.py", "8\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			input, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := Compile(string(input))
+			if res.Failed() {
+				t.Fatalf("compile failed: %v", res.Diagnostics)
+			}
+
+			var out strings.Builder
+			if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("output wrong. expected=%q, got=%q", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	res := Compile("x = * 5")
+	if !res.Failed() {
+		t.Fatal("expected compile to fail")
+	}
+	if res.Assembly != "" {
+		t.Errorf("expected no assembly for a failed compile, got %q", res.Assembly)
+	}
+}
+
+func TestWordSize(t *testing.T) {
+	source := "x = 3000000000\nprint(x)\n"
+	if res := Compile(source); !res.Failed() {
+		t.Fatal("expected a 32-bit compile to reject 3000000000")
+	}
+
+	res := CompileWith(source, Options{Codegen: codegen.Options{Target: codegen.TargetDescription{WordSize: 64}}})
+	if res.Failed() {
+		t.Fatalf("64-bit compile failed: %v", res.Diagnostics)
+	}
+	if !strings.Contains(res.Assembly, "dli $t0, 3000000000") || !strings.Contains(res.Assembly, "sd $t0, x") {
+		t.Errorf("expected 64-bit code, got:\n%s", res.Assembly)
+	}
+}
+
+func TestDesugar(t *testing.T) {
+	res := Compile("x = 3\nx += 4\nx *= 2\nx -= 1\nprint(x)\n")
+	if res.Failed() {
+		t.Fatalf("compile failed: %v", res.Diagnostics)
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+	}
+	if out.String() != "13\n" {
+		t.Errorf("output wrong. expected=%q, got=%q", "13\n", out.String())
+	}
+}
+
+func TestShadowing(t *testing.T) {
+	src := "x = 5\ndef f(x):\n\tx = \"shadowed\"\n\treturn 1\n\ny = f(x)\nprint(x)\n"
+	res := Compile(src)
+	if res.Failed() {
+		t.Fatalf("compile failed: %v", res.Diagnostics)
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+	}
+	if out.String() != "5\n" {
+		t.Errorf("output wrong. expected=%q, got=%q", "5\n", out.String())
+	}
+}
+
+func TestEarlyReturn(t *testing.T) {
+	src := "def abs(n):\n\tif n < 0:\n\t\treturn 0 - n\n\treturn n\n\na = 0 - 5\nx = abs(a)\nprint(x)\ny = abs(7)\nprint(y)\n"
+	res := Compile(src)
+	if res.Failed() {
+		t.Fatalf("compile failed: %v", res.Diagnostics)
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+	}
+	if out.String() != "5\n7\n" {
+		t.Errorf("output wrong. expected=%q, got=%q", "5\n7\n", out.String())
+	}
+}
+
+func TestStringComparisons(t *testing.T) {
+	src := "if \"apple\" < \"banana\":\n\tprint(\"yes\")\nelse:\n\tprint(\"no\")\nwhile \"b\" < \"a\":\n\tprint(\"never\")\nprint(\"done\")\n"
+	for _, optimize := range []bool{false, true} {
+		res := CompileWith(src, Options{Optimize: optimize})
+		if res.Failed() {
+			t.Fatalf("compile failed: %v", res.Diagnostics)
+		}
+		if optimize && strings.Contains(res.Assembly, "never") {
+			t.Errorf("-O kept the dead loop:\n%s", res.Assembly)
+		}
+		var out strings.Builder
+		if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+			t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+		}
+		if out.String() != "yes\ndone\n" {
+			t.Errorf("optimize=%v: output wrong. expected=%q, got=%q", optimize, "yes\ndone\n", out.String())
+		}
+	}
+}
+
+func TestElif(t *testing.T) {
+	tests := []struct {
+		x        string
+		expected string
+	}{
+		{"5", "big\n"},
+		{"1", "one\n"},
+		{"0", "zero\n"},
+		{"0 - 3", "negative\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.x, func(t *testing.T) {
+			src := "x = " + tt.x + "\nif x > 1:\n\tprint(\"big\")\nelif x > 0:\n\tprint(\"one\")\nelif x < 0:\n\tprint(\"negative\")\nelse:\n\tprint(\"zero\")\n"
+			res := Compile(src)
+			if res.Failed() {
+				t.Fatalf("compile failed: %v", res.Diagnostics)
+			}
+			var out strings.Builder
+			if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("output wrong. expected=%q, got=%q", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestForRange(t *testing.T) {
+	src := "total = 0\nfor i in range(5):\n\ttotal += i\nprint(total)\nfor j in range(2, 4):\n\tfor k in range(j):\n\t\tprint(k)\nfor m in range(3, 1):\n\tprint(m)\n"
+	res := Compile(src)
+	if res.Failed() {
+		t.Fatalf("compile failed: %v", res.Diagnostics)
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+	}
+	if want := "10\n0\n1\n0\n1\n2\n"; out.String() != want {
+		t.Errorf("output wrong. expected=%q, got=%q", want, out.String())
+	}
+}
+
+func TestForRangeStep(t *testing.T) {
+	src := "for i in range(10, 0, -3):\n\tprint(i)\nfor i in range(0, 10, 4):\n\tprint(i)\ns = -2\nfor i in range(5, -1, s):\n\tprint(i)\ns = 3\nfor i in range(1, 8, s):\n\ts = 100\n\tprint(i)\nfor i in range(1, 5, -1):\n\tprint(i)\n"
+	res := Compile(src)
+	if res.Failed() {
+		t.Fatalf("compile failed: %v", res.Diagnostics)
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+	}
+	if want := "10\n7\n4\n1\n0\n4\n8\n5\n3\n1\n1\n4\n7\n"; out.String() != want {
+		t.Errorf("output wrong. expected=%q, got=%q", want, out.String())
+	}
+
+	if res := Compile("for i in range(3, 0, 0):\n\tprint(i)\n"); !res.Failed() {
+		t.Error("expected a zero step to be rejected")
+	}
+}
+
+func TestForRangeReadsOnce(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"body changes stop", "n = 3\nfor i in range(n):\n\tn = n - 1\n\tprint(i)\n", "0\n1\n2\n"},
+		{"stop called once", "calls = 0\ndef f():\n\tglobal calls\n\tcalls += 1\n\treturn 3\n\nfor i in range(f()):\n\tprint(i)\nprint(calls)\n", "0\n1\n2\n1\n"},
+		{"body changes variable", "for i in range(3):\n\tprint(i)\n\ti = 10\n", "0\n1\n2\n"},
+		{"variable keeps last value", "for i in range(1, 7, 2):\n\tx = i\nprint(i)\n", "5\n"},
+		{"nested over same variable", "for i in range(2):\n\tfor i in range(3):\n\t\tprint(i)\n", "0\n1\n2\n0\n1\n2\n"},
+		{"function changes stop parameter", "def f(n):\n\tfor i in range(0, n, 1):\n\t\tn = 0\n\t\tprint(i)\n\nf(2)\n", "0\n1\n"},
+	}
+	for _, tt := range tests {
+		for _, optimize := range []bool{false, true} {
+			res := CompileWith(tt.src, Options{Optimize: optimize})
+			if res.Failed() {
+				t.Fatalf("%s: compile failed: %v", tt.name, res.Diagnostics)
+			}
+			var out strings.Builder
+			if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+				t.Fatalf("%s: run failed: %v\n%s", tt.name, err, res.Assembly)
+			}
+			if out.String() != tt.want {
+				t.Errorf("%s (optimize=%v): output wrong. expected=%q, got=%q", tt.name, optimize, tt.want, out.String())
+			}
+		}
+	}
+}
+
+func TestTupleAssignment(t *testing.T) {
+	src := "a, b = 1, 2\na, b = b, a\nprint(a)\nprint(b)\nx, y = a + b, a - b\nprint(x)\nprint(y)\n"
+	res := Compile(src)
+	if res.Failed() {
+		t.Fatalf("compile failed: %v", res.Diagnostics)
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+	}
+	if want := "2\n1\n3\n1\n"; out.String() != want {
+		t.Errorf("output wrong. expected=%q, got=%q", want, out.String())
+	}
+}
+
+func TestSwaps(t *testing.T) {
+	src := "def order(x, y):\n\tif x > y:\n\t\ttemp = x\n\t\tx = y\n\t\ty = temp\n\tprint(x)\n\tprint(y)\n\na = 1\nb = 2\nt = a\na = b\nb = t\nprint(a)\nprint(b)\norder(a, b)\n"
+	var sizes []int
+	for _, optimize := range []bool{false, true} {
+		res := CompileWith(src, Options{Optimize: optimize})
+		if res.Failed() {
+			t.Fatalf("compile failed: %v", res.Diagnostics)
+		}
+		var out strings.Builder
+		if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+			t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+		}
+		if want := "2\n1\n1\n2\n"; out.String() != want {
+			t.Errorf("optimize=%v: output wrong. expected=%q, got=%q", optimize, want, out.String())
+		}
+		sizes = append(sizes, codegen.Measure(res.Assembly).Instructions)
+	}
+	// Each exchange loses a load and a store, and order no longer zeroes temp
+	if sizes[0]-sizes[1] != 5 {
+		t.Errorf("wrong instruction counts: %v", sizes)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	src := "def f(n):\n\tprint(\"called\")\n\treturn n\nx = 5\ny = 20\nif x > 0 and y < 10:\n\tprint(1)\nelif x > 0 or y < 10:\n\tprint(2)\nif not x > 10:\n\tprint(3)\np = x < 0 or x > 3 and y > 10\nprint(p)\na = 0 and f(1)\nprint(a)\nb = 3 or f(2)\nprint(b)\nc = 3 and f(4)\nprint(c)\nn = not y\nprint(n)\n"
+	res := Compile(src)
+	if res.Failed() {
+		t.Fatalf("compile failed: %v", res.Diagnostics)
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+	}
+	if want := "2\n3\n1\n0\n3\ncalled\n4\n0\n"; out.String() != want {
+		t.Errorf("output wrong. expected=%q, got=%q", want, out.String())
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	src := "a = 3\nb = 3\nc = 5\nif a == b:\n\tprint(1)\nif a != c:\n\tprint(2)\nif a <= b and c >= b:\n\tprint(3)\nif c <= a or a >= c:\n\tprint(0)\nx = a == b\nprint(x)\ny = a != b\nprint(y)\nz = c <= a\nprint(z)\nw = c >= a\nprint(w)\nbig = 2147483647\nsmall = -1\nif big != small:\n\tprint(4)\n"
+	res := Compile(src)
+	if res.Failed() {
+		t.Fatalf("compile failed: %v", res.Diagnostics)
+	}
+	var out strings.Builder
+	if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+	}
+	if want := "1\n2\n3\n1\n0\n0\n1\n4\n"; out.String() != want {
+		t.Errorf("output wrong. expected=%q, got=%q", want, out.String())
+	}
+}
+
+func TestFloats(t *testing.T) {
+	src := "x = 1.5\ny = x * 2\nprint(y)\nz = 7 / 2.0\nprint(z)\nw = -7.5 // 2\nprint(w)\nm = -7.5 % 2\nprint(m)\np = 2.0 ** -2\nprint(p)\nif x < 2:\n\tprint(1)\nif x != 1.5:\n\tprint(0)\nc = x > 1\nprint(c)\ni = 3\nf = i + 0.25\nprint(f)\nn = f * 4\nk = n - 1\nwhile k > 10:\n\tk = k - 0.5\nprint(k)\n"
+	for _, opts := range []Options{{}, {Codegen: codegen.Options{Checked: true}}, {Optimize: true}} {
+		res := CompileWith(src, opts)
+		if res.Failed() {
+			t.Fatalf("compile failed: %v", res.Diagnostics)
+		}
+		var out strings.Builder
+		if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+			t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+		}
+		if want := "3.0\n3.5\n-4.0\n0.5\n0.25\n1\n1\n3.25\n10.0\n"; out.String() != want {
+			t.Errorf("%+v: output wrong. expected=%q, got=%q", opts, want, out.String())
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	source := "SIZE = 5\ni = 0\ntotal = 0\nwhile i < SIZE:\n\ttotal = total + SIZE\n\ti = i + 1\nprint(total)\n"
+	for _, optimize := range []bool{false, true} {
+		res := CompileWith(source, Options{Optimize: optimize})
+		if res.Failed() {
+			t.Fatalf("compile failed: %v", res.Diagnostics)
+		}
+		if hasStorage := strings.Contains(res.Assembly, "SIZE: .word"); hasStorage == optimize {
+			t.Errorf("optimize=%v: SIZE storage present=%v\n%s", optimize, hasStorage, res.Assembly)
+		}
+
+		var out strings.Builder
+		if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+			t.Fatalf("run failed: %v\n%s", err, res.Assembly)
+		}
+		if out.String() != "25\n" {
+			t.Errorf("optimize=%v: output wrong. expected=%q, got=%q", optimize, "25\n", out.String())
+		}
+	}
+}
+
+func TestStrict(t *testing.T) {
+	source := "def f(x):\n\treturn x\n\nx = 1\ny = f(x)\nprint(y)\n"
+	if res := CompileWith(source, Options{}); res.Failed() {
+		t.Fatalf("default mode rejected a warning: %v", res.Diagnostics)
+	}
+	res := CompileWith(source, Options{Strict: true})
+	if !res.Failed() {
+		t.Fatal("expected strict mode to reject a shadowing warning")
+	}
+	if res.Assembly != "" {
+		t.Errorf("expected no assembly for a failed compile, got %q", res.Assembly)
+	}
+}
+
+func TestNoqa(t *testing.T) {
+	src := "x = 1\nx + 1  # noqa\nx == 2  # NOQA: unused\nx - 1  # not noqa\nd = {1: 2, \"b\": 3}  # noqa\n"
+	_, diags := Analyze(src)
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"4:1: warning: the value of this expression is never used; did you mean to assign it?",
+		"5:12: error: dictionary keys must be all strings or all integers",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong diagnostics.\nexpected=%q\ngot=     %q", want, got)
+	}
+}
+
+func TestDeterminism(t *testing.T) {
+	files, err := filepath.Glob("../../test_data/*.py")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	// Many globals and strings give map iteration plenty of room to differ
+	sources := []string{"a = 1\nb = \"x\"\nc = \"y\"\nd = a + 2\ne = d * a\nf = \"z\"\nprint(b)\nprint(c)\nprint(f)\nprint(e)\n"}
+	for _, file := range files {
+		input, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, string(input))
+	}
+	options := []Options{
+		{},
+		{Optimize: true},
+		{Codegen: codegen.Options{Checked: true, FrameTrailer: true}},
+		{Codegen: codegen.Options{Target: codegen.TargetDescription{WordSize: 64}}},
+	}
+
+	for i, source := range sources {
+		for _, opts := range options {
+			first := CompileWith(source, opts)
+			if first.Failed() {
+				t.Fatalf("source %d: compile failed: %v", i, first.Diagnostics)
+			}
+			for run := 0; run < 10; run++ {
+				if again := CompileWith(source, opts); again.Assembly != first.Assembly {
+					t.Fatalf("source %d with %+v: compiling twice gave different assembly:\n%s\n---\n%s", i, opts, first.Assembly, again.Assembly)
+				}
+			}
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	toks := Tokens("x = 1")
+	if len(toks) != 4 || toks[len(toks)-1].Type != token.EOF {
+		t.Fatalf("expected 4 tokens ending in EOF, got %v", toks)
+	}
+
+	// The lexer does not advance past mixed indentation; Tokens must not spin
+	toks = Tokens("if x:\n\ty = 1\n  z = 2")
+	last := toks[len(toks)-1]
+	if last.Type != token.ILLEGAL {
+		t.Errorf("expected token stream to stop at ILLEGAL, got %s", last.Type)
+	}
+
+	source := "def f(x):\n\treturn [x,\n\t\tx]\n"
+	streamed, err := TokensFrom(strings.NewReader(source))
+	if err != nil || !reflect.DeepEqual(streamed, Tokens(source)) {
+		t.Errorf("streamed tokens differ (err %v):\n%v\n%v", err, streamed, Tokens(source))
+	}
+}
+
+func TestReport(t *testing.T) {
+	input := "SIZE = 3\nn = 0\ndef add(a, b):\n\tc = a + b\n\treturn c\n\nif \"a\" < \"b\":\n\tn = add(SIZE, 1)\nprint(n)\nglobal n\n"
+	res := CompileWith(input, Options{Optimize: true})
+	rep := res.Report()
+	if rep.Failed || rep.Errors != 0 || rep.Warnings != 1 {
+		t.Fatalf("wrong outcome: failed=%v errors=%d warnings=%d %v", rep.Failed, rep.Errors, rep.Warnings, rep.Diagnostics)
+	}
+
+	var names []string
+	for _, p := range rep.Phases {
+		names = append(names, p.Name)
+	}
+	if got := strings.Join(names, " "); got != "parse gate desugar check optimize codegen" {
+		t.Errorf("wrong phases: %s", got)
+	}
+	// SIZE was substituted and its storage removed
+	if want := (Symbols{Globals: 1, Functions: 1, Parameters: 2, Locals: 1}); rep.Symbols != want {
+		t.Errorf("wrong symbols. expected=%+v, got=%+v", want, rep.Symbols)
+	}
+	if rep.Size != codegen.Measure(res.Assembly) || rep.Size.Instructions == 0 {
+		t.Errorf("wrong size: %+v", rep.Size)
+	}
+	want := []Decision{
+		{Pass: "constant-globals", Detail: "substituted the constant global 'SIZE'"},
+		{Pass: "string-comparisons", Line: 7, Detail: "resolved a comparison of string literals"},
+	}
+	if !reflect.DeepEqual(rep.Optimizations, want) {
+		t.Errorf("wrong optimizations.\nexpected=%+v\ngot=     %+v", want, rep.Optimizations)
+	}
+
+	data, err := rep.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"phases"`, `"durationNs"`, `"symbols"`, `"instructions"`, `"optimizations"`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("JSON missing %s:\n%s", key, data)
+		}
+	}
+
+	// A rejected program reports its diagnostics and the phases that ran
+	rep = Compile("def f(x, x):\n\treturn x\n").Report()
+	if !rep.Failed || rep.Errors != 1 || len(rep.Phases) != 4 || rep.Size.Instructions != 0 {
+		t.Errorf("wrong report for a rejected program: %+v", rep)
+	}
+}
+
+func TestInternalError(t *testing.T) {
+	dir := t.TempDir()
+	crash := func(opts Options) (ice *InternalError, diags []diag.Diagnostic) {
+		s := &stage{}
+		defer s.rescue("x = 1\ny = x\n", opts, &ice, &diags)
+		s.enter("codegen")
+		s.at = func() (int, int) { return 2, 0 }
+		panic("no register for 'y'")
+	}
+
+	ice, diags := crash(Options{CrashDir: dir})
+	if ice == nil || ice.Phase != "codegen" || ice.Line != 2 || ice.Value != "no register for 'y'" {
+		t.Fatalf("wrong internal error: %+v", ice)
+	}
+	if len(diags) != 1 || diags[0].String() != "2: error: internal compiler error in codegen: no register for 'y'" {
+		t.Fatalf("wrong diagnostics: %v", diags)
+	}
+	if filepath.Dir(ice.Trace) != dir || !strings.Contains(diags[0].Hint, ice.Trace) {
+		t.Errorf("stack trace %q not in %s or not named in hint %q", ice.Trace, dir, diags[0].Hint)
+	}
+	trace, err := os.ReadFile(ice.Trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"internal compiler error in codegen at 2:0", "x = 1\ny = x\n", "TestInternalError"} {
+		if !strings.Contains(string(trace), want) {
+			t.Errorf("stack trace missing %q:\n%s", want, trace)
+		}
+	}
+
+	// NoRecover lets the panic through
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to go on under NoRecover")
+			}
+		}()
+		crash(Options{NoRecover: true, CrashDir: dir})
+	}()
+
+	// A compilation that does not panic has no internal error
+	if res := CompileWith("x = 1\nprint(x)\n", Options{CrashDir: dir}); res.Internal != nil || res.Failed() {
+		t.Errorf("unexpected internal error: %+v", res.Internal)
+	}
+}
+
+// brokenWriter fails every write
+type brokenWriter struct{}
+
+func (brokenWriter) Write([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestCompileTo(t *testing.T) {
+	source := "def f(a):\n\treturn a + 1\n\nprint(f(2))\n"
+	opts := Options{Optimize: true}
+	want := CompileWith(source, opts)
+
+	var out strings.Builder
+	res, err := CompileTo(&out, source, opts)
+	if err != nil {
+		t.Fatalf("CompileTo failed: %v", err)
+	}
+	if res.Assembly != "" {
+		t.Errorf("CompileTo kept the assembly in the result")
+	}
+	if out.String() != want.Assembly {
+		t.Errorf("CompileTo wrote different assembly.\nexpected=%q\ngot=     %q", want.Assembly, out.String())
+	}
+	if !reflect.DeepEqual(res.SourceMap, want.SourceMap) || !reflect.DeepEqual(res.Functions, want.Functions) {
+		t.Errorf("CompileTo's offsets differ from CompileWith's")
+	}
+	if got := res.Report().Size; got != want.Report().Size || got.Instructions == 0 {
+		t.Errorf("CompileTo's report measured %+v, CompileWith's %+v", got, want.Report().Size)
+	}
+
+	// A rejected program writes nothing, so there is nothing to fail
+	out.Reset()
+	res, err = CompileTo(&out, "x = \n", opts)
+	if err != nil || !res.Failed() || out.Len() != 0 {
+		t.Errorf("rejected program: failed=%v, err=%v, wrote %q", res.Failed(), err, out.String())
+	}
+
+	if _, err := CompileTo(brokenWriter{}, source, opts); err == nil || err.Error() != "connection reset" {
+		t.Errorf("expected the write error, got %v", err)
+	}
+}
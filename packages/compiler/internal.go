@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+
+	"github.com/arifali123/152compiler/packages/diag"
+)
+
+// InternalError describes a panic in one phase of the compiler, which is a
+// bug in the compiler rather than in the program compiled
+type InternalError struct {
+	Phase  string // as named in Result.Phases, or "validate"
+	Line   int    // where in the source the phase had got to; 0 if it cannot tell
+	Column int
+	Value  interface{} // what the phase panicked with
+	Trace  string      // the file the stack trace was written to; empty if it could not be
+}
+
+// stage is the phase of the pipeline under way, for reporting a panic in it
+type stage struct {
+	name string
+	at   func() (line, column int) // where the phase has got to, if it can tell
+}
+
+// enter starts the phase name, which cannot tell where it has got to
+// unless it sets at
+func (s *stage) enter(name string) {
+	s.name, s.at = name, nil
+}
+
+// rescue, deferred, turns a panic in the current phase into an internal
+// compiler error: it records it in *ice, writes the stack trace to a file
+// and reports both as an error in *diags. With opts.NoRecover the panic
+// goes on.
+func (s *stage) rescue(source string, opts Options, ice **InternalError, diags *[]diag.Diagnostic) {
+	if opts.NoRecover {
+		return
+	}
+	v := recover()
+	if v == nil {
+		return
+	}
+	e := &InternalError{Phase: s.name, Value: v}
+	if s.at != nil {
+		e.Line, e.Column = s.at()
+	}
+	e.Trace = writeTrace(opts.CrashDir, e, source, debug.Stack())
+	*ice = e
+
+	d := diag.Errorf(e.Line, e.Column, "internal compiler error in %s: %v", e.Phase, e.Value)
+	if e.Trace != "" {
+		d.Hint = "this is a bug in the compiler, not in your program; the stack trace is in " + e.Trace
+	} else {
+		d.Hint = "this is a bug in the compiler, not in your program"
+	}
+	*diags = append(*diags, d)
+}
+
+// writeTrace writes what went wrong, the source and the stack to a new file
+// in dir, returning its name, or "" if it could not be written
+func writeTrace(dir string, e *InternalError, source string, stack []byte) string {
+	f, err := os.CreateTemp(dir, "152compiler-crash-*.txt")
+	if err != nil {
+		return ""
+	}
+	fmt.Fprintf(f, "internal compiler error in %s at %d:%d: %v\n\n", e.Phase, e.Line, e.Column, e.Value)
+	fmt.Fprintf(f, "source:\n%s\n\nstack:\n%s", source, stack)
+	if err := f.Close(); err != nil {
+		return ""
+	}
+	return f.Name()
+}
@@ -0,0 +1,117 @@
+package compiler
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+// Phase is how long one stage of a compilation took
+type Phase struct {
+	Name     string        `json:"name"` // parse, gate, desugar, check, optimize or codegen
+	Duration time.Duration `json:"durationNs"`
+}
+
+// Decision is one change the optimizer made to the program
+type Decision struct {
+	Pass   string `json:"pass"`
+	Line   int    `json:"line,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// Symbols counts the names a program defines
+type Symbols struct {
+	Globals    int `json:"globals"`
+	Functions  int `json:"functions"`
+	Parameters int `json:"parameters"`
+	Locals     int `json:"locals"`
+}
+
+// Report summarizes one compilation as a single value that serializes to
+// JSON, for the HTTP service, the build command and grading to share
+type Report struct {
+	Failed        bool              `json:"failed"`
+	Phases        []Phase           `json:"phases"`
+	Errors        int               `json:"errors"`
+	Warnings      int               `json:"warnings"`
+	Diagnostics   []diag.Diagnostic `json:"diagnostics,omitempty"`
+	Symbols       Symbols           `json:"symbols"`
+	Size          codegen.Size      `json:"size"`
+	Optimizations []Decision        `json:"optimizations,omitempty"`
+}
+
+// Report summarizes the compilation. Symbols and Size stay zero when the
+// front end rejected the program.
+func (r *Result) Report() *Report {
+	rep := &Report{
+		Failed:        r.Failed(),
+		Phases:        r.Phases,
+		Diagnostics:   r.Diagnostics,
+		Optimizations: r.Optimizations,
+	}
+	for _, d := range r.Diagnostics {
+		switch d.Severity {
+		case diag.Error:
+			rep.Errors++
+		case diag.Warning:
+			rep.Warnings++
+		}
+	}
+	if rep.Failed {
+		return rep
+	}
+
+	if r.size != nil {
+		rep.Size = *r.size
+	} else {
+		rep.Size = codegen.Measure(r.Assembly)
+	}
+	for _, stmt := range r.Program.Statements {
+		if fn, ok := stmt.(*ast.FunctionDefinition); ok {
+			rep.Symbols.Functions++
+			rep.Symbols.Parameters += len(fn.Parameters)
+			rep.Symbols.Locals += len(fn.Locals)
+		}
+	}
+	if r.symbols != nil {
+		for _, sym := range r.symbols.GetSymbols() {
+			// Tuple assignment temporaries are named so no identifier can
+			// spell them
+			if sym.IsGlobal && !sym.IsPrint && sym.Type != symbol.FunctionType && !strings.HasPrefix(sym.Name, "(") {
+				rep.Symbols.Globals++
+			}
+		}
+	}
+	return rep
+}
+
+// JSON encodes the report, indented, with a trailing newline
+func (r *Report) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// timer records how long each phase of a compilation takes
+type timer struct {
+	phases []Phase
+	start  time.Time
+}
+
+func newTimer() *timer {
+	return &timer{start: time.Now()}
+}
+
+// done ends the phase name, which began when the previous one ended
+func (t *timer) done(name string) {
+	now := time.Now()
+	t.phases = append(t.phases, Phase{Name: name, Duration: now.Sub(t.start)})
+	t.start = now
+}
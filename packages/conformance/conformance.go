@@ -0,0 +1,195 @@
+// Package conformance runs the fixture programs in test_data/conformance. A
+// fixture is a Python source file whose leading comment lines state what
+// compiling and running it must produce:
+//
+//	# output: hello          a line the program prints; one per line, in order
+//	# error: 3:5: message    a diagnostic the compiler reports, by position
+//	# warning: 2:1: message
+//	# targets: mars          the targets to compile for; the default is all
+//
+// The header ends at the first line that is not a comment. A fixture with an
+// error is only compiled, and must report exactly its diagnostics. Any other
+// fixture is also run in the emulator and must print exactly its output
+// lines, nothing when it has none. Each fixture is checked once for every
+// target, with and without -O.
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/emulator"
+)
+
+// Fixture is one program of the suite with what it must produce
+type Fixture struct {
+	Name        string
+	Source      string
+	Output      string   // what the program prints
+	Diagnostics []string // as diag.Diagnostic.String renders them, in order
+	Targets     []string // empty means every target
+}
+
+// Variant is one way of compiling a fixture
+type Variant struct {
+	Target   string
+	Optimize bool
+}
+
+func (v Variant) String() string {
+	if v.Optimize {
+		return v.Target + " -O"
+	}
+	return v.Target
+}
+
+// Result is the outcome of checking one fixture in one variant. Err is nil
+// when the fixture conformed.
+type Result struct {
+	Fixture string
+	Variant Variant
+	Err     error
+}
+
+// Parse reads the header of a fixture's source. name identifies it in
+// results and errors.
+func Parse(name, source string) (*Fixture, error) {
+	f := &Fixture{Name: name, Source: source}
+	var output strings.Builder
+	for i, line := range strings.Split(source, "\n") {
+		text, ok := strings.CutPrefix(line, "#")
+		if !ok {
+			break
+		}
+		key, value, ok := strings.Cut(text, ":")
+		if !ok {
+			continue
+		}
+		// One space separates the colon from the value; any more belong to it
+		value = strings.TrimPrefix(value, " ")
+		switch key = strings.TrimSpace(key); key {
+		case "output":
+			output.WriteString(value + "\n")
+		case string(diag.Error), string(diag.Warning):
+			at, message, ok := strings.Cut(value, ": ")
+			if !ok || message == "" {
+				return nil, fmt.Errorf("%s:%d: expected '# %s: line:column: message'", name, i+1, key)
+			}
+			f.Diagnostics = append(f.Diagnostics, fmt.Sprintf("%s: %s: %s", at, key, message))
+		case "targets":
+			for _, target := range strings.Split(value, ",") {
+				target = strings.TrimSpace(target)
+				if _, ok := codegen.LookupTarget(target); !ok {
+					return nil, fmt.Errorf("%s:%d: unknown target %q", name, i+1, target)
+				}
+				f.Targets = append(f.Targets, target)
+			}
+		}
+	}
+	f.Output = output.String()
+	return f, nil
+}
+
+// Load parses every .py file in dir, in name order
+func Load(dir string) ([]*Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.py"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var fixtures []*Fixture
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := Parse(filepath.Base(path), string(source))
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+// Variants lists the ways f is checked: each of its targets, with and
+// without -O
+func (f *Fixture) Variants() []Variant {
+	targets := f.Targets
+	if len(targets) == 0 {
+		targets = codegen.TargetNames()
+	}
+	var variants []Variant
+	for _, target := range targets {
+		variants = append(variants, Variant{Target: target}, Variant{Target: target, Optimize: true})
+	}
+	return variants
+}
+
+// Check compiles f as v describes and, unless it expects an error, runs it,
+// returning what differed from its header
+func (f *Fixture) Check(v Variant) error {
+	target, ok := codegen.LookupTarget(v.Target)
+	if !ok {
+		return fmt.Errorf("unknown target %q", v.Target)
+	}
+	res := compiler.CompileWith(f.Source, compiler.Options{Optimize: v.Optimize, Codegen: codegen.Options{Target: target}})
+
+	var got []string
+	for _, d := range res.Diagnostics {
+		if d.Severity != diag.Note {
+			got = append(got, d.String())
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(f.Diagnostics, "\n") {
+		return fmt.Errorf("wrong diagnostics.\nexpected:\n%sgot:\n%s", lines(f.Diagnostics), lines(got))
+	}
+	if res.Failed() {
+		return nil
+	}
+
+	var out bytes.Buffer
+	if _, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out}); err != nil {
+		return fmt.Errorf("run failed: %v", err)
+	}
+	if out.String() != f.Output {
+		return fmt.Errorf("wrong output.\nexpected:\n%sgot:\n%s", printed(f.Output), printed(out.String()))
+	}
+	return nil
+}
+
+func lines(s []string) string {
+	if len(s) == 0 {
+		return "(none)\n"
+	}
+	return strings.Join(s, "\n") + "\n"
+}
+
+// printed shows a program's output on lines of its own
+func printed(s string) string {
+	if s == "" {
+		return "(nothing)\n"
+	}
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+// Run checks every fixture in every one of its variants
+func Run(fixtures []*Fixture) []Result {
+	var results []Result
+	for _, f := range fixtures {
+		for _, v := range f.Variants() {
+			results = append(results, Result{Fixture: f.Name, Variant: v, Err: f.Check(v)})
+		}
+	}
+	return results
+}
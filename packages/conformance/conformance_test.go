@@ -0,0 +1,68 @@
+package conformance
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSuite(t *testing.T) {
+	fixtures, err := Load("../../test_data/conformance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures found")
+	}
+	for _, f := range fixtures {
+		for _, v := range f.Variants() {
+			t.Run(f.Name+"/"+v.String(), func(t *testing.T) {
+				if err := f.Check(v); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	source := "# output: hello\n# output:\n# output:  two spaces\n# warning: 2:1: unused\n# error: 3: bad\n# targets: mars\n# output: after\nx = 1\n# output: ignored\n"
+	f, err := Parse("f.py", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Fixture{
+		Name:        "f.py",
+		Source:      source,
+		Output:      "hello\n\n two spaces\nafter\n",
+		Diagnostics: []string{"2:1: warning: unused", "3: error: bad"},
+		Targets:     []string{"mars"},
+	}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("wrong fixture.\nexpected=%+v\ngot=     %+v", want, f)
+	}
+	if got := f.Variants(); len(got) != 2 || got[1].String() != "mars -O" {
+		t.Errorf("wrong variants %v", got)
+	}
+
+	for _, bad := range []string{"# error: no position\n", "# targets: mars, vax\n"} {
+		if _, err := Parse("bad.py", bad); err == nil || !strings.HasPrefix(err.Error(), "bad.py:1: ") {
+			t.Errorf("%q: expected a positioned error, got %v", bad, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	f, err := Parse("f.py", "# output: 2\nprint(1)\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.Check(Variant{Target: "mars"})
+	if err == nil || !strings.Contains(err.Error(), "wrong output") {
+		t.Errorf("expected wrong output, got %v", err)
+	}
+	results := Run([]*Fixture{f})
+	if len(results) != 4 || results[0].Err == nil {
+		t.Errorf("wrong results %+v", results)
+	}
+}
@@ -0,0 +1,334 @@
+// Package desugar lowers surface syntax to the small core AST that the
+// checker, optimizer and code generator understand. Each construct that is
+// only shorthand for core nodes is rewritten here rather than taught to
+// every later stage.
+package desugar
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+)
+
+// pass rewrites one kind of sugar; it receives every node, children first,
+// and returns the node unchanged when it does not apply
+type pass func(ast.Node) ast.Node
+
+// passes run in order, each over the output of the previous one
+var passes = []pass{
+	augmentedAssignment,
+	elifChains,
+	mainGuards,
+	forLoops,
+	tupleAssignments,
+	stringFormats,
+}
+
+// Program returns a copy of program with all sugar lowered. The input is
+// left unchanged, so tools can still show what was written.
+func Program(program *ast.Program) *ast.Program {
+	var node ast.Node = program
+	for _, p := range passes {
+		node = ast.Rewrite(node, p)
+	}
+	return node.(*ast.Program)
+}
+
+// augmentedAssignment rewrites x op= value to x = x op value, and xs[i] op=
+// value to xs[i] = xs[i] op value, which evaluates the index twice
+func augmentedAssignment(n ast.Node) ast.Node {
+	switch aug := n.(type) {
+	case *ast.AugmentedAssignment:
+		return ast.NewAssign(aug.Token, aug.Name, ast.NewBinary(ast.NewName(aug.Name, aug.Token), aug.Operator, aug.Value))
+	case *ast.IndexAssignment:
+		if aug.Operator != "" {
+			return ast.NewIndexAssign(aug.Token, aug.Target, "", ast.NewBinary(aug.Target, aug.Operator, aug.Value))
+		}
+	}
+	return n
+}
+
+// elifChains rewrites the elif branches of an if into an if nested in its
+// else block, one level per branch, keeping any final else innermost
+func elifChains(n ast.Node) ast.Node {
+	stmt, ok := n.(*ast.IfStatement)
+	if !ok || len(stmt.Elifs) == 0 {
+		return n
+	}
+	alternative := stmt.Alternative
+	for i := len(stmt.Elifs) - 1; i >= 0; i-- {
+		e := stmt.Elifs[i]
+		nested := ast.NewIf(e.Token, e.Condition, e.Consequence, alternative)
+		nested.Hint = e.Hint
+		alternative = []ast.Statement{nested}
+	}
+	c := *stmt
+	c.Elifs = nil
+	c.Alternative = alternative
+	return &c
+}
+
+// mainGuards replaces each if __name__ == "__main__": with its block, and
+// each if __name__ != "__main__": with its else block. There are no imports,
+// so the file compiled is always the main module.
+var mainGuards = expandStatements(func(stmt ast.Statement) []ast.Statement {
+	guard, ok := stmt.(*ast.IfStatement)
+	if !ok {
+		return nil
+	}
+	cond, ok := guard.Condition.(*ast.BinaryExpression)
+	if !ok || (cond.Operator != "==" && cond.Operator != "!=") || !isMainGuard(cond.Left, cond.Right) && !isMainGuard(cond.Right, cond.Left) {
+		return nil
+	}
+	block := guard.Consequence
+	if cond.Operator == "!=" {
+		block = guard.Alternative
+	}
+	// A nil result would keep the if
+	return append([]ast.Statement{}, block...)
+})
+
+// isMainGuard reports whether name is __name__ and value is "__main__"
+func isMainGuard(name, value ast.Expression) bool {
+	id, ok := name.(*ast.Identifier)
+	str, isStr := value.(*ast.StringLiteral)
+	return ok && isStr && id.Value == "__name__" && str.Value == "__main__"
+}
+
+// forLoops rewrites each for loop over range to a while loop driven by a
+// hidden counter, which is copied to the loop variable at the top of each
+// pass, so the body assigning the variable does not change the values that
+// follow:
+//
+//	(i counter) = start
+//	(i stop) = stop
+//	while (i counter) < (i stop):
+//		i = (i counter)
+//		(i counter) = (i counter) + step
+//		body
+//
+// Stop and any step but a literal are copied to hidden temporaries before
+// the first pass, so each is read once as range reads its arguments, and
+// the body changing them does not change the values the loop runs through;
+// a literal is used as it is. A negative literal step counts down, testing
+// (i counter) > (i stop) instead. Any other step's sign picks the test on
+// each pass:
+//
+//	while (i step) > 0 and (i counter) < (i stop) or (i step) < 0 and (i counter) > (i stop):
+//
+// A step of zero then runs the body no times; the checker rejects a literal
+// zero before this stage. The hidden names carry the loop's position, so a
+// loop nested in another over the same variable has counters of its own.
+var forLoops = expandStatements(func(stmt ast.Statement) []ast.Statement {
+	loop, ok := stmt.(*ast.ForStatement)
+	if !ok {
+		return nil
+	}
+	tok := loop.Token
+	hidden := func(role string) string {
+		return fmt.Sprintf("(%s %s %d:%d)", loop.Variable, role, tok.Line, tok.Column)
+	}
+	start := loop.Start
+	if start == nil {
+		start = ast.NewInteger(0, tok)
+	}
+	counterName := hidden("counter")
+	counter := func() ast.Expression { return ast.NewName(counterName, tok) }
+	out := []ast.Statement{ast.NewAssign(tok, counterName, start)}
+
+	stop := func() ast.Expression { return loop.Stop }
+	if _, ok := loop.Stop.(*ast.IntegerLiteral); !ok {
+		stopName := hidden("stop")
+		out = append(out, ast.NewAssign(tok, stopName, loop.Stop))
+		stop = func() ast.Expression { return ast.NewName(stopName, tok) }
+	}
+
+	var step, condition ast.Expression
+	switch s := loop.Step.(type) {
+	case nil:
+		step = ast.NewInteger(1, tok)
+		condition = ast.NewBinary(counter(), "<", stop())
+	case *ast.IntegerLiteral:
+		step = s
+		if s.Value < 0 {
+			condition = ast.NewBinary(counter(), ">", stop())
+		} else {
+			condition = ast.NewBinary(counter(), "<", stop())
+		}
+	default:
+		stepName := hidden("step")
+		out = append(out, ast.NewAssign(tok, stepName, s))
+		step = ast.NewName(stepName, tok)
+		sign := func(op string) ast.Expression {
+			return ast.NewBinary(ast.NewName(stepName, tok), op, ast.NewInteger(0, tok))
+		}
+		up := ast.NewBinary(sign(">"), "and", ast.NewBinary(counter(), "<", stop()))
+		down := ast.NewBinary(sign("<"), "and", ast.NewBinary(counter(), ">", stop()))
+		condition = ast.NewBinary(up, "or", down)
+	}
+	body := append([]ast.Statement{
+		ast.NewAssign(tok, loop.Variable, counter()),
+		ast.NewAssign(tok, counterName, ast.NewBinary(counter(), "+", step)),
+	}, loop.Body...)
+	return append(out, ast.NewWhile(tok, condition, body))
+})
+
+// tupleAssignments rewrites a, b = x, y to one assignment per name. When a
+// value reads one of the names, every value is first copied to a hidden
+// temporary, named so no identifier can spell it, so that a, b = b, a swaps.
+// The temporaries are marked so the code generator can keep them in
+// registers.
+var tupleAssignments = expandStatements(func(stmt ast.Statement) []ast.Statement {
+	tuple, ok := stmt.(*ast.TupleAssignment)
+	if !ok {
+		return nil
+	}
+	assign := func(name string, value ast.Expression) ast.Statement {
+		return ast.NewAssign(tuple.Token, name, value)
+	}
+
+	var out []ast.Statement
+	if !readsAny(tuple.Values, tuple.Names) {
+		for i, name := range tuple.Names {
+			out = append(out, assign(name, tuple.Values[i]))
+		}
+		return out
+	}
+	for i, name := range tuple.Names {
+		temp := ast.NewAssign(tuple.Token, "("+name+")", tuple.Values[i])
+		temp.Temporary = true
+		out = append(out, temp)
+	}
+	for _, name := range tuple.Names {
+		temp := "(" + name + ")"
+		out = append(out, assign(name, ast.NewName(temp, tuple.Token)))
+	}
+	return out
+})
+
+// stringFormats rewrites "text %d text" % value, whose format string holds
+// exactly one %d, %i or %s conversion, to the concatenation of its text
+// around format(value). A width, as in %5d or %-5d, is passed on to
+// format, and %% stands for a single %. Any other use of % on a string
+// literal is left for the checker to report.
+func stringFormats(n ast.Node) ast.Node {
+	b, ok := n.(*ast.BinaryExpression)
+	if !ok || b.Operator != "%" {
+		return n
+	}
+	lit, ok := b.Left.(*ast.StringLiteral)
+	if !ok {
+		return n
+	}
+	before, width, after, ok := splitFormat(lit.Value)
+	if !ok {
+		return n
+	}
+	args := []ast.Expression{b.Right}
+	if width != 0 {
+		args = append(args, ast.NewInteger(int64(width), lit.Token))
+	}
+	var result ast.Expression = ast.NewCall("format", lit.Token, args)
+	if before != "" {
+		result = ast.NewBinary(ast.NewString(before, lit.Token), "+", result)
+	}
+	if after != "" {
+		result = ast.NewBinary(result, "+", ast.NewString(after, lit.Token))
+	}
+	return result
+}
+
+// splitFormat finds the one conversion in a format string, returning the
+// text on either side of it with each %% made a % and its width, negative
+// when the - flag left-aligns
+func splitFormat(format string) (before string, width int, after string, ok bool) {
+	var text strings.Builder
+	found := false
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			text.WriteByte(format[i])
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			text.WriteByte('%')
+			continue
+		}
+		start := i
+		if i < len(format) && format[i] == '-' {
+			i++
+		}
+		digits := i
+		for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+			i++
+		}
+		// A leading 0 would ask for zeros rather than spaces
+		if found || i == len(format) || !strings.ContainsRune("dis", rune(format[i])) || format[digits] == '0' {
+			return "", 0, "", false
+		}
+		if i > digits {
+			width, _ = strconv.Atoi(format[digits:i])
+			if digits > start {
+				width = -width
+			}
+		}
+		before = text.String()
+		text.Reset()
+		found = true
+	}
+	return before, width, text.String(), found
+}
+
+// readsAny reports whether any of exprs reads one of the variables names
+func readsAny(exprs []ast.Expression, names []string) bool {
+	found := false
+	for _, e := range exprs {
+		ast.Rewrite(e, func(n ast.Node) ast.Node {
+			if id, ok := n.(*ast.Identifier); ok && slices.Contains(names, id.Value) {
+				found = true
+			}
+			return n
+		})
+	}
+	return found
+}
+
+// expandStatements makes a pass that replaces each statement for which
+// expand returns a non-nil slice with the statements in it. The blocks
+// holding a statement are rewritten rather than the statement itself, since
+// one statement may become several.
+func expandStatements(expand func(ast.Statement) []ast.Statement) pass {
+	block := func(stmts []ast.Statement) []ast.Statement {
+		if stmts == nil {
+			return nil
+		}
+		out := make([]ast.Statement, 0, len(stmts))
+		for _, stmt := range stmts {
+			if replacement := expand(stmt); replacement != nil {
+				out = append(out, replacement...)
+			} else {
+				out = append(out, stmt)
+			}
+		}
+		return out
+	}
+	return func(n ast.Node) ast.Node {
+		switch s := n.(type) {
+		case *ast.Program:
+			s.Statements = block(s.Statements)
+		case *ast.FunctionDefinition:
+			s.Body = block(s.Body)
+		case *ast.IfStatement:
+			s.Consequence = block(s.Consequence)
+			s.Alternative = block(s.Alternative)
+		case *ast.WhileStatement:
+			s.Body = block(s.Body)
+		case *ast.ForStatement:
+			s.Body = block(s.Body)
+		}
+		return n
+	}
+}
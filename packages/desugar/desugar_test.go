@@ -0,0 +1,131 @@
+package desugar
+
+import (
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/parser"
+)
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "augmented assignment",
+			input:    "x += 1\n",
+			expected: "Program\n  Assignment x\n    Binary +\n      Identifier x\n      Integer 1\n",
+		},
+		{
+			name:     "augmented assignment keeps the value grouped",
+			input:    "x *= y - 1\n",
+			expected: "Program\n  Assignment x\n    Binary *\n      Identifier x\n      Binary -\n        Identifier y\n        Integer 1\n",
+		},
+		{
+			name:     "augmented assignment to a list element",
+			input:    "g[i][0] += 2\n",
+			expected: "Program\n  IndexAssignment =\n    Index\n      Index\n        Identifier g\n        Identifier i\n      Integer 0\n    Binary +\n      Index\n        Index\n          Identifier g\n          Identifier i\n        Integer 0\n      Integer 2\n",
+		},
+		{
+			name:     "inside blocks",
+			input:    "def f(a):\n\twhile a > 0:\n\t\ta -= 1\n\treturn a\n",
+			expected: "Program\n  FunctionDefinition f(a)\n    Body\n      While\n        Binary >\n          Identifier a\n          Integer 0\n        Body\n          Assignment a\n            Binary -\n              Identifier a\n              Integer 1\n      Return\n        Identifier a\n",
+		},
+		{
+			name:     "elif nests in the else block",
+			input:    "if x > 1:\n\ty = 1\nelif x > 0:\n\ty = 2\nelse:\n\ty = 3\n",
+			expected: "Program\n  If\n    Binary >\n      Identifier x\n      Integer 1\n    Then\n      Assignment y\n        Integer 1\n    Else\n      If\n        Binary >\n          Identifier x\n          Integer 0\n        Then\n          Assignment y\n            Integer 2\n        Else\n          Assignment y\n            Integer 3\n",
+		},
+		{
+			name:     "elif keeps its branch hint",
+			input:    "if x > 1:\n\ty = 1\nelif x > 0:  # pragma: unlikely\n\ty = 2\n",
+			expected: "Program\n  If\n    Binary >\n      Identifier x\n      Integer 1\n    Then\n      Assignment y\n        Integer 1\n    Else\n      If (unlikely)\n        Binary >\n          Identifier x\n          Integer 0\n        Then\n          Assignment y\n            Integer 2\n",
+		},
+		{
+			name:     "for over range becomes a while loop driven by a hidden counter",
+			input:    "for i in range(1, n):\n\tprint(i)\n",
+			expected: "Program\n  Assignment (i counter 1:1)\n    Integer 1\n  Assignment (i stop 1:1)\n    Identifier n\n  While\n    Binary <\n      Identifier (i counter 1:1)\n      Identifier (i stop 1:1)\n    Body\n      Assignment i\n        Identifier (i counter 1:1)\n      Assignment (i counter 1:1)\n        Binary +\n          Identifier (i counter 1:1)\n          Integer 1\n      Print\n        Identifier i\n",
+		},
+		{
+			name:     "nested for starts at zero",
+			input:    "while x > 0:\n\tfor j in range(3):\n\t\tx -= j\n",
+			expected: "Program\n  While\n    Binary >\n      Identifier x\n      Integer 0\n    Body\n      Assignment (j counter 2:2)\n        Integer 0\n      While\n        Binary <\n          Identifier (j counter 2:2)\n          Integer 3\n        Body\n          Assignment j\n            Identifier (j counter 2:2)\n          Assignment (j counter 2:2)\n            Binary +\n              Identifier (j counter 2:2)\n              Integer 1\n          Assignment x\n            Binary -\n              Identifier x\n              Identifier j\n",
+		},
+		{
+			name:     "negative step counts down",
+			input:    "for i in range(n, 0, -2):\n\tprint(i)\n",
+			expected: "Program\n  Assignment (i counter 1:1)\n    Identifier n\n  While\n    Binary >\n      Identifier (i counter 1:1)\n      Integer 0\n    Body\n      Assignment i\n        Identifier (i counter 1:1)\n      Assignment (i counter 1:1)\n        Binary +\n          Identifier (i counter 1:1)\n          Integer -2\n      Print\n        Identifier i\n",
+		},
+		{
+			name:     "variable stop and step are read once",
+			input:    "for i in range(0, n, s):\n\tprint(i)\n",
+			expected: "Program\n  Assignment (i counter 1:1)\n    Integer 0\n  Assignment (i stop 1:1)\n    Identifier n\n  Assignment (i step 1:1)\n    Identifier s\n  While\n    Binary or\n      Binary and\n        Binary >\n          Identifier (i step 1:1)\n          Integer 0\n        Binary <\n          Identifier (i counter 1:1)\n          Identifier (i stop 1:1)\n      Binary and\n        Binary <\n          Identifier (i step 1:1)\n          Integer 0\n        Binary >\n          Identifier (i counter 1:1)\n          Identifier (i stop 1:1)\n    Body\n      Assignment i\n        Identifier (i counter 1:1)\n      Assignment (i counter 1:1)\n        Binary +\n          Identifier (i counter 1:1)\n          Identifier (i step 1:1)\n      Print\n        Identifier i\n",
+		},
+		{
+			name:     "independent tuple assignment",
+			input:    "a, b = 1, c\n",
+			expected: "Program\n  Assignment a\n    Integer 1\n  Assignment b\n    Identifier c\n",
+		},
+		{
+			name:     "swap goes through temporaries",
+			input:    "a, b = b, a\n",
+			expected: "Program\n  Assignment (a)\n    Identifier b\n  Assignment (b)\n    Identifier a\n  Assignment a\n    Identifier (a)\n  Assignment b\n    Identifier (b)\n",
+		},
+		{
+			name:     "main guard becomes its block",
+			input:    "def f():\n\tprint(1)\nif __name__ == \"__main__\":\n\tf()\nelse:\n\tprint(2)\n",
+			expected: "Program\n  FunctionDefinition f()\n    Body\n      Print\n        Integer 1\n  ExpressionStatement\n    Call f\n",
+		},
+		{
+			name:     "negated main guard becomes its else block",
+			input:    "if \"__main__\" != __name__:\n\tprint(1)\nelif x > 0:\n\tprint(2)\n",
+			expected: "Program\n  If\n    Binary >\n      Identifier x\n      Integer 0\n    Then\n      Print\n        Integer 2\n",
+		},
+		{
+			name:     "negated main guard without an else",
+			input:    "if __name__ != \"__main__\":\n\tprint(1)\nx = 1\n",
+			expected: "Program\n  Assignment x\n    Integer 1\n",
+		},
+		{
+			name:     "format string becomes a concatenation",
+			input:    "s = \"%d items\" % n\n",
+			expected: "Program\n  Assignment s\n    Binary +\n      Call format\n        Identifier n\n      String \" items\"\n",
+		},
+		{
+			name:     "format string with a width and a literal percent",
+			input:    "print(\"[%-5s] 100%%\" % name)\n",
+			expected: "Program\n  Print\n    Binary +\n      Binary +\n        String \"[\"\n        Call format\n          Identifier name\n          Integer -5\n      String \"] 100%\"\n",
+		},
+		{
+			name:     "format string with two conversions is left alone",
+			input:    "s = \"%d and %d\" % n\n",
+			expected: "Program\n  Assignment s\n    Binary %\n      String \"%d and %d\"\n      Identifier n\n",
+		},
+		{
+			name:     "core program unchanged",
+			input:    "x = 1\nprint(x)\n",
+			expected: "Program\n  Assignment x\n    Integer 1\n  Print\n    Identifier x\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			before := ast.Dump(program)
+
+			if got := ast.Dump(Program(program)); got != tt.expected {
+				t.Errorf("wrong core tree.\nexpected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+			if ast.Dump(program) != before {
+				t.Errorf("Program modified its input")
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Package diag defines the diagnostics reported by every compiler phase and
+// renders them for humans.
+package diag
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+	Note    Severity = "note"
+)
+
+// Diagnostic is a single positioned message. Line and Column are 1-based;
+// zero means the position is unknown. EndColumn, when set, is just past
+// the span of source the message is about, and Hint is a short note shown
+// beside the underlined span.
+type Diagnostic struct {
+	Severity  Severity `json:"severity"`
+	File      string   `json:"file,omitempty"`
+	Line      int      `json:"line,omitempty"`
+	Column    int      `json:"column,omitempty"`
+	EndColumn int      `json:"endColumn,omitempty"`
+	Message   string   `json:"message"`
+	Hint      string   `json:"hint,omitempty"`
+	Fixes     []Fix    `json:"fixes,omitempty"`
+}
+
+// Fix is a suggested edit that resolves a diagnostic: Text replaces the
+// source from Column up to but not including EndColumn on Line. Equal
+// columns insert Text.
+type Fix struct {
+	Message   string `json:"message"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndColumn int    `json:"endColumn"`
+	Text      string `json:"text"`
+}
+
+// Insert suggests adding text before column
+func Insert(message string, line, column int, text string) Fix {
+	return Fix{Message: message, Line: line, Column: column, EndColumn: column, Text: text}
+}
+
+// Replace suggests replacing the columns [column, end) with text
+func Replace(message string, line, column, end int, text string) Fix {
+	return Fix{Message: message, Line: line, Column: column, EndColumn: end, Text: text}
+}
+
+// Apply returns the source line with the fix made. Columns past the end of
+// the line are clamped to it.
+func (f Fix) Apply(line string) string {
+	start := clamp(f.Column-1, len(line))
+	end := clamp(f.EndColumn-1, len(line))
+	if end < start {
+		end = start
+	}
+	return line[:start] + f.Text + line[end:]
+}
+
+func clamp(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+// Errorf builds an error diagnostic at the given position
+func Errorf(line, column int, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{Severity: Error, Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+// Warningf builds a warning diagnostic at the given position
+func Warningf(line, column int, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{Severity: Warning, Line: line, Column: column, Message: fmt.Sprintf(format, args...)}
+}
+
+// String renders the diagnostic without color or source excerpt
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s%s: %s", d.Location(), d.Severity, d.Message)
+}
+
+// Location formats "file:line:col: " with unknown parts omitted
+func (d Diagnostic) Location() string {
+	loc := d.File
+	if d.Line > 0 {
+		if loc != "" {
+			loc += ":"
+		}
+		loc += strconv.Itoa(d.Line)
+		if d.Column > 0 {
+			loc += ":" + strconv.Itoa(d.Column)
+		}
+	}
+	if loc == "" {
+		return ""
+	}
+	return loc + ": "
+}
+
+var linePrefix = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// FromMessage converts a "line N: message" string, as parser.Error formats
+// one, into an error diagnostic.
+func FromMessage(msg string) Diagnostic {
+	if m := linePrefix.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return Diagnostic{Severity: Error, Line: line, Message: m[2]}
+	}
+	return Diagnostic{Severity: Error, Message: msg}
+}
+
+// HasErrors reports whether any diagnostic is an error
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package diag
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromMessage(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Diagnostic
+	}{
+		{"line 3: Expected ':' after if condition", Diagnostic{Severity: Error, Line: 3, Message: "Expected ':' after if condition"}},
+		{"something broke", Diagnostic{Severity: Error, Message: "something broke"}},
+	}
+	for _, tt := range tests {
+		if got := FromMessage(tt.input); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("FromMessage(%q) = %+v, want %+v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		d        Diagnostic
+		expected string
+	}{
+		{Diagnostic{Severity: Error, File: "a.py", Line: 2, Column: 5, Message: "bad"}, "a.py:2:5: error: bad"},
+		{Diagnostic{Severity: Warning, Line: 2, Message: "odd"}, "2: warning: odd"},
+		{Diagnostic{Severity: Note, Message: "fyi"}, "note: fyi"},
+	}
+	for _, tt := range tests {
+		if got := tt.d.String(); got != tt.expected {
+			t.Errorf("String() = %q, want %q", got, tt.expected)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	source := "x = 1\n\ty = * 5\n"
+	d := Diagnostic{Severity: Error, File: "a.py", Line: 2, Column: 6, Message: "Unexpected token *"}
+
+	t.Run("Plain", func(t *testing.T) {
+		var out strings.Builder
+		r := &Renderer{Out: &out, Source: source}
+		r.Render(d)
+		expected := "a.py:2:6: error: Unexpected token *\n    \ty = * 5\n    \t    ^\n"
+		if out.String() != expected {
+			t.Errorf("wrong output.\nexpected: %q\ngot:      %q", expected, out.String())
+		}
+	})
+
+	t.Run("Color", func(t *testing.T) {
+		var out strings.Builder
+		r := &Renderer{Out: &out, Source: source, Color: true}
+		r.Render(d)
+		for _, want := range []string{bold + "a.py:2:6: " + reset, bold + red + "error:" + reset, underline + "^" + reset} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("output missing %q: %q", want, out.String())
+			}
+		}
+	})
+
+	t.Run("Fixes", func(t *testing.T) {
+		var out strings.Builder
+		r := &Renderer{Out: &out, Source: "if x > 1\n\tprint(x)\n"}
+		r.Render(Diagnostic{Severity: Error, Line: 1, Message: "missing ':'", Fixes: []Fix{Insert("insert ':'", 1, 9, ":")}})
+		expected := "1: error: missing ':'\n    help: insert ':'\n    if x > 1:\n"
+		if out.String() != expected {
+			t.Errorf("wrong output.\nexpected: %q\ngot:      %q", expected, out.String())
+		}
+	})
+
+	t.Run("Span", func(t *testing.T) {
+		var out strings.Builder
+		r := &Renderer{Out: &out, Source: "x = 1\nprint = 5\n"}
+		r.Render(Diagnostic{Severity: Error, Line: 2, Column: 1, EndColumn: 6, Message: "reserved"})
+		expected := "2:1: error: reserved\n    print = 5\n    ^~~~~\n"
+		if out.String() != expected {
+			t.Errorf("wrong output.\nexpected: %q\ngot:      %q", expected, out.String())
+		}
+	})
+
+	t.Run("Hint", func(t *testing.T) {
+		var out strings.Builder
+		r := &Renderer{Out: &out, Source: "x = 1 +\n"}
+		d := Diagnostic{Severity: Error, Line: 1, Column: 7, EndColumn: 8, Message: "Expected an operand after '+'", Hint: "'+' needs a value on its right"}
+		r.Render(d)
+		expected := "1:7: error: Expected an operand after '+'\n    x = 1 +\n          ^ '+' needs a value on its right\n"
+		if out.String() != expected {
+			t.Errorf("wrong output.\nexpected: %q\ngot:      %q", expected, out.String())
+		}
+
+		out.Reset()
+		r.Source = ""
+		r.Render(d)
+		expected = "1:7: error: Expected an operand after '+'\n    hint: '+' needs a value on its right\n"
+		if out.String() != expected {
+			t.Errorf("wrong output without source.\nexpected: %q\ngot:      %q", expected, out.String())
+		}
+	})
+
+	t.Run("No Column", func(t *testing.T) {
+		var out strings.Builder
+		r := &Renderer{Out: &out, Source: source}
+		r.Render(Diagnostic{Severity: Warning, Line: 1, Message: "hmm"})
+		if out.String() != "1: warning: hmm\n" {
+			t.Errorf("expected no excerpt without a column, got %q", out.String())
+		}
+	})
+}
+
+func TestFixApply(t *testing.T) {
+	tests := []struct {
+		fix      Fix
+		line     string
+		expected string
+	}{
+		{Insert("", 1, 9, ":"), "if x > 1", "if x > 1:"},
+		{Insert("", 1, 20, ":"), "if x > 1", "if x > 1:"},
+		{Replace("", 1, 9, 10, "=="), "while x = 1:", "while x == 1:"},
+		{Replace("", 1, 1, 3, "y"), "x = 1", "y= 1"},
+	}
+	for _, tt := range tests {
+		if got := tt.fix.Apply(tt.line); got != tt.expected {
+			t.Errorf("Apply(%q) = %q, want %q", tt.line, got, tt.expected)
+		}
+	}
+}
+
+func TestFixJSON(t *testing.T) {
+	d := Diagnostic{Severity: Error, Line: 1, Message: "m", Fixes: []Fix{Replace("use ==", 1, 9, 10, "==")}}
+	out, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"severity":"error","line":1,"message":"m","fixes":[{"message":"use ==","line":1,"column":9,"endColumn":10,"text":"=="}]}`
+	if string(out) != expected {
+		t.Errorf("wrong JSON.\nexpected: %s\ngot:      %s", expected, out)
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	var out strings.Builder
+	if ColorEnabled(&out, false) {
+		t.Error("color should be disabled for non-terminal writers")
+	}
+}
@@ -0,0 +1,140 @@
+package diag
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// ANSI styles used by the renderer
+const (
+	reset     = "\x1b[0m"
+	bold      = "\x1b[1m"
+	underline = "\x1b[4m"
+	red       = "\x1b[31m"
+	yellow    = "\x1b[33m"
+	cyan      = "\x1b[36m"
+	green     = "\x1b[32m"
+)
+
+// Renderer prints diagnostics in the familiar compiler layout, with the
+// span underlined and its hint beside it, followed by any suggested fixes
+// and the line as it would read after each:
+//
+//	prog.py:3:5: error: message
+//	    x = 1 + * 5
+//	          ^ hint
+//	    help: insert ':'
+//	    if x > 1:
+//
+// Without the source line to underline, the hint gets a line of its own.
+type Renderer struct {
+	Out    io.Writer
+	Color  bool
+	Source string // optional; enables the source excerpt and caret
+}
+
+// Render writes one diagnostic
+func (r *Renderer) Render(d Diagnostic) {
+	var b strings.Builder
+	if loc := d.Location(); loc != "" {
+		b.WriteString(r.style(bold, loc))
+	}
+	b.WriteString(r.style(bold+severityColor(d.Severity), string(d.Severity)+":"))
+	b.WriteString(" " + r.style(bold, d.Message) + "\n")
+
+	if text, ok := sourceLine(r.Source, d.Line); ok && d.Column > 0 {
+		b.WriteString("    " + text + "\n")
+		b.WriteString("    " + caretPadding(text, d.Column) + r.style(bold+green+underline, marker(d)))
+		if d.Hint != "" {
+			b.WriteString(" " + r.style(bold+green, d.Hint))
+		}
+		b.WriteString("\n")
+	} else if d.Hint != "" {
+		b.WriteString("    " + r.style(bold+green, "hint:") + " " + d.Hint + "\n")
+	}
+	for _, fix := range d.Fixes {
+		b.WriteString("    " + r.style(bold+cyan, "help:") + " " + fix.Message + "\n")
+		if text, ok := sourceLine(r.Source, fix.Line); ok {
+			b.WriteString("    " + r.style(green, fix.Apply(text)) + "\n")
+		}
+	}
+	io.WriteString(r.Out, b.String())
+}
+
+// RenderAll writes every diagnostic in order
+func (r *Renderer) RenderAll(diags []Diagnostic) {
+	for _, d := range diags {
+		r.Render(d)
+	}
+}
+
+func (r *Renderer) style(codes, s string) string {
+	if !r.Color {
+		return s
+	}
+	return codes + s + reset
+}
+
+func severityColor(s Severity) string {
+	switch s {
+	case Error:
+		return red
+	case Warning:
+		return yellow
+	}
+	return cyan
+}
+
+func sourceLine(source string, line int) (string, bool) {
+	if source == "" || line <= 0 {
+		return "", false
+	}
+	lines := strings.Split(source, "\n")
+	if line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// marker underlines the span of d: a caret at its start and tildes for the
+// rest
+func marker(d Diagnostic) string {
+	if d.EndColumn <= d.Column {
+		return "^"
+	}
+	return "^" + strings.Repeat("~", d.EndColumn-d.Column-1)
+}
+
+// caretPadding reproduces the tabs of the source line so the caret lines up
+func caretPadding(text string, column int) string {
+	var pad strings.Builder
+	for i := 0; i < column-1 && i < len(text); i++ {
+		if text[i] == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	for i := len(text); i < column-1; i++ {
+		pad.WriteByte(' ')
+	}
+	return pad.String()
+}
+
+// ColorEnabled decides whether output to w should be styled: only terminals
+// get color, and NO_COLOR or TERM=dumb turn it off like in other tools.
+func ColorEnabled(w io.Writer, noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,471 @@
+package emulator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type operandKind int
+
+const (
+	opReg operandKind = iota
+	opImm
+	opLabel
+	opMem
+	opFReg
+)
+
+// operand is a pre-decoded instruction argument. For memory and label
+// operands the label is folded into imm once all addresses are known.
+type operand struct {
+	kind  operandKind
+	reg   int
+	imm   int64
+	label string
+}
+
+type instr struct {
+	op   string
+	args []operand
+	line int
+}
+
+type fixup struct {
+	addr  uint32
+	label string
+	line  int
+}
+
+// AssembleError reports a problem in the assembly source
+type AssembleError struct {
+	Line int
+	Msg  string
+}
+
+func (e *AssembleError) Error() string {
+	return fmt.Sprintf("asm line %d: %s", e.Line, e.Msg)
+}
+
+var regNames = map[string]int{
+	"zero": 0, "at": 1, "v0": 2, "v1": 3,
+	"a0": 4, "a1": 5, "a2": 6, "a3": 7,
+	"t0": 8, "t1": 9, "t2": 10, "t3": 11, "t4": 12, "t5": 13, "t6": 14, "t7": 15,
+	"s0": 16, "s1": 17, "s2": 18, "s3": 19, "s4": 20, "s5": 21, "s6": 22, "s7": 23,
+	"t8": 24, "t9": 25, "k0": 26, "k1": 27, "gp": 28, "sp": 29, "fp": 30, "ra": 31,
+}
+
+const (
+	regV0 = 2
+	regA0 = 4
+	regA1 = 5
+	regGP = 28
+	regSP = 29
+	regRA = 31
+)
+
+func (m *Machine) assemble(src string) error {
+	inText := true
+	dataPtr := uint32(DataBase)
+	var pending []string
+	var fixups []fixup
+
+	bind := func(addr uint32) {
+		for _, l := range pending {
+			m.labels[l] = addr
+		}
+		pending = pending[:0]
+	}
+
+	type rawInstr struct {
+		op   string
+		args []string
+		line int
+	}
+	var raw []rawInstr
+
+	for i, line := range strings.Split(src, "\n") {
+		lineNo := i + 1
+		line = strings.TrimSpace(stripComment(line))
+
+		// Peel off any leading labels
+		for {
+			name, rest, ok := splitLabel(line)
+			if !ok {
+				break
+			}
+			if _, dup := m.labels[name]; dup {
+				return &AssembleError{lineNo, fmt.Sprintf("label %q already defined", name)}
+			}
+			for _, p := range pending {
+				if p == name {
+					return &AssembleError{lineNo, fmt.Sprintf("label %q already defined", name)}
+				}
+			}
+			pending = append(pending, name)
+			line = strings.TrimSpace(rest)
+		}
+		if line == "" {
+			continue
+		}
+
+		word, rest := splitWord(line)
+		if strings.HasPrefix(word, ".") {
+			switch word {
+			case ".data":
+				if inText {
+					bind(textAddr(len(raw)))
+				} else {
+					bind(dataPtr)
+				}
+				inText = false
+				continue
+			case ".text":
+				if !inText {
+					bind(dataPtr)
+				} else {
+					bind(textAddr(len(raw)))
+				}
+				inText = true
+				continue
+			case ".globl", ".global", ".extern", ".ent", ".end", ".set":
+				continue
+			}
+			if inText {
+				return &AssembleError{lineNo, fmt.Sprintf("directive %s not allowed in .text", word)}
+			}
+			next, err := m.dataDirective(word, rest, dataPtr, lineNo, bind, &fixups)
+			if err != nil {
+				return err
+			}
+			dataPtr = next
+			continue
+		}
+
+		if !inText {
+			return &AssembleError{lineNo, fmt.Sprintf("instruction %q in .data segment", word)}
+		}
+		bind(textAddr(len(raw)))
+		raw = append(raw, rawInstr{op: strings.ToLower(word), args: splitArgs(rest), line: lineNo})
+	}
+	if inText {
+		bind(textAddr(len(raw)))
+	} else {
+		bind(dataPtr)
+	}
+
+	for _, f := range fixups {
+		addr, ok := m.labels[f.label]
+		if !ok {
+			return &AssembleError{f.line, fmt.Sprintf("undefined label %q", f.label)}
+		}
+		_ = m.mem.store32(f.addr, int32(addr))
+	}
+
+	m.prog = make([]instr, len(raw))
+	for i, r := range raw {
+		in := instr{op: r.op, line: r.line}
+		for _, a := range r.args {
+			o, err := parseOperand(a)
+			if err != nil {
+				return &AssembleError{r.line, err.Error()}
+			}
+			if o.label != "" {
+				addr, ok := m.labels[o.label]
+				if !ok {
+					return &AssembleError{r.line, fmt.Sprintf("undefined label %q", o.label)}
+				}
+				o.imm += int64(addr)
+			}
+			in.args = append(in.args, o)
+		}
+		if !knownOp(in.op) {
+			return &AssembleError{r.line, fmt.Sprintf("unknown instruction %q", r.op)}
+		}
+		m.prog[i] = in
+	}
+	return nil
+}
+
+func (m *Machine) dataDirective(word, rest string, ptr uint32, line int, bind func(uint32), fixups *[]fixup) (uint32, error) {
+	align := func(n uint32) {
+		if n > 1 && ptr%n != 0 {
+			ptr += n - ptr%n
+		}
+	}
+	switch word {
+	case ".word":
+		align(4)
+		bind(ptr)
+		for _, a := range splitArgs(rest) {
+			if v, err := parseImmediate(a); err == nil {
+				_ = m.mem.store32(ptr, int32(v))
+			} else if isLabel(a) {
+				*fixups = append(*fixups, fixup{addr: ptr, label: a, line: line})
+			} else {
+				return 0, &AssembleError{line, fmt.Sprintf("bad .word value %q", a)}
+			}
+			ptr += 4
+		}
+	case ".float":
+		align(4)
+		bind(ptr)
+		for _, a := range splitArgs(rest) {
+			v, err := strconv.ParseFloat(a, 32)
+			if err != nil {
+				return 0, &AssembleError{line, fmt.Sprintf("bad .float value %q", a)}
+			}
+			_ = m.mem.store32(ptr, int32(math.Float32bits(float32(v))))
+			ptr += 4
+		}
+	case ".half":
+		align(2)
+		bind(ptr)
+		for _, a := range splitArgs(rest) {
+			v, err := parseImmediate(a)
+			if err != nil {
+				return 0, &AssembleError{line, fmt.Sprintf("bad .half value %q", a)}
+			}
+			_ = m.mem.store16(ptr, int16(v))
+			ptr += 2
+		}
+	case ".byte":
+		bind(ptr)
+		for _, a := range splitArgs(rest) {
+			v, err := parseImmediate(a)
+			if err != nil {
+				return 0, &AssembleError{line, fmt.Sprintf("bad .byte value %q", a)}
+			}
+			m.mem.store8(ptr, byte(v))
+			ptr++
+		}
+	case ".space":
+		bind(ptr)
+		n, err := parseImmediate(strings.TrimSpace(rest))
+		if err != nil || n < 0 {
+			return 0, &AssembleError{line, fmt.Sprintf("bad .space size %q", rest)}
+		}
+		ptr += uint32(n)
+	case ".align":
+		n, err := parseImmediate(strings.TrimSpace(rest))
+		if err != nil || n < 0 || n > 8 {
+			return 0, &AssembleError{line, fmt.Sprintf("bad .align value %q", rest)}
+		}
+		align(1 << uint(n))
+		bind(ptr)
+	case ".ascii", ".asciiz":
+		bind(ptr)
+		s, err := parseStringLiteral(strings.TrimSpace(rest))
+		if err != nil {
+			return 0, &AssembleError{line, err.Error()}
+		}
+		for i := 0; i < len(s); i++ {
+			m.mem.store8(ptr, s[i])
+			ptr++
+		}
+		if word == ".asciiz" {
+			m.mem.store8(ptr, 0)
+			ptr++
+		}
+	default:
+		return 0, &AssembleError{line, fmt.Sprintf("unsupported directive %s", word)}
+	}
+	return ptr, nil
+}
+
+// stripComment removes a trailing # comment, ignoring # inside quotes
+func stripComment(line string) string {
+	inStr := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if inStr {
+				i++
+			}
+		case '"':
+			inStr = !inStr
+		case '#':
+			if !inStr {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+func splitLabel(line string) (string, string, bool) {
+	idx := strings.IndexByte(line, ':')
+	if idx <= 0 {
+		return "", "", false
+	}
+	name := line[:idx]
+	if !isLabel(name) {
+		return "", "", false
+	}
+	return name, line[idx+1:], true
+}
+
+func splitWord(line string) (string, string) {
+	idx := strings.IndexAny(line, " \t")
+	if idx < 0 {
+		return line, ""
+	}
+	return line[:idx], strings.TrimSpace(line[idx+1:])
+}
+
+// splitArgs splits on commas that are not inside quotes
+func splitArgs(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	var args []string
+	inStr := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inStr {
+				i++
+			}
+		case '"':
+			inStr = !inStr
+		case ',':
+			if !inStr {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+func isLabel(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '.' || c == '$'
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return s[0] != '$'
+}
+
+func parseRegister(s string) (int, error) {
+	if !strings.HasPrefix(s, "$") {
+		return 0, fmt.Errorf("expected register, got %q", s)
+	}
+	name := s[1:]
+	if n, ok := regNames[name]; ok {
+		return n, nil
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 0 && n < 32 {
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown register %q", s)
+}
+
+func parseImmediate(s string) (int64, error) {
+	if len(s) >= 3 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		lit, err := parseStringLiteral(`"` + s[1:len(s)-1] + `"`)
+		if err != nil || len(lit) != 1 {
+			return 0, fmt.Errorf("bad character literal %s", s)
+		}
+		return int64(lit[0]), nil
+	}
+	v, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		// Allow unsigned 32-bit hex such as 0xDEADBEEF
+		u, uerr := strconv.ParseUint(s, 0, 32)
+		if uerr != nil {
+			return 0, err
+		}
+		return int64(int32(uint32(u))), nil
+	}
+	return v, nil
+}
+
+func parseOperand(s string) (operand, error) {
+	if s == "" {
+		return operand{}, fmt.Errorf("empty operand")
+	}
+	if open := strings.IndexByte(s, '('); open >= 0 && strings.HasSuffix(s, ")") {
+		reg, err := parseRegister(strings.TrimSpace(s[open+1 : len(s)-1]))
+		if err != nil {
+			return operand{}, err
+		}
+		o := operand{kind: opMem, reg: reg}
+		prefix := strings.TrimSpace(s[:open])
+		if prefix != "" {
+			base, err := parseOperand(prefix)
+			if err != nil || (base.kind != opImm && base.kind != opLabel) {
+				return operand{}, fmt.Errorf("bad memory operand %q", s)
+			}
+			o.imm, o.label = base.imm, base.label
+		}
+		return o, nil
+	}
+	if n, ok := parseFloatRegister(s); ok {
+		return operand{kind: opFReg, reg: n}, nil
+	}
+	if s[0] == '$' {
+		reg, err := parseRegister(s)
+		return operand{kind: opReg, reg: reg}, err
+	}
+	if v, err := parseImmediate(s); err == nil {
+		return operand{kind: opImm, reg: -1, imm: v}, nil
+	}
+	label, off := s, int64(0)
+	if idx := strings.LastIndexAny(s, "+-"); idx > 0 {
+		v, err := parseImmediate(strings.TrimSpace(s[idx:]))
+		if err == nil {
+			label, off = strings.TrimSpace(s[:idx]), v
+		}
+	}
+	if !isLabel(label) {
+		return operand{}, fmt.Errorf("bad operand %q", s)
+	}
+	return operand{kind: opLabel, reg: -1, imm: off, label: label}, nil
+}
+
+func parseStringLiteral(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("expected quoted string, got %s", s)
+	}
+	body := s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(body) {
+			return "", fmt.Errorf("unterminated escape in %s", s)
+		}
+		switch body[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case '\\':
+			b.WriteByte('\\')
+		case '"':
+			b.WriteByte('"')
+		case '\'':
+			b.WriteByte('\'')
+		default:
+			return "", fmt.Errorf("unknown escape \\%c in %s", body[i], s)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,205 @@
+// Package emulator executes the MIPS assembly produced by the code generator.
+// It understands the subset of MARS syntax, directives and syscalls that the
+// compiler emits, which is enough to run programs without an external
+// simulator.
+package emulator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Memory layout mirrors the MARS defaults so addresses in traces look familiar.
+const (
+	TextBase = 0x00400000
+	DataBase = 0x10010000
+	HeapBase = 0x10040000
+	StackTop = 0x7fffeffc
+)
+
+// DefaultMaxSteps bounds execution when Config.MaxSteps is zero.
+const DefaultMaxSteps = 10_000_000
+
+// ErrStepLimit is returned when a program executes more instructions than allowed.
+var ErrStepLimit = errors.New("step limit exceeded")
+
+// Config controls a single emulator run
+type Config struct {
+	Stdin    io.Reader
+	Stdout   io.Writer
+	MaxSteps int  // 0 means DefaultMaxSteps
+	Profile  bool // count executions of each instruction in Result.Profile
+}
+
+// Result describes a finished run
+type Result struct {
+	ExitCode int
+	Steps    int   // number of instructions executed
+	Profile  []int // executions per instruction, indexed like LabelIndex; nil unless Config.Profile
+}
+
+// RuntimeError is reported when the program faults while executing
+type RuntimeError struct {
+	Line int // line in the assembly source
+	Msg  string
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("runtime error at asm line %d: %s", e.Line, e.Msg)
+}
+
+// Machine holds the state of one emulated processor
+type Machine struct {
+	regs   [32]int32
+	hi, lo int32
+	fregs  [32]uint32 // coprocessor 1 registers, as raw bits
+	fcc    bool       // the FPU condition flag set by c.*.s
+	pc     int        // index into prog
+	mem    *memory
+	prog   []instr
+	labels map[string]uint32
+	heap   uint32
+	in     *bufio.Reader
+	out    io.Writer
+	steps  int
+	halted bool
+	exit   int
+}
+
+// Run assembles and executes the given program
+func Run(asm string, cfg Config) (*Result, error) {
+	m, err := Load(asm)
+	if err != nil {
+		return nil, err
+	}
+	return m.Run(cfg)
+}
+
+// Load assembles a program without running it. Memory is little-endian
+// unless the program opens with an "# endian: big" header, as the compiler
+// writes for big-endian targets.
+func Load(asm string) (*Machine, error) {
+	m := &Machine{
+		mem:    newMemory(),
+		labels: make(map[string]uint32),
+		heap:   HeapBase,
+	}
+	m.mem.bigEndian = declaredEndian(asm) == "big"
+	if err := m.assemble(asm); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// declaredEndian returns the byte order named by an "# endian:" comment
+// among the program's leading comment lines, or "" when there is none
+func declaredEndian(asm string) string {
+	for _, line := range strings.Split(asm, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "#") {
+			return ""
+		}
+		if order, ok := strings.CutPrefix(strings.TrimSpace(strings.TrimPrefix(line, "#")), "endian:"); ok {
+			return strings.TrimSpace(order)
+		}
+	}
+	return ""
+}
+
+// Run executes the loaded program until it exits or faults
+func (m *Machine) Run(cfg Config) (*Result, error) {
+	if cfg.Stdin == nil {
+		cfg.Stdin = strings.NewReader("")
+	}
+	if cfg.Stdout == nil {
+		cfg.Stdout = io.Discard
+	}
+	limit := cfg.MaxSteps
+	if limit == 0 {
+		limit = DefaultMaxSteps
+	}
+	var profile []int
+	if cfg.Profile {
+		profile = make([]int, len(m.prog))
+	}
+	m.in = bufio.NewReader(cfg.Stdin)
+	m.out = cfg.Stdout
+
+	m.regs[regSP] = StackTop
+	m.regs[regGP] = 0x10008000
+	m.pc = 0
+	if addr, ok := m.labels["main"]; ok && isText(addr) {
+		m.pc = textIndex(addr)
+	}
+
+	for !m.halted {
+		if m.pc < 0 || m.pc >= len(m.prog) {
+			// Falling off the end of the text segment ends the program
+			break
+		}
+		if m.steps >= limit {
+			return &Result{ExitCode: m.exit, Steps: m.steps, Profile: profile}, ErrStepLimit
+		}
+		in := &m.prog[m.pc]
+		if profile != nil {
+			profile[m.pc]++
+		}
+		m.pc++
+		m.steps++
+		if err := m.execute(in); err != nil {
+			return &Result{ExitCode: m.exit, Steps: m.steps, Profile: profile}, &RuntimeError{Line: in.line, Msg: err.Error()}
+		}
+		m.regs[0] = 0
+	}
+
+	return &Result{ExitCode: m.exit, Steps: m.steps, Profile: profile}, nil
+}
+
+// InstructionCount returns the number of instructions in the text segment
+func (m *Machine) InstructionCount() int {
+	return len(m.prog)
+}
+
+// Register returns the current value of a general purpose register by number
+func (m *Machine) Register(n int) int32 {
+	return m.regs[n]
+}
+
+// LoadWord reads a word from memory, for inspecting state after a run
+func (m *Machine) LoadWord(addr uint32) (int32, error) {
+	return m.mem.load32(addr)
+}
+
+// Label returns the address bound to a label
+func (m *Machine) Label(name string) (uint32, bool) {
+	addr, ok := m.labels[name]
+	return addr, ok
+}
+
+// LabelIndex returns the position in the text segment of the instruction a
+// label is bound to
+func (m *Machine) LabelIndex(name string) (int, bool) {
+	addr, ok := m.labels[name]
+	if !ok || !isText(addr) {
+		return 0, false
+	}
+	return textIndex(addr), true
+}
+
+func isText(addr uint32) bool {
+	return addr >= TextBase && addr < DataBase
+}
+
+func textIndex(addr uint32) int {
+	return int(addr-TextBase) / 4
+}
+
+func textAddr(index int) uint32 {
+	return TextBase + uint32(index)*4
+}
@@ -0,0 +1,295 @@
+package emulator
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunPrograms(t *testing.T) {
+	tests := []struct {
+		name     string
+		asm      string
+		stdin    string
+		expected string
+	}{
+		{
+			name: "Print Integer And String",
+			asm: `.data
+newline: .asciiz "\n"
+x: .word 0
+str_0: .asciiz "hello"
+
+.text
+main:
+    li $t0, 42
+    sw $t0, x
+    lw $t1, x
+    move $a0, $t1
+    li $v0, 1
+    syscall
+    la $a0, newline
+    li $v0, 4
+    syscall
+    la $a0, str_0
+    li $v0, 4
+    syscall
+
+    li $v0, 10
+    syscall`,
+			expected: "42\nhello",
+		},
+		{
+			name: "Loop With Branches",
+			asm: `.text
+main:
+    li $t0, 0
+loop:
+    slt $t1, $t0, 3
+    beq $t1, $zero, done
+    move $a0, $t0
+    li $v0, 1
+    syscall
+    addiu $t0, $t0, 1
+    j loop
+done:
+    li $v0, 10
+    syscall`,
+			expected: "012",
+		},
+		{
+			name: "Function Call And Stack",
+			asm: `.text
+main:
+    li $a0, 6
+    jal double
+    move $a0, $v0
+    li $v0, 1
+    syscall
+    li $v0, 10
+    syscall
+double:
+    addiu $sp, $sp, -8
+    sw $ra, 4($sp)
+    add $v0, $a0, $a0
+    lw $ra, 4($sp)
+    addiu $sp, $sp, 8
+    jr $ra`,
+			expected: "12",
+		},
+		{
+			name: "Division And Remainder",
+			asm: `.text
+main:
+    li $t0, -7
+    li $t1, 2
+    div $t0, $t1
+    mflo $a0
+    li $v0, 1
+    syscall
+    mfhi $a0
+    syscall
+    li $v0, 10
+    syscall`,
+			expected: "-3-1",
+		},
+		{
+			name: "Read Integer",
+			asm: `.text
+main:
+    li $v0, 5
+    syscall
+    mul $a0, $v0, $v0
+    li $v0, 1
+    syscall`,
+			stdin:    "9\n",
+			expected: "81",
+		},
+		{
+			name: "Heap Allocation",
+			asm: `.text
+main:
+    li $a0, 8
+    li $v0, 9
+    syscall
+    li $t0, 'A'
+    sb $t0, 0($v0)
+    sb $zero, 1($v0)
+    move $a0, $v0
+    li $v0, 4
+    syscall`,
+			expected: "A",
+		},
+		{
+			name: "Floats",
+			asm: `.data
+half: .float 0.5
+x: .float 2.25
+
+.text
+main:
+    l.s $f4, half
+    l.s $f5, x
+    add.s $f6, $f4, $f5
+    s.s $f6, x
+    l.s $f12, x
+    li $v0, 2
+    syscall
+    li $t0, -7
+    mtc1 $t0, $f7
+    cvt.s.w $f7, $f7
+    div.s $f8, $f7, $f6
+    floor.w.s $f9, $f8
+    mfc1 $a0, $f9
+    li $v0, 1
+    syscall
+    c.lt.s $f7, $f4
+    bc1f skip
+    neg.s $f12, $f7
+    li $v0, 2
+    syscall
+skip:
+    li $v0, 10
+    syscall`,
+			expected: "2.75-37.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			_, err := Run(tt.asm, Config{Stdin: strings.NewReader(tt.stdin), Stdout: &out})
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("output wrong. expected=%q, got=%q", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestExitCodeAndSteps(t *testing.T) {
+	res, err := Run(".text\nmain:\n    li $a0, 3\n    li $v0, 17\n    syscall", Config{})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if res.ExitCode != 3 {
+		t.Errorf("exit code wrong. expected=3, got=%d", res.ExitCode)
+	}
+	if res.Steps != 3 {
+		t.Errorf("steps wrong. expected=3, got=%d", res.Steps)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	asm := ".text\nmain:\n    li $t0, 3\nloop:\n    addi $t0, $t0, -1\n    bgtz $t0, loop\n    li $v0, 10\n    syscall"
+	m, err := Load(asm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := m.Run(Config{Profile: true})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	loop, ok := m.LabelIndex("loop")
+	if !ok || loop != 1 {
+		t.Fatalf("LabelIndex(loop) = %d, %v", loop, ok)
+	}
+	if want := []int{1, 3, 3, 1, 1}; !reflect.DeepEqual(res.Profile, want) {
+		t.Errorf("profile wrong. expected=%v, got=%v", want, res.Profile)
+	}
+
+	if res, _ := Run(asm, Config{}); res.Profile != nil {
+		t.Errorf("profile collected without Config.Profile: %v", res.Profile)
+	}
+}
+
+func TestEndian(t *testing.T) {
+	// Prints the first byte of a word, the first byte of a stored halfword
+	// and a word read back whole
+	body := ".data\nw: .word 0x01020304\nh: .half 0\n.text\nmain:\n" +
+		"    la $t0, w\n    lbu $a0, 0($t0)\n    li $v0, 1\n    syscall\n" +
+		"    la $t1, h\n    li $t2, 0x0506\n    sh $t2, 0($t1)\n    lbu $a0, 0($t1)\n    li $v0, 1\n    syscall\n" +
+		"    lw $a0, 0($t0)\n    li $v0, 1\n    syscall\n    li $v0, 10\n    syscall"
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"default", "", "4616909060"},
+		{"little", "# endian: little\n", "4616909060"},
+		{"big", "# generated\n# endian: big\n", "1516909060"},
+		{"header after code is ignored", "", "4616909060"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asm := tt.header + body
+			if tt.name == "header after code is ignored" {
+				asm += "\n# endian: big"
+			}
+			var out strings.Builder
+			if _, err := Run(asm, Config{Stdout: &out}); err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("output wrong. expected=%q, got=%q", tt.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	t.Run("Step Limit", func(t *testing.T) {
+		_, err := Run(".text\nmain:\n    j main", Config{MaxSteps: 100})
+		if !errors.Is(err, ErrStepLimit) {
+			t.Errorf("expected step limit error, got %v", err)
+		}
+	})
+
+	t.Run("Undefined Label", func(t *testing.T) {
+		_, err := Run(".text\nmain:\n    j nowhere", Config{})
+		var asmErr *AssembleError
+		if !errors.As(err, &asmErr) || asmErr.Line != 3 {
+			t.Errorf("expected assemble error on line 3, got %v", err)
+		}
+	})
+
+	t.Run("Unaligned Load", func(t *testing.T) {
+		_, err := Run(".text\nmain:\n    li $t0, 1\n    lw $t1, 0($t0)", Config{})
+		var rtErr *RuntimeError
+		if !errors.As(err, &rtErr) || rtErr.Line != 4 {
+			t.Errorf("expected runtime error on line 4, got %v", err)
+		}
+	})
+
+	t.Run("Unknown Instruction", func(t *testing.T) {
+		_, err := Run(".text\nmain:\n    frob $t0", Config{})
+		if err == nil || !strings.Contains(err.Error(), "unknown instruction") {
+			t.Errorf("expected unknown instruction error, got %v", err)
+		}
+	})
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		value    float32
+		expected string
+	}{
+		{0, "0.0"},
+		{3, "3.0"},
+		{-0.25, "-0.25"},
+		{0.1, "0.1"},
+		{1234567, "1234567.0"},
+		{1e7, "1.0E7"},
+		{1.5e-4, "1.5E-4"},
+		{float32(math.Inf(-1)), "-Infinity"},
+	}
+	for _, tt := range tests {
+		if got := formatFloat(tt.value); got != tt.expected {
+			t.Errorf("formatFloat(%v) = %q, expected %q", tt.value, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package emulator
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// arity lists the accepted operand counts for every supported mnemonic
+var arity = map[string][]int{
+	"nop": {0}, "syscall": {0}, "break": {0, 1},
+	"li": {2}, "la": {2}, "lui": {2}, "move": {2},
+	"add": {3}, "addu": {3}, "addi": {3}, "addiu": {3},
+	"sub": {3}, "subu": {3}, "mul": {3}, "mult": {2}, "multu": {2},
+	"div": {2, 3}, "divu": {2, 3}, "rem": {3}, "remu": {3},
+	"mfhi": {1}, "mflo": {1}, "mthi": {1}, "mtlo": {1},
+	"neg": {2}, "negu": {2}, "not": {2}, "abs": {2},
+	"and": {3}, "or": {3}, "xor": {3}, "nor": {3},
+	"andi": {3}, "ori": {3}, "xori": {3},
+	"sll": {3}, "srl": {3}, "sra": {3}, "sllv": {3}, "srlv": {3}, "srav": {3},
+	"slt": {3}, "sltu": {3}, "slti": {3}, "sltiu": {3},
+	"seq": {3}, "sne": {3}, "sge": {3}, "sgt": {3}, "sle": {3},
+	"lw": {2}, "sw": {2}, "lh": {2}, "lhu": {2}, "sh": {2}, "lb": {2}, "lbu": {2}, "sb": {2},
+	"beq": {3}, "bne": {3}, "blt": {3}, "bgt": {3}, "ble": {3}, "bge": {3},
+	"beqz": {2}, "bnez": {2}, "bltz": {2}, "bgtz": {2}, "blez": {2}, "bgez": {2},
+	"b": {1}, "j": {1}, "jal": {1}, "jr": {1}, "jalr": {1, 2},
+}
+
+func knownOp(op string) bool {
+	_, ok := arity[op]
+	return ok
+}
+
+func (m *Machine) execute(in *instr) error {
+	okArity := false
+	for _, n := range arity[in.op] {
+		if len(in.args) == n {
+			okArity = true
+		}
+	}
+	if !okArity {
+		return fmt.Errorf("wrong number of operands for %s", in.op)
+	}
+	a := in.args
+
+	switch in.op {
+	case "nop":
+	case "syscall":
+		return m.syscall()
+	case "break":
+		return fmt.Errorf("break instruction executed")
+
+	case "li", "la":
+		return m.set(a[0], int32(a[1].imm))
+	case "lui":
+		return m.set(a[0], int32(a[1].imm)<<16)
+	case "move":
+		return m.set(a[0], m.read(a[1]))
+
+	case "add", "addu", "addi", "addiu":
+		return m.set(a[0], m.read(a[1])+m.read(a[2]))
+	case "sub", "subu":
+		return m.set(a[0], m.read(a[1])-m.read(a[2]))
+	case "mul":
+		return m.set(a[0], m.read(a[1])*m.read(a[2]))
+	case "mult":
+		p := int64(m.read(a[0])) * int64(m.read(a[1]))
+		m.lo, m.hi = int32(p), int32(p>>32)
+	case "multu":
+		p := uint64(uint32(m.read(a[0]))) * uint64(uint32(m.read(a[1])))
+		m.lo, m.hi = int32(p), int32(p>>32)
+	case "div", "divu":
+		if len(a) == 2 {
+			x, y := m.read(a[0]), m.read(a[1])
+			if y != 0 {
+				m.lo, m.hi = divide(in.op, x, y)
+			}
+			return nil
+		}
+		y := m.read(a[2])
+		if y == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		q, _ := divide(in.op, m.read(a[1]), y)
+		return m.set(a[0], q)
+	case "rem", "remu":
+		y := m.read(a[2])
+		if y == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		_, r := divide(strings.Replace(in.op, "rem", "div", 1), m.read(a[1]), y)
+		return m.set(a[0], r)
+	case "mfhi":
+		return m.set(a[0], m.hi)
+	case "mflo":
+		return m.set(a[0], m.lo)
+	case "mthi":
+		m.hi = m.read(a[0])
+	case "mtlo":
+		m.lo = m.read(a[0])
+	case "neg", "negu":
+		return m.set(a[0], -m.read(a[1]))
+	case "not":
+		return m.set(a[0], ^m.read(a[1]))
+	case "abs":
+		v := m.read(a[1])
+		if v < 0 {
+			v = -v
+		}
+		return m.set(a[0], v)
+
+	case "and", "andi":
+		return m.set(a[0], m.read(a[1])&m.logical(a[2]))
+	case "or", "ori":
+		return m.set(a[0], m.read(a[1])|m.logical(a[2]))
+	case "xor", "xori":
+		return m.set(a[0], m.read(a[1])^m.logical(a[2]))
+	case "nor":
+		return m.set(a[0], ^(m.read(a[1]) | m.read(a[2])))
+	case "sll", "sllv":
+		return m.set(a[0], int32(uint32(m.read(a[1]))<<(uint32(m.read(a[2]))&31)))
+	case "srl", "srlv":
+		return m.set(a[0], int32(uint32(m.read(a[1]))>>(uint32(m.read(a[2]))&31)))
+	case "sra", "srav":
+		return m.set(a[0], m.read(a[1])>>(uint32(m.read(a[2]))&31))
+
+	case "slt", "slti":
+		return m.set(a[0], boolWord(m.read(a[1]) < m.read(a[2])))
+	case "sltu", "sltiu":
+		return m.set(a[0], boolWord(uint32(m.read(a[1])) < uint32(m.read(a[2]))))
+	case "seq":
+		return m.set(a[0], boolWord(m.read(a[1]) == m.read(a[2])))
+	case "sne":
+		return m.set(a[0], boolWord(m.read(a[1]) != m.read(a[2])))
+	case "sge":
+		return m.set(a[0], boolWord(m.read(a[1]) >= m.read(a[2])))
+	case "sgt":
+		return m.set(a[0], boolWord(m.read(a[1]) > m.read(a[2])))
+	case "sle":
+		return m.set(a[0], boolWord(m.read(a[1]) <= m.read(a[2])))
+
+	case "lw":
+		v, err := m.mem.load32(m.address(a[1]))
+		if err != nil {
+			return err
+		}
+		return m.set(a[0], v)
+	case "sw":
+		return m.mem.store32(m.address(a[1]), m.read(a[0]))
+	case "lh", "lhu":
+		v, err := m.mem.load16(m.address(a[1]))
+		if err != nil {
+			return err
+		}
+		if in.op == "lhu" {
+			return m.set(a[0], int32(uint16(v)))
+		}
+		return m.set(a[0], int32(v))
+	case "sh":
+		return m.mem.store16(m.address(a[1]), int16(m.read(a[0])))
+	case "lb":
+		return m.set(a[0], int32(int8(m.mem.load8(m.address(a[1])))))
+	case "lbu":
+		return m.set(a[0], int32(m.mem.load8(m.address(a[1]))))
+	case "sb":
+		m.mem.store8(m.address(a[1]), byte(m.read(a[0])))
+
+	case "beq", "bne", "blt", "bgt", "ble", "bge":
+		if compare(in.op[1:], m.read(a[0]), m.read(a[1])) {
+			return m.jump(a[2])
+		}
+	case "beqz", "bnez", "bltz", "bgtz", "blez", "bgez":
+		if compare(strings.TrimSuffix(in.op[1:], "z"), m.read(a[0]), 0) {
+			return m.jump(a[1])
+		}
+	case "b", "j":
+		return m.jump(a[0])
+	case "jal":
+		m.regs[regRA] = int32(textAddr(m.pc))
+		return m.jump(a[0])
+	case "jr":
+		return m.jumpTo(uint32(m.read(a[0])))
+	case "jalr":
+		target := uint32(m.read(a[len(a)-1]))
+		link := regRA
+		if len(a) == 2 {
+			link = a[0].reg
+		}
+		m.regs[link] = int32(textAddr(m.pc))
+		return m.jumpTo(target)
+
+	default:
+		if _, ok := floatOps[in.op]; ok {
+			return m.executeFloat(in)
+		}
+		return fmt.Errorf("unsupported instruction %s", in.op)
+	}
+	return nil
+}
+
+func (m *Machine) syscall() error {
+	switch m.regs[regV0] {
+	case 1:
+		fmt.Fprintf(m.out, "%d", m.regs[regA0])
+	case 2:
+		io.WriteString(m.out, formatFloat(math.Float32frombits(m.fregs[12])))
+	case 4:
+		io.WriteString(m.out, m.mem.loadString(uint32(m.regs[regA0])))
+	case 5:
+		line, err := m.in.ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read_int: no input available")
+		}
+		v, perr := strconv.ParseInt(strings.TrimSpace(line), 10, 32)
+		if perr != nil {
+			return fmt.Errorf("read_int: invalid integer %q", strings.TrimSpace(line))
+		}
+		m.regs[regV0] = int32(v)
+	case 8:
+		buf, n := uint32(m.regs[regA0]), int(m.regs[regA1])
+		line, _ := m.in.ReadString('\n')
+		if n <= 0 {
+			return nil
+		}
+		if len(line) > n-1 {
+			line = line[:n-1]
+		}
+		for i := 0; i < len(line); i++ {
+			m.mem.store8(buf+uint32(i), line[i])
+		}
+		m.mem.store8(buf+uint32(len(line)), 0)
+	case 9:
+		addr := m.heap
+		size := uint32(m.regs[regA0])
+		m.heap += (size + 3) &^ 3
+		m.regs[regV0] = int32(addr)
+	case 10:
+		m.halted = true
+	case 11:
+		m.out.Write([]byte{byte(m.regs[regA0])})
+	case 12:
+		c, err := m.in.ReadByte()
+		if err != nil {
+			return fmt.Errorf("read_char: no input available")
+		}
+		m.regs[regV0] = int32(c)
+	case 17:
+		m.exit = int(m.regs[regA0])
+		m.halted = true
+	default:
+		return fmt.Errorf("unsupported syscall %d", m.regs[regV0])
+	}
+	return nil
+}
+
+func (m *Machine) set(o operand, v int32) error {
+	if o.kind != opReg {
+		return fmt.Errorf("destination must be a register")
+	}
+	m.regs[o.reg] = v
+	return nil
+}
+
+// read returns the value of a register or immediate operand
+func (m *Machine) read(o operand) int32 {
+	if o.kind == opReg {
+		return m.regs[o.reg]
+	}
+	return int32(o.imm)
+}
+
+// logical treats immediates as zero-extended, like andi/ori/xori
+func (m *Machine) logical(o operand) int32 {
+	if o.kind == opImm && o.imm >= 0 && o.imm <= 0xffff {
+		return int32(uint32(o.imm))
+	}
+	return m.read(o)
+}
+
+func (m *Machine) address(o operand) uint32 {
+	addr := uint32(o.imm)
+	if o.kind == opMem {
+		addr += uint32(m.regs[o.reg])
+	}
+	if o.kind == opReg {
+		addr = uint32(m.regs[o.reg])
+	}
+	return addr
+}
+
+func (m *Machine) jump(o operand) error {
+	if o.kind == opReg {
+		return m.jumpTo(uint32(m.regs[o.reg]))
+	}
+	return m.jumpTo(uint32(o.imm))
+}
+
+func (m *Machine) jumpTo(addr uint32) error {
+	if !isText(addr) || addr%4 != 0 {
+		return fmt.Errorf("jump to invalid address 0x%08x", addr)
+	}
+	m.pc = textIndex(addr)
+	return nil
+}
+
+func compare(cond string, x, y int32) bool {
+	switch cond {
+	case "eq":
+		return x == y
+	case "ne":
+		return x != y
+	case "lt":
+		return x < y
+	case "gt":
+		return x > y
+	case "le":
+		return x <= y
+	case "ge":
+		return x >= y
+	}
+	return false
+}
+
+func divide(op string, x, y int32) (int32, int32) {
+	if op == "divu" {
+		return int32(uint32(x) / uint32(y)), int32(uint32(x) % uint32(y))
+	}
+	if x == -1<<31 && y == -1 {
+		return x, 0
+	}
+	return x / y, x % y
+}
+
+func boolWord(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,196 @@
+package emulator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// floatOps lists the coprocessor 1 mnemonics, all single precision
+var floatOps = map[string][]int{
+	"l.s": {2}, "s.s": {2}, "lwc1": {2}, "swc1": {2},
+	"mov.s": {2}, "neg.s": {2}, "abs.s": {2},
+	"add.s": {3}, "sub.s": {3}, "mul.s": {3}, "div.s": {3},
+	"mtc1": {2}, "mfc1": {2},
+	"cvt.s.w": {2}, "cvt.w.s": {2}, "round.w.s": {2}, "trunc.w.s": {2}, "floor.w.s": {2}, "ceil.w.s": {2},
+	"c.eq.s": {2}, "c.lt.s": {2}, "c.le.s": {2},
+	"bc1t": {1}, "bc1f": {1},
+}
+
+func init() {
+	for op, n := range floatOps {
+		arity[op] = n
+	}
+}
+
+// parseFloatRegister reads $f0 to $f31
+func parseFloatRegister(s string) (int, bool) {
+	digits, ok := strings.CutPrefix(s, "$f")
+	if !ok || digits == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil && n >= 0 && n < 32
+}
+
+func (m *Machine) executeFloat(in *instr) error {
+	a := in.args
+	switch in.op {
+	case "l.s", "lwc1":
+		v, err := m.mem.load32(m.address(a[1]))
+		if err != nil {
+			return err
+		}
+		return m.fset(a[0], uint32(v))
+	case "s.s", "swc1":
+		v, err := m.fbits(a[0])
+		if err != nil {
+			return err
+		}
+		return m.mem.store32(m.address(a[1]), int32(v))
+	case "mov.s":
+		return m.funary(a, func(x float32) float32 { return x })
+	case "neg.s":
+		return m.funary(a, func(x float32) float32 { return -x })
+	case "abs.s":
+		return m.funary(a, func(x float32) float32 { return float32(math.Abs(float64(x))) })
+	case "add.s":
+		return m.fbinary(a, func(x, y float32) float32 { return x + y })
+	case "sub.s":
+		return m.fbinary(a, func(x, y float32) float32 { return x - y })
+	case "mul.s":
+		return m.fbinary(a, func(x, y float32) float32 { return x * y })
+	case "div.s":
+		return m.fbinary(a, func(x, y float32) float32 { return x / y })
+	case "mtc1":
+		return m.fset(a[1], uint32(m.read(a[0])))
+	case "mfc1":
+		v, err := m.fbits(a[1])
+		if err != nil {
+			return err
+		}
+		return m.set(a[0], int32(v))
+	case "cvt.s.w":
+		v, err := m.fbits(a[1])
+		if err != nil {
+			return err
+		}
+		return m.fset(a[0], math.Float32bits(float32(int32(v))))
+	case "cvt.w.s", "round.w.s":
+		return m.toWord(a, math.RoundToEven)
+	case "trunc.w.s":
+		return m.toWord(a, math.Trunc)
+	case "floor.w.s":
+		return m.toWord(a, math.Floor)
+	case "ceil.w.s":
+		return m.toWord(a, math.Ceil)
+	case "c.eq.s", "c.lt.s", "c.le.s":
+		x, err := m.fread(a[0])
+		if err != nil {
+			return err
+		}
+		y, err := m.fread(a[1])
+		if err != nil {
+			return err
+		}
+		switch in.op {
+		case "c.eq.s":
+			m.fcc = x == y
+		case "c.lt.s":
+			m.fcc = x < y
+		default:
+			m.fcc = x <= y
+		}
+	case "bc1t", "bc1f":
+		if m.fcc == (in.op == "bc1t") {
+			return m.jump(a[0])
+		}
+	default:
+		return fmt.Errorf("unsupported instruction %s", in.op)
+	}
+	return nil
+}
+
+func (m *Machine) fbits(o operand) (uint32, error) {
+	if o.kind != opFReg {
+		return 0, fmt.Errorf("expected a floating point register")
+	}
+	return m.fregs[o.reg], nil
+}
+
+func (m *Machine) fread(o operand) (float32, error) {
+	v, err := m.fbits(o)
+	return math.Float32frombits(v), err
+}
+
+func (m *Machine) fset(o operand, v uint32) error {
+	if o.kind != opFReg {
+		return fmt.Errorf("destination must be a floating point register")
+	}
+	m.fregs[o.reg] = v
+	return nil
+}
+
+func (m *Machine) funary(a []operand, f func(float32) float32) error {
+	x, err := m.fread(a[1])
+	if err != nil {
+		return err
+	}
+	return m.fset(a[0], math.Float32bits(f(x)))
+}
+
+func (m *Machine) fbinary(a []operand, f func(x, y float32) float32) error {
+	x, err := m.fread(a[1])
+	if err != nil {
+		return err
+	}
+	y, err := m.fread(a[2])
+	if err != nil {
+		return err
+	}
+	return m.fset(a[0], math.Float32bits(f(x, y)))
+}
+
+// toWord converts to a 32-bit integer left in a float register. A NaN or a
+// value out of range gives 2^31 - 1, as the FPU does with traps disabled.
+func (m *Machine) toWord(a []operand, round func(float64) float64) error {
+	x, err := m.fread(a[1])
+	if err != nil {
+		return err
+	}
+	r := round(float64(x))
+	v := uint32(math.MaxInt32)
+	if r >= math.MinInt32 && r <= math.MaxInt32 {
+		v = uint32(int32(r))
+	}
+	return m.fset(a[0], v)
+}
+
+// formatFloat writes f the way MARS prints a float, which is Java's
+// Float.toString: plain decimal with at least one fraction digit between
+// 10^-3 and 10^7, and computerized scientific notation outside it
+func formatFloat(f float32) string {
+	switch {
+	case math.IsNaN(float64(f)):
+		return "NaN"
+	case math.IsInf(float64(f), 1):
+		return "Infinity"
+	case math.IsInf(float64(f), -1):
+		return "-Infinity"
+	}
+	abs := math.Abs(float64(f))
+	if abs == 0 || abs >= 1e-3 && abs < 1e7 {
+		s := strconv.FormatFloat(float64(f), 'f', -1, 32)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s
+	}
+	mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(float64(f), 'E', -1, 32), "E")
+	if !strings.Contains(mantissa, ".") {
+		mantissa += ".0"
+	}
+	exp, _ := strconv.Atoi(exponent)
+	return mantissa + "E" + strconv.Itoa(exp)
+}
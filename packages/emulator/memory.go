@@ -0,0 +1,96 @@
+package emulator
+
+import "fmt"
+
+const pageSize = 4096
+
+// memory is a sparse byte-addressed store, little-endian like MARS unless
+// bigEndian is set
+type memory struct {
+	pages     map[uint32]*[pageSize]byte
+	bigEndian bool
+}
+
+// shift returns the bit position of byte i of a size-byte value at its
+// address plus i
+func (m *memory) shift(i, size uint32) uint32 {
+	if m.bigEndian {
+		return 8 * (size - 1 - i)
+	}
+	return 8 * i
+}
+
+func newMemory() *memory {
+	return &memory{pages: make(map[uint32]*[pageSize]byte)}
+}
+
+func (m *memory) page(addr uint32) *[pageSize]byte {
+	base := addr &^ (pageSize - 1)
+	p, ok := m.pages[base]
+	if !ok {
+		p = new([pageSize]byte)
+		m.pages[base] = p
+	}
+	return p
+}
+
+func (m *memory) load8(addr uint32) byte {
+	return m.page(addr)[addr%pageSize]
+}
+
+func (m *memory) store8(addr uint32, v byte) {
+	m.page(addr)[addr%pageSize] = v
+}
+
+func (m *memory) load16(addr uint32) (int16, error) {
+	if addr%2 != 0 {
+		return 0, fmt.Errorf("unaligned halfword address 0x%08x", addr)
+	}
+	return int16(uint16(m.load8(addr))<<m.shift(0, 2) | uint16(m.load8(addr+1))<<m.shift(1, 2)), nil
+}
+
+func (m *memory) store16(addr uint32, v int16) error {
+	if addr%2 != 0 {
+		return fmt.Errorf("unaligned halfword address 0x%08x", addr)
+	}
+	m.store8(addr, byte(uint16(v)>>m.shift(0, 2)))
+	m.store8(addr+1, byte(uint16(v)>>m.shift(1, 2)))
+	return nil
+}
+
+func (m *memory) load32(addr uint32) (int32, error) {
+	if addr%4 != 0 {
+		return 0, fmt.Errorf("unaligned word address 0x%08x", addr)
+	}
+	var v uint32
+	for i := uint32(0); i < 4; i++ {
+		v |= uint32(m.load8(addr+i)) << m.shift(i, 4)
+	}
+	return int32(v), nil
+}
+
+func (m *memory) store32(addr uint32, v int32) error {
+	if addr%4 != 0 {
+		return fmt.Errorf("unaligned word address 0x%08x", addr)
+	}
+	for i := uint32(0); i < 4; i++ {
+		m.store8(addr+i, byte(uint32(v)>>m.shift(i, 4)))
+	}
+	return nil
+}
+
+// loadString reads a NUL-terminated string starting at addr
+func (m *memory) loadString(addr uint32) string {
+	var b []byte
+	for {
+		c := m.load8(addr)
+		if c == 0 {
+			return string(b)
+		}
+		b = append(b, c)
+		addr++
+		if len(b) > 1<<20 {
+			return string(b)
+		}
+	}
+}
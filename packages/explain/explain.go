@@ -0,0 +1,366 @@
+// Package explain shows what each phase of the compiler makes of a single
+// source line: its tokens, its syntax tree, its three-address code, the
+// assembly the source map attributes to it, with notes on that assembly, and
+// the assembly for the line's statements compiled on their own.
+package explain
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/ir"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// Explanation is everything the compiler produced for one source line
+type Explanation struct {
+	Line     int
+	Text     string // the source line itself
+	Tokens   []token.Token
+	Syntax   string // the syntax tree of each statement starting on the line
+	IR       string // three-address code for those statements, without the bodies of blocks
+	Function string // the function the assembly belongs to, "main" for top-level code
+	// Assembly holds each run of assembly attributed to the line, in
+	// output order. Code for one line can be split, such as a loop whose
+	// condition is tested after its body.
+	Assembly []string
+	Notes    []string
+	// Standalone is the instructions for the line's statements, without
+	// the bodies of blocks, generated on their own as top-level code, the
+	// way IR lowers them
+	Standalone []string
+}
+
+// Line compiles source with opts and explains line, which counts from 1.
+// It returns the diagnostics instead if the program does not compile.
+func Line(source string, line int, opts compiler.Options) (*Explanation, []diag.Diagnostic) {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return nil, []diag.Diagnostic{diag.Errorf(0, 0, "line %d is outside the file, which has %d lines", line, len(lines))}
+	}
+	res := compiler.CompileWith(source, opts)
+	if res.Failed() {
+		return nil, res.Diagnostics
+	}
+
+	e := &Explanation{Line: line, Text: strings.TrimRight(lines[line-1], "\r"), Function: "main"}
+	for _, tok := range compiler.Tokens(source) {
+		if tok.Line == line && tok.Type != token.EOF {
+			e.Tokens = append(e.Tokens, tok)
+		}
+	}
+
+	parsed, _ := compiler.Parse(source)
+	var syntax strings.Builder
+	g := codegen.New(nil)
+	g.Options = opts.Codegen
+	for _, n := range nodesOn(parsed.Statements, line) {
+		if stmt, ok := n.(ast.Statement); ok {
+			n = header(stmt)
+			e.Standalone = append(e.Standalone, g.GenerateStatement(n.(ast.Statement), nil)...)
+		}
+		syntax.WriteString(ast.Dump(n))
+	}
+	e.Syntax = syntax.String()
+
+	var headers []ast.Statement
+	for _, n := range nodesOn(res.Program.Statements, line) {
+		if stmt, ok := n.(ast.Statement); ok {
+			headers = append(headers, header(stmt))
+		}
+	}
+	e.IR = lowerHeaders(headers)
+
+	for i, m := range res.SourceMap {
+		if m.Line != line {
+			continue
+		}
+		end := len(res.Assembly)
+		if i+1 < len(res.SourceMap) {
+			end = res.SourceMap[i+1].Offset
+		}
+		if text := res.Assembly[m.Offset:end]; strings.TrimSpace(text) != "" {
+			e.Assembly = append(e.Assembly, text)
+		}
+		for _, f := range res.Functions {
+			if m.Offset >= f.Start && m.Offset < f.End {
+				e.Function = f.Name
+			}
+		}
+	}
+	e.Notes = notes(e, headers)
+	return e, nil
+}
+
+// nodesOn returns the statements in stmts, at any depth, that start on
+// line. An elif clause starting there is returned too, as it is the part
+// of its if statement written on that line.
+func nodesOn(stmts []ast.Statement, line int) []ast.Node {
+	var found []ast.Node
+	for _, stmt := range stmts {
+		if startLine(stmt) == line {
+			found = append(found, stmt)
+			continue
+		}
+		switch s := stmt.(type) {
+		case *ast.FunctionDefinition:
+			found = append(found, nodesOn(s.Body, line)...)
+		case *ast.IfStatement:
+			found = append(found, nodesOn(s.Consequence, line)...)
+			for _, elif := range s.Elifs {
+				if elif.Token.Line == line {
+					found = append(found, elif)
+					continue
+				}
+				found = append(found, nodesOn(elif.Consequence, line)...)
+			}
+			found = append(found, nodesOn(s.Alternative, line)...)
+		case *ast.WhileStatement:
+			found = append(found, nodesOn(s.Body, line)...)
+		case *ast.ForStatement:
+			found = append(found, nodesOn(s.Body, line)...)
+		}
+	}
+	return found
+}
+
+// startLine is the line a statement starts on, or 0 if it is not known
+func startLine(stmt ast.Statement) int {
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		return s.Token.Line
+	case *ast.TupleAssignment:
+		return s.Token.Line
+	case *ast.AugmentedAssignment:
+		return s.Token.Line
+	case *ast.IndexAssignment:
+		return s.Token.Line
+	case *ast.PrintStatement:
+		return s.Token.Line
+	case *ast.ReturnStatement:
+		return s.Token.Line
+	case *ast.GlobalStatement:
+		return s.Token.Line
+	case *ast.IfStatement:
+		return s.Token.Line
+	case *ast.WhileStatement:
+		return s.Token.Line
+	case *ast.ForStatement:
+		return s.Token.Line
+	case *ast.FunctionDefinition:
+		return s.Token.Line
+	case *ast.ExpressionStatement:
+		e := s.Expression
+		for {
+			switch x := e.(type) {
+			case *ast.BinaryExpression:
+				e = x.Left
+				continue
+			case *ast.Comparison:
+				e = x.Operands[0]
+				continue
+			case *ast.FunctionCall:
+				return x.Token.Line
+			case *ast.Identifier:
+				return x.Token.Line
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// header returns stmt without the blocks it holds, which are written on
+// the lines after it
+func header(stmt ast.Statement) ast.Statement {
+	switch s := stmt.(type) {
+	case *ast.IfStatement:
+		c := *s
+		c.Consequence, c.Elifs, c.Alternative = nil, nil, nil
+		return &c
+	case *ast.WhileStatement:
+		c := *s
+		c.Body = nil
+		return &c
+	case *ast.ForStatement:
+		c := *s
+		c.Body = nil
+		return &c
+	case *ast.FunctionDefinition:
+		c := *s
+		c.Body = nil
+		return &c
+	}
+	return stmt
+}
+
+// lowerHeaders lowers statements as if they were a program on their own
+// and drops the name of the top-level function the IR puts them in
+func lowerHeaders(stmts []ast.Statement) string {
+	if len(stmts) == 0 {
+		return ""
+	}
+	text := ir.Lower(&ast.Program{Statements: stmts}).String()
+	var out strings.Builder
+	for i, l := range strings.Split(text, "\n") {
+		if i == 0 || l == "" {
+			continue
+		}
+		out.WriteString(l + "\n")
+	}
+	return out.String()
+}
+
+var (
+	tempRegister = regexp.MustCompile(`\$t\d`)
+	memoryOp     = regexp.MustCompile(`^(lw|lb|lbu|lh|lhu|ld|l\.s|sw|sb|sh|sd|s\.s) [^,]+, ([A-Za-z_][A-Za-z0-9_]*|-?\d+\(\$fp\))$`)
+)
+
+// notes describes in words the assembly attributed to the statements of
+// the line
+func notes(e *Explanation, stmts []ast.Statement) []string {
+	var labels, instructions int
+	var calls, reads, writes, frame []string
+	cold := false
+	syscalls := 0
+	temps := make(map[string]bool)
+	for _, chunk := range e.Assembly {
+		for _, l := range strings.Split(chunk, "\n") {
+			l = strings.TrimSpace(l)
+			switch {
+			case l == "":
+				continue
+			case strings.HasSuffix(l, ":"):
+				labels++
+				cold = cold || strings.HasPrefix(l, "cold_")
+				continue
+			}
+			instructions++
+			for _, r := range tempRegister.FindAllString(l, -1) {
+				temps[r] = true
+			}
+			switch op, operand, _ := strings.Cut(l, " "); {
+			case op == "syscall":
+				syscalls++
+			case op == "jal":
+				calls = appendNew(calls, operand)
+			}
+			if m := memoryOp.FindStringSubmatch(l); m != nil {
+				if strings.HasSuffix(m[2], "($fp)") {
+					frame = appendNew(frame, m[2])
+				} else if m[1][0] == 's' {
+					writes = appendNew(writes, m[2])
+				} else {
+					reads = appendNew(reads, m[2])
+				}
+			}
+		}
+	}
+
+	if instructions == 0 {
+		return []string{"no code is generated for this line"}
+	}
+	var out []string
+	where := "the top-level code"
+	if e.Function != "main" {
+		where = "function " + e.Function
+	}
+	count := fmt.Sprintf("%d instruction%s in %s", instructions, plural(instructions), where)
+	if labels > 0 {
+		count += fmt.Sprintf(", with %d label%s to branch to", labels, plural(labels))
+	}
+	out = append(out, count)
+	if len(e.Assembly) > 1 {
+		out = append(out, fmt.Sprintf("the code is in %d separate places, with code for other lines between them", len(e.Assembly)))
+		for _, stmt := range stmts {
+			if _, ok := stmt.(*ast.WhileStatement); ok {
+				out = append(out, "the loop jumps to its condition, which comes after the body, so each iteration takes a single branch back")
+			}
+		}
+		if cold {
+			out = append(out, "a failed check branches to a block placed after the function, so passing checks fall through")
+		}
+	}
+	if len(temps) > 0 {
+		regs := make([]string, 0, len(temps))
+		for r := range temps {
+			regs = append(regs, r)
+		}
+		sort.Strings(regs)
+		out = append(out, "temporaries used: "+strings.Join(regs, ", "))
+	}
+	if len(reads) > 0 {
+		out = append(out, "reads from memory: "+strings.Join(reads, ", "))
+	}
+	if len(writes) > 0 {
+		out = append(out, "writes to memory: "+strings.Join(writes, ", "))
+	}
+	if len(frame) > 0 {
+		out = append(out, "uses the stack frame at "+strings.Join(frame, ", ")+", where parameters are kept")
+	}
+	for _, c := range calls {
+		if strings.HasPrefix(c, "rt_") {
+			out = append(out, "calls the runtime routine "+c)
+		} else {
+			out = append(out, "calls "+c)
+		}
+	}
+	if syscalls > 0 {
+		out = append(out, fmt.Sprintf("%d system call%s, for input, output or exit", syscalls, plural(syscalls)))
+	}
+	return out
+}
+
+func appendNew(list []string, s string) []string {
+	for _, have := range list {
+		if have == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// String lays the explanation out as sections, one per phase
+func (e *Explanation) String() string {
+	var out strings.Builder
+	section := func(title, body string) {
+		out.WriteString("\n" + title + ":\n")
+		if body == "" {
+			out.WriteString("    (none)\n")
+			return
+		}
+		for _, l := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+			out.WriteString("    " + l + "\n")
+		}
+	}
+
+	fmt.Fprintf(&out, "line %d: %s\n", e.Line, strings.TrimSpace(e.Text))
+	var toks strings.Builder
+	for _, tok := range e.Tokens {
+		fmt.Fprintf(&toks, "%d:%d\t%s\t%q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+	}
+	section("tokens", toks.String())
+	section("syntax tree", e.Syntax)
+	section("three-address code", e.IR)
+	var asm []string
+	for _, chunk := range e.Assembly {
+		asm = append(asm, strings.TrimRight(chunk, "\n"))
+	}
+	section("assembly ("+e.Function+")", strings.Join(asm, "\n...\n"))
+	section("notes", "- "+strings.Join(e.Notes, "\n- "))
+	section("assembly on its own", strings.Join(e.Standalone, "\n"))
+	return out.String()
+}
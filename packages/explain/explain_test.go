@@ -0,0 +1,108 @@
+package explain
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/compiler"
+)
+
+const program = "def sq(n):\n\treturn n * n\n\nx = 3\ny = sq(x)\nwhile x > 0:\n\tx = x - 1\nprint(y)\n"
+
+func TestLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     int
+		function string
+		syntax   string
+		ir       string
+		chunks   int
+		notes    []string
+		alone    string
+	}{
+		{
+			name:     "call",
+			line:     5,
+			function: "main",
+			syntax:   "Assignment y\n  Call sq\n    Identifier x\n",
+			ir:       "    param x\n    t1 = call sq, 1\n    y = t1\n",
+			chunks:   1,
+			notes:    []string{"5 instructions in the top-level code", "temporaries used: $t0", "reads from memory: x", "writes to memory: y", "calls sq"},
+			alone:    "lw $t0, x\nmove $a0, $t0\njal sq\nmove $t0, $v0\nsw $t0, y",
+		},
+		{
+			name:     "inside a function",
+			line:     2,
+			function: "sq",
+			syntax:   "Return\n  Binary *\n    Identifier n\n    Identifier n\n",
+			ir:       "    t1 = n * n\n    return t1\n",
+			chunks:   1,
+			notes: []string{
+				"4 instructions in function sq",
+				"temporaries used: $t0, $t1, $t2",
+				"uses the stack frame at -12($fp), where parameters are kept",
+			},
+		},
+		{
+			name:     "loop header without its body",
+			line:     6,
+			function: "main",
+			syntax:   "While\n  Binary >\n    Identifier x\n    Integer 0\n  Body\n",
+			ir:       "L1:\n    t1 = x > 0\n    iffalse t1 goto L2\n    goto L1\nL2:\n",
+			chunks:   2,
+		},
+		{
+			name:     "blank line",
+			line:     3,
+			function: "main",
+			notes:    []string{"no code is generated for this line"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, diags := Line(program, tt.line, compiler.Options{})
+			if len(diags) > 0 {
+				t.Fatalf("unexpected diagnostics: %v", diags)
+			}
+			if e.Function != tt.function || e.Syntax != tt.syntax || e.IR != tt.ir || len(e.Assembly) != tt.chunks {
+				t.Errorf("wrong explanation:\n%s", e)
+			}
+			if tt.notes != nil && !slices.Equal(e.Notes, tt.notes) {
+				t.Errorf("wrong notes. expected=%q, got=%q", tt.notes, e.Notes)
+			}
+			if tt.alone != "" && strings.Join(e.Standalone, "\n") != tt.alone {
+				t.Errorf("wrong standalone assembly. expected=%q, got=%q", tt.alone, e.Standalone)
+			}
+			for _, tok := range e.Tokens {
+				if tok.Line != tt.line {
+					t.Errorf("token %q is from line %d", tok.Literal, tok.Line)
+				}
+			}
+		})
+	}
+}
+
+func TestLineChecked(t *testing.T) {
+	e, diags := Line("def half(a):\n\treturn a // 2\n\nx = half(9)\n", 2, compiler.Options{Codegen: codegen.Options{Checked: true}})
+	if len(diags) > 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if len(e.Assembly) != 2 || !strings.HasPrefix(e.Assembly[1], "cold_") {
+		t.Fatalf("expected the division check's abort as a second chunk:\n%s", e)
+	}
+	if !slices.Contains(e.Notes, "a failed check branches to a block placed after the function, so passing checks fall through") {
+		t.Errorf("no note on the cold block: %q", e.Notes)
+	}
+}
+
+func TestLineErrors(t *testing.T) {
+	if _, diags := Line(program, 40, compiler.Options{}); len(diags) != 1 || !strings.Contains(diags[0].Message, "outside the file") {
+		t.Errorf("expected a diagnostic for a line past the end, got %v", diags)
+	}
+	if _, diags := Line("x = = 1\n", 1, compiler.Options{}); len(diags) == 0 {
+		t.Errorf("expected the program's own errors")
+	}
+}
@@ -0,0 +1,252 @@
+// Package format prints an AST back out as canonical, tab-indented source.
+package format
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+)
+
+// precedence of binary operators, following Python
+var precedence = map[string]int{
+	"or":  1,
+	"and": 2,
+	"<":   4, ">": 4, "<=": 4, ">=": 4, "==": 4, "!=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "//": 6, "%": 6,
+	"**": 8,
+}
+
+// notPrecedence sits between and and the comparisons, and prefixPrecedence
+// binds unary minus tighter than any binary operator but **
+const (
+	notPrecedence     = 3
+	comparePrecedence = 4
+	prefixPrecedence  = 7
+)
+
+type printer struct {
+	out    strings.Builder
+	trivia *trivia // the comments and blank lines to keep, or nil
+}
+
+// Source formats a whole program
+func Source(program *ast.Program) string {
+	p := &printer{}
+	p.program(program)
+	return p.out.String()
+}
+
+func (p *printer) program(program *ast.Program) {
+	for i, stmt := range program.Statements {
+		_, isDef := stmt.(*ast.FunctionDefinition)
+		if i > 0 {
+			_, prevDef := program.Statements[i-1].(*ast.FunctionDefinition)
+			if isDef || prevDef {
+				p.separate(stmtLine(stmt))
+			}
+		}
+		p.stmt(stmt, 0)
+	}
+	p.finish()
+}
+
+func (p *printer) line(depth int, s string) {
+	p.out.WriteString(strings.Repeat("\t", depth))
+	p.out.WriteString(s)
+	p.out.WriteString("\n")
+	if p.trivia != nil {
+		p.trivia.blanks = 0
+	}
+}
+
+// pragma writes back the comment a branch hint came from
+func pragma(h ast.BranchHint) string {
+	if h == ast.NoHint {
+		return ""
+	}
+	return "  # pragma: " + h.String()
+}
+
+// hinted is the end of a branch header: the pragma for its hint, which is
+// the comment the author wrote there, or else that comment
+func hinted(h ast.BranchHint, comment string) string {
+	if h != ast.NoHint {
+		return pragma(h)
+	}
+	return comment
+}
+
+func (p *printer) block(stmts []ast.Statement, depth int) {
+	for _, s := range stmts {
+		p.stmt(s, depth)
+	}
+	p.closeBlock(depth)
+}
+
+func (p *printer) stmt(stmt ast.Statement, depth int) {
+	// comment is the author's comment at the end of the statement's first line
+	comment := p.comments(stmtLine(stmt), depth)
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		if s.Annotation != "" {
+			p.line(depth, s.Name+": "+s.Annotation+" = "+Expr(s.Value)+comment)
+		} else {
+			p.line(depth, s.Name+" = "+Expr(s.Value)+comment)
+		}
+	case *ast.TupleAssignment:
+		values := make([]string, len(s.Values))
+		for i, v := range s.Values {
+			values[i] = Expr(v)
+		}
+		p.line(depth, strings.Join(s.Names, ", ")+" = "+strings.Join(values, ", ")+comment)
+	case *ast.AugmentedAssignment:
+		p.line(depth, s.Name+" "+s.Operator+"= "+Expr(s.Value)+comment)
+	case *ast.IndexAssignment:
+		p.line(depth, Expr(s.Target)+" "+s.Operator+"= "+Expr(s.Value)+comment)
+	case *ast.PrintStatement:
+		p.line(depth, "print("+Expr(s.Value)+")"+comment)
+	case *ast.ReturnStatement:
+		if s.Value == nil {
+			p.line(depth, "return"+comment)
+			break
+		}
+		p.line(depth, "return "+Expr(s.Value)+comment)
+	case *ast.ExpressionStatement:
+		p.line(depth, Expr(s.Expression)+comment)
+	case *ast.GlobalStatement:
+		p.line(depth, "global "+strings.Join(s.Names, ", ")+comment)
+	case *ast.FunctionDefinition:
+		p.line(depth, "def "+s.Name+"("+strings.Join(s.Parameters, ", ")+"):"+comment)
+		p.block(s.Body, depth+1)
+	case *ast.IfStatement:
+		p.line(depth, "if "+Expr(s.Condition)+":"+hinted(s.Hint, comment))
+		p.block(s.Consequence, depth+1)
+		for _, e := range s.Elifs {
+			comment := p.comments(e.Token.Line, depth)
+			p.line(depth, "elif "+Expr(e.Condition)+":"+hinted(e.Hint, comment))
+			p.block(e.Consequence, depth+1)
+		}
+		if len(s.Alternative) > 0 {
+			p.line(depth, "else:"+p.comments(p.elseLine(), depth))
+			p.block(s.Alternative, depth+1)
+		}
+	case *ast.WhileStatement:
+		p.line(depth, "while "+Expr(s.Condition)+":"+comment)
+		p.block(s.Body, depth+1)
+	case *ast.ForStatement:
+		args := Expr(s.Stop)
+		if s.Start != nil {
+			args = Expr(s.Start) + ", " + args
+		}
+		if s.Step != nil {
+			args += ", " + Expr(s.Step)
+		}
+		p.line(depth, "for "+s.Variable+" in range("+args+"):"+comment)
+		p.block(s.Body, depth+1)
+	}
+}
+
+// Expr formats an expression, adding only the parentheses needed to keep
+// the tree shape when it is parsed again.
+func Expr(e ast.Expression) string {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(e.Value, 10)
+	case *ast.FloatLiteral:
+		return e.String()
+	case *ast.StringLiteral:
+		return `"` + ast.Escape(e.Value) + `"`
+	case *ast.NoneLiteral:
+		return "None"
+	case *ast.Identifier:
+		return e.Value
+	case *ast.FunctionCall:
+		args := make([]string, len(e.Arguments))
+		for i, a := range e.Arguments {
+			args[i] = Expr(a)
+		}
+		if e.Method && len(args) > 0 {
+			return args[0] + "." + e.Function + "(" + strings.Join(args[1:], ", ") + ")"
+		}
+		return e.Function + "(" + strings.Join(args, ", ") + ")"
+	case *ast.ListLiteral:
+		elements := make([]string, len(e.Elements))
+		for i, element := range e.Elements {
+			elements[i] = Expr(element)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *ast.DictLiteral:
+		pairs := make([]string, len(e.Keys))
+		for i, key := range e.Keys {
+			pairs[i] = Expr(key) + ": " + Expr(e.Values[i])
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *ast.IndexExpression:
+		return Expr(e.Left) + "[" + Expr(e.Index) + "]"
+	case *ast.InterpolatedString:
+		var out strings.Builder
+		out.WriteString(`f"`)
+		for _, part := range e.Parts {
+			if text, ok := part.(*ast.StringLiteral); ok {
+				out.WriteString(strings.NewReplacer("{", "{{", "}", "}}").Replace(ast.Escape(text.Value)))
+				continue
+			}
+			out.WriteString("{" + Expr(part) + "}")
+		}
+		out.WriteString(`"`)
+		return out.String()
+	case *ast.BinaryExpression:
+		prec := precedence[e.Operator]
+		// ** groups to the right, so its left operand is the one an equal
+		// precedence operator must not sit in unparenthesized
+		power := e.Operator == "**"
+		// A comparison beside another would read as one chain
+		compare := prec == comparePrecedence
+		return operand(e.Left, prec, power || compare) + " " + e.Operator + " " + operand(e.Right, prec, !power)
+	case *ast.Comparison:
+		var out strings.Builder
+		out.WriteString(operand(e.Operands[0], comparePrecedence, true))
+		for i, op := range e.Operators {
+			out.WriteString(" " + op + " " + operand(e.Operands[i+1], comparePrecedence, true))
+		}
+		return out.String()
+	case *ast.PrefixExpression:
+		if e.Operator == "not" {
+			return "not " + operand(e.Right, notPrecedence, false)
+		}
+		return e.Operator + operand(e.Right, prefixPrecedence, false)
+	}
+	return ""
+}
+
+// operand formats e as an operand of an operator of precedence parent. An
+// operand of equal precedence is parenthesized when tie is set.
+func operand(e ast.Expression, parent int, tie bool) string {
+	s := Expr(e)
+	switch e := e.(type) {
+	case *ast.BinaryExpression:
+		prec := precedence[e.Operator]
+		if prec < parent || (tie && prec == parent) {
+			return "(" + s + ")"
+		}
+	case *ast.Comparison:
+		if comparePrecedence < parent || (tie && comparePrecedence == parent) {
+			return "(" + s + ")"
+		}
+	case *ast.PrefixExpression:
+		if e.Operator == "not" && notPrecedence < parent || e.Operator == "-" && prefixPrecedence < parent {
+			return "(" + s + ")"
+		}
+	case *ast.IntegerLiteral:
+		if e.Value < 0 && prefixPrecedence < parent {
+			return "(" + s + ")"
+		}
+	case *ast.FloatLiteral:
+		if e.Value < 0 && prefixPrecedence < parent {
+			return "(" + s + ")"
+		}
+	}
+	return s
+}
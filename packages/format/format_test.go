@@ -0,0 +1,222 @@
+package format
+
+import (
+	"os"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Spacing",
+			input:    "x=5+3\nprint( x )",
+			expected: "x = 5 + 3\nprint(x)\n",
+		},
+		{
+			name:     "Escapes",
+			input:    "s = \"a\\tb\\n\\\"c\\\"\\\\\"\nprint(f\"\\t{s}\")",
+			expected: "s = \"a\\tb\\n\\\"c\\\"\\\\\"\nprint(f\"\\t{s}\")\n",
+		},
+		{
+			name:     "FString",
+			input:    "print(f\"{{x}} is {  x*2 }\")",
+			expected: "print(f\"{{x}} is {x * 2}\")\n",
+		},
+		{
+			name:     "Blocks",
+			input:    "if x > 0:\n\ty = 1\nelse:\n\ty = 2\n\nwhile y < 3:\n\ty = y + 1\n",
+			expected: "if x > 0:\n\ty = 1\nelse:\n\ty = 2\nwhile y < 3:\n\ty = y + 1\n",
+		},
+		{
+			name:     "Elif",
+			input:    "if x > 1:\n\ty = 1\nelif x>0:\n\ty = 2\nelif x<0:\n\ty = 3\n",
+			expected: "if x > 1:\n\ty = 1\nelif x > 0:\n\ty = 2\nelif x < 0:\n\ty = 3\n",
+		},
+		{
+			name:     "Branch hints",
+			input:    "if x > 1: # pragma:likely\n\ty = 1\nelif x>0:   #  pragma: unlikely\n\ty = 2\n",
+			expected: "if x > 1:  # pragma: likely\n\ty = 1\nelif x > 0:  # pragma: unlikely\n\ty = 2\n",
+		},
+		{
+			name:     "Global",
+			input:    "def f():\n\tglobal  x,y\n\tx = 1\n",
+			expected: "def f():\n\tglobal x, y\n\tx = 1\n",
+		},
+		{
+			name:     "For",
+			input:    "for i in range( 3 ):\n\tprint(i)\nfor j in range(1,n+1):\n\tprint(j)\nfor k in range(n,0,-1):\n\tprint(k)\n",
+			expected: "for i in range(3):\n\tprint(i)\nfor j in range(1, n + 1):\n\tprint(j)\nfor k in range(n, 0, -1):\n\tprint(k)\n",
+		},
+		{
+			name:     "Tuple assignment",
+			input:    "a,b=b,a+1\n",
+			expected: "a, b = b, a + 1\n",
+		},
+		{
+			name:     "Function",
+			input:    "x = 1\ndef add(a,b):\n\treturn a+b\ny = add(x, 2)",
+			expected: "x = 1\n\ndef add(a, b):\n\treturn a + b\n\ny = add(x, 2)\n",
+		},
+		{
+			name:     "Negative",
+			input:    "x = -5\ny=x - -3\nz = -x * 2\nw=-(x+1)\n",
+			expected: "x = -5\ny = x - -3\nz = -x * 2\nw = -(x + 1)\n",
+		},
+		{
+			name:     "Annotated assignment",
+			input:    "c:uint8=a+1\n",
+			expected: "c: uint8 = a + 1\n",
+		},
+		{
+			name:     "Dictionaries",
+			input:    "d={ \"a\":1,2 :x+1, }\ny = -d[ \"a\" ]*d[2]\ne = {}\n",
+			expected: "d = {\"a\": 1, 2: x + 1}\ny = -d[\"a\"] * d[2]\ne = {}\n",
+		},
+		{
+			name:     "Lists",
+			input:    "xs=[ 3,1 , 2, ]\nxs . sort( )\nys = sorted( xs )[0]\ne = []\n",
+			expected: "xs = [3, 1, 2]\nxs.sort()\nys = sorted(xs)[0]\ne = []\n",
+		},
+		{
+			name:     "Compound assignment",
+			input:    "x+=1\ny -=x*2\nz*= -1\n",
+			expected: "x += 1\ny -= x * 2\nz *= -1\n",
+		},
+		{
+			name:     "Comparison chains",
+			input:    "ok = 0<x<=10\nif a==b!=c:\n\ty = 1\n",
+			expected: "ok = 0 < x <= 10\nif a == b != c:\n\ty = 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Source(parse(t, tt.input)); got != tt.expected {
+				t.Errorf("wrong output.\nexpected: %q\ngot:      %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	for _, file := range []string{"test_1.py", "test_2.py", "test_3.py"} {
+		t.Run(file, func(t *testing.T) {
+			input, err := os.ReadFile("../../test_data/" + file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			once := Source(parse(t, string(input)))
+			twice := Source(parse(t, once))
+			if once != twice {
+				t.Errorf("formatting is not stable.\nfirst:\n%s\nsecond:\n%s", once, twice)
+			}
+		})
+	}
+}
+
+func TestExprParentheses(t *testing.T) {
+	num := func(v int64) ast.Expression { return &ast.IntegerLiteral{Value: v} }
+	bin := func(l ast.Expression, op string, r ast.Expression) ast.Expression {
+		return &ast.BinaryExpression{Left: l, Operator: op, Right: r}
+	}
+
+	tests := []struct {
+		expr     ast.Expression
+		expected string
+	}{
+		{bin(num(1), "+", bin(num(2), "*", num(3))), "1 + 2 * 3"},
+		{bin(bin(num(1), "+", num(2)), "*", num(3)), "(1 + 2) * 3"},
+		{bin(num(1), "+", bin(num(2), "+", num(3))), "1 + (2 + 3)"},
+		{bin(bin(num(1), "+", num(2)), "+", num(3)), "1 + 2 + 3"},
+		{&ast.PrefixExpression{Operator: "-", Right: bin(num(1), "*", num(2))}, "-(1 * 2)"},
+		{bin(num(1), "-", num(-2)), "1 - -2"},
+		{bin(bin(num(1), "or", num(2)), "and", num(3)), "(1 or 2) and 3"},
+		{bin(num(1), "or", bin(num(2), "and", num(3))), "1 or 2 and 3"},
+		{&ast.PrefixExpression{Operator: "not", Right: bin(num(1), "<", num(2))}, "not 1 < 2"},
+		{&ast.PrefixExpression{Operator: "not", Right: bin(num(1), "and", num(2))}, "not (1 and 2)"},
+		{bin(&ast.PrefixExpression{Operator: "not", Right: num(1)}, "<", num(2)), "(not 1) < 2"},
+		{bin(num(2), "**", bin(num(3), "**", num(2))), "2 ** 3 ** 2"},
+		{bin(bin(num(2), "**", num(3)), "**", num(2)), "(2 ** 3) ** 2"},
+		{bin(num(-2), "**", num(2)), "(-2) ** 2"},
+		{&ast.PrefixExpression{Operator: "-", Right: bin(num(2), "**", num(2))}, "-2 ** 2"},
+		{bin(&ast.PrefixExpression{Operator: "-", Right: &ast.Identifier{Value: "a"}}, "**", num(2)), "(-a) ** 2"},
+		{bin(&ast.FloatLiteral{Value: -1.5}, "**", num(2)), "(-1.5) ** 2"},
+		{bin(&ast.FloatLiteral{Value: 2}, "*", &ast.FloatLiteral{Value: 0.25}), "2.0 * 0.25"},
+		{bin(num(7), "//", bin(num(2), "*", num(3))), "7 // (2 * 3)"},
+		{bin(bin(num(1), "<", num(2)), "<", num(3)), "(1 < 2) < 3"},
+		{bin(num(1), "==", bin(num(2), "<", num(3))), "1 == (2 < 3)"},
+		{&ast.Comparison{Operands: []ast.Expression{num(0), bin(num(1), "+", num(2)), num(9)}, Operators: []string{"<", "<="}}, "0 < 1 + 2 <= 9"},
+		{&ast.Comparison{Operands: []ast.Expression{bin(num(1), "<", num(2)), num(1), num(1)}, Operators: []string{"==", "=="}}, "(1 < 2) == 1 == 1"},
+		{bin(&ast.Comparison{Operands: []ast.Expression{num(0), num(1), num(2)}, Operators: []string{"<", "<"}}, "and", num(3)), "0 < 1 < 2 and 3"},
+	}
+	for _, tt := range tests {
+		if got := Expr(tt.expr); got != tt.expected {
+			t.Errorf("Expr wrong. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestSourceWithTrivia(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "trailing comments",
+			input:    "x=1   # one\nif x:  # pragma: likely\n\tprint( x )# show\n",
+			expected: "x = 1  # one\nif x:  # pragma: likely\n\tprint(x)  # show\n",
+		},
+		{
+			name:     "comment lines and blank lines",
+			input:    "\n# start\nx = 1\n\n\n\n# then\ny = 2\n",
+			expected: "# start\nx = 1\n\n\n# then\ny = 2\n",
+		},
+		{
+			name:     "comments in blocks",
+			input:    "if x:\n\t# first\n\ty = 1\n\t# last\nelse:  # no\n\ty = 2\n# after\n",
+			expected: "if x:\n\t# first\n\ty = 1\n\t# last\nelse:  # no\n\ty = 2\n# after\n",
+		},
+		{
+			name:     "definitions",
+			input:    "x = 1\n# f doubles\ndef f(a):\n\treturn a * 2\ny = f(x)\n",
+			expected: "x = 1\n\n# f doubles\ndef f(a):\n\treturn a * 2\n\ny = f(x)\n",
+		},
+		{
+			name:     "end of file",
+			input:    "x = 1\n\n# done",
+			expected: "x = 1\n\n# done\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := lexer.Record(lexer.New(tt.input).KeepTrivia()).Tokens()
+			got := SourceWithTrivia(parse(t, tt.input), tokens)
+			if got != tt.expected {
+				t.Errorf("wrong output.\nexpected=%q\ngot=     %q", tt.expected, got)
+			}
+			again := lexer.Record(lexer.New(got).KeepTrivia()).Tokens()
+			if twice := SourceWithTrivia(parse(t, got), again); twice != got {
+				t.Errorf("formatting is not stable.\nfirst= %q\nsecond=%q", got, twice)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// SourceWithTrivia formats program like Source but keeps the author's
+// comments and blank lines, taken from tokens lexed from the program's
+// source with trivia kept. A comment stays on the line of the statement it
+// followed or before the statement it preceded, and runs of blank lines
+// are cut to two.
+func SourceWithTrivia(program *ast.Program, tokens []token.Token) string {
+	p := &printer{trivia: collectTrivia(tokens)}
+	p.program(program)
+	return p.out.String()
+}
+
+// item is a comment or a blank line from the source
+type item struct {
+	line     int
+	indent   int    // tabs before a comment on a line of its own
+	text     string // the comment, or empty for a blank line
+	trailing bool   // the comment follows code on its line
+}
+
+type trivia struct {
+	items  []item // in source order
+	next   int    // the first item not yet written
+	starts []int  // the lines tokens start on, in order
+	elses  []int  // the lines of else keywords, in order
+	last   int    // the line of the statement written last
+	blanks int    // blank lines written since the last line of code
+}
+
+func collectTrivia(tokens []token.Token) *trivia {
+	t := &trivia{}
+	for _, tok := range tokens {
+		switch tok.Type {
+		case token.INDENT, token.DEDENT, token.NEWLINE, token.COMMENT, token.PRAGMA:
+			continue
+		case token.ELSE:
+			t.elses = append(t.elses, tok.Line)
+		}
+		if tok.Type != token.EOF && (len(t.starts) == 0 || t.starts[len(t.starts)-1] != tok.Line) {
+			t.starts = append(t.starts, tok.Line)
+		}
+
+		// Every line of the leading text but the last is a whole line
+		// before the token's; the last is its indentation, except that
+		// the source may end in a comment without a newline
+		lines := strings.Split(tok.Leading, "\n")
+		first := tok.Line - len(lines) + 1
+		if tok.Type != token.EOF {
+			lines = lines[:len(lines)-1]
+		}
+		for i, text := range lines {
+			comment := strings.TrimSpace(text)
+			if comment != "" && comment[0] != '#' {
+				continue
+			}
+			indent := len(text) - len(strings.TrimLeft(text, "\t"))
+			t.items = append(t.items, item{line: first + i, indent: indent, text: comment})
+		}
+		if comment := strings.TrimSpace(tok.Trailing); comment != "" {
+			t.items = append(t.items, item{line: tok.Line, text: comment, trailing: true})
+		}
+	}
+	return t
+}
+
+// comments writes the comments and blank lines before line and returns
+// the comment at the end of line itself, ready to append to the code
+func (p *printer) comments(line, depth int) string {
+	t := p.trivia
+	if t == nil {
+		return ""
+	}
+	for t.next < len(t.items) && t.items[t.next].line < line {
+		p.write(t.items[t.next], depth)
+		t.next++
+	}
+	t.last = max(t.last, line)
+	if t.next < len(t.items) && t.items[t.next].line == line && t.items[t.next].trailing {
+		t.next++
+		return "  " + t.items[t.next-1].text
+	}
+	return ""
+}
+
+// closeBlock writes the comments indented into a block that ends it,
+// along with the blank lines between them, before the next line of code
+func (p *printer) closeBlock(depth int) {
+	t := p.trivia
+	if t == nil {
+		return
+	}
+	end := p.nextStart()
+	for {
+		j := t.next
+		for j < len(t.items) && t.items[j].line < end && t.items[j].text == "" {
+			j++
+		}
+		if j == len(t.items) || t.items[j].line >= end || t.items[j].trailing || t.items[j].indent < depth {
+			return
+		}
+		for ; t.next <= j; t.next++ {
+			p.write(t.items[t.next], depth)
+		}
+	}
+}
+
+// separate puts a blank line before the statement at line, ahead of any
+// comments that lead up to it, unless the author already left one
+func (p *printer) separate(line int) {
+	t := p.trivia
+	if t == nil {
+		p.out.WriteString("\n")
+		return
+	}
+	if t.next < len(t.items) && t.items[t.next].line < line && t.items[t.next].text == "" {
+		return
+	}
+	p.write(item{}, 0)
+}
+
+// finish writes the comments after the last statement
+func (p *printer) finish() {
+	t := p.trivia
+	if t == nil {
+		return
+	}
+	// Blank lines are only kept when a comment follows them
+	end := len(t.items)
+	for end > t.next && t.items[end-1].text == "" {
+		end--
+	}
+	for ; t.next < end; t.next++ {
+		p.write(t.items[t.next], 0)
+	}
+}
+
+func (p *printer) write(it item, depth int) {
+	t := p.trivia
+	if it.text != "" {
+		p.line(depth, it.text)
+		return
+	}
+	// No blank lines open the file, and at most two separate code
+	if p.out.Len() > 0 && t.blanks < 2 {
+		p.out.WriteString("\n")
+		t.blanks++
+	}
+}
+
+// nextStart is the first line after the last statement written that a
+// token starts on, or past the end
+func (p *printer) nextStart() int {
+	for _, line := range p.trivia.starts {
+		if line > p.trivia.last {
+			return line
+		}
+	}
+	return int(^uint(0) >> 1)
+}
+
+// elseLine is the line of the else of the if statement being written
+func (p *printer) elseLine() int {
+	if p.trivia == nil {
+		return 0
+	}
+	for _, line := range p.trivia.elses {
+		if line > p.trivia.last {
+			return line
+		}
+	}
+	return 0
+}
+
+// stmtLine is the line a statement starts on
+func stmtLine(stmt ast.Statement) int {
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		return s.Token.Line
+	case *ast.TupleAssignment:
+		return s.Token.Line
+	case *ast.AugmentedAssignment:
+		return s.Token.Line
+	case *ast.IndexAssignment:
+		return s.Token.Line
+	case *ast.PrintStatement:
+		return s.Token.Line
+	case *ast.ReturnStatement:
+		return s.Token.Line
+	case *ast.GlobalStatement:
+		return s.Token.Line
+	case *ast.ExpressionStatement:
+		return exprLine(s.Expression)
+	case *ast.FunctionDefinition:
+		return s.Token.Line
+	case *ast.IfStatement:
+		return s.Token.Line
+	case *ast.WhileStatement:
+		return s.Token.Line
+	case *ast.ForStatement:
+		return s.Token.Line
+	}
+	return 0
+}
+
+// exprLine is the line an expression starts on
+func exprLine(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.BinaryExpression:
+		return exprLine(e.Left)
+	case *ast.Comparison:
+		return exprLine(e.Operands[0])
+	case *ast.IndexExpression:
+		return exprLine(e.Left)
+	case *ast.PrefixExpression:
+		return e.Token.Line
+	case *ast.FunctionCall:
+		return e.Token.Line
+	case *ast.Identifier:
+		return e.Token.Line
+	case *ast.IntegerLiteral:
+		return e.Token.Line
+	case *ast.FloatLiteral:
+		return e.Token.Line
+	case *ast.StringLiteral:
+		return e.Token.Line
+	case *ast.NoneLiteral:
+		return e.Token.Line
+	case *ast.InterpolatedString:
+		return e.Token.Line
+	case *ast.DictLiteral:
+		return e.Token.Line
+	case *ast.ListLiteral:
+		return e.Token.Line
+	}
+	return 0
+}
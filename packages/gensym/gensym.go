@@ -0,0 +1,40 @@
+// Package gensym makes up the names a compilation needs that the program
+// does not give, such as the labels of generated code and temporary
+// variables. Each compilation owns its Generator rather than sharing a
+// counter, so compilations running side by side, or REPL sessions, number
+// their names independently and the same program is always given the same
+// names. A test can pin the names it expects by choosing the seed.
+package gensym
+
+import "strconv"
+
+// Generator hands out increasing numbers for names
+type Generator struct {
+	last int
+}
+
+// New returns a generator whose first number is seed+1
+func New(seed int) *Generator {
+	return &Generator{last: seed}
+}
+
+// Next returns the next number
+func (g *Generator) Next() int {
+	g.last++
+	return g.last
+}
+
+// Name returns prefix followed by the next number, as in L1 or _t2
+func (g *Generator) Name(prefix string) string {
+	return prefix + strconv.Itoa(g.Next())
+}
+
+// Last returns the last number handed out, or the seed before any is
+func (g *Generator) Last() int {
+	return g.last
+}
+
+// Skip makes sure no number up to n is handed out from now on
+func (g *Generator) Skip(n int) {
+	g.last = max(g.last, n)
+}
@@ -0,0 +1,32 @@
+package gensym
+
+import "testing"
+
+func TestGenerator(t *testing.T) {
+	g := New(0)
+	if got := []string{g.Name("L"), g.Name("if_true_"), g.Name("L")}; got[0] != "L1" || got[1] != "if_true_2" || got[2] != "L3" {
+		t.Errorf("expected L1, if_true_2 and L3, got %v", got)
+	}
+	if g.Last() != 3 {
+		t.Errorf("expected the last number to be 3, got %d", g.Last())
+	}
+
+	g.Skip(2)
+	if n := g.Next(); n != 4 {
+		t.Errorf("skipping back renumbered: expected 4, got %d", n)
+	}
+	g.Skip(10)
+	if n := g.Next(); n != 11 {
+		t.Errorf("expected 11 after skipping to 10, got %d", n)
+	}
+
+	// Generators are independent, and a seed pins where numbering starts
+	a, b := New(0), New(100)
+	a.Next()
+	if got := b.Name("_t"); got != "_t101" {
+		t.Errorf("expected _t101 from a seed of 100, got %s", got)
+	}
+	if got := a.Name("_t"); got != "_t2" {
+		t.Errorf("expected _t2, got %s", got)
+	}
+}
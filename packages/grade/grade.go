@@ -0,0 +1,308 @@
+// Package grade compiles a batch of submissions, runs each one against a set
+// of input/expected-output cases in the emulator and reports the results.
+package grade
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/emulator"
+)
+
+// Status values for an Entry
+const (
+	StatusPass         = "pass"
+	StatusFail         = "fail"
+	StatusCompileError = "compile-error"
+	StatusCompiled     = "compiled" // no test cases were given
+	StatusInternal     = "internal-error"
+)
+
+// DefaultCompileTimeout bounds how long one submission may take to compile
+const DefaultCompileTimeout = 10 * time.Second
+
+// Case is one input/expected-output pair
+type Case struct {
+	Name     string
+	Input    string
+	Expected string
+}
+
+// Submission is one student program
+type Submission struct {
+	Name string
+	Path string
+}
+
+// TestResult is the outcome of running one submission against one case
+type TestResult struct {
+	Case   string `json:"case"`
+	Passed bool   `json:"passed"`
+	Steps  int    `json:"steps"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Entry is the report line for one submission
+type Entry struct {
+	Submission   string            `json:"submission"`
+	Status       string            `json:"status"`
+	Diagnostics  []diag.Diagnostic `json:"diagnostics,omitempty"`
+	Instructions int               `json:"instructions"` // static count in the generated code
+	Steps        int               `json:"steps"`        // executed instructions summed over all cases
+	Passed       int               `json:"passed"`
+	Total        int               `json:"total"`
+	Tests        []TestResult      `json:"tests,omitempty"`
+	Compilation  *compiler.Report  `json:"compilation,omitempty"`
+}
+
+// Report is the result of a grading run
+type Report struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Config controls how submissions are executed
+type Config struct {
+	MaxSteps int
+
+	// CompileTimeout gives up on a submission whose compilation runs
+	// longer; zero means DefaultCompileTimeout
+	CompileTimeout time.Duration
+}
+
+// FindSubmissions lists the submissions in dir: every top-level .py file,
+// and every subdirectory holding either main.py or exactly one .py file.
+func FindSubmissions(dir string) ([]Submission, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var subs []Submission
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if !e.IsDir() {
+			if filepath.Ext(e.Name()) == ".py" {
+				subs = append(subs, Submission{Name: strings.TrimSuffix(e.Name(), ".py"), Path: path})
+			}
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, "main.py")); err == nil {
+			subs = append(subs, Submission{Name: e.Name(), Path: filepath.Join(path, "main.py")})
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(path, "*.py"))
+		if len(matches) == 1 {
+			subs = append(subs, Submission{Name: e.Name(), Path: matches[0]})
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Name < subs[j].Name })
+	return subs, nil
+}
+
+// LoadCases reads NAME.out files from dir together with the optional
+// matching NAME.in used as standard input.
+func LoadCases(dir string) ([]Case, error) {
+	outs, err := filepath.Glob(filepath.Join(dir, "*.out"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(outs)
+	var cases []Case
+	for _, out := range outs {
+		expected, err := os.ReadFile(out)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(out), ".out")
+		c := Case{Name: name, Expected: string(expected)}
+		if input, err := os.ReadFile(strings.TrimSuffix(out, ".out") + ".in"); err == nil {
+			c.Input = string(input)
+		}
+		cases = append(cases, c)
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no *.out files found in %s", dir)
+	}
+	return cases, nil
+}
+
+// Grade compiles and runs every submission
+func Grade(subs []Submission, cases []Case, cfg Config) *Report {
+	report := &Report{}
+	for _, sub := range subs {
+		report.Entries = append(report.Entries, gradeIsolated(sub, cases, cfg))
+	}
+	return report
+}
+
+// gradeIsolated is gradeOne, recording a panic as an internal error of the
+// submission so the rest of the batch is still graded
+func gradeIsolated(sub Submission, cases []Case, cfg Config) (entry Entry) {
+	defer func() {
+		if r := recover(); r != nil {
+			entry = internalError(sub, cases, fmt.Errorf("internal error: %v", r))
+		}
+	}()
+	return gradeOne(sub, cases, cfg)
+}
+
+func internalError(sub Submission, cases []Case, err error) Entry {
+	return Entry{
+		Submission:  sub.Name,
+		Status:      StatusInternal,
+		Total:       len(cases),
+		Diagnostics: []diag.Diagnostic{{Severity: diag.Error, Message: err.Error()}},
+	}
+}
+
+// compile is replaced in tests
+var compile = compiler.Compile
+
+// compileWithin compiles source on a goroutine of its own, returning an
+// error if the compiler panics or is still running after timeout. A
+// compilation that never finishes is abandoned, as it cannot be stopped.
+func compileWithin(source string, timeout time.Duration) (*compiler.Result, error) {
+	type outcome struct {
+		res *compiler.Result
+		err error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("internal compiler error: %v", r)}
+			}
+		}()
+		done <- outcome{res: compile(source)}
+	}()
+	select {
+	case o := <-done:
+		return o.res, o.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("compilation did not finish within %s", timeout)
+	}
+}
+
+func gradeOne(sub Submission, cases []Case, cfg Config) Entry {
+	entry := Entry{Submission: sub.Name, Total: len(cases)}
+
+	source, err := os.ReadFile(sub.Path)
+	if err != nil {
+		entry.Status = StatusCompileError
+		entry.Diagnostics = []diag.Diagnostic{{Severity: diag.Error, Message: err.Error()}}
+		return entry
+	}
+	timeout := cfg.CompileTimeout
+	if timeout <= 0 {
+		timeout = DefaultCompileTimeout
+	}
+	res, err := compileWithin(string(source), timeout)
+	if err != nil {
+		return internalError(sub, cases, err)
+	}
+	if res.Internal != nil {
+		return internalError(sub, cases, fmt.Errorf("internal compiler error in %s: %v", res.Internal.Phase, res.Internal.Value))
+	}
+	entry.Diagnostics = res.Diagnostics
+	entry.Compilation = res.Report()
+	if res.Failed() {
+		entry.Status = StatusCompileError
+		return entry
+	}
+
+	machine, err := emulator.Load(res.Assembly)
+	if err != nil {
+		entry.Status = StatusCompileError
+		entry.Diagnostics = append(entry.Diagnostics, diag.Diagnostic{Severity: diag.Error, Message: err.Error()})
+		return entry
+	}
+	entry.Instructions = machine.InstructionCount()
+
+	if len(cases) == 0 {
+		entry.Status = StatusCompiled
+		return entry
+	}
+
+	for _, c := range cases {
+		var out strings.Builder
+		result, err := emulator.Run(res.Assembly, emulator.Config{
+			Stdin:    strings.NewReader(c.Input),
+			Stdout:   &out,
+			MaxSteps: cfg.MaxSteps,
+		})
+		tr := TestResult{Case: c.Name}
+		if result != nil {
+			tr.Steps = result.Steps
+			entry.Steps += result.Steps
+		}
+		if err != nil {
+			tr.Error = err.Error()
+		} else {
+			tr.Passed = normalize(out.String()) == normalize(c.Expected)
+		}
+		if tr.Passed {
+			entry.Passed++
+		}
+		entry.Tests = append(entry.Tests, tr)
+	}
+
+	entry.Status = StatusFail
+	if entry.Passed == entry.Total {
+		entry.Status = StatusPass
+	}
+	return entry
+}
+
+// normalize ignores trailing whitespace on lines and at the end of output
+func normalize(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t\r")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// WriteJSON writes the full report, including per-case results
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes one summary row per submission
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"submission", "status", "passed", "total", "instructions", "steps", "errors", "warnings", "first_error"})
+	for _, e := range r.Entries {
+		var errs, warns int
+		firstErr := ""
+		for _, d := range e.Diagnostics {
+			switch d.Severity {
+			case diag.Error:
+				if errs == 0 {
+					firstErr = d.String()
+				}
+				errs++
+			case diag.Warning:
+				warns++
+			}
+		}
+		cw.Write([]string{
+			e.Submission, e.Status,
+			strconv.Itoa(e.Passed), strconv.Itoa(e.Total),
+			strconv.Itoa(e.Instructions), strconv.Itoa(e.Steps),
+			strconv.Itoa(errs), strconv.Itoa(warns), firstErr,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,170 @@
+package grade
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arifali123/152compiler/packages/compiler"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGrade(t *testing.T) {
+	subsDir := t.TempDir()
+	testsDir := t.TempDir()
+	writeFiles(t, subsDir, map[string]string{
+		"alice.py":        "x = 2\ny = x * 3\nprint(y)\n",
+		"bob/main.py":     "x = 2\ny = x + 3\nprint(y)\n",
+		"carol/answer.py": "x = * 2\n",
+		"notes.txt":       "ignored",
+	})
+	writeFiles(t, testsDir, map[string]string{
+		"basic.out": "6\n",
+	})
+
+	subs, err := FindSubmissions(subsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 3 {
+		t.Fatalf("expected 3 submissions, got %d: %v", len(subs), subs)
+	}
+	cases, err := LoadCases(testsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Grade(subs, cases, Config{})
+	expected := []struct {
+		name   string
+		status string
+		passed int
+	}{
+		{"alice", StatusPass, 1},
+		{"bob", StatusFail, 0},
+		{"carol", StatusCompileError, 0},
+	}
+	for i, tt := range expected {
+		e := report.Entries[i]
+		if e.Submission != tt.name || e.Status != tt.status || e.Passed != tt.passed {
+			t.Errorf("entry %d wrong. expected=%s/%s/%d, got=%s/%s/%d",
+				i, tt.name, tt.status, tt.passed, e.Submission, e.Status, e.Passed)
+		}
+	}
+	if report.Entries[0].Instructions == 0 || report.Entries[0].Steps == 0 {
+		t.Errorf("expected instruction counts for alice, got %+v", report.Entries[0])
+	}
+
+	var csvOut strings.Builder
+	if err := report.WriteCSV(&csvOut); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "submission,status") {
+		t.Errorf("unexpected CSV:\n%s", csvOut.String())
+	}
+	if !strings.HasPrefix(lines[3], "carol,compile-error,0,1,0,0,1,0,") {
+		t.Errorf("unexpected CSV row for carol: %s", lines[3])
+	}
+
+	var jsonOut strings.Builder
+	if err := report.WriteJSON(&jsonOut); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(jsonOut.String(), `"case": "basic"`) {
+		t.Errorf("JSON report missing per-case results:\n%s", jsonOut.String())
+	}
+	if !strings.Contains(jsonOut.String(), `"compilation": {`) {
+		t.Errorf("JSON report missing the compilation reports:\n%s", jsonOut.String())
+	}
+}
+
+func TestLoadCasesWithInput(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.in": "5\n", "a.out": "25\n", "b.out": "x\n"})
+	cases, err := LoadCases(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 2 || cases[0].Input != "5\n" || cases[1].Input != "" {
+		t.Errorf("unexpected cases: %+v", cases)
+	}
+
+	if _, err := LoadCases(t.TempDir()); err == nil {
+		t.Error("expected an error for a directory without cases")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if normalize("1 \n2\n\n") != normalize("1\n2") {
+		t.Error("trailing whitespace should not affect comparison")
+	}
+	if normalize("1\n2") == normalize("12") {
+		t.Error("line breaks must be significant")
+	}
+}
+
+func TestGradeIsolation(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.py": "print(1)\n",
+		"b.py": "panic\n",
+		"c.py": "hang\n",
+		"d.py": "print(2)\n",
+		"e.py": "recovered\n",
+	})
+	subs, err := FindSubmissions(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	defer func(c func(string) *compiler.Result) { compile = c }(compile)
+	compile = func(source string) *compiler.Result {
+		switch source {
+		case "panic\n":
+			panic("boom")
+		case "hang\n":
+			<-release
+		case "recovered\n":
+			return &compiler.Result{Internal: &compiler.InternalError{Phase: "codegen", Value: "boom"}}
+		}
+		return compiler.Compile(source)
+	}
+
+	report := Grade(subs, nil, Config{CompileTimeout: 100 * time.Millisecond})
+	expected := []struct {
+		status  string
+		message string
+	}{
+		{StatusCompiled, ""},
+		{StatusInternal, "internal compiler error: boom"},
+		{StatusInternal, "compilation did not finish within 100ms"},
+		{StatusCompiled, ""},
+		{StatusInternal, "internal compiler error in codegen: boom"},
+	}
+	for i, tt := range expected {
+		e := report.Entries[i]
+		if e.Status != tt.status {
+			t.Errorf("%s: expected status %s, got %s", e.Submission, tt.status, e.Status)
+		}
+		if tt.message != "" && (len(e.Diagnostics) != 1 || e.Diagnostics[0].Message != tt.message) {
+			t.Errorf("%s: expected diagnostic %q, got %+v", e.Submission, tt.message, e.Diagnostics)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package highlight classifies the text of a program for syntax coloring,
+// using the positions the lexer records on each token. It renders the
+// result as LSP semantic tokens or as HTML.
+package highlight
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// Kind is what a range of source is, named as in the LSP's standard
+// semantic token types
+type Kind string
+
+const (
+	Keyword  Kind = "keyword"
+	Function Kind = "function" // a function name where it is defined or called, and print
+	Variable Kind = "variable"
+	Number   Kind = "number"
+	String   Kind = "string"
+	Operator Kind = "operator"
+	Comment  Kind = "comment"
+)
+
+// Kinds lists every Kind in the order of the LSP legend, so a kind's index
+// here is its token type number
+var Kinds = []Kind{Keyword, Function, Variable, Number, String, Operator, Comment}
+
+// Range is a run of source text of one kind. Line and Column count from 1
+// and Length is in bytes; a range never spans lines.
+type Range struct {
+	Line   int
+	Column int
+	Length int
+	Kind   Kind
+}
+
+var keywords = map[token.TokenType]bool{
+	token.DEF: true, token.RETURN: true, token.IF: true, token.ELIF: true, token.ELSE: true,
+	token.WHILE: true, token.FOR: true, token.IN: true, token.AND: true, token.OR: true, token.NOT: true,
+	token.NONE: true, token.GLOBAL: true,
+}
+
+// Ranges classifies source, in order. Text the lexer rejects is left out.
+func Ranges(source string) []Range {
+	lines := strings.Split(source, "\n")
+	lineEnd := func(line int) int {
+		if line < 1 || line > len(lines) {
+			return 0
+		}
+		return len(strings.TrimRight(lines[line-1], "\r"))
+	}
+	var ranges []Range
+	tokens := lexer.Record(lexer.New(source).KeepComments()).Tokens()
+	prev := token.Token{Type: token.NEWLINE}
+	for i, tok := range tokens {
+		if tok.Type == token.EOF {
+			break
+		}
+		r := Range{Line: tok.Line, Column: tok.Column, Length: len(tok.Literal)}
+		switch {
+		case keywords[tok.Type]:
+			r.Kind = Keyword
+		case tok.Type == token.PRINT:
+			r.Kind = Function
+		case tok.Type == token.IDENT:
+			r.Kind = Variable
+			if prev.Type == token.DEF || i+1 < len(tokens) && tokens[i+1].Type == token.LPAREN {
+				r.Kind = Function
+			}
+		case tok.Type == token.INT || tok.Type == token.FLOAT:
+			// Underscores grouping the digits are not in the literal
+			r.Kind, r.Length = Number, tok.End()-tok.Column
+		case tok.Type == token.STRING:
+			// The literal holds the unescaped value, so measure the source
+			r.Kind, r.Length = String, tok.End()-tok.Column
+		case tok.Type == token.FSTRING:
+			r.Kind, r.Length = String, tok.End()-tok.Column
+		case tok.Type == token.COMMENT:
+			r.Kind = Comment
+		case tok.Type == token.PRAGMA:
+			r.Kind, r.Length = Comment, lineEnd(tok.Line)-tok.Column+1
+		case isOperator(tok.Type):
+			r.Kind = Operator
+		default:
+			prev = tok
+			continue
+		}
+		ranges = append(ranges, r)
+		prev = tok
+	}
+	return ranges
+}
+
+// isOperator reports whether t is an arithmetic, comparison or assignment
+// operator; brackets and other punctuation are not
+func isOperator(t token.TokenType) bool {
+	switch t {
+	case token.LPAREN, token.RPAREN, token.LBRACE, token.RBRACE, token.LBRACKET, token.RBRACKET,
+		token.COLON, token.COMMA, token.DOT:
+		return false
+	}
+	s := string(t)
+	return s != "" && strings.Trim(s, "=+-*/%<>!") == ""
+}
+
+// LSP encodes ranges as the data array of an LSP SemanticTokens result:
+// five numbers per range giving its line and start relative to the range
+// before it, its length, its index in Kinds and no modifiers. Positions are
+// zero-based, and bytes stand in for UTF-16 units, which is exact for ASCII.
+func LSP(ranges []Range) []int {
+	index := make(map[Kind]int, len(Kinds))
+	for i, k := range Kinds {
+		index[k] = i
+	}
+	data := make([]int, 0, 5*len(ranges))
+	line, column := 0, 0
+	for _, r := range ranges {
+		deltaLine := r.Line - 1 - line
+		deltaStart := r.Column - 1
+		if deltaLine == 0 {
+			deltaStart -= column
+		}
+		data = append(data, deltaLine, deltaStart, r.Length, index[r.Kind], 0)
+		line, column = r.Line-1, r.Column-1
+	}
+	return data
+}
+
+// HTML renders source as a pre element with each range wrapped in a span
+// whose class is its kind, prefixed with "hl-"
+func HTML(source string, ranges []Range) string {
+	var out strings.Builder
+	out.WriteString("<pre class=\"hl\">")
+	lines := strings.SplitAfter(source, "\n")
+	next := 0
+	for i, text := range lines {
+		line, col := i+1, 0
+		for ; next < len(ranges) && ranges[next].Line == line; next++ {
+			r := ranges[next]
+			start := min(r.Column-1, len(text))
+			end := min(start+r.Length, len(text))
+			if start < col {
+				continue
+			}
+			out.WriteString(html.EscapeString(text[col:start]))
+			fmt.Fprintf(&out, "<span class=\"hl-%s\">%s</span>", r.Kind, html.EscapeString(text[start:end]))
+			col = end
+		}
+		out.WriteString(html.EscapeString(text[col:]))
+	}
+	out.WriteString("</pre>\n")
+	return out.String()
+}
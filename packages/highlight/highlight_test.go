@@ -0,0 +1,46 @@
+package highlight
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRanges(t *testing.T) {
+	input := "def sq(n):\n\treturn n * n # square\n\nx = sq(3) + 1.5\nif x >= 2 and not x: # pragma: likely\n\tprint(\"a\\t<b>\\\"\")\nprint(f\"{x}\")\n"
+	expected := []Range{
+		{1, 1, 3, Keyword}, {1, 5, 2, Function}, {1, 8, 1, Variable},
+		{2, 2, 6, Keyword}, {2, 9, 1, Variable}, {2, 11, 1, Operator}, {2, 13, 1, Variable}, {2, 15, 8, Comment},
+		{4, 1, 1, Variable}, {4, 3, 1, Operator}, {4, 5, 2, Function}, {4, 8, 1, Number}, {4, 11, 1, Operator}, {4, 13, 3, Number},
+		{5, 1, 2, Keyword}, {5, 4, 1, Variable}, {5, 6, 2, Operator}, {5, 9, 1, Number}, {5, 11, 3, Keyword}, {5, 15, 3, Keyword},
+		{5, 19, 1, Variable}, {5, 22, 16, Comment},
+		{6, 2, 5, Function}, {6, 8, 10, String},
+		{7, 1, 5, Function}, {7, 7, 6, String},
+	}
+	got := Ranges(input)
+	if !slices.Equal(got, expected) {
+		t.Errorf("wrong ranges.\nexpected=%v\ngot=     %v", expected, got)
+	}
+}
+
+func TestLSP(t *testing.T) {
+	ranges := []Range{{1, 1, 3, Keyword}, {1, 5, 2, Function}, {3, 2, 6, Keyword}, {3, 9, 1, Variable}}
+	expected := []int{
+		0, 0, 3, 0, 0,
+		0, 4, 2, 1, 0,
+		2, 1, 6, 0, 0,
+		0, 7, 1, 2, 0,
+	}
+	if got := LSP(ranges); !slices.Equal(got, expected) {
+		t.Errorf("wrong data. expected=%v, got=%v", expected, got)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	input := "x = \"<&>\"\nprint(x)\n"
+	expected := "<pre class=\"hl\"><span class=\"hl-variable\">x</span> <span class=\"hl-operator\">=</span> " +
+		"<span class=\"hl-string\">&#34;&lt;&amp;&gt;&#34;</span>\n" +
+		"<span class=\"hl-function\">print</span>(<span class=\"hl-variable\">x</span>)\n</pre>\n"
+	if got := HTML(input, Ranges(input)); got != expected {
+		t.Errorf("wrong html.\nexpected=%q\ngot=     %q", expected, got)
+	}
+}
@@ -0,0 +1,315 @@
+// Package ir lowers the AST into three-address code. The MIPS backend still
+// generates directly from the AST; the IR is the inspectable, machine
+// independent view of the same lowering, printed by the `ir` subcommand.
+package ir
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/ast"
+)
+
+type Op string
+
+const (
+	OpCopy    Op = "copy"    // Dst = A
+	OpBinary  Op = "binary"  // Dst = A Operator B
+	OpLabel   Op = "label"   // Label:
+	OpJump    Op = "jump"    // goto Label
+	OpIfFalse Op = "iffalse" // iffalse A goto Label
+	OpPrint   Op = "print"   // print A
+	OpWrite   Op = "write"   // print A without ending the line
+	OpParam   Op = "param"   // param A
+	OpCall    Op = "call"    // Dst = call Label, N  (Dst may be empty)
+	OpReturn  Op = "return"  // return A, or return with no value
+	OpDict    Op = "dict"    // Dst = dict N  (an empty table with room for N entries)
+	OpList    Op = "list"    // Dst = list N  (a list of N elements, set after)
+	OpSet     Op = "set"     // Dst[A] = B
+	OpIndex   Op = "index"   // Dst = A[B]
+)
+
+// Instr is a single three-address instruction. Operands are textual:
+// variables by name, temporaries as tN, integers in decimal and strings quoted.
+type Instr struct {
+	Op       Op
+	Dst      string
+	A, B     string
+	Operator string
+	Label    string
+	N        int
+}
+
+// Function is a lowered function body; top-level code becomes "main"
+type Function struct {
+	Name   string
+	Params []string
+	Body   []Instr
+}
+
+// Module is a lowered program
+type Module struct {
+	Functions []*Function
+}
+
+type lowerer struct {
+	fn     *Function
+	temps  int
+	labels int
+}
+
+// Lower translates a program into three-address code
+func Lower(program *ast.Program) *Module {
+	mod := &Module{}
+	main := &Function{Name: "main"}
+	mod.Functions = append(mod.Functions, main)
+
+	lw := &lowerer{fn: main}
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*ast.FunctionDefinition); ok {
+			f := &Function{Name: fn.Name, Params: fn.Parameters}
+			mod.Functions = append(mod.Functions, f)
+			sub := &lowerer{fn: f}
+			sub.block(fn.Body)
+			continue
+		}
+		lw.stmt(stmt)
+	}
+	return mod
+}
+
+func (lw *lowerer) emit(in Instr) {
+	lw.fn.Body = append(lw.fn.Body, in)
+}
+
+func (lw *lowerer) temp() string {
+	lw.temps++
+	return fmt.Sprintf("t%d", lw.temps)
+}
+
+func (lw *lowerer) label() string {
+	lw.labels++
+	return fmt.Sprintf("L%d", lw.labels)
+}
+
+func (lw *lowerer) block(stmts []ast.Statement) {
+	for _, s := range stmts {
+		lw.stmt(s)
+	}
+}
+
+func (lw *lowerer) stmt(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		lw.emit(Instr{Op: OpCopy, Dst: s.Name, A: lw.expr(s.Value)})
+	case *ast.IndexAssignment:
+		list := lw.expr(s.Target.Left)
+		index := lw.expr(s.Target.Index)
+		lw.emit(Instr{Op: OpSet, Dst: list, A: index, B: lw.expr(s.Value)})
+	case *ast.PrintStatement:
+		if fs, ok := s.Value.(*ast.InterpolatedString); ok {
+			for _, part := range fs.Parts {
+				lw.emit(Instr{Op: OpWrite, A: lw.expr(part)})
+			}
+			lw.emit(Instr{Op: OpPrint, A: `""`})
+			return
+		}
+		lw.emit(Instr{Op: OpPrint, A: lw.expr(s.Value)})
+	case *ast.ReturnStatement:
+		if s.Value == nil {
+			lw.emit(Instr{Op: OpReturn})
+			return
+		}
+		lw.emit(Instr{Op: OpReturn, A: lw.expr(s.Value)})
+	case *ast.ExpressionStatement:
+		if call, ok := s.Expression.(*ast.FunctionCall); ok {
+			lw.call(call, "")
+			return
+		}
+		lw.expr(s.Expression)
+	case *ast.IfStatement:
+		elseLabel, end := lw.label(), lw.label()
+		lw.emit(Instr{Op: OpIfFalse, A: lw.expr(s.Condition), Label: elseLabel})
+		lw.block(s.Consequence)
+		lw.emit(Instr{Op: OpJump, Label: end})
+		lw.emit(Instr{Op: OpLabel, Label: elseLabel})
+		lw.block(s.Alternative)
+		lw.emit(Instr{Op: OpLabel, Label: end})
+	case *ast.WhileStatement:
+		start, end := lw.label(), lw.label()
+		lw.emit(Instr{Op: OpLabel, Label: start})
+		lw.emit(Instr{Op: OpIfFalse, A: lw.expr(s.Condition), Label: end})
+		lw.block(s.Body)
+		lw.emit(Instr{Op: OpJump, Label: start})
+		lw.emit(Instr{Op: OpLabel, Label: end})
+	}
+}
+
+// expr lowers an expression and returns the operand holding its value
+func (lw *lowerer) expr(e ast.Expression) string {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(e.Value, 10)
+	case *ast.FloatLiteral:
+		return e.String()
+	case *ast.StringLiteral:
+		return strconv.Quote(e.Value)
+	case *ast.NoneLiteral:
+		return "None"
+	case *ast.Identifier:
+		return e.Value
+	case *ast.BinaryExpression:
+		if e.Operator == "and" || e.Operator == "or" {
+			return lw.logical(e)
+		}
+		left := lw.expr(e.Left)
+		right := lw.expr(e.Right)
+		dst := lw.temp()
+		lw.emit(Instr{Op: OpBinary, Dst: dst, A: left, B: right, Operator: e.Operator})
+		return dst
+	case *ast.Comparison:
+		return lw.comparison(e)
+	case *ast.PrefixExpression:
+		right := lw.expr(e.Right)
+		dst := lw.temp()
+		if e.Operator == "not" {
+			lw.emit(Instr{Op: OpBinary, Dst: dst, A: right, B: "0", Operator: "=="})
+			return dst
+		}
+		lw.emit(Instr{Op: OpBinary, Dst: dst, A: "0", B: right, Operator: e.Operator})
+		return dst
+	case *ast.FunctionCall:
+		dst := lw.temp()
+		lw.call(e, dst)
+		return dst
+	case *ast.DictLiteral:
+		dst := lw.temp()
+		lw.emit(Instr{Op: OpDict, Dst: dst, N: len(e.Keys)})
+		for i, key := range e.Keys {
+			k := lw.expr(key)
+			lw.emit(Instr{Op: OpSet, Dst: dst, A: k, B: lw.expr(e.Values[i])})
+		}
+		return dst
+	case *ast.ListLiteral:
+		dst := lw.temp()
+		lw.emit(Instr{Op: OpList, Dst: dst, N: len(e.Elements)})
+		for i, element := range e.Elements {
+			lw.emit(Instr{Op: OpSet, Dst: dst, A: strconv.Itoa(i), B: lw.expr(element)})
+		}
+		return dst
+	case *ast.IndexExpression:
+		left := lw.expr(e.Left)
+		index := lw.expr(e.Index)
+		dst := lw.temp()
+		lw.emit(Instr{Op: OpIndex, Dst: dst, A: left, B: index})
+		return dst
+	}
+	return "?"
+}
+
+// logical lowers and/or so the right operand is only evaluated when the
+// left one does not already decide the result
+func (lw *lowerer) logical(e *ast.BinaryExpression) string {
+	dst := lw.temp()
+	lw.emit(Instr{Op: OpCopy, Dst: dst, A: lw.expr(e.Left)})
+	end := lw.label()
+	if e.Operator == "and" {
+		lw.emit(Instr{Op: OpIfFalse, A: dst, Label: end})
+	} else {
+		rhs := lw.label()
+		lw.emit(Instr{Op: OpIfFalse, A: dst, Label: rhs})
+		lw.emit(Instr{Op: OpJump, Label: end})
+		lw.emit(Instr{Op: OpLabel, Label: rhs})
+	}
+	lw.emit(Instr{Op: OpCopy, Dst: dst, A: lw.expr(e.Right)})
+	lw.emit(Instr{Op: OpLabel, Label: end})
+	return dst
+}
+
+// comparison lowers a < b < c as a < b and b < c, evaluating b once and c
+// only when a < b holds
+func (lw *lowerer) comparison(e *ast.Comparison) string {
+	dst := lw.temp()
+	end := lw.label()
+	left := lw.expr(e.Operands[0])
+	for i, op := range e.Operators {
+		right := lw.expr(e.Operands[i+1])
+		lw.emit(Instr{Op: OpBinary, Dst: dst, A: left, B: right, Operator: op})
+		if i < len(e.Operators)-1 {
+			lw.emit(Instr{Op: OpIfFalse, A: dst, Label: end})
+		}
+		left = right
+	}
+	lw.emit(Instr{Op: OpLabel, Label: end})
+	return dst
+}
+
+func (lw *lowerer) call(call *ast.FunctionCall, dst string) {
+	args := make([]string, len(call.Arguments))
+	for i, a := range call.Arguments {
+		args[i] = lw.expr(a)
+	}
+	for _, a := range args {
+		lw.emit(Instr{Op: OpParam, A: a})
+	}
+	lw.emit(Instr{Op: OpCall, Dst: dst, Label: call.Function, N: len(args)})
+}
+
+func (in Instr) String() string {
+	switch in.Op {
+	case OpCopy:
+		return fmt.Sprintf("%s = %s", in.Dst, in.A)
+	case OpBinary:
+		return fmt.Sprintf("%s = %s %s %s", in.Dst, in.A, in.Operator, in.B)
+	case OpLabel:
+		return in.Label + ":"
+	case OpJump:
+		return "goto " + in.Label
+	case OpIfFalse:
+		return fmt.Sprintf("iffalse %s goto %s", in.A, in.Label)
+	case OpPrint:
+		return "print " + in.A
+	case OpWrite:
+		return "write " + in.A
+	case OpParam:
+		return "param " + in.A
+	case OpCall:
+		if in.Dst == "" {
+			return fmt.Sprintf("call %s, %d", in.Label, in.N)
+		}
+		return fmt.Sprintf("%s = call %s, %d", in.Dst, in.Label, in.N)
+	case OpReturn:
+		if in.A == "" {
+			return "return"
+		}
+		return "return " + in.A
+	case OpDict:
+		return fmt.Sprintf("%s = dict %d", in.Dst, in.N)
+	case OpList:
+		return fmt.Sprintf("%s = list %d", in.Dst, in.N)
+	case OpSet:
+		return fmt.Sprintf("%s[%s] = %s", in.Dst, in.A, in.B)
+	case OpIndex:
+		return fmt.Sprintf("%s = %s[%s]", in.Dst, in.A, in.B)
+	}
+	return string(in.Op)
+}
+
+func (m *Module) String() string {
+	var out strings.Builder
+	for i, fn := range m.Functions {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "func %s(%s):\n", fn.Name, strings.Join(fn.Params, ", "))
+		for _, in := range fn.Body {
+			if in.Op == OpLabel {
+				out.WriteString(in.String() + "\n")
+				continue
+			}
+			out.WriteString("    " + in.String() + "\n")
+		}
+	}
+	return out.String()
+}
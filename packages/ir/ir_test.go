@@ -0,0 +1,149 @@
+package ir
+
+import (
+	"os"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/parser"
+)
+
+func TestLower(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:  "Assignment",
+			input: "x = 5 + 3\nprint(x)",
+			expected: `func main():
+    t1 = 5 + 3
+    x = t1
+    print x
+`,
+		},
+		{
+			name:  "Dictionary",
+			input: "d = {\"a\": 1, \"b\": n + 1}\nprint(d[\"b\"])",
+			expected: `func main():
+    t1 = dict 2
+    t1["a"] = 1
+    t2 = n + 1
+    t1["b"] = t2
+    d = t1
+    t3 = d["b"]
+    print t3
+`,
+		},
+		{
+			name:  "List",
+			input: "xs = [4, n * 2]\nxs.sort()\nprint(xs[1])",
+			expected: `func main():
+    t1 = list 2
+    t1[0] = 4
+    t2 = n * 2
+    t1[1] = t2
+    xs = t1
+    param xs
+    call sort, 1
+    t3 = xs[1]
+    print t3
+`,
+		},
+		{
+			name:  "While Loop",
+			input: "i = 0\nwhile i < 3:\n\ti = i + 1",
+			expected: `func main():
+    i = 0
+L1:
+    t1 = i < 3
+    iffalse t1 goto L2
+    t2 = i + 1
+    i = t2
+    goto L1
+L2:
+`,
+		},
+		{
+			name:  "Comparison Chain",
+			input: "ok = 0 < x - 1 <= 9",
+			expected: `func main():
+    t2 = x - 1
+    t1 = 0 < t2
+    iffalse t1 goto L1
+    t1 = t2 <= 9
+L1:
+    ok = t1
+`,
+		},
+		{
+			name:  "If Else",
+			input: "if x > 0:\n\ty = 1\nelse:\n\ty = \"no\"\n",
+			expected: `func main():
+    t1 = x > 0
+    iffalse t1 goto L1
+    y = 1
+    goto L2
+L1:
+    y = "no"
+L2:
+`,
+		},
+		{
+			name:  "Short Circuit",
+			input: "a = x and y\nb = x or not y",
+			expected: `func main():
+    t1 = x
+    iffalse t1 goto L1
+    t1 = y
+L1:
+    a = t1
+    t2 = x
+    iffalse t2 goto L3
+    goto L2
+L3:
+    t3 = y == 0
+    t2 = t3
+L2:
+    b = t2
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			if got := Lower(program).String(); got != tt.expected {
+				t.Errorf("wrong IR.\nexpected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLowerFunctions(t *testing.T) {
+	input, err := os.ReadFile("../../test_data/test_3.py")
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := parser.New(lexer.New(string(input))).ParseProgram()
+
+	expected := `func main():
+    param 5
+    param 3
+    t1 = call add, 2
+    result = t1
+    print result
+
+func add(a, b):
+    t1 = a + b
+    return t1
+`
+	if got := Lower(program).String(); got != expected {
+		t.Errorf("wrong IR.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -1,21 +1,44 @@
 package lexer
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
 	"github.com/arifali123/152compiler/packages/token"
 )
 
 type Lexer struct {
 	input         string
-	position      int   // current position in input
-	readPosition  int   // current reading position in input
-	ch            byte  // current char under examination
-	line          int   // current line number
-	column        int   // current column number
-	indentStack   []int // stack to track indentation levels
-	currentIndent int   // current line's indentation level
-	startOfLine   bool  // track if we're at start of line
-	expectIndent  bool  // track if we expect indentation after a colon
-	lineLength    int   // track the length of the current line
+	position      int           // current position in input
+	readPosition  int           // current reading position in input
+	ch            byte          // current char under examination
+	line          int           // current line number
+	column        int           // current column number
+	indentStack   []int         // stack to track indentation levels
+	currentIndent int           // current line's indentation level
+	startOfLine   bool          // track if we're at start of line
+	expectIndent  bool          // the last token was a colon, so a block may open on the next line
+	lineLength    int           // track the length of the current line
+	dedents       int           // DEDENT tokens still owed for the current line
+	brackets      int           // (, [ and { still open, inside which a newline does not end the line
+	comments      bool          // return comments as COMMENT tokens rather than skip them
+	trivia        bool          // fill in the Leading and Trailing text of tokens
+	triviaStart   int           // where the next token's leading trivia begins
+	tokenStart    int           // where the token being returned begins
+	lineHasToken  bool          // a token other than NEWLINE was read on this line
+	indent        Indentation   // what one level of indentation is; see Indent
+	indentLine    int           // the line AutoIndent took indent from, 0 if it was given
+	trace         Logger        // receives each token returned; see Trace
+	reader        *bufio.Reader // where input's next line comes from, nil once it is all read
+	err           error         // why reading stopped early; see Err
+}
+
+// Logger receives a trace of the front end's work, one line per call, such
+// as a *log.Logger. Tracing is off unless one is given.
+type Logger interface {
+	Printf(format string, args ...interface{})
 }
 
 func New(input string) *Lexer {
@@ -31,7 +54,137 @@ func New(input string) *Lexer {
 	return l
 }
 
+// NewFromReader lexes the text r produces, reading it a line at a time.
+// Only the line being lexed is held in memory, along with, when trivia is
+// kept, the blank lines and comments not yet attached to a token. A read
+// error ends the input early; Err reports it.
+func NewFromReader(r io.Reader) *Lexer {
+	l := &Lexer{
+		reader:      bufio.NewReader(r),
+		line:        1,
+		indentStack: []int{0},
+		startOfLine: true,
+	}
+	l.readChar()
+	return l
+}
+
+// Err returns the error that ended a reader's input early, or nil
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// NewAt lexes input as part of a line that starts at line and column, such
+// as an expression inside an f-string. Positions count from there, and
+// leading spaces are not indentation.
+func NewAt(input string, line, column int) *Lexer {
+	l := &Lexer{
+		input:       input,
+		line:        line,
+		column:      column - 1,
+		indentStack: []int{0},
+	}
+	l.readChar()
+	return l
+}
+
+// KeepComments makes l return each comment as a COMMENT token instead of
+// skipping it, for tools that show or preserve comments. The parser ignores
+// them.
+func (l *Lexer) KeepComments() *Lexer {
+	l.comments = true
+	return l
+}
+
+// KeepTrivia makes l record the whitespace, blank lines and comments around
+// each token in its Leading and Trailing fields, so a tool can write them
+// back out
+func (l *Lexer) KeepTrivia() *Lexer {
+	l.trivia = true
+	return l
+}
+
+// Indentation is what one level of indentation is written as: a tab, a
+// number of spaces, or, with AutoIndent, whatever the first indented line
+// uses
+type Indentation int
+
+const (
+	// AutoIndent takes the unit from the first indented line: a tab, or as
+	// many spaces as it starts with. It is the default.
+	AutoIndent Indentation = 0
+	// TabIndent indents one tab per level
+	TabIndent Indentation = -1
+)
+
+// SpaceIndent indents n spaces per level
+func SpaceIndent(n int) Indentation {
+	return Indentation(n)
+}
+
+// Indent sets how l expects lines to be indented. A line indented in any
+// other way, mixing tabs and spaces or with spaces that are not a whole
+// number of levels, is ILLEGAL.
+func (l *Lexer) Indent(unit Indentation) *Lexer {
+	l.indent = unit
+	return l
+}
+
+// Trace makes l report each token it returns to log
+func (l *Lexer) Trace(log Logger) *Lexer {
+	l.trace = log
+	return l
+}
+
+// operators and the tables after it are indexed by character rather than
+// keyed in maps, as they are consulted for every operator in the input
+var operators = [256]token.TokenType{
+	'+': token.PLUS,
+	'-': token.MINUS,
+	'*': token.ASTERISK,
+	'/': token.SLASH,
+	'%': token.PERCENT,
+}
+
+var compoundAssign = [256]token.TokenType{
+	'+': token.PLUS_ASSIGN,
+	'-': token.MINUS_ASSIGN,
+	'*': token.ASTERISK_ASSIGN,
+	'/': token.SLASH_ASSIGN,
+	'%': token.PERCENT_ASSIGN,
+}
+
+// doubled are the operators spelled by repeating a character, with their
+// compound assignments
+var doubled = [256]token.TokenType{
+	'/': token.FLOOR,
+	'*': token.POWER,
+}
+
+var doubledAssign = [256]token.TokenType{
+	'/': token.FLOOR_ASSIGN,
+	'*': token.POWER_ASSIGN,
+}
+
+// comparisons are the two-character operators spelled with a trailing '='
+var comparisons = [256]token.TokenType{
+	'=': token.EQ,
+	'!': token.NOT_EQ,
+	'<': token.LE,
+	'>': token.GE,
+}
+
+func (l *Lexer) peekChar() byte {
+	if l.readPosition >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition]
+}
+
 func (l *Lexer) readChar() {
+	if l.readPosition >= len(l.input) && l.reader != nil {
+		l.fill()
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -51,65 +204,147 @@ func (l *Lexer) readChar() {
 			l.lineLength++
 		}
 	}
+}
 
-	// fmt.Printf("DEBUG readChar: char='%c', pos=%d, line=%d, col=%d, startOfLine=%v, lineLength=%d\n",
-	// 	l.ch, l.position, l.line, l.column, l.startOfLine, l.lineLength)
+// fill appends the reader's next line to the input, first dropping the text
+// before the current character that no token or trivia still needs. Lines
+// are read whole, so every look ahead to the end of the current line finds
+// it in the input.
+func (l *Lexer) fill() {
+	line, err := l.reader.ReadString('\n')
+	if err != nil {
+		l.reader = nil
+		if err != io.EOF {
+			l.err = err
+		}
+	}
+	keep := min(l.position, len(l.input))
+	if l.trivia {
+		keep = min(keep, l.triviaStart)
+	}
+	l.input = l.input[keep:] + line
+	l.position -= keep
+	l.readPosition -= keep
+	l.triviaStart = max(l.triviaStart-keep, 0)
+	l.tokenStart = max(l.tokenStart-keep, 0)
+}
+
+// skipTo moves to the character at end as repeated calls to readChar
+// would, but only reads that last character. The characters passed over
+// must not include a newline.
+func (l *Lexer) skipTo(end int) {
+	if end <= l.position {
+		return
+	}
+	n := end - 1 - l.position
+	l.column += n
+	if !l.startOfLine {
+		l.lineLength += n
+	}
+	l.readPosition = end
+	l.readChar()
 }
 
 func (l *Lexer) processToken() token.Token {
 	var tok token.Token
-	startColumn := l.column
+	start, startColumn := l.position, l.column
 
 	if isLetter(l.ch) {
-		// fmt.Printf("DEBUG processToken: Found letter '%c' at position %d\n", l.ch, l.position)
-		startPos := l.position
-		l.readChar()
-		for isLetter(l.ch) || isDigit(l.ch) {
-			// fmt.Printf("DEBUG processToken: Reading next char '%c' at position %d\n", l.ch, l.position)
-			l.readChar()
+		end := l.position + 1
+		for end < len(l.input) && (isLetter(l.input[end]) || isDigit(l.input[end])) {
+			end++
+		}
+		l.skipTo(end)
+		literal := l.input[start:l.position]
+		if literal == "f" && l.ch == '"' {
+			tok := l.readString()
+			if tok.Type == token.STRING {
+				tok.Type = token.FSTRING
+			}
+			tok.Column = startColumn
+			return tok
 		}
-		literal := l.input[startPos:l.position]
 		tokenType := token.LookupIdent(literal)
-		// fmt.Printf("DEBUG processToken: Formed identifier '%s' with type %s\n", literal, tokenType)
 		return token.Token{
 			Type:    tokenType,
 			Literal: literal,
 			Line:    l.line,
 			Column:  startColumn,
 		}
+	} else if l.ch == '0' && bases[l.peekChar()] != 0 {
+		return l.readBased(start, startColumn)
 	} else if isDigit(l.ch) {
 		literal := l.readNumber()
-		return token.Token{
-			Type:    token.INT,
-			Literal: literal,
-			Line:    l.line,
-			Column:  startColumn,
+		tokenType := token.TokenType(token.INT)
+		if l.ch == '.' {
+			// A fraction makes it a float; digits after the point are optional
+			l.readChar()
+			l.readNumber()
+			literal = l.input[start:l.position]
+			tokenType = token.FLOAT
 		}
+		return l.number(tokenType, literal, startColumn, 0, isDigit)
 	}
 
 	switch l.ch {
-	case '=':
-		tok = newToken(token.ASSIGN, l.ch, l.line, startColumn)
-	case '+':
-		tok = newToken(token.PLUS, l.ch, l.line, startColumn)
-	case '*':
-		tok = newToken(token.ASTERISK, l.ch, l.line, startColumn)
-	case '<':
-		tok = newToken(token.LT, l.ch, l.line, startColumn)
-	case '>':
-		tok = newToken(token.GT, l.ch, l.line, startColumn)
+	case '=', '!', '<', '>':
+		if l.peekChar() == '=' {
+			op := l.ch
+			l.readChar()
+			tok = l.newToken(comparisons[op], start, startColumn)
+			break
+		}
+		switch l.ch {
+		case '=':
+			tok = l.newToken(token.ASSIGN, start, startColumn)
+		case '<':
+			tok = l.newToken(token.LT, start, startColumn)
+		case '>':
+			tok = l.newToken(token.GT, start, startColumn)
+		default:
+			tok = token.Token{Type: token.ILLEGAL, Literal: "'!' is only an operator in '!='; use 'not' to negate", Line: l.line, Column: startColumn, EndColumn: startColumn + 1}
+		}
+	case '+', '-', '*', '/', '%':
+		if doubled[l.ch] != "" && l.peekChar() == l.ch {
+			op := l.ch
+			l.readChar()
+			if l.peekChar() == '=' {
+				l.readChar()
+				tok = l.newToken(doubledAssign[op], start, startColumn)
+				break
+			}
+			tok = l.newToken(doubled[op], start, startColumn)
+			break
+		}
+		if l.peekChar() == '=' {
+			op := l.ch
+			l.readChar()
+			tok = l.newToken(compoundAssign[op], start, startColumn)
+			break
+		}
+		tok = l.newToken(operators[l.ch], start, startColumn)
 	case '(':
-		tok = newToken(token.LPAREN, l.ch, l.line, startColumn)
+		tok = l.newToken(token.LPAREN, start, startColumn)
 	case ')':
-		tok = newToken(token.RPAREN, l.ch, l.line, startColumn)
+		tok = l.newToken(token.RPAREN, start, startColumn)
+	case '{':
+		tok = l.newToken(token.LBRACE, start, startColumn)
+	case '}':
+		tok = l.newToken(token.RBRACE, start, startColumn)
+	case '[':
+		tok = l.newToken(token.LBRACKET, start, startColumn)
+	case ']':
+		tok = l.newToken(token.RBRACKET, start, startColumn)
 	case ':':
-		tok = newToken(token.COLON, l.ch, l.line, startColumn)
+		tok = l.newToken(token.COLON, start, startColumn)
 	case ',':
-		tok = newToken(token.COMMA, l.ch, l.line, startColumn)
+		tok = l.newToken(token.COMMA, start, startColumn)
+	case '.':
+		tok = l.newToken(token.DOT, start, startColumn)
 	case '"':
-		return l.readString()
+		return unescapeToken(l.readString())
 	default:
-		tok = newToken(token.ILLEGAL, l.ch, l.line, startColumn)
+		tok = l.newToken(token.ILLEGAL, start, startColumn)
 	}
 
 	l.readChar()
@@ -117,42 +352,131 @@ func (l *Lexer) processToken() token.Token {
 }
 
 func (l *Lexer) NextToken() token.Token {
-	// fmt.Printf("\nDEBUG NextToken: BEFORE: line=%d, col=%d, char='%c', startOfLine=%v, lineLength=%d\n",
-	// 	l.line, l.column, l.ch, l.startOfLine, l.lineLength)
+	tok := l.next()
+	if l.trivia {
+		l.addTrivia(&tok)
+	}
+	if l.trace != nil {
+		l.trace.Printf("lex %d:%d %s %q", tok.Line, tok.Column, tok.Type, tok.Literal)
+	}
+	return tok
+}
+
+// addTrivia fills in the trivia around tok, which next just returned.
+// A blank line's NEWLINE is trivia itself and joins the leading text of
+// the next token, as do comment-only lines.
+func (l *Lexer) addTrivia(tok *token.Token) {
+	switch tok.Type {
+	case token.INDENT, token.DEDENT, token.COMMENT, token.PRAGMA:
+		return
+	case token.NEWLINE:
+		if l.lineHasToken {
+			l.triviaStart = min(l.position, len(l.input))
+			l.lineHasToken = false
+		}
+		return
+	case token.EOF:
+		tok.Leading = l.input[l.triviaStart:]
+		l.triviaStart = len(l.input)
+		return
+	}
+	l.lineHasToken = true
+	tok.Leading = l.input[l.triviaStart:l.tokenStart]
+	end := min(l.position, len(l.input))
+	i := end
+	for i < len(l.input) && (l.input[i] == ' ' || l.input[i] == '\t') {
+		i++
+	}
+	if i < len(l.input) && l.input[i] == '#' {
+		if n := strings.IndexByte(l.input[i:], '\n'); n >= 0 {
+			i += n
+		} else {
+			i = len(l.input)
+		}
+	}
+	if i == len(l.input) || l.input[i] == '\n' {
+		tok.Trailing = strings.TrimRight(l.input[end:i], "\r")
+		end += len(tok.Trailing)
+	}
+	l.triviaStart = end
+}
+
+func (l *Lexer) next() token.Token {
+	// An error found before a token starts, such as indentation with
+	// spaces, is a token of its own for trivia
+	l.tokenStart = l.position
+
+	// A line that closes several blocks at once owes one DEDENT per block
+	if l.dedents > 0 {
+		l.dedents--
+		return token.Token{Type: token.DEDENT, Literal: "", Line: l.line, Column: 1}
+	}
+
+	// Inside brackets a newline only separates tokens, here and after a
+	// comment below
+	if l.ch == '\n' && l.brackets > 0 {
+		return l.continueLine()
+	}
 
 	// Handle start of new line
+	// A line holding only a comment is skipped whole, however it is
+	// indented, so it neither opens nor closes a block
+	for l.startOfLine && l.commentOnly() {
+		l.column = 1
+		for l.ch == ' ' || l.ch == '\t' {
+			l.readChar()
+		}
+		tok, ok := l.readComment()
+		if l.ch == '\n' {
+			l.readChar()
+			l.line++
+			l.lineLength = 0
+		}
+		if ok {
+			return tok
+		}
+	}
+
 	if l.startOfLine {
 		l.column = 1
 		indentLevel := 0
 
-		// First check for spaces at start of line - this is an error
-		if l.ch == ' ' {
-			return token.Token{
-				Type:    token.ILLEGAL,
-				Literal: "spaces for indentation not allowed, use tabs",
-				Line:    l.line,
-				Column:  l.column,
+		// A blank line may hold spaces and tabs, which are not indentation
+		if l.blankLine() {
+			for l.ch == ' ' || l.ch == '\t' {
+				l.readChar()
 			}
 		}
 
-		// Count tab-based indentation
-		for l.ch == '\t' {
-			indentLevel++
+		// Count indentation in the unit, which the first indented line
+		// sets unless it was given
+		if tok, ok := l.checkIndent(); !ok {
+			return tok
+		}
+		width := 0
+		for l.ch == ' ' || l.ch == '\t' {
+			width++
 			l.readChar()
 		}
+		if l.indent > 0 {
+			indentLevel = width / int(l.indent)
+		} else {
+			indentLevel = width
+		}
 
 		// If we're at a newline or EOF, this is an empty line
 		if l.ch == '\n' || l.ch == 0 {
 			l.startOfLine = true
 		} else {
 			l.startOfLine = false
-			l.column = indentLevel + 1 // Position after tabs
-			l.lineLength = l.column    // Start counting from current position
+			l.column = width + 1    // Position after the indentation
+			l.lineLength = l.column // Start counting from current position
 		}
 
 		// Check if we need to emit DEDENT tokens
 		if indentLevel < len(l.indentStack)-1 && l.ch != '\n' {
-			l.indentStack = l.indentStack[:len(l.indentStack)-1]
+			l.dedents = len(l.indentStack) - 2 - indentLevel
+			l.indentStack = l.indentStack[:indentLevel+1]
 			return token.Token{
 				Type:    token.DEDENT,
 				Literal: "",
@@ -162,7 +486,7 @@ func (l *Lexer) NextToken() token.Token {
 		}
 
 		// Check if we need to emit INDENT token
-		if indentLevel > len(l.indentStack)-1 {
+		if indentLevel > len(l.indentStack)-1 && l.ch != '\n' {
 			l.indentStack = append(l.indentStack, indentLevel)
 			return token.Token{
 				Type:    token.INDENT,
@@ -176,18 +500,27 @@ func (l *Lexer) NextToken() token.Token {
 	// Reject carriage returns anywhere in the file
 	if l.ch == '\r' {
 		return token.Token{
-			Type:    token.ILLEGAL,
-			Literal: "Windows line endings (\\r\\n) not allowed, use Unix style (\\n)",
-			Line:    l.line,
-			Column:  l.column,
+			Type:      token.ILLEGAL,
+			Literal:   "Windows line endings (\\r\\n) not allowed, use Unix style (\\n)",
+			Line:      l.line,
+			Column:    l.column,
+			EndColumn: l.column + 1,
 		}
 	}
 
 	// Skip whitespace but preserve startOfLine state
 	l.skipWhitespace()
 
+	if l.ch == '#' {
+		if tok, ok := l.readComment(); ok {
+			return tok
+		}
+		if l.ch == '\n' && l.brackets > 0 {
+			return l.continueLine()
+		}
+	}
+
 	if l.ch == 0 {
-		// fmt.Printf("DEBUG NextToken: EOF detected\n")
 		return token.Token{
 			Type:    token.EOF,
 			Literal: "",
@@ -196,10 +529,22 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	}
 
+	// A backslash at the end of a line joins the next line to it
+	if l.ch == '\\' && l.peekChar() == '\n' {
+		l.readChar()
+		return l.continueLine()
+	}
+
 	// Now we can check if we have a newline or actual content
 	if l.ch == '\n' {
-		// fmt.Printf("DEBUG Newline: Found newline char at line=%d, col=%d, startOfLine=%v\n",
-		// 	l.line, l.column, l.startOfLine)
+		// The blank lines between a block's header and its first
+		// statement are dropped, so INDENT still follows the header's
+		// NEWLINE
+		if l.expectIndent && l.lineLength == 0 {
+			l.readChar()
+			l.line++
+			return l.next()
+		}
 
 		// For newlines, use the line length as the column
 		tok := token.Token{
@@ -212,51 +557,313 @@ func (l *Lexer) NextToken() token.Token {
 		l.line++
 		l.startOfLine = true
 		l.lineLength = 0 // Reset line length for new line
-		// fmt.Printf("DEBUG Newline: Created token at line=%d, col=%d, next line will be %d\n",
-		// 	tok.Line, tok.Column, l.line)
 		return tok
 	}
 
 	// If we get here, we have actual content
+	l.tokenStart = l.position
 	tok := l.processToken()
-	// fmt.Printf("DEBUG NextToken: Generated token: Type=%s, Literal='%s', Line=%d, Col=%d\n",
-	// 	tok.Type, tok.Literal, tok.Line, tok.Column)
 
-	if tok.Type == token.COLON {
-		l.expectIndent = true
+	l.expectIndent = tok.Type == token.COLON
+	switch tok.Type {
+	case token.LPAREN, token.LBRACKET, token.LBRACE:
+		l.brackets++
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		l.brackets = max(l.brackets-1, 0)
 	}
 	return tok
 }
 
+// checkIndent reports whether the indentation at the start of the current
+// line is written in the unit, taking the unit from it if none is set yet.
+// When it is not, the ILLEGAL token says why.
+func (l *Lexer) checkIndent() (token.Token, bool) {
+	rest := l.input[l.position:]
+	width := len(rest) - len(strings.TrimLeft(rest, " \t"))
+	if width == 0 {
+		return token.Token{}, true
+	}
+	lead := rest[:width]
+	illegal := func(format string, args ...interface{}) (token.Token, bool) {
+		return token.Token{
+			Type:      token.ILLEGAL,
+			Literal:   fmt.Sprintf(format, args...),
+			Line:      l.line,
+			Column:    l.column,
+			EndColumn: l.column + width,
+		}, false
+	}
+	spaces := strings.Count(lead, " ")
+	if spaces != 0 && spaces != width {
+		return illegal("indentation mixes tabs and spaces")
+	}
+	if l.indent == AutoIndent {
+		l.indent, l.indentLine = TabIndent, l.line
+		if spaces > 0 {
+			l.indent = SpaceIndent(width)
+		}
+	}
+	switch {
+	case l.indent == TabIndent && spaces > 0:
+		if l.indentLine > 0 {
+			return illegal("indented with spaces, but line %d is indented with tabs", l.indentLine)
+		}
+		return illegal("spaces for indentation not allowed, use tabs")
+	case l.indent > 0 && spaces == 0:
+		if l.indentLine > 0 {
+			return illegal("indented with tabs, but line %d is indented with spaces", l.indentLine)
+		}
+		return illegal("tabs for indentation not allowed, use %d spaces", l.indent)
+	case l.indent > 0 && spaces%int(l.indent) != 0:
+		return illegal("indentation of %d spaces is not a multiple of %d", spaces, l.indent)
+	}
+	return token.Token{}, true
+}
+
+// continueLine moves past the newline under the current character without
+// ending the logical line, so the next line's leading whitespace is not
+// indentation and no NEWLINE separates the tokens either side
+func (l *Lexer) continueLine() token.Token {
+	l.readChar()
+	l.line++
+	l.startOfLine = false
+	l.lineLength = l.column
+	if l.lineHasToken {
+		// As after a NEWLINE, what follows belongs to the next token
+		l.triviaStart = max(l.triviaStart, l.position)
+		l.lineHasToken = false
+	}
+	return l.next()
+}
+
 func (l *Lexer) readString() token.Token {
 	startCol := l.column // Save the column of the opening quote
 	position := l.position + 1
+	end := position
 	for {
-		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
+		i := strings.IndexAny(l.input[end:], "\"\n\\")
+		if i < 0 {
+			end = len(l.input)
+			break
+		}
+		end += i
+		if l.input[end] != '\\' {
 			break
 		}
+		// An escaped character never ends the string, but a line still does
+		end++
+		if end == len(l.input) || l.input[end] == '\n' {
+			break
+		}
+		end++
+	}
+	l.skipTo(end)
+	if l.ch != '"' {
+		// Leave the newline for the next token so lexing resumes cleanly
+		return token.Token{
+			Type:      token.ILLEGAL,
+			Literal:   "unterminated string literal; add a closing '\"' before the end of the line",
+			Line:      l.line,
+			Column:    startCol,
+			EndColumn: startCol + 1 + l.position - position,
+		}
 	}
 
 	str := l.input[position:l.position]
 	tok := token.Token{
-		Type:    token.STRING,
-		Literal: str,
-		Line:    l.line,
-		Column:  startCol, // Use the saved column
+		Type:      token.STRING,
+		Literal:   str,
+		Line:      l.line,
+		Column:    startCol, // Use the saved column
+		EndColumn: l.column + 1,
 	}
 	l.readChar() // consume closing quote
 	return tok
 }
 
+// unescapeToken replaces the escape sequences in a string token, or makes
+// it ILLEGAL if one is unknown
+func unescapeToken(tok token.Token) token.Token {
+	if tok.Type != token.STRING {
+		return tok
+	}
+	value, err := Unescape(tok.Literal)
+	if err != nil {
+		tok.Type, tok.Literal = token.ILLEGAL, err.Error()
+		return tok
+	}
+	tok.Literal = value
+	return tok
+}
+
+// Unescape replaces \n, \t, \\ and \" in the body of a string literal with
+// the characters they stand for
+func Unescape(s string) (string, error) {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s, nil
+	}
+	var out strings.Builder
+	out.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("a single '\\' cannot end the text; write '\\\\' for a backslash")
+		}
+		switch s[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case '\\', '"':
+			out.WriteByte(s[i])
+		default:
+			return "", fmt.Errorf("unknown escape sequence '\\%c'; write '\\\\' for a backslash", s[i])
+		}
+	}
+	return out.String(), nil
+}
+
+// readComment moves past a comment to the end of its line. A
+// "# pragma: word" directive becomes a PRAGMA token, and any other comment
+// a COMMENT token when comments are kept; otherwise it reports false.
+func (l *Lexer) readComment() (token.Token, bool) {
+	start, column := l.position, l.column
+	end := strings.IndexByte(l.input[start:], '\n')
+	if end < 0 {
+		end = len(l.input) - start
+	}
+	end += start
+	text := strings.TrimRight(l.input[start:end], "\r")
+	l.skipTo(start + len(text))
+
+	if word, ok := strings.CutPrefix(strings.TrimSpace(text[1:]), "pragma:"); ok {
+		return token.Token{Type: token.PRAGMA, Literal: strings.TrimSpace(word), Line: l.line, Column: column}, true
+	}
+	if l.comments {
+		return token.Token{Type: token.COMMENT, Literal: text, Line: l.line, Column: column}, true
+	}
+	return token.Token{}, false
+}
+
+// commentOnly reports whether the line starting at the current character
+// holds nothing but a comment
+func (l *Lexer) commentOnly() bool {
+	i := l.position
+	for i < len(l.input) && (l.input[i] == ' ' || l.input[i] == '\t') {
+		i++
+	}
+	return i < len(l.input) && l.input[i] == '#'
+}
+
+// blankLine reports whether the line starting at the current character
+// holds nothing but spaces and tabs
+func (l *Lexer) blankLine() bool {
+	i := l.position
+	for i < len(l.input) && (l.input[i] == ' ' || l.input[i] == '\t') {
+		i++
+	}
+	return i == len(l.input) || l.input[i] == '\n'
+}
+
+// readNumber reads a run of digits, which underscores may group as in
+// 1_000_000; number checks where the underscores are
 func (l *Lexer) readNumber() string {
 	position := l.position
-	for isDigit(l.ch) {
-		l.readChar()
+	end := position
+	for end < len(l.input) && (isDigit(l.input[end]) || l.input[end] == '_') {
+		end++
 	}
+	l.skipTo(end)
 	return l.input[position:l.position]
 }
 
+// bases maps the letter of a 0x, 0o or 0b prefix to the base it selects
+var bases = [256]int{'x': 16, 'X': 16, 'o': 8, 'O': 8, 'b': 2, 'B': 2}
+
+var baseNames = map[int]string{16: "hexadecimal", 8: "octal", 2: "binary"}
+
+// readBased reads an integer literal written with a base prefix, such as
+// 0x1F. The literal keeps the prefix; the parser converts it. A literal
+// with no digits, or one not valid in its base, is ILLEGAL, positioned at
+// the offending digit. As in Python, an underscore may follow the prefix.
+func (l *Lexer) readBased(start, column int) token.Token {
+	base := bases[l.peekChar()]
+	end := l.position + 2
+	for end < len(l.input) && (isLetter(l.input[end]) || isDigit(l.input[end])) {
+		end++
+	}
+	l.skipTo(end)
+	literal := l.input[start:l.position]
+	if len(literal) == 2 {
+		return l.illegalAt(column, 2, "%s literal %s has no digits", baseNames[base], literal)
+	}
+	tok := l.number(token.INT, literal, column, 2, func(ch byte) bool { return digitValue(ch) < 16 })
+	if tok.Type == token.ILLEGAL {
+		return tok
+	}
+	for i := 2; i < len(literal); i++ {
+		if literal[i] != '_' && digitValue(literal[i]) >= base {
+			return l.illegalAt(column+i, 1, "invalid digit '%c' in %s literal %s", literal[i], baseNames[base], literal)
+		}
+	}
+	return tok
+}
+
+// number makes the token for a numeric literal whose digits start at from,
+// dropping the underscores that group them. An underscore that does not
+// come between two digits, or after a base prefix, is ILLEGAL.
+func (l *Lexer) number(tokenType token.TokenType, literal string, column, from int, digit func(byte) bool) token.Token {
+	for i := from; i < len(literal); i++ {
+		if literal[i] != '_' {
+			continue
+		}
+		switch {
+		case i+1 < len(literal) && literal[i+1] == '_':
+			return l.illegalAt(column+i+1, 1, "consecutive underscores in numeric literal %s", literal)
+		case i+1 == len(literal) || !digit(literal[i+1]):
+			return l.illegalAt(column+i, 1, "trailing underscore in numeric literal %s", literal)
+		case i > from && !digit(literal[i-1]):
+			return l.illegalAt(column+i, 1, "leading underscore after '%c' in numeric literal %s", literal[i-1], literal)
+		}
+	}
+	tok := token.Token{Type: tokenType, Literal: literal, Line: l.line, Column: column}
+	if strings.Contains(literal, "_") {
+		tok.Literal = strings.ReplaceAll(literal, "_", "")
+		tok.EndColumn = column + len(literal)
+	}
+	return tok
+}
+
+// illegalAt makes an ILLEGAL token explaining a problem with the width
+// characters at column of the current line
+func (l *Lexer) illegalAt(column, width int, format string, args ...interface{}) token.Token {
+	return token.Token{
+		Type:      token.ILLEGAL,
+		Literal:   fmt.Sprintf(format, args...),
+		Line:      l.line,
+		Column:    column,
+		EndColumn: column + width,
+	}
+}
+
+// digitValue is the value of ch as a digit in bases up to 16, or 16 if it
+// is not one
+func digitValue(ch byte) int {
+	switch {
+	case isDigit(ch):
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		return int(ch-'A') + 10
+	}
+	return 16
+}
+
 func (l *Lexer) skipWhitespace() {
 	// Skip spaces but preserve tabs at start of line
 	if !l.startOfLine {
@@ -274,11 +881,14 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte, line, column int) token.Token {
+// newToken makes a token whose literal runs from start through the current
+// character. The literal is sliced from the input rather than built, so
+// operators cost no allocation.
+func (l *Lexer) newToken(tokenType token.TokenType, start, column int) token.Token {
 	return token.Token{
 		Type:    tokenType,
-		Literal: string(ch),
-		Line:    line,
+		Literal: l.input[start : l.position+1],
+		Line:    l.line,
 		Column:  column,
 	}
 }
@@ -1,8 +1,13 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/arifali123/152compiler/packages/token"
 )
@@ -300,6 +305,162 @@ func TestIllegalToken(t *testing.T) {
 	}
 }
 
+func TestMinus(t *testing.T) {
+	input := "x = 5 - -3"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.MINUS, "-"},
+		{token.MINUS, "-"},
+		{token.INT, "3"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestCompoundAssign(t *testing.T) {
+	input := "x += 1\ny -= -2\nz *= 3\nq /= 4 % 5\nr %= 6 // 7 ** 8\ns //= 9\nt **= 10"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.NEWLINE, "\n"},
+		{token.IDENT, "y"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.MINUS, "-"},
+		{token.INT, "2"},
+		{token.NEWLINE, "\n"},
+		{token.IDENT, "z"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.NEWLINE, "\n"},
+		{token.IDENT, "q"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.PERCENT, "%"},
+		{token.INT, "5"},
+		{token.NEWLINE, "\n"},
+		{token.IDENT, "r"},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.INT, "6"},
+		{token.FLOOR, "//"},
+		{token.INT, "7"},
+		{token.POWER, "**"},
+		{token.INT, "8"},
+		{token.NEWLINE, "\n"},
+		{token.IDENT, "s"},
+		{token.FLOOR_ASSIGN, "//="},
+		{token.INT, "9"},
+		{token.NEWLINE, "\n"},
+		{token.IDENT, "t"},
+		{token.POWER_ASSIGN, "**="},
+		{token.INT, "10"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestComparisonOperators(t *testing.T) {
+	input := "a == b != c <= d >= e < f > g = h !i"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.EQ, "=="},
+		{token.IDENT, "b"},
+		{token.NOT_EQ, "!="},
+		{token.IDENT, "c"},
+		{token.LE, "<="},
+		{token.IDENT, "d"},
+		{token.GE, ">="},
+		{token.IDENT, "e"},
+		{token.LT, "<"},
+		{token.IDENT, "f"},
+		{token.GT, ">"},
+		{token.IDENT, "g"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "h"},
+		{token.ILLEGAL, "'!' is only an operator in '!='; use 'not' to negate"},
+		{token.IDENT, "i"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestForAndNestedDedent(t *testing.T) {
+	input := "for i in range(2):\n\tif i:\n\t\tx\ny\n"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FOR, "for"},
+		{token.IDENT, "i"},
+		{token.IN, "in"},
+		{token.IDENT, "range"},
+		{token.LPAREN, "("},
+		{token.INT, "2"},
+		{token.RPAREN, ")"},
+		{token.COLON, ":"},
+		{token.NEWLINE, "\n"},
+		{token.INDENT, "\t"},
+		{token.IF, "if"},
+		{token.IDENT, "i"},
+		{token.COLON, ":"},
+		{token.NEWLINE, "\n"},
+		{token.INDENT, "\t"},
+		{token.IDENT, "x"},
+		{token.NEWLINE, "\n"},
+		{token.DEDENT, ""},
+		{token.DEDENT, ""},
+		{token.IDENT, "y"},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
 func TestWhitespaceAtStartOfLine(t *testing.T) {
 	// Test tab indentation
 	input := "\tfirst" // Tab indentation
@@ -343,29 +504,31 @@ func TestWhitespaceAtStartOfLine(t *testing.T) {
 }
 
 func TestRejectMixedIndentation(t *testing.T) {
-	// Test that any space-based indentation is rejected
+	// Test that indentation switching from spaces to tabs is rejected
 	input := "if x > 0:\n    y = 1\n\tz = 2" // First indent with spaces
 	l := New(input)
 
-	// Skip the first line tokens
-	for tok := l.NextToken(); tok.Type != token.NEWLINE; tok = l.NextToken() {
-		// Skip 'if x > 0:'
+	// Skip the first two lines
+	for newlines := 0; newlines < 2; {
+		if l.NextToken().Type == token.NEWLINE {
+			newlines++
+		}
 	}
 
-	// The space indentation should be rejected immediately
+	// The tab indentation should be rejected
 	tok := l.NextToken()
 	if tok.Type != token.ILLEGAL {
-		t.Fatalf("expected ILLEGAL token for space indentation, got %q", tok.Type)
+		t.Fatalf("expected ILLEGAL token for tab indentation, got %q", tok.Type)
 	}
-	if tok.Literal != "spaces for indentation not allowed, use tabs" {
-		t.Fatalf("expected error message about spaces not allowed, got %q", tok.Literal)
+	if tok.Literal != "indented with tabs, but line 2 is indented with spaces" {
+		t.Fatalf("expected error message about mixed indentation, got %q", tok.Literal)
 	}
 }
 
 func TestRejectSpaceIndentation(t *testing.T) {
-	// Test that spaces are rejected for indentation
+	// Test that spaces are rejected for indentation when tabs are asked for
 	input := "if x > 0:\n    y = 1" // Using spaces for indentation
-	l := New(input)
+	l := New(input).Indent(TabIndent)
 
 	// Skip the first line tokens
 	for tok := l.NextToken(); tok.Type != token.NEWLINE; tok = l.NextToken() {
@@ -382,6 +545,58 @@ func TestRejectSpaceIndentation(t *testing.T) {
 	}
 }
 
+func TestIndentation(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		indent Indentation
+		tokens []token.TokenType // the tokens of the last line, from its indentation
+		err    string            // the ILLEGAL token's literal, if the last line has one
+	}{
+		{"four spaces", "if x:\n    if y:\n        z = 1", AutoIndent,
+			[]token.TokenType{token.INDENT, token.IDENT, token.ASSIGN, token.INT}, ""},
+		{"two spaces", "if x:\n  y = 1\nz = 2", AutoIndent,
+			[]token.TokenType{token.DEDENT, token.IDENT, token.ASSIGN, token.INT}, ""},
+		{"tabs", "if x:\n\tif y:\n\t\tz = 1", AutoIndent,
+			[]token.TokenType{token.INDENT, token.IDENT, token.ASSIGN, token.INT}, ""},
+		{"first indented line sets the unit", "if x:\n\ty = 1\nif z:\n    w = 2", AutoIndent,
+			nil, "indented with spaces, but line 2 is indented with tabs"},
+		{"mixed on one line", "if x:\n\t  y = 1", AutoIndent,
+			nil, "indentation mixes tabs and spaces"},
+		{"not a whole level", "if x:\n    if y:\n      z = 1", AutoIndent,
+			nil, "indentation of 6 spaces is not a multiple of 4"},
+		{"spaces given", "if x:\n  y = 1", SpaceIndent(2),
+			[]token.TokenType{token.INDENT, token.IDENT, token.ASSIGN, token.INT}, ""},
+		{"spaces given, tabs used", "if x:\n\ty = 1", SpaceIndent(4),
+			nil, "tabs for indentation not allowed, use 4 spaces"},
+		{"spaces given, other width used", "if x:\n  y = 1", SpaceIndent(4),
+			nil, "indentation of 2 spaces is not a multiple of 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.input).Indent(tt.indent)
+			lines := strings.Count(tt.input, "\n")
+			for newlines := 0; newlines < lines; {
+				if l.NextToken().Type == token.NEWLINE {
+					newlines++
+				}
+			}
+			if tt.err != "" {
+				tok := l.NextToken()
+				if tok.Type != token.ILLEGAL || tok.Literal != tt.err {
+					t.Fatalf("expected ILLEGAL %q, got %s %q", tt.err, tok.Type, tok.Literal)
+				}
+				return
+			}
+			for _, want := range tt.tokens {
+				if tok := l.NextToken(); tok.Type != want {
+					t.Fatalf("expected %s, got %s %q", want, tok.Type, tok.Literal)
+				}
+			}
+		})
+	}
+}
+
 func TestRejectWindowsLineEndings(t *testing.T) {
 	// Test that Windows-style line endings (\r\n) are rejected
 	input := "x = 5\r\n" // Using Windows line ending
@@ -401,3 +616,558 @@ func TestRejectWindowsLineEndings(t *testing.T) {
 		t.Fatalf("expected error message about Windows line endings, got %q", tok.Literal)
 	}
 }
+
+func TestUnterminatedString(t *testing.T) {
+	l := New("x = \"abc\ny\n")
+	want := []token.TokenType{token.IDENT, token.ASSIGN, token.ILLEGAL, token.NEWLINE, token.IDENT}
+	for i, typ := range want {
+		if tok := l.NextToken(); tok.Type != typ {
+			t.Fatalf("tests[%d] - wrong token type. expected=%q, got=%q (%q)", i, typ, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestFString(t *testing.T) {
+	input := "print(f\"x is {x}\")\nf = f + 1\ny = f\"open\n"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.PRINT, "print", 1},
+		{token.LPAREN, "(", 6},
+		{token.FSTRING, "x is {x}", 7},
+		{token.RPAREN, ")", 18},
+		{token.NEWLINE, "\n", 19},
+		{token.IDENT, "f", 1},
+		{token.ASSIGN, "=", 3},
+		{token.IDENT, "f", 5},
+		{token.PLUS, "+", 7},
+		{token.INT, "1", 9},
+		{token.NEWLINE, "\n", 10},
+		{token.IDENT, "y", 1},
+		{token.ASSIGN, "=", 3},
+		{token.ILLEGAL, "unterminated string literal; add a closing '\"' before the end of the line", 5},
+		{token.NEWLINE, "\n", 11},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q at %d, got=%q %q at %d",
+				i, tt.expectedType, tt.expectedLiteral, tt.expectedColumn, tok.Type, tok.Literal, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "x = 1 # one\nif x:\n\t# inside\n# outdented\n  # spaced\n\ty = 2\n# last"
+	tests := []struct {
+		name     string
+		lexer    *Lexer
+		expected []token.Token
+	}{
+		{"skipped", New(input), []token.Token{
+			{Type: token.IDENT, Literal: "x", Line: 1, Column: 1},
+			{Type: token.ASSIGN, Literal: "=", Line: 1, Column: 3},
+			{Type: token.INT, Literal: "1", Line: 1, Column: 5},
+			{Type: token.NEWLINE, Literal: "\n", Line: 1, Column: 12},
+			{Type: token.IF, Literal: "if", Line: 2, Column: 1},
+			{Type: token.IDENT, Literal: "x", Line: 2, Column: 4},
+			{Type: token.COLON, Literal: ":", Line: 2, Column: 5},
+			{Type: token.NEWLINE, Literal: "\n", Line: 2, Column: 6},
+			{Type: token.INDENT, Literal: "\t", Line: 6, Column: 1},
+			{Type: token.IDENT, Literal: "y", Line: 6, Column: 2},
+			{Type: token.ASSIGN, Literal: "=", Line: 6, Column: 4},
+			{Type: token.INT, Literal: "2", Line: 6, Column: 6},
+			{Type: token.NEWLINE, Literal: "\n", Line: 6, Column: 7},
+			{Type: token.DEDENT, Literal: "", Line: 7, Column: 1},
+			{Type: token.EOF, Literal: "", Line: 7, Column: 1},
+		}},
+		{"kept", New(input).KeepComments(), []token.Token{
+			{Type: token.IDENT, Literal: "x", Line: 1, Column: 1},
+			{Type: token.ASSIGN, Literal: "=", Line: 1, Column: 3},
+			{Type: token.INT, Literal: "1", Line: 1, Column: 5},
+			{Type: token.COMMENT, Literal: "# one", Line: 1, Column: 7},
+			{Type: token.NEWLINE, Literal: "\n", Line: 1, Column: 12},
+			{Type: token.IF, Literal: "if", Line: 2, Column: 1},
+			{Type: token.IDENT, Literal: "x", Line: 2, Column: 4},
+			{Type: token.COLON, Literal: ":", Line: 2, Column: 5},
+			{Type: token.NEWLINE, Literal: "\n", Line: 2, Column: 6},
+			{Type: token.COMMENT, Literal: "# inside", Line: 3, Column: 2},
+			{Type: token.COMMENT, Literal: "# outdented", Line: 4, Column: 1},
+			{Type: token.COMMENT, Literal: "# spaced", Line: 5, Column: 3},
+			{Type: token.INDENT, Literal: "\t", Line: 6, Column: 1},
+			{Type: token.IDENT, Literal: "y", Line: 6, Column: 2},
+			{Type: token.ASSIGN, Literal: "=", Line: 6, Column: 4},
+			{Type: token.INT, Literal: "2", Line: 6, Column: 6},
+			{Type: token.NEWLINE, Literal: "\n", Line: 6, Column: 7},
+			{Type: token.COMMENT, Literal: "# last", Line: 7, Column: 1},
+			{Type: token.DEDENT, Literal: "", Line: 7, Column: 1},
+			{Type: token.EOF, Literal: "", Line: 7, Column: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.expected {
+				if tok := tt.lexer.NextToken(); tok != want {
+					t.Fatalf("tests[%d] - wrong token. expected=%+v, got=%+v", i, want, tok)
+				}
+			}
+		})
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	input := "# head\n\nx = 1  # one\nif x:\n\n\t# in\n\tprint(x)\n# tail\n"
+	expected := []token.Token{
+		{Type: token.NEWLINE, Literal: "\n", Line: 2, Column: 1},
+		{Type: token.IDENT, Literal: "x", Line: 3, Column: 1, Leading: "# head\n\n"},
+		{Type: token.ASSIGN, Literal: "=", Line: 3, Column: 3, Leading: " "},
+		{Type: token.INT, Literal: "1", Line: 3, Column: 5, Leading: " ", Trailing: "  # one"},
+		{Type: token.NEWLINE, Literal: "\n", Line: 3, Column: 13},
+		{Type: token.IF, Literal: "if", Line: 4, Column: 1},
+		{Type: token.IDENT, Literal: "x", Line: 4, Column: 4, Leading: " "},
+		{Type: token.COLON, Literal: ":", Line: 4, Column: 5},
+		{Type: token.NEWLINE, Literal: "\n", Line: 4, Column: 6},
+		{Type: token.INDENT, Literal: "\t", Line: 7, Column: 1},
+		{Type: token.PRINT, Literal: "print", Line: 7, Column: 2, Leading: "\n\t# in\n\t"},
+		{Type: token.LPAREN, Literal: "(", Line: 7, Column: 7},
+		{Type: token.IDENT, Literal: "x", Line: 7, Column: 8},
+		{Type: token.RPAREN, Literal: ")", Line: 7, Column: 9},
+		{Type: token.NEWLINE, Literal: "\n", Line: 7, Column: 10},
+		{Type: token.DEDENT, Literal: "", Line: 9, Column: 1},
+		{Type: token.EOF, Literal: "", Line: 9, Column: 1, Leading: "# tail\n"},
+	}
+	l := New(input).KeepTrivia()
+	for i, want := range expected {
+		if tok := l.NextToken(); tok != want {
+			t.Fatalf("tests[%d] - wrong token. expected=%+v, got=%+v", i, want, tok)
+		}
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected token.Token
+	}{
+		{`"a\nb"`, token.Token{Type: token.STRING, Literal: "a\nb", Line: 1, Column: 1, EndColumn: 7}},
+		{`"\t\\\""`, token.Token{Type: token.STRING, Literal: "\t\\\"", Line: 1, Column: 1, EndColumn: 9}},
+		{`"say \"hi\"" x`, token.Token{Type: token.STRING, Literal: `say "hi"`, Line: 1, Column: 1, EndColumn: 13}},
+		{`f"{x}\n"`, token.Token{Type: token.FSTRING, Literal: `{x}\n`, Line: 1, Column: 1, EndColumn: 9}},
+		{`"a\q"`, token.Token{Type: token.ILLEGAL, Literal: "unknown escape sequence '\\q'; write '\\\\' for a backslash", Line: 1, Column: 1, EndColumn: 6}},
+		{"\"a\\\nb\"", token.Token{Type: token.ILLEGAL, Literal: "unterminated string literal; add a closing '\"' before the end of the line", Line: 1, Column: 1, EndColumn: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if tok := New(tt.input).NextToken(); tok != tt.expected {
+				t.Errorf("wrong token. expected=%+v, got=%+v", tt.expected, tok)
+			}
+		})
+	}
+}
+
+func TestNewAt(t *testing.T) {
+	l := NewAt("  a + 12", 4, 10)
+	want := []token.Token{
+		{Type: token.IDENT, Literal: "a", Line: 4, Column: 12},
+		{Type: token.PLUS, Literal: "+", Line: 4, Column: 14},
+		{Type: token.INT, Literal: "12", Line: 4, Column: 16},
+		{Type: token.EOF, Literal: "", Line: 4, Column: 18},
+	}
+	for i, tt := range want {
+		if tok := l.NextToken(); tok != tt {
+			t.Fatalf("tests[%d] - wrong token. expected=%+v, got=%+v", i, tt, tok)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	s := Record(New("x = 1\n"))
+	want := []token.TokenType{token.IDENT, token.ASSIGN, token.INT, token.NEWLINE, token.EOF}
+	if got := s.Tokens(); len(got) != len(want) {
+		t.Fatalf("recorded %d tokens, expected %d: %v", len(got), len(want), got)
+	}
+
+	read := func(n int) []token.TokenType {
+		var types []token.TokenType
+		for i := 0; i < n; i++ {
+			types = append(types, s.NextToken().Type)
+		}
+		return types
+	}
+	tests := []struct {
+		name     string
+		move     func()
+		n        int
+		expected []token.TokenType
+	}{
+		{"from the start", func() {}, 2, want[:2]},
+		{"seek back", func() { s.Seek(1) }, 2, want[1:3]},
+		{"past the end repeats EOF", func() { s.Seek(4) }, 3, []token.TokenType{token.EOF, token.EOF, token.EOF}},
+		{"reset", s.Reset, 1, want[:1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.move()
+			got := read(tt.n)
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("wrong tokens. expected=%v, got=%v", tt.expected, got)
+				}
+			}
+		})
+	}
+
+	stuck := Record(New("if x:\n\ty = 1\n  z = 2\n"))
+	if last := stuck.Tokens()[len(stuck.Tokens())-1]; last.Type != token.ILLEGAL {
+		t.Errorf("recording should stop at a repeated ILLEGAL token, ended with %v", last)
+	}
+}
+
+func TestFloat(t *testing.T) {
+	input := "x = 1.5 + 2. * 30\ny = 0.25"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.FLOAT, "1.5"},
+		{token.PLUS, "+"},
+		{token.FLOAT, "2."},
+		{token.ASTERISK, "*"},
+		{token.INT, "30"},
+		{token.NEWLINE, "\n"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "="},
+		{token.FLOAT, "0.25"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestBasedIntegers(t *testing.T) {
+	tests := []struct {
+		input     string
+		tokenType token.TokenType
+		literal   string
+		column    int
+	}{
+		{"x = 0x1F", token.INT, "0x1F", 5},
+		{"x = 0XfF", token.INT, "0XfF", 5},
+		{"x = 0o17", token.INT, "0o17", 5},
+		{"x = 0b1010", token.INT, "0b1010", 5},
+		{"x = 0x", token.ILLEGAL, "hexadecimal literal 0x has no digits", 5},
+		{"x = 0b102", token.ILLEGAL, "invalid digit '2' in binary literal 0b102", 9},
+		{"x = 0o8", token.ILLEGAL, "invalid digit '8' in octal literal 0o8", 7},
+		{"x = 0x1G", token.ILLEGAL, "invalid digit 'G' in hexadecimal literal 0x1G", 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := New(tt.input)
+			l.NextToken() // x
+			l.NextToken() // =
+			tok := l.NextToken()
+			if tok.Type != tt.tokenType || tok.Literal != tt.literal || tok.Column != tt.column {
+				t.Fatalf("wrong token. expected=%s %q at column %d, got=%s %q at column %d",
+					tt.tokenType, tt.literal, tt.column, tok.Type, tok.Literal, tok.Column)
+			}
+			if next := l.NextToken(); next.Type != token.EOF {
+				t.Fatalf("expected the literal to end the line, got %s %q", next.Type, next.Literal)
+			}
+		})
+	}
+}
+
+func TestNumberUnderscores(t *testing.T) {
+	tests := []struct {
+		input     string
+		tokenType token.TokenType
+		literal   string
+		column    int
+		end       int
+	}{
+		{"x = 1_000_000", token.INT, "1000000", 5, 14},
+		{"x = 1_000.000_5", token.FLOAT, "1000.0005", 5, 16},
+		{"x = 0x_FF_FF", token.INT, "0xFFFF", 5, 13},
+		{"x = 0b1010_1010", token.INT, "0b10101010", 5, 16},
+		{"x = 100", token.INT, "100", 5, 8},
+		{"x = 1__000", token.ILLEGAL, "consecutive underscores in numeric literal 1__000", 7, 8},
+		{"x = 1000_", token.ILLEGAL, "trailing underscore in numeric literal 1000_", 9, 10},
+		{"x = 1_.5", token.ILLEGAL, "trailing underscore in numeric literal 1_.5", 6, 7},
+		{"x = 1._5", token.ILLEGAL, "leading underscore after '.' in numeric literal 1._5", 7, 8},
+		{"x = 0x_", token.ILLEGAL, "trailing underscore in numeric literal 0x_", 7, 8},
+		{"x = 0b1_2", token.ILLEGAL, "invalid digit '2' in binary literal 0b1_2", 9, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := New(tt.input)
+			l.NextToken() // x
+			l.NextToken() // =
+			tok := l.NextToken()
+			if tok.Type != tt.tokenType || tok.Literal != tt.literal || tok.Column != tt.column || tok.End() != tt.end {
+				t.Fatalf("wrong token. expected=%s %q at columns %d-%d, got=%s %q at columns %d-%d",
+					tt.tokenType, tt.literal, tt.column, tt.end, tok.Type, tok.Literal, tok.Column, tok.End())
+			}
+			if next := l.NextToken(); next.Type != token.EOF {
+				t.Fatalf("expected the literal to end the line, got %s %q", next.Type, next.Literal)
+			}
+		})
+	}
+}
+
+func TestPragma(t *testing.T) {
+	input := "if x:  # pragma: unlikely\n\ty = 1 #pragma:likely\n# other\n"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IF, "if"},
+		{token.IDENT, "x"},
+		{token.COLON, ":"},
+		{token.PRAGMA, "unlikely"},
+		{token.NEWLINE, "\n"},
+		{token.INDENT, "\t"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.PRAGMA, "likely"},
+		{token.NEWLINE, "\n"},
+		{token.DEDENT, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestDict(t *testing.T) {
+	input := `d = {"a": 1, 2: x}` + "\nprint(d[\"a\"])"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "d"},
+		{token.ASSIGN, "="},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.COLON, ":"},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+		{token.NEWLINE, "\n"},
+		{token.PRINT, "print"},
+		{token.LPAREN, "("},
+		{token.IDENT, "d"},
+		{token.LBRACKET, "["},
+		{token.STRING, "a"},
+		{token.RBRACKET, "]"},
+		{token.RPAREN, ")"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestLineContinuation(t *testing.T) {
+	input := "if f(a,\n  # why\n\n\t\tb) and \\\n    c:\n\tx = [1,\n2]\ny = 3\n"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.IF, "if", 1, 1},
+		{token.IDENT, "f", 1, 4},
+		{token.LPAREN, "(", 1, 5},
+		{token.IDENT, "a", 1, 6},
+		{token.COMMA, ",", 1, 7},
+		{token.IDENT, "b", 4, 3},
+		{token.RPAREN, ")", 4, 4},
+		{token.AND, "and", 4, 6},
+		{token.IDENT, "c", 5, 5},
+		{token.COLON, ":", 5, 6},
+		{token.NEWLINE, "\n", 5, 7},
+		{token.INDENT, "\t", 6, 1},
+		{token.IDENT, "x", 6, 2},
+		{token.ASSIGN, "=", 6, 4},
+		{token.LBRACKET, "[", 6, 6},
+		{token.INT, "1", 6, 7},
+		{token.COMMA, ",", 6, 8},
+		{token.INT, "2", 7, 1},
+		{token.RBRACKET, "]", 7, 2},
+		{token.NEWLINE, "\n", 7, 3},
+		{token.DEDENT, "", 8, 1},
+		{token.IDENT, "y", 8, 1},
+		{token.ASSIGN, "=", 8, 3},
+		{token.INT, "3", 8, 5},
+		{token.NEWLINE, "\n", 8, 6},
+		{token.EOF, "", 9, 1},
+	}
+
+	runLexerTest(t, New(input), tests)
+}
+
+func TestNewFromReader(t *testing.T) {
+	inputs := []string{
+		"",
+		"x = 1",
+		"# head\n\nx = 1  # one\nif x:\n\n\t# in\n\tprint(x)\n# tail\n",
+		"if f(a,\n  # why\n\n\t\tb) and \\\n    c:\n\tx = [1,\n2]\ny = 3\n",
+		"s = \"unterminated\nt = f\"{x}\"  # pragma: likely\n  bad\r\n",
+		benchmarkSource,
+	}
+	for i, input := range inputs {
+		for _, trivia := range []bool{false, true} {
+			want, got := New(input), NewFromReader(iotest.OneByteReader(strings.NewReader(input)))
+			if trivia {
+				want.KeepTrivia()
+				got.KeepTrivia()
+			}
+			window := 0
+			for n := 0; ; n++ {
+				expected, tok := want.NextToken(), got.NextToken()
+				if tok != expected {
+					t.Fatalf("inputs[%d] trivia=%v token %d: expected=%+v, got=%+v", i, trivia, n, expected, tok)
+				}
+				window = max(window, len(got.input))
+				if tok.Type == token.EOF || n > 100000 {
+					break
+				}
+			}
+			// Only about a line of the input is ever held
+			if window > 200 {
+				t.Errorf("inputs[%d] trivia=%v: held %d bytes at once", i, trivia, window)
+			}
+		}
+	}
+
+	broken := errors.New("broken pipe")
+	l := NewFromReader(io.MultiReader(strings.NewReader("x = 1\ny"), iotest.ErrReader(broken)))
+	var types []token.TokenType
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+	if fmt.Sprint(types) != "[IDENT = INT NEWLINE IDENT]" || l.Err() != broken {
+		t.Errorf("wrong tokens %v or error %v after a failed read", types, l.Err())
+	}
+}
+
+func TestMethodCall(t *testing.T) {
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "xs"},
+		{token.DOT, "."},
+		{token.IDENT, "sort"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.NEWLINE, "\n"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "="},
+		{token.FLOAT, "1."},
+		{token.EOF, ""},
+	}
+
+	l := New("xs.sort()\ny = 1.")
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+// benchmarkSource is a program using every kind of token, repeated to about
+// a megabyte so that the cost of setting up a lexer does not count
+var benchmarkSource = strings.Repeat(`def area(width, height):
+	total = width * height // 2 + width ** 2 - height % 3
+	if total >= 100 and not width == height:
+		total -= 1
+	elif total != 0 or width < height:
+		total += 2.5
+	return total
+
+names = {"first": 1, "second": 22, "third": 333}
+count = 0
+while count <= 1000:
+	count *= 2
+	print(area(count, names["first"]))  # pragma: likely
+for i in range(10, 20):
+	print("line number and some text")
+`, 2500)
+
+func BenchmarkLexer(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkSource)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l := New(benchmarkSource)
+		for l.NextToken().Type != token.EOF {
+		}
+	}
+}
+
+// TestAllocations keeps lexing from allocating per token or per character;
+// only the lexer itself and its indentation stack are allocated
+func TestAllocations(t *testing.T) {
+	allocs := testing.AllocsPerRun(5, func() {
+		l := New(benchmarkSource)
+		for l.NextToken().Type != token.EOF {
+		}
+	})
+	if allocs > 4 {
+		t.Errorf("lexing allocated %v times, expected at most 4", allocs)
+	}
+}
+
+// traceLog collects the lines traced to it
+type traceLog []string
+
+func (t *traceLog) Printf(format string, args ...interface{}) {
+	*t = append(*t, fmt.Sprintf(format, args...))
+}
+
+func TestTrace(t *testing.T) {
+	var log traceLog
+	l := New("x = 1\n").Trace(&log)
+	for l.NextToken().Type != token.EOF {
+	}
+	expected := []string{`lex 1:1 IDENT "x"`, `lex 1:3 = "="`, `lex 1:5 INT "1"`, `lex 1:6 NEWLINE "\n"`, `lex 2:1 EOF ""`}
+	if strings.Join(log, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong trace.\nexpected: %q\ngot:      %q", expected, log)
+	}
+}
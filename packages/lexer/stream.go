@@ -0,0 +1,65 @@
+package lexer
+
+import "github.com/arifali123/152compiler/packages/token"
+
+// Stream holds every token of an input so they can be read more than once.
+// A parser that needs to look past an ambiguous construct can remember Pos,
+// read ahead, and Seek back without lexing the input again.
+type Stream struct {
+	tokens []token.Token
+	pos    int
+}
+
+// Record lexes all of l's remaining input into a Stream. It ends with EOF,
+// or early at an ILLEGAL token the lexer cannot move past.
+func Record(l *Lexer) *Stream {
+	s := &Stream{}
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.ILLEGAL && len(s.tokens) > 0 {
+			prev := s.tokens[len(s.tokens)-1]
+			if prev.Type == token.ILLEGAL && prev.Line == tok.Line && prev.Column == tok.Column {
+				break
+			}
+		}
+		s.tokens = append(s.tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	return s
+}
+
+// NextToken returns the token at the current position and moves past it.
+// Past the end it keeps returning the last token, as the lexer would.
+func (s *Stream) NextToken() token.Token {
+	if len(s.tokens) == 0 {
+		return token.Token{Type: token.EOF}
+	}
+	if s.pos >= len(s.tokens) {
+		return s.tokens[len(s.tokens)-1]
+	}
+	tok := s.tokens[s.pos]
+	s.pos++
+	return tok
+}
+
+// Pos returns the index of the token NextToken will return
+func (s *Stream) Pos() int {
+	return s.pos
+}
+
+// Seek moves to the token at index pos, clamped to the recorded range
+func (s *Stream) Seek(pos int) {
+	s.pos = max(0, min(pos, len(s.tokens)))
+}
+
+// Reset moves back to the first token
+func (s *Stream) Reset() {
+	s.pos = 0
+}
+
+// Tokens returns every recorded token; the caller must not modify it
+func (s *Stream) Tokens() []token.Token {
+	return s.tokens
+}
@@ -0,0 +1,86 @@
+package manifest
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/diag"
+)
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected File
+	}{
+		{"", File{Path: "a.s", Size: 0, SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}},
+		{"abc", File{Path: "a.s", Size: 3, SHA256: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			if got := Describe("a.s", []byte(tt.data)); got != tt.expected {
+				t.Errorf("wrong file. expected=%+v, got=%+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		diags    []diag.Diagnostic
+		expected Counts
+		failed   bool
+	}{
+		{name: "none"},
+		{
+			name:     "warnings only",
+			diags:    []diag.Diagnostic{diag.Warningf(1, 1, "w"), diag.Warningf(2, 1, "w")},
+			expected: Counts{Warnings: 2},
+		},
+		{
+			name:     "errors fail the build",
+			diags:    []diag.Diagnostic{diag.Errorf(1, 1, "e"), diag.Warningf(2, 1, "w"), {Severity: diag.Note, Message: "n"}},
+			expected: Counts{Errors: 1, Warnings: 1, Notes: 1},
+			failed:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(nil)
+			m.Count(tt.diags)
+			if m.Diagnostics != tt.expected || m.Failed != tt.failed {
+				t.Errorf("wrong counts. expected=%+v failed=%v, got=%+v failed=%v", tt.expected, tt.failed, m.Diagnostics, m.Failed)
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	m := New(map[string]string{"O": "true"})
+	m.AddInput("a.py", []byte("print(1)\n"))
+	m.AddOutput("out/a.s", []byte("abc"))
+	data, err := m.JSON()
+	if err != nil {
+		t.Fatalf("encoding failed: %v", err)
+	}
+	if data[len(data)-1] != '\n' {
+		t.Errorf("missing trailing newline")
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("decoding failed: %v", err)
+	}
+	for _, k := range []string{"version", "inputs", "options", "outputs", "diagnostics", "failed"} {
+		if _, ok := got[k]; !ok {
+			t.Errorf("missing key %q in %s", k, data)
+		}
+	}
+	var back Manifest
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("decoding failed: %v", err)
+	}
+	if !reflect.DeepEqual(&back, m) {
+		t.Errorf("round trip changed the manifest.\nexpected=%+v\ngot=     %+v", m, &back)
+	}
+}
@@ -0,0 +1,332 @@
+// Package opt holds the AST optimizations run between checking and code
+// generation when the compiler is invoked with -O.
+package opt
+
+import (
+	"math"
+
+	"github.com/arifali123/152compiler/packages/ast"
+)
+
+// Options controls the optimizer
+type Options struct {
+	// WordSize bounds folded arithmetic, 32 or 64 bits. Zero means 32.
+	WordSize int
+
+	// KeepStorage keeps the assignment, and so the .data word, of a
+	// constant global even when every use of it was substituted
+	KeepStorage bool
+}
+
+// ConstantGlobals substitutes the value of every global assigned exactly
+// once, at top level, from a constant expression (SIZE = 10) at the uses
+// that run after the assignment, folding the arithmetic this exposes. Unless
+// KeepStorage is set, assignments whose uses were all replaced are removed.
+// It returns the names of the globals it treated as constants.
+func ConstantGlobals(program *ast.Program, opts Options) []string {
+	c := &constants{
+		values:  make(map[string]int64),
+		assigns: make(map[string]int),
+		bits:    opts.WordSize,
+	}
+	if c.bits != 64 {
+		c.bits = 32
+	}
+	c.countAssignments(program.Statements, nil)
+
+	var names []string
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			s.Value = c.expr(s.Value, nil)
+			// An annotated variable's value depends on its storage width
+			if lit, ok := s.Value.(*ast.IntegerLiteral); ok && c.assigns[s.Name] == 1 && s.Annotation == "" {
+				c.values[s.Name] = lit.Value
+				names = append(names, s.Name)
+			}
+		case *ast.FunctionDefinition:
+			// A function can only be called once its def has run, which is
+			// after every constant assigned above it
+			c.block(s.Body, shadowed(s))
+		default:
+			c.stmt(stmt, nil)
+		}
+	}
+
+	if !opts.KeepStorage {
+		used := make(map[string]bool)
+		markUses(program.Statements, nil, used)
+		kept := program.Statements[:0]
+		for _, stmt := range program.Statements {
+			if s, ok := stmt.(*ast.AssignmentStatement); ok && !used[s.Name] {
+				if _, isConst := c.values[s.Name]; isConst {
+					continue
+				}
+			}
+			kept = append(kept, stmt)
+		}
+		program.Statements = kept
+	}
+	return names
+}
+
+type constants struct {
+	values  map[string]int64
+	assigns map[string]int
+	bits    int
+}
+
+// countAssignments counts assignments to each global anywhere in the
+// program, including inside the functions that declare it global. Names in
+// locals belong to the enclosing function instead.
+func (c *constants) countAssignments(stmts []ast.Statement, locals map[string]bool) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			if !locals[s.Name] {
+				c.assigns[s.Name]++
+			}
+		case *ast.IfStatement:
+			c.countAssignments(s.Consequence, locals)
+			c.countAssignments(s.Alternative, locals)
+		case *ast.WhileStatement:
+			c.countAssignments(s.Body, locals)
+		case *ast.FunctionDefinition:
+			c.countAssignments(s.Body, shadowed(s))
+		}
+	}
+}
+
+// shadowed returns the names that refer to fn's parameters and local
+// variables inside it rather than to globals
+func shadowed(fn *ast.FunctionDefinition) map[string]bool {
+	names := make(map[string]bool)
+	for _, p := range fn.Parameters {
+		names[p] = true
+	}
+	for _, name := range ast.LocalNames(fn) {
+		names[name] = true
+	}
+	return names
+}
+
+func (c *constants) block(stmts []ast.Statement, params map[string]bool) {
+	for _, stmt := range stmts {
+		c.stmt(stmt, params)
+	}
+}
+
+// stmt substitutes constants in a statement. Names in params are bound to a
+// parameter or local variable of the enclosing function and are left alone.
+func (c *constants) stmt(stmt ast.Statement, params map[string]bool) {
+	switch s := stmt.(type) {
+	case *ast.AssignmentStatement:
+		s.Value = c.expr(s.Value, params)
+	case *ast.IndexAssignment:
+		s.Target.Left = c.expr(s.Target.Left, params)
+		s.Target.Index = c.expr(s.Target.Index, params)
+		s.Value = c.expr(s.Value, params)
+	case *ast.PrintStatement:
+		s.Value = c.expr(s.Value, params)
+	case *ast.ReturnStatement:
+		s.Value = c.expr(s.Value, params)
+	case *ast.ExpressionStatement:
+		s.Expression = c.expr(s.Expression, params)
+	case *ast.IfStatement:
+		s.Condition = c.expr(s.Condition, params)
+		c.block(s.Consequence, params)
+		c.block(s.Alternative, params)
+	case *ast.WhileStatement:
+		s.Condition = c.expr(s.Condition, params)
+		c.block(s.Body, params)
+	}
+}
+
+func (c *constants) expr(e ast.Expression, params map[string]bool) ast.Expression {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if v, ok := c.values[e.Value]; ok && !params[e.Value] {
+			return &ast.IntegerLiteral{Token: e.Token, Value: v}
+		}
+	case *ast.BinaryExpression:
+		e.Left = c.expr(e.Left, params)
+		e.Right = c.expr(e.Right, params)
+		left, lok := e.Left.(*ast.IntegerLiteral)
+		right, rok := e.Right.(*ast.IntegerLiteral)
+		if lok && rok {
+			if v, ok := c.fold(left.Value, e.Operator, right.Value); ok {
+				return &ast.IntegerLiteral{Token: left.Token, Value: v}
+			}
+		}
+	case *ast.Comparison:
+		for i, operand := range e.Operands {
+			e.Operands[i] = c.expr(operand, params)
+		}
+	case *ast.PrefixExpression:
+		e.Right = c.expr(e.Right, params)
+		if lit, ok := e.Right.(*ast.IntegerLiteral); ok && e.Operator == "-" {
+			if v, ok := c.fold(0, "-", lit.Value); ok {
+				return &ast.IntegerLiteral{Token: e.Token, Value: v}
+			}
+		}
+	case *ast.FunctionCall:
+		for i, arg := range e.Arguments {
+			e.Arguments[i] = c.expr(arg, params)
+		}
+	case *ast.DictLiteral:
+		for i := range e.Keys {
+			e.Keys[i] = c.expr(e.Keys[i], params)
+			e.Values[i] = c.expr(e.Values[i], params)
+		}
+	case *ast.ListLiteral:
+		for i, element := range e.Elements {
+			e.Elements[i] = c.expr(element, params)
+		}
+	case *ast.IndexExpression:
+		e.Index = c.expr(e.Index, params)
+	case *ast.InterpolatedString:
+		for i, part := range e.Parts {
+			e.Parts[i] = c.expr(part, params)
+		}
+	}
+	return e
+}
+
+// fold evaluates an arithmetic operator on two constants, dividing the way
+// Python does. Comparisons are
+// left for the code generator, which branches on them directly, and results
+// that would overflow a register are not folded.
+func (c *constants) fold(a int64, op string, b int64) (int64, bool) {
+	var v int64
+	switch op {
+	case "+":
+		v = a + b
+		if (v > a) != (b > 0) {
+			return 0, false
+		}
+	case "-":
+		v = a - b
+		if (v < a) != (b > 0) {
+			return 0, false
+		}
+	case "*":
+		v = a * b
+		if a != 0 && (v/a != b || a == -1 && b == math.MinInt64) {
+			return 0, false
+		}
+	case "/", "//", "%":
+		// Dividing by zero is left to fail, or be caught, at run time
+		if b == 0 || a == math.MinInt64 && b == -1 {
+			return 0, false
+		}
+		q, r := a/b, a%b
+		if r != 0 && (r < 0) != (b < 0) {
+			q, r = q-1, r+b
+		}
+		v = q
+		if op == "%" {
+			v = r
+		}
+	case "**":
+		var ok bool
+		if v, ok = power(a, b); !ok {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if c.bits == 32 && v != int64(int32(v)) {
+		return 0, false
+	}
+	return v, true
+}
+
+// power computes a ** b as the generated code does, giving 0 for a negative
+// exponent. It reports false when the result overflows an int64.
+func power(a, b int64) (int64, bool) {
+	switch {
+	case b < 0:
+		return 0, true
+	case b == 0:
+		return 1, true
+	case a == 0 || a == 1:
+		return a, true
+	case a == -1:
+		return 1 - 2*(b%2), true
+	}
+	v := int64(1)
+	for ; b > 0; b-- {
+		if v*a/a != v {
+			return 0, false
+		}
+		v *= a
+	}
+	return v, true
+}
+
+// markUses records every global read by the statements. Inside a function,
+// reads of its parameters and locals are not global reads.
+func markUses(stmts []ast.Statement, params map[string]bool, used map[string]bool) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			markExpr(s.Value, params, used)
+		case *ast.IndexAssignment:
+			markExpr(s.Target, params, used)
+			markExpr(s.Value, params, used)
+		case *ast.PrintStatement:
+			markExpr(s.Value, params, used)
+		case *ast.ReturnStatement:
+			markExpr(s.Value, params, used)
+		case *ast.ExpressionStatement:
+			markExpr(s.Expression, params, used)
+		case *ast.IfStatement:
+			markExpr(s.Condition, params, used)
+			markUses(s.Consequence, params, used)
+			markUses(s.Alternative, params, used)
+		case *ast.WhileStatement:
+			markExpr(s.Condition, params, used)
+			markUses(s.Body, params, used)
+		case *ast.FunctionDefinition:
+			markUses(s.Body, shadowed(s), used)
+		}
+	}
+}
+
+func markExpr(e ast.Expression, params map[string]bool, used map[string]bool) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if !params[e.Value] {
+			used[e.Value] = true
+		}
+	case *ast.BinaryExpression:
+		markExpr(e.Left, params, used)
+		markExpr(e.Right, params, used)
+	case *ast.Comparison:
+		for _, operand := range e.Operands {
+			markExpr(operand, params, used)
+		}
+	case *ast.PrefixExpression:
+		markExpr(e.Right, params, used)
+	case *ast.FunctionCall:
+		for _, arg := range e.Arguments {
+			markExpr(arg, params, used)
+		}
+	case *ast.DictLiteral:
+		for i := range e.Keys {
+			markExpr(e.Keys[i], params, used)
+			markExpr(e.Values[i], params, used)
+		}
+	case *ast.ListLiteral:
+		for _, element := range e.Elements {
+			markExpr(element, params, used)
+		}
+	case *ast.IndexExpression:
+		markExpr(e.Left, params, used)
+		markExpr(e.Index, params, used)
+	case *ast.InterpolatedString:
+		for _, part := range e.Parts {
+			markExpr(part, params, used)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package opt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/format"
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/parser"
+)
+
+func TestConstantGlobals(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     Options
+		expected string
+		consts   []string
+	}{
+		{
+			name:     "loop bound",
+			input:    "SIZE = 10\nSTEP = SIZE * 2\ni = 0\nwhile i < SIZE:\n\ti = i + STEP\nprint(i)\n",
+			expected: "i = 0\nwhile i < 10:\n\ti = i + 20\nprint(i)\n",
+			consts:   []string{"SIZE", "STEP"},
+		},
+		{
+			name:     "keep storage",
+			input:    "SIZE = 10\nprint(SIZE)\n",
+			opts:     Options{KeepStorage: true},
+			expected: "SIZE = 10\nprint(10)\n",
+			consts:   []string{"SIZE"},
+		},
+		{
+			name:     "division rounds down",
+			input:    "N = -7\nQ = N / 2\nR = N % 2\nZ = N / 0\nprint(Q)\nprint(R)\nprint(Z)\n",
+			expected: "Z = -7 / 0\nprint(-4)\nprint(1)\nprint(Z)\n",
+			consts:   []string{"N", "Q", "R"},
+		},
+		{
+			name:     "powers",
+			input:    "B = 3\nP = B ** 4\nF = 2 ** -1\nbig = 2 ** 40\nprint(P)\nprint(F)\nprint(big)\n",
+			expected: "big = 2 ** 40\nprint(81)\nprint(0)\nprint(big)\n",
+			consts:   []string{"B", "P", "F"},
+		},
+		{
+			name:     "dictionary",
+			input:    "K = 2\nd = {K: K * 3}\nprint(d[K])\n",
+			expected: "d = {2: 6}\nprint(d[2])\n",
+			consts:   []string{"K"},
+		},
+		{
+			name:     "reassigned",
+			input:    "n = 1\nn = 2\nprint(n)\n",
+			expected: "n = 1\nn = 2\nprint(n)\n",
+		},
+		{
+			name:     "assigned in a function",
+			input:    "def f(a):\n\tglobal n\n\tn = a\n\treturn n\n\nn = 1\nprint(n)\n",
+			expected: "def f(a):\n\tglobal n\n\tn = a\n\treturn n\n\nn = 1\nprint(n)\n",
+		},
+		{
+			name:     "local of the same name",
+			input:    "def f(a):\n\tn = a\n\treturn n\n\nn = 1\nprint(n)\n",
+			expected: "def f(a):\n\tn = a\n\treturn n\n\nprint(1)\n",
+			consts:   []string{"n"},
+		},
+		{
+			name:     "use before assignment keeps storage",
+			input:    "print(N)\nN = 3\nprint(N)\n",
+			expected: "print(N)\nN = 3\nprint(3)\n",
+			consts:   []string{"N"},
+		},
+		{
+			name:     "parameter shadows constant",
+			input:    "M = 4\nN = 5\ndef f(N):\n\treturn N + M\n\ny = f(N)\nprint(y)\n",
+			expected: "def f(N):\n\treturn N + 4\n\ny = f(5)\nprint(y)\n",
+			consts:   []string{"M", "N"},
+		},
+		{
+			name:     "function defined before constant",
+			input:    "def f(a):\n\treturn a + M\n\nM = 4\ny = f(1)\nprint(y)\n",
+			expected: "def f(a):\n\treturn a + M\n\nM = 4\ny = f(1)\nprint(y)\n",
+			consts:   []string{"M"},
+		},
+		{
+			name:     "overflow is not folded",
+			input:    "BIG = 2147483647\nx = BIG + 1\nprint(x)\n",
+			expected: "x = 2147483647 + 1\nprint(x)\n",
+			consts:   []string{"BIG"},
+		},
+		{
+			name:     "64-bit folding",
+			input:    "BIG = 2147483647\nx = BIG + 1\nprint(x)\n",
+			opts:     Options{WordSize: 64},
+			expected: "print(2147483648)\n",
+			consts:   []string{"BIG", "x"},
+		},
+		{
+			name:     "annotated global keeps its storage width",
+			input:    "C: uint8 = 5\nprint(C)\n",
+			expected: "C: uint8 = 5\nprint(C)\n",
+		},
+		{
+			name:     "negation",
+			input:    "N = 3\nx = -N\nprint(x)\n",
+			expected: "print(-3)\n",
+			consts:   []string{"N", "x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			consts := ConstantGlobals(program, tt.opts)
+			if got := format.Source(program); got != tt.expected {
+				t.Errorf("wrong program.\nexpected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+			if !reflect.DeepEqual(consts, tt.consts) {
+				t.Errorf("wrong constants. expected=%v, got=%v", tt.consts, consts)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package opt
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/format"
+)
+
+// Loop is what the analysis could prove about one while loop
+type Loop struct {
+	Line      int
+	Function  string // enclosing function, empty at top level
+	Condition string
+	Induction []Induction
+	Trips     int64 // iterations per entry when provable, otherwise -1
+}
+
+// Induction is a variable the loop body changes by a constant step exactly
+// once per iteration
+type Induction struct {
+	Name       string
+	Step       int64
+	Start      int64
+	StartKnown bool // Start holds the constant assigned just before the loop
+}
+
+// Loops finds the induction variables and, where the condition compares one
+// against a constant, the trip count of every while loop. Run it after
+// ConstantGlobals to see through named bounds.
+func Loops(program *ast.Program) []Loop {
+	a := &loopAnalysis{funcAssigned: make(map[string]bool)}
+	for _, stmt := range program.Statements {
+		if fn, ok := stmt.(*ast.FunctionDefinition); ok {
+			assigned := make(map[string]bool)
+			countInto(fn.Body, assigned)
+			local := shadowed(fn)
+			for name := range assigned {
+				if !local[name] {
+					a.funcAssigned[name] = true
+				}
+			}
+		}
+	}
+	a.walk(program.Statements, "")
+	sort.SliceStable(a.loops, func(i, j int) bool { return a.loops[i].Line < a.loops[j].Line })
+	return a.loops
+}
+
+type loopAnalysis struct {
+	loops []Loop
+	// funcAssigned holds the globals some function assigns, which any call
+	// in a loop body may change
+	funcAssigned map[string]bool
+}
+
+func (a *loopAnalysis) walk(stmts []ast.Statement, function string) {
+	for i, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.WhileStatement:
+			a.loops = append(a.loops, a.analyze(s, stmts[:i], function))
+			a.walk(s.Body, function)
+		case *ast.IfStatement:
+			a.walk(s.Consequence, function)
+			a.walk(s.Alternative, function)
+		case *ast.FunctionDefinition:
+			a.walk(s.Body, s.Name)
+		}
+	}
+}
+
+// analyze examines one loop; before holds the statements preceding it in the
+// same block
+func (a *loopAnalysis) analyze(loop *ast.WhileStatement, before []ast.Statement, function string) Loop {
+	info := Loop{Line: loop.Token.Line, Function: function, Condition: format.Expr(loop.Condition), Trips: -1}
+
+	counts := make(map[string]int)
+	countAssigns(loop.Body, counts)
+	calls := hasCall(loop.Condition) || blockHasCall(loop.Body)
+	for _, stmt := range loop.Body {
+		s, ok := stmt.(*ast.AssignmentStatement)
+		if !ok || counts[s.Name] != 1 || calls && a.funcAssigned[s.Name] {
+			continue
+		}
+		step, ok := stepOf(s)
+		if !ok {
+			continue
+		}
+		iv := Induction{Name: s.Name, Step: step}
+		iv.Start, iv.StartKnown = startOf(s.Name, before)
+		info.Induction = append(info.Induction, iv)
+	}
+
+	if !hasReturn(loop.Body) {
+		info.Trips = trips(loop.Condition, info.Induction)
+	}
+	return info
+}
+
+// stepOf recognizes v = v + c, v = c + v and v = v - c
+func stepOf(s *ast.AssignmentStatement) (int64, bool) {
+	bin, ok := s.Value.(*ast.BinaryExpression)
+	if !ok {
+		return 0, false
+	}
+	left, lid := bin.Left.(*ast.Identifier)
+	right, rid := bin.Right.(*ast.Identifier)
+	leftLit, llit := bin.Left.(*ast.IntegerLiteral)
+	rightLit, rlit := bin.Right.(*ast.IntegerLiteral)
+
+	var step int64
+	switch {
+	case bin.Operator == "+" && lid && left.Value == s.Name && rlit:
+		step = rightLit.Value
+	case bin.Operator == "+" && rid && right.Value == s.Name && llit:
+		step = leftLit.Value
+	case bin.Operator == "-" && lid && left.Value == s.Name && rlit:
+		step = -rightLit.Value
+	default:
+		return 0, false
+	}
+	return step, step != 0
+}
+
+// startOf finds the constant last assigned to name before the loop. Only
+// assignments and prints without calls may sit in between.
+func startOf(name string, before []ast.Statement) (int64, bool) {
+	for i := len(before) - 1; i >= 0; i-- {
+		switch s := before[i].(type) {
+		case *ast.AssignmentStatement:
+			if hasCall(s.Value) {
+				return 0, false
+			}
+			if s.Name == name {
+				lit, ok := s.Value.(*ast.IntegerLiteral)
+				if !ok {
+					return 0, false
+				}
+				return lit.Value, true
+			}
+		case *ast.PrintStatement:
+			if hasCall(s.Value) {
+				return 0, false
+			}
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// trips computes the iteration count of a loop whose condition compares an
+// induction variable with a known start against a constant
+func trips(cond ast.Expression, ivs []Induction) int64 {
+	bin, ok := cond.(*ast.BinaryExpression)
+	if !ok {
+		return -1
+	}
+	op := bin.Operator
+	id, idOk := bin.Left.(*ast.Identifier)
+	bound, boundOk := bin.Right.(*ast.IntegerLiteral)
+	if !idOk || !boundOk {
+		// Normalize "c > v" to "v < c"
+		id, idOk = bin.Right.(*ast.Identifier)
+		bound, boundOk = bin.Left.(*ast.IntegerLiteral)
+		op = map[string]string{"<": ">", ">": "<", "<=": ">=", ">=": "<="}[op]
+	}
+	if !idOk || !boundOk {
+		return -1
+	}
+
+	for _, iv := range ivs {
+		if iv.Name != id.Value || !iv.StartKnown {
+			continue
+		}
+		limit := bound.Value
+		switch op {
+		case "<=":
+			limit++
+			fallthrough
+		case "<":
+			if iv.Step < 0 {
+				return -1
+			}
+			return ceilDiv(limit-iv.Start, iv.Step)
+		case ">=":
+			limit--
+			fallthrough
+		case ">":
+			if iv.Step > 0 {
+				return -1
+			}
+			return ceilDiv(iv.Start-limit, -iv.Step)
+		}
+	}
+	return -1
+}
+
+func ceilDiv(distance, step int64) int64 {
+	if distance <= 0 {
+		return 0
+	}
+	return (distance + step - 1) / step
+}
+
+// countAssigns counts assignments to each name in a block and the blocks
+// nested in it
+func countAssigns(stmts []ast.Statement, counts map[string]int) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			counts[s.Name]++
+		case *ast.IfStatement:
+			countAssigns(s.Consequence, counts)
+			countAssigns(s.Alternative, counts)
+		case *ast.WhileStatement:
+			countAssigns(s.Body, counts)
+		}
+	}
+}
+
+func countInto(stmts []ast.Statement, names map[string]bool) {
+	counts := make(map[string]int)
+	countAssigns(stmts, counts)
+	for name := range counts {
+		names[name] = true
+	}
+}
+
+func hasReturn(stmts []ast.Statement) bool {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.ReturnStatement:
+			return true
+		case *ast.IfStatement:
+			if hasReturn(s.Consequence) || hasReturn(s.Alternative) {
+				return true
+			}
+		case *ast.WhileStatement:
+			if hasReturn(s.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func blockHasCall(stmts []ast.Statement) bool {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignmentStatement:
+			if hasCall(s.Value) {
+				return true
+			}
+		case *ast.IndexAssignment:
+			if hasCall(s.Target) || hasCall(s.Value) {
+				return true
+			}
+		case *ast.PrintStatement:
+			if hasCall(s.Value) {
+				return true
+			}
+		case *ast.ExpressionStatement:
+			if hasCall(s.Expression) {
+				return true
+			}
+		case *ast.IfStatement:
+			if hasCall(s.Condition) || blockHasCall(s.Consequence) || blockHasCall(s.Alternative) {
+				return true
+			}
+		case *ast.WhileStatement:
+			if hasCall(s.Condition) || blockHasCall(s.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasCall(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.FunctionCall:
+		return true
+	case *ast.BinaryExpression:
+		return hasCall(e.Left) || hasCall(e.Right)
+	case *ast.Comparison:
+		return slices.ContainsFunc(e.Operands, hasCall)
+	case *ast.PrefixExpression:
+		return hasCall(e.Right)
+	case *ast.IndexExpression:
+		return hasCall(e.Left) || hasCall(e.Index)
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package opt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/parser"
+)
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []Loop
+	}{
+		{
+			name:  "counting up",
+			input: "i = 0\nwhile i < 10:\n\tprint(i)\n\ti = i + 3\n",
+			expected: []Loop{{Line: 2, Condition: "i < 10", Trips: 4,
+				Induction: []Induction{{Name: "i", Step: 3, Start: 0, StartKnown: true}}}},
+		},
+		{
+			name:  "counting down with bound on the left",
+			input: "n = 5\nx = 1\nwhile 0 < n:\n\tn = n - 1\n",
+			expected: []Loop{{Line: 3, Condition: "0 < n", Trips: 5,
+				Induction: []Induction{{Name: "n", Step: -1, Start: 5, StartKnown: true}}}},
+		},
+		{
+			name:  "never entered",
+			input: "i = 20\nwhile i < 10:\n\ti = 1 + i\n",
+			expected: []Loop{{Line: 2, Condition: "i < 10", Trips: 0,
+				Induction: []Induction{{Name: "i", Step: 1, Start: 20, StartKnown: true}}}},
+		},
+		{
+			name:  "wrong direction",
+			input: "i = 0\nwhile i < 10:\n\ti = i - 1\n",
+			expected: []Loop{{Line: 2, Condition: "i < 10", Trips: -1,
+				Induction: []Induction{{Name: "i", Step: -1, Start: 0, StartKnown: true}}}},
+		},
+		{
+			name:  "named bound",
+			input: "SIZE = 10\ni = 0\nwhile i < SIZE:\n\ti = i + 1\n",
+			expected: []Loop{{Line: 3, Condition: "i < SIZE", Trips: -1,
+				Induction: []Induction{{Name: "i", Step: 1, Start: 0, StartKnown: true}}}},
+		},
+		{
+			name:     "assigned twice",
+			input:    "i = 0\nwhile i < 10:\n\ti = i + 1\n\ti = i + 1\n",
+			expected: []Loop{{Line: 2, Condition: "i < 10", Trips: -1}},
+		},
+		{
+			name:     "changed by a call",
+			input:    "def bump(x):\n\tglobal i\n\ti = x\n\treturn x\n\ni = 0\nwhile i < 10:\n\ti = i + 1\n\tbump(3)\n",
+			expected: []Loop{{Line: 7, Condition: "i < 10", Trips: -1}},
+		},
+		{
+			name:  "call that assigns a local",
+			input: "def bump(x):\n\ti = x\n\treturn x\n\ni = 0\nwhile i < 10:\n\ti = i + 1\n\tbump(3)\n",
+			expected: []Loop{{Line: 6, Condition: "i < 10", Trips: 10,
+				Induction: []Induction{{Name: "i", Step: 1, StartKnown: true}}}},
+		},
+		{
+			name:  "unknown start",
+			input: "def f(i):\n\twhile i < 10:\n\t\ti = i + 1\n\treturn i\n\nx = f(1)\nprint(x)\n",
+			expected: []Loop{{Line: 2, Function: "f", Condition: "i < 10", Trips: -1,
+				Induction: []Induction{{Name: "i", Step: 1}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+			if got := Loops(program); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("wrong loops.\nexpected=%+v\ngot=     %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoopsAfterConstantGlobals(t *testing.T) {
+	program := parser.New(lexer.New("SIZE = 10\ni = 0\nwhile i < SIZE:\n\ti = i + 1\n")).ParseProgram()
+	ConstantGlobals(program, Options{})
+	if loops := Loops(program); len(loops) != 1 || loops[0].Trips != 10 {
+		t.Errorf("expected a trip count of 10 once SIZE is substituted, got %+v", loops)
+	}
+}
@@ -0,0 +1,81 @@
+package opt
+
+import "github.com/arifali123/152compiler/packages/ast"
+
+// StringComparisons resolves if and while conditions that compare two string
+// literals. An if is replaced by the branch it would take and a loop whose
+// condition is false is removed; a loop that is always entered is left for
+// the code generator, which also resolves the comparison. It returns the
+// lines of the statements it replaced or removed.
+func StringComparisons(program *ast.Program) []int {
+	var lines []int
+	program.Statements = stringBlock(program.Statements, &lines)
+	return lines
+}
+
+func stringBlock(stmts []ast.Statement, lines *[]int) []ast.Statement {
+	if stmts == nil {
+		return nil
+	}
+	out := make([]ast.Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.IfStatement:
+			s.Consequence = stringBlock(s.Consequence, lines)
+			s.Alternative = stringBlock(s.Alternative, lines)
+			if taken, ok := literalCondition(s.Condition); ok {
+				*lines = append(*lines, s.Token.Line)
+				if taken {
+					out = append(out, s.Consequence...)
+				} else {
+					out = append(out, s.Alternative...)
+				}
+				continue
+			}
+		case *ast.WhileStatement:
+			s.Body = stringBlock(s.Body, lines)
+			if taken, ok := literalCondition(s.Condition); ok && !taken {
+				*lines = append(*lines, s.Token.Line)
+				continue
+			}
+		case *ast.FunctionDefinition:
+			s.Body = stringBlock(s.Body, lines)
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
+
+func literalCondition(cond ast.Expression) (bool, bool) {
+	bin, ok := cond.(*ast.BinaryExpression)
+	if !ok {
+		return false, false
+	}
+	left, lok := bin.Left.(*ast.StringLiteral)
+	right, rok := bin.Right.(*ast.StringLiteral)
+	if !lok || !rok {
+		return false, false
+	}
+	return CompareStrings(bin.Operator, left.Value, right.Value)
+}
+
+// CompareStrings evaluates a comparison between two string constants the way
+// Python does, by code point. ok is false for an operator that does not
+// compare.
+func CompareStrings(op, a, b string) (result, ok bool) {
+	switch op {
+	case "<":
+		return a < b, true
+	case ">":
+		return a > b, true
+	case "<=":
+		return a <= b, true
+	case ">=":
+		return a >= b, true
+	case "==":
+		return a == b, true
+	case "!=":
+		return a != b, true
+	}
+	return false, false
+}
@@ -0,0 +1,90 @@
+package opt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/format"
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/parser"
+)
+
+func TestStringComparisons(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		lines    []int
+	}{
+		{
+			name:     "if takes the consequence",
+			input:    "if \"apple\" < \"banana\":\n\tprint(1)\nelse:\n\tprint(2)\nprint(3)\n",
+			expected: "print(1)\nprint(3)\n",
+			lines:    []int{1},
+		},
+		{
+			name:     "if takes the alternative",
+			input:    "if \"apple\" > \"banana\":\n\tprint(1)\nelse:\n\tprint(2)\n",
+			expected: "print(2)\n",
+			lines:    []int{1},
+		},
+		{
+			name:     "loop never entered",
+			input:    "def f(a):\n\twhile \"b\" < \"a\":\n\t\ta = a + 1\n\treturn a\n",
+			expected: "def f(a):\n\treturn a\n",
+			lines:    []int{2},
+		},
+		{
+			name:     "loop always entered is kept",
+			input:    "while \"a\" < \"b\":\n\tprint(1)\n",
+			expected: "while \"a\" < \"b\":\n\tprint(1)\n",
+		},
+		{
+			name:     "run-time operand is kept",
+			input:    "s = \"a\"\nif s > 0:\n\tprint(s)\n",
+			expected: "s = \"a\"\nif s > 0:\n\tprint(s)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			lines := StringComparisons(program)
+			if got := format.Source(program); got != tt.expected {
+				t.Errorf("wrong program.\nexpected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("wrong lines. expected=%v, got=%v", tt.lines, lines)
+			}
+		})
+	}
+}
+
+func TestCompareStrings(t *testing.T) {
+	tests := []struct {
+		op, a, b string
+		expected bool
+	}{
+		{"<", "Zebra", "apple", true},
+		{">", "ab", "a", true},
+		{"<=", "a", "a", true},
+		{">=", "a", "b", false},
+		{"==", "hi", "hi", true},
+		{"!=", "hi", "hi", false},
+		{"<", "é", "z", false},
+	}
+	for _, tt := range tests {
+		got, ok := CompareStrings(tt.op, tt.a, tt.b)
+		if !ok || got != tt.expected {
+			t.Errorf("%q %s %q: expected=%v, got=%v (ok=%v)", tt.a, tt.op, tt.b, tt.expected, got, ok)
+		}
+	}
+	if _, ok := CompareStrings("+", "a", "b"); ok {
+		t.Errorf("CompareStrings accepted +")
+	}
+}
@@ -0,0 +1,113 @@
+package opt
+
+import (
+	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// Swaps rewrites the exchange t = a; a = b; b = t, when t is read nowhere
+// else, to what desugar makes of a, b = b, a: both values are copied to
+// hidden temporaries, which the code generator keeps in registers, and
+// stored back crossed. t is no longer assigned. It returns the lines of the
+// exchanges it rewrote.
+func Swaps(program *ast.Program) []int {
+	s := &swaps{program: program}
+	program.Statements = s.block(program.Statements, nil)
+	return s.lines
+}
+
+type swaps struct {
+	program *ast.Program
+	lines   []int
+}
+
+// block rewrites the exchanges in stmts. fn is the function they are in, or
+// nil at top level.
+func (s *swaps) block(stmts []ast.Statement, fn *ast.FunctionDefinition) []ast.Statement {
+	if stmts == nil {
+		return nil
+	}
+	out := make([]ast.Statement, 0, len(stmts))
+	for i := 0; i < len(stmts); i++ {
+		if i+2 < len(stmts) {
+			if a, b, ok := s.exchange(stmts[i:i+3], fn); ok {
+				s.lines = append(s.lines, stmts[i].(*ast.AssignmentStatement).Token.Line)
+				out = append(out, swap(stmts[i].(*ast.AssignmentStatement).Token, a, b)...)
+				i += 2
+				continue
+			}
+		}
+		switch stmt := stmts[i].(type) {
+		case *ast.IfStatement:
+			stmt.Consequence = s.block(stmt.Consequence, fn)
+			for _, e := range stmt.Elifs {
+				e.Consequence = s.block(e.Consequence, fn)
+			}
+			stmt.Alternative = s.block(stmt.Alternative, fn)
+		case *ast.WhileStatement:
+			stmt.Body = s.block(stmt.Body, fn)
+		case *ast.FunctionDefinition:
+			stmt.Body = s.block(stmt.Body, stmt)
+		}
+		out = append(out, stmts[i])
+	}
+	return out
+}
+
+// exchange reports whether three statements are t = a; a = b; b = t with
+// three different names and no other read of t, and returns a and b
+func (s *swaps) exchange(stmts []ast.Statement, fn *ast.FunctionDefinition) (a, b string, ok bool) {
+	var names [3]string
+	var values [3]string
+	for i, stmt := range stmts {
+		assign, ok := stmt.(*ast.AssignmentStatement)
+		if !ok || assign.Temporary || assign.Annotation != "" {
+			return "", "", false
+		}
+		value, ok := assign.Value.(*ast.Identifier)
+		if !ok {
+			return "", "", false
+		}
+		names[i], values[i] = assign.Name, value.Value
+	}
+	t, a, b := names[0], values[0], values[1]
+	if names[1] != a || names[2] != b || values[2] != t {
+		return "", "", false
+	}
+	if a == b || t == a || t == b || s.reads(t, fn) != 1 {
+		return "", "", false
+	}
+	return a, b, true
+}
+
+// reads counts the reads of name where it refers to the same variable as in
+// fn: within fn for one of its locals, and anywhere in the program for a
+// global
+func (s *swaps) reads(name string, fn *ast.FunctionDefinition) int {
+	var scope ast.Node = s.program
+	if fn != nil && shadowed(fn)[name] {
+		scope = fn
+	}
+	count := 0
+	ast.Rewrite(scope, func(n ast.Node) ast.Node {
+		if id, ok := n.(*ast.Identifier); ok && id.Value == name {
+			count++
+		}
+		return n
+	})
+	return count
+}
+
+// swap is the lowering desugar gives a, b = b, a
+func swap(tok token.Token, a, b string) []ast.Statement {
+	out := make([]ast.Statement, 0, 4)
+	for _, name := range [][2]string{{a, b}, {b, a}} {
+		temp := ast.NewAssign(tok, "("+name[0]+")", ast.NewName(name[1], tok))
+		temp.Temporary = true
+		out = append(out, temp)
+	}
+	for _, name := range []string{a, b} {
+		out = append(out, ast.NewAssign(tok, name, ast.NewName("("+name+")", tok)))
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package opt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/format"
+	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/parser"
+)
+
+func TestSwaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		lines    []int
+	}{
+		{
+			name:     "global exchange",
+			input:    "a = 1\nb = 2\nt = a\na = b\nb = t\nprint(a)\n",
+			expected: "a = 1\nb = 2\n(a) = b\n(b) = a\na = (a)\nb = (b)\nprint(a)\n",
+			lines:    []int{3},
+		},
+		{
+			name:     "local exchange inside a loop",
+			input:    "def f(x, y):\n\twhile x < y:\n\t\ttemp = x\n\t\tx = y\n\t\ty = temp\n\treturn x\n",
+			expected: "def f(x, y):\n\twhile x < y:\n\t\t(x) = y\n\t\t(y) = x\n\t\tx = (x)\n\t\ty = (y)\n\treturn x\n",
+			lines:    []int{3},
+		},
+		{
+			name:     "temporary read later is kept",
+			input:    "a = 1\nb = 2\nt = a\na = b\nb = t\nprint(t)\n",
+			expected: "a = 1\nb = 2\nt = a\na = b\nb = t\nprint(t)\n",
+		},
+		{
+			name:     "global temporary read in a function is kept",
+			input:    "def f():\n\treturn t\n\na = 1\nb = 2\nt = a\na = b\nb = t\n",
+			expected: "def f():\n\treturn t\n\na = 1\nb = 2\nt = a\na = b\nb = t\n",
+		},
+		{
+			name:     "not an exchange",
+			input:    "a = 1\nb = 2\nt = a\na = b\nb = a\n",
+			expected: "a = 1\nb = 2\nt = a\na = b\nb = a\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := parser.New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parser errors: %v", p.Errors())
+			}
+
+			lines := Swaps(program)
+			if got := format.Source(program); got != tt.expected {
+				t.Errorf("wrong program.\nexpected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("wrong lines. expected=%v, got=%v", tt.lines, lines)
+			}
+		})
+	}
+}
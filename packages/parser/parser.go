@@ -2,26 +2,60 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/diag"
 	"github.com/arifali123/152compiler/packages/lexer"
 	"github.com/arifali123/152compiler/packages/token"
 )
 
+// Error is a syntax error at the span of the token it was reported on.
+// Columns are 1-based and EndColumn is just past the span. Hint, if set, is
+// a short note about the span.
+type Error struct {
+	Line      int
+	Column    int
+	EndColumn int
+	Message   string
+	Hint      string
+	Fixes     []diag.Fix
+}
+
+// Error formats the error as "line N: message"
+func (e Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
 type Parser struct {
-	l            *lexer.Lexer
+	tokens       *lexer.Stream
 	currentToken token.Token
 	peekToken    token.Token
 	prevToken    token.Token
-	errors       []string
+	errors       []Error
+	groups       []token.Token       // the '(' of each group being parsed, innermost last
+	intBits      int                 // width of integer literals; see SetWordSize
+	pragmas      map[int]token.Token // pragma comments by line, kept out of the grammar
+	fragment     bool                // parsing one expression from inside an f-string
+	illegal      *token.Token        // the last ILLEGAL token reported, so a stuck lexer is reported once
+	trace        lexer.Logger        // receives a line per statement and block parsed; see SetTrace
+	depth        int                 // how many expressions and blocks enclose the one being parsed
+	maxDepth     int                 // the most depth may reach; see SetMaxDepth
 }
 
+// DefaultMaxDepth is how deeply expressions and blocks may nest unless
+// SetMaxDepth says otherwise
+const DefaultMaxDepth = 200
+
+// New lexes all of l's input up front, so the parser can back up over
+// tokens it has already read
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l}
+	p := &Parser{tokens: lexer.Record(l), intBits: 32, maxDepth: DefaultMaxDepth, pragmas: make(map[int]token.Token)}
 
-	// Initialize by reading the first token into peekToken
-	p.peekToken = p.l.NextToken()
-	// Then advance to set up currentToken and peekToken
+	// Read the first two tokens into currentToken and peekToken, passing
+	// over comments as nextToken does
+	p.nextToken()
 	p.nextToken()
 
 	return p
@@ -30,134 +64,434 @@ func New(l *lexer.Lexer) *Parser {
 func (p *Parser) nextToken() {
 	p.prevToken = p.currentToken
 	p.currentToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.tokens.NextToken()
+	for p.peekToken.Type == token.PRAGMA || p.peekToken.Type == token.COMMENT {
+		if p.peekToken.Type == token.PRAGMA {
+			p.pragmas[p.peekToken.Line] = p.peekToken
+		}
+		p.peekToken = p.tokens.NextToken()
+	}
+}
+
+// branchHint returns the hint a pragma comment gives the branch whose
+// header ends on the current line
+func (p *Parser) branchHint() ast.BranchHint {
+	tok, ok := p.pragmas[p.currentToken.Line]
+	if !ok {
+		return ast.NoHint
+	}
+	switch tok.Literal {
+	case "likely":
+		return ast.Likely
+	case "unlikely":
+		return ast.Unlikely
+	}
+	p.errorAt(tok, "unknown pragma '%s'; expected 'likely' or 'unlikely'", tok.Literal)
+	return ast.NoHint
+}
+
+// position is a point in the token stream that parsing can return to
+type position struct {
+	next                int // stream index of the token after peekToken
+	prev, current, peek token.Token
+	errors              int
+}
+
+// mark records the current position for a later backtrack
+func (p *Parser) mark() position {
+	return position{
+		next:    p.tokens.Pos(),
+		prev:    p.prevToken,
+		current: p.currentToken,
+		peek:    p.peekToken,
+		errors:  len(p.errors),
+	}
+}
+
+// backtrack returns to a marked position, dropping any errors reported
+// since, so an abandoned attempt at parsing leaves no trace
+func (p *Parser) backtrack(pos position) {
+	p.tokens.Seek(pos.next)
+	p.prevToken, p.currentToken, p.peekToken = pos.prev, pos.current, pos.peek
+	p.errors = p.errors[:pos.errors]
+	p.illegal = nil
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
-	// blockLevel := 0
-
-	for p.currentToken.Type != token.EOF {
-		// fmt.Printf("[L%d] Token: %s (%s) -> %s (%s)\n",
-		// 	blockLevel,
-		// 	p.currentToken.Type, p.currentToken.Literal,
-		// 	p.peekToken.Type, p.peekToken.Literal)
 
+	for !p.atEnd() {
 		// Skip newlines between statements
 		if p.currentToken.Type == token.NEWLINE {
-			// fmt.Printf("[L%d] Skipping newline\n", blockLevel)
 			p.nextToken()
 			continue
 		}
 
-		stmt := p.parseStatement()
-
-		// Check for errors first
-		if len(p.errors) > 0 {
-			// fmt.Printf("[L%d] Found error, discarding statements\n", blockLevel)
-			program.Statements = []ast.Statement{}
-			return program
-		}
-
-		// Only add statement if there were no errors
-		if stmt != nil {
+		start := p.mark()
+		if stmt := p.parseRecovering(); stmt != nil {
 			program.Statements = append(program.Statements, stmt)
-			// fmt.Printf("[L%d] Successfully added %T\n", blockLevel, stmt)
-		} else {
-			// If we couldn't parse a statement, that's a syntax error
-			p.addError(fmt.Sprintf("Unexpected token %s (%s)", p.currentToken.Type, p.currentToken.Literal))
-			// fmt.Printf("[L%d] Failed to parse statement, discarding\n", blockLevel)
-			program.Statements = []ast.Statement{}
-			return program
+		} else if p.currentToken.Type == token.DEDENT {
+			// Left over from an indented block that was skipped
+			p.nextToken()
+		}
+		if !p.progressed(start) {
+			p.nextToken()
 		}
 	}
 
+	if p.currentToken.Type == token.ILLEGAL {
+		p.illegalTokenError(p.currentToken)
+	}
 	return program
 }
 
+// atEnd reports whether the tokens have run out: at EOF, or at an ILLEGAL
+// token the lexer could not move past, which the stream then repeats
+func (p *Parser) atEnd() bool {
+	if p.currentToken.Type == token.EOF {
+		return true
+	}
+	return p.currentToken.Type == token.ILLEGAL && p.peekToken.Type == token.ILLEGAL &&
+		p.peekToken.Line == p.currentToken.Line && p.peekToken.Column == p.currentToken.Column
+}
+
+// progressed reports whether parsing has moved on from start. A loop over
+// statements that did not would try the same token forever, so the token
+// is reported for the caller to step past.
+func (p *Parser) progressed(start position) bool {
+	if p.tokens.Pos() != start.next || p.currentToken != start.current {
+		return true
+	}
+	p.errorAt(p.currentToken, "parser made no progress at token %s (%s)", p.currentToken.Type, p.currentToken.Literal)
+	return false
+}
+
+// enter goes a level deeper into nested expressions or blocks, or reports
+// that the input nests too deeply and returns false. Each successful enter
+// must be paired with a leave.
+func (p *Parser) enter() bool {
+	if p.depth >= p.maxDepth {
+		p.errorAt(p.currentToken, "nested more than %d levels deep; split the expression or block into smaller ones", p.maxDepth)
+		return false
+	}
+	p.depth++
+	return true
+}
+
+func (p *Parser) leave() {
+	p.depth--
+}
+
+// orNil returns s as a Statement, keeping a nil pointer nil rather than
+// turning it into a non-nil interface
+func orNil[T any, P interface {
+	*T
+	ast.Statement
+}](s P) ast.Statement {
+	if s == nil {
+		return nil
+	}
+	return s
+}
+
+// parseRecovering parses a statement, returning nil if it had errors. A
+// statement that failed part way is skipped, so parsing carries on with
+// the next one and reports the errors in that too.
+func (p *Parser) parseRecovering() ast.Statement {
+	errs := len(p.errors)
+	stmt := p.parseStatement()
+	if stmt == nil && len(p.errors) == errs {
+		switch {
+		case p.currentToken.Type == token.ILLEGAL:
+			p.illegalTokenError(p.currentToken)
+		case p.peekToken.Type == token.ILLEGAL:
+			// The statement stopped short of a token the lexer rejected,
+			// whose message says more
+			p.illegalTokenError(p.peekToken)
+		default:
+			p.unexpectedToken(p.currentToken)
+		}
+	}
+	if stmt != nil && len(p.errors) == errs && !p.ended(stmt) {
+		p.unexpectedToken(p.peekToken)
+		stmt = nil
+	}
+	if stmt == nil {
+		p.synchronize()
+	}
+	if len(p.errors) > errs {
+		// A statement parsed in full despite an error, such as an unknown
+		// pragma, has already consumed its line
+		return nil
+	}
+	return stmt
+}
+
+// unexpectedToken reports tok as out of place
+func (p *Parser) unexpectedToken(tok token.Token) {
+	switch tok.Type {
+	case token.NEWLINE:
+		p.errorAt(tok, "Unexpected end of line")
+	case token.EOF:
+		p.errorAt(tok, "Unexpected end of file")
+	case token.ILLEGAL:
+		p.illegalTokenError(tok)
+	default:
+		p.errorAt(tok, "Unexpected token %s (%s)", tok.Type, tok.Literal)
+	}
+}
+
+// ended reports whether stmt took up the rest of its line. A statement
+// other than a block is left on its last token if anything follows it.
+func (p *Parser) ended(stmt ast.Statement) bool {
+	switch stmt.(type) {
+	case *ast.IfStatement, *ast.WhileStatement, *ast.ForStatement, *ast.FunctionDefinition:
+		return true
+	}
+	switch p.currentToken.Type {
+	case token.NEWLINE, token.EOF, token.DEDENT:
+		return true
+	}
+	return false
+}
+
+// synchronize skips the rest of a statement that failed to parse: its line
+// and the indented block that follows it, if any. It stops on the first
+// token of the next statement, or on the DEDENT that ends the enclosing
+// block.
+func (p *Parser) synchronize() {
+	depth := 0
+	for !p.atEnd() {
+		switch p.currentToken.Type {
+		case token.INDENT:
+			depth++
+		case token.DEDENT:
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 {
+				p.nextToken()
+				return
+			}
+		case token.NEWLINE:
+			if depth == 0 && p.peekToken.Type != token.INDENT {
+				p.nextToken()
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseStatement() ast.Statement {
-	// fmt.Printf("[S] Parsing statement starting with %s (%s), peek=%s (%s)\n",
-	// 	p.currentToken.Type, p.currentToken.Literal,
-	// 	p.peekToken.Type, p.peekToken.Literal)
+	p.tracef("parse statement at %d:%d starting with %s %q", p.currentToken.Line, p.currentToken.Column, p.currentToken.Type, p.currentToken.Literal)
+	_, augmented := augmentedOperators[p.peekToken.Type]
+	if (p.peekToken.Type == token.ASSIGN || augmented) && p.currentToken.Type != token.IDENT &&
+		token.LookupIdent(p.currentToken.Literal) != token.IDENT {
+		p.reservedNameError(p.currentToken, "assigned to")
+		return nil
+	}
+
+	if p.currentToken.Type == token.IDENT && p.misspelledKeyword() {
+		return nil
+	}
 
 	var stmt ast.Statement
 	switch p.currentToken.Type {
 	case token.PRINT:
-		stmt = p.parsePrintStatement()
+		stmt = orNil(p.parsePrintStatement())
 	case token.IF:
-		stmt = p.parseIfStatement()
+		stmt = orNil(p.parseIfStatement())
 	case token.WHILE:
-		stmt = p.parseWhileStatement()
+		stmt = orNil(p.parseWhileStatement())
+	case token.FOR:
+		stmt = orNil(p.parseForStatement())
 	case token.DEF:
-		stmt = p.parseFunctionDefinition()
+		stmt = orNil(p.parseFunctionDefinition())
 	case token.RETURN:
-		stmt = p.parseReturnStatement()
+		stmt = orNil(p.parseReturnStatement())
+	case token.GLOBAL:
+		stmt = p.parseGlobalStatement()
+	case token.LPAREN:
+		// A call may be wrapped in parentheses, as in (f(x))
+		stmt = p.parseExpressionStatement()
 	case token.IDENT:
 		if p.peekToken.Type == token.ASSIGN {
-			stmt = p.parseAssignmentStatement()
+			stmt = orNil(p.parseAssignmentStatement())
+		} else if op, ok := augmentedOperators[p.peekToken.Type]; ok {
+			stmt = p.parseAugmentedAssignment(op)
+		} else if p.peekToken.Type == token.COLON {
+			stmt = p.parseAnnotatedAssignment()
+		} else if p.peekToken.Type == token.COMMA {
+			stmt = p.parseTupleAssignment()
 		} else {
 			stmt = p.parseExpressionStatement()
 		}
 	}
+	return stmt
+}
 
-	if stmt != nil {
-		// fmt.Printf("[S] Successfully parsed %T\n", stmt)
-	} else {
-		// fmt.Printf("[S] No statement parsed for %s\n", p.currentToken.Type)
+// augmentedOperators maps compound assignment tokens to their binary operator
+var augmentedOperators = map[token.TokenType]string{
+	token.PLUS_ASSIGN:     "+",
+	token.MINUS_ASSIGN:    "-",
+	token.ASTERISK_ASSIGN: "*",
+	token.SLASH_ASSIGN:    "/",
+	token.PERCENT_ASSIGN:  "%",
+	token.FLOOR_ASSIGN:    "//",
+	token.POWER_ASSIGN:    "**",
+}
+
+func (p *Parser) parseAugmentedAssignment(op string) ast.Statement {
+	tok := p.currentToken
+	p.nextToken() // move to the operator
+	p.nextToken() // move past it
+	value := p.parseExpression()
+	if value == nil {
+		return nil
+	}
+	return ast.NewAugmented(tok, tok.Literal, op, value)
+}
+
+// parseAnnotatedAssignment parses name: type = value. The checker decides
+// whether the type is one it knows.
+func (p *Parser) parseAnnotatedAssignment() ast.Statement {
+	tok := p.currentToken
+	p.nextToken() // move to ':'
+	if !p.expectPeek(token.IDENT) {
+		p.errorAt(p.currentToken, "expected a type after '%s:'", tok.Literal)
+		return nil
+	}
+	annotation := p.currentToken.Literal
+	if !p.expectPeek(token.ASSIGN) {
+		p.errorAt(tok, "annotated variable '%s' needs a value", tok.Literal)
+		return nil
 	}
+	p.nextToken() // move past =
+	value := p.parseExpression()
+	if value == nil {
+		return nil
+	}
+	stmt := ast.NewAssign(tok, tok.Literal, value)
+	stmt.Annotation = annotation
 	return stmt
 }
 
 func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
-	stmt := &ast.AssignmentStatement{Token: p.currentToken}
-	stmt.Name = p.currentToken.Literal
-	// fmt.Printf("[A] Starting assignment to %s\n", stmt.Name)
+	tok := p.currentToken
 
 	p.nextToken() // move to =
 	if p.currentToken.Type != token.ASSIGN {
-		p.addError("Expected '=' after identifier")
+		p.errorAt(p.currentToken, "Expected '=' after identifier")
 		return nil
 	}
 
 	p.nextToken() // move past =
-	stmt.Value = p.parseExpression()
-	if stmt.Value == nil {
-		// fmt.Printf("[A] Failed to parse value for assignment to %s\n", stmt.Name)
+	value := p.parseExpression()
+	if value == nil {
 		return nil
 	}
 
-	// fmt.Printf("[A] Finished assignment %s = %s\n",
-	// 	stmt.Name, stmt.Value.String())
-	return stmt
+	return ast.NewAssign(tok, tok.Literal, value)
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+// parseTupleAssignment parses a, b = x, y. A name followed by a comma
+// cannot start any other statement, as there are no tuple expressions.
+func (p *Parser) parseTupleAssignment() ast.Statement {
+	tok := p.currentToken
+	names := []string{tok.Literal}
+	for p.peekToken.Type == token.COMMA {
+		p.nextToken() // move to ,
+		if !p.expectPeek(token.IDENT) {
+			p.errorAt(p.peekToken, "expected a name after ',' in the names assigned to")
+			return nil
+		}
+		names = append(names, p.currentToken.Literal)
+	}
+	if !p.expectPeek(token.ASSIGN) {
+		p.errorAt(tok, "expected '=' after %s; names separated by commas can only be assigned to, as in %s = ...", strings.Join(names, ", "), strings.Join(names, ", "))
+		return nil
+	}
+
+	var values []ast.Expression
+	for {
+		p.nextToken() // move to the value
+		value := p.parseExpression()
+		if value == nil {
+			return nil
+		}
+		values = append(values, value)
+		if !p.expectPeek(token.COMMA) {
+			break
+		}
+	}
+	if len(values) != len(names) {
+		msg := fmt.Sprintf("cannot assign %d value(s) to %d names", len(values), len(names))
+		if call, ok := values[0].(*ast.FunctionCall); ok && len(values) == 1 {
+			msg += fmt.Sprintf("; '%s' returns a single value", call.Function)
+		}
+		p.errorAt(tok, "%s", msg)
+		return nil
+	}
+	return ast.NewTuple(tok, names, values)
+}
+
+// parseExpressionStatement parses an expression on a line of its own, or
+// an assignment to an element when the expression is an index followed by
+// '=' or an augmented operator
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	stmt := &ast.ExpressionStatement{}
-	// fmt.Printf("[E] Starting expression statement\n")
+	start := p.currentToken
 
 	stmt.Expression = p.parseExpression()
 	if stmt.Expression == nil {
 		return nil
 	}
+	if target, ok := stmt.Expression.(*ast.IndexExpression); ok {
+		if op, augmented := augmentedOperators[p.peekToken.Type]; augmented || p.peekToken.Type == token.ASSIGN {
+			return p.parseIndexAssignment(start, target, op)
+		}
+	}
 
 	// Advance past the expression if we're at EOF or have a newline
 	if p.peekToken.Type == token.EOF || p.peekToken.Type == token.NEWLINE {
 		p.nextToken()
 	}
 
-	// fmt.Printf("[E] Finished expression statement: %s\n", stmt.Expression.String())
 	return stmt
 }
 
+// parseIndexAssignment parses the rest of target = value, or target op=
+// value, from the operator on
+func (p *Parser) parseIndexAssignment(start token.Token, target *ast.IndexExpression, op string) ast.Statement {
+	p.nextToken() // move to the operator
+	p.nextToken() // move past it
+	value := p.parseExpression()
+	if value == nil {
+		return nil
+	}
+	if p.peekToken.Type == token.EOF || p.peekToken.Type == token.NEWLINE {
+		p.nextToken()
+	}
+	return ast.NewIndexAssign(start, target, op, value)
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	stmt := &ast.ReturnStatement{Token: p.currentToken}
-	// fmt.Printf("[R] Parsing return statement\n")
+	tok := p.currentToken
+
+	// A bare return ends the function without a value
+	switch p.peekToken.Type {
+	case token.NEWLINE, token.EOF, token.DEDENT:
+		p.nextToken()
+		return ast.NewReturn(tok, nil)
+	}
 
 	p.nextToken() // move past 'return'
 
-	stmt.Value = p.parseExpression()
-	if stmt.Value == nil {
+	value := p.parseExpression()
+	if value == nil {
 		return nil
 	}
 
@@ -166,17 +500,44 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 		p.nextToken()
 	}
 
-	// fmt.Printf("[R] Parsed return with value: %s\n", stmt.Value.String())
-	return stmt
+	return ast.NewReturn(tok, value)
+}
+
+// parseGlobalStatement parses global a, b
+func (p *Parser) parseGlobalStatement() ast.Statement {
+	tok := p.currentToken
+	var names []string
+	for {
+		if !p.expectPeek(token.IDENT) {
+			if token.LookupIdent(p.peekToken.Literal) != token.IDENT {
+				p.reservedNameError(p.peekToken, "declared global")
+				return nil
+			}
+			p.errorAt(p.peekToken, "expected a variable name after '%s'", p.currentToken.Literal)
+			return nil
+		}
+		names = append(names, p.currentToken.Literal)
+		if !p.expectPeek(token.COMMA) {
+			break
+		}
+	}
+
+	if p.peekToken.Type == token.EOF || p.peekToken.Type == token.NEWLINE {
+		p.nextToken()
+	}
+	return ast.NewGlobal(tok, names)
 }
 
 func (p *Parser) parseFunctionDefinition() *ast.FunctionDefinition {
 	stmt := &ast.FunctionDefinition{Token: p.currentToken}
-	// fmt.Printf("[F] Starting function definition\n")
 
 	// Expect function name
 	if p.peekToken.Type != token.IDENT {
-		p.addError("Expected function name after 'def'")
+		if token.LookupIdent(p.peekToken.Literal) != token.IDENT {
+			p.reservedNameError(p.peekToken, "used as a function name")
+			return nil
+		}
+		p.errorAt(p.peekToken, "Expected function name after 'def'")
 		return nil
 	}
 	p.nextToken()
@@ -184,18 +545,27 @@ func (p *Parser) parseFunctionDefinition() *ast.FunctionDefinition {
 
 	// Expect opening parenthesis
 	if p.peekToken.Type != token.LPAREN {
-		p.addError("Expected '(' after function name")
+		p.errorAt(p.peekToken, "Expected '(' after function name")
 		return nil
 	}
 	p.nextToken()
 
 	// Parse parameters
 	stmt.Parameters = []string{}
+	open := p.currentToken
 	p.nextToken() // move past '('
 
 	for p.currentToken.Type != token.RPAREN {
+		if p.currentToken.Type == token.EOF && p.prevToken.Type != token.COMMA {
+			p.errorAt(open, "'(' was never closed")
+			return nil
+		}
 		if p.currentToken.Type != token.IDENT {
-			p.addError("Expected parameter name")
+			if token.LookupIdent(p.currentToken.Literal) != token.IDENT {
+				p.reservedNameError(p.currentToken, "used as a parameter name")
+				return nil
+			}
+			p.errorAt(p.currentToken, "Expected parameter name")
 			return nil
 		}
 		stmt.Parameters = append(stmt.Parameters, p.currentToken.Literal)
@@ -208,14 +578,14 @@ func (p *Parser) parseFunctionDefinition() *ast.FunctionDefinition {
 
 	// Expect colon
 	if p.peekToken.Type != token.COLON {
-		p.addError("Expected ':' after parameters")
+		p.headerError(stmt.Token, "Expected ':' after parameters")
 		return nil
 	}
 	p.nextToken() // move to ':'
 
 	// Expect newline
 	if p.peekToken.Type != token.NEWLINE {
-		p.addError("Expected newline after ':'")
+		p.errorAt(p.peekToken, "Expected newline after ':'")
 		return nil
 	}
 	p.nextToken() // move to newline
@@ -227,200 +597,496 @@ func (p *Parser) parseFunctionDefinition() *ast.FunctionDefinition {
 		return nil
 	}
 
-	// fmt.Printf("[F] Finished parsing function '%s' with %d parameters\n",
-	// 	stmt.Name, len(stmt.Parameters))
 	return stmt
 }
 
+// Binding powers for the operators of an expression; a higher one binds
+// tighter
+const (
+	lowest = iota
+	orPrecedence
+	andPrecedence
+	notPrecedence
+	comparisonPrecedence
+	sumPrecedence
+	productPrecedence
+	unaryPrecedence // -x
+	powerPrecedence
+)
+
+// infixPrecedence is the binding power of each binary operator. ** is
+// right-associative, the comparisons chain, and the rest group left.
+var infixPrecedence = map[token.TokenType]int{
+	token.OR:  orPrecedence,
+	token.AND: andPrecedence,
+	token.LT:  comparisonPrecedence, token.GT: comparisonPrecedence, token.LE: comparisonPrecedence,
+	token.GE: comparisonPrecedence, token.EQ: comparisonPrecedence, token.NOT_EQ: comparisonPrecedence,
+	token.PLUS: sumPrecedence, token.MINUS: sumPrecedence,
+	token.ASTERISK: productPrecedence, token.SLASH: productPrecedence, token.FLOOR: productPrecedence, token.PERCENT: productPrecedence,
+	token.POWER: powerPrecedence,
+}
+
+// parseExpression parses a full expression, leaving the current token on
+// its last token, or on the newline or EOF that ends the line
 func (p *Parser) parseExpression() ast.Expression {
-	var leftExp ast.Expression
-	// fmt.Printf("[E] Parsing expression starting with %s (%s), peek=%s (%s)\n",
-	// 	p.currentToken.Type, p.currentToken.Literal,
-	// 	p.peekToken.Type, p.peekToken.Literal)
+	expr := p.parseBinding(lowest)
+	if expr != nil && (p.peekToken.Type == token.EOF || p.peekToken.Type == token.NEWLINE) {
+		p.nextToken()
+	}
+	return expr
+}
 
-	switch p.currentToken.Type {
-	case token.LPAREN:
-		return p.parseGroupedExpression()
-	case token.IDENT:
-		// Check if it's a function call
-		if p.peekToken.Type == token.LPAREN {
-			// fmt.Printf("[E] Found function call: %s\n", p.currentToken.Literal)
-			return p.parseFunctionCall()
-		}
-		// fmt.Printf("[E] Found identifier: %s\n", p.currentToken.Literal)
-		leftExp = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-	case token.INT:
-		// fmt.Printf("[E] Found integer: %s (peek: %s)\n", p.currentToken.Literal, p.peekToken.Type)
-		leftExp = &ast.IntegerLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
-	case token.STRING:
-		// fmt.Printf("[E] Found string: %s\n", p.currentToken.Literal)
-		leftExp = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
-	case token.EOF:
-		p.addError("'(' was never closed")
-		return nil
-	default:
-		// fmt.Printf("[E] Unhandled token type: %s\n", p.currentToken.Type)
+// parseBinding parses an operand and the operators that follow it for as
+// long as they bind tighter than minPrec
+func (p *Parser) parseBinding(minPrec int) ast.Expression {
+	if !p.enter() {
 		return nil
 	}
-
-	// Look for operators
-	if p.peekToken.Type == token.PLUS || p.peekToken.Type == token.ASTERISK ||
-		p.peekToken.Type == token.GT || p.peekToken.Type == token.LT {
+	defer p.leave()
+	left := p.parsePrefix(minPrec)
+	for left != nil {
+		prec := infixPrecedence[p.peekToken.Type]
+		if prec <= minPrec {
+			break
+		}
+		if prec == comparisonPrecedence {
+			left = p.parseComparison(left)
+			continue
+		}
 		op := p.peekToken
-		// fmt.Printf("[E] Found operator: %s, current=%s (%s), peek=%s (%s)\n",
-		// 	op.Literal, p.currentToken.Type, p.currentToken.Literal,
-		// 	p.peekToken.Type, p.peekToken.Literal)
-
 		p.nextToken() // consume operator
 		p.nextToken() // move to right operand
-
-		// fmt.Printf("[E] Parsing right side of %s, current=%s (%s), peek=%s (%s)\n",
-		// 	op.Literal, p.currentToken.Type, p.currentToken.Literal,
-		// 	p.peekToken.Type, p.peekToken.Literal)
-
-		rightExp := p.parseExpression()
-		if rightExp == nil {
-			fmt.Printf("[E] Failed to parse right side of %s\n", op.Literal)
+		if op.Type == token.POWER {
+			prec-- // so the right operand takes the next ** first
+		}
+		right := p.parseOperand(op, prec)
+		if right == nil {
 			return nil
 		}
+		left = ast.NewBinary(left, op.Literal, right)
+	}
+	return left
+}
+
+// parseOperand parses the right operand of op, reporting it missing if
+// nothing more specific was
+func (p *Parser) parseOperand(op token.Token, minPrec int) ast.Expression {
+	errs := len(p.errors)
+	operand := p.parseBinding(minPrec)
+	if operand == nil && len(p.errors) == errs {
+		p.errorAt(op, "Expected an operand after '%s'", op.Literal)
+		p.hint("'%s' needs a value on its right", op.Literal)
+	}
+	return operand
+}
 
-		binExp := &ast.BinaryExpression{
-			Left:     leftExp,
-			Operator: op.Literal,
-			Right:    rightExp,
+// parseComparison collects the run of comparisons that follows left, so
+// that 0 < x < 10 is one chain rather than (0 < x) < 10
+func (p *Parser) parseComparison(left ast.Expression) ast.Expression {
+	operands := []ast.Expression{left}
+	var ops []string
+	for infixPrecedence[p.peekToken.Type] == comparisonPrecedence {
+		op := p.peekToken
+		p.nextToken() // consume operator
+		p.nextToken() // move to right operand
+		right := p.parseOperand(op, comparisonPrecedence)
+		if right == nil {
+			return nil
 		}
-		// fmt.Printf("[E] Created binary expression: %s\n", binExp.String())
-		return binExp
+		ops = append(ops, op.Literal)
+		operands = append(operands, right)
+	}
+	if len(ops) == 1 {
+		return ast.NewBinary(operands[0], ops[0], operands[1])
 	}
+	return ast.NewComparison(operands, ops)
+}
 
-	// Advance past the expression if we're at EOF or have a newline
-	if p.peekToken.Type == token.EOF || p.peekToken.Type == token.NEWLINE {
+// parsePrefix parses the operand starting at the current token, with any
+// unary operator in front of it. It returns nil without an error when the
+// token cannot start an expression, leaving the caller to report it.
+func (p *Parser) parsePrefix(minPrec int) ast.Expression {
+	switch p.currentToken.Type {
+	case token.LPAREN:
+		if group := p.parseGroupedExpression(); group != nil {
+			return p.parseIndex(group)
+		}
+		return nil
+	case token.IDENT:
+		if p.peekToken.Type == token.LPAREN {
+			if call := p.parseFunctionCall(); call != nil {
+				return p.parseIndex(call)
+			}
+			return nil
+		}
+		if p.peekToken.Type == token.DOT {
+			if call := p.parseMethodCall(); call != nil {
+				return call
+			}
+			return nil
+		}
+		return p.parseIndex(&ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal})
+	case token.LBRACE:
+		return p.parseDictLiteral()
+	case token.LBRACKET:
+		if list := p.parseListLiteral(); list != nil {
+			return p.parseIndex(list)
+		}
+		return nil
+	case token.INT:
+		return &ast.IntegerLiteral{Token: p.currentToken, Value: p.parseInteger(p.currentToken, p.currentToken.Literal)}
+	case token.FLOAT:
+		return &ast.FloatLiteral{Token: p.currentToken, Value: p.parseFloat(p.currentToken)}
+	case token.STRING:
+		return &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+	case token.NONE:
+		return &ast.NoneLiteral{Token: p.currentToken}
+	case token.FSTRING:
+		return p.parseInterpolatedString()
+	case token.MINUS:
+		return p.parseNegation()
+	case token.NOT:
+		if minPrec > notPrecedence {
+			p.errorAt(p.currentToken, "'not' needs parentheses here, as in (not x)")
+			return nil
+		}
+		notTok := p.currentToken
 		p.nextToken()
+		errs := len(p.errors)
+		operand := p.parseBinding(notPrecedence)
+		if operand == nil {
+			if len(p.errors) == errs {
+				p.errorAt(notTok, "Expected an operand after 'not'")
+			}
+			return nil
+		}
+		return ast.NewPrefix(notTok, "not", operand)
+	case token.EOF:
+		if p.fragment {
+			p.errorAt(p.currentToken, "f-string: expression is incomplete before '}'")
+			return nil
+		}
+		// Outside a group the caller says what was missing
+		if len(p.groups) > 0 {
+			p.errorAt(p.groups[len(p.groups)-1], "'(' was never closed")
+		}
+	case token.ILLEGAL:
+		p.illegalTokenError(p.currentToken)
 	}
+	return nil
+}
 
-	// fmt.Printf("[E] Returning expression: %s\n", leftExp.String())
-	return leftExp
+// parseNegation parses a unary minus. It binds looser than **, since
+// -x ** 2 is -(x ** 2), and a number it applies to directly takes the sign.
+func (p *Parser) parseNegation() ast.Expression {
+	minusTok := p.currentToken
+	p.nextToken()
+	if p.peekToken.Type != token.POWER {
+		switch p.currentToken.Type {
+		case token.INT:
+			// Fold the sign into the literal so -2147483648 stays representable
+			return &ast.IntegerLiteral{Token: minusTok, Value: p.parseInteger(p.currentToken, "-"+p.currentToken.Literal)}
+		case token.FLOAT:
+			return &ast.FloatLiteral{Token: minusTok, Value: -p.parseFloat(p.currentToken)}
+		}
+	}
+	errs := len(p.errors)
+	operand := p.parseBinding(unaryPrecedence)
+	if operand == nil {
+		if len(p.errors) == errs {
+			p.errorAt(minusTok, "Expected an operand after '-'")
+		}
+		return nil
+	}
+	return ast.NewPrefix(minusTok, "-", operand)
 }
 
+// parseFunctionCall parses name(args...), leaving the current token on the
+// closing parenthesis. A trailing comma is allowed.
 func (p *Parser) parseFunctionCall() *ast.FunctionCall {
-	funcName := p.currentToken.Literal
-	// fmt.Printf("[F] Starting function call: %s\n", funcName)
-
 	call := &ast.FunctionCall{
 		Token:     p.currentToken,
-		Function:  funcName,
+		Function:  p.currentToken.Literal,
 		Arguments: []ast.Expression{},
 	}
 
-	// Move past function name and opening parenthesis
-	p.nextToken() // to (
-	p.nextToken() // past (
-
-	// Parse arguments
-	for p.currentToken.Type != token.RPAREN {
-		// fmt.Printf("[F] Parsing argument starting with %s (%s), peek=%s (%s)\n",
-		// 	p.currentToken.Type, p.currentToken.Literal,
-		// 	p.peekToken.Type, p.peekToken.Literal)
-
-		arg := p.parseExpression()
+	p.nextToken() // move to (
+	p.openGroup()
+	defer p.closeGroup()
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken() // move to the argument
+		arg := p.parseBinding(lowest)
 		if arg == nil {
 			return nil
 		}
 		call.Arguments = append(call.Arguments, arg)
+		if !p.expectPeek(token.COMMA) {
+			break
+		}
+	}
+	if !p.expectPeek(token.RPAREN) {
+		p.errorAt(p.peekToken, "Expected ',' or ')' after argument")
+		return nil
+	}
+	return call
+}
 
-		// fmt.Printf("[F] After parsing argument: current=%s (%s), peek=%s (%s)\n",
-		// 	p.currentToken.Type, p.currentToken.Literal,
-		// 	p.peekToken.Type, p.peekToken.Literal)
+// parseMethodCall parses receiver.name(args...), leaving the current token
+// on the closing parenthesis. The call gets the receiver as its first
+// argument.
+func (p *Parser) parseMethodCall() *ast.FunctionCall {
+	receiver := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	p.nextToken() // move to .
+	dot := p.currentToken
+	if !p.expectPeek(token.IDENT) {
+		p.errorAt(dot, "expected a method name after '.'")
+		return nil
+	}
+	if !p.peekTokenIs(token.LPAREN) {
+		p.errorAt(p.currentToken, "'%s.%s' is not supported; only methods can follow '.', as in %s.sort()", receiver.Value, p.currentToken.Literal, receiver.Value)
+		return nil
+	}
+	call := p.parseFunctionCall()
+	if call == nil {
+		return nil
+	}
+	call.Arguments = append([]ast.Expression{receiver}, call.Arguments...)
+	call.Method = true
+	return call
+}
 
-		// Move past the argument we just parsed
-		p.nextToken()
+// parseIndex parses the lookups following left, as in d["a"], (xs)[0] or
+// sorted(xs)[0], leaving the current token on the last ']'
+func (p *Parser) parseIndex(left ast.Expression) ast.Expression {
+	for p.peekToken.Type == token.LBRACKET {
+		p.nextToken() // move to [
+		tok := p.currentToken
+		p.nextToken() // move past [
+		index := p.parseBinding(lowest)
+		if index == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			p.errorAt(tok, "'[' was never closed")
+			return nil
+		}
+		left = ast.NewIndex(tok, left, index)
+	}
+	return left
+}
 
-		// Check what follows the argument
-		if p.currentToken.Type == token.COMMA {
-			p.nextToken() // move past comma to next argument
-		} else if p.currentToken.Type != token.RPAREN {
-			p.addError("Expected ',' or ')' after argument")
+// parseDictLiteral parses {key: value, ...}, leaving the current token on
+// the closing brace. A trailing comma is allowed.
+func (p *Parser) parseDictLiteral() ast.Expression {
+	dict := &ast.DictLiteral{Token: p.currentToken}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken() // move to the key
+		key := p.parseBinding(lowest)
+		if key == nil {
+			return nil
+		}
+		if !p.expectPeek(token.COLON) {
+			p.errorAt(dict.Token, "expected ':' after the dictionary key %s", key.String())
+			return nil
+		}
+		p.nextToken() // move past :
+		value := p.parseBinding(lowest)
+		if value == nil {
 			return nil
 		}
+		dict.Keys = append(dict.Keys, key)
+		dict.Values = append(dict.Values, value)
+		if !p.expectPeek(token.COMMA) {
+			break
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		p.errorAt(dict.Token, "'{' was never closed")
+		return nil
 	}
+	return dict
+}
 
-	// Consume the closing parenthesis
-	p.nextToken()
+// parseListLiteral parses [element, ...], leaving the current token on the
+// closing bracket. A trailing comma is allowed.
+func (p *Parser) parseListLiteral() ast.Expression {
+	open := p.currentToken
+	var elements []ast.Expression
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken() // move to the element
+		element := p.parseBinding(lowest)
+		if element == nil {
+			return nil
+		}
+		elements = append(elements, element)
+		if !p.expectPeek(token.COMMA) {
+			break
+		}
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		if p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.EOF) {
+			p.errorAt(open, "'[' was never closed")
+		} else {
+			p.errorAt(p.peekToken, "Expected ',' or ']' after element")
+		}
+		return nil
+	}
+	return ast.NewList(open, elements)
+}
 
-	// fmt.Printf("[F] Finished function call %s with %d arguments\n",
-	// 	funcName, len(call.Arguments))
-	return call
+// parseInterpolatedString splits the current f-string into its text and the
+// expressions between braces, parsing each expression on its own. {{ and }}
+// stand for literal braces.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	tok := p.currentToken
+	s := &ast.InterpolatedString{Token: tok}
+	var text strings.Builder
+	flush := func() bool {
+		if text.Len() == 0 {
+			return true
+		}
+		value, err := lexer.Unescape(text.String())
+		if err != nil {
+			p.errorAt(tok, "f-string: %s", err)
+			return false
+		}
+		s.Parts = append(s.Parts, &ast.StringLiteral{Token: tok, Value: value})
+		text.Reset()
+		return true
+	}
+	body := tok.Literal
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case (c == '{' || c == '}') && i+1 < len(body) && body[i+1] == c:
+			text.WriteByte(c)
+			i++
+		case c == '}':
+			p.errorAt(tok, "f-string: single '}' is not allowed; write '}}' for a brace")
+			return nil
+		case c == '{':
+			end := strings.IndexByte(body[i+1:], '}')
+			if end < 0 {
+				p.errorAt(tok, "f-string: expecting '}'")
+				return nil
+			}
+			source := body[i+1 : i+1+end]
+			if strings.TrimSpace(source) == "" {
+				p.errorAt(tok, "f-string: empty expression not allowed")
+				return nil
+			}
+			if !flush() {
+				return nil
+			}
+			// The text starts after f and the opening quote
+			expr := p.parseFragment(source, tok.Line, tok.Column+2+i+1)
+			if expr == nil {
+				return nil
+			}
+			s.Parts = append(s.Parts, expr)
+			i += end + 1
+		default:
+			text.WriteByte(c)
+		}
+	}
+	if !flush() {
+		return nil
+	}
+	return s
+}
+
+// parseFragment parses source, which sits at line and column of the
+// program, as one expression
+func (p *Parser) parseFragment(source string, line, column int) ast.Expression {
+	sub := New(lexer.NewAt(source, line, column))
+	sub.intBits, sub.fragment, sub.trace = p.intBits, true, p.trace
+	expr := sub.parseExpression()
+	if expr != nil && sub.peekToken.Type != token.EOF && sub.currentToken.Type != token.EOF {
+		sub.errorAt(sub.peekToken, "f-string: unexpected '%s' after the expression", sub.peekToken.Literal)
+	}
+	if len(sub.errors) > 0 {
+		p.errors = append(p.errors, sub.errors...)
+		return nil
+	}
+	return expr
 }
 
+// parseGroupedExpression parses (expr), leaving the current token on the
+// closing parenthesis
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	open := p.currentToken
+	p.openGroup()
+	defer p.closeGroup()
 	p.nextToken() // skip (
 
-	exp := p.parseExpression()
+	exp := p.parseBinding(lowest)
 	if exp == nil {
 		return nil
 	}
 
 	if !p.expectPeek(token.RPAREN) {
-		p.addError("'(' was never closed")
+		p.errorAt(open, "'(' was never closed")
 		return nil
 	}
+	return exp
+}
 
-	// Consume the closing parenthesis
-	p.nextToken()
+// openGroup records the current '(' as enclosing what is parsed until the
+// matching closeGroup, so running out of input can point back at it
+func (p *Parser) openGroup() {
+	p.groups = append(p.groups, p.currentToken)
+}
 
-	return exp
+func (p *Parser) closeGroup() {
+	p.groups = p.groups[:len(p.groups)-1]
 }
 
 func (p *Parser) parsePrintStatement() *ast.PrintStatement {
-	stmt := &ast.PrintStatement{Token: p.currentToken}
-	fmt.Printf("[P] Print: %s -> %s\n", p.currentToken.Literal, p.peekToken.Literal)
+	tok := p.currentToken
 
 	// Expect opening parenthesis after print
 	if p.peekToken.Type != token.LPAREN {
-		p.addError("Expected '(' after print")
+		p.errorAt(p.peekToken, "Expected '(' after print")
 		return nil
 	}
 	p.nextToken() // move to '('
+	p.openGroup()
+	defer p.closeGroup()
 	p.nextToken() // move to expression
 
 	// Parse the expression
-	stmt.Value = p.parseExpression()
-	if stmt.Value == nil {
+	value := p.parseExpression()
+	if value == nil {
 		return nil
 	}
 
 	// Expect closing parenthesis
 	if p.peekToken.Type != token.RPAREN {
-		p.addError("Expected ')' after expression")
+		p.errorAt(p.peekToken, "Expected ')' after expression")
 		return nil
 	}
 	p.nextToken() // move to ')'
-	p.nextToken() // move past ')'
+	if p.peekToken.Type == token.EOF || p.peekToken.Type == token.NEWLINE {
+		p.nextToken()
+	}
 
-	// fmt.Printf("[P] Parsed print(%s)\n", stmt.Value.String())
-	return stmt
+	return ast.NewPrint(tok, value)
 }
 
 func (p *Parser) parseIfStatement() *ast.IfStatement {
-	stmt := &ast.IfStatement{Token: p.currentToken}
-	// fmt.Printf("[IF] Starting with current=%s (%s), peek=%s (%s)\n",
-	// 	p.currentToken.Type, p.currentToken.Literal,
-	// 	p.peekToken.Type, p.peekToken.Literal)
+	tok := p.currentToken
 
 	p.nextToken() // skip if
-	fmt.Printf("[IF] Parsing condition starting with %s (%s)\n",
-		p.currentToken.Type, p.currentToken.Literal)
-	stmt.Condition = p.parseExpression()
-	if stmt.Condition == nil {
-		// fmt.Printf("[IF] Failed to parse condition\n")
+	condition := p.parseExpression()
+	if condition == nil {
 		return nil
 	}
-	// fmt.Printf("[IF] Parsed condition: %s\n", stmt.Condition.String())
 
 	if !p.expectPeek(token.COLON) {
-		p.addError("Expected ':' after if condition")
+		p.headerError(tok, "Expected ':' after if condition")
 		return nil
 	}
+	hint := p.branchHint()
 
 	// Skip newline after colon
 	if !p.expectPeek(token.NEWLINE) {
@@ -433,14 +1099,20 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 	}
 
 	// Parse the consequence (if body)
-	stmt.Consequence = p.parseBlockStatement()
-	if stmt.Consequence == nil {
+	consequence := p.parseBlockStatement()
+	if consequence == nil {
 		return nil
 	}
+	stmt := ast.NewIf(tok, condition, consequence, nil)
+	stmt.Hint = hint
 
-	fmt.Printf("[IF] After consequence, current=%s (%s), peek=%s (%s)\n",
-		p.currentToken.Type, p.currentToken.Literal,
-		p.peekToken.Type, p.peekToken.Literal)
+	for p.currentToken.Type == token.ELIF {
+		clause := p.parseElifClause()
+		if clause == nil {
+			return nil
+		}
+		stmt.Elifs = append(stmt.Elifs, clause)
+	}
 
 	// Check for else
 	if p.currentToken.Type == token.ELSE {
@@ -462,22 +1134,124 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 		}
 	}
 
-	// fmt.Printf("IF: finished with current=%s, peek=%s\n", p.currentToken.Type, p.peekToken.Type)
 	return stmt
 }
 
+// parseElifClause parses one elif branch, leaving the token after its block
+// current so further elif and else clauses can follow
+func (p *Parser) parseElifClause() *ast.ElifClause {
+	clause := &ast.ElifClause{Token: p.currentToken}
+
+	p.nextToken() // skip elif
+	clause.Condition = p.parseExpression()
+	if clause.Condition == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.COLON) {
+		p.headerError(clause.Token, "Expected ':' after elif condition")
+		return nil
+	}
+	clause.Hint = p.branchHint()
+	if !p.expectPeek(token.NEWLINE) {
+		return nil
+	}
+	if !p.expectPeek(token.INDENT) {
+		return nil
+	}
+
+	clause.Consequence = p.parseBlockStatement()
+	if clause.Consequence == nil {
+		return nil
+	}
+	return clause
+}
+
+// parseForStatement parses for i in range(stop), for i in range(start, stop)
+// and for i in range(start, stop, step)
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	tok := p.currentToken
+
+	if !p.expectPeek(token.IDENT) {
+		p.errorAt(tok, "Expected a loop variable after 'for'")
+		return nil
+	}
+	variable := p.currentToken.Literal
+
+	if !p.expectPeek(token.IN) {
+		p.errorAt(tok, "Expected 'in' after the loop variable")
+		return nil
+	}
+	if p.peekToken.Type != token.IDENT || p.peekToken.Literal != "range" {
+		p.errorAt(tok, "for loops can only iterate over range()")
+		return nil
+	}
+	p.nextToken() // move to range
+	if !p.expectPeek(token.LPAREN) {
+		p.errorAt(tok, "Expected '(' after range")
+		return nil
+	}
+	p.openGroup()
+	defer p.closeGroup()
+
+	var args []ast.Expression
+	for {
+		p.nextToken() // move to the argument
+		arg := p.parseExpression()
+		if arg == nil {
+			return nil
+		}
+		args = append(args, arg)
+		if !p.expectPeek(token.COMMA) {
+			break
+		}
+	}
+	if !p.expectPeek(token.RPAREN) {
+		p.errorAt(tok, "'(' was never closed")
+		return nil
+	}
+	var start, stop, step ast.Expression
+	switch len(args) {
+	case 1:
+		stop = args[0]
+	case 2:
+		start, stop = args[0], args[1]
+	case 3:
+		start, stop, step = args[0], args[1], args[2]
+	default:
+		p.errorAt(tok, "range() takes one to three arguments, got %d", len(args))
+		return nil
+	}
+
+	if !p.expectPeek(token.COLON) {
+		p.headerError(tok, "Expected ':' after for header")
+		return nil
+	}
+	if !p.expectPeek(token.NEWLINE) {
+		return nil
+	}
+	if !p.expectPeek(token.INDENT) {
+		return nil
+	}
+
+	body := p.parseBlockStatement()
+	if body == nil {
+		return nil
+	}
+	return ast.NewFor(tok, variable, start, stop, step, body)
+}
+
 func (p *Parser) parseWhileStatement() *ast.WhileStatement {
-	stmt := &ast.WhileStatement{Token: p.currentToken}
-	// fmt.Printf("WHILE: starting with current=%s, peek=%s\n", p.currentToken.Type, p.peekToken.Type)
+	tok := p.currentToken
 
 	p.nextToken() // skip while
-	stmt.Condition = p.parseExpression()
-	if stmt.Condition == nil {
+	condition := p.parseExpression()
+	if condition == nil {
 		return nil
 	}
 
 	if !p.expectPeek(token.COLON) {
-		p.addError("Expected ':' after while condition")
+		p.headerError(tok, "Expected ':' after while condition")
 		return nil
 	}
 
@@ -492,67 +1266,213 @@ func (p *Parser) parseWhileStatement() *ast.WhileStatement {
 	}
 
 	// Parse the body
-	stmt.Body = p.parseBlockStatement()
-	if stmt.Body == nil {
+	body := p.parseBlockStatement()
+	if body == nil {
 		return nil
 	}
 
-	// fmt.Printf("WHILE: finished with current=%s, peek=%s\n", p.currentToken.Type, p.peekToken.Type)
-	return stmt
+	return ast.NewWhile(tok, condition, body)
 }
 
+// parseBlockStatement parses the statements of an indented block. The
+// result is never nil once the block has begun, even if every statement in
+// it was reported and skipped.
 func (p *Parser) parseBlockStatement() []ast.Statement {
-	var statements []ast.Statement
-	blockLevel := 1 // increment nesting level
+	statements := []ast.Statement{}
 
 	// We should be at INDENT token
 	if p.currentToken.Type != token.INDENT {
-		// fmt.Printf("[B] Expected INDENT, got %s\n", p.currentToken.Type)
 		return nil
 	}
+	if !p.enter() {
+		return nil
+	}
+	defer p.leave()
+	p.tracef("parse block opening on line %d", p.currentToken.Line)
 	p.nextToken() // move past INDENT
 
-	// fmt.Printf("[B] Starting block at %s (%s)\n",
-	// 	p.currentToken.Type, p.currentToken.Literal)
-
 	// Parse statements until we hit DEDENT
-	for p.currentToken.Type != token.DEDENT && p.currentToken.Type != token.EOF {
-		// fmt.Printf("[B%d] Token: %s (%s) -> %s (%s)\n",
-		// 	blockLevel,
-		// 	p.currentToken.Type, p.currentToken.Literal,
-		// 	p.peekToken.Type, p.peekToken.Literal)
-
+	for p.currentToken.Type != token.DEDENT && !p.atEnd() {
 		// Skip newlines between block statements
 		if p.currentToken.Type == token.NEWLINE {
-			// fmt.Printf("[B%d] Skipping block newline\n", blockLevel)
 			p.nextToken()
 			continue
 		}
 
-		stmt := p.parseStatement()
-		if stmt != nil {
-			// fmt.Printf("[B%d] Added block statement %T\n", blockLevel, stmt)
+		start := p.mark()
+		if stmt := p.parseRecovering(); stmt != nil {
 			statements = append(statements, stmt)
 		}
+		if !p.progressed(start) {
+			p.nextToken()
+		}
 	}
 
 	// Skip the DEDENT token
 	if p.currentToken.Type == token.DEDENT {
-		// fmt.Printf("[B%d] Exiting block at DEDENT\n", blockLevel)
+		p.tracef("parse block closing on line %d", p.currentToken.Line)
 		p.nextToken()
 	} else {
-		fmt.Printf("[B%d] Warning: Block ended without DEDENT at %s\n",
-			blockLevel, p.currentToken.Type)
+		p.tracef("parse block ended at %s without a dedent", p.currentToken.Type)
 	}
 
 	return statements
 }
 
-func (p *Parser) addError(msg string) {
-	p.errors = append(p.errors, fmt.Sprintf("line 1: %s", msg))
+// Position returns where parsing has got to: the line and column of the
+// current token
+func (p *Parser) Position() (line, column int) {
+	return p.currentToken.Line, p.currentToken.Column
+}
+
+// SetTrace makes p report each statement and block it parses to log
+func (p *Parser) SetTrace(log lexer.Logger) {
+	p.trace = log
+}
+
+func (p *Parser) tracef(format string, args ...interface{}) {
+	if p.trace != nil {
+		p.trace.Printf(format, args...)
+	}
+}
+
+// SetMaxDepth sets how deeply expressions and blocks may nest before
+// parsing reports an error rather than recursing further
+func (p *Parser) SetMaxDepth(n int) {
+	p.maxDepth = n
+}
+
+// SetWordSize sets the integer width, 32 or 64 bits, that literals must fit in
+func (p *Parser) SetWordSize(bits int) {
+	p.intBits = bits
+}
+
+// parseInteger converts the text of an integer literal, decimal or with a
+// 0x, 0o or 0b prefix after any sign, reporting values that do not fit in a
+// register. The literal is still returned so parsing can continue.
+func (p *Parser) parseInteger(tok token.Token, text string) int64 {
+	sign, digits := "", text
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			digits = digits[2:]
+		}
+	}
+	v, err := strconv.ParseInt(sign+digits, base, p.intBits)
+	if err != nil {
+		p.errorAt(tok, "integer literal %s is out of range for a %d-bit integer", text, p.intBits)
+		p.hint("%d-bit integers run from %d to %d", p.intBits, int64(-1)<<(p.intBits-1), int64(1)<<(p.intBits-1)-1)
+	}
+	return v
+}
+
+// parseFloat reads a float literal. The code generator stores floats in
+// single precision, so a literal beyond its range is an error.
+func (p *Parser) parseFloat(tok token.Token) float64 {
+	if _, err := strconv.ParseFloat(tok.Literal, 32); err != nil {
+		p.errorAt(tok, "float literal %s is out of range for a 32-bit float", tok.Literal)
+	}
+	v, _ := strconv.ParseFloat(tok.Literal, 64)
+	return v
+}
+
+// headerError reports a block header such as if x > 0: that did not end in
+// ':'. The common mistakes get a message of their own: leaving the ':' off
+// the end of the line, and writing '=' in a condition.
+func (p *Parser) headerError(keyword token.Token, generic string) {
+	isCondition := keyword.Type == token.IF || keyword.Type == token.ELIF || keyword.Type == token.WHILE
+	switch {
+	case isCondition && p.peekToken.Type == token.ASSIGN:
+		assign := p.peekToken
+		p.errorAt(assign, "'=' assigns a value and cannot be used in the condition of '%s'; use '==' to compare", keyword.Literal)
+		p.suggest(diag.Replace("replace '=' with '==' to compare", assign.Line, assign.Column, assign.End(), "=="))
+	case p.currentToken.Type == token.NEWLINE:
+		p.missingColon(keyword, p.prevToken)
+	case p.peekToken.Type == token.NEWLINE || p.peekToken.Type == token.EOF:
+		p.missingColon(keyword, p.currentToken)
+	default:
+		p.errorAt(p.peekToken, "%s", generic)
+	}
+}
+
+func (p *Parser) missingColon(keyword, last token.Token) {
+	p.errorAt(keyword, "missing ':' at the end of the %s line; add it after '%s'", keyword.Literal, last.Literal)
+	p.suggest(diag.Insert("insert ':'", last.Line, last.End(), ":"))
+}
+
+// suggest attaches a fix to the error reported last
+func (p *Parser) suggest(fix diag.Fix) {
+	last := &p.errors[len(p.errors)-1]
+	last.Fixes = append(last.Fixes, fix)
+}
+
+// hint attaches a short note to the error reported last
+func (p *Parser) hint(format string, args ...interface{}) {
+	p.errors[len(p.errors)-1].Hint = fmt.Sprintf(format, args...)
+}
+
+// Fixes returns the fixes suggested for Errors()[i]
+func (p *Parser) Fixes(i int) []diag.Fix {
+	return p.errors[i].Fixes
+}
+
+// illegalTokenError reports a token the lexer could not make sense of.
+// The lexer spells out the longer problems, such as an unterminated string,
+// in the token's literal.
+func (p *Parser) illegalTokenError(tok token.Token) {
+	if p.illegal != nil && p.illegal.Line == tok.Line && p.illegal.Column == tok.Column {
+		return
+	}
+	p.illegal = &tok
+	if len(tok.Literal) > 1 {
+		p.errorAt(tok, "%s", tok.Literal)
+	} else {
+		p.errorAt(tok, "unexpected character '%s'", tok.Literal)
+	}
+}
+
+// errorAt reports an error spanning tok
+func (p *Parser) errorAt(tok token.Token, format string, args ...interface{}) {
+	p.errors = append(p.errors, Error{
+		Line:      tok.Line,
+		Column:    tok.Column,
+		EndColumn: tok.End(),
+		Message:   fmt.Sprintf(format, args...),
+	})
 }
 
+// reservedNameError reports a keyword or builtin used where a name is expected
+func (p *Parser) reservedNameError(tok token.Token, use string) {
+	kind := "reserved word"
+	if tok.Type == token.PRINT {
+		kind = "builtin function"
+	}
+	p.errorAt(tok, "'%s' is a %s and cannot be %s", tok.Literal, kind, use)
+	p.hint("pick another name")
+}
+
+// Errors returns the syntax errors formatted as "line N: message"
 func (p *Parser) Errors() []string {
+	var msgs []string
+	for _, err := range p.errors {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+// SyntaxErrors returns the syntax errors with their positions
+func (p *Parser) SyntaxErrors() []Error {
 	return p.errors
 }
 
@@ -3,11 +3,15 @@ package parser
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/arifali123/152compiler/packages/ast"
+	"github.com/arifali123/152compiler/packages/diag"
 	"github.com/arifali123/152compiler/packages/lexer"
+	"github.com/arifali123/152compiler/packages/token"
 )
 
 func TestParser_TestCase1(t *testing.T) {
@@ -210,6 +214,150 @@ func TestParser_ReturnStatement(t *testing.T) {
 	}
 }
 
+func TestParser_GlobalStatement(t *testing.T) {
+	input := "def f():\n\tglobal x, y\n\tx = 1\n"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn, ok := program.Statements[0].(*ast.FunctionDefinition)
+	if !ok || len(fn.Body) != 2 {
+		t.Fatalf("expected a function of two statements, got %s", ast.Dump(program))
+	}
+	stmt, ok := fn.Body[0].(*ast.GlobalStatement)
+	if !ok {
+		t.Fatalf("fn.Body[0] is not ast.GlobalStatement. got=%T", fn.Body[0])
+	}
+	if !reflect.DeepEqual(stmt.Names, []string{"x", "y"}) {
+		t.Errorf("wrong names. expected=[x y], got=%v", stmt.Names)
+	}
+}
+
+func TestParser_None(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"return", "Program\n  Return\n"},
+		{"x = None", "Program\n  Assignment x\n    None\n"},
+		{"if x == None:\n\treturn None\n", "Program\n  If\n    Binary ==\n      Identifier x\n      None\n    Then\n      Return\n        None\n"},
+		{"def f(x):\n\tprint(x)\n\treturn\n\ny = 1\n", "Program\n  FunctionDefinition f(x)\n    Body\n      Print\n        Identifier x\n      Return\n  Assignment y\n    Integer 1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := ast.Dump(program); got != tt.expected {
+				t.Errorf("wrong tree. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_Comments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"# heading\nx = 1 # one\n", "Program\n  Assignment x\n    Integer 1\n"},
+		{"if x:\n\t# why\n\treturn 1\n", "Program\n  If\n    Identifier x\n    Then\n      Return\n        Integer 1\n"},
+		{"while x:\n\tx = 0\n# not the end\n  # nor this\n\tprint(x)\n", "Program\n  While\n    Identifier x\n    Body\n      Assignment x\n        Integer 0\n      Print\n        Identifier x\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			for _, l := range []*lexer.Lexer{lexer.New(tt.input), lexer.New(tt.input).KeepComments()} {
+				p := New(l)
+				program := p.ParseProgram()
+				checkParserErrors(t, p)
+				if got := ast.Dump(program); got != tt.expected {
+					t.Errorf("wrong tree. expected=%q, got=%q", tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParser_BlankLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"before the first statement", "def f(x):\n\n\ty = x\n\n\treturn y\n", "Program\n  FunctionDefinition f(x)\n    Body\n      Assignment y\n        Identifier x\n      Return\n        Identifier y\n"},
+		{"holding tabs or spaces", "while x:\n\t\n\tx = 0\n  \n\t\t\n\tprint(x)\n", "Program\n  While\n    Identifier x\n    Body\n      Assignment x\n        Integer 0\n      Print\n        Identifier x\n"},
+		{"around comments and else", "if x:\n\n\t# why\n\n\ty = 1\n\nelse:\n\n\ty = 2\n", "Program\n  If\n    Identifier x\n    Then\n      Assignment y\n        Integer 1\n    Else\n      Assignment y\n        Integer 2\n"},
+		{"before a dedent", "def f(a):\n\twhile a:\n\n\t\ta = 0\n\n\treturn a\n", "Program\n  FunctionDefinition f(a)\n    Body\n      While\n        Identifier a\n        Body\n          Assignment a\n            Integer 0\n      Return\n        Identifier a\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := ast.Dump(program); got != tt.expected {
+				t.Errorf("wrong tree. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_LineContinuation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = f(1,\n      2)\n", "Program\n  Assignment x\n    Call f\n      Integer 1\n      Integer 2\n"},
+		{"x = [1,\n  # two\n\n2]\ny = x\n", "Program\n  Assignment x\n    List\n      Integer 1\n      Integer 2\n  Assignment y\n    Identifier x\n"},
+		{"if a and \\\n  b:\n\tx = (1 +\n2)\n", "Program\n  If\n    Binary and\n      Identifier a\n      Identifier b\n    Then\n      Assignment x\n        Binary +\n          Integer 1\n          Integer 2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := ast.Dump(program); got != tt.expected {
+				t.Errorf("wrong tree. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_InterpolatedString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`print(f"")`, "Program\n  Print\n    InterpolatedString\n"},
+		{`print(f"{{x}}")`, "Program\n  Print\n    InterpolatedString\n      String \"{x}\"\n"},
+		{`print(f"x is {x}!")`, "Program\n  Print\n    InterpolatedString\n      String \"x is \"\n      Identifier x\n      String \"!\"\n"},
+		{`print(f"{ a + f(1) }{d[k]}")`, "Program\n  Print\n    InterpolatedString\n      Binary +\n        Identifier a\n        Call f\n          Integer 1\n      Index\n        Identifier d\n        Identifier k\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := ast.Dump(program); got != tt.expected {
+				t.Errorf("wrong tree. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+
+	// Names inside the braces keep their place in the source
+	p := New(lexer.New("x = 1\nprint(f\"ab {x}\")\n"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	s := program.Statements[1].(*ast.PrintStatement).Value.(*ast.InterpolatedString)
+	if id := s.Parts[1].(*ast.Identifier); id.Token.Line != 2 || id.Token.Column != 13 {
+		t.Errorf("wrong position. expected=2:13, got=%d:%d", id.Token.Line, id.Token.Column)
+	}
+}
+
 func TestParser_PrintExpression(t *testing.T) {
 	input := `print(x + y)`
 	l := lexer.New(input)
@@ -233,6 +381,335 @@ func TestParser_PrintExpression(t *testing.T) {
 	}
 }
 
+func TestParser_NegativeNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = -5", "x = -5"},
+		{"x = -2147483648", "x = -2147483648"},
+		{"x = a - -3", "x = (a - -3)"},
+		{"x = -a", "x = (-a)"},
+		{"x = -a * 2", "x = ((-a) * 2)"},
+		{"x = f(-1)", "x = f(-1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+
+	p := New(lexer.New("x = -5"))
+	lit, ok := p.ParseProgram().Statements[0].(*ast.AssignmentStatement).Value.(*ast.IntegerLiteral)
+	if !ok || lit.Value != -5 {
+		t.Errorf("expected -5 to fold into an IntegerLiteral, got %#v", lit)
+	}
+}
+
+func TestParser_BasedIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"x = 0x1F", 31},
+		{"x = 0XFF", 255},
+		{"x = 0o17", 15},
+		{"x = 0b1010", 10},
+		{"x = -0x10", -16},
+		{"x = 0x7fffffff", 2147483647},
+		{"x = -0x80000000", -2147483648},
+		{"x = 1_000_000", 1000000},
+		{"x = -0x_7f_ff", -32767},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			lit, ok := program.Statements[0].(*ast.AssignmentStatement).Value.(*ast.IntegerLiteral)
+			if !ok || lit.Value != tt.expected {
+				t.Errorf("expected the literal %d, got %#v", tt.expected, lit)
+			}
+		})
+	}
+}
+
+func TestParser_AugmentedAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x += 1", "x += 1"},
+		{"x -= -2", "x -= -2"},
+		{"x *= a + 1", "x *= (a + 1)"},
+		{"x /= 2", "x /= 2"},
+		{"x %= a / b", "x %= (a / b)"},
+		{"x //= 2", "x //= 2"},
+		{"x **= 2", "x **= 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if len(program.Statements) != 1 {
+				t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+			}
+			if _, ok := program.Statements[0].(*ast.AugmentedAssignment); !ok {
+				t.Fatalf("expected *ast.AugmentedAssignment, got %T", program.Statements[0])
+			}
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_IndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs[0] = 1", "xs[0] = 1"},
+		{"xs[i + 1] = -2", "xs[(i + 1)] = -2"},
+		{"grid[i][j] = grid[j][i]", "grid[i][j] = grid[j][i]"},
+		{"xs[-1] += a * 2", "xs[-1] += (a * 2)"},
+		{"m[r][c] //= 2", "m[r][c] //= 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if len(program.Statements) != 1 {
+				t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+			}
+			if _, ok := program.Statements[0].(*ast.IndexAssignment); !ok {
+				t.Fatalf("expected *ast.IndexAssignment, got %T", program.Statements[0])
+			}
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_TupleAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a, b = 1, 2", "a, b = 1, 2"},
+		{"a, b = b, a", "a, b = b, a"},
+		{"x, y, z = y + 1, 0, f(x)", "x, y, z = (y + 1), 0, f(x)"},
+		{"x, y = f(y), g(x)", "x, y = f(y), g(x)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if len(program.Statements) != 1 {
+				t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+			}
+			if _, ok := program.Statements[0].(*ast.TupleAssignment); !ok {
+				t.Fatalf("expected *ast.TupleAssignment, got %T", program.Statements[0])
+			}
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_LogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = a and b", "x = (a and b)"},
+		{"x = a or b and c", "x = (a or (b and c))"},
+		{"x = a and b or c", "x = ((a and b) or c)"},
+		{"x = a or b or c", "x = ((a or b) or c)"},
+		{"x = not a and b", "x = ((not a) and b)"},
+		{"x = not not a", "x = (not (not a))"},
+		{"x = a > 0 and b < 10", "x = ((a > 0) and (b < 10))"},
+		{"x = not a < b", "x = (not (a < b))"},
+		{"x = a == b", "x = (a == b)"},
+		{"x = a != b and c <= d", "x = ((a != b) and (c <= d))"},
+		{"x = not a >= b", "x = (not (a >= b))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_Precedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 10 / 3 + 1", "x = ((10 / 3) + 1)"},
+		{"x = 1 + 2 * 3", "x = (1 + (2 * 3))"},
+		{"x = a - b - c", "x = ((a - b) - c)"},
+		{"x = a // b % c", "x = ((a // b) % c)"},
+		{"x = a + b < c * d", "x = ((a + b) < (c * d))"},
+		{"x = 2 * a ** 2", "x = (2 * (a ** 2))"},
+		{"x = 2 ** 3 ** 2", "x = (2 ** (3 ** 2))"},
+		{"x = -2 ** 2", "x = (-(2 ** 2))"},
+		{"x = -a ** 2 * 3", "x = ((-(a ** 2)) * 3)"},
+		{"x = 1.5 + 2. * 3", "x = (1.5 + (2.0 * 3))"},
+		{"x = -0.5 ** 2", "x = (-(0.5 ** 2))"},
+		{"x = 2 ** -3 ** 2", "x = (2 ** (-(3 ** 2)))"},
+		{"x = -2 * 3", "x = (-2 * 3)"},
+		{"x = 0 < a < 10", "x = (0 < a < 10)"},
+		{"x = a + 1 < b <= c * 2", "x = ((a + 1) < b <= (c * 2))"},
+		{"x = a == b != c and b < c", "x = ((a == b != c) and (b < c))"},
+		{"x = (1 + 2) * 3", "x = ((1 + 2) * 3)"},
+		{"x = f(a) + 1", "x = (f(a) + 1)"},
+		{"x = -(a) * 2", "x = ((-a) * 2)"},
+		{"x = - -a", "x = (-(-a))"},
+		{"x = ((a))", "x = a"},
+		{"x = f(g(a), -b) ** 2 < 3", "x = ((f(g(a), (-b)) ** 2) < 3)"},
+		{"x = d[a + 1] * 2 or not f(b)", "x = ((d[(a + 1)] * 2) or (not f(b)))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_NestedExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = (a + b) * (c + d)", "x = ((a + b) * (c + d))"},
+		{"x = (a + b) * (c + d) - e", "x = (((a + b) * (c + d)) - e)"},
+		{"x = f(g(h(1)) + 2)", "x = f((g(h(1)) + 2))"},
+		{"x = f(g(h(1)), (2 + h(3)) * 4)", "x = f(g(h(1)), ((2 + h(3)) * 4))"},
+		{"x = (((a + b) * c) - (d // (e + 1))) ** 2", "x = ((((a + b) * c) - (d // (e + 1))) ** 2)"},
+		{"x = -(a + b) ** (c - d)", "x = (-((a + b) ** (c - d)))"},
+		{"x = (f(a)) + (g(b) * (c))", "x = (f(a) + (g(b) * c))"},
+		{"x = (a < b) == (c < d)", "x = ((a < b) == (c < d))"},
+		{"x = not (a and b) or (c)", "x = ((not (a and b)) or c)"},
+		{"x = (xs)[0] + (d)[k]", "x = (xs[0] + d[k])"},
+		{"x = ((((((((((((((((((((((((((((((((((((((((a)))))))))))))))))))))))))))))))))))))))) + 1", "x = (a + 1)"},
+		{"x = ((((((((((((((((((((1 + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1)", "x = ((((((((((((((((((((1 + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1) + 1)"},
+		{"x = f(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(1)))))))))))))))))))))", "x = f(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(g(1)))))))))))))))))))))"},
+		{"(f(1))", "f(1)"},
+		{"((f((2))))", "f(2)"},
+		{"print((a + b) * c)", "print(((a + b) * c))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_Dict(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"d = {}", "d = {}"},
+		{`d = {"a": 1, 2: x + 1,}`, "d = {a: 1, 2: (x + 1)}"},
+		{`d = {"a": f(1), "b": g(2)}`, "d = {a: f(1), b: g(2)}"},
+		{`x = d["a"] * 2 + d[k]`, "x = ((d[a] * 2) + d[k])"},
+		{`x = -d["a"] ** 2`, "x = (-(d[a] ** 2))"},
+		{"x = d[f(1)]", "x = d[f(1)]"},
+		{"x = d[i + 1]", "x = d[(i + 1)]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_List(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"xs = []", "xs = []"},
+		{`xs = [3, "a", x + 1,]`, "xs = [3, a, (x + 1)]"},
+		{"x = xs[0] + len([f(1), 2])", "x = (xs[0] + len([f(1), 2]))"},
+		{"ys = sorted(reversed(xs))", "ys = sorted(reversed(xs))"},
+		{"x = sorted(xs)[-1] + [4, 5][i]", "x = (sorted(xs)[-1] + [4, 5][i])"},
+		{"xs.sort()", "xs.sort()"},
+		{"print(xs.reverse())", "print(xs.reverse())"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			checkParserErrors(t, p)
+			if got := program.String(); got != tt.expected {
+				t.Errorf("wrong program. expected=%q, got=%q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParser_AnnotatedAssignment(t *testing.T) {
+	p := New(lexer.New("c: uint8 = a + 1"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.AssignmentStatement)
+	if !ok {
+		t.Fatalf("expected *ast.AssignmentStatement, got %T", program.Statements[0])
+	}
+	if stmt.Name != "c" || stmt.Annotation != "uint8" {
+		t.Errorf("wrong assignment. name=%q, annotation=%q", stmt.Name, stmt.Annotation)
+	}
+	if got := program.String(); got != "c: uint8 = (a + 1)" {
+		t.Errorf("wrong program. got=%q", got)
+	}
+}
+
 func TestParser_ErrorCases(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -248,7 +725,71 @@ func TestParser_ErrorCases(t *testing.T) {
 		},
 		{
 			"if x > ",
-			"'(' was never closed",
+			"Expected an operand after '>'",
+		},
+		{
+			"print(f\"a}\")",
+			"f-string: single '}' is not allowed; write '}}' for a brace",
+		},
+		{
+			"print(f\"{x\")",
+			"f-string: expecting '}'",
+		},
+		{
+			"print(f\"{ }\")",
+			"f-string: empty expression not allowed",
+		},
+		{
+			"print(f\"{x y}\")",
+			"f-string: unexpected 'y' after the expression",
+		},
+		{
+			"print(f\"{x *}\")",
+			"f-string: expression is incomplete before '}'",
+		},
+		{
+			"print(f\"{x}\\q\")",
+			"f-string: unknown escape sequence '\\q'; write '\\\\' for a backslash",
+		},
+		{
+			"x = \"a\\q\"",
+			"unknown escape sequence '\\q'; write '\\\\' for a backslash",
+		},
+		{
+			"d = {\"a\" 1}",
+			"expected ':' after the dictionary key a",
+		},
+		{
+			"d = {\"a\": 1\n",
+			"'{' was never closed",
+		},
+		{
+			"x = d[1\n",
+			"'[' was never closed",
+		},
+		{
+			"if x: # pragma: often\n\tprint(x)\n",
+			"unknown pragma 'often'; expected 'likely' or 'unlikely'",
+		},
+		{
+			"for i in items:\n\tprint(i)\n",
+			"for loops can only iterate over range()",
+		},
+		{
+			"for i in range(1, 2, 3, 4):\n\tprint(i)\n",
+			"range() takes one to three arguments, got 4",
+		},
+		{
+			"for in range(3):\n\tprint(i)\n",
+			"Expected a loop variable after 'for'",
+		},
+		{
+			"a, b = f()\n",
+			"cannot assign 1 value(s) to 2 names; 'f' returns a single value",
+		},
+		{
+			"a, b = 1, 2, 3\n",
+			"cannot assign 3 value(s) to 2 names",
 		},
 		{
 			"def foo(x,",
@@ -260,12 +801,68 @@ func TestParser_ErrorCases(t *testing.T) {
 		},
 		{
 			"x = 5 +",
-			"'(' was never closed",
+			"Expected an operand after '+'",
 		},
 		{
 			"x = * 5",
 			"Unexpected token * (*)",
 		},
+		{
+			"print = 5",
+			"'print' is a builtin function and cannot be assigned to",
+		},
+		{
+			"while = 3",
+			"'while' is a reserved word and cannot be assigned to",
+		},
+		{
+			"def foo(x, while):",
+			"'while' is a reserved word and cannot be used as a parameter name",
+		},
+		{
+			"def return(x):",
+			"'return' is a reserved word and cannot be used as a function name",
+		},
+		{
+			"while += 3",
+			"'while' is a reserved word and cannot be assigned to",
+		},
+		{
+			"x = 2147483648",
+			"integer literal 2147483648 is out of range for a 32-bit integer",
+		},
+		{
+			"x = -2147483649",
+			"integer literal -2147483649 is out of range for a 32-bit integer",
+		},
+		{
+			"x = 0x80000000",
+			"integer literal 0x80000000 is out of range for a 32-bit integer",
+		},
+		{
+			"x = 99999999999999999999",
+			"integer literal 99999999999999999999 is out of range for a 32-bit integer",
+		},
+		{
+			"x: = 1",
+			"expected a type after 'x:'",
+		},
+		{
+			"x: int8",
+			"annotated variable 'x' needs a value",
+		},
+		{
+			"global",
+			"expected a variable name after 'global'",
+		},
+		{
+			"global x, 2",
+			"expected a variable name after ','",
+		},
+		{
+			"global print",
+			"'print' is a builtin function and cannot be declared global",
+		},
 	}
 
 	for i, tt := range tests {
@@ -281,9 +878,9 @@ func TestParser_ErrorCases(t *testing.T) {
 		}
 
 		// Check error message
-		if p.errors[0] != fmt.Sprintf("line 1: %s", tt.expectedError) {
+		if p.Errors()[0] != fmt.Sprintf("line 1: %s", tt.expectedError) {
 			t.Errorf("test[%d] - wrong error message. expected=%q, got=%q",
-				i, fmt.Sprintf("line 1: %s", tt.expectedError), p.errors[0])
+				i, fmt.Sprintf("line 1: %s", tt.expectedError), p.Errors()[0])
 		}
 
 		// We expect no statements when there's an error
@@ -294,6 +891,96 @@ func TestParser_ErrorCases(t *testing.T) {
 	}
 }
 
+func TestParser_ErrorProductions(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"if without colon", "x = 1\nif x > 1\n\tprint(x)\n", "line 2: missing ':' at the end of the if line; add it after '1'"},
+		{"elif without colon", "if x > 1:\n\ty = 1\nelif x > 0\n\ty = 2\n", "line 3: missing ':' at the end of the elif line; add it after '0'"},
+		{"while without colon", "while x < 3\n\tx += 1\n", "line 1: missing ':' at the end of the while line; add it after '3'"},
+		{"def without colon", "def f(a)\n\treturn a\n", "line 1: missing ':' at the end of the def line; add it after ')'"},
+		{"for without colon", "for i in range(3)\n\tprint(i)\n", "line 1: missing ':' at the end of the for line; add it after ')'"},
+		{"assignment in condition", "if x = 1:\n\tprint(x)\n", "line 1: '=' assigns a value and cannot be used in the condition of 'if'; use '==' to compare"},
+		{"assignment in loop condition", "while x = 1:\n\tprint(x)\n", "line 1: '=' assigns a value and cannot be used in the condition of 'while'; use '==' to compare"},
+		{"unterminated string", "x = 1\ny = \"abc\nprint(y)\n", "line 2: unterminated string literal; add a closing '\"' before the end of the line"},
+		{"unexpected character", "x = 1\ny = $\n", "line 2: unexpected character '$'"},
+		{"misspelled while", "x = 1\nwhlie x < 3:\n\tx += 1\n", "line 2: unknown statement 'whlie'; did you mean 'while'?"},
+		{"misspelled return", "def f(a):\n\tretrun a\n", "line 2: unknown statement 'retrun'; did you mean 'return'?"},
+		{"misspelled else", "if x > 0:\n\tx = 2\nesle:\n\tx = 3\n", "line 3: unknown statement 'esle'; did you mean 'else'?"},
+		{"misspelled def", "deff f(a):\n\treturn a\n", "line 1: unknown statement 'deff'; did you mean 'def'?"},
+		{"for on a later line", "x = 1\n\nfor 3 in range(4):\n\tprint(x)\n", "line 3: Expected a loop variable after 'for'"},
+		{"range arguments on a later line", "x = 1\nfor i in range(1, 2, 3, 4):\n\tprint(i)\n", "line 2: range() takes one to three arguments, got 4"},
+		{"names without assignment", "x = 1\nx, y\n", "line 2: expected '=' after x, y; names separated by commas can only be assigned to, as in x, y = ..."},
+		{"trailing comma without assignment", "x = 1\nx, \n", "line 2: expected a name after ',' in the names assigned to"},
+		{"number among names", "a, 3 = 1, 2\n", "line 1: expected a name after ',' in the names assigned to"},
+		{"and without operand", "x = 1\ny = x and\n", "line 2: Expected an operand after 'and'"},
+		{"not without operand", "if not:\n\tx = 1\n", "line 1: Expected an operand after 'not'"},
+		{"plus without operand", "x = 1\ny = x +\n", "line 2: Expected an operand after '+'"},
+		{"not after comparison", "x = a == not b\n", "line 1: 'not' needs parentheses here, as in (not x)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+			if errs := p.Errors(); len(errs) != 1 || errs[0] != tt.expected {
+				t.Errorf("wrong errors. expected=%q, got=%q", tt.expected, errs)
+			}
+		})
+	}
+}
+
+func TestParser_Fixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []diag.Fix
+	}{
+		{"missing colon", "x = 1\nif x > 1\n\tprint(x)\n", []diag.Fix{diag.Insert("insert ':'", 2, 9, ":")}},
+		{"missing colon after string", "while \"a\"\n\tx = 1\n", []diag.Fix{diag.Insert("insert ':'", 1, 10, ":")}},
+		{"assignment in condition", "if x = 1:\n\tprint(x)\n", []diag.Fix{diag.Replace("replace '=' with '==' to compare", 1, 6, 7, "==")}},
+		{"misspelled keyword", "whlie x < 3:\n\tx += 1\n", []diag.Fix{diag.Replace("replace 'whlie' with 'while'", 1, 1, 6, "while")}},
+		{"no fix", "print(1\n", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+			if len(p.Errors()) == 0 {
+				t.Fatalf("expected an error")
+			}
+			if got := p.Fixes(0); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("wrong fixes. expected=%+v, got=%+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClosestKeyword(t *testing.T) {
+	tests := []struct {
+		word     string
+		expected string
+	}{
+		{"whlie", "while"},
+		{"retrun", "return"},
+		{"wihle", "while"},
+		{"fi", "if"},
+		{"x", ""},
+		{"total", ""},
+		{"elf", "elif"},
+		{"globl", "global"},
+	}
+	for _, tt := range tests {
+		got, _ := closestKeyword(tt.word, headerKeywords)
+		if got != tt.expected {
+			t.Errorf("closestKeyword(%q) = %q, want %q", tt.word, got, tt.expected)
+		}
+	}
+}
+
 func TestParser_PrintExpressionErrors(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -338,9 +1025,9 @@ func TestParser_PrintExpressionErrors(t *testing.T) {
 		}
 
 		// Check error message
-		if p.errors[0] != fmt.Sprintf("line 1: %s", tt.expectedError) {
+		if p.Errors()[0] != fmt.Sprintf("line 1: %s", tt.expectedError) {
 			t.Errorf("test[%d] - wrong error message. expected=%q, got=%q",
-				i, fmt.Sprintf("line 1: %s", tt.expectedError), p.errors[0])
+				i, fmt.Sprintf("line 1: %s", tt.expectedError), p.Errors()[0])
 		}
 
 		// We expect no statements when there's an error
@@ -410,9 +1097,8 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 		return false
 	}
 
-	intVal, err := strconv.ParseInt(integ.Value, 10, 64)
-	if err != nil || intVal != value {
-		t.Errorf("integ.Value not %d. got=%s", value, integ.Value)
+	if integ.Value != value {
+		t.Errorf("integ.Value not %d. got=%d", value, integ.Value)
 		return false
 	}
 
@@ -446,3 +1132,235 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestParser_ErrorPositions(t *testing.T) {
+	tests := []struct {
+		name              string
+		input             string
+		line, column, end int
+	}{
+		{"unclosed group", "x = (2 + ", 1, 5, 6},
+		{"unclosed print", "x = 1\nprint(x + ", 2, 6, 7},
+		{"print without parentheses", "print x", 1, 7, 8},
+		{"def without parentheses", "def f x:\n\treturn x\n", 1, 7, 8},
+		{"integer out of range", "x = 1\n\ny = 99999999999\n", 3, 5, 16},
+		{"reserved name", "x = 1\nprint = 5\n", 2, 1, 6},
+		{"global without a name", "def f():\n\tglobal 3\n", 2, 9, 10},
+		{"unclosed list", "xs = [1, 2", 1, 6, 7},
+		{"list without a comma", "xs = [1 2]", 1, 9, 10},
+		{"attribute", "n = xs.size", 1, 8, 12},
+		{"unterminated string", "x = \"abc\n", 1, 5, 9},
+		{"unknown escape", "x = \"a\\qb\" + 1\n", 1, 5, 11},
+		{"bang in an expression", "x = 1 ! 2\n", 1, 7, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			p.ParseProgram()
+			errs := p.SyntaxErrors()
+			if len(errs) == 0 {
+				t.Fatalf("no error for %q", tt.input)
+			}
+			if e := errs[0]; e.Line != tt.line || e.Column != tt.column || e.EndColumn != tt.end {
+				t.Errorf("wrong position for %q. expected=%d:%d-%d, got=%d:%d-%d",
+					e.Message, tt.line, tt.column, tt.end, e.Line, e.Column, e.EndColumn)
+			}
+		})
+	}
+}
+
+func TestParser_ErrorHints(t *testing.T) {
+	tests := []struct {
+		input string
+		hint  string
+	}{
+		{"x = 1 +\n", "'+' needs a value on its right"},
+		{"print = 5\n", "pick another name"},
+		{"y = 99999999999\n", "32-bit integers run from -2147483648 to 2147483647"},
+		{"x = (1\n", ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.SyntaxErrors()
+		if len(errs) == 0 {
+			t.Fatalf("no error for %q", tt.input)
+		}
+		if errs[0].Hint != tt.hint {
+			t.Errorf("wrong hint for %q. expected=%q, got=%q", tt.input, tt.hint, errs[0].Hint)
+		}
+	}
+}
+
+func TestBacktrack(t *testing.T) {
+	p := New(lexer.New("x = 1 + 2\nprint(x)\n"))
+	start := p.mark()
+
+	p.errorAt(p.currentToken, "abandoned attempt")
+	for p.currentToken.Type != token.PRINT {
+		p.nextToken()
+	}
+	p.backtrack(start)
+
+	if len(p.Errors()) != 0 {
+		t.Errorf("backtrack kept errors: %v", p.Errors())
+	}
+	program := p.ParseProgram()
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements after backtracking, got %d: %v", len(program.Statements), program.Statements)
+	}
+	if got := program.Statements[0].String(); got != "x = (1 + 2)" {
+		t.Errorf("wrong first statement after backtracking: %q", got)
+	}
+}
+
+func TestParser_BranchHints(t *testing.T) {
+	input := "x = 1  # pragma: likely\nif x > 0:  # pragma: unlikely\n\tprint(1)\nelif x < 0: # pragma: likely\n\tprint(2)\nif x:\n\tprint(3)\n"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if len(program.Statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(program.Statements))
+	}
+	first := program.Statements[1].(*ast.IfStatement)
+	if first.Hint != ast.Unlikely || first.Elifs[0].Hint != ast.Likely {
+		t.Errorf("wrong hints. expected unlikely and likely, got %q and %q", first.Hint, first.Elifs[0].Hint)
+	}
+	if second := program.Statements[2].(*ast.IfStatement); second.Hint != ast.NoHint {
+		t.Errorf("expected no hint, got %q", second.Hint)
+	}
+}
+
+func TestParser_Limits(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		maxDepth int
+		errors   []string
+	}{
+		{
+			name:   "parentheses past the default depth",
+			input:  "x = " + strings.Repeat("(", 300) + "1" + strings.Repeat(")", 300) + "\n",
+			errors: []string{"line 1: nested more than 200 levels deep; split the expression or block into smaller ones"},
+		},
+		{
+			name:     "expression at the limit",
+			input:    "x = 2 ** 2 ** 2 ** 2\n",
+			maxDepth: 4,
+		},
+		{
+			name:     "expression past the limit",
+			input:    "x = -(1 + (2 * (3 - 4)))\n",
+			maxDepth: 3,
+			errors:   []string{"line 1: nested more than 3 levels deep; split the expression or block into smaller ones"},
+		},
+		{
+			name:     "blocks past the limit",
+			input:    "if a:\n\tif b:\n\t\tif c:\n\t\t\tx = 1\ny = 2\n",
+			maxDepth: 2,
+			errors:   []string{"line 3: nested more than 2 levels deep; split the expression or block into smaller ones"},
+		},
+		{name: "call open at the end", input: "print(f(\n", errors: []string{"line 1: '(' was never closed"}},
+		{name: "literals open at the end", input: "xs = [1, [2, {3: (\n", errors: []string{"line 1: '(' was never closed"}},
+		{name: "parameters open at the end", input: "def f(a, b\n", errors: []string{"line 1: '(' was never closed"}},
+		{name: "range open at the end", input: "for i in range(1,\n", errors: []string{"line 1: '(' was never closed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			if tt.maxDepth > 0 {
+				p.SetMaxDepth(tt.maxDepth)
+			}
+			p.ParseProgram()
+			if errs := p.Errors(); !reflect.DeepEqual(errs, tt.errors) && len(errs)+len(tt.errors) > 0 {
+				t.Errorf("wrong errors. expected=%q, got=%q", tt.errors, errs)
+			}
+		})
+	}
+}
+
+func TestParser_Recovery(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		errors     []string
+		statements string
+	}{
+		{
+			"statements around errors",
+			"x = * 5\ny = 2\nz = )\nprint(y)\n",
+			[]string{"line 1: Unexpected token * (*)", "line 3: Unexpected token ) ())"},
+			"y = 2\nprint(y)",
+		},
+		{
+			"header error skips its block",
+			"if x > 1\n\tprint(x)\n\tx = 2\ny = 3\n",
+			[]string{"line 1: missing ':' at the end of the if line; add it after '1'"},
+			"y = 3",
+		},
+		{
+			"errors inside a block",
+			"while y < 3:\n\ty = * 2\n\tdef return(a):\n\t\treturn a\n\ty += 1\nprint(y)\n",
+			[]string{"line 2: Unexpected token * (*)", "line 3: 'return' is a reserved word and cannot be used as a function name"},
+			"print(y)",
+		},
+		{
+			"token after a statement",
+			"pr}int(x)\ny = \nprint(1) 2\nx = 3\n",
+			[]string{"line 1: Unexpected token } (})", "line 2: Unexpected end of line", "line 3: Unexpected token INT (2)"},
+			"x = 3",
+		},
+		{
+			"nested block",
+			"if a:\n\tif b:\n\t\tx = )\n\ty = 2\nz = 3\n",
+			[]string{"line 3: Unexpected token ) ())"},
+			"z = 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(lexer.New(tt.input))
+			program := p.ParseProgram()
+			if !reflect.DeepEqual(p.Errors(), tt.errors) {
+				t.Errorf("wrong errors.\nexpected=%q\ngot=     %q", tt.errors, p.Errors())
+			}
+			var got []string
+			for _, stmt := range program.Statements {
+				got = append(got, stmt.String())
+			}
+			if strings.Join(got, "\n") != tt.statements {
+				t.Errorf("wrong statements. expected=%q, got=%q", tt.statements, got)
+			}
+		})
+	}
+}
+
+// traceLog collects the lines traced to it
+type traceLog []string
+
+func (t *traceLog) Printf(format string, args ...interface{}) {
+	*t = append(*t, fmt.Sprintf(format, args...))
+}
+
+func TestTrace(t *testing.T) {
+	var log traceLog
+	p := New(lexer.New("if x:\n\ty = 1\nz = 2\n"))
+	p.SetTrace(&log)
+	p.ParseProgram()
+	expected := []string{
+		`parse statement at 1:1 starting with IF "if"`,
+		"parse block opening on line 2",
+		`parse statement at 2:2 starting with IDENT "y"`,
+		"parse block closing on line 3",
+		`parse statement at 3:1 starting with IDENT "z"`,
+	}
+	if strings.Join(log, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong trace.\nexpected: %q\ngot:      %q", expected, log)
+	}
+}
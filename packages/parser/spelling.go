@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/token"
+)
+
+// Keywords that start a statement, split by what follows them
+var (
+	headerKeywords = []string{"def", "return", "global", "if", "elif", "while", "for"}
+	bareKeywords   = []string{"else"}
+)
+
+// misspelledKeyword reports an identifier in statement position that is
+// followed by what only a keyword could be followed by, as in whlie x < 3:
+// or esle:, when it is spelled close to such a keyword
+func (p *Parser) misspelledKeyword() bool {
+	var candidates []string
+	switch p.peekToken.Type {
+	case token.IDENT, token.INT, token.STRING, token.NOT:
+		candidates = headerKeywords
+	case token.COLON:
+		// Unlike esle:, an annotation such as x: int = 1 goes on after the ':'
+		pos := p.mark()
+		p.nextToken()
+		p.nextToken()
+		endsLine := p.currentToken.Type == token.NEWLINE || p.currentToken.Type == token.EOF
+		p.backtrack(pos)
+		if !endsLine {
+			return false
+		}
+		candidates = bareKeywords
+	default:
+		return false
+	}
+
+	tok := p.currentToken
+	keyword, ok := closestKeyword(tok.Literal, candidates)
+	if !ok {
+		return false
+	}
+	p.errorAt(tok, "unknown statement '%s'; did you mean '%s'?", tok.Literal, keyword)
+	p.suggest(diag.Replace("replace '"+tok.Literal+"' with '"+keyword+"'", tok.Line, tok.Column, tok.End(), keyword))
+	return true
+}
+
+// closestKeyword picks the candidate within a typo or two of word. Short
+// words only allow one edit, so that names like x are not taken for if.
+func closestKeyword(word string, candidates []string) (string, bool) {
+	limit := 1
+	if len(word) > 4 {
+		limit = 2
+	}
+	best, bestDistance := "", limit+1
+	for _, c := range candidates {
+		if d := editDistance(word, c); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best, best != ""
+}
+
+// editDistance counts the insertions, deletions, substitutions and swaps of
+// adjacent letters needed to turn a into b
+func editDistance(a, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d = min(d, rows[i-2][j-2]+1)
+			}
+			rows[i][j] = d
+		}
+	}
+	return rows[len(a)][len(b)]
+}
@@ -0,0 +1,115 @@
+package reduce
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/emulator"
+)
+
+// DefaultTimeout bounds one run of the reference interpreter when
+// Interpreter.Timeout is zero. Removing a loop's increment makes it run
+// forever, so every run needs a bound.
+const DefaultTimeout = 5 * time.Second
+
+// Crash is interesting when compiling with opts stops at an internal
+// compiler error, or produces assembly the emulator cannot load
+func Crash(opts compiler.Options) Test {
+	return func(source string) bool {
+		res, panicked := compile(source, opts)
+		if panicked {
+			return true
+		}
+		if res.Failed() {
+			return false
+		}
+		_, err := emulator.Load(res.Assembly)
+		return err != nil
+	}
+}
+
+// Diagnostic is interesting when compiling with opts reports a diagnostic
+// whose text, as diag.Diagnostic.String renders it, contains text
+func Diagnostic(opts compiler.Options, text string) Test {
+	return func(source string) bool {
+		res, panicked := compile(source, opts)
+		if panicked {
+			return false
+		}
+		for _, d := range res.Diagnostics {
+			if strings.Contains(d.String(), text) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Interpreter runs a program to find the output it should print
+type Interpreter struct {
+	Command []string      // the program and its arguments; the source file's path is added last
+	Timeout time.Duration // how long one run may take; 0 means DefaultTimeout
+}
+
+// WrongOutput is interesting when the program compiles with opts and, given
+// stdin, runs to completion both in the emulator and in the interpreter, and
+// they print different output. A program the interpreter rejects or that
+// never ends is not.
+func WrongOutput(opts compiler.Options, stdin string, py Interpreter) Test {
+	return func(source string) bool {
+		res, panicked := compile(source, opts)
+		if panicked || res.Failed() {
+			return false
+		}
+		var got bytes.Buffer
+		if _, err := emulator.Run(res.Assembly, emulator.Config{Stdin: strings.NewReader(stdin), Stdout: &got}); err != nil {
+			return false
+		}
+		want, ok := py.run(source, stdin)
+		return ok && got.String() != want
+	}
+}
+
+// run returns what source prints when the interpreter runs it, and whether
+// it finished successfully in time
+func (py Interpreter) run(source, stdin string) (string, bool) {
+	f, err := os.CreateTemp("", "reduce-*.py")
+	if err != nil {
+		return "", false
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(source)
+	if cerr := f.Close(); err != nil || cerr != nil {
+		return "", false
+	}
+
+	timeout := py.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	args := append(append([]string{}, py.Command[1:]...), f.Name())
+	cmd := exec.CommandContext(ctx, py.Command[0], args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	out, err := cmd.Output()
+	return string(out), err == nil
+}
+
+// compile compiles source, reporting a panic in the compiler. It recovers
+// from the panic itself, so that no stack trace is written for the many
+// candidates that crash.
+func compile(source string, opts compiler.Options) (res *compiler.Result, panicked bool) {
+	defer func() {
+		if recover() != nil {
+			res, panicked = nil, true
+		}
+	}()
+	opts.NoRecover = true
+	return compiler.CompileWith(source, opts), false
+}
@@ -0,0 +1,131 @@
+// Package reduce shrinks a program that shows a compiler bug to a smaller one
+// that still shows it, for a bug report or a regression test. Whether a
+// program still shows the bug is up to a Test, such as Crash, Diagnostic or
+// WrongOutput.
+//
+// Lines are removed by delta debugging: first large runs of them, then ever
+// smaller ones, keeping each removal after which the program is still
+// interesting. As a block's header cannot go without its body, each line is
+// also tried removed along with the lines indented under it. The result is
+// one-minimal: removing any single line or block from it loses the bug.
+package reduce
+
+import "strings"
+
+// Test reports whether source still shows the problem being reduced
+type Test func(source string) bool
+
+// Result is a reduced program
+type Result struct {
+	Source string
+	Tests  int // how many candidates were tested
+}
+
+// Lines removes as many of source's lines as it can while interesting still
+// holds. interesting should hold for source itself; if it does not, source
+// comes back unchanged.
+func Lines(source string, interesting Test) Result {
+	r := &reducer{interesting: interesting}
+	lines := strings.SplitAfter(source, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for {
+		n := len(lines)
+		lines = r.ddmin(lines)
+		lines = r.blocks(lines)
+		if len(lines) == n {
+			return Result{Source: strings.Join(lines, ""), Tests: r.tests}
+		}
+	}
+}
+
+type reducer struct {
+	interesting Test
+	tests       int
+}
+
+func (r *reducer) test(lines []string) bool {
+	r.tests++
+	return r.interesting(strings.Join(lines, ""))
+}
+
+// ddmin is Zeller's minimizing delta debugging over lines: split them into
+// n runs and keep one run, or all but one, when that is still interesting,
+// splitting finer while neither is
+func (r *reducer) ddmin(lines []string) []string {
+	n := 2
+	for len(lines) >= 2 {
+		runs := split(lines, n)
+		reduced := false
+		for i := range runs {
+			if len(runs) > 2 && r.test(runs[i]) {
+				lines, n, reduced = runs[i], 2, true
+				break
+			}
+			if rest := without(runs, i); r.test(rest) {
+				lines, n, reduced = rest, max(n-1, 2), true
+				break
+			}
+		}
+		if reduced {
+			continue
+		}
+		if n >= len(lines) {
+			break
+		}
+		n = min(2*n, len(lines))
+	}
+	return lines
+}
+
+// blocks removes each line along with the lines after it that are indented
+// deeper, or blank, when that is still interesting
+func (r *reducer) blocks(lines []string) []string {
+	for i := 0; i < len(lines); i++ {
+		end := i + 1
+		for end < len(lines) && (blank(lines[end]) || indent(lines[end]) > indent(lines[i])) {
+			end++
+		}
+		if end == i+1 {
+			continue // ddmin has tried the line on its own
+		}
+		rest := append(append([]string{}, lines[:i]...), lines[end:]...)
+		if r.test(rest) {
+			lines = rest
+			i--
+		}
+	}
+	return lines
+}
+
+// split divides lines into n runs of nearly equal length
+func split(lines []string, n int) [][]string {
+	runs := make([][]string, 0, n)
+	start := 0
+	for i := 0; i < n; i++ {
+		end := start + (len(lines)-start)/(n-i)
+		runs = append(runs, lines[start:end])
+		start = end
+	}
+	return runs
+}
+
+// without joins every run but the ith
+func without(runs [][]string, i int) []string {
+	var lines []string
+	for j, run := range runs {
+		if j != i {
+			lines = append(lines, run...)
+		}
+	}
+	return lines
+}
+
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func blank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
@@ -0,0 +1,90 @@
+package reduce
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/diag"
+)
+
+func TestLines(t *testing.T) {
+	// parses holds of a program the front end accepts
+	parses := func(source string) bool {
+		_, diags := compiler.Parse(source)
+		return !diag.HasErrors(diags)
+	}
+	tests := []struct {
+		name        string
+		input       string
+		interesting Test
+		expected    string
+	}{
+		{
+			"keeps the lines needed",
+			"a = 1\nb = 2\nx = 3\nc = 4\nprint(x)\nd = 5\n",
+			func(s string) bool { return strings.Contains(s, "x = 3\n") && strings.Contains(s, "print(x)") },
+			"x = 3\nprint(x)\n",
+		},
+		{
+			"removes a block with its header",
+			"def f():\n\ta = 1\n\n\treturn a\nif True:\n\tprint(2)\nprint(3)\n",
+			func(s string) bool { return parses(s) && strings.Contains(s, "print(3)") },
+			"print(3)\n",
+		},
+		{
+			"keeps a header its body needs",
+			"x = 0\nwhile x < 3:\n\tx += 1\n\tprint(x)\ny = 1\n",
+			func(s string) bool { return parses(s) && strings.Contains(s, "\tprint(x)") },
+			"while x < 3:\n\tprint(x)\n",
+		},
+		{
+			"not interesting to begin with",
+			"a = 1\nb = 2\n",
+			func(s string) bool { return false },
+			"a = 1\nb = 2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := Lines(tt.input, tt.interesting)
+			if res.Source != tt.expected {
+				t.Errorf("wrong result after %d tests. expected=%q, got=%q", res.Tests, tt.expected, res.Source)
+			}
+		})
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	_, err := exec.LookPath("python3")
+	hasPython := err == nil
+	py := Interpreter{Command: []string{"python3"}}
+
+	tests := []struct {
+		name     string
+		test     Test
+		input    string
+		expected bool
+		python   bool // needs python3 installed
+	}{
+		{"diagnostic reported", Diagnostic(compiler.Options{}, "mixes tabs and spaces"), "if x:\n\t y = 1\n", true, false},
+		{"diagnostic not reported", Diagnostic(compiler.Options{}, "mixes tabs and spaces"), "print(1)\n", false, false},
+		{"no crash", Crash(compiler.Options{}), "x = 1\nprint(x)\n", false, false},
+		{"no crash on a syntax error", Crash(compiler.Options{}), "x = = 1\n", false, false},
+		{"same output", WrongOutput(compiler.Options{}, "", py), "print(1 + 2)\n", false, true},
+		// Division of integers is floor division in the compiled language
+		{"different output", WrongOutput(compiler.Options{}, "", py), "print(7 / 2)\n", true, true},
+		{"rejected by the interpreter", WrongOutput(compiler.Options{}, "", py), "print(1 +)\n", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.python && !hasPython {
+				t.Skip("python3 is not installed")
+			}
+			if got := tt.test(tt.input); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package symbol
+
+import (
+	"encoding/json"
+
+	"github.com/arifali123/152compiler/packages/gensym"
+)
+
+// Clone returns a copy of the table that can be changed without affecting
+// it: its symbols, every enclosing scope and the numbering of temporaries
+// are copied too. Nodes bound to
+// the original, such as ast identifiers, keep pointing at its symbols.
+func (st *SymbolTable) Clone() *SymbolTable {
+	if st == nil {
+		return nil
+	}
+	c := *st
+	c.parent = st.parent.Clone()
+	if c.parent != nil {
+		c.temps = c.parent.temps
+	} else {
+		c.temps = gensym.New(st.temps.Last())
+	}
+	c.symbols = make(map[string]*Symbol, len(st.symbols))
+	for name, sym := range st.symbols {
+		c.symbols[name] = sym.clone()
+	}
+	return &c
+}
+
+func (s *Symbol) clone() *Symbol {
+	c := *s
+	c.FuncParams = append([]string(nil), s.FuncParams...)
+	return &c
+}
+
+// Merge copies every symbol of other into the table, replacing one of the
+// same name, so a clone that was checked speculatively can be kept. Only
+// this scope is merged. A replaced symbol keeps its address here; a symbol
+// new to the table takes the next free offset, as both tables may have
+// handed out the same offsets since the clone was made. Temporary numbering
+// continues after the larger of the two.
+func (st *SymbolTable) Merge(other *SymbolTable) {
+	for _, sym := range other.GetSymbols() {
+		c := sym.clone()
+		if old, ok := st.symbols[sym.Name]; ok {
+			c.Address = old.Address
+		} else {
+			c.Address = st.nextOffset
+			st.nextOffset += 4
+		}
+		st.symbols[sym.Name] = c
+	}
+	st.temps.Skip(other.temps.Last())
+}
+
+// tableJSON is the serialized form of a SymbolTable
+type tableJSON struct {
+	Scope      string     `json:"scope,omitempty"`
+	Symbols    []*Symbol  `json:"symbols"`
+	NextOffset int        `json:"nextOffset"`
+	TempCount  int        `json:"tempCount,omitempty"`
+	LoopDepth  int        `json:"loopDepth,omitempty"`
+	Function   string     `json:"function,omitempty"`
+	Parent     *tableJSON `json:"parent,omitempty"`
+}
+
+func (st *SymbolTable) toJSON() *tableJSON {
+	if st == nil {
+		return nil
+	}
+	return &tableJSON{
+		Scope:      st.scopeName,
+		Symbols:    st.GetSymbols(),
+		NextOffset: st.nextOffset,
+		TempCount:  st.temps.Last(),
+		LoopDepth:  st.loopDepth,
+		Function:   st.currentFunc,
+		Parent:     st.parent.toJSON(),
+	}
+}
+
+func (t *tableJSON) table() *SymbolTable {
+	if t == nil {
+		return nil
+	}
+	st := &SymbolTable{
+		symbols:     make(map[string]*Symbol, len(t.Symbols)),
+		parent:      t.Parent.table(),
+		scopeName:   t.Scope,
+		nextOffset:  t.NextOffset,
+		loopDepth:   t.LoopDepth,
+		currentFunc: t.Function,
+	}
+	if st.parent != nil {
+		st.temps = st.parent.temps
+	} else {
+		st.temps = gensym.New(t.TempCount)
+	}
+	for _, sym := range t.Symbols {
+		st.symbols[sym.Name] = sym
+	}
+	return st
+}
+
+// MarshalJSON writes the table with its symbols in definition order and
+// its enclosing scopes nested under "parent"
+func (st *SymbolTable) MarshalJSON() ([]byte, error) {
+	return json.Marshal(st.toJSON())
+}
+
+// UnmarshalJSON restores a table written by MarshalJSON
+func (st *SymbolTable) UnmarshalJSON(data []byte) error {
+	var t tableJSON
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	*st = *t.table()
+	return nil
+}
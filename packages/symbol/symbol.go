@@ -1,12 +1,19 @@
 package symbol
 
-import "fmt"
+import (
+	"sort"
+
+	"github.com/arifali123/152compiler/packages/gensym"
+)
 
 type SymbolType string
 
 const (
 	IntegerType  SymbolType = "INTEGER"
 	StringType   SymbolType = "STRING"
+	FloatType    SymbolType = "FLOAT"
+	DictType     SymbolType = "DICT"
+	ListType     SymbolType = "LIST"
 	FunctionType SymbolType = "FUNCTION"
 	BooleanType  SymbolType = "BOOLEAN" // For if conditions
 	VoidType     SymbolType = "VOID"    // For functions without return
@@ -14,15 +21,64 @@ const (
 
 // Enhanced Symbol struct
 type Symbol struct {
-	Name       string
-	Type       SymbolType
-	Address    int // Memory offset for MIPS
-	IsGlobal   bool
-	FuncParams []string // For function symbols
+	Name       string     `json:"name"`
+	Type       SymbolType `json:"type"`
+	Address    int        `json:"address"` // Memory offset for MIPS
+	IsGlobal   bool       `json:"global,omitempty"`
+	IsParam    bool       `json:"param,omitempty"`      // a function parameter, passed in an argument register
+	FuncParams []string   `json:"funcParams,omitempty"` // For function symbols
 	// New fields
-	IsTemp  bool   // For temporary computation results
-	IsPrint bool   // For print function
-	Scope   string // Track which scope ("global", "function", "if", "while")
+	IsTemp  bool       `json:"temp,omitempty"`   // For temporary computation results
+	IsPrint bool       `json:"print,omitempty"`  // For print function
+	Scope   string     `json:"scope,omitempty"`  // Track which scope ("global", "function", "if", "while")
+	Storage Storage    `json:"storage"`          // Layout in .data, chosen by a type annotation
+	Values  SymbolType `json:"values,omitempty"` // What a DictType variable maps its keys to, or a ListType one holds
+	Rows    SymbolType `json:"rows,omitempty"`   // What each list in a ListType variable holding lists holds
+}
+
+// Storage describes how an integer variable is laid out in memory
+type Storage struct {
+	Size     int  `json:"size,omitempty"`     // bytes; 0 means a full register word
+	Unsigned bool `json:"unsigned,omitempty"` // loads zero-extend rather than sign-extend
+}
+
+// storageTypes are the annotations that select a variable's storage
+var storageTypes = map[string]Storage{
+	"int":    {},
+	"int8":   {Size: 1},
+	"uint8":  {Size: 1, Unsigned: true},
+	"char":   {Size: 1, Unsigned: true},
+	"int16":  {Size: 2},
+	"uint16": {Size: 2, Unsigned: true},
+}
+
+// LookupStorage returns the storage a type annotation selects
+func LookupStorage(annotation string) (Storage, bool) {
+	s, ok := storageTypes[annotation]
+	return s, ok
+}
+
+// StorageNames returns the accepted type annotations, sorted
+func StorageNames() []string {
+	names := make([]string, 0, len(storageTypes))
+	for name := range storageTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Range returns the smallest and largest value the storage holds. A full
+// word is bounded by the register width instead and reports ok false.
+func (s Storage) Range() (min, max int64, ok bool) {
+	if s.Size == 0 {
+		return 0, 0, false
+	}
+	bits := uint(8 * s.Size)
+	if s.Unsigned {
+		return 0, 1<<bits - 1, true
+	}
+	return -1 << (bits - 1), 1<<(bits-1) - 1, true
 }
 
 type SymbolTable struct {
@@ -31,9 +87,9 @@ type SymbolTable struct {
 	scopeName  string
 	nextOffset int
 	// New fields
-	tempCount   int    // For generating temporary variable names
-	currentFunc string // Track current function for return statements
-	loopDepth   int    // Track nested loops
+	temps       *gensym.Generator // numbers temporaries; shared by every scope of a table
+	currentFunc string            // Track current function for return statements
+	loopDepth   int               // Track nested loops
 }
 
 // Enhanced methods
@@ -43,6 +99,11 @@ func NewSymbolTable(parent *SymbolTable) *SymbolTable {
 		parent:     parent,
 		nextOffset: 0,
 	}
+	if parent != nil {
+		st.temps = parent.temps
+	} else {
+		st.temps = gensym.New(0)
+	}
 
 	// Add built-in print function
 	if parent == nil { // Only in global scope
@@ -63,10 +124,21 @@ func (st *SymbolTable) DefinePrint() *Symbol {
 	return sym
 }
 
+// Names returns the generator that numbers the table's temporaries, which
+// its enclosing and nested scopes share
+func (st *SymbolTable) Names() *gensym.Generator {
+	return st.temps
+}
+
+// SetNames makes g number the temporaries of the table and of the scopes
+// entered from it afterwards, so a test can pin their names
+func (st *SymbolTable) SetNames(g *gensym.Generator) {
+	st.temps = g
+}
+
 // For temporary variables in expressions
 func (st *SymbolTable) NewTemp(symType SymbolType) *Symbol {
-	st.tempCount++
-	name := fmt.Sprintf("_t%d", st.tempCount)
+	name := st.temps.Name("_t")
 	sym := &Symbol{
 		Name:    name,
 		Type:    symType,
@@ -122,11 +194,18 @@ func (st *SymbolTable) Lookup(name string) (*Symbol, bool) {
 	return nil, false
 }
 
-// GetSymbols returns all symbols in the symbol table
+// GetSymbols returns all symbols in the symbol table in the order they were
+// defined, so that output built from them does not depend on map order
 func (st *SymbolTable) GetSymbols() []*Symbol {
 	symbols := make([]*Symbol, 0, len(st.symbols))
 	for _, sym := range st.symbols {
 		symbols = append(symbols, sym)
 	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if symbols[i].Address != symbols[j].Address {
+			return symbols[i].Address < symbols[j].Address
+		}
+		return symbols[i].Name < symbols[j].Name
+	})
 	return symbols
 }
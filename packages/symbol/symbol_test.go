@@ -1,6 +1,12 @@
 package symbol
 
-import "testing"
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/arifali123/152compiler/packages/gensym"
+)
 
 func TestSymbolTable_AllStatementTypes(t *testing.T) {
 	t.Run("Assignment Statements", func(t *testing.T) {
@@ -165,3 +171,178 @@ func TestSymbolTable_GetSymbols(t *testing.T) {
 		}
 	}
 }
+
+func TestStorage(t *testing.T) {
+	tests := []struct {
+		annotation string
+		size       int
+		min, max   int64
+	}{
+		{"int8", 1, -128, 127},
+		{"uint8", 1, 0, 255},
+		{"char", 1, 0, 255},
+		{"int16", 2, -32768, 32767},
+		{"uint16", 2, 0, 65535},
+	}
+	for _, tt := range tests {
+		s, ok := LookupStorage(tt.annotation)
+		if !ok {
+			t.Fatalf("LookupStorage(%q) failed", tt.annotation)
+		}
+		min, max, bounded := s.Range()
+		if s.Size != tt.size || !bounded || min != tt.min || max != tt.max {
+			t.Errorf("%s: got size %d, range %d to %d (bounded=%v)", tt.annotation, s.Size, min, max, bounded)
+		}
+	}
+
+	if s, ok := LookupStorage("int"); !ok || s.Size != 0 {
+		t.Errorf("int should select a full word, got %+v", s)
+	}
+	if _, _, bounded := (Storage{}).Range(); bounded {
+		t.Errorf("a full word should not report a range")
+	}
+	if _, ok := LookupStorage("float"); ok {
+		t.Errorf("float should not be a storage type")
+	}
+}
+
+func TestSymbolTable_Clone(t *testing.T) {
+	live := NewSymbolTable(nil)
+	live.Define("x", IntegerType)
+	fn := live.EnterScope("function")
+	fn.Define("a", IntegerType).IsParam = true
+
+	spec := fn.Clone()
+	spec.Define("b", StringType)
+	a, _ := spec.Lookup("a")
+	a.Type = FloatType
+	x, _ := spec.Lookup("x")
+	x.Type = StringType
+
+	if _, ok := fn.Lookup("b"); ok {
+		t.Error("symbol defined in the clone appeared in the original")
+	}
+	if a, _ := fn.Lookup("a"); a.Type != IntegerType {
+		t.Errorf("clone changed the original's symbol to %v", a.Type)
+	}
+	if x, _ := live.Lookup("x"); x.Type != IntegerType {
+		t.Errorf("clone changed the enclosing scope's symbol to %v", x.Type)
+	}
+
+	// Keeping the speculative copy
+	fn.Merge(spec)
+	if b, ok := fn.Lookup("b"); !ok || b.Type != StringType {
+		t.Errorf("merge did not add b: %+v", b)
+	}
+	if a, _ := fn.Lookup("a"); a.Type != FloatType || !a.IsParam {
+		t.Errorf("merge did not replace a: %+v", a)
+	}
+	if c := fn.Define("c", IntegerType); c.Address != 8 {
+		t.Errorf("merge reused an address: c at %d", c.Address)
+	}
+}
+
+func TestSymbolTable_MergeFreshOffsets(t *testing.T) {
+	live := NewSymbolTable(nil)
+	live.Define("x", IntegerType)
+	spec := live.Clone()
+
+	// Both tables hand out the offset after x
+	y := live.Define("y", IntegerType)
+	z := spec.Define("z", IntegerType)
+	if y.Address != z.Address {
+		t.Fatalf("expected y and z to share an offset before merging, got %d and %d", y.Address, z.Address)
+	}
+	spec.Define("w", StringType)
+
+	live.Merge(spec)
+	seen := make(map[int]string)
+	for _, sym := range live.GetSymbols() {
+		if other, ok := seen[sym.Address]; ok && !sym.IsPrint {
+			t.Errorf("%s and %s share address %d", other, sym.Name, sym.Address)
+		}
+		if !sym.IsPrint {
+			seen[sym.Address] = sym.Name
+		}
+	}
+	if y, _ := live.Lookup("y"); y.Address != 4 {
+		t.Errorf("merge moved y to %d", y.Address)
+	}
+	x, _ := live.Lookup("x")
+	if x.Address != 0 {
+		t.Errorf("merge moved x to %d", x.Address)
+	}
+	if next := live.Define("v", IntegerType); next.Address != 16 {
+		t.Errorf("expected the next offset after the merged symbols, got %d", next.Address)
+	}
+}
+
+func TestSymbolTable_JSON(t *testing.T) {
+	global := NewSymbolTable(nil)
+	global.Define("count", IntegerType).Storage = Storage{Size: 1, Unsigned: true}
+	global.Define("f", FunctionType).FuncParams = []string{"n"}
+	loop := global.EnterScope("while")
+	loop.NewTemp(IntegerType)
+
+	data, err := json.Marshal(loop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored SymbolTable
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	again, err := json.Marshal(&restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("round trip changed the table.\nbefore: %s\nafter:  %s", data, again)
+	}
+
+	if !restored.InLoop() {
+		t.Error("restored table lost its loop depth")
+	}
+	if sym, ok := restored.Lookup("count"); !ok || sym.Storage.Size != 1 || !sym.IsGlobal {
+		t.Errorf("restored table lost count from the enclosing scope: %+v", sym)
+	}
+	if sym, ok := restored.Lookup("f"); !ok || !reflect.DeepEqual(sym.FuncParams, []string{"n"}) {
+		t.Errorf("restored table lost f's parameters: %+v", sym)
+	}
+	if sym, ok := restored.Lookup("print"); !ok || !sym.IsPrint {
+		t.Error("restored table lost the print builtin")
+	}
+}
+
+func TestSymbolTable_TempNames(t *testing.T) {
+	global := NewSymbolTable(nil)
+	loop := global.EnterScope("while")
+	names := []string{global.NewTemp(IntegerType).Name, loop.NewTemp(IntegerType).Name, global.NewTemp(IntegerType).Name}
+	if names[0] != "_t1" || names[1] != "_t2" || names[2] != "_t3" {
+		t.Errorf("expected scopes to share one numbering, got %v", names)
+	}
+
+	// Another table numbers its own
+	if name := NewSymbolTable(nil).NewTemp(IntegerType).Name; name != "_t1" {
+		t.Errorf("expected a new table to start at _t1, got %s", name)
+	}
+
+	pinned := NewSymbolTable(nil)
+	pinned.SetNames(gensym.New(41))
+	if name := pinned.EnterScope("for").NewTemp(IntegerType).Name; name != "_t42" {
+		t.Errorf("expected the pinned generator to give _t42, got %s", name)
+	}
+
+	// A clone numbers on from the original without affecting it
+	clone := global.Clone()
+	if name := clone.NewTemp(IntegerType).Name; name != "_t4" {
+		t.Errorf("expected the clone to go on at _t4, got %s", name)
+	}
+	if global.Names().Last() != 3 {
+		t.Errorf("the clone advanced the original to %d", global.Names().Last())
+	}
+	global.Merge(clone)
+	if name := global.NewTemp(IntegerType).Name; name != "_t5" {
+		t.Errorf("expected numbering to go on after the merged clone at _t5, got %s", name)
+	}
+}
@@ -8,52 +8,113 @@ const (
 	EOF     = "EOF"
 
 	// Identifiers + literals
-	IDENT  = "IDENT"  // variable names, function names
-	INT    = "INT"    // 123
-	STRING = "STRING" // "hello"
+	IDENT   = "IDENT"   // variable names, function names
+	INT     = "INT"     // 123
+	FLOAT   = "FLOAT"   // 1.5
+	STRING  = "STRING"  // "hello"
+	FSTRING = "FSTRING" // f"x is {x}", with the text between the quotes as its literal
+	PRAGMA  = "PRAGMA"  // # pragma: likely, with the word after the colon as its literal
+	COMMENT = "COMMENT" // # text, only from a lexer keeping comments; the literal includes the #
 
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
 	MINUS    = "-"
 	ASTERISK = "*"
+	SLASH    = "/"
+	PERCENT  = "%"
+	FLOOR    = "//"
+	POWER    = "**"
 	LT       = "<"
 	GT       = ">"
+	EQ       = "=="
+	NOT_EQ   = "!="
+	LE       = "<="
+	GE       = ">="
+
+	// Compound assignment, desugared to name = name op value
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
+	FLOOR_ASSIGN    = "//="
+	POWER_ASSIGN    = "**="
 
 	// Delimiters
-	LPAREN  = "("
-	RPAREN  = ")"
-	COLON   = ":"
-	COMMA   = ","
-	NEWLINE = "NEWLINE" // Python uses newlines as statement separators
-	INDENT  = "INDENT"  // Python's indentation
-	DEDENT  = "DEDENT"  // Python's dedentation
+	LPAREN   = "("
+	RPAREN   = ")"
+	LBRACE   = "{"
+	RBRACE   = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
+	COLON    = ":"
+	COMMA    = ","
+	DOT      = "."       // Between a list and the method called on it, as in xs.sort()
+	NEWLINE  = "NEWLINE" // Python uses newlines as statement separators
+	INDENT   = "INDENT"  // Python's indentation
+	DEDENT   = "DEDENT"  // Python's dedentation
 
 	// Keywords
 	DEF    = "DEF"
 	RETURN = "RETURN"
+	GLOBAL = "GLOBAL"
 	IF     = "IF"
+	ELIF   = "ELIF"
 	ELSE   = "ELSE"
 	WHILE  = "WHILE"
+	FOR    = "FOR"
+	IN     = "IN"
+	AND    = "AND"
+	OR     = "OR"
+	NOT    = "NOT"
 	PRINT  = "PRINT" // Python's print function
+	NONE   = "NONE"
 )
 
-// Token represents a lexical token
+// Token represents a lexical token. Leading and Trailing are only set by a
+// lexer keeping trivia: Leading is the source text between the previous
+// token and this one, such as spaces, or the blank lines, comment lines and
+// indentation before the first token of a line. Trailing is the spaces and
+// comment after the last token of a line.
 type Token struct {
-	Type    TokenType
-	Literal string
-	Line    int
-	Column  int
+	Type     TokenType
+	Literal  string
+	Line     int
+	Column   int
+	Leading  string
+	Trailing string
+	// EndColumn is just past the token's source text when Literal does not
+	// spell it, as for a string, whose quotes and escapes are gone, a number
+	// whose underscores are, or an ILLEGAL token, whose literal explains the
+	// problem. Zero otherwise.
+	EndColumn int
+}
+
+// End is the column just past the token's source text
+func (t Token) End() int {
+	if t.EndColumn > 0 {
+		return t.EndColumn
+	}
+	return t.Column + len(t.Literal)
 }
 
 // Keywords map for quick lookup
 var keywords = map[string]TokenType{
 	"def":    DEF,
 	"return": RETURN,
+	"global": GLOBAL,
 	"if":     IF,
+	"elif":   ELIF,
 	"else":   ELSE,
 	"while":  WHILE,
+	"for":    FOR,
+	"in":     IN,
+	"and":    AND,
+	"or":     OR,
+	"not":    NOT,
 	"print":  PRINT,
+	"None":   NONE,
 }
 
 // LookupIdent checks if identifier is a keyword
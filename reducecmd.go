@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arifali123/152compiler/packages/cli"
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/reduce"
+)
+
+func reduceCommand() *cli.Command {
+	var crash, wrongOutput bool
+	var diagnostic, interpreter, input, output string
+	var timeout time.Duration
+	var opts compiler.Options
+	return &cli.Command{
+		Name:  "reduce",
+		Usage: "[flags] <file.py>",
+		Short: "shrink a program that shows a compiler bug to a smaller one that still does",
+		Long: `Exactly one of -crash, -diagnostic and -wrong-output says what the bug is.
+Lines and indented blocks are removed while the program still shows it, and
+the smallest program found is printed.`,
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&crash, "crash", false, "the compiler panics or writes assembly the emulator cannot load")
+			fs.StringVar(&diagnostic, "diagnostic", "", "a diagnostic containing `text` is reported")
+			fs.BoolVar(&wrongOutput, "wrong-output", false, "the program prints something other than the interpreter does")
+			fs.StringVar(&interpreter, "interpreter", "python3", "with -wrong-output, the `command` to run programs with")
+			fs.StringVar(&input, "input", "", "with -wrong-output, give the program standard input from `file`")
+			fs.DurationVar(&timeout, "timeout", reduce.DefaultTimeout, "with -wrong-output, give up on an interpreter run after `d`")
+			fs.StringVar(&output, "o", "", "write the reduced program to `file` instead of stdout")
+			fs.BoolVar(&opts.Optimize, "O", false, "compile with optimization")
+			fs.BoolVar(&opts.Codegen.Checked, "checked", false, "compile with run-time checks")
+		},
+		Run: func(ctx *cli.Context) error {
+			var interesting reduce.Test
+			chosen := 0
+			if crash {
+				chosen++
+				interesting = reduce.Crash(opts)
+			}
+			if diagnostic != "" {
+				chosen++
+				interesting = reduce.Diagnostic(opts, diagnostic)
+			}
+			if wrongOutput {
+				chosen++
+				command := strings.Fields(interpreter)
+				if len(command) == 0 {
+					return cli.Usagef("expected an interpreter command")
+				}
+				stdin := ""
+				if input != "" {
+					data, err := os.ReadFile(input)
+					if err != nil {
+						return fmt.Errorf("reading input: %w", err)
+					}
+					stdin = string(data)
+				}
+				interesting = reduce.WrongOutput(opts, stdin, reduce.Interpreter{Command: command, Timeout: timeout})
+			}
+			if chosen != 1 {
+				return cli.Usagef("expected exactly one of -crash, -diagnostic and -wrong-output")
+			}
+
+			path, source, err := readSource(ctx)
+			if err != nil {
+				return err
+			}
+			if !interesting(source) {
+				return fmt.Errorf("%s does not show the bug to begin with", path)
+			}
+			res := reduce.Lines(source, interesting)
+			fmt.Fprintf(ctx.Stderr, "reduced %d lines to %d in %d tests\n",
+				strings.Count(source, "\n"), strings.Count(res.Source, "\n"), res.Tests)
+			if output != "" {
+				return os.WriteFile(output, []byte(res.Source), 0644)
+			}
+			_, err = fmt.Fprint(ctx.Stdout, res.Source)
+			return err
+		},
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/cli"
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/emulator"
+	"github.com/arifali123/152compiler/packages/symbol"
+)
+
+const replHelp = `Enter statements to compile and run them. A line ending in ':' starts a
+block; finish it with an empty line.
+  :asm     show the instructions generated for each entry so far
+  :reset   forget all previous statements
+  :quit    leave the REPL`
+
+// replSession keeps the accepted source. Each entry recompiles and reruns the
+// whole session, and only output beyond what was already shown is printed.
+// The instructions for each entry on its own are generated once, when it is
+// accepted, in a global scope that lasts the session.
+type replSession struct {
+	source string
+	output string
+	gen    *codegen.CodeGenerator
+	env    *symbol.SymbolTable
+	asm    []string
+}
+
+func replCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "repl",
+		Usage: "",
+		Short: "interactively compile and run statements",
+		Long:  replHelp,
+		Run: func(ctx *cli.Context) error {
+			in := bufio.NewScanner(ctx.Stdin)
+			s := &replSession{}
+			fmt.Fprintln(ctx.Stdout, "152compiler REPL, :help for commands")
+
+			for {
+				entry, ok := readEntry(in, ctx)
+				if !ok {
+					fmt.Fprintln(ctx.Stdout)
+					return in.Err()
+				}
+				switch strings.TrimSpace(entry) {
+				case "":
+					continue
+				case ":quit", ":q", ":exit":
+					return nil
+				case ":help":
+					fmt.Fprintln(ctx.Stdout, replHelp)
+					continue
+				case ":reset":
+					*s = replSession{}
+					continue
+				case ":asm":
+					fmt.Fprint(ctx.Stdout, strings.Join(s.asm, ""))
+					continue
+				}
+				s.eval(ctx, entry)
+			}
+		},
+	}
+}
+
+// readEntry reads one statement, or a whole block when the first line ends in ':'
+func readEntry(in *bufio.Scanner, ctx *cli.Context) (string, bool) {
+	fmt.Fprint(ctx.Stdout, ">>> ")
+	if !in.Scan() {
+		return "", false
+	}
+	entry := in.Text() + "\n"
+	if !strings.HasSuffix(strings.TrimSpace(entry), ":") {
+		return entry, true
+	}
+	for {
+		fmt.Fprint(ctx.Stdout, "... ")
+		if !in.Scan() || strings.TrimSpace(in.Text()) == "" {
+			return entry, true
+		}
+		entry += in.Text() + "\n"
+	}
+}
+
+func (s *replSession) eval(ctx *cli.Context, entry string) {
+	candidate := s.source + entry
+	res := compiler.Compile(candidate)
+	r := &diag.Renderer{Out: ctx.Stderr, Color: diag.ColorEnabled(ctx.Stderr, noColor)}
+	r.RenderAll(res.Diagnostics)
+	if res.Failed() {
+		return
+	}
+
+	var out strings.Builder
+	_, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out})
+	if err != nil {
+		fmt.Fprintln(ctx.Stderr, err)
+		return
+	}
+
+	if strings.HasPrefix(out.String(), s.output) {
+		fmt.Fprint(ctx.Stdout, out.String()[len(s.output):])
+	} else {
+		fmt.Fprint(ctx.Stdout, out.String())
+	}
+	s.source, s.output = candidate, out.String()
+	s.generate(entry)
+}
+
+// generate records the instructions for an accepted entry, headed by the
+// entry itself as a comment
+func (s *replSession) generate(entry string) {
+	if s.gen == nil {
+		s.gen, s.env = codegen.New(nil), symbol.NewSymbolTable(nil)
+	}
+	program, _ := compiler.Parse(entry)
+	var text strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(entry, "\n"), "\n") {
+		text.WriteString("# " + line + "\n")
+	}
+	for _, stmt := range program.Statements {
+		for _, instruction := range s.gen.GenerateStatement(stmt, s.env) {
+			if !strings.HasSuffix(instruction, ":") {
+				text.WriteString("    ")
+			}
+			text.WriteString(instruction + "\n")
+		}
+	}
+	s.asm = append(s.asm, text.String())
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/cli"
+	"github.com/arifali123/152compiler/packages/compiler"
+	"github.com/arifali123/152compiler/packages/diag"
+	"github.com/arifali123/152compiler/packages/emulator"
+)
+
+// maxRequestSize caps uploaded source programs
+const maxRequestSize = 1 << 20
+
+type compileResponse struct {
+	Assembly    string            `json:"assembly,omitempty"`
+	Diagnostics []diag.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+type runResponse struct {
+	Output      string            `json:"output"`
+	ExitCode    int               `json:"exitCode"`
+	Steps       int               `json:"steps"`
+	Diagnostics []diag.Diagnostic `json:"diagnostics,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+func serveCommand() *cli.Command {
+	var addr string
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "[flags]",
+		Short: "serve the compiler over HTTP",
+		Long: `Endpoints take the program source as the POST body and answer with JSON:
+  POST /compile   {"assembly": ..., "diagnostics": [...]}
+  POST /assemble  the assembly as text/plain, streamed as it is generated, or
+                  {"diagnostics": [...]} with status 422 if the program is rejected
+  POST /report    {"failed": ..., "phases": [...], "symbols": {...}, "size": {...}, ...}
+  POST /run       {"output": ..., "exitCode": ..., "steps": ..., "diagnostics": [...], "error": ...}`,
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&addr, "addr", "localhost:8152", "listen `address`")
+		},
+		Run: func(ctx *cli.Context) error {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/compile", handleCompile)
+			mux.HandleFunc("/assemble", handleAssemble)
+			mux.HandleFunc("/run", handleRun)
+			mux.HandleFunc("/report", handleReport)
+			fmt.Fprintf(ctx.Stderr, "listening on http://%s\n", addr)
+			return http.ListenAndServe(addr, mux)
+		},
+	}
+}
+
+func readBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST the program source", http.StatusMethodNotAllowed)
+		return "", false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return string(body), true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("writing response: %v", err)
+	}
+}
+
+func handleCompile(w http.ResponseWriter, r *http.Request) {
+	source, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	res := compiler.Compile(source)
+	writeJSON(w, compileResponse{Assembly: res.Assembly, Diagnostics: res.Diagnostics})
+}
+
+// handleAssemble writes the assembly straight into the response rather than
+// into a JSON string, so a large program is not held in memory whole
+func handleAssemble(w http.ResponseWriter, r *http.Request) {
+	source, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	// The headers go out with the first write, which a rejected program
+	// never reaches, so they can still change below
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	out := &sentWriter{Writer: w}
+	res, err := compiler.CompileTo(out, source, compiler.Options{})
+	if err != nil {
+		log.Printf("writing response: %v", err)
+		return
+	}
+	if res.Failed() {
+		if out.sent {
+			// Code generation panicked after part of the assembly went out
+			// as a success; the client can only see it cut short
+			log.Printf("assembly cut short: %s", res.Internal.Value)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		if err := json.NewEncoder(w).Encode(compileResponse{Diagnostics: res.Diagnostics}); err != nil {
+			log.Printf("writing response: %v", err)
+		}
+	}
+}
+
+// sentWriter notes whether anything has been written through it
+type sentWriter struct {
+	io.Writer
+	sent bool
+}
+
+func (w *sentWriter) Write(p []byte) (int, error) {
+	w.sent = w.sent || len(p) > 0
+	return w.Writer.Write(p)
+}
+
+func handleReport(w http.ResponseWriter, r *http.Request) {
+	source, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, compiler.Compile(source).Report())
+}
+
+func handleRun(w http.ResponseWriter, r *http.Request) {
+	source, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	res := compiler.Compile(source)
+	if res.Failed() {
+		writeJSON(w, runResponse{Diagnostics: res.Diagnostics})
+		return
+	}
+
+	var out strings.Builder
+	result, err := emulator.Run(res.Assembly, emulator.Config{Stdout: &out})
+	resp := runResponse{Output: out.String(), Diagnostics: res.Diagnostics}
+	if result != nil {
+		resp.ExitCode, resp.Steps = result.ExitCode, result.Steps
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	writeJSON(w, resp)
+}
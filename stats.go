@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/arifali123/152compiler/packages/codegen"
+	"github.com/arifali123/152compiler/packages/emulator"
+	"github.com/arifali123/152compiler/packages/opt"
+)
+
+// writeLoopStats prints what the loop analysis proved about each while loop
+// next to what the run actually cost: the instructions the loop compiled to,
+// how many of them executed and over how many iterations
+func writeLoopStats(w io.Writer, loops []opt.Loop, labels []codegen.LoopLabels, m *emulator.Machine, result *emulator.Result) {
+	fmt.Fprintf(w, "%d instructions executed\n", result.Steps)
+
+	byLine := make(map[int]codegen.LoopLabels)
+	for _, l := range labels {
+		byLine[l.Line] = l
+	}
+	for _, loop := range loops {
+		where := "top level"
+		if loop.Function != "" {
+			where = loop.Function
+		}
+		fmt.Fprintf(w, "\nloop on line %d (%s): while %s\n", loop.Line, where, loop.Condition)
+
+		var ivs []string
+		for _, iv := range loop.Induction {
+			desc := fmt.Sprintf("%s step %+d", iv.Name, iv.Step)
+			if iv.StartKnown {
+				desc = fmt.Sprintf("%s from %d step %+d", iv.Name, iv.Start, iv.Step)
+			}
+			ivs = append(ivs, desc)
+		}
+		if len(ivs) == 0 {
+			ivs = append(ivs, "none")
+		}
+		fmt.Fprintf(w, "  induction variables: %s\n", strings.Join(ivs, ", "))
+		if loop.Trips >= 0 {
+			fmt.Fprintf(w, "  trip count: %d per entry\n", loop.Trips)
+		} else {
+			fmt.Fprintf(w, "  trip count: unknown\n")
+		}
+
+		l, ok := byLine[loop.Line]
+		if !ok {
+			continue
+		}
+		start, okStart := m.LabelIndex(l.Start)
+		body, okBody := m.LabelIndex(l.Body)
+		end, okEnd := m.LabelIndex(l.End)
+		if !okStart || !okBody || !okEnd {
+			continue
+		}
+		executed := 0
+		for _, n := range result.Profile[start:end] {
+			executed += n
+		}
+		fmt.Fprintf(w, "  instructions: %d in the loop, %d executed over %d iterations\n",
+			end-start, executed, result.Profile[body])
+	}
+}
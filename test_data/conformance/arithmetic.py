@@ -0,0 +1,20 @@
+# output: 10
+# output: 4
+# output: 21
+# output: 2
+# output: 1
+# output: -3
+# output: 2
+# output: 1024
+# output: 40
+x = 7
+y = 3
+print(x + y)
+print(x - y)
+print(x * y)
+print(x // y)
+print(x % y)
+print(-x // y)
+print(-x % y)
+print(2 ** 10)
+print((x + y) * (x - y))
@@ -0,0 +1,23 @@
+# output: 1
+# output: -1
+# output: 0
+# output: inside
+# output: chained
+def sign(n):
+	if n > 0:
+		return 1
+	elif n < 0:
+		return -1
+	else:
+		return 0
+
+print(sign(5))
+print(sign(-3))
+print(sign(0))
+a = 3
+if a > 1 and a < 5:
+	print("inside")
+if not a == 3 or a > 10:
+	print("never")
+if 1 < a < 4:
+	print("chained")
@@ -0,0 +1,6 @@
+# error: 4:16: dictionary keys must be all strings or all integers
+# error: 4:23: dictionary values must be all strings or all integers
+# error: 5: duplicate parameter 'x' in function 'f'
+d = {1: "one", "two": 2}
+def f(x, x):
+	return x
@@ -0,0 +1,12 @@
+# output: 3.0
+# output: 3.5
+# output: -4.0
+# output: 0.25
+# output: 3.25
+x = 1.5
+print(x * 2)
+print(7 / 2.0)
+print(-7.5 // 2)
+print(2.0 ** -2)
+i = 3
+print(i + 0.25)
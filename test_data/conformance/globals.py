@@ -0,0 +1,13 @@
+# output: 2
+# output: 16
+count = 0
+
+def bump():
+	global count
+	count = count + 1
+
+bump()
+bump()
+print(count)
+SIZE = 4
+print(SIZE * SIZE)
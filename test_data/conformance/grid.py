@@ -0,0 +1,11 @@
+# output: [[8, 0, 0], [0, 0, 7]]
+# output: [[1, 6], [3, 4]]
+# output: [3, 4]
+g = zeros(2, 3)
+g[1][2] = 7
+g[0][0] = g[1][2] + 1
+print(g)
+rows = [[1, 2], [3, 4]]
+rows[0][1] = rows[1][0] * 2
+print(rows)
+print(rows[1])
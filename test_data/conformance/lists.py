@@ -0,0 +1,16 @@
+# output: [3, 1, 2, 5]
+# output: 4
+# output: 8
+# output: [1, 2, 3, 5]
+# output: 11
+# output: 5
+# output: [3, 10, 2, 5]
+xs = [3, 1, 2, 5]
+print(xs)
+print(len(xs))
+print(xs[0] + xs[3])
+print(sorted(xs))
+print(sum(xs))
+print(max(xs))
+xs[1] = 10
+print(xs)
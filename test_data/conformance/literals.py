@@ -0,0 +1,15 @@
+# output: 31
+# output: 15
+# output: 10
+# output: 240
+# output: -255
+# output: 1000000
+# output: 65535
+print(0x1F)
+print(0o17)
+print(0b1010)
+mask = 0xF0
+print(mask + 0b0)
+print(-0xff)
+print(1_000_000)
+print(0xFF_FF)
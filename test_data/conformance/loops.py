@@ -0,0 +1,24 @@
+# output: 10
+# output: 0
+# output: 1
+# output: 2
+# output: 10
+# output: 7
+# output: 4
+# output: 1
+# output: 11
+total = 0
+i = 0
+while i < 5:
+	total = total + i
+	i = i + 1
+print(total)
+for j in range(3):
+	print(j)
+for k in range(10, 0, -3):
+	print(k)
+n = 0
+for a in range(1, 4):
+	for b in range(a):
+		n += a * b
+print(n)
@@ -0,0 +1,16 @@
+# output: hello world
+# output: hello world!
+# output: ordered
+# output: equal
+# output: world and hello world
+# output: 3 items
+name = "world"
+greeting = "hello " + name
+print(greeting)
+print(greeting + "!")
+if "apple" < "banana":
+	print("ordered")
+if name == "world":
+	print("equal")
+print(f"{name} and {greeting}")
+print("%d items" % 3)
@@ -0,0 +1,14 @@
+# output: 2
+# output: 1
+# output: 1
+# output: 2
+a = 1
+b = 2
+t = a
+a = b
+b = t
+print(a)
+print(b)
+a, b = b, a
+print(a)
+print(b)
@@ -0,0 +1,6 @@
+# warning: 4:1: the result of '==' is never used; did you mean '=' to assign to 'x'?
+# output: 1
+x = 1
+x == 2
+x + 1  # noqa
+print(x)